@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/restic/restic/internal/cache"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/restic"
+)
+
+// checkStateBatchSize is the number of packs which are read before the check
+// state is saved.
+const checkStateBatchSize = 500
+
+// checkState records the packs verified by an interrupted check --read-data,
+// such that a later run can skip them.
+type checkState struct {
+	// Selection describes the packs to read, a state is only resumed for the
+	// same selection.
+	Selection string     `json:"selection"`
+	Verified  restic.IDs `json:"verified"`
+}
+
+// stateCacheDir returns the cache directory used to store the state of check
+// and scrub. The state is kept even if the cache is disabled or temporary.
+func stateCacheDir(gopts GlobalOptions) (string, error) {
+	if gopts.CacheDir != "" {
+		return gopts.CacheDir, nil
+	}
+	return cache.DefaultDir()
+}
+
+// checkStateFile returns the filename of the check state for the repository
+// with the given ID. The state is stored in the cache directory.
+func checkStateFile(cacheDir string, repoID string) string {
+	return filepath.Join(cacheDir, repoID, "check-state.json")
+}
+
+// loadCheckState reads the state from filename. If the file does not exist or
+// the state is for a different selection, an empty state is returned.
+func loadCheckState(filename string, selection string) (*checkState, error) {
+	buf, err := os.ReadFile(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return &checkState{Selection: selection}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var state checkState
+	err = json.Unmarshal(buf, &state)
+	if err != nil {
+		return nil, errors.Errorf("invalid check state %v: %v", filename, err)
+	}
+
+	if state.Selection != selection {
+		return &checkState{Selection: selection}, nil
+	}
+	return &state, nil
+}
+
+// save atomically writes the state to filename.
+func (s *checkState) save(filename string) error {
+	buf, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	err = fs.MkdirAll(filepath.Dir(filename), 0700)
+	if err != nil {
+		return err
+	}
+
+	tmpname := filename + ".tmp"
+	err = os.WriteFile(tmpname, buf, 0600)
+	if err != nil {
+		return err
+	}
+	return fs.Rename(tmpname, filename)
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/restic/restic/internal/backend"
+	"github.com/restic/restic/internal/backend/location"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/ui"
+
+	"github.com/spf13/cobra"
+)
+
+var cmdBackend = &cobra.Command{
+	Use:   "backend",
+	Short: "Inspect the repository backend",
+}
+
+var cmdBackendTest = &cobra.Command{
+	Use:   "test [flags]",
+	Short: "Test access to the repository backend",
+	Long: `
+The "backend test" command checks that the backend of the repository is usable
+by restic. It connects to the backend, which verifies the credentials, and then
+uploads, lists, downloads and removes a probe file in the data directory of the
+repository. The time each operation took and the throughput are printed as a
+report.
+
+The repository does not have to be initialized yet. The probe file is a pack
+file with random content. If the repository is initialized, the command asks
+for the password and holds an exclusive lock while the probe file exists, such
+that "prune" and "check" cannot report or remove it. No password is required
+for uninitialized repositories or with --no-lock.
+
+EXIT STATUS
+===========
+
+Exit status is 0 if all checks passed, and non-zero if any check failed.
+`,
+	DisableAutoGenTag: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runBackendTest(cmd.Context(), backendTestOptions, globalOptions)
+	},
+}
+
+// BackendTestOptions collects all options for the backend test command.
+type BackendTestOptions struct {
+	Size     uint
+	Requests uint
+}
+
+var backendTestOptions BackendTestOptions
+
+func init() {
+	cmdRoot.AddCommand(cmdBackend)
+	cmdBackend.AddCommand(cmdBackendTest)
+
+	f := cmdBackendTest.Flags()
+	f.UintVar(&backendTestOptions.Size, "size", 16, "upload a probe file of `size` MiB")
+	f.UintVar(&backendTestOptions.Requests, "requests", 5, "measure the latency using `n` requests")
+}
+
+// backendTestReport prints the result of each check of the backend test.
+type backendTestReport struct {
+	failed int
+}
+
+func (r *backendTestReport) check(name string, d time.Duration, err error, format string, args ...interface{}) bool {
+	if err != nil {
+		r.failed++
+		Printf("  %-8s FAILED  %v\n", name, err)
+		return false
+	}
+	line := fmt.Sprintf("  %-8s ok      %-8v %s", name, d.Round(time.Millisecond), fmt.Sprintf(format, args...))
+	Printf("%s\n", strings.TrimRight(line, " "))
+	return true
+}
+
+// throughput formats the rate at which size bytes were transferred in d.
+func throughput(size int, d time.Duration) string {
+	if d <= 0 {
+		return ""
+	}
+	return ui.FormatBytes(uint64(float64(size)/d.Seconds())) + "/s"
+}
+
+func runBackendTest(ctx context.Context, opts BackendTestOptions, gopts GlobalOptions) error {
+	if opts.Size == 0 {
+		return errors.Fatal("size of the probe file must be at least 1 MiB")
+	}
+	if opts.Requests == 0 {
+		return errors.Fatal("at least one request is required to measure the latency")
+	}
+
+	repoLocation, err := ReadRepo(gopts)
+	if err != nil {
+		return err
+	}
+
+	Printf("testing backend at %v\n", location.StripPassword(repoLocation))
+	r := &backendTestReport{}
+
+	start := time.Now()
+	be, err := openBackend(ctx, repoLocation, gopts, gopts.extended)
+	if !r.check("open", time.Since(start), err, "") {
+		return errors.Fatal("unable to connect to the backend")
+	}
+	defer func() {
+		_ = be.Close()
+	}()
+
+	start = time.Now()
+	fi, err := be.Stat(ctx, restic.Handle{Type: restic.ConfigFile})
+	if err != nil && be.IsNotExist(err) {
+		r.check("config", time.Since(start), nil, "not found, the repository is not initialized")
+	} else {
+		r.check("config", time.Since(start), err, "found, %v", ui.FormatBytes(uint64(fi.Size)))
+	}
+
+	// the probe file is stored in the data directory, prune and check must
+	// not run while it exists
+	if err == nil && !gopts.NoLock {
+		repo, err := OpenRepository(ctx, gopts)
+		if err != nil {
+			return err
+		}
+		var lock *restic.Lock
+		lock, ctx, err = lockRepoExclusive(ctx, repo)
+		defer unlockRepo(lock)
+		if err != nil {
+			return err
+		}
+	}
+
+	data := make([]byte, opts.Size*1024*1024)
+	_, err = rand.Read(data)
+	if err != nil {
+		return errors.Wrap(err, "rand.Read")
+	}
+	id := restic.Hash(data)
+	h := restic.Handle{Type: restic.PackFile, Name: id.String()}
+
+	start = time.Now()
+	err = be.Save(ctx, h, restic.NewByteReader(data, be.Hasher()))
+	d := time.Since(start)
+	if r.check("save", d, err, "%v, %v", ui.FormatBytes(uint64(len(data))), throughput(len(data), d)) {
+		func() {
+			defer removeProbe(ctx, r, be, h)
+			testProbe(ctx, r, be, h, data, opts.Requests)
+		}()
+	}
+
+	if r.failed > 0 {
+		return errors.Fatalf("%d checks failed", r.failed)
+	}
+	Printf("all checks passed\n")
+	return nil
+}
+
+// removeProbe removes the probe file h and checks that it is gone.
+func removeProbe(ctx context.Context, r *backendTestReport, be restic.Backend, h restic.Handle) {
+	start := time.Now()
+	err := be.Remove(ctx, h)
+	if errors.Is(err, restic.ErrObjectLocked) {
+		r.check("remove", time.Since(start), nil, "kept, %v", err)
+		Warnf("the probe file %v is protected by object lock and stays in the repository,\n"+
+			"check reports it as a pack file not referenced by any index until prune\n"+
+			"removes it after the retention period has expired\n", h)
+		return
+	}
+	if !r.check("remove", time.Since(start), err, "") {
+		Warnf("unable to remove probe file %v, please remove it manually\n", h)
+		return
+	}
+
+	start = time.Now()
+	_, err = be.Stat(ctx, h)
+	if err == nil {
+		err = errors.New("probe file still exists after removing it")
+	} else if be.IsNotExist(err) {
+		err = nil
+	}
+	r.check("removed", time.Since(start), err, "")
+}
+
+// testProbe checks that the probe file h, which has the contents data, can be
+// listed and read from the backend.
+func testProbe(ctx context.Context, r *backendTestReport, be restic.Backend, h restic.Handle, data []byte, requests uint) {
+	var min, max, total time.Duration
+	var err error
+	for i := uint(0); i < requests; i++ {
+		start := time.Now()
+		var fi restic.FileInfo
+		fi, err = be.Stat(ctx, h)
+		if err == nil && fi.Size != int64(len(data)) {
+			err = errors.Errorf("wrong size of probe file, got %d, want %d", fi.Size, len(data))
+		}
+		if err != nil {
+			break
+		}
+
+		d := time.Since(start)
+		if i == 0 || d < min {
+			min = d
+		}
+		if d > max {
+			max = d
+		}
+		total += d
+	}
+	r.check("stat", total, err, "latency min %v, avg %v, max %v (%d requests)",
+		min.Round(time.Millisecond), (total / time.Duration(requests)).Round(time.Millisecond), max.Round(time.Millisecond), requests)
+
+	start := time.Now()
+	files, found := 0, false
+	err = be.List(ctx, restic.PackFile, func(fi restic.FileInfo) error {
+		files++
+		if fi.Name == h.Name {
+			found = true
+		}
+		return nil
+	})
+	if err == nil && !found {
+		err = errors.New("probe file not found in the list of files")
+	}
+	r.check("list", time.Since(start), err, "%d files in the data directory", files)
+
+	start = time.Now()
+	buf, err := backend.LoadAll(ctx, nil, be, h)
+	if err == nil && !bytes.Equal(buf, data) {
+		err = errors.New("probe file was corrupted")
+	}
+	d := time.Since(start)
+	r.check("load", d, err, "%v, %v", ui.FormatBytes(uint64(len(buf))), throughput(len(buf), d))
+}
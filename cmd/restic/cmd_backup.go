@@ -7,12 +7,14 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"os/user"
 	"path"
 	"path/filepath"
 	"runtime"
 	"strconv"
 	"strings"
 	"sync"
+	"text/template"
 	"time"
 
 	"github.com/spf13/cobra"
@@ -43,16 +45,10 @@ EXIT STATUS
 Exit status is 0 if the command was successful.
 Exit status is 1 if there was a fatal error (no snapshot created).
 Exit status is 3 if some source data could not be read (incomplete snapshot created).
+With --on-error skip, the exit status is 0 in that case.
 `,
 	PreRun: func(cmd *cobra.Command, args []string) {
-		if backupOptions.Host == "" {
-			hostname, err := os.Hostname()
-			if err != nil {
-				debug.Log("os.Hostname() returned err: %v", err)
-				return
-			}
-			backupOptions.Host = hostname
-		}
+		backupOptions.Host = backupHostname(backupOptions.Host)
 	},
 	DisableAutoGenTag: true,
 	RunE: func(cmd *cobra.Command, args []string) error {
@@ -93,9 +89,13 @@ type BackupOptions struct {
 	ExcludeOtherFS    bool
 	ExcludeIfPresent  []string
 	ExcludeCaches     bool
+	IgnoreFiles       []string
 	ExcludeLargerThan string
 	Stdin             bool
 	StdinFilename     string
+	StdinMode         string
+	StdinMtime        string
+	StdinUser         string
 	Tags              restic.TagLists
 	Host              string
 	FilesFrom         []string
@@ -103,12 +103,21 @@ type BackupOptions struct {
 	FilesFromRaw      []string
 	TimeStamp         string
 	WithAtime         bool
+	ReadBlockDevices  bool
 	IgnoreInode       bool
 	IgnoreCtime       bool
+	ForceChecksum     bool
 	UseFsSnapshot     bool
 	DryRun            bool
 	ReadConcurrency   uint
 	NoScan            bool
+	NoResume          bool
+	OnError           string
+
+	PreCommand         string
+	PostCommand        string
+	PostSuccessCommand string
+	PostFailureCommand string
 }
 
 var backupOptions BackupOptions
@@ -127,11 +136,15 @@ func init() {
 
 	f.BoolVarP(&backupOptions.ExcludeOtherFS, "one-file-system", "x", false, "exclude other file systems, don't cross filesystem boundaries and subvolumes")
 	f.StringArrayVar(&backupOptions.ExcludeIfPresent, "exclude-if-present", nil, "takes `filename[:header]`, exclude contents of directories containing filename (except filename itself) if header of that file is as provided (can be specified multiple times)")
+	f.StringArrayVar(&backupOptions.IgnoreFiles, "ignore-file", nil, "read gitignore-style exclude patterns from files called `name` in the backed up directories (can be specified multiple times)")
 	f.BoolVar(&backupOptions.ExcludeCaches, "exclude-caches", false, `excludes cache directories that are marked with a CACHEDIR.TAG file. See https://bford.info/cachedir/ for the Cache Directory Tagging Standard`)
 	f.StringVar(&backupOptions.ExcludeLargerThan, "exclude-larger-than", "", "max `size` of the files to be backed up (allowed suffixes: k/K, m/M, g/G, t/T)")
 	f.BoolVar(&backupOptions.Stdin, "stdin", false, "read backup from stdin")
 	f.StringVar(&backupOptions.StdinFilename, "stdin-filename", "stdin", "`filename` to use when reading from stdin")
-	f.Var(&backupOptions.Tags, "tag", "add `tags` for the new snapshot in the format `tag[,tag,...]` (can be specified multiple times)")
+	f.StringVar(&backupOptions.StdinMode, "stdin-mode", "", "octal permission `mode` of the file read from stdin (default: 0644)")
+	f.StringVar(&backupOptions.StdinMtime, "stdin-mtime", "", "modification `time` of the file read from stdin (ex. '2012-11-01 22:08:41') (default: backup time)")
+	f.StringVar(&backupOptions.StdinUser, "stdin-user", "", "`user[:group]` owning the file read from stdin, as name or numeric ID (default: current user)")
+	f.Var(tagTemplateLists{&backupOptions.Tags}, "tag", "add `tags` for the new snapshot in the format `tag[,tag,...]`, placeholders like {{.Date}} are expanded (can be specified multiple times)")
 	f.UintVar(&backupOptions.ReadConcurrency, "read-concurrency", 0, "read `n` files concurrently (default: $RESTIC_READ_CONCURRENCY or 2)")
 	f.StringVarP(&backupOptions.Host, "host", "H", "", "set the `hostname` for the snapshot manually. To prevent an expensive rescan use the \"parent\" flag")
 	f.StringVar(&backupOptions.Host, "hostname", "", "set the `hostname` for the snapshot manually")
@@ -145,10 +158,18 @@ func init() {
 	f.StringArrayVar(&backupOptions.FilesFromRaw, "files-from-raw", nil, "read the files to backup from `file` (can be combined with file args; can be specified multiple times)")
 	f.StringVar(&backupOptions.TimeStamp, "time", "", "`time` of the backup (ex. '2012-11-01 22:08:41') (default: now)")
 	f.BoolVar(&backupOptions.WithAtime, "with-atime", false, "store the atime for all files and directories")
+	f.BoolVar(&backupOptions.ReadBlockDevices, "read-block-devices", false, "read the contents of block devices given as targets and save them as regular files")
 	f.BoolVar(&backupOptions.IgnoreInode, "ignore-inode", false, "ignore inode number changes when checking for modified files")
 	f.BoolVar(&backupOptions.IgnoreCtime, "ignore-ctime", false, "ignore ctime changes when checking for modified files")
+	f.BoolVar(&backupOptions.ForceChecksum, "force-checksum", false, "re-read all files to detect changes by content, but still compare against the parent snapshot")
 	f.BoolVarP(&backupOptions.DryRun, "dry-run", "n", false, "do not upload or write any data, just show what would be done")
 	f.BoolVar(&backupOptions.NoScan, "no-scan", false, "do not run scanner to estimate size of backup")
+	f.StringVar(&backupOptions.OnError, "on-error", "warn", "`policy` for files which cannot be read: skip (continue silently), warn (continue, exit code 3) or fail (abort the backup)")
+	f.BoolVar(&backupOptions.NoResume, "no-resume", false, "do not resume an interrupted backup of the same files/directories")
+	f.StringVar(&backupOptions.PreCommand, "pre-command", "", "run `command` before the backup, abort the backup if it fails")
+	f.StringVar(&backupOptions.PostCommand, "post-command", "", "run `command` after the backup, regardless of the result")
+	f.StringVar(&backupOptions.PostSuccessCommand, "post-success-command", "", "run `command` after a successful backup")
+	f.StringVar(&backupOptions.PostFailureCommand, "post-failure-command", "", "run `command` after a failed or incomplete backup")
 	if runtime.GOOS == "windows" {
 		f.BoolVar(&backupOptions.UseFsSnapshot, "use-fs-snapshot", false, "use filesystem snapshot where possible (currently only Windows VSS)")
 	}
@@ -284,6 +305,12 @@ func (opts BackupOptions) Check(gopts GlobalOptions, args []string) error {
 		}
 	}
 
+	switch opts.OnError {
+	case "", "skip", "warn", "fail":
+	default:
+		return errors.Fatalf("invalid --on-error policy %q, must be one of skip, warn or fail", opts.OnError)
+	}
+
 	if opts.Stdin {
 		if len(opts.FilesFrom) > 0 {
 			return errors.Fatal("--stdin and --files-from cannot be used together")
@@ -298,6 +325,8 @@ func (opts BackupOptions) Check(gopts GlobalOptions, args []string) error {
 		if len(args) > 0 {
 			return errors.Fatal("--stdin was specified and files/dirs were listed as arguments")
 		}
+	} else if opts.StdinMode != "" || opts.StdinMtime != "" || opts.StdinUser != "" {
+		return errors.Fatal("--stdin-mode, --stdin-mtime and --stdin-user can only be used together with --stdin")
 	}
 
 	return nil
@@ -339,11 +368,12 @@ func collectRejectByNameFuncs(opts BackupOptions, repo *repository.Repository, t
 }
 
 // collectRejectFuncs returns a list of all functions which may reject data
-// from being saved in a snapshot based on path and file info
-func collectRejectFuncs(opts BackupOptions, repo *repository.Repository, targets []string) (fs []RejectFunc, err error) {
+// from being saved in a snapshot based on path and file info. skippedMountPoint
+// is called for each mount point skipped due to --one-file-system.
+func collectRejectFuncs(opts BackupOptions, repo *repository.Repository, targets []string, skippedMountPoint func(string)) (fs []RejectFunc, err error) {
 	// allowed devices
 	if opts.ExcludeOtherFS && !opts.Stdin {
-		f, err := rejectByDevice(targets)
+		f, err := rejectByDevice(targets, skippedMountPoint)
 		if err != nil {
 			return nil, err
 		}
@@ -358,6 +388,14 @@ func collectRejectFuncs(opts BackupOptions, repo *repository.Repository, targets
 		fs = append(fs, f)
 	}
 
+	if len(opts.IgnoreFiles) > 0 && !opts.Stdin {
+		f, err := rejectByIgnoreFiles(opts.IgnoreFiles, targets)
+		if err != nil {
+			return nil, err
+		}
+		fs = append(fs, f)
+	}
+
 	return fs, nil
 }
 
@@ -447,12 +485,301 @@ func findParentSnapshot(ctx context.Context, repo restic.Repository, opts Backup
 	return sn, err
 }
 
-func runBackup(ctx context.Context, opts BackupOptions, gopts GlobalOptions, term *termstatus.Terminal, args []string) error {
-	err := opts.Check(gopts, args)
+// runPostBackupHooks runs the hook commands configured for the end of a
+// backup. Errors are only reported as warnings, the backup itself is done.
+func runPostBackupHooks(opts BackupOptions, gopts GlobalOptions, result backupHookResult, err error) {
+	switch {
+	case err == nil:
+		result.status = backupStatusSuccess
+	case errors.Is(err, ErrInvalidSourceData):
+		result.status = backupStatusPartial
+		result.err = err
+	default:
+		result.status = backupStatusFailure
+		result.err = err
+	}
+
+	type hook struct{ name, command string }
+	hooks := []hook{{"post-failure-command", opts.PostFailureCommand}}
+	if result.status == backupStatusSuccess {
+		hooks = []hook{{"post-success-command", opts.PostSuccessCommand}}
+	}
+	hooks = append(hooks, hook{"post-command", opts.PostCommand})
+
+	env := result.environ()
+	for _, h := range hooks {
+		if h.command == "" {
+			continue
+		}
+		if herr := runHookCommand(h.name, h.command, env, gopts.stderr); herr != nil {
+			Warnf("%v\n", herr)
+		}
+	}
+}
+
+// newStdinReader returns the file system for a backup of stdin, using the
+// file name and metadata from opts.
+func newStdinReader(opts BackupOptions, timeStamp time.Time) (*fs.Reader, error) {
+	mode := uint64(0644)
+	if opts.StdinMode != "" {
+		var err error
+		mode, err = strconv.ParseUint(opts.StdinMode, 8, 32)
+		if err != nil || os.FileMode(mode)&^os.ModePerm != 0 {
+			return nil, errors.Fatalf("invalid --stdin-mode %q, must be an octal number between 0 and 0777", opts.StdinMode)
+		}
+	}
+
+	modTime := timeStamp
+	if opts.StdinMtime != "" {
+		var err error
+		modTime, err = time.ParseInLocation(TimeFormat, opts.StdinMtime, time.Local)
+		if err != nil {
+			return nil, errors.Fatalf("error in --stdin-mtime option: %v", err)
+		}
+	}
+
+	var owner *fs.Owner
+	if opts.StdinUser != "" {
+		var err error
+		owner, err = parseStdinUser(opts.StdinUser)
+		if err != nil {
+			return nil, errors.Fatalf("invalid --stdin-user %q: %v", opts.StdinUser, err)
+		}
+	}
+
+	return &fs.Reader{
+		ModTime:    modTime,
+		Name:       path.Join("/", opts.StdinFilename),
+		Mode:       os.FileMode(mode),
+		Owner:      owner,
+		ReadCloser: os.Stdin,
+	}, nil
+}
+
+// tagTemplateData is passed to the templates in the tags of a new snapshot.
+type tagTemplateData struct {
+	Time     time.Time
+	Date     string
+	Week     string
+	Hostname string
+	Username string
+}
+
+// tagTemplateLists stores the values of --tag for backup without splitting
+// them, so that commas within templates are kept until they are expanded.
+type tagTemplateLists struct {
+	*restic.TagLists
+}
+
+func (l tagTemplateLists) Set(s string) error {
+	*l.TagLists = append(*l.TagLists, restic.TagList{s})
+	return nil
+}
+
+// backupHostname returns host, or the hostname of the system if host is empty.
+func backupHostname(host string) string {
+	if host != "" {
+		return host
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		debug.Log("os.Hostname() returned err: %v", err)
+		return ""
+	}
+	return hostname
+}
+
+// expandTagTemplates expands the text/template placeholders in tags, e.g.
+// "weekly-{{.Week}}", using the time and hostname of the new snapshot. The
+// expanded tags are then split at commas.
+func expandTagTemplates(tags restic.TagLists, timeStamp time.Time, hostname string) (restic.TagList, error) {
+	year, week := timeStamp.ISOWeek()
+	data := tagTemplateData{
+		Time:     timeStamp,
+		Date:     timeStamp.Format("2006-01-02"),
+		Week:     fmt.Sprintf("%04d-W%02d", year, week),
+		Hostname: hostname,
+	}
+	if usr, err := user.Current(); err == nil {
+		data.Username = usr.Username
+	}
+
+	var expandedTags restic.TagLists
+	for _, list := range tags {
+		for _, tag := range list {
+			expanded, err := expandTagTemplate(tag, data)
+			if err != nil {
+				return nil, err
+			}
+			var l restic.TagList
+			_ = l.Set(expanded)
+			expandedTags = append(expandedTags, l)
+		}
+	}
+	return expandedTags.Flatten(), nil
+}
+
+// expandTagTemplate expands the template in tag using data.
+func expandTagTemplate(tag string, data tagTemplateData) (string, error) {
+	if !strings.Contains(tag, "{{") {
+		return tag, nil
+	}
+
+	tmpl, err := template.New("tag").Option("missingkey=error").Parse(tag)
+	if err != nil {
+		return "", errors.Fatalf("invalid template in tag %q: %v", tag, err)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", errors.Fatalf("unable to expand tag %q: %v", tag, err)
+	}
+
+	expanded := strings.TrimSpace(buf.String())
+	if expanded == "" {
+		return "", errors.Fatalf("tag %q expands to an empty string", tag)
+	}
+	debug.Log("expanded tag %q to %q", tag, expanded)
+	return expanded, nil
+}
+
+// parseStdinUser parses a string in the format user[:group]. User and group
+// can either be a name or a numeric ID. If the group is omitted, the primary
+// group of the user is used, or the current group if it cannot be determined.
+func parseStdinUser(s string) (*fs.Owner, error) {
+	userName, groupName, hasGroup := strings.Cut(s, ":")
+	if userName == "" || (hasGroup && groupName == "") {
+		return nil, errors.New("expected format user[:group]")
+	}
+
+	owner := &fs.Owner{GID: uint32(os.Getgid())}
+
+	if id, err := strconv.ParseUint(userName, 10, 32); err == nil {
+		owner.UID = uint32(id)
+		if u, err := user.LookupId(userName); err == nil {
+			if gid, err := strconv.ParseUint(u.Gid, 10, 32); err == nil {
+				owner.GID = uint32(gid)
+			}
+		}
+	} else {
+		u, err := user.Lookup(userName)
+		if err != nil {
+			return nil, err
+		}
+		uid, err := strconv.ParseUint(u.Uid, 10, 32)
+		if err != nil {
+			return nil, errors.Errorf("user %v has no numeric ID", userName)
+		}
+		owner.UID, owner.User = uint32(uid), userName
+		if gid, err := strconv.ParseUint(u.Gid, 10, 32); err == nil {
+			owner.GID = uint32(gid)
+		}
+	}
+
+	if !hasGroup {
+		return owner, nil
+	}
+
+	if id, err := strconv.ParseUint(groupName, 10, 32); err == nil {
+		owner.GID = uint32(id)
+		return owner, nil
+	}
+
+	g, err := user.LookupGroup(groupName)
+	if err != nil {
+		return nil, err
+	}
+	gid, err := strconv.ParseUint(g.Gid, 10, 32)
+	if err != nil {
+		return nil, errors.Errorf("group %v has no numeric ID", groupName)
+	}
+	owner.GID, owner.Group = uint32(gid), groupName
+	return owner, nil
+}
+
+// resumeCheckpointInterval is the interval at which the list of completed
+// directories is saved while a backup is running.
+var resumeCheckpointInterval = 5 * time.Minute
+
+// resumeTargets returns the absolute paths of targets, which identify the
+// backup in its resume state.
+func resumeTargets(targets []string) ([]string, error) {
+	absTargets := make([]string, 0, len(targets))
+	for _, target := range targets {
+		abs, err := filepath.Abs(target)
+		if err != nil {
+			return nil, err
+		}
+		absTargets = append(absTargets, abs)
+	}
+	return absTargets, nil
+}
+
+// loadResumeState returns the name of the file which records the progress of
+// the backup of targets, and the state left behind by an interrupted run of
+// the same backup, if any. The filename is empty if the backup cannot be
+// resumed, e.g. because it reads from stdin or no cache is available. It must
+// be called after the index has been loaded.
+func loadResumeState(ctx context.Context, repo *repository.Repository, opts BackupOptions, targets []string) (string, *archiver.ResumeState, error) {
+	if opts.Stdin || opts.DryRun || opts.NoResume || repo.Cache == nil {
+		return "", nil, nil
+	}
+
+	absTargets, err := resumeTargets(targets)
+	if err != nil {
+		return "", nil, err
+	}
+
+	dir, err := repo.Cache.StateDir("backup")
+	if err != nil {
+		Warnf("unable to create directory for backup state: %v\n", err)
+		return "", nil, nil
+	}
+	filename := archiver.ResumeStateFilename(dir, opts.Host, absTargets)
+
+	// --force re-reads all files, but progress is still recorded
+	if opts.Force {
+		return filename, nil, nil
+	}
+
+	state, err := archiver.LoadResumeState(filename, opts.Host, absTargets)
+	if err != nil {
+		Warnf("ignoring invalid backup state: %v\n", err)
+		return filename, nil, nil
+	}
+	if state == nil {
+		return filename, nil, nil
+	}
+
+	err = state.RemoveIncomplete(ctx, repo)
+	if err != nil {
+		return "", nil, err
+	}
+	if state.Len() == 0 {
+		return filename, nil, nil
+	}
+	return filename, state, nil
+}
+
+func runBackup(ctx context.Context, opts BackupOptions, gopts GlobalOptions, term *termstatus.Terminal, args []string) (err error) {
+	err = opts.Check(gopts, args)
 	if err != nil {
 		return err
 	}
 
+	hookResult := backupHookResult{status: backupStatusPending}
+	defer func() {
+		runPostBackupHooks(opts, gopts, hookResult, err)
+	}()
+
+	if opts.PreCommand != "" {
+		err = runHookCommand("pre-command", opts.PreCommand, hookResult.environ(), gopts.stderr)
+		if err != nil {
+			return errors.Fatal(err.Error())
+		}
+	}
+
 	targets, err := collectTargets(opts, args)
 	if err != nil {
 		return err
@@ -466,6 +793,20 @@ func runBackup(ctx context.Context, opts BackupOptions, gopts GlobalOptions, ter
 		}
 	}
 
+	// opts.Host is only set by PreRun if the command is run via cobra
+	tags, err := expandTagTemplates(opts.Tags, timeStamp, backupHostname(opts.Host))
+	if err != nil {
+		return err
+	}
+
+	var stdinFile *fs.Reader
+	if opts.Stdin {
+		stdinFile, err = newStdinReader(opts, timeStamp)
+		if err != nil {
+			return err
+		}
+	}
+
 	if gopts.verbosity >= 2 && !gopts.JSON {
 		Verbosef("open repository\n")
 	}
@@ -505,7 +846,7 @@ func runBackup(ctx context.Context, opts BackupOptions, gopts GlobalOptions, ter
 	}
 
 	// rejectFuncs collect functions that can reject items from the backup based on path and file info
-	rejectFuncs, err := collectRejectFuncs(opts, repo, targets)
+	rejectFuncs, err := collectRejectFuncs(opts, repo, targets, progressPrinter.SkippedMountPoint)
 	if err != nil {
 		return err
 	}
@@ -552,6 +893,14 @@ func runBackup(ctx context.Context, opts BackupOptions, gopts GlobalOptions, ter
 		return true
 	}
 
+	resumeFile, resumeState, err := loadResumeState(ctx, repo, opts, targets)
+	if err != nil {
+		return err
+	}
+	if resumeState != nil && !gopts.JSON {
+		progressPrinter.P("resuming interrupted backup from %v\n", resumeState.Time.Local().Format(TimeFormat))
+	}
+
 	var targetFS fs.FS = fs.Local{}
 	if runtime.GOOS == "windows" && opts.UseFsSnapshot {
 		if err = fs.HasSufficientPrivilegesForVSS(); err != nil {
@@ -576,14 +925,8 @@ func runBackup(ctx context.Context, opts BackupOptions, gopts GlobalOptions, ter
 		if !gopts.JSON {
 			progressPrinter.V("read data from stdin")
 		}
-		filename := path.Join("/", opts.StdinFilename)
-		targetFS = &fs.Reader{
-			ModTime:    timeStamp,
-			Name:       filename,
-			Mode:       0644,
-			ReadCloser: os.Stdin,
-		}
-		targets = []string{filename}
+		targetFS = stdinFile
+		targets = []string{stdinFile.Name}
 	}
 
 	wg, wgCtx := errgroup.WithContext(ctx)
@@ -607,12 +950,51 @@ func runBackup(ctx context.Context, opts BackupOptions, gopts GlobalOptions, ter
 	arch.SelectByName = selectByNameFilter
 	arch.Select = selectFilter
 	arch.WithAtime = opts.WithAtime
+	arch.ReadBlockDevices = opts.ReadBlockDevices
 	success := true
 	arch.Error = func(item string, err error) error {
+		switch opts.OnError {
+		case "fail":
+			return err
+		case "skip":
+			if !gopts.JSON {
+				progressPrinter.V("skipping %v: %v", item, err)
+			}
+			return nil
+		}
 		success = false
 		return progressReporter.Error(item, err)
 	}
 	arch.CompleteItem = progressReporter.CompleteItem
+	arch.Resume = resumeState
+
+	var checkpoint *archiver.ResumeState
+	if resumeFile != "" {
+		absTargets, err := resumeTargets(targets)
+		if err != nil {
+			return err
+		}
+		checkpoint = archiver.NewResumeState(opts.Host, absTargets)
+		arch.CompleteItem = func(item string, previous, current *restic.Node, s archiver.ItemStats, d time.Duration) {
+			progressReporter.CompleteItem(item, previous, current, s, d)
+			checkpoint.Complete(item, current)
+		}
+
+		wg.Go(func() error {
+			ticker := time.NewTicker(resumeCheckpointInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-cancelCtx.Done():
+					return nil
+				case <-ticker.C:
+					if err := checkpoint.Save(resumeFile); err != nil {
+						Warnf("unable to save backup state: %v\n", err)
+					}
+				}
+			}
+		})
+	}
 	arch.StartFile = progressReporter.StartFile
 	arch.CompleteBlob = progressReporter.CompleteBlob
 
@@ -624,10 +1006,13 @@ func runBackup(ctx context.Context, opts BackupOptions, gopts GlobalOptions, ter
 	if opts.IgnoreCtime {
 		arch.ChangeIgnoreFlags |= archiver.ChangeIgnoreCtime
 	}
+	if opts.ForceChecksum {
+		arch.ChangeIgnoreFlags |= archiver.ChangeForceRescan
+	}
 
 	snapshotOpts := archiver.SnapshotOptions{
 		Excludes:       opts.Excludes,
-		Tags:           opts.Tags.Flatten(),
+		Tags:           tags,
 		Time:           timeStamp,
 		Hostname:       opts.Host,
 		ParentSnapshot: parentSnapshot,
@@ -646,11 +1031,27 @@ func runBackup(ctx context.Context, opts BackupOptions, gopts GlobalOptions, ter
 
 	// return original error
 	if err != nil {
+		if checkpoint != nil {
+			if serr := checkpoint.Save(resumeFile); serr != nil {
+				Warnf("unable to save backup state: %v\n", serr)
+			}
+		}
 		return errors.Fatalf("unable to save snapshot: %v", err)
 	}
 
+	if resumeFile != "" {
+		if rerr := fs.Remove(resumeFile); rerr != nil && !errors.Is(rerr, os.ErrNotExist) {
+			Warnf("unable to remove backup state: %v\n", rerr)
+		}
+	}
+
 	// Report finished execution
 	progressReporter.Finish(id, opts.DryRun)
+	summary := progressReporter.Summary()
+	hookResult.summary = &summary
+	if !id.IsNull() {
+		hookResult.snapshotID = &id
+	}
 	if !gopts.JSON && !opts.DryRun {
 		progressPrinter.P("snapshot %s saved\n", id.Str())
 	}
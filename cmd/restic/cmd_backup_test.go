@@ -9,7 +9,9 @@ import (
 	"sort"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/restic/restic/internal/restic"
 	rtest "github.com/restic/restic/internal/test"
 )
 
@@ -110,3 +112,76 @@ func TestReadFilenamesRaw(t *testing.T) {
 	rtest.Assert(t, strings.Contains(err.Error(), "zero byte"),
 		"wrong error message: %v", err.Error())
 }
+
+func TestParseStdinUser(t *testing.T) {
+	for _, test := range []struct {
+		input    string
+		uid, gid uint32
+	}{
+		{"1000:1001", 1000, 1001},
+		{"0:0", 0, 0},
+		{"4321:100", 4321, 100},
+	} {
+		owner, err := parseStdinUser(test.input)
+		rtest.OK(t, err)
+		rtest.Equals(t, test.uid, owner.UID)
+		rtest.Equals(t, test.gid, owner.GID)
+	}
+
+	for _, input := range []string{":", "1000:", ":1000", "user-which-does-not-exist-here"} {
+		_, err := parseStdinUser(input)
+		rtest.Assert(t, err != nil, "missing error for %q", input)
+	}
+}
+
+func TestNewStdinReader(t *testing.T) {
+	now := time.Now()
+
+	rd, err := newStdinReader(BackupOptions{StdinFilename: "dump.sql", StdinMode: "0640"}, now)
+	rtest.OK(t, err)
+	rtest.Equals(t, "/dump.sql", rd.Name)
+	rtest.Equals(t, os.FileMode(0640), rd.Mode)
+	rtest.Equals(t, now, rd.ModTime)
+	rtest.Assert(t, rd.Owner == nil, "unexpected owner %v", rd.Owner)
+
+	rd, err = newStdinReader(BackupOptions{StdinFilename: "stdin"}, now)
+	rtest.OK(t, err)
+	rtest.Equals(t, os.FileMode(0644), rd.Mode)
+
+	rd, err = newStdinReader(BackupOptions{StdinFilename: "dump.sql", StdinMtime: "2012-11-01 22:08:41"}, now)
+	rtest.OK(t, err)
+	rtest.Equals(t, time.Date(2012, 11, 1, 22, 8, 41, 0, time.Local), rd.ModTime)
+
+	for _, opts := range []BackupOptions{
+		{StdinMode: "999"},
+		{StdinMode: "01777"},
+		{StdinMtime: "yesterday"},
+	} {
+		_, err := newStdinReader(opts, now)
+		rtest.Assert(t, err != nil, "missing error for %+v", opts)
+	}
+}
+
+func TestExpandTagTemplates(t *testing.T) {
+	timeStamp := time.Date(2021, 1, 3, 12, 0, 0, 0, time.UTC)
+	var tagLists restic.TagLists
+	for _, s := range []string{
+		"plain,other",
+		"weekly-{{.Week}}",
+		"{{.Hostname}}-{{.Date}}",
+		`{{.Time.Format "2006-01"}}`,
+		// commas within templates are only split after the expansion
+		`{{.Time.Format "Jan 2, 2006"}}, {{printf "%s,%s" "a" "b"}}`,
+	} {
+		rtest.OK(t, tagTemplateLists{&tagLists}.Set(s))
+	}
+
+	tags, err := expandTagTemplates(tagLists, timeStamp, "host")
+	rtest.OK(t, err)
+	rtest.Equals(t, restic.TagList{"plain", "other", "weekly-2020-W53", "host-2021-01-03", "2021-01", "Jan 3", "2021", "a", "b"}, tags)
+
+	for _, tag := range []string{"{{.Date", "{{.Unknown}}", "{{if false}}x{{end}}"} {
+		_, err := expandTagTemplates(restic.TagLists{{tag}}, timeStamp, "host")
+		rtest.Assert(t, err != nil, "missing error for %q", tag)
+	}
+}
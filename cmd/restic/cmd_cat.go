@@ -13,10 +13,11 @@ import (
 )
 
 var cmdCat = &cobra.Command{
-	Use:   "cat [flags] [pack|blob|snapshot|index|key|masterkey|config|lock] ID",
+	Use:   "cat [flags] [pack|blob|tree|snapshot|index|key|masterkey|config|lock] ID",
 	Short: "Print internal objects to stdout",
 	Long: `
-The "cat" command is used to print internal objects to stdout.
+The "cat" command is used to print internal objects to stdout. Trees are
+printed as indented JSON, blobs and packs are printed as raw data.
 
 EXIT STATUS
 ===========
@@ -165,6 +166,29 @@ func runCat(ctx context.Context, gopts GlobalOptions, args []string) error {
 
 		return errors.Fatal("blob not found")
 
+	case "tree":
+		err = repo.LoadIndex(ctx)
+		if err != nil {
+			return err
+		}
+
+		if !repo.Index().Has(restic.BlobHandle{ID: id, Type: restic.TreeBlob}) {
+			return errors.Fatal("tree not found")
+		}
+
+		tree, err := restic.LoadTree(ctx, repo, id)
+		if err != nil {
+			return err
+		}
+
+		buf, err := json.MarshalIndent(tree, "", "  ")
+		if err != nil {
+			return err
+		}
+
+		Println(string(buf))
+		return nil
+
 	default:
 		return errors.Fatal("invalid type")
 	}
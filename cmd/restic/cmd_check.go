@@ -2,8 +2,10 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"math/rand"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -15,7 +17,9 @@ import (
 	"github.com/restic/restic/internal/checker"
 	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/repository"
 	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/ui/progress"
 )
 
 var cmdCheck = &cobra.Command{
@@ -28,6 +32,22 @@ finds. It can also be used to read all data and therefore simulate a restore.
 By default, the "check" command will always load all data directly from the
 repository and not use a local cache.
 
+When using "--with-cache-verify", the local cache is used, but first all cached
+files are verified. Damaged files are removed from the cache and downloaded
+again if necessary.
+
+The "--snapshot" option restricts the check of trees and blobs to the given
+snapshots. When combined with "--read-data" or "--read-data-subset", only the
+pack files containing data of these snapshots are read.
+
+The "--resume" option records which packs were already read in the cache
+directory. If "check --read-data" or "--read-data-subset=n/t" is interrupted,
+running it again with "--resume" skips these packs. The state is removed once
+all packs were read successfully.
+
+With "--json", the errors found are printed as JSON messages, which contain
+the type of the error and the affected pack or tree.
+
 EXIT STATUS
 ===========
 
@@ -44,10 +64,13 @@ Exit status is 0 if the command was successful, and non-zero if there was any er
 
 // CheckOptions bundles all options for the 'check' command.
 type CheckOptions struct {
-	ReadData       bool
-	ReadDataSubset string
-	CheckUnused    bool
-	WithCache      bool
+	ReadData        bool
+	ReadDataSubset  string
+	CheckUnused     bool
+	WithCache       bool
+	WithCacheVerify bool
+	Snapshots       []string
+	Resume          bool
 }
 
 var checkOptions CheckOptions
@@ -66,12 +89,20 @@ func init() {
 		panic(err)
 	}
 	f.BoolVar(&checkOptions.WithCache, "with-cache", false, "use the cache")
+	f.BoolVar(&checkOptions.WithCacheVerify, "with-cache-verify", false, "use the cache and remove damaged files from it first")
+	f.StringArrayVar(&checkOptions.Snapshots, "snapshot", nil, "only check the data referenced by `snapshotID` (can be specified multiple times)")
+	f.BoolVar(&checkOptions.Resume, "resume", false, "skip the packs already read by an interrupted --read-data run")
 }
 
 func checkFlags(opts CheckOptions) error {
 	if opts.ReadData && opts.ReadDataSubset != "" {
 		return errors.Fatal("check flags --read-data and --read-data-subset cannot be used together")
 	}
+	if opts.Resume {
+		if _, err := stringToIntSlice(opts.ReadDataSubset); !opts.ReadData && (opts.ReadDataSubset == "" || err != nil) {
+			return errors.Fatal("check flag --resume requires --read-data or --read-data-subset=n/t")
+		}
+	}
 	if opts.ReadDataSubset != "" {
 		dataSubset, err := stringToIntSlice(opts.ReadDataSubset)
 		argumentError := errors.Fatal("check flag --read-data-subset has invalid value, please see documentation")
@@ -155,7 +186,7 @@ func parsePercentage(s string) (float64, error) {
 //   - by default, we use a cache in a temporary directory that is deleted after the check
 func prepareCheckCache(opts CheckOptions, gopts *GlobalOptions) (cleanup func()) {
 	cleanup = func() {}
-	if opts.WithCache {
+	if opts.WithCache || opts.WithCacheVerify {
 		// use the default cache, no setup needed
 		return cleanup
 	}
@@ -180,7 +211,9 @@ func prepareCheckCache(opts CheckOptions, gopts *GlobalOptions) (cleanup func())
 	}
 
 	gopts.CacheDir = tempdir
-	Verbosef("using temporary cache in %v\n", tempdir)
+	if !gopts.JSON {
+		Verbosef("using temporary cache in %v\n", tempdir)
+	}
 
 	cleanup = func() {
 		err := fs.RemoveAll(tempdir)
@@ -197,6 +230,17 @@ func runCheck(ctx context.Context, opts CheckOptions, gopts GlobalOptions, args
 		return errors.Fatal("the check command expects no arguments, only options - please see `restic help check` for usage and flags")
 	}
 
+	// the check state is kept in the default cache directory, as the cache
+	// used by check is usually temporary
+	var stateDir string
+	if opts.Resume {
+		var err error
+		stateDir, err = stateCacheDir(gopts)
+		if err != nil {
+			return errors.Fatalf("--resume requires a cache directory: %v", err)
+		}
+	}
+
 	cleanup := prepareCheckCache(opts, &gopts)
 	AddCleanupHandler(func(code int) (int, error) {
 		cleanup()
@@ -209,7 +253,9 @@ func runCheck(ctx context.Context, opts CheckOptions, gopts GlobalOptions, args
 	}
 
 	if !gopts.NoLock {
-		Verbosef("create exclusive lock for repository\n")
+		if !gopts.JSON {
+			Verbosef("create exclusive lock for repository\n")
+		}
 		var lock *restic.Lock
 		lock, ctx, err = lockRepoExclusive(ctx, repo)
 		defer unlockRepo(lock)
@@ -218,19 +264,57 @@ func runCheck(ctx context.Context, opts CheckOptions, gopts GlobalOptions, args
 		}
 	}
 
-	chkr := checker.New(repo, opts.CheckUnused)
+	if opts.WithCacheVerify {
+		err = verifyCache(repo)
+		if err != nil {
+			return err
+		}
+	}
+
+	readData := opts.ReadData || opts.ReadDataSubset != ""
+	// the blob references are necessary to find the packs of the selected snapshots
+	chkr := checker.New(repo, opts.CheckUnused || (len(opts.Snapshots) > 0 && readData))
 	err = chkr.LoadSnapshots(ctx)
 	if err != nil {
 		return err
 	}
 
-	Verbosef("load indexes\n")
+	snapshotIDs := restic.NewIDSet()
+	if len(opts.Snapshots) > 0 {
+		for _, s := range opts.Snapshots {
+			sn, err := restic.FindFilteredSnapshot(ctx, repo.Backend(), repo, nil, nil, nil, nil, s)
+			if err != nil {
+				return errors.Fatalf("failed to find snapshot %q: %v", s, err)
+			}
+			snapshotIDs.Insert(*sn.ID())
+		}
+		chkr.SelectSnapshots(snapshotIDs)
+	}
+
+	summary := jsonCheckSummary{MessageType: "summary"}
+	printJSONCheckMessage := func(msg jsonCheckMessage) {
+		if msg.MessageType == "hint" {
+			summary.NumHints++
+		} else {
+			summary.NumErrors++
+		}
+		printJSONCheck(msg)
+	}
+
+	printPhase("load-index", "load indexes\n")
 	hints, errs := chkr.LoadIndex(ctx)
 
 	errorsFound := false
 	suggestIndexRebuild := false
 	mixedFound := false
 	for _, hint := range hints {
+		if gopts.JSON {
+			msg := newJSONCheckMessage(hint, "index_damaged")
+			errorsFound = errorsFound || msg.MessageType == "error"
+			printJSONCheckMessage(msg)
+			continue
+		}
+
 		switch hint.(type) {
 		case *checker.ErrDuplicatePacks, *checker.ErrOldIndexFormat:
 			Printf("%v\n", hint)
@@ -245,7 +329,7 @@ func runCheck(ctx context.Context, opts CheckOptions, gopts GlobalOptions, args
 	}
 
 	if suggestIndexRebuild {
-		Printf("Duplicate packs/old indexes are non-critical, you can run `restic rebuild-index' to correct this.\n")
+		Printf("Duplicate packs/old indexes are non-critical, you can run `restic repair index' to correct this.\n")
 	}
 	if mixedFound {
 		Printf("Mixed packs with tree and data blobs are non-critical, you can run `restic prune` to correct this.\n")
@@ -253,7 +337,14 @@ func runCheck(ctx context.Context, opts CheckOptions, gopts GlobalOptions, args
 
 	if len(errs) > 0 {
 		for _, err := range errs {
-			Warnf("error: %v\n", err)
+			if gopts.JSON {
+				printJSONCheckMessage(newJSONCheckMessage(err, "index_damaged"))
+			} else {
+				Warnf("error: %v\n", err)
+			}
+		}
+		if gopts.JSON {
+			printJSONCheck(summary)
 		}
 		return errors.Fatal("LoadIndex returned errors")
 	}
@@ -261,11 +352,15 @@ func runCheck(ctx context.Context, opts CheckOptions, gopts GlobalOptions, args
 	orphanedPacks := 0
 	errChan := make(chan error)
 
-	Verbosef("check all packs\n")
+	printPhase("check-packs", "check all packs\n")
 	go chkr.Packs(ctx, errChan)
 
 	for err := range errChan {
-		if checker.IsOrphanedPack(err) {
+		if gopts.JSON {
+			msg := newJSONCheckMessage(err, "error")
+			errorsFound = errorsFound || msg.MessageType == "error"
+			printJSONCheckMessage(msg)
+		} else if checker.IsOrphanedPack(err) {
 			orphanedPacks++
 			Verbosef("%v\n", err)
 		} else if err == checker.ErrLegacyLayout {
@@ -280,21 +375,36 @@ func runCheck(ctx context.Context, opts CheckOptions, gopts GlobalOptions, args
 		Verbosef("%d additional files were found in the repo, which likely contain duplicate data.\nThis is non-critical, you can run `restic prune` to correct this.\n", orphanedPacks)
 	}
 
-	Verbosef("check snapshots, trees and blobs\n")
+	if len(opts.Snapshots) > 0 {
+		printPhase("check-snapshots", "check %d snapshots, trees and blobs\n", len(opts.Snapshots))
+	} else {
+		printPhase("check-snapshots", "check snapshots, trees and blobs\n")
+	}
 	errChan = make(chan error)
 	var wg sync.WaitGroup
 
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		bar := newProgressMax(!gopts.Quiet, 0, "snapshots")
+		bar := newPhaseProgressMax(!gopts.Quiet, 0, "check-snapshots", "snapshots")
 		defer bar.Done()
 		chkr.Structure(ctx, bar, errChan)
 	}()
 
 	for err := range errChan {
 		errorsFound = true
-		if e, ok := err.(*checker.TreeError); ok {
+		if gopts.JSON {
+			e, ok := err.(*checker.TreeError)
+			if !ok {
+				printJSONCheckMessage(newJSONCheckMessage(err, "error"))
+				continue
+			}
+			for _, treeErr := range e.Errors {
+				msg := newJSONCheckMessage(treeErr, "tree_damaged")
+				msg.TreeID = &e.ID
+				printJSONCheckMessage(msg)
+			}
+		} else if e, ok := err.(*checker.TreeError); ok {
 			var clean string
 			if stdoutCanUpdateStatus() {
 				clean = clearLine(0)
@@ -313,50 +423,169 @@ func runCheck(ctx context.Context, opts CheckOptions, gopts GlobalOptions, args
 	// deadlocking in the case of errors.
 	wg.Wait()
 
-	if opts.CheckUnused {
+	// blobs of other snapshots would be reported as unused
+	if opts.CheckUnused && len(opts.Snapshots) == 0 {
 		for _, id := range chkr.UnusedBlobs(ctx) {
-			Verbosef("unused blob %v\n", id)
+			if gopts.JSON {
+				blobID := id.ID
+				printJSONCheckMessage(jsonCheckMessage{
+					MessageType: "error",
+					ErrorType:   "unused_blob",
+					Message:     "unused blob " + id.String(),
+					BlobID:      &blobID,
+				})
+			} else {
+				Verbosef("unused blob %v\n", id)
+			}
 			errorsFound = true
 		}
 	}
 
-	doReadData := func(packs map[restic.ID]int64) {
-		packCount := uint64(len(packs))
-
-		p := newProgressMax(!gopts.Quiet, packCount, "packs")
+	// readPacks reads the packs and returns the IDs of the damaged ones.
+	// complete is false if it is unknown which packs were read successfully.
+	readPacks := func(packs map[restic.ID]int64, p *progress.Counter) (damaged restic.IDSet, complete bool) {
+		damaged = restic.NewIDSet()
+		complete = true
 		errChan := make(chan error)
 
 		go chkr.ReadPacks(ctx, packs, p, errChan)
 
 		for err := range errChan {
 			errorsFound = true
-			Warnf("%v\n", err)
+			if gopts.JSON {
+				printJSONCheckMessage(newJSONCheckMessage(err, "pack_damaged"))
+			} else {
+				Warnf("%v\n", err)
+			}
+
+			var packErr *checker.PackError
+			if errors.As(err, &packErr) {
+				damaged.Insert(packErr.ID)
+			} else {
+				complete = false
+			}
+		}
+		return damaged, complete && ctx.Err() == nil
+	}
+
+	doReadData := func(packs map[restic.ID]int64, selection string) error {
+		if !opts.Resume {
+			p := newPhaseProgressMax(!gopts.Quiet, uint64(len(packs)), "read-data", "packs")
+			readPacks(packs, p)
+			p.Done()
+			return nil
+		}
+
+		if len(snapshotIDs) > 0 {
+			selection += " of snapshots " + snapshotIDs.String()
+		}
+		stateFile := checkStateFile(stateDir, repo.Config().ID)
+		state, err := loadCheckState(stateFile, selection)
+		if err != nil {
+			return err
+		}
+
+		skipped := 0
+		for _, id := range state.Verified {
+			if _, ok := packs[id]; ok {
+				delete(packs, id)
+				skipped++
+			}
+		}
+		if skipped > 0 && !gopts.JSON {
+			Printf("skipping %d packs already read by a previous run\n", skipped)
+		}
+
+		ids := make(restic.IDs, 0, len(packs))
+		for id := range packs {
+			ids = append(ids, id)
+		}
+		sort.Sort(ids)
+
+		p := newPhaseProgressMax(!gopts.Quiet, uint64(len(packs)), "read-data", "packs")
+		defer p.Done()
+
+		allVerified := true
+		for len(ids) > 0 {
+			n := checkStateBatchSize
+			if n > len(ids) {
+				n = len(ids)
+			}
+			batch := make(map[restic.ID]int64, n)
+			for _, id := range ids[:n] {
+				batch[id] = packs[id]
+			}
+			ids = ids[n:]
+
+			damaged, complete := readPacks(batch, p)
+			if !complete {
+				allVerified = false
+				if ctx.Err() != nil {
+					break
+				}
+				continue
+			}
+			if len(damaged) > 0 {
+				allVerified = false
+			}
+
+			for id := range batch {
+				if !damaged.Has(id) {
+					state.Verified = append(state.Verified, id)
+				}
+			}
+			err = state.save(stateFile)
+			if err != nil {
+				Warnf("unable to save check state: %v\n", err)
+			}
+		}
+
+		if allVerified {
+			err = fs.Remove(stateFile)
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				Warnf("unable to remove check state: %v\n", err)
+			}
+		}
+		return nil
+	}
+
+	var allPacks map[restic.ID]int64
+	if readData {
+		if len(opts.Snapshots) > 0 {
+			allPacks = chkr.ReferencedPacks(ctx)
+		} else {
+			allPacks = chkr.GetPacks()
 		}
-		p.Done()
 	}
 
 	switch {
 	case opts.ReadData:
-		Verbosef("read all data\n")
-		doReadData(selectPacksByBucket(chkr.GetPacks(), 1, 1))
+		if len(opts.Snapshots) > 0 {
+			printPhase("read-data", "read data of the selected snapshots\n")
+		} else {
+			printPhase("read-data", "read all data\n")
+		}
+		err = doReadData(selectPacksByBucket(allPacks, 1, 1), "all")
+		if err != nil {
+			return err
+		}
 	case opts.ReadDataSubset != "":
 		var packs map[restic.ID]int64
 		dataSubset, err := stringToIntSlice(opts.ReadDataSubset)
 		if err == nil {
 			bucket := dataSubset[0]
 			totalBuckets := dataSubset[1]
-			packs = selectPacksByBucket(chkr.GetPacks(), bucket, totalBuckets)
+			packs = selectPacksByBucket(allPacks, bucket, totalBuckets)
 			packCount := uint64(len(packs))
-			Verbosef("read group #%d of %d data packs (out of total %d packs in %d groups)\n", bucket, packCount, chkr.CountPacks(), totalBuckets)
+			printPhase("read-data", "read group #%d of %d data packs (out of total %d packs in %d groups)\n", bucket, packCount, len(allPacks), totalBuckets)
 		} else if strings.HasSuffix(opts.ReadDataSubset, "%") {
 			percentage, err := parsePercentage(opts.ReadDataSubset)
 			if err == nil {
-				packs = selectRandomPacksByPercentage(chkr.GetPacks(), percentage)
-				Verbosef("read %.1f%% of data packs\n", percentage)
+				packs = selectRandomPacksByPercentage(allPacks, percentage)
+				printPhase("read-data", "read %.1f%% of data packs\n", percentage)
 			}
 		} else {
 			repoSize := int64(0)
-			allPacks := chkr.GetPacks()
 			for _, size := range allPacks {
 				repoSize += size
 			}
@@ -367,24 +596,142 @@ func runCheck(ctx context.Context, opts CheckOptions, gopts GlobalOptions, args
 			if subsetSize > repoSize {
 				subsetSize = repoSize
 			}
-			packs = selectRandomPacksByFileSize(chkr.GetPacks(), subsetSize, repoSize)
-			Verbosef("read %d bytes of data packs\n", subsetSize)
+			packs = selectRandomPacksByFileSize(allPacks, subsetSize, repoSize)
+			printPhase("read-data", "read %d bytes of data packs\n", subsetSize)
 		}
 		if packs == nil {
 			return errors.Fatal("internal error: failed to select packs to check")
 		}
-		doReadData(packs)
+		err = doReadData(packs, opts.ReadDataSubset)
+		if err != nil {
+			return err
+		}
+	}
+
+	if gopts.JSON {
+		printJSONCheck(summary)
 	}
 
 	if errorsFound {
 		return errors.Fatal("repository contains errors")
 	}
 
-	Verbosef("no errors were found\n")
+	if !gopts.JSON {
+		Verbosef("no errors were found\n")
+	}
 
 	return nil
 }
 
+// jsonCheckMessage is printed with --json for each error or hint found.
+type jsonCheckMessage struct {
+	MessageType string     `json:"message_type"` // "error" or "hint"
+	ErrorType   string     `json:"error_type"`
+	Message     string     `json:"message"`
+	PackID      *restic.ID `json:"pack_id,omitempty"`
+	TreeID      *restic.ID `json:"tree_id,omitempty"`
+	BlobID      *restic.ID `json:"blob_id,omitempty"`
+}
+
+// jsonCheckSummary is printed with --json at the end of the check.
+type jsonCheckSummary struct {
+	MessageType string `json:"message_type"` // "summary"
+	NumErrors   int    `json:"num_errors"`
+	NumHints    int    `json:"num_hints"`
+}
+
+func printJSONCheck(v interface{}) {
+	err := json.NewEncoder(globalOptions.stdout).Encode(v)
+	if err != nil {
+		Warnf("JSON encode failed: %v\n", err)
+	}
+}
+
+// newJSONCheckMessage converts an error returned by the checker into a
+// message for --json. Errors of an unknown kind are reported as fallbackType.
+func newJSONCheckMessage(err error, fallbackType string) jsonCheckMessage {
+	msg := jsonCheckMessage{
+		MessageType: "error",
+		ErrorType:   fallbackType,
+		Message:     err.Error(),
+	}
+
+	var (
+		dupErr   *checker.ErrDuplicatePacks
+		oldErr   *checker.ErrOldIndexFormat
+		mixedErr *checker.ErrMixedPack
+		packErr  *checker.PackError
+		treeErr  *checker.Error
+	)
+	switch {
+	case errors.As(err, &dupErr):
+		msg.MessageType = "hint"
+		msg.ErrorType = "duplicate_pack"
+		msg.PackID = &dupErr.PackID
+	case errors.As(err, &oldErr):
+		msg.MessageType = "hint"
+		msg.ErrorType = "old_index_format"
+	case errors.As(err, &mixedErr):
+		msg.MessageType = "hint"
+		msg.ErrorType = "mixed_pack"
+		msg.PackID = &mixedErr.PackID
+	case errors.Is(err, checker.ErrLegacyLayout):
+		msg.MessageType = "hint"
+		msg.ErrorType = "legacy_layout"
+	case errors.As(err, &packErr):
+		msg.PackID = &packErr.ID
+		switch {
+		case packErr.Orphaned:
+			msg.MessageType = "hint"
+			msg.ErrorType = "orphaned_pack"
+		case errors.Is(err, checker.ErrPackNotFound):
+			msg.ErrorType = "missing_pack"
+		case errors.Is(err, checker.ErrPackSize):
+			msg.ErrorType = "pack_size_mismatch"
+		case errors.Is(err, checker.ErrPackHash):
+			msg.ErrorType = "pack_hash_mismatch"
+		default:
+			msg.ErrorType = "pack_damaged"
+		}
+	case errors.As(err, &treeErr):
+		if !treeErr.TreeID.IsNull() {
+			msg.TreeID = &treeErr.TreeID
+		}
+		if errors.Is(err, checker.ErrBlobNotFound) {
+			msg.ErrorType = "missing_blob"
+		}
+	}
+	return msg
+}
+
+// verifyCache removes all damaged files from the cache. Files which no longer
+// exist in the repository are removed when loading the index.
+func verifyCache(repo *repository.Repository) error {
+	if repo.Cache == nil {
+		return errors.Fatal("--with-cache-verify requires a cache, but the cache is disabled")
+	}
+
+	printPhase("verify-cache", "verify cache\n")
+	removedCount := 0
+	for _, tpe := range []restic.FileType{restic.SnapshotFile, restic.IndexFile, restic.PackFile} {
+		removed, err := repo.Cache.Verify(tpe)
+		if err != nil {
+			return errors.Fatalf("unable to verify cache: %v", err)
+		}
+		if !globalOptions.JSON {
+			for _, id := range removed {
+				Verbosef("removed damaged cache entry %v\n", restic.Handle{Type: tpe, Name: id.String()})
+			}
+		}
+		removedCount += len(removed)
+	}
+
+	if removedCount > 0 && !globalOptions.JSON {
+		Printf("removed %d damaged files from the cache\n", removedCount)
+	}
+	return nil
+}
+
 // selectPacksByBucket selects subsets of packs by ranges of buckets.
 func selectPacksByBucket(allPacks map[restic.ID]int64, bucket, totalBuckets uint) map[restic.ID]int64 {
 	packs := make(map[restic.ID]int64)
@@ -70,9 +70,11 @@ type Comparer struct {
 }
 
 type Change struct {
-	MessageType string `json:"message_type"` // "change"
-	Path        string `json:"path"`
-	Modifier    string `json:"modifier"`
+	MessageType  string `json:"message_type"` // "change"
+	Path         string `json:"path"`
+	Modifier     string `json:"modifier"`
+	AddedBytes   uint64 `json:"added_bytes,omitempty"`
+	RemovedBytes uint64 `json:"removed_bytes,omitempty"`
 }
 
 func NewChange(path string, mode string) *Change {
@@ -139,6 +141,35 @@ type DiffStatsContainer struct {
 	BlobsBefore, BlobsAfter, BlobsCommon restic.BlobSet `json:"-"`
 }
 
+// contentBytes returns the size of the data blobs of the file node which are
+// not part of the file other. Both nodes may be nil.
+func (c *Comparer) contentBytes(node, other *restic.Node) uint64 {
+	if node == nil || node.Type != "file" {
+		return 0
+	}
+
+	known := restic.NewIDSet()
+	if other != nil && other.Type == "file" {
+		known = restic.NewIDSet(other.Content...)
+	}
+
+	var bytes uint64
+	for _, id := range node.Content {
+		if known.Has(id) {
+			continue
+		}
+		known.Insert(id)
+
+		size, found := c.repo.LookupBlobSize(id, restic.DataBlob)
+		if !found {
+			Warnf("unable to find blob size for %v\n", id.Str())
+			continue
+		}
+		bytes += uint64(size)
+	}
+	return bytes
+}
+
 // updateBlobs updates the blob counters in the stats struct.
 func updateBlobs(repo restic.Repository, blobs restic.BlobSet, stats *DiffStat) {
 	for h := range blobs {
@@ -171,7 +202,13 @@ func (c *Comparer) printDir(ctx context.Context, mode string, stats *DiffStat, b
 		if node.Type == "dir" {
 			name += "/"
 		}
-		c.printChange(NewChange(name, mode))
+		change := NewChange(name, mode)
+		if mode == "+" {
+			change.AddedBytes = c.contentBytes(node, nil)
+		} else {
+			change.RemovedBytes = c.contentBytes(node, nil)
+		}
+		c.printChange(change)
 		stats.Add(node)
 		addBlobs(blobs, node)
 
@@ -274,7 +311,10 @@ func (c *Comparer) diffTree(ctx context.Context, stats *DiffStatsContainer, pref
 			}
 
 			if mod != "" {
-				c.printChange(NewChange(name, mod))
+				change := NewChange(name, mod)
+				change.AddedBytes = c.contentBytes(node2, node1)
+				change.RemovedBytes = c.contentBytes(node1, node2)
+				c.printChange(change)
 			}
 
 			if node1.Type == "dir" && node2.Type == "dir" {
@@ -293,7 +333,9 @@ func (c *Comparer) diffTree(ctx context.Context, stats *DiffStatsContainer, pref
 			if node1.Type == "dir" {
 				prefix += "/"
 			}
-			c.printChange(NewChange(prefix, "-"))
+			change := NewChange(prefix, "-")
+			change.RemovedBytes = c.contentBytes(node1, nil)
+			c.printChange(change)
 			stats.Removed.Add(node1)
 
 			if node1.Type == "dir" {
@@ -307,7 +349,9 @@ func (c *Comparer) diffTree(ctx context.Context, stats *DiffStatsContainer, pref
 			if node2.Type == "dir" {
 				prefix += "/"
 			}
-			c.printChange(NewChange(prefix, "+"))
+			change := NewChange(prefix, "+")
+			change.AddedBytes = c.contentBytes(node2, nil)
+			c.printChange(change)
 			stats.Added.Add(node2)
 
 			if node2.Type == "dir" {
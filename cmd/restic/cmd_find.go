@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"regexp"
 	"sort"
 	"strings"
 	"time"
@@ -14,6 +15,7 @@ import (
 	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/filter"
 	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/ui"
 	"github.com/restic/restic/internal/walker"
 )
 
@@ -26,6 +28,9 @@ repo.
 It can also be used to search for restic blobs or trees for troubleshooting.`,
 	Example: `restic find config.json
 restic find --json "*.yml" "*.json"
+restic find --size +1G --type f "*"
+restic find --duplicates --snapshot latest
+restic find --regex -i '/\.(env|aws|ssh)/'
 restic find --json --blob 420f620f b46ebe8a ddd38656
 restic find --show-pack-id --blob 420f620f
 restic find --tree 577c2bc9 f81f2e22 a62827a9
@@ -50,7 +55,11 @@ type FindOptions struct {
 	BlobID, TreeID     bool
 	PackID, ShowPackID bool
 	CaseInsensitive    bool
+	Regex              bool
+	Duplicates         bool
 	ListLong           bool
+	Size               string
+	Type               string
 	snapshotFilterOptions
 }
 
@@ -68,7 +77,11 @@ func init() {
 	f.BoolVar(&findOptions.PackID, "pack", false, "pattern is a pack-ID")
 	f.BoolVar(&findOptions.ShowPackID, "show-pack-id", false, "display the pack-ID the blobs belong to (with --blob or --tree)")
 	f.BoolVarP(&findOptions.CaseInsensitive, "ignore-case", "i", false, "ignore case for pattern")
+	f.BoolVar(&findOptions.Regex, "regex", false, "pattern is a regular expression matched against the full path")
+	f.BoolVar(&findOptions.Duplicates, "duplicates", false, "list matching files with identical content, grouped by content (all files if no pattern is given)")
 	f.BoolVarP(&findOptions.ListLong, "long", "l", false, "use a long listing format showing size and mode")
+	f.StringVar(&findOptions.Size, "size", "", "only match files with a `size` larger than +n, smaller than -n or exactly n (allowed suffixes: k/K, m/M, g/G, t/T)")
+	f.StringVar(&findOptions.Type, "type", "", "only match items of the given `type`s, a comma separated list of f (file), d (dir), l (symlink) or other node types")
 
 	initMultiSnapshotFilterOptions(f, &findOptions.snapshotFilterOptions, true)
 }
@@ -76,7 +89,73 @@ func init() {
 type findPattern struct {
 	oldest, newest time.Time
 	pattern        []string
+	regexps        []*regexp.Regexp
 	ignoreCase     bool
+	size           *sizeFilter
+	types          map[string]struct{}
+}
+
+// sizeFilter matches the size of files like the -size option of find(1).
+type sizeFilter struct {
+	cmp  int // -1: smaller than size, 0: exactly size, 1: larger than size
+	size uint64
+}
+
+func parseSizeFilter(str string) (*sizeFilter, error) {
+	var f sizeFilter
+	switch {
+	case strings.HasPrefix(str, "+"):
+		f.cmp = 1
+		str = str[1:]
+	case strings.HasPrefix(str, "-"):
+		f.cmp = -1
+		str = str[1:]
+	}
+
+	size, err := parseSizeStr(str)
+	if err != nil || size < 0 {
+		return nil, errors.Fatalf("invalid size %q", str)
+	}
+	f.size = uint64(size)
+	return &f, nil
+}
+
+func (f *sizeFilter) match(node *restic.Node) bool {
+	if node.Type != "file" {
+		return false
+	}
+
+	switch f.cmp {
+	case 1:
+		return node.Size > f.size
+	case -1:
+		return node.Size < f.size
+	default:
+		return node.Size == f.size
+	}
+}
+
+// findNodeTypes maps the short names of node types to their full names.
+var findNodeTypes = map[string]string{
+	"f": "file",
+	"d": "dir",
+	"l": "symlink",
+}
+
+func parseTypeFilter(str string) (map[string]struct{}, error) {
+	types := make(map[string]struct{})
+	for _, t := range strings.Split(str, ",") {
+		if name, ok := findNodeTypes[t]; ok {
+			t = name
+		}
+		switch t {
+		case "file", "dir", "symlink", "dev", "chardev", "fifo", "socket":
+			types[t] = struct{}{}
+		default:
+			return nil, errors.Fatalf("invalid type %q", t)
+		}
+	}
+	return types, nil
 }
 
 var timeFormats = []string{
@@ -164,7 +243,7 @@ func (s *statefulOutput) PrintPatternNormal(path string, node *restic.Node) {
 		s.oldsn = s.newsn
 		Verbosef("Found matching entries in snapshot %s from %s\n", s.oldsn.ID().Str(), s.oldsn.Time.Local().Format(TimeFormat))
 	}
-	Println(formatNode(path, node, s.ListLong))
+	Println(formatNode(path, node, s.ListLong, false, TimeFormat))
 }
 
 func (s *statefulOutput) PrintPattern(path string, node *restic.Node) {
@@ -250,6 +329,71 @@ type Finder struct {
 	blobIDs     map[string]struct{}
 	treeIDs     map[string]struct{}
 	itemsFound  int
+
+	// duplicates groups the matching files by content with --duplicates,
+	// in the order in which the content was first found
+	duplicates     map[fileID]*duplicateFiles
+	duplicateOrder []fileID
+}
+
+// duplicateFiles are files with identical content.
+type duplicateFiles struct {
+	Size    uint64          `json:"size"`
+	Matches []duplicateFile `json:"matches"`
+
+	paths map[string]struct{}
+}
+
+type duplicateFile struct {
+	Path       string `json:"path"`
+	SnapshotID string `json:"snapshot"`
+}
+
+// addDuplicate records the file node. A path is only recorded for the first
+// snapshot it is found in.
+func (f *Finder) addDuplicate(path string, node *restic.Node, sn *restic.Snapshot) {
+	id := makeFileIDByContents(node)
+	files, ok := f.duplicates[id]
+	if !ok {
+		files = &duplicateFiles{Size: node.Size, paths: make(map[string]struct{})}
+		f.duplicates[id] = files
+		f.duplicateOrder = append(f.duplicateOrder, id)
+	}
+
+	if _, ok := files.paths[path]; ok {
+		return
+	}
+	files.paths[path] = struct{}{}
+	files.Matches = append(files.Matches, duplicateFile{Path: path, SnapshotID: sn.ID().String()})
+}
+
+// printDuplicates prints all groups of files with content found at more than
+// one path.
+func (f *Finder) printDuplicates() {
+	groups := []*duplicateFiles{}
+	for _, id := range f.duplicateOrder {
+		if files := f.duplicates[id]; len(files.Matches) > 1 {
+			groups = append(groups, files)
+		}
+	}
+
+	if f.out.JSON {
+		err := json.NewEncoder(globalOptions.stdout).Encode(groups)
+		if err != nil {
+			Warnf("JSON encode failed: %v\n", err)
+		}
+		return
+	}
+
+	for i, files := range groups {
+		if i > 0 {
+			Printf("\n")
+		}
+		Printf("%d files with identical content of %s:\n", len(files.Matches), ui.FormatBytes(files.Size))
+		for _, m := range files.Matches {
+			Printf("  %s (snapshot %s)\n", m.Path, m.SnapshotID[:8])
+		}
+	}
 }
 
 func (f *Finder) findInSnapshot(ctx context.Context, sn *restic.Snapshot) error {
@@ -274,20 +418,29 @@ func (f *Finder) findInSnapshot(ctx context.Context, sn *restic.Snapshot) error
 		}
 
 		normalizedNodepath := nodepath
-		if f.pat.ignoreCase {
+		if f.pat.ignoreCase && f.pat.regexps == nil {
 			normalizedNodepath = strings.ToLower(nodepath)
 		}
 
 		var foundMatch bool
 
-		for _, pat := range f.pat.pattern {
-			found, err := filter.Match(pat, normalizedNodepath)
-			if err != nil {
-				return false, err
+		if f.pat.regexps != nil {
+			for _, re := range f.pat.regexps {
+				if re.MatchString(nodepath) {
+					foundMatch = true
+					break
+				}
 			}
-			if found {
-				foundMatch = true
-				break
+		} else {
+			for _, pat := range f.pat.pattern {
+				found, err := filter.Match(pat, normalizedNodepath)
+				if err != nil {
+					return false, err
+				}
+				if found {
+					foundMatch = true
+					break
+				}
 			}
 		}
 
@@ -295,7 +448,10 @@ func (f *Finder) findInSnapshot(ctx context.Context, sn *restic.Snapshot) error
 			ignoreIfNoMatch = true
 			errIfNoMatch    error
 		)
-		if node.Type == "dir" {
+		if node.Type == "dir" && f.pat.regexps != nil {
+			// a regular expression may match any path below the directory
+			ignoreIfNoMatch = false
+		} else if node.Type == "dir" {
 			var childMayMatch bool
 			for _, pat := range f.pat.pattern {
 				mayMatch, err := filter.ChildMatch(pat, normalizedNodepath)
@@ -330,7 +486,26 @@ func (f *Finder) findInSnapshot(ctx context.Context, sn *restic.Snapshot) error
 			return ignoreIfNoMatch, errIfNoMatch
 		}
 
+		if f.pat.types != nil {
+			if _, ok := f.pat.types[node.Type]; !ok {
+				debug.Log("    type %v does not match\n", node.Type)
+				return ignoreIfNoMatch, errIfNoMatch
+			}
+		}
+
+		if f.pat.size != nil && !f.pat.size.match(node) {
+			debug.Log("    size %v does not match\n", node.Size)
+			return ignoreIfNoMatch, errIfNoMatch
+		}
+
 		debug.Log("    found match\n")
+		if f.duplicates != nil {
+			// empty files are not considered to be duplicates
+			if node.Type == "file" && node.Size > 0 {
+				f.addDuplicate(nodepath, node, sn)
+			}
+			return false, nil
+		}
 		f.out.PrintPattern(nodepath, node)
 		return false, nil
 	})
@@ -534,14 +709,48 @@ func (f *Finder) findObjectsPacks(ctx context.Context) {
 	}
 }
 
+// compileFindRegexps compiles the patterns passed to find with --regex.
+func compileFindRegexps(patterns []string, ignoreCase bool) ([]*regexp.Regexp, error) {
+	regexps := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pat := range patterns {
+		expr := pat
+		if ignoreCase {
+			expr = "(?i)" + expr
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, errors.Fatalf("invalid regular expression %q: %v", pat, err)
+		}
+		regexps = append(regexps, re)
+	}
+	return regexps, nil
+}
+
 func runFind(ctx context.Context, opts FindOptions, gopts GlobalOptions, args []string) error {
+	if opts.Duplicates {
+		if opts.BlobID || opts.TreeID || opts.PackID {
+			return errors.Fatal("--duplicates cannot be used to search for IDs")
+		}
+		if len(args) == 0 {
+			args = []string{"*"}
+		}
+	}
+
 	if len(args) == 0 {
 		return errors.Fatal("wrong number of arguments")
 	}
 
 	var err error
 	pat := findPattern{pattern: args}
-	if opts.CaseInsensitive {
+	if opts.Regex {
+		if opts.BlobID || opts.TreeID || opts.PackID {
+			return errors.Fatal("--regex cannot be used to search for IDs")
+		}
+		if pat.regexps, err = compileFindRegexps(args, opts.CaseInsensitive); err != nil {
+			return err
+		}
+		pat.ignoreCase = opts.CaseInsensitive
+	} else if opts.CaseInsensitive {
 		for i := range pat.pattern {
 			pat.pattern[i] = strings.ToLower(pat.pattern[i])
 		}
@@ -560,6 +769,18 @@ func runFind(ctx context.Context, opts FindOptions, gopts GlobalOptions, args []
 		}
 	}
 
+	if opts.Size != "" {
+		if pat.size, err = parseSizeFilter(opts.Size); err != nil {
+			return err
+		}
+	}
+
+	if opts.Type != "" {
+		if pat.types, err = parseTypeFilter(opts.Type); err != nil {
+			return err
+		}
+	}
+
 	// Check at most only one kind of IDs is provided: currently we
 	// can't mix types
 	if (opts.BlobID && opts.TreeID) ||
@@ -618,6 +839,10 @@ func runFind(ctx context.Context, opts FindOptions, gopts GlobalOptions, args []
 		}
 	}
 
+	if opts.Duplicates {
+		f.duplicates = make(map[fileID]*duplicateFiles)
+	}
+
 	for sn := range FindFilteredSnapshots(ctx, snapshotLister, repo, opts.Hosts, opts.Tags, opts.Paths, opts.Snapshots) {
 		if f.blobIDs != nil || f.treeIDs != nil {
 			if err = f.findIDs(ctx, sn); err != nil && err.Error() != "OK" {
@@ -629,6 +854,11 @@ func runFind(ctx context.Context, opts FindOptions, gopts GlobalOptions, args []
 			return err
 		}
 	}
+
+	if f.duplicates != nil {
+		f.printDuplicates()
+		return nil
+	}
 	f.out.Finish()
 
 	if opts.ShowPackID && (f.blobIDs != nil || f.treeIDs != nil) {
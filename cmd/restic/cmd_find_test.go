@@ -0,0 +1,49 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestParseSizeFilter(t *testing.T) {
+	for _, test := range []struct {
+		filter string
+		size   uint64
+		match  bool
+	}{
+		{"+1k", 1025, true},
+		{"+1k", 1024, false},
+		{"-1k", 1023, true},
+		{"-1k", 1024, false},
+		{"1k", 1024, true},
+		{"1k", 1025, false},
+		{"+1G", 2 << 30, true},
+	} {
+		f, err := parseSizeFilter(test.filter)
+		rtest.OK(t, err)
+		node := &restic.Node{Type: "file", Size: test.size}
+		rtest.Assert(t, f.match(node) == test.match, "filter %v, size %v: want %v", test.filter, test.size, test.match)
+	}
+
+	f, err := parseSizeFilter("-1G")
+	rtest.OK(t, err)
+	rtest.Assert(t, !f.match(&restic.Node{Type: "dir"}), "size filter matched a directory")
+
+	for _, filter := range []string{"", "+", "1x", "+-1"} {
+		_, err := parseSizeFilter(filter)
+		rtest.Assert(t, err != nil, "missing error for %q", filter)
+	}
+}
+
+func TestParseTypeFilter(t *testing.T) {
+	types, err := parseTypeFilter("f,l,fifo")
+	rtest.OK(t, err)
+	rtest.Equals(t, map[string]struct{}{"file": {}, "symlink": {}, "fifo": {}}, types)
+
+	for _, filter := range []string{"", "x", "f,"} {
+		_, err := parseTypeFilter(filter)
+		rtest.Assert(t, err != nil, "missing error for %q", filter)
+	}
+}
@@ -18,6 +18,11 @@ The "forget" command removes snapshots according to a policy. All snapshots are
 first divided into groups according to "--group-by", and after that the policy
 specified by the "--keep-*" options is applied to each group individually.
 
+Alternatively, the policy can be read from a YAML file using "--policy-file".
+The file contains a list of rules, each selecting snapshots by host, tag and
+path and specifying the keep options for them. A snapshot is handled by the
+first rule which matches it, snapshots not matched by any rule are kept.
+
 Please note that this command really only deletes the snapshot object in the
 repository, which is a reference to data stored there. In order to remove the
 unreferenced data after "forget" was run successfully, see the "prune" command.
@@ -51,6 +56,7 @@ type ForgetOptions struct {
 	WithinMonthly restic.Duration
 	WithinYearly  restic.Duration
 	KeepTags      restic.TagLists
+	PolicyFile    string
 
 	snapshotFilterOptions
 	Compact bool
@@ -80,6 +86,7 @@ func init() {
 	f.VarP(&forgetOptions.WithinMonthly, "keep-within-monthly", "", "keep monthly snapshots that are newer than `duration` (eg. 1y5m7d2h) relative to the latest snapshot")
 	f.VarP(&forgetOptions.WithinYearly, "keep-within-yearly", "", "keep yearly snapshots that are newer than `duration` (eg. 1y5m7d2h) relative to the latest snapshot")
 	f.Var(&forgetOptions.KeepTags, "keep-tag", "keep snapshots with this `taglist` (can be specified multiple times)")
+	f.StringVar(&forgetOptions.PolicyFile, "policy-file", "", "read the keep rules from `file` instead of the --keep-* options")
 
 	initMultiSnapshotFilterOptions(f, &forgetOptions.snapshotFilterOptions, false)
 	f.StringArrayVar(&forgetOptions.Hosts, "hostname", nil, "only consider snapshots with the given `hostname` (can be specified multiple times)")
@@ -105,6 +112,18 @@ func runForget(ctx context.Context, opts ForgetOptions, gopts GlobalOptions, arg
 		return err
 	}
 
+	var filePolicies []forgetPolicy
+	if opts.PolicyFile != "" {
+		if len(args) > 0 {
+			return errors.Fatal("--policy-file cannot be combined with snapshot IDs")
+		}
+
+		filePolicies, err = loadForgetPolicies(opts.PolicyFile)
+		if err != nil {
+			return err
+		}
+	}
+
 	repo, err := OpenRepository(ctx, gopts)
 	if err != nil {
 		return err
@@ -138,11 +157,6 @@ func runForget(ctx context.Context, opts ForgetOptions, gopts GlobalOptions, arg
 			removeSnIDs.Insert(*sn.ID())
 		}
 	} else {
-		snapshotGroups, _, err := restic.GroupSnapshots(snapshots, opts.GroupBy)
-		if err != nil {
-			return err
-		}
-
 		policy := restic.ExpirePolicy{
 			Last:          opts.Last,
 			Hourly:        opts.Hourly,
@@ -159,15 +173,47 @@ func runForget(ctx context.Context, opts ForgetOptions, gopts GlobalOptions, arg
 			Tags:          opts.KeepTags,
 		}
 
-		if policy.Empty() && len(args) == 0 {
+		policies := []forgetPolicy{{policy: policy}}
+		if filePolicies != nil {
+			if !policy.Empty() {
+				return errors.Fatal("--policy-file cannot be combined with --keep-* options")
+			}
+			policies = filePolicies
+		}
+
+		if len(policies) == 1 && policies[0].policy.Empty() {
 			if !gopts.JSON {
 				Verbosef("no policy was specified, no snapshots will be removed\n")
 			}
 		}
 
-		if !policy.Empty() {
+		// each snapshot is handled by the first policy which matches it
+		for _, p := range policies {
+			if p.policy.Empty() {
+				continue
+			}
+
+			var selected, remaining restic.Snapshots
+			for _, sn := range snapshots {
+				if p.matches(sn) {
+					selected = append(selected, sn)
+				} else {
+					remaining = append(remaining, sn)
+				}
+			}
+			snapshots = remaining
+
+			if len(selected) == 0 {
+				continue
+			}
+
 			if !gopts.JSON {
-				Verbosef("Applying Policy: %v\n", policy)
+				Verbosef("Applying Policy: %v\n", p.policy)
+			}
+
+			snapshotGroups, _, err := restic.GroupSnapshots(selected, opts.GroupBy)
+			if err != nil {
+				return err
 			}
 
 			for k, snapshotGroup := range snapshotGroups {
@@ -188,7 +234,7 @@ func runForget(ctx context.Context, opts ForgetOptions, gopts GlobalOptions, arg
 				fg.Host = key.Hostname
 				fg.Paths = key.Paths
 
-				keep, remove, reasons := restic.ApplyPolicy(snapshotGroup, policy)
+				keep, remove, reasons := restic.ApplyPolicy(snapshotGroup, p.policy)
 
 				if len(keep) != 0 && !gopts.Quiet && !gopts.JSON {
 					Printf("keep %d snapshots:\n", len(keep))
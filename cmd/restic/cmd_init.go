@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"math/bits"
 	"strconv"
 
 	"github.com/restic/chunker"
@@ -36,6 +37,9 @@ type InitOptions struct {
 	secondaryRepoOptions
 	CopyChunkerParameters bool
 	RepositoryVersion     string
+	ChunkMinSize          string
+	ChunkMaxSize          string
+	ChunkAvgSize          string
 }
 
 var initOptions InitOptions
@@ -47,12 +51,15 @@ func init() {
 	initSecondaryRepoOptions(f, &initOptions.secondaryRepoOptions, "secondary", "to copy chunker parameters from")
 	f.BoolVar(&initOptions.CopyChunkerParameters, "copy-chunker-params", false, "copy chunker parameters from the secondary repository (useful with the copy command)")
 	f.StringVar(&initOptions.RepositoryVersion, "repository-version", "stable", "repository format version to use, allowed values are a format version, 'latest' and 'stable'")
+	f.StringVar(&initOptions.ChunkMinSize, "chunk-min-size", "", "minimum `size` of the chunks files are split into (allowed suffixes: k/K, m/M) (default: 512K)")
+	f.StringVar(&initOptions.ChunkMaxSize, "chunk-max-size", "", "maximum `size` of the chunks files are split into (allowed suffixes: k/K, m/M) (default: 8M)")
+	f.StringVar(&initOptions.ChunkAvgSize, "chunk-avg-size", "", "average `size` of the chunks files are split into, must be a power of two (allowed suffixes: k/K, m/M) (default: 1M)")
 }
 
 func runInit(ctx context.Context, opts InitOptions, gopts GlobalOptions, args []string) error {
 	var version uint
 	if opts.RepositoryVersion == "latest" || opts.RepositoryVersion == "" {
-		version = restic.MaxRepoVersion
+		version = restic.LatestRepoVersion
 	} else if opts.RepositoryVersion == "stable" {
 		version = restic.StableRepoVersion
 	} else {
@@ -66,10 +73,14 @@ func runInit(ctx context.Context, opts InitOptions, gopts GlobalOptions, args []
 		return errors.Fatalf("only repository versions between %v and %v are allowed", restic.MinRepoVersion, restic.MaxRepoVersion)
 	}
 
-	chunkerPolynomial, err := maybeReadChunkerPolynomial(ctx, opts, gopts)
+	chunkerPolynomial, chunkerSizes, err := maybeReadChunkerParameters(ctx, opts, gopts)
 	if err != nil {
 		return err
 	}
+	if chunkerSizes != (restic.ChunkerSizes{}) && version < restic.ChunkerSizesRepoVersion {
+		// older versions would silently ignore the chunk sizes
+		return errors.Fatalf("custom chunk sizes require --repository-version %v", restic.ChunkerSizesRepoVersion)
+	}
 
 	repo, err := ReadRepo(gopts)
 	if err != nil {
@@ -83,7 +94,7 @@ func runInit(ctx context.Context, opts InitOptions, gopts GlobalOptions, args []
 		return err
 	}
 
-	be, err := create(ctx, repo, gopts.extended)
+	be, err := create(ctx, repo, gopts, gopts.extended)
 	if err != nil {
 		return errors.Fatalf("create repository at %s failed: %v\n", location.StripPassword(gopts.Repo), err)
 	}
@@ -96,7 +107,7 @@ func runInit(ctx context.Context, opts InitOptions, gopts GlobalOptions, args []
 		return err
 	}
 
-	err = s.Init(ctx, version, gopts.password, chunkerPolynomial)
+	err = s.Init(ctx, version, gopts.password, chunkerPolynomial, chunkerSizes)
 	if err != nil {
 		return errors.Fatalf("create key in repository at %s failed: %v\n", location.StripPassword(gopts.Repo), err)
 	}
@@ -120,26 +131,78 @@ func runInit(ctx context.Context, opts InitOptions, gopts GlobalOptions, args []
 	return nil
 }
 
-func maybeReadChunkerPolynomial(ctx context.Context, opts InitOptions, gopts GlobalOptions) (*chunker.Pol, error) {
+func maybeReadChunkerParameters(ctx context.Context, opts InitOptions, gopts GlobalOptions) (*chunker.Pol, restic.ChunkerSizes, error) {
 	if opts.CopyChunkerParameters {
+		if opts.ChunkMinSize != "" || opts.ChunkMaxSize != "" || opts.ChunkAvgSize != "" {
+			return nil, restic.ChunkerSizes{}, errors.Fatal("chunk sizes cannot be specified when copying the chunker parameters")
+		}
+
 		otherGopts, _, err := fillSecondaryGlobalOpts(opts.secondaryRepoOptions, gopts, "secondary")
 		if err != nil {
-			return nil, err
+			return nil, restic.ChunkerSizes{}, err
 		}
 
 		otherRepo, err := OpenRepository(ctx, otherGopts)
 		if err != nil {
-			return nil, err
+			return nil, restic.ChunkerSizes{}, err
 		}
 
 		pol := otherRepo.Config().ChunkerPolynomial
-		return &pol, nil
+		return &pol, otherRepo.Config().ChunkerSizes, nil
 	}
 
 	if opts.Repo != "" || opts.RepositoryFile != "" || opts.LegacyRepo != "" || opts.LegacyRepositoryFile != "" {
-		return nil, errors.Fatal("Secondary repository must only be specified when copying the chunker parameters")
+		return nil, restic.ChunkerSizes{}, errors.Fatal("Secondary repository must only be specified when copying the chunker parameters")
+	}
+
+	sizes, err := parseChunkerSizes(opts)
+	if err != nil {
+		return nil, restic.ChunkerSizes{}, err
+	}
+	return nil, sizes, nil
+}
+
+// parseChunkerSizes returns the chunk sizes set in opts. Sizes which are not
+// set are left at zero to select the default.
+func parseChunkerSizes(opts InitOptions) (restic.ChunkerSizes, error) {
+	var sizes restic.ChunkerSizes
+
+	parse := func(name, str string) (uint, error) {
+		if str == "" {
+			return 0, nil
+		}
+		size, err := parseSizeStr(str)
+		if err != nil || size <= 0 {
+			return 0, errors.Fatalf("invalid %s %q", name, str)
+		}
+		return uint(size), nil
+	}
+
+	var err error
+	sizes.MinSize, err = parse("--chunk-min-size", opts.ChunkMinSize)
+	if err != nil {
+		return sizes, err
+	}
+	sizes.MaxSize, err = parse("--chunk-max-size", opts.ChunkMaxSize)
+	if err != nil {
+		return sizes, err
+	}
+
+	avg, err := parse("--chunk-avg-size", opts.ChunkAvgSize)
+	if err != nil {
+		return sizes, err
+	}
+	if avg != 0 {
+		if avg&(avg-1) != 0 {
+			return sizes, errors.Fatalf("--chunk-avg-size %q is not a power of two", opts.ChunkAvgSize)
+		}
+		sizes.AverageBits = bits.TrailingZeros(avg)
+	}
+
+	if err := sizes.Validate(); err != nil {
+		return sizes, errors.Fatalf("invalid chunk sizes: %v", err)
 	}
-	return nil, nil
+	return sizes, nil
 }
 
 type initSuccess struct {
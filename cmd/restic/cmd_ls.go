@@ -3,7 +3,10 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"io"
 	"os"
+	"path"
 	"strings"
 	"time"
 
@@ -11,6 +14,7 @@ import (
 
 	"github.com/restic/restic/internal/backend"
 	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/filter"
 	"github.com/restic/restic/internal/fs"
 	"github.com/restic/restic/internal/restic"
 	"github.com/restic/restic/internal/walker"
@@ -35,6 +39,48 @@ will allow traversing into matching directories' subfolders.
 Any directory paths specified must be absolute (starting with
 a path separator); paths use the forward slash '/' as separator.
 
+The --exclude and --include flags accept the same patterns as the
+backup and restore commands. Excluded directories are not descended
+into. If include patterns are given, only matching files and
+directories are listed.
+
+The --sort flag orders the entries of each directory by "name" (the
+default), "size", "mtime" or "extension". Use --reverse to invert the
+order. Subdirectories are still listed right after their parent.
+
+If the global --json flag is set, the output consists of one JSON object
+per line: first an object with "struct_type" set to "snapshot" describing
+the listed snapshot, followed by one object with "struct_type" set to
+"node" for each file or directory, including its path, type, size, mode,
+uid, gid and timestamps.
+
+The --max-depth flag limits the listing to entries at most the given number
+of levels below the root of the snapshot, for example "--max-depth 1" only
+lists the top-level entries. Directories below that level are not loaded
+at all. With --dirs-only, only directories are listed.
+
+The --larger-than and --smaller-than flags only list files whose size is
+above or below the given size; other entries are not listed if one of them
+is used. The --newer-than and --older-than flags select entries by their
+modification time. They accept either a date, for example "2023-01-31" or
+"2023-01-31 15:04", or a duration relative to the current time, for example
+"7d" for seven days or "1y6m" for one and a half years. The walk still
+descends into directories which do not match the filters.
+
+In the long listing, sizes are printed in bytes unless --human-readable is
+specified. Modification times are printed in the local time zone; the
+format can be changed with --time-format, which accepts "iso" for ISO 8601
+timestamps or a reference time layout as used by the Go time package, for
+example "Jan _2 15:04".
+
+The --blobs flag additionally prints the IDs of the data blobs a file
+consists of, together with the IDs of the pack files containing them.
+Blobs which are missing from the index are reported as such.
+
+The --ncdu flag prints the listing in the export format of the ncdu disk
+usage analyzer, which allows to explore the snapshot interactively using
+"restic ls --ncdu latest | ncdu -f -".
+
 EXIT STATUS
 ===========
 
@@ -50,7 +96,24 @@ Exit status is 0 if the command was successful, and non-zero if there was any er
 type LsOptions struct {
 	ListLong bool
 	snapshotFilterOptions
-	Recursive bool
+	Recursive          bool
+	Exclude            []string
+	InsensitiveExclude []string
+	Include            []string
+	InsensitiveInclude []string
+	Sort               string
+	Reverse            bool
+	Ncdu               bool
+	ShowBlobs          bool
+	MaxDepth           int
+	DirsOnly           bool
+	Print0             bool
+	HumanReadable      bool
+	TimeFormat         string
+	LargerThan         string
+	SmallerThan        string
+	NewerThan          string
+	OlderThan          string
 }
 
 var lsOptions LsOptions
@@ -62,6 +125,23 @@ func init() {
 	initSingleSnapshotFilterOptions(flags, &lsOptions.snapshotFilterOptions)
 	flags.BoolVarP(&lsOptions.ListLong, "long", "l", false, "use a long listing format showing size and mode")
 	flags.BoolVar(&lsOptions.Recursive, "recursive", false, "include files in subfolders of the listed directories")
+	flags.StringArrayVarP(&lsOptions.Exclude, "exclude", "e", nil, "exclude a `pattern` (can be specified multiple times)")
+	flags.StringArrayVar(&lsOptions.InsensitiveExclude, "iexclude", nil, "same as `--exclude` but ignores the casing of filenames")
+	flags.StringArrayVarP(&lsOptions.Include, "include", "i", nil, "include a `pattern`, exclude everything else (can be specified multiple times)")
+	flags.StringArrayVar(&lsOptions.InsensitiveInclude, "iinclude", nil, "same as `--include` but ignores the casing of filenames")
+	flags.StringVar(&lsOptions.Sort, "sort", "name", "sort entries of each directory by `field` (name, size, mtime, extension)")
+	flags.BoolVar(&lsOptions.Reverse, "reverse", false, "reverse the sort order")
+	flags.BoolVar(&lsOptions.Ncdu, "ncdu", false, "output NCDU export format (pipe into 'ncdu -f -')")
+	flags.BoolVar(&lsOptions.ShowBlobs, "blobs", false, "show the data blobs of each file and the packs containing them")
+	flags.IntVar(&lsOptions.MaxDepth, "max-depth", 0, "only list entries up to `n` levels below the snapshot root (0 means no limit)")
+	flags.BoolVar(&lsOptions.DirsOnly, "dirs-only", false, "only list directories")
+	flags.BoolVar(&lsOptions.Print0, "print0", false, "terminate each entry with a NUL character instead of a newline, e.g. for 'xargs -0'")
+	flags.BoolVar(&lsOptions.HumanReadable, "human-readable", false, "print sizes in human readable format in the long listing")
+	flags.StringVar(&lsOptions.LargerThan, "larger-than", "", "only list files larger than `size` (allowed suffixes: k/K, m/M, g/G, t/T)")
+	flags.StringVar(&lsOptions.SmallerThan, "smaller-than", "", "only list files smaller than `size` (allowed suffixes: k/K, m/M, g/G, t/T)")
+	flags.StringVar(&lsOptions.NewerThan, "newer-than", "", "only list entries modified after `time`, either a date or a duration like 7d or 1y2m")
+	flags.StringVar(&lsOptions.OlderThan, "older-than", "", "only list entries modified before `time`, either a date or a duration like 7d or 1y2m")
+	flags.StringVar(&lsOptions.TimeFormat, "time-format", "", "`format` for timestamps in the long listing, either \"iso\" for ISO 8601 or a Go time layout")
 }
 
 type lsSnapshot struct {
@@ -71,8 +151,48 @@ type lsSnapshot struct {
 	StructType string     `json:"struct_type"` // "snapshot"
 }
 
-// Print node in our custom JSON format, followed by a newline.
-func lsNodeJSON(enc *json.Encoder, path string, node *restic.Node) error {
+// lsBlob describes a data blob of a file and the packs it is stored in.
+type lsBlob struct {
+	ID    restic.ID  `json:"id"`
+	Packs restic.IDs `json:"packs"`
+}
+
+// lsFileBlobs looks up the packs for all data blobs of node in the index.
+func lsFileBlobs(idx restic.MasterIndex, node *restic.Node) []lsBlob {
+	if node.Type != "file" {
+		return nil
+	}
+
+	blobs := make([]lsBlob, 0, len(node.Content))
+	for _, id := range node.Content {
+		b := lsBlob{ID: id, Packs: restic.IDs{}}
+		for _, pb := range idx.Lookup(restic.BlobHandle{ID: id, Type: restic.DataBlob}) {
+			b.Packs = append(b.Packs, pb.PackID)
+		}
+		blobs = append(blobs, b)
+	}
+	return blobs
+}
+
+// formatBlobs returns one line for each blob, listing the packs it is
+// contained in.
+func formatBlobs(blobs []lsBlob) string {
+	var lines []string
+	for _, b := range blobs {
+		if len(b.Packs) == 0 {
+			lines = append(lines, fmt.Sprintf("    blob %v not found in index", b.ID))
+			continue
+		}
+		for _, pack := range b.Packs {
+			lines = append(lines, fmt.Sprintf("    blob %v in pack %v", b.ID, pack))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Print node in our custom JSON format, followed by a newline. If blobs is
+// not nil, the data blobs of the node are included.
+func lsNodeJSON(enc *json.Encoder, path string, node *restic.Node, blobs []lsBlob) error {
 	n := &struct {
 		Name        string      `json:"name"`
 		Type        string      `json:"type"`
@@ -85,6 +205,7 @@ func lsNodeJSON(enc *json.Encoder, path string, node *restic.Node) error {
 		ModTime     time.Time   `json:"mtime,omitempty"`
 		AccessTime  time.Time   `json:"atime,omitempty"`
 		ChangeTime  time.Time   `json:"ctime,omitempty"`
+		Blobs       []lsBlob    `json:"blobs,omitempty"`
 		StructType  string      `json:"struct_type"` // "node"
 
 		size uint64 // Target for Size pointer.
@@ -100,6 +221,7 @@ func lsNodeJSON(enc *json.Encoder, path string, node *restic.Node) error {
 		ModTime:     node.ModTime,
 		AccessTime:  node.AccessTime,
 		ChangeTime:  node.ChangeTime,
+		Blobs:       blobs,
 		StructType:  "node",
 	}
 	// Always print size for regular files, even when empty,
@@ -111,10 +233,354 @@ func lsNodeJSON(enc *json.Encoder, path string, node *restic.Node) error {
 	return enc.Encode(n)
 }
 
+// parseTimeOrDuration parses str either as a point in time, see parseTime, or
+// as a duration like "7d" that is subtracted from now.
+func parseTimeOrDuration(str string, now time.Time) (time.Time, error) {
+	if d, err := restic.ParseDuration(str); err == nil {
+		return now.AddDate(-d.Years, -d.Months, -d.Days).Add(time.Hour * time.Duration(-d.Hours)), nil
+	}
+
+	return parseTime(str)
+}
+
+// lsNodeFilter returns a function which reports whether a node matches the
+// size and time filters in opts.
+func lsNodeFilter(opts LsOptions, now time.Time) (func(node *restic.Node) bool, error) {
+	var (
+		minSize, maxSize int64 = -1, -1
+		newer, older     time.Time
+		err              error
+	)
+
+	if opts.LargerThan != "" {
+		minSize, err = parseSizeStr(opts.LargerThan)
+		if err != nil {
+			return nil, errors.Fatalf("invalid value for --larger-than: %v", err)
+		}
+	}
+	if opts.SmallerThan != "" {
+		maxSize, err = parseSizeStr(opts.SmallerThan)
+		if err != nil {
+			return nil, errors.Fatalf("invalid value for --smaller-than: %v", err)
+		}
+	}
+	if opts.NewerThan != "" {
+		newer, err = parseTimeOrDuration(opts.NewerThan, now)
+		if err != nil {
+			return nil, errors.Fatalf("invalid value for --newer-than: %v", err)
+		}
+	}
+	if opts.OlderThan != "" {
+		older, err = parseTimeOrDuration(opts.OlderThan, now)
+		if err != nil {
+			return nil, errors.Fatalf("invalid value for --older-than: %v", err)
+		}
+	}
+
+	return func(node *restic.Node) bool {
+		if minSize >= 0 || maxSize >= 0 {
+			if node.Type != "file" {
+				return false
+			}
+			if minSize >= 0 && node.Size <= uint64(minSize) {
+				return false
+			}
+			if maxSize >= 0 && node.Size >= uint64(maxSize) {
+				return false
+			}
+		}
+		if !newer.IsZero() && !node.ModTime.After(newer) {
+			return false
+		}
+		if !older.IsZero() && !node.ModTime.Before(older) {
+			return false
+		}
+		return true
+	}, nil
+}
+
+// lsSortFunc returns the function used to order the entries of a directory
+// for the given sort field.
+func lsSortFunc(field string, reverse bool) (walker.LessFunc, error) {
+	var less walker.LessFunc
+	switch field {
+	case "", "name":
+		less = func(a, b *restic.Node) bool {
+			return a.Name < b.Name
+		}
+	case "size":
+		less = func(a, b *restic.Node) bool {
+			return a.Size < b.Size
+		}
+	case "mtime":
+		less = func(a, b *restic.Node) bool {
+			return a.ModTime.Before(b.ModTime)
+		}
+	case "extension":
+		less = func(a, b *restic.Node) bool {
+			return path.Ext(a.Name) < path.Ext(b.Name)
+		}
+	default:
+		return nil, errors.Fatalf("unknown sort field %q, must be one of name, size, mtime, extension", field)
+	}
+
+	if reverse {
+		return func(a, b *restic.Node) bool {
+			return less(b, a)
+		}, nil
+	}
+	return less, nil
+}
+
+// ncduLsPrinter prints the nodes of a snapshot in the ncdu export format,
+// see https://dev.yorhel.nl/ncdu/jsonfmt. Directories are represented as
+// arrays containing the directory itself followed by its children, which
+// requires that a directory is printed before its contents. Directories
+// which are not listed themselves, for example due to a filter, are printed
+// once one of their children is printed.
+type ncduLsPrinter struct {
+	out io.Writer
+	// dirs holds the paths of all directories which are currently open.
+	dirs []string
+	// skipped holds the directories below the last open one which were not
+	// printed, but whose children may still be, outermost first.
+	skipped []ncduDir
+}
+
+type ncduDir struct {
+	path string
+	node *restic.Node
+}
+
+func (p *ncduLsPrinter) Snapshot(sn *restic.Snapshot) {
+	const NcduMajorVer = 1
+	const NcduMinorVer = 2
+
+	meta, err := json.Marshal(struct {
+		ProgName  string `json:"progname"`
+		ProgVer   string `json:"progver"`
+		Timestamp int64  `json:"timestamp"`
+	}{"restic", version, sn.Time.Unix()})
+	if err != nil {
+		Warnf("JSON encode failed: %v\n", err)
+		return
+	}
+
+	root, err := json.Marshal(struct {
+		Name string `json:"name"`
+	}{"/"})
+	if err != nil {
+		Warnf("JSON encode failed: %v\n", err)
+		return
+	}
+
+	fmt.Fprintf(p.out, "[%d, %d, %s, [%s", NcduMajorVer, NcduMinorVer, meta, root)
+	p.dirs = []string{"/"}
+}
+
+// lsNcduNode converts node to an entry of the ncdu export format.
+func lsNcduNode(node *restic.Node) ([]byte, error) {
+	type NcduNode struct {
+		Name   string `json:"name"`
+		Asize  uint64 `json:"asize"`
+		Dsize  uint64 `json:"dsize"`
+		Dev    uint64 `json:"dev,omitempty"`
+		Ino    uint64 `json:"ino,omitempty"`
+		Hlnkc  bool   `json:"hlnkc,omitempty"`
+		NotReg bool   `json:"notreg,omitempty"`
+		UID    uint32 `json:"uid"`
+		GID    uint32 `json:"gid"`
+		Mode   uint32 `json:"mode"`
+		Mtime  int64  `json:"mtime"`
+	}
+
+	const blockSize = 512
+
+	n := NcduNode{
+		Name:  node.Name,
+		Asize: node.Size,
+		// round up to the next full block
+		Dsize:  (node.Size + blockSize - 1) / blockSize * blockSize,
+		Dev:    node.DeviceID,
+		Ino:    node.Inode,
+		Hlnkc:  node.Type == "file" && node.Links > 1,
+		NotReg: node.Type != "dir" && node.Type != "file",
+		UID:    node.UID,
+		GID:    node.GID,
+		Mode:   uint32(node.Mode & os.ModePerm),
+		Mtime:  node.ModTime.Unix(),
+	}
+
+	// file type and special bits as defined in inode(7)
+	switch node.Type {
+	case "file":
+		n.Mode |= 0100000
+	case "dir":
+		n.Mode |= 0040000
+	case "symlink":
+		n.Mode |= 0120000
+	case "dev":
+		n.Mode |= 0060000
+	case "chardev":
+		n.Mode |= 0020000
+	case "fifo":
+		n.Mode |= 0010000
+	case "socket":
+		n.Mode |= 0140000
+	}
+	if node.Mode&os.ModeSetuid != 0 {
+		n.Mode |= 04000
+	}
+	if node.Mode&os.ModeSetgid != 0 {
+		n.Mode |= 02000
+	}
+	if node.Mode&os.ModeSticky != 0 {
+		n.Mode |= 01000
+	}
+
+	return json.Marshal(n)
+}
+
+// dropSkipped forgets the skipped directories which do not contain
+// nodepath.
+func (p *ncduLsPrinter) dropSkipped(nodepath string) {
+	parent := path.Dir(nodepath)
+	for len(p.skipped) > 0 && !fs.HasPathPrefix(p.skipped[len(p.skipped)-1].path, parent) {
+		p.skipped = p.skipped[:len(p.skipped)-1]
+	}
+}
+
+// SkippedDir records a directory which is not printed. It is printed later
+// if any of its children is printed.
+func (p *ncduLsPrinter) SkippedDir(nodepath string, node *restic.Node) {
+	p.dropSkipped(nodepath)
+	p.skipped = append(p.skipped, ncduDir{path: nodepath, node: node})
+}
+
+func (p *ncduLsPrinter) Node(nodepath string, node *restic.Node) {
+	// close all directories which do not contain the node
+	parent := path.Dir(nodepath)
+	for len(p.dirs) > 1 && !fs.HasPathPrefix(p.dirs[len(p.dirs)-1], parent) {
+		fmt.Fprint(p.out, "]")
+		p.dirs = p.dirs[:len(p.dirs)-1]
+	}
+
+	// open the parent directories which were not printed yet
+	p.dropSkipped(nodepath)
+	skipped := p.skipped
+	p.skipped = nil
+	for _, dir := range skipped {
+		p.print(dir.path, dir.node)
+	}
+	p.print(nodepath, node)
+}
+
+func (p *ncduLsPrinter) print(nodepath string, node *restic.Node) {
+	out, err := lsNcduNode(node)
+	if err != nil {
+		Warnf("JSON encode failed: %v\n", err)
+		return
+	}
+
+	if node.Type == "dir" {
+		fmt.Fprintf(p.out, ",\n[%s", out)
+		p.dirs = append(p.dirs, nodepath)
+	} else {
+		fmt.Fprintf(p.out, ",\n%s", out)
+	}
+}
+
+func (p *ncduLsPrinter) Close() {
+	fmt.Fprint(p.out, strings.Repeat("]", len(p.dirs))+"]\n")
+}
+
 func runLs(ctx context.Context, opts LsOptions, gopts GlobalOptions, args []string) error {
 	if len(args) == 0 {
 		return errors.Fatal("no snapshot ID specified, specify snapshot ID or use special ID 'latest'")
 	}
+	if opts.Ncdu && gopts.JSON {
+		return errors.Fatal("only either --json or --ncdu can be specified")
+	}
+	if opts.Print0 && (opts.Ncdu || gopts.JSON) {
+		return errors.Fatal("--print0 cannot be combined with --json or --ncdu")
+	}
+	if opts.MaxDepth < 0 {
+		return errors.Fatal("--max-depth must not be negative")
+	}
+
+	less, err := lsSortFunc(opts.Sort, opts.Reverse)
+	if err != nil {
+		return err
+	}
+
+	matchesFilter, err := lsNodeFilter(opts, time.Now())
+	if err != nil {
+		return err
+	}
+
+	// Validate provided patterns
+	for _, p := range []struct {
+		name     string
+		patterns []string
+	}{
+		{"--exclude", opts.Exclude},
+		{"--iexclude", opts.InsensitiveExclude},
+		{"--include", opts.Include},
+		{"--iinclude", opts.InsensitiveInclude},
+	} {
+		if err := filter.ValidatePatterns(p.patterns); err != nil {
+			return errors.Fatalf("%s: %s", p.name, err)
+		}
+	}
+
+	for i, str := range opts.InsensitiveExclude {
+		opts.InsensitiveExclude[i] = strings.ToLower(str)
+	}
+
+	for i, str := range opts.InsensitiveInclude {
+		opts.InsensitiveInclude[i] = strings.ToLower(str)
+	}
+
+	excludePatterns := filter.ParsePatterns(opts.Exclude)
+	insensitiveExcludePatterns := filter.ParsePatterns(opts.InsensitiveExclude)
+	includePatterns := filter.ParsePatterns(opts.Include)
+	insensitiveIncludePatterns := filter.ParsePatterns(opts.InsensitiveInclude)
+	hasIncludes := len(includePatterns) > 0 || len(insensitiveIncludePatterns) > 0
+
+	// isExcluded reports whether nodepath matches one of the exclude patterns.
+	isExcluded := func(nodepath string) bool {
+		matched, err := filter.List(excludePatterns, nodepath)
+		if err != nil {
+			Warnf("error for exclude pattern: %v", err)
+		}
+
+		matchedInsensitive, err := filter.List(insensitiveExcludePatterns, strings.ToLower(nodepath))
+		if err != nil {
+			Warnf("error for iexclude pattern: %v", err)
+		}
+
+		return matched || matchedInsensitive
+	}
+
+	// isIncluded reports whether nodepath should be printed and whether
+	// children of nodepath may still match one of the include patterns.
+	isIncluded := func(nodepath string) (included bool, childMayMatch bool) {
+		if !hasIncludes {
+			return true, true
+		}
+
+		matched, childMayMatch, err := filter.ListWithChild(includePatterns, nodepath)
+		if err != nil {
+			Warnf("error for include pattern: %v", err)
+		}
+
+		matchedInsensitive, childMayMatchInsensitive, err := filter.ListWithChild(insensitiveIncludePatterns, strings.ToLower(nodepath))
+		if err != nil {
+			Warnf("error for iinclude pattern: %v", err)
+		}
+
+		return matched || matchedInsensitive, childMayMatch || childMayMatchInsensitive
+	}
 
 	// extract any specific directories to walk
 	var dirs []string
@@ -176,11 +642,19 @@ func runLs(ctx context.Context, opts LsOptions, gopts GlobalOptions, args []stri
 	}
 
 	var (
-		printSnapshot func(sn *restic.Snapshot)
-		printNode     func(path string, node *restic.Node)
+		printSnapshot   func(sn *restic.Snapshot)
+		printNode       func(path string, node *restic.Node)
+		printSkippedDir = func(path string, node *restic.Node) {}
+		printFinish     = func() {}
 	)
 
-	if gopts.JSON {
+	if opts.Ncdu {
+		p := &ncduLsPrinter{out: gopts.stdout}
+		printSnapshot = p.Snapshot
+		printNode = p.Node
+		printSkippedDir = p.SkippedDir
+		printFinish = p.Close
+	} else if gopts.JSON {
 		enc := json.NewEncoder(gopts.stdout)
 
 		printSnapshot = func(sn *restic.Snapshot) {
@@ -196,7 +670,11 @@ func runLs(ctx context.Context, opts LsOptions, gopts GlobalOptions, args []stri
 		}
 
 		printNode = func(path string, node *restic.Node) {
-			err := lsNodeJSON(enc, path, node)
+			var blobs []lsBlob
+			if opts.ShowBlobs {
+				blobs = lsFileBlobs(repo.Index(), node)
+			}
+			err := lsNodeJSON(enc, path, node, blobs)
 			if err != nil {
 				Warnf("JSON encode failed: %v\n", err)
 			}
@@ -205,8 +683,24 @@ func runLs(ctx context.Context, opts LsOptions, gopts GlobalOptions, args []stri
 		printSnapshot = func(sn *restic.Snapshot) {
 			Verbosef("snapshot %s of %v filtered by %v at %s):\n", sn.ID().Str(), sn.Paths, dirs, sn.Time)
 		}
+		timeFormat := TimeFormat
+		switch opts.TimeFormat {
+		case "":
+		case "iso":
+			timeFormat = time.RFC3339
+		default:
+			timeFormat = opts.TimeFormat
+		}
+
+		term := "\n"
+		if opts.Print0 {
+			term = "\x00"
+		}
 		printNode = func(path string, node *restic.Node) {
-			Printf("%s\n", formatNode(path, node, lsOptions.ListLong))
+			Printf("%s%s", formatNode(path, node, opts.ListLong, opts.HumanReadable, timeFormat), term)
+			if opts.ShowBlobs && node.Type == "file" && len(node.Content) > 0 {
+				Printf("%s%s", formatBlobs(lsFileBlobs(repo.Index(), node)), term)
+			}
 		}
 	}
 
@@ -217,7 +711,7 @@ func runLs(ctx context.Context, opts LsOptions, gopts GlobalOptions, args []stri
 
 	printSnapshot(sn)
 
-	err = walker.Walk(ctx, repo, *sn.Tree, nil, func(_ restic.ID, nodepath string, node *restic.Node, err error) (bool, error) {
+	err = walker.WalkSorted(ctx, repo, *sn.Tree, nil, less, func(_ restic.ID, nodepath string, node *restic.Node, err error) (bool, error) {
 		if err != nil {
 			return false, err
 		}
@@ -225,10 +719,37 @@ func runLs(ctx context.Context, opts LsOptions, gopts GlobalOptions, args []stri
 			return false, nil
 		}
 
-		if withinDir(nodepath) {
+		if isExcluded(nodepath) {
+			if node.Type == "dir" {
+				return false, walker.ErrSkipNode
+			}
+			return false, nil
+		}
+
+		included, childMayMatch := isIncluded(nodepath)
+		if !included && !childMayMatch && node.Type == "dir" {
+			return false, walker.ErrSkipNode
+		}
+		if opts.DirsOnly && node.Type != "dir" {
+			included = false
+		}
+		if included && !matchesFilter(node) {
+			included = false
+		}
+
+		if withinDir(nodepath) && included {
 			// if we're within a dir, print the node
 			printNode(nodepath, node)
+		} else if node.Type == "dir" {
+			printSkippedDir(nodepath, node)
+		}
 
+		// do not descend below the maximum depth
+		if opts.MaxDepth > 0 && node.Type == "dir" && strings.Count(nodepath, "/") >= opts.MaxDepth {
+			return false, walker.ErrSkipNode
+		}
+
+		if withinDir(nodepath) {
 			// if recursive listing is requested, signal the walker that it
 			// should continue walking recursively
 			if opts.Recursive {
@@ -254,5 +775,7 @@ func runLs(ctx context.Context, opts LsOptions, gopts GlobalOptions, args []stri
 		return err
 	}
 
+	printFinish()
+
 	return nil
 }
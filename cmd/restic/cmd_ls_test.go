@@ -3,7 +3,10 @@ package main
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"os"
+	"sort"
+	"strings"
 	"testing"
 	"time"
 
@@ -80,7 +83,7 @@ func TestLsNodeJSON(t *testing.T) {
 	} {
 		buf := new(bytes.Buffer)
 		enc := json.NewEncoder(buf)
-		err := lsNodeJSON(enc, c.path, &c.Node)
+		err := lsNodeJSON(enc, c.path, &c.Node, nil)
 		rtest.OK(t, err)
 		rtest.Equals(t, c.expect+"\n", buf.String())
 
@@ -90,3 +93,182 @@ func TestLsNodeJSON(t *testing.T) {
 		rtest.OK(t, err)
 	}
 }
+
+func TestLsSortFunc(t *testing.T) {
+	nodes := []*restic.Node{
+		{Name: "b.txt", Size: 3, ModTime: time.Unix(200, 0)},
+		{Name: "a.zip", Size: 1, ModTime: time.Unix(300, 0)},
+		{Name: "c.go", Size: 2, ModTime: time.Unix(100, 0)},
+	}
+
+	for _, c := range []struct {
+		field   string
+		reverse bool
+		expect  []string
+	}{
+		{"name", false, []string{"a.zip", "b.txt", "c.go"}},
+		{"name", true, []string{"c.go", "b.txt", "a.zip"}},
+		{"size", false, []string{"a.zip", "c.go", "b.txt"}},
+		{"mtime", false, []string{"c.go", "b.txt", "a.zip"}},
+		{"mtime", true, []string{"a.zip", "b.txt", "c.go"}},
+		{"extension", false, []string{"c.go", "b.txt", "a.zip"}},
+	} {
+		less, err := lsSortFunc(c.field, c.reverse)
+		rtest.OK(t, err)
+
+		sorted := append([]*restic.Node(nil), nodes...)
+		sort.SliceStable(sorted, func(i, j int) bool {
+			return less(sorted[i], sorted[j])
+		})
+
+		var names []string
+		for _, node := range sorted {
+			names = append(names, node.Name)
+		}
+		rtest.Equals(t, c.expect, names)
+	}
+
+	_, err := lsSortFunc("inode", false)
+	rtest.Assert(t, err != nil, "expected error for unknown sort field")
+}
+
+func TestLsNcdu(t *testing.T) {
+	var buf bytes.Buffer
+	printer := &ncduLsPrinter{out: &buf}
+
+	printer.Snapshot(&restic.Snapshot{
+		Hostname: "host",
+		Paths:    []string{"/example"},
+		Time:     time.Unix(1700000000, 0),
+	})
+	printer.Node("/directory", &restic.Node{
+		Name:    "directory",
+		Type:    "dir",
+		Mode:    os.ModeDir | 0755,
+		ModTime: time.Unix(1700000001, 0),
+	})
+	printer.Node("/directory/data", &restic.Node{
+		Name:    "data",
+		Type:    "file",
+		Mode:    0644,
+		Size:    1000,
+		ModTime: time.Unix(1700000002, 0),
+	})
+	printer.Node("/file", &restic.Node{
+		Name:    "file",
+		Type:    "file",
+		Mode:    0600 | os.ModeSetuid,
+		Size:    42,
+		UID:     1000,
+		GID:     100,
+		Inode:   12,
+		Links:   2,
+		ModTime: time.Unix(1700000003, 0),
+	})
+	printer.Node("/link", &restic.Node{
+		Name: "link",
+		Type: "symlink",
+		Mode: os.ModeSymlink | 0777,
+	})
+	printer.Close()
+
+	rtest.Equals(t, `[1, 2, {"progname":"restic","progver":"`+version+`","timestamp":1700000000}, [{"name":"/"},
+[{"name":"directory","asize":0,"dsize":0,"uid":0,"gid":0,"mode":16877,"mtime":1700000001},
+{"name":"data","asize":1000,"dsize":1024,"uid":0,"gid":0,"mode":33188,"mtime":1700000002}],
+{"name":"file","asize":42,"dsize":512,"ino":12,"hlnkc":true,"uid":1000,"gid":100,"mode":35200,"mtime":1700000003},
+{"name":"link","asize":0,"dsize":0,"notreg":true,"uid":0,"gid":0,"mode":41471,"mtime":`+fmt.Sprint(time.Time{}.Unix())+`}]]
+`, buf.String())
+
+	// Sanity check: output must be valid JSON.
+	var v interface{}
+	rtest.OK(t, json.Unmarshal(buf.Bytes(), &v))
+}
+
+func TestLsNcduSkippedDirs(t *testing.T) {
+	var buf bytes.Buffer
+	printer := &ncduLsPrinter{out: &buf}
+
+	dir := func(name string) *restic.Node {
+		return &restic.Node{Name: name, Type: "dir", Mode: os.ModeDir | 0755}
+	}
+	file := func(name string) *restic.Node {
+		return &restic.Node{Name: name, Type: "file", Mode: 0644}
+	}
+
+	printer.Snapshot(&restic.Snapshot{Time: time.Unix(1700000000, 0)})
+	printer.SkippedDir("/a", dir("a"))
+	printer.SkippedDir("/a/b", dir("b"))
+	printer.Node("/a/b/x", file("x"))
+	printer.Node("/a/b/y", file("y"))
+	// skipped dirs without printed children are not printed
+	printer.SkippedDir("/a/c", dir("c"))
+	printer.SkippedDir("/a/c/d", dir("d"))
+	printer.SkippedDir("/a/e", dir("e"))
+	printer.Node("/a/e/z", file("z"))
+	printer.Node("/f", file("f"))
+	printer.Close()
+
+	var names []string
+	var walk func(v interface{}, depth int)
+	walk = func(v interface{}, depth int) {
+		switch v := v.(type) {
+		case []interface{}:
+			for i, e := range v {
+				// the first element of an array is the dir itself
+				d := depth + 1
+				if i == 0 {
+					d = depth
+				}
+				walk(e, d)
+			}
+		case map[string]interface{}:
+			names = append(names, strings.Repeat(" ", depth)+v["name"].(string))
+		}
+	}
+	var v []interface{}
+	rtest.OK(t, json.Unmarshal(buf.Bytes(), &v))
+	walk(v[3], 0)
+	rtest.Equals(t, []string{"/", " a", "  b", "   x", "   y", "  e", "   z", " f"}, names)
+}
+
+func TestLsNodeFilter(t *testing.T) {
+	now := time.Date(2023, 2, 1, 12, 0, 0, 0, time.Local)
+
+	small := &restic.Node{Name: "small", Type: "file", Size: 100, ModTime: now.AddDate(0, 0, -1)}
+	large := &restic.Node{Name: "large", Type: "file", Size: 2 << 30, ModTime: now.AddDate(0, 0, -10)}
+	dir := &restic.Node{Name: "dir", Type: "dir", ModTime: now.AddDate(-1, 0, 0)}
+
+	for _, c := range []struct {
+		opts   LsOptions
+		expect []string
+	}{
+		{LsOptions{}, []string{"small", "large", "dir"}},
+		{LsOptions{LargerThan: "1G"}, []string{"large"}},
+		{LsOptions{SmallerThan: "1k"}, []string{"small"}},
+		{LsOptions{NewerThan: "7d"}, []string{"small"}},
+		{LsOptions{OlderThan: "7d"}, []string{"large", "dir"}},
+		{LsOptions{NewerThan: "2023-01-01", OlderThan: "2023-01-30"}, []string{"large"}},
+		{LsOptions{LargerThan: "1G", NewerThan: "7d"}, nil},
+	} {
+		filter, err := lsNodeFilter(c.opts, now)
+		rtest.OK(t, err)
+
+		var matches []string
+		for _, node := range []*restic.Node{small, large, dir} {
+			if filter(node) {
+				matches = append(matches, node.Name)
+			}
+		}
+		rtest.Equals(t, c.expect, matches)
+	}
+
+	for _, opts := range []LsOptions{
+		{LargerThan: "1x"},
+		{SmallerThan: "big"},
+		{NewerThan: "yesterday"},
+		{OlderThan: "7w"},
+	} {
+		_, err := lsNodeFilter(opts, now)
+		rtest.Assert(t, err != nil, "expected error for options %+v", opts)
+	}
+}
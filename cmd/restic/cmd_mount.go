@@ -6,8 +6,9 @@ package main
 import (
 	"context"
 	"os"
+	"runtime"
+	"strconv"
 	"strings"
-	"time"
 
 	"github.com/spf13/cobra"
 
@@ -29,37 +30,32 @@ var cmdMount = &cobra.Command{
 The "mount" command mounts the repository via fuse to a directory. This is a
 read-only mount.
 
-Snapshot Directories
-====================
+` + mountSnapshotDirsHelp + `
 
-If you need a different template for directories that contain snapshots,
-you can pass a time template via --time-template and path templates via
---path-template.
+` + mountSingleSnapshotHelp + `
 
-Example time template without colons:
+Access by other users
+=====================
 
-    --time-template "2006-01-02_15-04-05"
+By default, only the user running restic can access the mounted repository.
+The option --allow-other allows all users to access it, --allow-root allows
+only the user running restic and the superuser. Both options need the line
+"user_allow_other" in /etc/fuse.conf when restic is not run as root.
 
-You need to specify a sample format for exactly the following timestamp:
+For --allow-other and --allow-root, the kernel checks permissions based on the
+owner, group and mode of files as stored in the snapshots. Use --owner-root or
+--owner to report a different owner and group for all files and dirs, for
+example "--owner 1000:1000", or --no-default-permissions to skip the check.
 
-    Mon Jan 2 15:04:05 -0700 MST 2006
+macOS without macFUSE
+=====================
 
-For details please see the documentation for time.Format() at:
-  https://godoc.org/time#Time.Format
-
-For path templates, you can use the following patterns which will be replaced:
-    %i by short snapshot ID
-    %I by long snapshot ID
-    %u by username
-    %h by hostname
-    %t by tags
-    %T by timestamp as specified by --time-template
-
-The default path templates are:
-    "ids/%i"
-    "snapshots/%T"
-    "hosts/%h/%T"
-    "tags/%t/%T"
+On macOS, the option --nfs mounts the repository with the NFS client of macOS
+instead of macFUSE, for systems on which the macFUSE kernel extension cannot
+be installed. Restic then runs an NFS server which only accepts connections
+from localhost and permits only a single mount via a random path, which is
+used by restic itself. Thus --nfs cannot be combined with the options for
+access by other users.
 
 EXIT STATUS
 ===========
@@ -75,11 +71,13 @@ Exit status is 0 if the command was successful, and non-zero if there was any er
 // MountOptions collects all options for the mount command.
 type MountOptions struct {
 	OwnerRoot            bool
+	Owner                string
 	AllowOther           bool
+	AllowRoot            bool
 	NoDefaultPermissions bool
-	snapshotFilterOptions
-	TimeTemplate  string
-	PathTemplates []string
+	NFS                  bool
+	Snapshot             string
+	snapshotDirsOptions
 }
 
 var mountOptions MountOptions
@@ -89,30 +87,68 @@ func init() {
 
 	mountFlags := cmdMount.Flags()
 	mountFlags.BoolVar(&mountOptions.OwnerRoot, "owner-root", false, "use 'root' as the owner of files and dirs")
+	mountFlags.StringVar(&mountOptions.Owner, "owner", "", "use numeric `uid:gid` as the owner and group of files and dirs")
 	mountFlags.BoolVar(&mountOptions.AllowOther, "allow-other", false, "allow other users to access the data in the mounted directory")
+	mountFlags.BoolVar(&mountOptions.AllowRoot, "allow-root", false, "allow the superuser to access the data in the mounted directory")
 	mountFlags.BoolVar(&mountOptions.NoDefaultPermissions, "no-default-permissions", false, "for 'allow-other', ignore Unix permissions and allow users to read all snapshot files")
+	if runtime.GOOS == "darwin" {
+		mountFlags.BoolVar(&mountOptions.NFS, "nfs", false, "mount via a local NFS server instead of macFUSE")
+	}
+	mountFlags.StringVar(&mountOptions.Snapshot, "snapshot", "", "mount only the snapshot `ID` (or \"latest\") at the mountpoint")
 
-	initMultiSnapshotFilterOptions(mountFlags, &mountOptions.snapshotFilterOptions, true)
-
-	mountFlags.StringArrayVar(&mountOptions.PathTemplates, "path-template", nil, "set `template` for path names (can be specified multiple times)")
-	mountFlags.StringVar(&mountOptions.TimeTemplate, "snapshot-template", time.RFC3339, "set `template` to use for snapshot dirs")
-	mountFlags.StringVar(&mountOptions.TimeTemplate, "time-template", time.RFC3339, "set `template` to use for times")
-	_ = mountFlags.MarkDeprecated("snapshot-template", "use --time-template")
+	initSnapshotDirsOptions(mountFlags, &mountOptions.snapshotDirsOptions)
 }
 
-func runMount(ctx context.Context, opts MountOptions, gopts GlobalOptions, args []string) error {
-	if opts.TimeTemplate == "" {
-		return errors.Fatal("time template string cannot be empty")
+// parseOwner parses a numeric owner and group in the form "uid:gid".
+func parseOwner(s string) (uid, gid uint32, err error) {
+	u, g, ok := strings.Cut(s, ":")
+	if !ok {
+		return 0, 0, errors.Fatalf("invalid owner %q, expected uid:gid", s)
+	}
+	uid64, err := strconv.ParseUint(u, 10, 32)
+	if err != nil {
+		return 0, 0, errors.Fatalf("invalid uid %q in owner %q", u, s)
+	}
+	gid64, err := strconv.ParseUint(g, 10, 32)
+	if err != nil {
+		return 0, 0, errors.Fatalf("invalid gid %q in owner %q", g, s)
 	}
+	return uint32(uid64), uint32(gid64), nil
+}
 
-	if strings.HasPrefix(opts.TimeTemplate, "/") || strings.HasSuffix(opts.TimeTemplate, "/") {
-		return errors.Fatal("time template string cannot start or end with '/'")
+func runMount(ctx context.Context, opts MountOptions, gopts GlobalOptions, args []string) error {
+	cfg, err := opts.config()
+	if err != nil {
+		return err
 	}
 
 	if len(args) == 0 {
 		return errors.Fatal("wrong number of parameters")
 	}
 
+	if opts.AllowOther && opts.AllowRoot {
+		return errors.Fatal("--allow-other and --allow-root cannot be used together")
+	}
+	if opts.AllowRoot && opts.NoDefaultPermissions {
+		return errors.Fatal("--allow-root requires the default permission checks, remove --no-default-permissions")
+	}
+	if opts.OwnerRoot && opts.Owner != "" {
+		return errors.Fatal("--owner-root and --owner cannot be used together")
+	}
+	if opts.NFS && (opts.AllowOther || opts.AllowRoot || opts.NoDefaultPermissions || opts.OwnerRoot || opts.Owner != "") {
+		return errors.Fatal("--nfs cannot be used together with --allow-other, --allow-root, --no-default-permissions, --owner-root or --owner")
+	}
+
+	if opts.Owner != "" {
+		cfg.ForceOwner = true
+		cfg.OwnerUID, cfg.OwnerGID, err = parseOwner(opts.Owner)
+		if err != nil {
+			return err
+		}
+	}
+	cfg.OwnerIsRoot = opts.OwnerRoot
+	cfg.AllowRoot = opts.AllowRoot
+
 	debug.Log("start mount")
 	defer debug.Log("finish mount")
 
@@ -130,6 +166,13 @@ func runMount(ctx context.Context, opts MountOptions, gopts GlobalOptions, args
 		}
 	}
 
+	if opts.Snapshot != "" {
+		cfg.Snapshot, err = findMountSnapshot(ctx, repo, opts.snapshotDirsOptions, opts.Snapshot)
+		if err != nil {
+			return err
+		}
+	}
+
 	err = repo.LoadIndex(ctx)
 	if err != nil {
 		return err
@@ -141,13 +184,20 @@ func runMount(ctx context.Context, opts MountOptions, gopts GlobalOptions, args
 		Verbosef("Mountpoint %s doesn't exist\n", mountpoint)
 		return err
 	}
+
+	if opts.NFS {
+		return mountNFS(ctx, repo, cfg, mountpoint)
+	}
+
 	mountOptions := []systemFuse.MountOption{
 		systemFuse.ReadOnly(),
 		systemFuse.FSName("restic"),
 		systemFuse.MaxReadahead(128 * 1024),
 	}
 
-	if opts.AllowOther {
+	// fuse has no option to allow only the superuser, thus --allow-root uses
+	// allow_other and restricts the permissions of the root dir instead
+	if opts.AllowOther || opts.AllowRoot {
 		mountOptions = append(mountOptions, systemFuse.AllowOther())
 
 		// let the kernel check permissions unless it is explicitly disabled
@@ -170,6 +220,9 @@ func runMount(ctx context.Context, opts MountOptions, gopts GlobalOptions, args
 	})
 
 	c, err := systemFuse.Mount(mountpoint, mountOptions...)
+	if errors.Is(err, systemFuse.ErrOSXFUSENotFound) {
+		return errors.Fatal("macFUSE is not installed, install it from https://osxfuse.github.io or use --nfs to mount via NFS")
+	}
 	if err != nil {
 		return err
 	}
@@ -178,14 +231,6 @@ func runMount(ctx context.Context, opts MountOptions, gopts GlobalOptions, args
 		debug.Log("fuse: %v", msg)
 	}
 
-	cfg := fuse.Config{
-		OwnerIsRoot:   opts.OwnerRoot,
-		Hosts:         opts.Hosts,
-		Tags:          opts.Tags,
-		Paths:         opts.Paths,
-		TimeTemplate:  opts.TimeTemplate,
-		PathTemplates: opts.PathTemplates,
-	}
 	root := fuse.NewRoot(repo, cfg)
 
 	Printf("Now serving the repository at %s\n", mountpoint)
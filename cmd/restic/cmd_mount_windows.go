@@ -0,0 +1,141 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+
+	resticfuse "github.com/restic/restic/internal/fuse"
+
+	"github.com/winfsp/cgofuse/fuse"
+)
+
+var cmdMount = &cobra.Command{
+	Use:   "mount [flags] mountpoint",
+	Short: "Mount the repository",
+	Long: `
+The "mount" command mounts the repository via WinFsp to a drive letter like
+"X:" or to a directory which must not exist yet. This is a read-only mount.
+WinFsp needs to be installed, see https://winfsp.dev.
+
+Links to snapshots like "latest" are shown as directories which contain the
+snapshot.
+
+` + mountSnapshotDirsHelp + `
+
+` + mountSingleSnapshotHelp + `
+
+EXIT STATUS
+===========
+
+Exit status is 0 if the command was successful, and non-zero if there was any error.
+`,
+	DisableAutoGenTag: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runMount(cmd.Context(), mountOptions, globalOptions, args)
+	},
+}
+
+// MountOptions collects all options for the mount command.
+type MountOptions struct {
+	Snapshot string
+	snapshotDirsOptions
+}
+
+var mountOptions MountOptions
+
+func init() {
+	cmdRoot.AddCommand(cmdMount)
+
+	mountFlags := cmdMount.Flags()
+	mountFlags.StringVar(&mountOptions.Snapshot, "snapshot", "", "mount only the snapshot `ID` (or \"latest\") at the mountpoint")
+	initSnapshotDirsOptions(mountFlags, &mountOptions.snapshotDirsOptions)
+}
+
+func runMount(ctx context.Context, opts MountOptions, gopts GlobalOptions, args []string) error {
+	cfg, err := opts.config()
+	if err != nil {
+		return err
+	}
+
+	if len(args) == 0 {
+		return errors.Fatal("wrong number of parameters")
+	}
+
+	debug.Log("start mount")
+	defer debug.Log("finish mount")
+
+	repo, err := OpenRepository(ctx, gopts)
+	if err != nil {
+		return err
+	}
+
+	if !gopts.NoLock {
+		var lock *restic.Lock
+		lock, ctx, err = lockRepo(ctx, repo)
+		defer unlockRepo(lock)
+		if err != nil {
+			return err
+		}
+	}
+
+	if opts.Snapshot != "" {
+		cfg.Snapshot, err = findMountSnapshot(ctx, repo, opts.snapshotDirsOptions, opts.Snapshot)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = repo.LoadIndex(ctx)
+	if err != nil {
+		return err
+	}
+
+	mountpoint := args[0]
+
+	host := fuse.NewFileSystemHost(resticfuse.NewFS(ctx, repo, cfg))
+
+	AddCleanupHandler(func(code int) (int, error) {
+		debug.Log("running umount cleanup handler for mount at %v", mountpoint)
+		if !host.Unmount() {
+			Warnf("unable to umount (maybe already umounted?)\n")
+		}
+		// replace error code of sigint
+		if code == 130 {
+			code = 0
+		}
+		return code, nil
+	})
+
+	Printf("Now serving the repository at %s\n", mountpoint)
+	Printf("Use another terminal or tool to browse the contents of this folder.\n")
+	Printf("When finished, quit with Ctrl-c here.\n")
+
+	debug.Log("serving mount at %v", mountpoint)
+	return serveMount(host, mountpoint)
+}
+
+// serveMount mounts the file system at mountpoint and blocks until it is
+// unmounted again.
+func serveMount(host *fuse.FileSystemHost, mountpoint string) (err error) {
+	// cgofuse panics if the WinFsp DLL cannot be loaded
+	defer func() {
+		if r := recover(); r != nil {
+			err = errors.Fatal(fmt.Sprintf("unable to use WinFsp, is it installed? %v", r))
+		}
+	}()
+
+	ok := host.Mount(mountpoint, []string{"-o", "uid=-1,gid=-1", "-o", "volname=restic"})
+	if !ok {
+		return errors.Fatalf("unable to mount the repository at %v", mountpoint)
+	}
+	return nil
+}
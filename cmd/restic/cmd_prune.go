@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"math"
 	"sort"
 	"strconv"
@@ -177,14 +178,23 @@ func runPrune(ctx context.Context, opts PruneOptions, gopts GlobalOptions) error
 }
 
 func runPruneWithRepo(ctx context.Context, opts PruneOptions, gopts GlobalOptions, repo *repository.Repository, ignoreSnapshots restic.IDSet) error {
-	// we do not need index updates while pruning!
-	repo.DisableAutoIndexUpdate()
+	// Full index files for the packs created while repacking are still
+	// uploaded, such that an interrupted prune does not lose the data repacked
+	// so far. The next prune then just removes the old copies of these blobs.
+	// Recovering from no free space cannot afford additional index files.
+	if opts.unsafeRecovery {
+		repo.DisableAutoIndexUpdate()
+	}
 
 	if repo.Cache == nil {
-		Print("warning: running prune without a cache, this may be very slow!\n")
+		if gopts.JSON {
+			Warnf("warning: running prune without a cache, this may be very slow!\n")
+		} else {
+			Print("warning: running prune without a cache, this may be very slow!\n")
+		}
 	}
 
-	Verbosef("loading indexes...\n")
+	printPhase("load-index", "loading indexes...\n")
 	// loading the index before the snapshots is ok, as we use an exclusive lock here
 	err := repo.LoadIndex(ctx)
 	if err != nil {
@@ -196,11 +206,15 @@ func runPruneWithRepo(ctx context.Context, opts PruneOptions, gopts GlobalOption
 		return err
 	}
 
-	if opts.DryRun {
+	if opts.DryRun && !gopts.JSON {
 		Verbosef("\nWould have made the following changes:")
 	}
 
-	err = printPruneStats(stats)
+	if gopts.JSON {
+		err = printJSONPruneStats(stats, plan, opts.DryRun, opts.DryRun && gopts.verbosity >= 2)
+	} else {
+		err = printPruneStats(stats)
+	}
 	if err != nil {
 		return err
 	}
@@ -266,25 +280,24 @@ type packInfoWithID struct {
 func planPrune(ctx context.Context, opts PruneOptions, repo restic.Repository, ignoreSnapshots restic.IDSet, quiet bool) (prunePlan, pruneStats, error) {
 	var stats pruneStats
 
-	usedBlobs, err := getUsedBlobs(ctx, repo, ignoreSnapshots, quiet)
+	usedBlobs, err := getUsedBlobs(ctx, repo, repo.Backend(), ignoreSnapshots, quiet)
 	if err != nil {
 		return prunePlan{}, stats, err
 	}
 
-	Verbosef("searching used packs...\n")
+	printPhase("plan", "searching used packs...\n")
 	keepBlobs, indexPack, err := packInfoFromIndex(ctx, repo.Index(), usedBlobs, &stats)
 	if err != nil {
 		return prunePlan{}, stats, err
 	}
 
-	Verbosef("collecting packs for deletion and repacking\n")
+	printPhase("plan", "collecting packs for deletion and repacking\n")
 	plan, err := decidePackAction(ctx, opts, repo, indexPack, &stats, quiet)
 	if err != nil {
 		return prunePlan{}, stats, err
 	}
 
 	if len(plan.repackPacks) != 0 {
-		blobCount := keepBlobs.Len()
 		// when repacking, we do not want to keep blobs which are
 		// already contained in kept packs, so delete them from keepBlobs
 		repo.Index().Each(ctx, func(blob restic.PackedBlob) {
@@ -294,46 +307,44 @@ func planPrune(ctx context.Context, opts PruneOptions, repo restic.Repository, i
 			keepBlobs.Delete(blob.BlobHandle)
 		})
 
-		if keepBlobs.Len() < blobCount/2 {
-			// replace with copy to shrink map to necessary size if there's a chance to benefit
-			keepBlobs = keepBlobs.Copy()
-		}
-	} else {
-		// keepBlobs is only needed if packs are repacked
-		keepBlobs = nil
+		// the index is modified while repacking, which is not allowed while
+		// keepBlobs is in use. Thus copy the remaining blobs to a separate set.
+		plan.keepBlobs = restic.NewCountedBlobSet()
+		keepBlobs.Each(func(bh restic.BlobHandle, count uint8) {
+			plan.keepBlobs[bh] = count
+		})
 	}
-	plan.keepBlobs = keepBlobs
 
 	return plan, stats, nil
 }
 
-func packInfoFromIndex(ctx context.Context, idx restic.MasterIndex, usedBlobs restic.CountedBlobSet, stats *pruneStats) (restic.CountedBlobSet, map[restic.ID]packInfo, error) {
+func packInfoFromIndex(ctx context.Context, idx restic.MasterIndex, usedBlobs *index.CountedBlobSet, stats *pruneStats) (*index.CountedBlobSet, map[restic.ID]packInfo, error) {
 	// iterate over all blobs in index to find out which blobs are duplicates
 	// The counter in usedBlobs describes how many instances of the blob exist in the repository index
 	// Thus 0 == blob is missing, 1 == blob exists once, >= 2 == duplicates exist
 	idx.Each(ctx, func(blob restic.PackedBlob) {
 		bh := blob.BlobHandle
-		count, ok := usedBlobs[bh]
+		count, ok := usedBlobs.Get(bh)
 		if ok {
-			if count < math.MaxUint8 {
-				// don't overflow, but saturate count at 255
+			if count < index.MaxBlobCount {
+				// don't overflow, but saturate count at index.MaxBlobCount
 				// this can lead to a non-optimal pack selection, but won't cause
 				// problems otherwise
 				count++
 			}
 
-			usedBlobs[bh] = count
+			usedBlobs.Set(bh, count)
 		}
 	})
 
 	// Check if all used blobs have been found in index
 	missingBlobs := restic.NewBlobSet()
-	for bh, count := range usedBlobs {
+	usedBlobs.Each(func(bh restic.BlobHandle, count uint8) {
 		if count == 0 {
 			// blob does not exist in any pack files
 			missingBlobs.Insert(bh)
 		}
-	}
+	})
 
 	if len(missingBlobs) != 0 {
 		Warnf("%v not found in the index\n\n"+
@@ -369,7 +380,7 @@ func packInfoFromIndex(ctx context.Context, idx restic.MasterIndex, usedBlobs re
 
 		bh := blob.BlobHandle
 		size := uint64(blob.Length)
-		dupCount := usedBlobs[bh]
+		dupCount, _ := usedBlobs.Get(bh)
 		switch {
 		case dupCount >= 2:
 			hasDuplicates = true
@@ -408,7 +419,7 @@ func packInfoFromIndex(ctx context.Context, idx restic.MasterIndex, usedBlobs re
 		// iterate again over all blobs in index (this is pretty cheap, all in-mem)
 		idx.Each(ctx, func(blob restic.PackedBlob) {
 			bh := blob.BlobHandle
-			count, ok := usedBlobs[bh]
+			count, ok := usedBlobs.Get(bh)
 			// skip non-duplicate, aka. normal blobs
 			// count == 0 is used to mark that this was a duplicate blob with only a single occurence remaining
 			if !ok || count == 1 {
@@ -430,7 +441,7 @@ func packInfoFromIndex(ctx context.Context, idx restic.MasterIndex, usedBlobs re
 				stats.size.duplicate -= size
 				stats.blobs.duplicate--
 				// let other occurences remain marked as unused
-				usedBlobs[bh] = 1
+				usedBlobs.Set(bh, 1)
 			default:
 				// remain unused and decrease counter
 				count--
@@ -439,7 +450,7 @@ func packInfoFromIndex(ctx context.Context, idx restic.MasterIndex, usedBlobs re
 					// thus use the special value zero. This will select the last instance of the blob for keeping.
 					count = 0
 				}
-				usedBlobs[bh] = count
+				usedBlobs.Set(bh, count)
 			}
 			// update indexPack
 			indexPack[blob.PackID] = ip
@@ -448,11 +459,11 @@ func packInfoFromIndex(ctx context.Context, idx restic.MasterIndex, usedBlobs re
 
 	// Sanity check. If no duplicates exist, all blobs have value 1. After handling
 	// duplicates, this also applies to duplicates.
-	for _, count := range usedBlobs {
+	usedBlobs.Each(func(_ restic.BlobHandle, count uint8) {
 		if count != 1 {
 			panic("internal error during blob selection")
 		}
-	}
+	})
 
 	return usedBlobs, indexPack, nil
 }
@@ -473,12 +484,14 @@ func decidePackAction(ctx context.Context, opts PruneOptions, repo restic.Reposi
 	}
 
 	// loop over all packs and decide what to do
-	bar := newProgressMax(!quiet, uint64(len(indexPack)), "packs processed")
+	bar := newPhaseProgressMax(!quiet, uint64(len(indexPack)), "plan", "packs processed")
 	err := repo.List(ctx, restic.PackFile, func(id restic.ID, packSize int64) error {
 		p, ok := indexPack[id]
 		if !ok {
 			// Pack was not referenced in index and is not used  => immediately remove!
-			Verboseff("will remove pack %v as it is unused and not indexed\n", id.Str())
+			if !globalOptions.JSON {
+				Verboseff("will remove pack %v as it is unused and not indexed\n", id.Str())
+			}
 			removePacksFirst.Insert(id)
 			stats.size.unref += uint64(packSize)
 			return nil
@@ -488,7 +501,7 @@ func decidePackAction(ctx context.Context, opts PruneOptions, repo restic.Reposi
 			// Pack size does not fit and pack is needed => error
 			// If the pack is not needed, this is no error, the pack can
 			// and will be simply removed, see below.
-			Warnf("pack %s: calculated size %d does not match real size %d\nRun 'restic rebuild-index'.\n",
+			Warnf("pack %s: calculated size %d does not match real size %d\nRun 'restic repair index'.\n",
 				id.Str(), p.unusedSize+p.usedSize, packSize)
 			return errorSizeNotMatching
 		}
@@ -673,6 +686,9 @@ func printPruneStats(stats pruneStats) error {
 
 	Verbosef("\nto repack:    %10d blobs / %s\n", stats.blobs.repack, ui.FormatBytes(stats.size.repack))
 	Verbosef("this removes: %10d blobs / %s\n", stats.blobs.repackrm, ui.FormatBytes(stats.size.repackrm))
+	// repacking downloads the packs completely and uploads the blobs to keep
+	Verbosef("to download:  %10d packs / %s\n", stats.packs.repack, ui.FormatBytes(stats.size.repack))
+	Verbosef("to upload:    %10d blobs / %s\n", stats.blobs.repack-stats.blobs.repackrm, ui.FormatBytes(stats.size.repack-stats.size.repackrm))
 	Verbosef("to delete:    %10d blobs / %s\n", stats.blobs.remove, ui.FormatBytes(stats.size.remove+stats.size.unref))
 	totalPruneSize := stats.size.remove + stats.size.repackrm + stats.size.unref
 	Verbosef("total prune:  %10d blobs / %s\n", stats.blobs.remove+stats.blobs.repackrm, ui.FormatBytes(totalPruneSize))
@@ -697,6 +713,58 @@ func printPruneStats(stats pruneStats) error {
 	return nil
 }
 
+// printJSONPruneStats prints the statistics as a JSON message. If listPacks
+// is set, the message also contains the packs which would be removed or
+// repacked by a dry run.
+func printJSONPruneStats(stats pruneStats, plan prunePlan, dryRun, listPacks bool) error {
+	totalSize := stats.size.used + stats.size.duplicate + stats.size.unused + stats.size.unref
+	totalPruneSize := stats.size.remove + stats.size.repackrm + stats.size.unref
+
+	var unreferencedPacks, repackPacks, removePacks restic.IDs
+	if listPacks {
+		unreferencedPacks = plan.removePacksFirst.List()
+		repackPacks = plan.repackPacks.List()
+		removePacks = plan.removePacks.List()
+	}
+
+	return json.NewEncoder(globalOptions.stdout).Encode(struct {
+		MessageType       string `json:"message_type"` // "plan"
+		DryRun            bool   `json:"dry_run"`
+		BlobsUsed         uint   `json:"blobs_used"`
+		BytesUsed         uint64 `json:"bytes_used"`
+		BlobsUnused       uint   `json:"blobs_unused"`
+		BytesUnused       uint64 `json:"bytes_unused"`
+		PacksToRepack     uint   `json:"packs_to_repack"`
+		BytesToDownload   uint64 `json:"bytes_to_download"`
+		BytesToUpload     uint64 `json:"bytes_to_upload"`
+		PacksToDelete     uint   `json:"packs_to_delete"`
+		BytesToFree       uint64 `json:"bytes_to_free"`
+		BytesRemaining    uint64 `json:"bytes_remaining"`
+		BytesUncompressed uint64 `json:"bytes_uncompressed,omitempty"`
+
+		UnreferencedPacks restic.IDs `json:"unreferenced_packs,omitempty"`
+		RepackPacks       restic.IDs `json:"repack_packs,omitempty"`
+		RemovePacks       restic.IDs `json:"remove_packs,omitempty"`
+	}{
+		MessageType:       "plan",
+		DryRun:            dryRun,
+		BlobsUsed:         stats.blobs.used,
+		BytesUsed:         stats.size.used,
+		BlobsUnused:       stats.blobs.unused + stats.blobs.duplicate,
+		BytesUnused:       stats.size.unused + stats.size.duplicate,
+		PacksToRepack:     stats.packs.repack,
+		BytesToDownload:   stats.size.repack,
+		BytesToUpload:     stats.size.repack - stats.size.repackrm,
+		PacksToDelete:     stats.packs.remove + stats.packs.unref,
+		BytesToFree:       totalPruneSize,
+		BytesRemaining:    totalSize - totalPruneSize,
+		BytesUncompressed: stats.size.uncompressed,
+		UnreferencedPacks: unreferencedPacks,
+		RepackPacks:       repackPacks,
+		RemovePacks:       removePacks,
+	})
+}
+
 // doPrune does the actual pruning:
 // - remove unreferenced packs first
 // - repack given pack files while keeping the given blobs
@@ -719,13 +787,13 @@ func doPrune(ctx context.Context, opts PruneOptions, gopts GlobalOptions, repo r
 
 	// unreferenced packs can be safely deleted first
 	if len(plan.removePacksFirst) != 0 {
-		Verbosef("deleting unreferenced packs\n")
+		printPhase("delete", "deleting unreferenced packs\n")
 		DeleteFiles(ctx, gopts, repo, plan.removePacksFirst, restic.PackFile)
 	}
 
 	if len(plan.repackPacks) != 0 {
-		Verbosef("repacking packs\n")
-		bar := newProgressMax(!gopts.Quiet, uint64(len(plan.repackPacks)), "packs repacked")
+		printPhase("repack", "repacking packs\n")
+		bar := newPhaseProgressMax(!gopts.Quiet, uint64(len(plan.repackPacks)), "repack", "packs repacked")
 		_, err := repository.Repack(ctx, repo, repo, plan.repackPacks, plan.keepBlobs, bar)
 		bar.Done()
 		if err != nil {
@@ -753,22 +821,31 @@ func doPrune(ctx context.Context, opts PruneOptions, gopts GlobalOptions, repo r
 		plan.ignorePacks.Merge(plan.removePacks)
 	}
 
+	var lockedIndexes restic.IDSet
 	if opts.unsafeRecovery {
-		Verbosef("deleting index files\n")
+		printPhase("delete", "deleting index files\n")
 		indexFiles := repo.Index().(*index.MasterIndex).IDs()
-		err = DeleteFilesChecked(ctx, gopts, repo, indexFiles, restic.IndexFile)
+		lockedIndexes, err = DeleteFilesCheckedLocked(ctx, gopts, repo, indexFiles, restic.IndexFile)
 		if err != nil {
 			return errors.Fatalf("%s", err)
 		}
 	} else if len(plan.ignorePacks) != 0 {
-		err = rebuildIndexFiles(ctx, gopts, repo, plan.ignorePacks, nil)
+		lockedIndexes, err = rebuildIndexFiles(ctx, gopts, repo, plan.ignorePacks, nil)
 		if err != nil {
 			return errors.Fatalf("%s", err)
 		}
 	}
 
+	// index files protected by object lock still reference the packs which
+	// were to be removed, these are removed by a later prune run once the
+	// index files are gone
+	if len(lockedIndexes) != 0 && len(plan.removePacks) != 0 {
+		Printf("keeping %d old packs which are still referenced by index files protected by object lock\n", len(plan.removePacks))
+		plan.removePacks = nil
+	}
+
 	if len(plan.removePacks) != 0 {
-		Verbosef("removing %d old packs\n", len(plan.removePacks))
+		printPhase("delete", "removing %d old packs\n", len(plan.removePacks))
 		DeleteFiles(ctx, gopts, repo, plan.removePacks, restic.PackFile)
 	}
 
@@ -779,33 +856,37 @@ func doPrune(ctx context.Context, opts PruneOptions, gopts GlobalOptions, repo r
 		}
 	}
 
-	Verbosef("done\n")
+	if !gopts.JSON {
+		Verbosef("done\n")
+	}
 	return nil
 }
 
 func writeIndexFiles(ctx context.Context, gopts GlobalOptions, repo restic.Repository, removePacks restic.IDSet, extraObsolete restic.IDs) (restic.IDSet, error) {
-	Verbosef("rebuilding index\n")
+	printPhase("rebuild-index", "rebuilding index\n")
 
-	bar := newProgressMax(!gopts.Quiet, 0, "packs processed")
+	bar := newPhaseProgressMax(!gopts.Quiet, 0, "rebuild-index", "packs processed")
 	obsoleteIndexes, err := repo.Index().Save(ctx, repo, removePacks, extraObsolete, bar)
 	bar.Done()
 	return obsoleteIndexes, err
 }
 
-func rebuildIndexFiles(ctx context.Context, gopts GlobalOptions, repo restic.Repository, removePacks restic.IDSet, extraObsolete restic.IDs) error {
+// rebuildIndexFiles writes the new index and removes the obsolete index
+// files. It returns the obsolete index files protected by object lock.
+func rebuildIndexFiles(ctx context.Context, gopts GlobalOptions, repo restic.Repository, removePacks restic.IDSet, extraObsolete restic.IDs) (restic.IDSet, error) {
 	obsoleteIndexes, err := writeIndexFiles(ctx, gopts, repo, removePacks, extraObsolete)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	Verbosef("deleting obsolete index files\n")
-	return DeleteFilesChecked(ctx, gopts, repo, obsoleteIndexes, restic.IndexFile)
+	printPhase("delete", "deleting obsolete index files\n")
+	return DeleteFilesCheckedLocked(ctx, gopts, repo, obsoleteIndexes, restic.IndexFile)
 }
 
-func getUsedBlobs(ctx context.Context, repo restic.Repository, ignoreSnapshots restic.IDSet, quiet bool) (usedBlobs restic.CountedBlobSet, err error) {
+func getUsedBlobs(ctx context.Context, repo restic.Repository, snapshotLister restic.Lister, ignoreSnapshots restic.IDSet, quiet bool) (usedBlobs *index.CountedBlobSet, err error) {
 	var snapshotTrees restic.IDs
-	Verbosef("loading all snapshots...\n")
-	err = restic.ForAllSnapshots(ctx, repo.Backend(), repo, ignoreSnapshots,
+	printPhase("load-snapshots", "loading all snapshots...\n")
+	err = restic.ForAllSnapshots(ctx, snapshotLister, repo, ignoreSnapshots,
 		func(id restic.ID, sn *restic.Snapshot, err error) error {
 			if err != nil {
 				debug.Log("failed to load snapshot %v (error %v)", id, err)
@@ -819,11 +900,13 @@ func getUsedBlobs(ctx context.Context, repo restic.Repository, ignoreSnapshots r
 		return nil, errors.Fatalf("failed loading snapshot: %v", err)
 	}
 
-	Verbosef("finding data that is still in use for %d snapshots\n", len(snapshotTrees))
+	printPhase("find-used-blobs", "finding data that is still in use for %d snapshots\n", len(snapshotTrees))
 
-	usedBlobs = restic.NewCountedBlobSet()
+	// track the used blobs in the index itself instead of a separate set, only
+	// blobs which are missing from the index are stored in a map
+	usedBlobs = repo.Index().(*index.MasterIndex).NewCountedBlobSet()
 
-	bar := newProgressMax(!quiet, uint64(len(snapshotTrees)), "snapshots")
+	bar := newPhaseProgressMax(!quiet, uint64(len(snapshotTrees)), "find-used-blobs", "snapshots")
 	defer bar.Done()
 
 	err = restic.FindUsedBlobs(ctx, repo, snapshotTrees, usedBlobs, bar)
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"context"
+
+	"github.com/restic/restic/internal/backend"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/walker"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/sync/errgroup"
+)
+
+var cmdRepairSnapshots = &cobra.Command{
+	Use:   "snapshots [flags] [snapshot ID] [...]",
+	Short: "Repair snapshots",
+	Long: `
+The "repair snapshots" command repairs broken snapshots. It scans the given
+snapshots and generates new ones with damaged directories and file contents
+removed. If the broken snapshots are deleted, a prune run will be able to
+clean up the repository.
+
+The command depends on a correct index, thus make sure to run "repair index"
+first, after removing damaged pack files from the repository.
+
+WARNING: Repairing snapshots is a lossy operation. Damaged files are truncated
+to the parts which are still available, directories which cannot be loaded are
+replaced by empty directories. Snapshots whose root directory is damaged cannot
+be repaired.
+
+The special tag 'repaired' will be added to the new snapshots to distinguish
+them from the original ones, unless --forget is used. If the --forget option is
+used, the original snapshots will instead be directly removed from the
+repository.
+
+EXIT STATUS
+===========
+
+Exit status is 0 if the command was successful, and non-zero if there was any error.
+`,
+	DisableAutoGenTag: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runRepairSnapshots(cmd.Context(), globalOptions, repairSnapshotOptions, args)
+	},
+}
+
+// RepairOptions collects all options for the repair snapshots command.
+type RepairOptions struct {
+	DryRun bool
+	Forget bool
+
+	snapshotFilterOptions
+}
+
+var repairSnapshotOptions RepairOptions
+
+func init() {
+	cmdRepair.AddCommand(cmdRepairSnapshots)
+	f := cmdRepairSnapshots.Flags()
+
+	f.BoolVarP(&repairSnapshotOptions.DryRun, "dry-run", "n", false, "do not do anything, just print what would be done")
+	f.BoolVarP(&repairSnapshotOptions.Forget, "forget", "", false, "remove original snapshots after creating new ones")
+
+	initMultiSnapshotFilterOptions(f, &repairSnapshotOptions.snapshotFilterOptions, true)
+}
+
+func runRepairSnapshots(ctx context.Context, gopts GlobalOptions, opts RepairOptions, args []string) error {
+	repo, err := OpenRepository(ctx, gopts)
+	if err != nil {
+		return err
+	}
+
+	if !opts.DryRun {
+		var lock *restic.Lock
+		var err error
+		if opts.Forget {
+			Verbosef("create exclusive lock for repository\n")
+			lock, ctx, err = lockRepoExclusive(ctx, repo)
+		} else {
+			lock, ctx, err = lockRepo(ctx, repo)
+		}
+		defer unlockRepo(lock)
+		if err != nil {
+			return err
+		}
+	} else {
+		repo.SetDryRun()
+	}
+
+	snapshotLister, err := backend.MemorizeList(ctx, repo.Backend(), restic.SnapshotFile)
+	if err != nil {
+		return err
+	}
+
+	if err := repo.LoadIndex(ctx); err != nil {
+		return err
+	}
+
+	changedCount := 0
+	for sn := range FindFilteredSnapshots(ctx, snapshotLister, repo, opts.Hosts, opts.Tags, opts.Paths, args) {
+		Verbosef("\nsnapshot %s of %v at %s)\n", sn.ID().Str(), sn.Paths, sn.Time)
+		changed, err := repairSnapshot(ctx, repo, sn, opts)
+		if err != nil {
+			return errors.Fatalf("unable to repair snapshot ID %q: %v", sn.ID().Str(), err)
+		}
+		if changed {
+			changedCount++
+		}
+	}
+
+	Verbosef("\n")
+	if changedCount == 0 {
+		if !opts.DryRun {
+			Verbosef("no snapshots were modified\n")
+		} else {
+			Verbosef("no snapshots would be modified\n")
+		}
+	} else {
+		if !opts.DryRun {
+			Verbosef("modified %v snapshots\n", changedCount)
+		} else {
+			Verbosef("would modify %v snapshots\n", changedCount)
+		}
+	}
+
+	return nil
+}
+
+// repairSnapshot removes missing file contents and directories which cannot
+// be loaded from the snapshot. It returns whether the snapshot was damaged.
+func repairSnapshot(ctx context.Context, repo *repository.Repository, sn *restic.Snapshot, opts RepairOptions) (bool, error) {
+	if sn.Tree == nil {
+		return false, errors.Errorf("snapshot %v has nil tree", sn.ID().Str())
+	}
+
+	var emptyTree restic.ID
+	visitor := &walker.TreeFilterVisitor{
+		SelectByName: func(string) bool { return true },
+		RewriteNode: func(node *restic.Node, path string) *restic.Node {
+			if node.Type != "file" {
+				return node
+			}
+
+			ok := true
+			newContent := restic.IDs{}
+			var newSize uint64
+			// keep only the contents which are still available
+			for _, id := range node.Content {
+				size, found := repo.LookupBlobSize(id, restic.DataBlob)
+				if !found {
+					ok = false
+					continue
+				}
+				newContent = append(newContent, id)
+				newSize += uint64(size)
+			}
+
+			if !ok {
+				Verbosef("  file %q: removed missing content\n", path)
+				node.Content = newContent
+				node.Size = newSize
+			}
+			return node
+		},
+		RewriteFailedTree: func(nodeID restic.ID, path string, err error) (restic.ID, error) {
+			if path == "/" {
+				Verbosef("  dir %q: unable to load root tree: %v\n", path, err)
+				// the snapshot cannot be repaired
+				return restic.ID{}, nil
+			}
+
+			Verbosef("  dir %q: replaced with empty directory\n", path)
+			if emptyTree.IsNull() {
+				var err error
+				emptyTree, err = restic.SaveTree(ctx, repo, &restic.Tree{})
+				if err != nil {
+					return restic.ID{}, err
+				}
+			}
+			return emptyTree, nil
+		},
+	}
+
+	wg, wgCtx := errgroup.WithContext(ctx)
+	repo.StartPackUploader(wgCtx, wg)
+
+	var newTree restic.ID
+	wg.Go(func() error {
+		var err error
+		newTree, err = walker.FilterTree(wgCtx, repo, "/", *sn.Tree, visitor)
+		if err != nil {
+			return err
+		}
+
+		return repo.Flush(wgCtx)
+	})
+	err := wg.Wait()
+	if err != nil {
+		return false, err
+	}
+
+	if newTree == *sn.Tree {
+		debug.Log("Snapshot %v not modified", sn)
+		return false, nil
+	}
+
+	if newTree.IsNull() {
+		if opts.Forget {
+			if opts.DryRun {
+				Verbosef("would remove damaged snapshot\n")
+				return true, nil
+			}
+
+			h := restic.Handle{Type: restic.SnapshotFile, Name: sn.ID().String()}
+			if err = repo.Backend().Remove(ctx, h); err != nil {
+				return false, err
+			}
+			debug.Log("removed damaged snapshot %v", sn.ID())
+			Verbosef("removed damaged snapshot %v\n", sn.ID().Str())
+			return true, nil
+		}
+
+		Verbosef("snapshot cannot be repaired, use --forget to remove it\n")
+		return false, nil
+	}
+
+	debug.Log("Snapshot %v modified", sn)
+	if opts.DryRun {
+		Verbosef("would save new snapshot\n")
+
+		if opts.Forget {
+			Verbosef("would remove old snapshot\n")
+		}
+
+		return true, nil
+	}
+
+	// Always set the original snapshot id as this essentially a new snapshot.
+	sn.Original = sn.ID()
+	*sn.Tree = newTree
+
+	if !opts.Forget {
+		sn.AddTags([]string{"repaired"})
+	}
+
+	// Save the new snapshot.
+	id, err := restic.SaveSnapshot(ctx, repo, sn)
+	if err != nil {
+		return false, err
+	}
+
+	if opts.Forget {
+		h := restic.Handle{Type: restic.SnapshotFile, Name: sn.ID().String()}
+		if err = repo.Backend().Remove(ctx, h); err != nil {
+			return false, err
+		}
+		debug.Log("removed old snapshot %v", sn.ID())
+		Verbosef("removed old snapshot %v\n", sn.ID().Str())
+	}
+	Verbosef("saved new snapshot %v\n", id.Str())
+	return true, nil
+}
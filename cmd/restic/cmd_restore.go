@@ -2,7 +2,10 @@ package main
 
 import (
 	"context"
+	"os/user"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/restic/restic/internal/debug"
@@ -10,6 +13,9 @@ import (
 	"github.com/restic/restic/internal/filter"
 	"github.com/restic/restic/internal/restic"
 	"github.com/restic/restic/internal/restorer"
+	"github.com/restic/restic/internal/ui"
+	restoreui "github.com/restic/restic/internal/ui/restore"
+	"github.com/restic/restic/internal/ui/termstatus"
 
 	"github.com/spf13/cobra"
 )
@@ -31,7 +37,31 @@ Exit status is 0 if the command was successful, and non-zero if there was any er
 `,
 	DisableAutoGenTag: true,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		return runRestore(cmd.Context(), restoreOptions, globalOptions, args)
+		ctx := cmd.Context()
+		var wg sync.WaitGroup
+		cancelCtx, cancel := context.WithCancel(ctx)
+		defer func() {
+			// shutdown termstatus
+			cancel()
+			wg.Wait()
+		}()
+
+		term := termstatus.New(globalOptions.stdout, globalOptions.stderr, globalOptions.Quiet)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			term.Run(cancelCtx)
+		}()
+
+		// use the terminal for stdout/stderr
+		prevStdout, prevStderr := globalOptions.stdout, globalOptions.stderr
+		defer func() {
+			globalOptions.stdout, globalOptions.stderr = prevStdout, prevStderr
+		}()
+		stdioWrapper := ui.NewStdioWrapper(term)
+		globalOptions.stdout, globalOptions.stderr = stdioWrapper.Stdout(), stdioWrapper.Stderr()
+
+		return runRestore(ctx, restoreOptions, globalOptions, term, args)
 	},
 }
 
@@ -43,8 +73,14 @@ type RestoreOptions struct {
 	InsensitiveInclude []string
 	Target             string
 	snapshotFilterOptions
-	Sparse bool
-	Verify bool
+	Sparse    bool
+	Verify    bool
+	Overwrite string
+	InPlace   bool
+	NoXattrs  bool
+	NoACLs    bool
+	OwnerMap  []string
+	GroupMap  []string
 }
 
 var restoreOptions RestoreOptions
@@ -62,9 +98,15 @@ func init() {
 	initSingleSnapshotFilterOptions(flags, &restoreOptions.snapshotFilterOptions)
 	flags.BoolVar(&restoreOptions.Sparse, "sparse", false, "restore files as sparse")
 	flags.BoolVar(&restoreOptions.Verify, "verify", false, "verify restored files content")
+	flags.StringVar(&restoreOptions.Overwrite, "overwrite", "always", "overwrite behavior for existing files, one of (always|if-changed|if-newer|never)")
+	flags.BoolVar(&restoreOptions.InPlace, "in-place", false, "reuse the content of existing files in the target directory and only restore the parts that differ")
+	flags.StringArrayVar(&restoreOptions.OwnerMap, "owner-map", nil, "restore files owned by `old:new` user as owned by the new user, either can be a name or a numeric ID (can be specified multiple times)")
+	flags.StringArrayVar(&restoreOptions.GroupMap, "group-map", nil, "restore files owned by `old:new` group as owned by the new group, either can be a name or a numeric ID (can be specified multiple times)")
+	flags.BoolVar(&restoreOptions.NoXattrs, "no-xattrs", false, "do not restore extended attributes (implies --no-acls)")
+	flags.BoolVar(&restoreOptions.NoACLs, "no-acls", false, "do not restore ACLs")
 }
 
-func runRestore(ctx context.Context, opts RestoreOptions, gopts GlobalOptions, args []string) error {
+func runRestore(ctx context.Context, opts RestoreOptions, gopts GlobalOptions, term *termstatus.Terminal, args []string) error {
 	hasExcludes := len(opts.Exclude) > 0 || len(opts.InsensitiveExclude) > 0
 	hasIncludes := len(opts.Include) > 0 || len(opts.InsensitiveInclude) > 0
 
@@ -113,6 +155,20 @@ func runRestore(ctx context.Context, opts RestoreOptions, gopts GlobalOptions, a
 		return errors.Fatal("exclude and include patterns are mutually exclusive")
 	}
 
+	overwrite, err := parseOverwriteBehavior(opts.Overwrite)
+	if err != nil {
+		return err
+	}
+
+	ownerMap, err := parseOwnerMapping("--owner-map", opts.OwnerMap, lookupUserID)
+	if err != nil {
+		return err
+	}
+	groupMap, err := parseOwnerMapping("--group-map", opts.GroupMap, lookupGroupID)
+	if err != nil {
+		return err
+	}
+
 	snapshotIDString := args[0]
 
 	debug.Log("restore %v to %v", snapshotIDString, opts.Target)
@@ -142,11 +198,34 @@ func runRestore(ctx context.Context, opts RestoreOptions, gopts GlobalOptions, a
 	}
 
 	res := restorer.NewRestorer(ctx, repo, sn, opts.Sparse)
+	res.Overwrite = overwrite
+	if len(opts.OwnerMap) > 0 {
+		res.MapUser = ownerMap.lookup
+	}
+	if len(opts.GroupMap) > 0 {
+		res.MapGroup = groupMap.lookup
+	}
+	res.InPlace = opts.InPlace
+
+	var progress *restoreui.Progress
+	if term != nil {
+		var printer restoreui.ProgressPrinter
+		if gopts.JSON {
+			printer = restoreui.NewJSONProgress(term)
+		} else {
+			printer = restoreui.NewTextProgress(term, gopts.verbosity)
+		}
+		progress = restoreui.NewProgress(printer, calculateProgressInterval(!gopts.Quiet, gopts.JSON))
+	}
+	res.Progress = progress
 
 	totalErrors := 0
 	res.Error = func(location string, err error) error {
-		Warnf("ignoring error for %s: %s\n", location, err)
 		totalErrors++
+		if progress != nil {
+			return progress.Error(location, err)
+		}
+		Warnf("ignoring error for %s: %s\n", location, err)
 		return nil
 	}
 
@@ -192,15 +271,24 @@ func runRestore(ctx context.Context, opts RestoreOptions, gopts GlobalOptions, a
 		return selectedForRestore, childMayBeSelected
 	}
 
+	if opts.NoXattrs || opts.NoACLs {
+		res.XattrSelectFilter = func(name string) bool {
+			return !opts.NoXattrs && !restic.IsACLExtendedAttribute(name)
+		}
+	}
+
 	if hasExcludes {
 		res.SelectFilter = selectExcludeFilter
 	} else if hasIncludes {
 		res.SelectFilter = selectIncludeFilter
 	}
 
-	Verbosef("restoring %s to %s\n", res.Snapshot(), opts.Target)
+	if !gopts.JSON {
+		Verbosef("restoring %s to %s\n", res.Snapshot(), opts.Target)
+	}
 
 	err = res.RestoreTo(ctx, opts.Target)
+	progress.Finish()
 	if err != nil {
 		return err
 	}
@@ -210,7 +298,9 @@ func runRestore(ctx context.Context, opts RestoreOptions, gopts GlobalOptions, a
 	}
 
 	if opts.Verify {
-		Verbosef("verifying files in %s\n", opts.Target)
+		if !gopts.JSON {
+			Verbosef("verifying files in %s\n", opts.Target)
+		}
 		var count int
 		t0 := time.Now()
 		count, err = res.VerifyFiles(ctx, opts.Target)
@@ -220,9 +310,99 @@ func runRestore(ctx context.Context, opts RestoreOptions, gopts GlobalOptions, a
 		if totalErrors > 0 {
 			return errors.Fatalf("There were %d errors\n", totalErrors)
 		}
-		Verbosef("finished verifying %d files in %s (took %s)\n", count, opts.Target,
-			time.Since(t0).Round(time.Millisecond))
+		if !gopts.JSON {
+			Verbosef("finished verifying %d files in %s (took %s)\n", count, opts.Target,
+				time.Since(t0).Round(time.Millisecond))
+		}
 	}
 
 	return nil
 }
+
+// parseOverwriteBehavior parses the value of the --overwrite option.
+func parseOverwriteBehavior(s string) (restorer.OverwriteBehavior, error) {
+	switch s {
+	case "always", "":
+		return restorer.OverwriteAlways, nil
+	case "if-changed":
+		return restorer.OverwriteIfChanged, nil
+	case "if-newer":
+		return restorer.OverwriteIfNewer, nil
+	case "never":
+		return restorer.OverwriteNever, nil
+	default:
+		return 0, errors.Fatalf("invalid value for --overwrite: %q, must be one of always, if-changed, if-newer or never", s)
+	}
+}
+
+// ownerMapping maps the user or group IDs and names stored in a snapshot to
+// the IDs used for restoring.
+type ownerMapping struct {
+	ids   map[uint32]uint32
+	names map[string]uint32
+}
+
+// lookup returns the ID to use for an item owned by id and name. A mapping for
+// the ID takes precedence over one for the name.
+func (m ownerMapping) lookup(id uint32, name string) uint32 {
+	if newID, ok := m.ids[id]; ok {
+		return newID
+	}
+	if newID, ok := m.names[name]; ok && name != "" {
+		return newID
+	}
+	return id
+}
+
+// parseOwnerMapping parses entries in the format old:new. Names on the new
+// side are resolved to IDs via resolve.
+func parseOwnerMapping(option string, entries []string, resolve func(name string) (uint32, error)) (ownerMapping, error) {
+	m := ownerMapping{
+		ids:   make(map[uint32]uint32),
+		names: make(map[string]uint32),
+	}
+
+	for _, entry := range entries {
+		oldOwner, newOwner, ok := strings.Cut(entry, ":")
+		if !ok || oldOwner == "" || newOwner == "" {
+			return m, errors.Fatalf("%s: invalid mapping %q, expected old:new", option, entry)
+		}
+
+		newID, err := parseOwnerID(newOwner)
+		if err != nil {
+			newID, err = resolve(newOwner)
+			if err != nil {
+				return m, errors.Fatalf("%s: %v", option, err)
+			}
+		}
+
+		if oldID, err := parseOwnerID(oldOwner); err == nil {
+			m.ids[oldID] = newID
+		} else {
+			m.names[oldOwner] = newID
+		}
+	}
+
+	return m, nil
+}
+
+func parseOwnerID(s string) (uint32, error) {
+	id, err := strconv.ParseUint(s, 10, 32)
+	return uint32(id), err
+}
+
+func lookupUserID(name string) (uint32, error) {
+	usr, err := user.Lookup(name)
+	if err != nil {
+		return 0, err
+	}
+	return parseOwnerID(usr.Uid)
+}
+
+func lookupGroupID(name string) (uint32, error) {
+	grp, err := user.LookupGroup(name)
+	if err != nil {
+		return 0, err
+	}
+	return parseOwnerID(grp.Gid)
+}
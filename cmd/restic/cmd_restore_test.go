@@ -0,0 +1,40 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/restic/restic/internal/errors"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestParseOwnerMapping(t *testing.T) {
+	resolve := func(name string) (uint32, error) {
+		if name == "bob" {
+			return 2000, nil
+		}
+		return 0, errors.Errorf("unknown user %v", name)
+	}
+
+	m, err := parseOwnerMapping("--owner-map", []string{"1000:1500", "alice:bob", "33:0"}, resolve)
+	rtest.OK(t, err)
+
+	for _, test := range []struct {
+		id   uint32
+		name string
+		want uint32
+	}{
+		{1000, "", 1500},
+		{1000, "alice", 1500},
+		{1234, "alice", 2000},
+		{33, "www-data", 0},
+		{42, "", 42},
+		{42, "other", 42},
+	} {
+		rtest.Equals(t, test.want, m.lookup(test.id, test.name))
+	}
+
+	for _, entry := range []string{"1000", ":1000", "1000:", "1000:carol"} {
+		_, err := parseOwnerMapping("--owner-map", []string{entry}, resolve)
+		rtest.Assert(t, err != nil, "missing error for %q", entry)
+	}
+}
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/restic/restic/internal/checker"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/ui"
+)
+
+var cmdScrub = &cobra.Command{
+	Use:   "scrub [flags]",
+	Short: "Continuously verify a small part of the repository data",
+	Long: `
+The "scrub" command reads a part of the pack files in the repository and
+verifies their contents, such that damaged data is detected early without
+having to read the whole repository at once. The time each pack file was last
+verified is stored in the cache directory. Pack files which were never
+verified are read first, followed by the ones verified the longest time ago.
+
+The amount of data read by each run is specified by "--subset" either as a
+percentage of the pack files, e.g. "1%", or as a size with suffixes k/K, m/M,
+g/G, t/T, e.g. "500M". With "--interval", scrub keeps running and reads the
+next part after the given duration, e.g. "24h". The repository is only locked
+while reading. Use "--limit-download" to restrict the bandwidth used.
+
+EXIT STATUS
+===========
+
+Exit status is 0 if the command was successful, and non-zero if there was any error.
+`,
+	DisableAutoGenTag: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runScrub(cmd.Context(), scrubOptions, globalOptions, args)
+	},
+}
+
+// ScrubOptions bundles all options for the scrub command.
+type ScrubOptions struct {
+	Subset   string
+	Interval time.Duration
+}
+
+var scrubOptions ScrubOptions
+
+func init() {
+	cmdRoot.AddCommand(cmdScrub)
+
+	f := cmdScrub.Flags()
+	f.StringVar(&scrubOptions.Subset, "subset", "1%", "read a `subset` of the packs per run, either 'x%' or a size with suffixes k/K, m/M, g/G, t/T")
+	f.DurationVar(&scrubOptions.Interval, "interval", 0, "keep running and read the next subset after `duration`")
+}
+
+// scrubState records the time each pack was last verified.
+type scrubState struct {
+	Verified map[string]time.Time `json:"verified"`
+}
+
+func scrubStateFile(cacheDir string, repoID string) string {
+	return filepath.Join(cacheDir, repoID, "scrub-state.json")
+}
+
+func loadScrubState(filename string) (*scrubState, error) {
+	state := &scrubState{Verified: make(map[string]time.Time)}
+	buf, err := os.ReadFile(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(buf, state)
+	if err != nil {
+		return nil, errors.Errorf("invalid scrub state %v: %v", filename, err)
+	}
+	if state.Verified == nil {
+		state.Verified = make(map[string]time.Time)
+	}
+	return state, nil
+}
+
+// save atomically writes the state to filename.
+func (s *scrubState) save(filename string) error {
+	buf, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	err = fs.MkdirAll(filepath.Dir(filename), 0700)
+	if err != nil {
+		return err
+	}
+
+	tmpname := filename + ".tmp"
+	err = os.WriteFile(tmpname, buf, 0600)
+	if err != nil {
+		return err
+	}
+	return fs.Rename(tmpname, filename)
+}
+
+// selectScrubPacks returns the packs to read next, packs which were never
+// verified come first. Either percentage or size limits the selection.
+func selectScrubPacks(allPacks map[restic.ID]int64, state *scrubState, percentage float64, size int64) restic.IDs {
+	ids := make(restic.IDs, 0, len(allPacks))
+	for id := range allPacks {
+		ids = append(ids, id)
+	}
+	sort.Sort(ids)
+	sort.SliceStable(ids, func(i, j int) bool {
+		return state.Verified[ids[i].String()].Before(state.Verified[ids[j].String()])
+	})
+
+	if size == 0 {
+		count := int(float64(len(ids)) * (percentage / 100.0))
+		if len(ids) > 0 && count < 1 {
+			count = 1
+		}
+		return ids[:count]
+	}
+
+	var total int64
+	for i, id := range ids {
+		if total >= size {
+			return ids[:i]
+		}
+		total += allPacks[id]
+	}
+	return ids
+}
+
+func runScrub(ctx context.Context, opts ScrubOptions, gopts GlobalOptions, args []string) error {
+	if len(args) != 0 {
+		return errors.Fatal("the scrub command expects no arguments, only options - please see `restic help scrub` for usage and flags")
+	}
+
+	var percentage float64
+	var size int64
+	var err error
+	if strings.HasSuffix(opts.Subset, "%") {
+		percentage, err = parsePercentage(opts.Subset)
+		if err != nil || percentage <= 0.0 || percentage > 100.0 {
+			return errors.Fatal("scrub flag --subset=x% x must be above 0.0% and at most 100.0%")
+		}
+	} else {
+		size, err = parseSizeStr(opts.Subset)
+		if err != nil || size <= 0 {
+			return errors.Fatal("scrub flag --subset has invalid value, please see documentation")
+		}
+	}
+	if opts.Interval < 0 {
+		return errors.Fatal("scrub flag --interval must not be negative")
+	}
+
+	stateDir, err := stateCacheDir(gopts)
+	if err != nil {
+		return errors.Fatalf("scrub requires a cache directory: %v", err)
+	}
+
+	// the data must be read from the backend and not from the cache
+	gopts.NoCache = true
+	repo, err := OpenRepository(ctx, gopts)
+	if err != nil {
+		return err
+	}
+	stateFile := scrubStateFile(stateDir, repo.Config().ID)
+
+	for {
+		damaged, err := scrubOnce(ctx, gopts, repo, stateFile, percentage, size)
+		if err != nil {
+			return err
+		}
+
+		if opts.Interval == 0 {
+			if damaged > 0 {
+				return errors.Fatal("repository contains errors")
+			}
+			return nil
+		}
+
+		Verbosef("next run at %v\n", time.Now().Add(opts.Interval).Format(TimeFormat))
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(opts.Interval):
+		}
+	}
+}
+
+// scrubOnce reads the next subset of packs and returns the number of damaged
+// packs found.
+func scrubOnce(ctx context.Context, gopts GlobalOptions, repo restic.Repository, stateFile string, percentage float64, size int64) (int, error) {
+	if !gopts.NoLock {
+		var lock *restic.Lock
+		var err error
+		lock, ctx, err = lockRepo(ctx, repo)
+		defer unlockRepo(lock)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	chkr := checker.New(repo, false)
+	Verbosef("load indexes\n")
+	// hints about the index are only relevant for check
+	_, errs := chkr.LoadIndex(ctx)
+	if len(errs) > 0 {
+		for _, err := range errs {
+			Warnf("error: %v\n", err)
+		}
+		return 0, errors.Fatal("LoadIndex returned errors")
+	}
+
+	state, err := loadScrubState(stateFile)
+	if err != nil {
+		return 0, err
+	}
+
+	allPacks := chkr.GetPacks()
+	// forget packs which were removed from the repository
+	for id := range state.Verified {
+		packID, err := restic.ParseID(id)
+		if err != nil {
+			delete(state.Verified, id)
+			continue
+		}
+		if _, ok := allPacks[packID]; !ok {
+			delete(state.Verified, id)
+		}
+	}
+
+	ids := selectScrubPacks(allPacks, state, percentage, size)
+	var bytes uint64
+	for _, id := range ids {
+		bytes += uint64(allPacks[id])
+	}
+	Verbosef("read %d of %d packs (%s)\n", len(ids), len(allPacks), ui.FormatBytes(bytes))
+
+	p := newProgressMax(!gopts.Quiet, uint64(len(ids)), "packs")
+	defer p.Done()
+
+	damagedCount := 0
+	for len(ids) > 0 {
+		n := checkStateBatchSize
+		if n > len(ids) {
+			n = len(ids)
+		}
+		batch := make(map[restic.ID]int64, n)
+		for _, id := range ids[:n] {
+			batch[id] = allPacks[id]
+		}
+		ids = ids[n:]
+
+		damaged := restic.NewIDSet()
+		complete := true
+		errChan := make(chan error)
+		go chkr.ReadPacks(ctx, batch, p, errChan)
+		for err := range errChan {
+			Warnf("%v\n", err)
+			var packErr *checker.PackError
+			if errors.As(err, &packErr) {
+				damaged.Insert(packErr.ID)
+			} else {
+				complete = false
+			}
+		}
+		damagedCount += len(damaged)
+		if ctx.Err() != nil {
+			return damagedCount, ctx.Err()
+		}
+		if !complete {
+			return damagedCount, errors.Fatal("unable to read packs")
+		}
+
+		now := time.Now()
+		for id := range batch {
+			if !damaged.Has(id) {
+				state.Verified[id.String()] = now
+			}
+		}
+		err = state.save(stateFile)
+		if err != nil {
+			Warnf("unable to save scrub state: %v\n", err)
+		}
+	}
+	p.Done()
+
+	var oldest time.Time
+	unverified := 0
+	for id := range allPacks {
+		t, ok := state.Verified[id.String()]
+		if !ok {
+			unverified++
+			continue
+		}
+		if oldest.IsZero() || t.Before(oldest) {
+			oldest = t
+		}
+	}
+	if unverified > 0 {
+		Verbosef("%d packs were not verified yet\n", unverified)
+	} else if len(allPacks) > 0 {
+		Verbosef("all packs were verified since %v\n", oldest.Format(TimeFormat))
+	}
+	if damagedCount > 0 {
+		Warnf("found %d damaged packs\n", damagedCount)
+	}
+
+	return damagedCount, nil
+}
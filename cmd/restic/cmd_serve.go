@@ -0,0 +1,14 @@
+package main
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var cmdServe = &cobra.Command{
+	Use:   "serve",
+	Short: "Serve the snapshots in the repository to other programs",
+}
+
+func init() {
+	cmdRoot.AddCommand(cmdServe)
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/fuse"
+	"github.com/restic/restic/internal/httpfs"
+	"github.com/restic/restic/internal/restic"
+)
+
+var cmdServeHTTP = &cobra.Command{
+	Use:   "http [flags]",
+	Short: "Serve the snapshots via HTTP and WebDAV",
+	Long: `
+The "serve http" command runs a read-only web server which shows the snapshots
+in the same directory structure as the "mount" command. Files can be
+downloaded with a browser or tools like curl, for example:
+
+    curl -O http://localhost:8000/ids/latest/home/user/file.txt
+
+The server also supports WebDAV, thus it can be mounted by the WebDAV clients
+of most operating systems. As it does not support locking, clients mount it
+read-only. Links to snapshots like "latest" are shown as directories which
+contain the snapshot.
+
+The server listens on the address given by --listen. Use --tls-cert and
+--tls-key to serve HTTPS. With --htpasswd-file, clients need to log in with one
+of the users from the file, whose passwords must be hashed with bcrypt, for
+example created with "htpasswd -B -c file user". Without it, everyone who can
+connect to the server can read all snapshots.
+
+` + mountSnapshotDirsHelp + `
+
+EXIT STATUS
+===========
+
+Exit status is 0 if the command was successful, and non-zero if there was any error.
+`,
+	DisableAutoGenTag: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runServeHTTP(cmd.Context(), serveHTTPOptions, globalOptions, args)
+	},
+}
+
+// ServeHTTPOptions collects all options for the serve http command.
+type ServeHTTPOptions struct {
+	Listen       string
+	TLSCert      string
+	TLSKey       string
+	HtpasswdFile string
+	snapshotDirsOptions
+}
+
+var serveHTTPOptions ServeHTTPOptions
+
+func init() {
+	cmdServe.AddCommand(cmdServeHTTP)
+
+	f := cmdServeHTTP.Flags()
+	f.StringVar(&serveHTTPOptions.Listen, "listen", "localhost:8000", "listen on this `address` for HTTP clients")
+	f.StringVar(&serveHTTPOptions.TLSCert, "tls-cert", "", "serve HTTPS with the TLS certificate from `file`")
+	f.StringVar(&serveHTTPOptions.TLSKey, "tls-key", "", "serve HTTPS with the TLS key from `file`")
+	f.StringVar(&serveHTTPOptions.HtpasswdFile, "htpasswd-file", "", "require HTTP basic authentication for the users in `file`")
+	initSnapshotDirsOptions(f, &serveHTTPOptions.snapshotDirsOptions)
+}
+
+func runServeHTTP(ctx context.Context, opts ServeHTTPOptions, gopts GlobalOptions, args []string) error {
+	if len(args) > 0 {
+		return errors.Fatal("the serve http command expects no arguments")
+	}
+
+	if (opts.TLSCert == "") != (opts.TLSKey == "") {
+		return errors.Fatal("--tls-cert and --tls-key must be used together")
+	}
+
+	cfg, err := opts.config()
+	if err != nil {
+		return err
+	}
+
+	var users *httpfs.Htpasswd
+	if opts.HtpasswdFile != "" {
+		users, err = httpfs.ReadHtpasswd(opts.HtpasswdFile)
+		if err != nil {
+			return errors.Fatalf("%s", err)
+		}
+	}
+
+	repo, err := OpenRepository(ctx, gopts)
+	if err != nil {
+		return err
+	}
+
+	if !gopts.NoLock {
+		var lock *restic.Lock
+		lock, ctx, err = lockRepo(ctx, repo)
+		defer unlockRepo(lock)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = repo.LoadIndex(ctx)
+	if err != nil {
+		return err
+	}
+
+	var handler http.Handler = httpfs.NewHandler(fuse.NewSnapshotFS(ctx, repo, cfg))
+	if users != nil {
+		handler = httpfs.BasicAuth(handler, "restic", users)
+	}
+	srv := &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: 30 * time.Second,
+	}
+
+	l, err := net.Listen("tcp", opts.Listen)
+	if err != nil {
+		return errors.Fatalf("unable to listen for HTTP clients: %v", err)
+	}
+
+	AddCleanupHandler(func(code int) (int, error) {
+		// replace error code of sigint
+		if code == 130 {
+			code = 0
+		}
+		return code, nil
+	})
+
+	go func() {
+		<-ctx.Done()
+		_ = srv.Close()
+	}()
+
+	scheme := "http"
+	if opts.TLSCert != "" {
+		scheme = "https"
+	}
+	Printf("Now serving the repository at %s://%s/\n", scheme, l.Addr())
+	Printf("When finished, quit with Ctrl-c here.\n")
+
+	debug.Log("serving HTTP at %v", l.Addr())
+	if opts.TLSCert != "" {
+		err = srv.ServeTLS(l, opts.TLSCert, opts.TLSKey)
+	} else {
+		err = srv.Serve(l)
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
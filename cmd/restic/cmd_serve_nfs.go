@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"net"
+
+	"github.com/spf13/cobra"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/fuse"
+	"github.com/restic/restic/internal/nfs"
+	"github.com/restic/restic/internal/restic"
+)
+
+var cmdServeNFS = &cobra.Command{
+	Use:   "nfs [flags]",
+	Short: "Serve the snapshots via NFS",
+	Long: `
+The "serve nfs" command runs a read-only NFS server which exports the
+snapshots in the same directory structure as the "mount" command. This allows
+browsing snapshots on systems where FUSE is not available. Only NFS version 3
+over TCP is supported.
+
+The server listens on the address given by --listen. It does not register
+with a portmapper, thus the port for both NFS and the mount protocol must be
+passed to the client. For example, on Linux:
+
+    mount -t nfs -o vers=3,proto=tcp,port=2049,mountport=2049,nolock localhost:/ /mnt/restic
+
+On macOS:
+
+    mount -t nfs -o vers=3,tcp,port=2049,mountport=2049,nolocks,locallocks localhost:/ /mnt/restic
+
+Subdirectories can be mounted directly, for example "localhost:/ids/latest".
+Links to snapshots like "latest" are shown as directories which contain the
+snapshot.
+
+Everyone who can connect to the server can read all snapshots, this includes
+all local users for the default address. The server does not check the
+credentials of clients or the permissions of files, thus the command refuses
+to run unless --insecure-no-auth is passed. Only listen on addresses which are
+not reachable by untrusted users.
+
+` + mountSnapshotDirsHelp + `
+
+EXIT STATUS
+===========
+
+Exit status is 0 if the command was successful, and non-zero if there was any error.
+`,
+	DisableAutoGenTag: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runServeNFS(cmd.Context(), serveNFSOptions, globalOptions, args)
+	},
+}
+
+// ServeNFSOptions collects all options for the serve nfs command.
+type ServeNFSOptions struct {
+	Listen         string
+	InsecureNoAuth bool
+	snapshotDirsOptions
+}
+
+var serveNFSOptions ServeNFSOptions
+
+func init() {
+	cmdServe.AddCommand(cmdServeNFS)
+
+	f := cmdServeNFS.Flags()
+	f.StringVar(&serveNFSOptions.Listen, "listen", "localhost:2049", "listen on this `address` for NFS clients")
+	f.BoolVar(&serveNFSOptions.InsecureNoAuth, "insecure-no-auth", false, "serve without authentication, everyone who can connect to the server can read all snapshots")
+	initSnapshotDirsOptions(f, &serveNFSOptions.snapshotDirsOptions)
+}
+
+func runServeNFS(ctx context.Context, opts ServeNFSOptions, gopts GlobalOptions, args []string) error {
+	if len(args) > 0 {
+		return errors.Fatal("the serve nfs command expects no arguments")
+	}
+	if !opts.InsecureNoAuth {
+		return errors.Fatal("the NFS server does not authenticate clients, everyone who can connect to it can read all snapshots, pass --insecure-no-auth to serve anyway")
+	}
+
+	cfg, err := opts.config()
+	if err != nil {
+		return err
+	}
+
+	repo, err := OpenRepository(ctx, gopts)
+	if err != nil {
+		return err
+	}
+
+	if !gopts.NoLock {
+		var lock *restic.Lock
+		lock, ctx, err = lockRepo(ctx, repo)
+		defer unlockRepo(lock)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = repo.LoadIndex(ctx)
+	if err != nil {
+		return err
+	}
+
+	l, err := net.Listen("tcp", opts.Listen)
+	if err != nil {
+		return errors.Fatalf("unable to listen for NFS clients: %v", err)
+	}
+
+	AddCleanupHandler(func(code int) (int, error) {
+		// replace error code of sigint
+		if code == 130 {
+			code = 0
+		}
+		return code, nil
+	})
+
+	Printf("Now serving the repository via NFS at %s\n", l.Addr())
+	Printf("When finished, quit with Ctrl-c here.\n")
+
+	debug.Log("serving NFS at %v", l.Addr())
+	srv := nfs.NewServer(fuse.NewSnapshotFS(ctx, repo, cfg))
+	return srv.Serve(ctx, l)
+}
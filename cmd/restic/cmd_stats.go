@@ -4,12 +4,18 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"path"
 	"path/filepath"
+	"sort"
+	"strings"
 
 	"github.com/restic/restic/internal/backend"
 	"github.com/restic/restic/internal/crypto"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/fs"
 	"github.com/restic/restic/internal/restic"
 	"github.com/restic/restic/internal/ui"
+	"github.com/restic/restic/internal/ui/table"
 	"github.com/restic/restic/internal/walker"
 
 	"github.com/minio/sha256-simd"
@@ -17,7 +23,7 @@ import (
 )
 
 var cmdStats = &cobra.Command{
-	Use:   "stats [flags] [snapshot ID] [...]",
+	Use:   "stats [flags] [snapshot ID] [...]\n  restic stats --by-dir [flags] snapshotID [dir]",
 	Short: "Scan the repository and show basic statistics",
 	Long: `
 The "stats" command walks one or multiple snapshots in a repository
@@ -42,6 +48,11 @@ The modes are:
 
 Refer to the online manual for more details about each mode.
 
+With --by-dir, the stats are reported separately for each subdirectory of
+dir (default: the root of the snapshot) in a single snapshot. For each
+directory, the restore size and the size of the data which is not referenced
+by any other snapshot are shown.
+
 EXIT STATUS
 ===========
 
@@ -58,6 +69,9 @@ type StatsOptions struct {
 	// the mode of counting to perform (see consts for available modes)
 	countMode string
 
+	// report stats per subdirectory of a single snapshot
+	byDir bool
+
 	snapshotFilterOptions
 }
 
@@ -67,6 +81,7 @@ func init() {
 	cmdRoot.AddCommand(cmdStats)
 	f := cmdStats.Flags()
 	f.StringVar(&statsOptions.countMode, "mode", countModeRestoreSize, "counting mode: restore-size (default), files-by-contents, blobs-per-file or raw-data")
+	f.BoolVar(&statsOptions.byDir, "by-dir", false, "report the restore size and unique data size per subdirectory of a snapshot")
 	initMultiSnapshotFilterOptions(f, &statsOptions.snapshotFilterOptions, true)
 }
 
@@ -103,6 +118,10 @@ func runStats(ctx context.Context, gopts GlobalOptions, args []string) error {
 		Printf("scanning...\n")
 	}
 
+	if statsOptions.byDir {
+		return statsByDir(ctx, gopts, repo, snapshotLister, args)
+	}
+
 	// create a container for the stats (and other needed state)
 	stats := &statsContainer{
 		uniqueFiles:    make(map[fileID]struct{}),
@@ -295,6 +314,15 @@ func verifyStatsInput(gopts GlobalOptions, args []string) error {
 		return fmt.Errorf("unknown counting mode: %s (use the -h flag to get a list of supported modes)", statsOptions.countMode)
 	}
 
+	if statsOptions.byDir {
+		if statsOptions.countMode != countModeRestoreSize {
+			return errors.Fatal("--by-dir cannot be combined with --mode")
+		}
+		if len(args) < 1 || len(args) > 2 {
+			return errors.Fatal("--by-dir requires a snapshot ID and an optional directory")
+		}
+	}
+
 	return nil
 }
 
@@ -327,6 +355,177 @@ type statsContainer struct {
 	blobs restic.BlobSet
 }
 
+// statsDir holds the statistics for a single directory with --by-dir.
+type statsDir struct {
+	Path        string `json:"path"`
+	FileCount   uint64 `json:"total_file_count"`
+	RestoreSize uint64 `json:"restore_size"`
+	UniqueSize  uint64 `json:"unique_size"`
+
+	// blobs holds the data blobs already counted for UniqueSize
+	blobs restic.IDSet
+}
+
+func newStatsDir(path string) *statsDir {
+	return &statsDir{Path: path, blobs: restic.NewIDSet()}
+}
+
+// add counts the file node. Blobs contained in shared are not counted as
+// unique data.
+func (s *statsDir) add(repo restic.Repository, node *restic.Node, countSize bool, shared restic.BlobSet) error {
+	s.FileCount++
+	if countSize {
+		s.RestoreSize += node.Size
+	}
+
+	for _, id := range node.Content {
+		h := restic.BlobHandle{ID: id, Type: restic.DataBlob}
+		if shared.Has(h) || s.blobs.Has(id) {
+			continue
+		}
+
+		pbs := repo.Index().Lookup(h)
+		if len(pbs) == 0 {
+			return fmt.Errorf("blob %v not found", h)
+		}
+		s.UniqueSize += uint64(pbs[0].Length)
+		s.blobs.Insert(id)
+	}
+	return nil
+}
+
+// statsByDir reports the stats for each subdirectory of the directory
+// args[1] in the snapshot args[0].
+func statsByDir(ctx context.Context, gopts GlobalOptions, repo restic.Repository, snapshotLister restic.Lister, args []string) error {
+	sn, err := restic.FindFilteredSnapshot(ctx, snapshotLister, repo, statsOptions.Hosts, statsOptions.Tags, statsOptions.Paths, nil, args[0])
+	if err != nil {
+		return errors.Fatalf("failed to find snapshot: %v", err)
+	}
+
+	dir := "/"
+	if len(args) > 1 {
+		dir = path.Join("/", args[1])
+	}
+
+	// collect the blobs referenced by all other snapshots, data only
+	// referenced by this snapshot is what is freed when it is forgotten
+	var otherTrees restic.IDs
+	err = restic.ForAllSnapshots(ctx, snapshotLister, repo, restic.NewIDSet(*sn.ID()), func(_ restic.ID, other *restic.Snapshot, err error) error {
+		if err != nil {
+			return err
+		}
+		otherTrees = append(otherTrees, *other.Tree)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	shared := restic.NewBlobSet()
+	err = restic.FindUsedBlobs(ctx, repo, otherTrees, shared, nil)
+	if err != nil {
+		return err
+	}
+
+	total := newStatsDir(dir)
+	subdirs := make(map[string]*statsDir)
+	uniqueInodes := make(map[uint64]struct{})
+	found := dir == "/"
+
+	err = walker.Walk(ctx, repo, *sn.Tree, nil, func(_ restic.ID, nodepath string, node *restic.Node, err error) (bool, error) {
+		if err != nil {
+			return false, err
+		}
+		if node == nil {
+			return false, nil
+		}
+
+		if !fs.HasPathPrefix(dir, nodepath) {
+			if node.Type == "dir" && !fs.HasPathPrefix(nodepath, dir) {
+				return false, walker.ErrSkipNode
+			}
+			return false, nil
+		}
+
+		if nodepath == dir {
+			found = true
+			return false, nil
+		}
+
+		// the subdirectory of dir containing the node
+		rel := strings.TrimPrefix(nodepath, dir)
+		rel = strings.TrimPrefix(rel, "/")
+		name, _, isNested := strings.Cut(rel, "/")
+		subdir := path.Join(dir, name)
+
+		if node.Type == "dir" && !isNested {
+			subdirs[subdir] = newStatsDir(subdir)
+		}
+
+		if node.Type != "file" {
+			return false, nil
+		}
+
+		// hard links do not increase the restore size
+		_, seen := uniqueInodes[node.Inode]
+		countSize := !seen || node.Inode == 0
+		uniqueInodes[node.Inode] = struct{}{}
+
+		if err := total.add(repo, node, countSize, shared); err != nil {
+			return false, err
+		}
+		if stats, ok := subdirs[subdir]; ok {
+			return false, stats.add(repo, node, countSize, shared)
+		}
+		return false, nil
+	})
+	if err != nil {
+		return fmt.Errorf("walking tree %s: %v", *sn.Tree, err)
+	}
+
+	if !found {
+		return errors.Fatalf("path %q not found in snapshot %s", dir, sn.ID().Str())
+	}
+
+	stats := make([]*statsDir, 0, len(subdirs))
+	for _, s := range subdirs {
+		stats = append(stats, s)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Path < stats[j].Path
+	})
+
+	if gopts.JSON {
+		err = json.NewEncoder(globalOptions.stdout).Encode(struct {
+			SnapshotID string      `json:"snapshot_id"`
+			Total      *statsDir   `json:"total"`
+			Dirs       []*statsDir `json:"dirs"`
+		}{sn.ID().String(), total, stats})
+		if err != nil {
+			return fmt.Errorf("encoding output: %v", err)
+		}
+		return nil
+	}
+
+	tab := table.New()
+	tab.AddColumn("Path", "{{ .Path }}")
+	tab.AddColumn("Files", "{{ .FileCount }}")
+	tab.AddColumn("Restore Size", "{{ .RestoreSize }}")
+	tab.AddColumn("Unique Size", "{{ .UniqueSize }}")
+	for _, s := range stats {
+		tab.AddRow(struct {
+			Path                    string
+			FileCount               uint64
+			RestoreSize, UniqueSize string
+		}{s.Path, s.FileCount, ui.FormatBytes(s.RestoreSize), ui.FormatBytes(s.UniqueSize)})
+	}
+	tab.AddFooter(fmt.Sprintf("%s: %d files, restore size %s, unique size %s", dir, total.FileCount,
+		ui.FormatBytes(total.RestoreSize), ui.FormatBytes(total.UniqueSize)))
+
+	Printf("Stats per directory of %s in snapshot %s:\n", dir, sn.ID().Str())
+	return tab.Write(globalOptions.stdout)
+}
+
 // fileID is a 256-bit hash that distinguishes unique files.
 type fileID [32]byte
 
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/restic/restic/internal/backend"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/ui"
+
+	"github.com/spf13/cobra"
+)
+
+var cmdUnused = &cobra.Command{
+	Use:   "unused [flags]",
+	Short: "List unused and duplicate data in the repository",
+	Long: `
+The "unused" command lists all blobs which are not referenced by any snapshot,
+all additional copies of blobs which are stored more than once and all pack
+files which are not contained in the index, for example as they were left
+behind by an interrupted backup. Nothing is removed from the repository, run
+"prune" to free the space.
+
+Data which is added by a backup running at the same time is not yet referenced
+by a snapshot and is therefore also reported as unused.
+
+EXIT STATUS
+===========
+
+Exit status is 0 if the command was successful, and non-zero if there was any error.
+`,
+	DisableAutoGenTag: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runUnused(cmd.Context(), globalOptions, args)
+	},
+}
+
+func init() {
+	cmdRoot.AddCommand(cmdUnused)
+}
+
+// unusedBlob is an unused or duplicate copy of a blob.
+type unusedBlob struct {
+	Type   restic.BlobType `json:"type"`
+	ID     restic.ID       `json:"id"`
+	PackID restic.ID       `json:"pack_id"`
+	Size   uint            `json:"size"`
+}
+
+// unusedPack is a pack file which is not contained in the index.
+type unusedPack struct {
+	ID   restic.ID `json:"id"`
+	Size int64     `json:"size"`
+}
+
+// unusedReport is printed as a single message with --json.
+type unusedReport struct {
+	MessageType       string       `json:"message_type"` // "summary"
+	UnusedBlobs       []unusedBlob `json:"unused_blobs"`
+	UnusedSize        uint64       `json:"unused_size"`
+	DuplicateBlobs    []unusedBlob `json:"duplicate_blobs"`
+	DuplicateSize     uint64       `json:"duplicate_size"`
+	UnreferencedPacks []unusedPack `json:"unreferenced_packs"`
+	UnreferencedSize  uint64       `json:"unreferenced_size"`
+}
+
+func runUnused(ctx context.Context, gopts GlobalOptions, args []string) error {
+	if len(args) != 0 {
+		return errors.Fatal("the unused command expects no arguments, only options - please see `restic help unused` for usage and flags")
+	}
+
+	repo, err := OpenRepository(ctx, gopts)
+	if err != nil {
+		return err
+	}
+
+	if !gopts.NoLock {
+		var lock *restic.Lock
+		lock, ctx, err = lockRepo(ctx, repo)
+		defer unlockRepo(lock)
+		if err != nil {
+			return err
+		}
+	}
+
+	// list the snapshots before loading the index, the index then contains
+	// all blobs referenced by these snapshots even if a backup is running
+	snapshotLister, err := backend.MemorizeList(ctx, repo.Backend(), restic.SnapshotFile)
+	if err != nil {
+		return err
+	}
+
+	printPhase("load-index", "loading indexes...\n")
+	err = repo.LoadIndex(ctx)
+	if err != nil {
+		return err
+	}
+
+	usedBlobs, err := getUsedBlobs(ctx, repo, snapshotLister, restic.NewIDSet(), gopts.Quiet)
+	if err != nil {
+		return err
+	}
+
+	report := unusedReport{
+		MessageType:       "summary",
+		UnusedBlobs:       []unusedBlob{},
+		DuplicateBlobs:    []unusedBlob{},
+		UnreferencedPacks: []unusedPack{},
+	}
+
+	indexedPacks := restic.NewIDSet()
+	repo.Index().Each(ctx, func(pb restic.PackedBlob) {
+		indexedPacks.Insert(pb.PackID)
+		blob := unusedBlob{Type: pb.Type, ID: pb.ID, PackID: pb.PackID, Size: pb.Length}
+
+		count, ok := usedBlobs.Get(pb.BlobHandle)
+		switch {
+		case !ok:
+			report.UnusedBlobs = append(report.UnusedBlobs, blob)
+			report.UnusedSize += uint64(pb.Length)
+		case count == 0:
+			// first copy of a used blob
+			usedBlobs.Set(pb.BlobHandle, 1)
+		default:
+			report.DuplicateBlobs = append(report.DuplicateBlobs, blob)
+			report.DuplicateSize += uint64(pb.Length)
+		}
+	})
+
+	err = repo.List(ctx, restic.PackFile, func(id restic.ID, size int64) error {
+		if !indexedPacks.Has(id) {
+			report.UnreferencedPacks = append(report.UnreferencedPacks, unusedPack{ID: id, Size: size})
+			report.UnreferencedSize += uint64(size)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if gopts.JSON {
+		return json.NewEncoder(globalOptions.stdout).Encode(report)
+	}
+
+	for _, blob := range report.UnusedBlobs {
+		Printf("unused %v blob %v in pack %v, %v\n", blob.Type, blob.ID, blob.PackID, ui.FormatBytes(uint64(blob.Size)))
+	}
+	for _, blob := range report.DuplicateBlobs {
+		Printf("duplicate %v blob %v in pack %v, %v\n", blob.Type, blob.ID, blob.PackID, ui.FormatBytes(uint64(blob.Size)))
+	}
+	for _, pack := range report.UnreferencedPacks {
+		Printf("unreferenced pack %v, %v\n", pack.ID, ui.FormatBytes(uint64(pack.Size)))
+	}
+
+	Printf("\n")
+	Printf("unused blobs:       %10d blobs / %s\n", len(report.UnusedBlobs), ui.FormatBytes(report.UnusedSize))
+	Printf("duplicate blobs:    %10d blobs / %s\n", len(report.DuplicateBlobs), ui.FormatBytes(report.DuplicateSize))
+	Printf("unreferenced packs: %10d packs / %s\n", len(report.UnreferencedPacks), ui.FormatBytes(report.UnreferencedSize))
+	return nil
+}
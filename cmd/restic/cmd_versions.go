@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/restic/restic/internal/backend"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/ui"
+	"github.com/restic/restic/internal/ui/table"
+)
+
+var cmdVersions = &cobra.Command{
+	Use:   "versions [flags] path",
+	Short: "List the versions of a file across snapshots",
+	Long: `
+The "versions" command looks up a file or directory in all snapshots and
+lists each distinct version of it, together with the first snapshot the
+version was found in. A new version is reported whenever the type, size,
+modification time or content of the path differs from the previous
+snapshot containing it. Snapshots are processed from oldest to newest.
+
+The path must be absolute, as shown by the "ls" command, and uses the
+forward slash '/' as separator.
+
+EXIT STATUS
+===========
+
+Exit status is 0 if the command was successful, and non-zero if there was any error.
+`,
+	Example: `restic versions /home/user/work/report.odt
+restic versions --host laptop --json /etc/fstab`,
+	DisableAutoGenTag: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runVersions(cmd.Context(), versionsOptions, globalOptions, args)
+	},
+}
+
+// VersionsOptions collects all options for the versions command.
+type VersionsOptions struct {
+	snapshotFilterOptions
+	All bool
+}
+
+var versionsOptions VersionsOptions
+
+func init() {
+	cmdRoot.AddCommand(cmdVersions)
+
+	flags := cmdVersions.Flags()
+	initMultiSnapshotFilterOptions(flags, &versionsOptions.snapshotFilterOptions, true)
+	flags.BoolVar(&versionsOptions.All, "all", false, "list the path for every snapshot containing it, even if unchanged")
+}
+
+// fileVersion describes the state of a path in one snapshot.
+type fileVersion struct {
+	SnapshotID string    `json:"snapshot_id"`
+	Time       time.Time `json:"time"`
+	Type       string    `json:"type"`
+	Size       uint64    `json:"size"`
+	ModTime    time.Time `json:"mtime"`
+
+	node *restic.Node
+}
+
+// findNodeInTree returns the node for the absolute path p in the tree with
+// the given ID, or nil if the path does not exist.
+func findNodeInTree(ctx context.Context, repo restic.BlobLoader, id restic.ID, p string) (*restic.Node, error) {
+	components := strings.Split(strings.Trim(p, "/"), "/")
+
+	var node *restic.Node
+	for i, name := range components {
+		tree, err := restic.LoadTree(ctx, repo, id)
+		if err != nil {
+			return nil, err
+		}
+
+		node = tree.Find(name)
+		if node == nil {
+			return nil, nil
+		}
+
+		if i == len(components)-1 {
+			break
+		}
+
+		if node.Type != "dir" || node.Subtree == nil {
+			return nil, nil
+		}
+		id = *node.Subtree
+	}
+
+	return node, nil
+}
+
+// sameVersion returns true if the nodes a and b describe the same version of
+// a file or directory.
+func sameVersion(a, b *restic.Node) bool {
+	if a.Type != b.Type || a.Size != b.Size || !a.ModTime.Equal(b.ModTime) || a.LinkTarget != b.LinkTarget {
+		return false
+	}
+
+	if (a.Subtree == nil) != (b.Subtree == nil) {
+		return false
+	}
+	if a.Subtree != nil && !a.Subtree.Equal(*b.Subtree) {
+		return false
+	}
+
+	if len(a.Content) != len(b.Content) {
+		return false
+	}
+	for i := range a.Content {
+		if !a.Content[i].Equal(b.Content[i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func runVersions(ctx context.Context, opts VersionsOptions, gopts GlobalOptions, args []string) error {
+	if len(args) != 1 {
+		return errors.Fatal("specify exactly one path")
+	}
+
+	target := path.Clean(args[0])
+	if !strings.HasPrefix(target, "/") {
+		return errors.Fatal("the path must be absolute, starting with a forward slash '/'")
+	}
+	if target == "/" {
+		return errors.Fatal("cannot list versions of the snapshot root")
+	}
+
+	repo, err := OpenRepository(ctx, gopts)
+	if err != nil {
+		return err
+	}
+
+	if !gopts.NoLock {
+		var lock *restic.Lock
+		lock, ctx, err = lockRepo(ctx, repo)
+		defer unlockRepo(lock)
+		if err != nil {
+			return err
+		}
+	}
+
+	snapshotLister, err := backend.MemorizeList(ctx, repo.Backend(), restic.SnapshotFile)
+	if err != nil {
+		return err
+	}
+
+	if err = repo.LoadIndex(ctx); err != nil {
+		return err
+	}
+
+	var snapshots []*restic.Snapshot
+	for sn := range FindFilteredSnapshots(ctx, snapshotLister, repo, opts.Hosts, opts.Tags, opts.Paths, nil) {
+		snapshots = append(snapshots, sn)
+	}
+	sort.SliceStable(snapshots, func(i, j int) bool {
+		return snapshots[i].Time.Before(snapshots[j].Time)
+	})
+
+	var versions []fileVersion
+	for _, sn := range snapshots {
+		node, err := findNodeInTree(ctx, repo, *sn.Tree, target)
+		if err != nil {
+			return errors.Fatalf("loading tree for snapshot %s failed: %v", sn.ID().Str(), err)
+		}
+		if node == nil {
+			continue
+		}
+
+		if !opts.All && len(versions) > 0 && sameVersion(versions[len(versions)-1].node, node) {
+			continue
+		}
+
+		versions = append(versions, fileVersion{
+			SnapshotID: sn.ID().String(),
+			Time:       sn.Time,
+			Type:       node.Type,
+			Size:       node.Size,
+			ModTime:    node.ModTime,
+			node:       node,
+		})
+	}
+
+	if gopts.JSON {
+		if versions == nil {
+			versions = []fileVersion{}
+		}
+		return json.NewEncoder(gopts.stdout).Encode(versions)
+	}
+
+	tab := table.New()
+	tab.AddColumn("ID", "{{ .ID }}")
+	tab.AddColumn("Time", "{{ .Time }}")
+	tab.AddColumn("Type", "{{ .Type }}")
+	tab.AddColumn("Modified", "{{ .ModTime }}")
+	tab.AddColumn("Size", "{{ .Size }}")
+
+	for _, v := range versions {
+		tab.AddRow(struct {
+			ID, Time, Type, ModTime, Size string
+		}{
+			ID:      v.SnapshotID[:8],
+			Time:    v.Time.Local().Format(TimeFormat),
+			Type:    v.Type,
+			ModTime: v.ModTime.Local().Format(TimeFormat),
+			Size:    ui.FormatBytes(v.Size),
+		})
+	}
+	tab.AddFooter(fmt.Sprintf("%d versions", len(versions)))
+
+	return tab.Write(gopts.stdout)
+}
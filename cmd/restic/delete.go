@@ -2,27 +2,37 @@ package main
 
 import (
 	"context"
+	"sync"
 
 	"golang.org/x/sync/errgroup"
 
+	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/restic"
 )
 
 // DeleteFiles deletes the given fileList of fileType in parallel
 // it will print a warning if there is an error, but continue deleting the remaining files
 func DeleteFiles(ctx context.Context, gopts GlobalOptions, repo restic.Repository, fileList restic.IDSet, fileType restic.FileType) {
-	_ = deleteFiles(ctx, gopts, true, repo, fileList, fileType)
+	_, _ = deleteFiles(ctx, gopts, true, repo, fileList, fileType)
 }
 
 // DeleteFilesChecked deletes the given fileList of fileType in parallel
 // if an error occurs, it will cancel and return this error
 func DeleteFilesChecked(ctx context.Context, gopts GlobalOptions, repo restic.Repository, fileList restic.IDSet, fileType restic.FileType) error {
+	_, err := deleteFiles(ctx, gopts, false, repo, fileList, fileType)
+	return err
+}
+
+// DeleteFilesCheckedLocked works like DeleteFilesChecked, but also returns the
+// files which are protected by object lock and were therefore not removed.
+func DeleteFilesCheckedLocked(ctx context.Context, gopts GlobalOptions, repo restic.Repository, fileList restic.IDSet, fileType restic.FileType) (restic.IDSet, error) {
 	return deleteFiles(ctx, gopts, false, repo, fileList, fileType)
 }
 
 // deleteFiles deletes the given fileList of fileType in parallel
 // if ignoreError=true, it will print a warning if there was an error, else it will abort.
-func deleteFiles(ctx context.Context, gopts GlobalOptions, ignoreError bool, repo restic.Repository, fileList restic.IDSet, fileType restic.FileType) error {
+// The files protected by object lock are kept and returned.
+func deleteFiles(ctx context.Context, gopts GlobalOptions, ignoreError bool, repo restic.Repository, fileList restic.IDSet, fileType restic.FileType) (restic.IDSet, error) {
 	totalCount := len(fileList)
 	fileChan := make(chan restic.ID)
 	wg, ctx := errgroup.WithContext(ctx)
@@ -38,6 +48,8 @@ func deleteFiles(ctx context.Context, gopts GlobalOptions, ignoreError bool, rep
 		return nil
 	})
 
+	var m sync.Mutex
+	locked := restic.NewIDSet()
 	bar := newProgressMax(!gopts.JSON && !gopts.Quiet, uint64(totalCount), "files deleted")
 	defer bar.Done()
 	// deleting files is IO-bound
@@ -47,6 +59,17 @@ func deleteFiles(ctx context.Context, gopts GlobalOptions, ignoreError bool, rep
 			for id := range fileChan {
 				h := restic.Handle{Type: fileType, Name: id.String()}
 				err := repo.Backend().Remove(ctx, h)
+				if errors.Is(err, restic.ErrObjectLocked) {
+					// the file will be removed by a later run once the lock has expired
+					if !gopts.JSON && gopts.verbosity > 2 {
+						Verbosef("kept %v\n", err)
+					}
+					m.Lock()
+					locked.Insert(id)
+					m.Unlock()
+					bar.Add(1)
+					continue
+				}
 				if err != nil {
 					if !gopts.JSON {
 						Warnf("unable to remove %v from the repository\n", h)
@@ -64,5 +87,10 @@ func deleteFiles(ctx context.Context, gopts GlobalOptions, ignoreError bool, rep
 		})
 	}
 	err := wg.Wait()
-	return err
+	bar.Done()
+
+	if len(locked) > 0 && !gopts.JSON {
+		Printf("%d of %d files are protected by object lock and were not removed\n", len(locked), totalCount)
+	}
+	return locked, err
 }
@@ -271,14 +271,32 @@ func (m DeviceMap) IsAllowed(item string, deviceID uint64) (bool, error) {
 }
 
 // rejectByDevice returns a RejectFunc that rejects files which are on a
-// different file systems than the files/dirs in samples.
-func rejectByDevice(samples []string) (RejectFunc, error) {
+// different file systems than the files/dirs in samples. If skipped is not
+// nil, it is called once for each mount point whose content is rejected.
+func rejectByDevice(samples []string, skipped func(mountPoint string)) (RejectFunc, error) {
 	deviceMap, err := NewDeviceMap(samples)
 	if err != nil {
 		return nil, err
 	}
 	debug.Log("allowed devices: %v\n", deviceMap)
 
+	var mtx sync.Mutex
+	reported := make(map[string]struct{})
+	reportMountPoint := func(item string) {
+		if skipped == nil {
+			return
+		}
+
+		mtx.Lock()
+		_, ok := reported[item]
+		reported[item] = struct{}{}
+		mtx.Unlock()
+
+		if !ok {
+			skipped(item)
+		}
+	}
+
 	return func(item string, fi os.FileInfo) bool {
 		id, err := fs.DeviceID(fi)
 		if err != nil {
@@ -331,6 +349,8 @@ func rejectByDevice(samples []string) (RejectFunc, error) {
 
 		if parentAllowed {
 			// we found a mount point, so accept the directory
+			debug.Log("item %v: skipping contents of mount point", item)
+			reportMountPoint(filepath.Clean(item))
 			return false
 		}
 
@@ -385,6 +405,155 @@ func rejectBySize(maxSizeStr string) (RejectFunc, error) {
 	}, nil
 }
 
+// ignoreFilePattern is a pattern read from a per-directory ignore file.
+type ignoreFilePattern struct {
+	pattern []filter.Pattern
+	negate  bool
+	dirOnly bool
+}
+
+// parseIgnoreFile parses the gitignore-style patterns in buf, which was read
+// from an ignore file in dir. The patterns are matched against the path
+// relative to dir, so that dir itself cannot contain glob characters. Patterns
+// without a slash match at any level, other patterns are relative to dir.
+func parseIgnoreFile(dir string, buf []byte) []ignoreFilePattern {
+	var patterns []ignoreFilePattern
+	for _, line := range strings.Split(string(buf), "\n") {
+		line = strings.TrimRight(line, " \t\r")
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		var pat ignoreFilePattern
+		if line[0] == '!' {
+			pat.negate = true
+			line = line[1:]
+		} else if line[0] == '\\' {
+			// escaped leading '#' or '!'
+			line = line[1:]
+		}
+
+		if strings.HasSuffix(line, "/") {
+			pat.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+		if line == "" {
+			continue
+		}
+
+		var str string
+		if strings.Contains(line, "/") {
+			str = string(filepath.Separator) + filepath.FromSlash(strings.TrimLeft(line, "/"))
+		} else {
+			str = filepath.Join(string(filepath.Separator), "**", line)
+		}
+
+		if err := filter.ValidatePatterns([]string{str}); err != nil {
+			Warnf("ignoring invalid pattern %q in ignore file in %v\n", line, dir)
+			continue
+		}
+		pat.pattern = filter.ParsePatterns([]string{str})
+		patterns = append(patterns, pat)
+	}
+	return patterns
+}
+
+// rejectByIgnoreFiles returns a RejectFunc which rejects files matching the
+// patterns of the ignore files with the given names. The ignore files are
+// read from the directories within targets, patterns from deeper directories
+// take precedence and can re-include files with a leading '!'.
+func rejectByIgnoreFiles(names []string, targets []string) (RejectFunc, error) {
+	for _, name := range names {
+		if name == "" || strings.ContainsAny(name, "/\\") {
+			return nil, errors.Fatalf("invalid name %q for ignore file", name)
+		}
+	}
+
+	absTargets := make([]string, 0, len(targets))
+	for _, target := range targets {
+		abs, err := filepath.Abs(target)
+		if err != nil {
+			return nil, err
+		}
+		absTargets = append(absTargets, abs)
+	}
+
+	var mtx sync.Mutex
+	cache := make(map[string][]ignoreFilePattern)
+
+	load := func(dir string) []ignoreFilePattern {
+		mtx.Lock()
+		defer mtx.Unlock()
+
+		if patterns, ok := cache[dir]; ok {
+			return patterns
+		}
+
+		var patterns []ignoreFilePattern
+		for _, name := range names {
+			buf, err := textfile.Read(filepath.Join(dir, name))
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			if err != nil {
+				Warnf("unable to read ignore file: %v\n", err)
+				continue
+			}
+			patterns = append(patterns, parseIgnoreFile(dir, buf)...)
+		}
+		cache[dir] = patterns
+		return patterns
+	}
+
+	inTargets := func(dir string) bool {
+		for _, target := range absTargets {
+			if fs.HasPathPrefix(target, dir) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return func(item string, fi os.FileInfo) bool {
+		// collect the directories containing item, outermost first
+		var dirs []string
+		for dir := filepath.Dir(item); inTargets(dir); dir = filepath.Dir(dir) {
+			dirs = append([]string{dir}, dirs...)
+			if dir == filepath.Dir(dir) {
+				break
+			}
+		}
+
+		rejected := false
+		for _, dir := range dirs {
+			rel, err := filepath.Rel(dir, item)
+			if err != nil {
+				continue
+			}
+			rel = string(filepath.Separator) + rel
+
+			for _, pat := range load(dir) {
+				if pat.dirOnly && !fi.IsDir() {
+					continue
+				}
+				matched, err := filter.List(pat.pattern, rel)
+				if err != nil {
+					Warnf("error for ignore file pattern: %v\n", err)
+					continue
+				}
+				if matched {
+					rejected = !pat.negate
+				}
+			}
+		}
+
+		if rejected {
+			debug.Log("path %q excluded by an ignore file", item)
+		}
+		return rejected
+	}, nil
+}
+
 func parseSizeStr(sizeStr string) (int64, error) {
 	if sizeStr == "" {
 		return 0, errors.New("expected size, got empty string")
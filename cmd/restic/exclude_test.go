@@ -187,6 +187,76 @@ func TestMultipleIsExcludedByFile(t *testing.T) {
 	}
 }
 
+func TestRejectByIgnoreFiles(t *testing.T) {
+	// glob characters in the path of an ignore file must not matter
+	tempDir := filepath.Join(test.TempDir(t), "dir[1]")
+
+	files := []struct {
+		path string
+		incl bool
+	}{
+		{".resticignore", true},
+		{"42", true},
+		{"foo.log", false},
+		{"build", false},
+		{"cache/data", false},
+		{"src/main.go", true},
+		{"src/main.o", false},
+		{"src/.resticignore", true},
+		{"src/keep.log", true},
+		{"src/debug.log", false},
+		{"src/tmp/x", false},
+		{"src/sub/tmp/x", true},
+	}
+
+	ignoreFiles := map[string]string{
+		".resticignore":     "# comment\n*.log\n*.o\n/build\ncache/\n",
+		"src/.resticignore": "!keep.log\n/tmp/\n",
+	}
+
+	var errs []error
+	for _, f := range files {
+		p := filepath.Join(tempDir, filepath.FromSlash(f.path))
+		data := ignoreFiles[f.path]
+		if data == "" {
+			data = f.path
+		}
+		errs = append(errs, os.MkdirAll(filepath.Dir(p), 0700))
+		errs = append(errs, os.WriteFile(p, []byte(data), 0600))
+	}
+	test.OKs(t, errs)
+
+	reject, err := rejectByIgnoreFiles([]string{".resticignore"}, []string{tempDir})
+	test.OK(t, err)
+
+	m := make(map[string]bool)
+	walk := func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		excluded := reject(p, fi)
+		t.Logf("%q: %v", p, excluded)
+		m[p] = !excluded
+		if excluded && fi.IsDir() {
+			return filepath.SkipDir
+		}
+		return nil
+	}
+	test.OK(t, filepath.Walk(tempDir, walk))
+
+	for _, f := range files {
+		p := filepath.Join(tempDir, filepath.FromSlash(f.path))
+		if m[p] != f.incl {
+			t.Errorf("inclusion status of %s is wrong: want %v, got %v", f.path, f.incl, m[p])
+		}
+	}
+
+	for _, name := range []string{"", "dir/.resticignore"} {
+		_, err := rejectByIgnoreFiles([]string{name}, []string{tempDir})
+		test.Assert(t, err != nil, "expected error for ignore file name %q", name)
+	}
+}
+
 func TestParseSizeStr(t *testing.T) {
 	sizeStrTests := []struct {
 		in       string
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"io"
+	"os"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+	"gopkg.in/yaml.v3"
+)
+
+// forgetPolicyFile is the content of a policy file for the forget command.
+type forgetPolicyFile struct {
+	Rules []forgetPolicyRule `yaml:"rules"`
+}
+
+// forgetPolicyRule applies a keep policy to all snapshots matching the
+// filters. The keys mirror the command line options of forget.
+type forgetPolicyRule struct {
+	Hosts []string `yaml:"host"`
+	Tags  []string `yaml:"tag"`
+	Paths []string `yaml:"path"`
+
+	Last          int      `yaml:"keep-last"`
+	Hourly        int      `yaml:"keep-hourly"`
+	Daily         int      `yaml:"keep-daily"`
+	Weekly        int      `yaml:"keep-weekly"`
+	Monthly       int      `yaml:"keep-monthly"`
+	Yearly        int      `yaml:"keep-yearly"`
+	Within        string   `yaml:"keep-within"`
+	WithinHourly  string   `yaml:"keep-within-hourly"`
+	WithinDaily   string   `yaml:"keep-within-daily"`
+	WithinWeekly  string   `yaml:"keep-within-weekly"`
+	WithinMonthly string   `yaml:"keep-within-monthly"`
+	WithinYearly  string   `yaml:"keep-within-yearly"`
+	KeepTags      []string `yaml:"keep-tag"`
+}
+
+// forgetPolicy is a parsed rule of a policy file.
+type forgetPolicy struct {
+	hosts  []string
+	tags   restic.TagLists
+	paths  []string
+	policy restic.ExpirePolicy
+}
+
+// matches returns true if the snapshot is selected by the rule's filters.
+func (p forgetPolicy) matches(sn *restic.Snapshot) bool {
+	return sn.HasHostname(p.hosts) && sn.HasTagList(p.tags) && sn.HasPaths(p.paths)
+}
+
+// loadForgetPolicies reads the policy file at filename.
+func loadForgetPolicies(filename string) ([]forgetPolicy, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, errors.Fatalf("unable to open policy file: %v", err)
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	policies, err := parseForgetPolicies(f)
+	if err != nil {
+		return nil, errors.Fatalf("invalid policy file %v: %v", filename, err)
+	}
+	return policies, nil
+}
+
+// parseForgetPolicies parses the rules of a policy file from rd. Unknown keys
+// are rejected, such that a typo cannot silently remove snapshots.
+func parseForgetPolicies(rd io.Reader) ([]forgetPolicy, error) {
+	var file forgetPolicyFile
+	dec := yaml.NewDecoder(rd)
+	dec.KnownFields(true)
+	err := dec.Decode(&file)
+	if err == io.EOF {
+		return nil, errors.New("no rules found")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(file.Rules) == 0 {
+		return nil, errors.New("no rules found")
+	}
+
+	policies := make([]forgetPolicy, 0, len(file.Rules))
+	for i, rule := range file.Rules {
+		p, err := rule.parse()
+		if err != nil {
+			return nil, errors.Errorf("rule %d: %v", i+1, err)
+		}
+		policies = append(policies, p)
+	}
+	return policies, nil
+}
+
+func (r forgetPolicyRule) parse() (forgetPolicy, error) {
+	p := forgetPolicy{
+		hosts: r.Hosts,
+		paths: r.Paths,
+		policy: restic.ExpirePolicy{
+			Last:    r.Last,
+			Hourly:  r.Hourly,
+			Daily:   r.Daily,
+			Weekly:  r.Weekly,
+			Monthly: r.Monthly,
+			Yearly:  r.Yearly,
+		},
+	}
+
+	for _, tags := range r.Tags {
+		_ = p.tags.Set(tags)
+	}
+	var keepTags restic.TagLists
+	for _, tags := range r.KeepTags {
+		_ = keepTags.Set(tags)
+	}
+	p.policy.Tags = keepTags
+
+	durations := []struct {
+		name  string
+		value string
+		d     *restic.Duration
+	}{
+		{"keep-within", r.Within, &p.policy.Within},
+		{"keep-within-hourly", r.WithinHourly, &p.policy.WithinHourly},
+		{"keep-within-daily", r.WithinDaily, &p.policy.WithinDaily},
+		{"keep-within-weekly", r.WithinWeekly, &p.policy.WithinWeekly},
+		{"keep-within-monthly", r.WithinMonthly, &p.policy.WithinMonthly},
+		{"keep-within-yearly", r.WithinYearly, &p.policy.WithinYearly},
+	}
+	for _, d := range durations {
+		if d.value == "" {
+			continue
+		}
+		err := d.d.Set(d.value)
+		if err != nil {
+			return forgetPolicy{}, errors.Errorf("invalid duration for %v: %v", d.name, err)
+		}
+	}
+
+	if p.policy.Empty() {
+		return forgetPolicy{}, errors.New("no keep-* option specified")
+	}
+	return p, nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestParseForgetPolicies(t *testing.T) {
+	policies, err := parseForgetPolicies(strings.NewReader(`
+rules:
+  - host: [db-server]
+    tag: ["db,daily"]
+    keep-daily: 7
+    keep-within-monthly: 1y
+  - path: [/home]
+    keep-last: 3
+    keep-tag: [important]
+`))
+	rtest.OK(t, err)
+	rtest.Equals(t, 2, len(policies))
+
+	rtest.Equals(t, []string{"db-server"}, policies[0].hosts)
+	rtest.Equals(t, restic.TagLists{restic.TagList{"db", "daily"}}, policies[0].tags)
+	rtest.Equals(t, 7, policies[0].policy.Daily)
+	rtest.Equals(t, restic.Duration{Years: 1}, policies[0].policy.WithinMonthly)
+
+	rtest.Equals(t, []string{"/home"}, policies[1].paths)
+	rtest.Equals(t, 3, policies[1].policy.Last)
+	rtest.Equals(t, []restic.TagList{{"important"}}, policies[1].policy.Tags)
+
+	sn := &restic.Snapshot{Hostname: "db-server", Tags: []string{"daily", "db"}, Paths: []string{"/var/lib/db"}}
+	rtest.Assert(t, policies[0].matches(sn), "first rule does not match %v", sn)
+	rtest.Assert(t, !policies[1].matches(sn), "second rule matches %v", sn)
+}
+
+func TestParseForgetPoliciesInvalid(t *testing.T) {
+	for _, data := range []string{
+		"",
+		"rules: []",
+		"rules:\n  - tag: [db]\n",
+		"rules:\n  - keep-dialy: 7\n",
+		"rules:\n  - keep-within: 7x\n",
+		"keep-last: 3\n",
+	} {
+		_, err := parseForgetPolicies(strings.NewReader(data))
+		rtest.Assert(t, err != nil, "expected error for policy file %q", data)
+	}
+}
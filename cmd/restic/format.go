@@ -5,9 +5,14 @@ import (
 	"os"
 
 	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/ui"
 )
 
-func formatNode(path string, n *restic.Node, long bool) string {
+// formatNode returns the line printed for n by ls and find. If long is set,
+// the line includes the mode, owner, size and modification time of the node.
+// In that case the size is formatted as a human readable string if human is
+// set, and the modification time is formatted using timeFormat.
+func formatNode(path string, n *restic.Node, long bool, human bool, timeFormat string) string {
 	if !long {
 		return path
 	}
@@ -33,8 +38,15 @@ func formatNode(path string, n *restic.Node, long bool) string {
 		mode = os.ModeSocket
 	}
 
-	return fmt.Sprintf("%s %5d %5d %6d %s %s%s",
-		mode|n.Mode, n.UID, n.GID, n.Size,
-		n.ModTime.Local().Format(TimeFormat), path,
+	var size string
+	if human {
+		size = fmt.Sprintf("%10s", ui.FormatBytes(n.Size))
+	} else {
+		size = fmt.Sprintf("%6d", n.Size)
+	}
+
+	return fmt.Sprintf("%s %5d %5d %s %s %s%s",
+		mode|n.Mode, n.UID, n.GID, size,
+		n.ModTime.Local().Format(timeFormat), path,
 		target)
 }
@@ -10,13 +10,16 @@ import (
 	"runtime"
 	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/restic/restic/internal/backend"
 	"github.com/restic/restic/internal/backend/azure"
 	"github.com/restic/restic/internal/backend/b2"
+	"github.com/restic/restic/internal/backend/dropbox"
 	"github.com/restic/restic/internal/backend/gs"
+	"github.com/restic/restic/internal/backend/ipfs"
 	"github.com/restic/restic/internal/backend/limiter"
 	"github.com/restic/restic/internal/backend/local"
 	"github.com/restic/restic/internal/backend/location"
@@ -26,6 +29,8 @@ import (
 	"github.com/restic/restic/internal/backend/s3"
 	"github.com/restic/restic/internal/backend/sftp"
 	"github.com/restic/restic/internal/backend/swift"
+	"github.com/restic/restic/internal/backend/tape"
+	"github.com/restic/restic/internal/backend/webdav"
 	"github.com/restic/restic/internal/cache"
 	"github.com/restic/restic/internal/debug"
 	"github.com/restic/restic/internal/fs"
@@ -68,6 +73,7 @@ type GlobalOptions struct {
 
 	backend.TransportOptions
 	limiter.Limits
+	Retry retry.Options
 
 	password string
 	stdout   io.Writer
@@ -120,10 +126,19 @@ func init() {
 	f.StringSliceVar(&globalOptions.RootCertFilenames, "cacert", nil, "`file` to load root certificates from (default: use system certificates)")
 	f.StringVar(&globalOptions.TLSClientCertKeyFilename, "tls-client-cert", "", "path to a `file` containing PEM encoded TLS client certificate and private key")
 	f.BoolVar(&globalOptions.InsecureTLS, "insecure-tls", false, "skip TLS certificate verification when connecting to the repository (insecure)")
+	f.StringVar(&globalOptions.Proxy, "proxy", "", "use the proxy at `url` for HTTP based backends (default: $HTTPS_PROXY or $HTTP_PROXY)")
 	f.BoolVar(&globalOptions.CleanupCache, "cleanup-cache", false, "auto remove old cache directories")
-	f.Var(&globalOptions.Compression, "compression", "compression mode (only available for repository format version 2), one of (auto|off|max)")
+	f.Var(&globalOptions.Compression, "compression", "compression mode (only available for repository format version 2), one of (auto|off|fastest|better|max)")
 	f.IntVar(&globalOptions.Limits.UploadKb, "limit-upload", 0, "limits uploads to a maximum `rate` in KiB/s. (default: unlimited)")
 	f.IntVar(&globalOptions.Limits.DownloadKb, "limit-download", 0, "limits downloads to a maximum `rate` in KiB/s. (default: unlimited)")
+	f.IntVar(&globalOptions.Limits.Requests, "limit-requests", 0, "limits backend operations to a maximum `rate` per second. (default: unlimited)")
+	defaultRetry := retry.DefaultOptions()
+	f.IntVar(&globalOptions.Retry.MaxTries, "retries", defaultRetry.MaxTries, "retry failed backend operations `n` times, overrides $RESTIC_RETRIES")
+	f.StringVar(&globalOptions.Retry.Backoff, "retry-backoff", defaultRetry.Backoff, "backoff `strategy` between retries, exponential or constant")
+	f.DurationVar(&globalOptions.Retry.InitialInterval, "retry-interval", defaultRetry.InitialInterval, "`duration` to wait before the first retry")
+	f.DurationVar(&globalOptions.Retry.MaxInterval, "retry-max-interval", defaultRetry.MaxInterval, "maximum `duration` to wait between retries")
+	f.DurationVar(&globalOptions.Retry.MaxElapsedTime, "retry-max-time", defaultRetry.MaxElapsedTime, "stop retrying an operation after `duration`, 0 retries without time limit, overrides $RESTIC_RETRY_MAX_TIME")
+	f.DurationVar(&globalOptions.Retry.RequestTimeout, "request-timeout", 0, "abort and retry a single backend request after `duration`, 0 disables the timeout (default: $RESTIC_REQUEST_TIMEOUT)")
 	f.UintVar(&globalOptions.PackSize, "pack-size", 0, "set target pack `size` in MiB, created pack files may be larger (default: $RESTIC_PACK_SIZE)")
 	f.StringSliceVarP(&globalOptions.Options, "option", "o", []string{}, "set extended option (`key=value`, can be specified multiple times)")
 	// Use our "generate" command instead of the cobra provided "completion" command
@@ -143,6 +158,17 @@ func init() {
 	targetPackSize, _ := strconv.ParseUint(os.Getenv("RESTIC_PACK_SIZE"), 10, 32)
 	globalOptions.PackSize = uint(targetPackSize)
 
+	// parse retry options from env, on error the default values will be used
+	if retries, err := strconv.Atoi(os.Getenv("RESTIC_RETRIES")); err == nil {
+		globalOptions.Retry.MaxTries = retries
+	}
+	if d, err := time.ParseDuration(os.Getenv("RESTIC_RETRY_MAX_TIME")); err == nil {
+		globalOptions.Retry.MaxElapsedTime = d
+	}
+	if d, err := time.ParseDuration(os.Getenv("RESTIC_REQUEST_TIMEOUT")); err == nil {
+		globalOptions.Retry.RequestTimeout = d
+	}
+
 	restoreTerminal()
 }
 
@@ -435,7 +461,10 @@ func OpenRepository(ctx context.Context, opts GlobalOptions) (*repository.Reposi
 	success := func(msg string, retries int) {
 		Warnf("%v operation successful after %d retries\n", msg, retries)
 	}
-	be = retry.New(be, 10, report, success)
+	if err := opts.Retry.Validate(); err != nil {
+		return nil, errors.Fatalf("invalid retry options: %v", err)
+	}
+	be = retry.NewWithOptions(be, opts.Retry, report, success)
 
 	// wrap backend if a test specified a hook
 	if opts.backendTestHook != nil {
@@ -558,6 +587,15 @@ func parseConfig(loc location.Location, opts options.Options) (interface{}, erro
 		debug.Log("opening local repository at %#v", cfg)
 		return cfg, nil
 
+	case "tape":
+		cfg := loc.Config.(tape.Config)
+		if err := opts.Apply(loc.Scheme, &cfg); err != nil {
+			return nil, err
+		}
+
+		debug.Log("opening tape repository at %#v", cfg)
+		return cfg, nil
+
 	case "sftp":
 		cfg := loc.Config.(sftp.Config)
 		if err := opts.Apply(loc.Scheme, &cfg); err != nil {
@@ -675,6 +713,60 @@ func parseConfig(loc location.Location, opts options.Options) (interface{}, erro
 
 		debug.Log("opening rest repository at %#v", cfg)
 		return cfg, nil
+	case "webdav":
+		cfg := loc.Config.(webdav.Config)
+
+		if cfg.Username == "" {
+			cfg.Username = os.Getenv("WEBDAV_USERNAME")
+		}
+
+		if cfg.Password.String() == "" {
+			cfg.Password = options.NewSecretString(os.Getenv("WEBDAV_PASSWORD"))
+		}
+
+		if err := opts.Apply(loc.Scheme, &cfg); err != nil {
+			return nil, err
+		}
+
+		debug.Log("opening webdav repository at %#v", cfg)
+		return cfg, nil
+	case "dropbox":
+		cfg := loc.Config.(dropbox.Config)
+
+		if cfg.AccessToken.String() == "" {
+			cfg.AccessToken = options.NewSecretString(os.Getenv("DROPBOX_ACCESS_TOKEN"))
+		}
+
+		if cfg.RefreshToken.String() == "" {
+			cfg.RefreshToken = options.NewSecretString(os.Getenv("DROPBOX_REFRESH_TOKEN"))
+		}
+
+		if cfg.AppKey == "" {
+			cfg.AppKey = os.Getenv("DROPBOX_APP_KEY")
+		}
+
+		if cfg.AppSecret.String() == "" {
+			cfg.AppSecret = options.NewSecretString(os.Getenv("DROPBOX_APP_SECRET"))
+		}
+
+		if cfg.AccessToken.String() == "" && cfg.RefreshToken.String() == "" {
+			return nil, errors.Fatalf("unable to open Dropbox backend: either $DROPBOX_ACCESS_TOKEN or $DROPBOX_REFRESH_TOKEN must be set")
+		}
+
+		if err := opts.Apply(loc.Scheme, &cfg); err != nil {
+			return nil, err
+		}
+
+		debug.Log("opening dropbox repository at %#v", cfg)
+		return cfg, nil
+	case "ipfs":
+		cfg := loc.Config.(ipfs.Config)
+		if err := opts.Apply(loc.Scheme, &cfg); err != nil {
+			return nil, err
+		}
+
+		debug.Log("opening ipfs repository at %#v", cfg)
+		return cfg, nil
 	case "rclone":
 		cfg := loc.Config.(rclone.Config)
 		if err := opts.Apply(loc.Scheme, &cfg); err != nil {
@@ -688,8 +780,56 @@ func parseConfig(loc location.Location, opts options.Options) (interface{}, erro
 	return nil, errors.Fatalf("invalid backend: %q", loc.Scheme)
 }
 
+// transportOptions returns the options for the HTTP transport of a backend.
+// The TLS settings in the backend config take precedence over the global
+// options.
+func transportOptions(cfg interface{}) backend.TransportOptions {
+	topts := globalOptions.TransportOptions
+
+	var caCert, clientCert, clientKey string
+	switch cfg := cfg.(type) {
+	case rest.Config:
+		caCert, clientCert, clientKey = cfg.CACert, cfg.TLSClientCert, cfg.TLSClientKey
+	case webdav.Config:
+		caCert, clientCert, clientKey = cfg.CACert, cfg.TLSClientCert, cfg.TLSClientKey
+	}
+
+	if caCert != "" {
+		topts.RootCertFilenames = []string{caCert}
+	}
+	if clientCert != "" {
+		topts.TLSClientCertKeyFilename = clientCert
+	}
+	if clientKey != "" {
+		topts.TLSClientKeyFilename = clientKey
+	}
+
+	return topts
+}
+
 // Open the backend specified by a location config.
 func open(ctx context.Context, s string, gopts GlobalOptions, opts options.Options) (restic.Backend, error) {
+	be, err := openBackend(ctx, s, gopts, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// check if config is there
+	fi, err := be.Stat(ctx, restic.Handle{Type: restic.ConfigFile})
+	if err != nil {
+		return nil, errors.Fatalf("unable to open config file: %v\nIs there a repository at the following location?\n%v", err, location.StripPassword(s))
+	}
+
+	if fi.Size == 0 {
+		return nil, errors.New("config file has zero size, invalid repository?")
+	}
+
+	return be, nil
+}
+
+// openBackend opens the backend specified by a location config, without
+// checking that it contains a repository.
+func openBackend(ctx context.Context, s string, gopts GlobalOptions, opts options.Options) (restic.Backend, error) {
 	debug.Log("parsing location %v", location.StripPassword(s))
 	loc, err := location.Parse(s)
 	if err != nil {
@@ -703,18 +843,20 @@ func open(ctx context.Context, s string, gopts GlobalOptions, opts options.Optio
 		return nil, err
 	}
 
-	rt, err := backend.Transport(globalOptions.TransportOptions)
+	rt, err := backend.Transport(transportOptions(cfg))
 	if err != nil {
 		return nil, err
 	}
 
 	// wrap the transport so that the throughput via HTTP is limited
-	lim := limiter.NewStaticLimiter(gopts.Limits)
+	lim := sharedLimiter(gopts.Limits)
 	rt = lim.Transport(rt)
 
 	switch loc.Scheme {
 	case "local":
 		be, err = local.Open(ctx, cfg.(local.Config))
+	case "tape":
+		be, err = tape.Open(ctx, cfg.(tape.Config))
 	case "sftp":
 		be, err = sftp.Open(ctx, cfg.(sftp.Config))
 	case "s3":
@@ -729,6 +871,12 @@ func open(ctx context.Context, s string, gopts GlobalOptions, opts options.Optio
 		be, err = b2.Open(ctx, cfg.(b2.Config), rt)
 	case "rest":
 		be, err = rest.Open(cfg.(rest.Config), rt)
+	case "webdav":
+		be, err = webdav.Open(cfg.(webdav.Config), rt)
+	case "ipfs":
+		be, err = ipfs.Open(cfg.(ipfs.Config), rt)
+	case "dropbox":
+		be, err = dropbox.Open(ctx, cfg.(dropbox.Config), rt)
 	case "rclone":
 		be, err = rclone.Open(cfg.(rclone.Config), lim)
 
@@ -748,26 +896,19 @@ func open(ctx context.Context, s string, gopts GlobalOptions, opts options.Optio
 		}
 	}
 
-	if loc.Scheme == "local" || loc.Scheme == "sftp" {
+	if loc.Scheme == "local" || loc.Scheme == "sftp" || loc.Scheme == "tape" {
 		// wrap the backend in a LimitBackend so that the throughput is limited
 		be = limiter.LimitBackend(be, lim)
 	}
-
-	// check if config is there
-	fi, err := be.Stat(ctx, restic.Handle{Type: restic.ConfigFile})
-	if err != nil {
-		return nil, errors.Fatalf("unable to open config file: %v\nIs there a repository at the following location?\n%v", err, location.StripPassword(s))
-	}
-
-	if fi.Size == 0 {
-		return nil, errors.New("config file has zero size, invalid repository?")
+	if gopts.Limits.Requests > 0 {
+		be = limiter.LimitRequests(be, lim)
 	}
 
 	return be, nil
 }
 
 // Create the backend specified by URI.
-func create(ctx context.Context, s string, opts options.Options) (restic.Backend, error) {
+func create(ctx context.Context, s string, gopts GlobalOptions, opts options.Options) (restic.Backend, error) {
 	debug.Log("parsing location %v", s)
 	loc, err := location.Parse(s)
 	if err != nil {
@@ -779,32 +920,81 @@ func create(ctx context.Context, s string, opts options.Options) (restic.Backend
 		return nil, err
 	}
 
-	rt, err := backend.Transport(globalOptions.TransportOptions)
+	rt, err := backend.Transport(transportOptions(cfg))
 	if err != nil {
 		return nil, err
 	}
 
+	// wrap the transport so that the throughput via HTTP is limited
+	lim := sharedLimiter(gopts.Limits)
+	rt = lim.Transport(rt)
+
+	var be restic.Backend
 	switch loc.Scheme {
 	case "local":
-		return local.Create(ctx, cfg.(local.Config))
+		be, err = local.Create(ctx, cfg.(local.Config))
+	case "tape":
+		be, err = tape.Create(ctx, cfg.(tape.Config))
 	case "sftp":
-		return sftp.Create(ctx, cfg.(sftp.Config))
+		be, err = sftp.Create(ctx, cfg.(sftp.Config))
 	case "s3":
-		return s3.Create(ctx, cfg.(s3.Config), rt)
+		be, err = s3.Create(ctx, cfg.(s3.Config), rt)
 	case "gs":
-		return gs.Create(cfg.(gs.Config), rt)
+		be, err = gs.Create(cfg.(gs.Config), rt)
 	case "azure":
-		return azure.Create(ctx, cfg.(azure.Config), rt)
+		be, err = azure.Create(ctx, cfg.(azure.Config), rt)
 	case "swift":
-		return swift.Open(ctx, cfg.(swift.Config), rt)
+		be, err = swift.Open(ctx, cfg.(swift.Config), rt)
 	case "b2":
-		return b2.Create(ctx, cfg.(b2.Config), rt)
+		be, err = b2.Create(ctx, cfg.(b2.Config), rt)
 	case "rest":
-		return rest.Create(ctx, cfg.(rest.Config), rt)
+		be, err = rest.Create(ctx, cfg.(rest.Config), rt)
+	case "webdav":
+		be, err = webdav.Create(ctx, cfg.(webdav.Config), rt)
+	case "ipfs":
+		be, err = ipfs.Create(ctx, cfg.(ipfs.Config), rt)
+	case "dropbox":
+		be, err = dropbox.Create(ctx, cfg.(dropbox.Config), rt)
 	case "rclone":
-		return rclone.Create(ctx, cfg.(rclone.Config))
+		be, err = rclone.Create(ctx, cfg.(rclone.Config), lim)
+	default:
+		debug.Log("invalid repository scheme: %v", s)
+		return nil, errors.Fatalf("invalid scheme %q", loc.Scheme)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if loc.Scheme == "local" || loc.Scheme == "sftp" || loc.Scheme == "tape" {
+		// wrap the backend in a LimitBackend so that the throughput is limited
+		be = limiter.LimitBackend(be, lim)
 	}
+	if gopts.Limits.Requests > 0 {
+		be = limiter.LimitRequests(be, lim)
+	}
+
+	return be, nil
+}
 
-	debug.Log("invalid repository scheme: %v", s)
-	return nil, errors.Fatalf("invalid scheme %q", loc.Scheme)
+// limiters contains the limiter for each combination of limits, see
+// sharedLimiter.
+var limiters = struct {
+	sync.Mutex
+	m map[limiter.Limits]limiter.Limiter
+}{m: make(map[limiter.Limits]limiter.Limiter)}
+
+// sharedLimiter returns the limiter for the limits l. All backends opened
+// with the same limits share the limiter, such that e.g. the copy command
+// stays within the configured bandwidth for both repositories together.
+func sharedLimiter(l limiter.Limits) limiter.Limiter {
+	limiters.Lock()
+	defer limiters.Unlock()
+
+	lim, ok := limiters.m[l]
+	if !ok {
+		lim = limiter.NewStaticLimiter(l)
+		limiters.m[l] = lim
+	}
+	return lim
 }
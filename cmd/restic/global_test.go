@@ -6,6 +6,7 @@ import (
 	"path/filepath"
 	"testing"
 
+	"github.com/restic/restic/internal/backend/limiter"
 	"github.com/restic/restic/internal/test"
 	rtest "github.com/restic/restic/internal/test"
 )
@@ -58,3 +59,10 @@ func TestReadRepo(t *testing.T) {
 		t.Fatal("must not read repository path from invalid file path")
 	}
 }
+
+func TestSharedLimiter(t *testing.T) {
+	l := limiter.Limits{UploadKb: 100, DownloadKb: 200}
+	lim := sharedLimiter(l)
+	rtest.Assert(t, lim == sharedLimiter(l), "limiter is not shared for identical limits")
+	rtest.Assert(t, lim != sharedLimiter(limiter.Limits{UploadKb: 100}), "limiter is shared for different limits")
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/ui/backup"
+)
+
+// Values of RESTIC_BACKUP_STATUS passed to the backup hook commands.
+const (
+	backupStatusPending = "pending"
+	backupStatusSuccess = "success"
+	backupStatusPartial = "partial"
+	backupStatusFailure = "failure"
+)
+
+// backupHookResult collects the information about a backup run which is
+// exposed to the hook commands via environment variables.
+type backupHookResult struct {
+	status     string
+	snapshotID *restic.ID
+	summary    *backup.Summary
+	err        error
+}
+
+// environ returns the environment of the current process extended by the
+// variables describing the backup result.
+func (r backupHookResult) environ() []string {
+	env := append(os.Environ(), "RESTIC_BACKUP_STATUS="+r.status)
+
+	if r.snapshotID != nil {
+		env = append(env, "RESTIC_SNAPSHOT_ID="+r.snapshotID.String())
+	}
+	if r.err != nil {
+		env = append(env, "RESTIC_BACKUP_ERROR="+r.err.Error())
+	}
+
+	if s := r.summary; s != nil {
+		for _, v := range []struct {
+			name  string
+			value uint64
+		}{
+			{"FILES_NEW", uint64(s.Files.New)},
+			{"FILES_CHANGED", uint64(s.Files.Changed)},
+			{"FILES_UNMODIFIED", uint64(s.Files.Unchanged)},
+			{"DIRS_NEW", uint64(s.Dirs.New)},
+			{"DIRS_CHANGED", uint64(s.Dirs.Changed)},
+			{"DIRS_UNMODIFIED", uint64(s.Dirs.Unchanged)},
+			{"DATA_ADDED", s.DataSize + s.TreeSize},
+			{"DATA_ADDED_PACKED", s.DataSizeInRepo + s.TreeSizeInRepo},
+			{"BYTES_PROCESSED", s.ProcessedBytes},
+		} {
+			env = append(env, fmt.Sprintf("RESTIC_%s=%d", v.name, v.value))
+		}
+	}
+
+	return env
+}
+
+// runHookCommand runs command using the shell of the operating system. The
+// output of the command is written to out.
+func runHookCommand(name, command string, env []string, out io.Writer) error {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", command)
+	} else {
+		cmd = exec.Command("sh", "-c", command)
+	}
+	cmd.Env = env
+	cmd.Stdout = out
+	cmd.Stderr = out
+
+	debug.Log("running %v: %q", name, command)
+	if err := cmd.Run(); err != nil {
+		return errors.Errorf("%v %q failed: %v", name, command, err)
+	}
+	return nil
+}
@@ -58,7 +58,7 @@ func waitForMount(t testing.TB, dir string) {
 func testRunMount(t testing.TB, gopts GlobalOptions, dir string, wg *sync.WaitGroup) {
 	defer wg.Done()
 	opts := MountOptions{
-		TimeTemplate: time.RFC3339,
+		snapshotDirsOptions: snapshotDirsOptions{TimeTemplate: time.RFC3339},
 	}
 	rtest.OK(t, runMount(context.TODO(), opts, gopts, []string{dir}))
 }
@@ -10,15 +10,19 @@ import (
 	"io"
 	mrand "math/rand"
 	"os"
+	"path"
 	"path/filepath"
 	"regexp"
 	"runtime"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"testing"
 	"time"
 
+	"github.com/cenkalti/backoff/v4"
+	"github.com/restic/restic/internal/archiver"
 	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/filter"
 	"github.com/restic/restic/internal/fs"
@@ -112,7 +116,7 @@ func testRunRestoreLatest(t testing.TB, gopts GlobalOptions, dir string, paths [
 		},
 	}
 
-	rtest.OK(t, runRestore(context.TODO(), opts, gopts, []string{"latest"}))
+	rtest.OK(t, runRestore(context.TODO(), opts, gopts, nil, []string{"latest"}))
 }
 
 func testRunRestoreExcludes(t testing.TB, gopts GlobalOptions, dir string, snapshotID restic.ID, excludes []string) {
@@ -121,7 +125,7 @@ func testRunRestoreExcludes(t testing.TB, gopts GlobalOptions, dir string, snaps
 		Exclude: excludes,
 	}
 
-	rtest.OK(t, runRestore(context.TODO(), opts, gopts, []string{snapshotID.String()}))
+	rtest.OK(t, runRestore(context.TODO(), opts, gopts, nil, []string{snapshotID.String()}))
 }
 
 func testRunRestoreIncludes(t testing.TB, gopts GlobalOptions, dir string, snapshotID restic.ID, includes []string) {
@@ -130,11 +134,11 @@ func testRunRestoreIncludes(t testing.TB, gopts GlobalOptions, dir string, snaps
 		Include: includes,
 	}
 
-	rtest.OK(t, runRestore(context.TODO(), opts, gopts, []string{snapshotID.String()}))
+	rtest.OK(t, runRestore(context.TODO(), opts, gopts, nil, []string{snapshotID.String()}))
 }
 
 func testRunRestoreAssumeFailure(t testing.TB, snapshotID string, opts RestoreOptions, gopts GlobalOptions) error {
-	err := runRestore(context.TODO(), opts, gopts, []string{snapshotID})
+	err := runRestore(context.TODO(), opts, gopts, nil, []string{snapshotID})
 
 	return err
 }
@@ -187,10 +191,14 @@ func testRunRebuildIndex(t testing.TB, gopts GlobalOptions) {
 		globalOptions.stdout = os.Stdout
 	}()
 
-	rtest.OK(t, runRebuildIndex(context.TODO(), RebuildIndexOptions{}, gopts))
+	rtest.OK(t, runRebuildIndex(context.TODO(), RepairIndexOptions{}, gopts))
 }
 
 func testRunLs(t testing.TB, gopts GlobalOptions, snapshotID string) []string {
+	return testRunLsWithOpts(t, gopts, LsOptions{}, []string{snapshotID})
+}
+
+func testRunLsWithOpts(t testing.TB, gopts GlobalOptions, opts LsOptions, args []string) []string {
 	buf := bytes.NewBuffer(nil)
 	globalOptions.stdout = buf
 	quiet := globalOptions.Quiet
@@ -200,9 +208,7 @@ func testRunLs(t testing.TB, gopts GlobalOptions, snapshotID string) []string {
 		globalOptions.Quiet = quiet
 	}()
 
-	opts := LsOptions{}
-
-	rtest.OK(t, runLs(context.TODO(), opts, gopts, []string{snapshotID}))
+	rtest.OK(t, runLs(context.TODO(), opts, gopts, args))
 
 	return strings.Split(buf.String(), "\n")
 }
@@ -413,6 +419,77 @@ func TestDryRunBackup(t *testing.T) {
 	rtest.Equals(t, indexIDs, indexIDsAfter)
 }
 
+func TestBackupResumeRelativeTargets(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+	for i := 0; i < 200; i++ {
+		dir := filepath.Join(env.testdata, fmt.Sprintf("dir%03d", i))
+		rtest.OK(t, os.MkdirAll(dir, 0755))
+		rtest.OK(t, os.WriteFile(filepath.Join(dir, "file"), rtest.Random(i, 200*1024), 0644))
+	}
+
+	defer func(interval time.Duration) {
+		resumeCheckpointInterval = interval
+	}(resumeCheckpointInterval)
+	resumeCheckpointInterval = time.Millisecond
+
+	opts := BackupOptions{Host: "example"}
+	targets := []string{"testdata"}
+	restore := rtest.Chdir(t, env.base)
+	defer restore()
+
+	// interrupt the backup once a checkpoint with completed dirs has been saved
+	stateFiles := filepath.Join(env.cache, "*", "state", "backup", "*.json")
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	go func() {
+		for ctx.Err() == nil {
+			files, _ := filepath.Glob(stateFiles)
+			for _, file := range files {
+				var state archiver.ResumeState
+				buf, err := os.ReadFile(file)
+				if err == nil && json.Unmarshal(buf, &state) == nil && len(state.Nodes) > 0 {
+					cancel()
+					return
+				}
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}()
+	termCtx, termCancel := context.WithCancel(context.TODO())
+	term := termstatus.New(io.Discard, io.Discard, true)
+	go term.Run(termCtx)
+	gopts := env.gopts
+	gopts.stdout = io.Discard
+	err := runBackup(ctx, opts, gopts, term, targets)
+	termCancel()
+	rtest.Assert(t, err != nil, "interrupted backup did not fail")
+	rtest.Equals(t, 0, len(testRunList(t, "snapshots", env.gopts)))
+
+	repo, err := OpenRepository(context.TODO(), env.gopts)
+	rtest.OK(t, err)
+	rtest.OK(t, repo.LoadIndex(context.TODO()))
+	filename, _, err := loadResumeState(context.TODO(), repo, opts, targets)
+	rtest.OK(t, err)
+	// the data of the interrupted backup was not uploaded, thus check the
+	// state before incomplete dirs are removed
+	absTargets, err := resumeTargets(targets)
+	rtest.OK(t, err)
+	state, err := archiver.LoadResumeState(filename, opts.Host, absTargets)
+	rtest.OK(t, err)
+	rtest.Assert(t, state != nil && state.Len() > 0, "state of the interrupted backup was not found")
+
+	// the resumed backup removes the state
+	testRunBackup(t, "", targets, opts, env.gopts)
+	rtest.Equals(t, 1, len(testRunList(t, "snapshots", env.gopts)))
+	files, err := filepath.Glob(stateFiles)
+	rtest.OK(t, err)
+	rtest.Equals(t, 0, len(files))
+	testRunCheck(t, env.gopts)
+}
+
 func TestBackupNonExistingFile(t *testing.T) {
 	env, cleanup := withTestEnvironment(t)
 	defer cleanup()
@@ -623,6 +700,121 @@ func TestBackupExclude(t *testing.T) {
 		"expected file %q not in first snapshot, but it's included", "passwords.txt")
 }
 
+func TestLsFilter(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+
+	datadir := filepath.Join(env.base, "testdata")
+	for _, filename := range backupExcludeFilenames {
+		fp := filepath.Join(datadir, filename)
+		rtest.OK(t, os.MkdirAll(filepath.Dir(fp), 0755))
+		rtest.OK(t, os.WriteFile(fp, []byte(filename), 0644))
+	}
+
+	testRunBackup(t, filepath.Dir(env.testdata), []string{"testdata"}, BackupOptions{}, env.gopts)
+	snapshotID := testRunList(t, "snapshots", env.gopts)[0].String()
+
+	files := testRunLsWithOpts(t, env.gopts, LsOptions{Exclude: []string{"*.tar.gz", "private"}}, []string{snapshotID})
+	rtest.Assert(t, !includes(files, "/testdata/foo.tar.gz"), "excluded file %q listed", "foo.tar.gz")
+	rtest.Assert(t, !includes(files, "/testdata/private"), "excluded dir %q listed", "private")
+	rtest.Assert(t, !includes(files, "/testdata/private/secret/passwords.txt"), "file %q in excluded dir listed", "passwords.txt")
+	rtest.Assert(t, includes(files, "/testdata/work/source/test.c"), "expected file %q not listed", "test.c")
+
+	files = testRunLsWithOpts(t, env.gopts, LsOptions{InsensitiveInclude: []string{"*.C"}}, []string{snapshotID})
+	rtest.Assert(t, includes(files, "/testdata/work/source/test.c"), "expected file %q not listed", "test.c")
+	rtest.Assert(t, !includes(files, "/testdata/testfile1"), "file %q not matching include listed", "testfile1")
+	rtest.Assert(t, !includes(files, "/testdata/work"), "dir %q not matching include listed", "work")
+
+	files = testRunLsWithOpts(t, env.gopts, LsOptions{MaxDepth: 2}, []string{snapshotID})
+	rtest.Assert(t, includes(files, "/testdata/testfile1"), "expected file %q not listed", "testfile1")
+	rtest.Assert(t, includes(files, "/testdata/work"), "expected dir %q not listed", "work")
+	rtest.Assert(t, !includes(files, "/testdata/work/source"), "dir %q below max depth listed", "source")
+
+	files = testRunLsWithOpts(t, env.gopts, LsOptions{DirsOnly: true}, []string{snapshotID})
+	rtest.Assert(t, includes(files, "/testdata/work/source"), "expected dir %q not listed", "source")
+	rtest.Assert(t, !includes(files, "/testdata/testfile1"), "file %q listed with --dirs-only", "testfile1")
+
+	files = testRunLsWithOpts(t, env.gopts, LsOptions{Print0: true, MaxDepth: 1}, []string{snapshotID})
+	rtest.Equals(t, []string{"/testdata\x00"}, files)
+}
+
+func TestLsBlobs(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+
+	datadir := filepath.Join(env.base, "testdata")
+	rtest.OK(t, os.MkdirAll(datadir, 0755))
+	rtest.OK(t, os.WriteFile(filepath.Join(datadir, "file"), []byte("content"), 0644))
+
+	testRunBackup(t, env.base, []string{"testdata"}, BackupOptions{}, env.gopts)
+	snapshotID := testRunList(t, "snapshots", env.gopts)[0].String()
+	packs := testRunList(t, "packs", env.gopts)
+
+	files := testRunLsWithOpts(t, env.gopts, LsOptions{ShowBlobs: true}, []string{snapshotID})
+	rtest.Assert(t, includes(files, "/testdata/file"), "file missing from listing: %v", files)
+
+	var blobLines []string
+	for _, line := range files {
+		if strings.HasPrefix(line, "    blob ") {
+			blobLines = append(blobLines, line)
+		}
+	}
+	rtest.Equals(t, 1, len(blobLines))
+
+	found := false
+	for _, id := range packs {
+		found = found || strings.HasSuffix(blobLines[0], " in pack "+id.String())
+	}
+	rtest.Assert(t, found, "blob line %q does not reference any of the packs %v", blobLines[0], packs)
+}
+
+func testRunVersions(t testing.TB, gopts GlobalOptions, opts VersionsOptions, p string) []fileVersion {
+	buf := bytes.NewBuffer(nil)
+	gopts.stdout = buf
+	gopts.JSON = true
+
+	rtest.OK(t, runVersions(context.TODO(), opts, gopts, []string{p}))
+
+	var versions []fileVersion
+	rtest.OK(t, json.Unmarshal(buf.Bytes(), &versions))
+	return versions
+}
+
+func TestVersions(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+
+	datadir := filepath.Join(env.base, "testdata")
+	rtest.OK(t, os.MkdirAll(datadir, 0755))
+	fp := filepath.Join(datadir, "file")
+	rtest.OK(t, os.WriteFile(fp, []byte("first"), 0644))
+
+	testRunBackup(t, env.base, []string{"testdata"}, BackupOptions{}, env.gopts)
+	testRunBackup(t, env.base, []string{"testdata"}, BackupOptions{}, env.gopts)
+
+	rtest.OK(t, os.WriteFile(fp, []byte("second version"), 0644))
+	mtime := time.Now().Add(time.Hour)
+	rtest.OK(t, os.Chtimes(fp, mtime, mtime))
+	testRunBackup(t, env.base, []string{"testdata"}, BackupOptions{}, env.gopts)
+
+	versions := testRunVersions(t, env.gopts, VersionsOptions{}, "/testdata/file")
+	rtest.Equals(t, 2, len(versions))
+	rtest.Equals(t, uint64(5), versions[0].Size)
+	rtest.Equals(t, uint64(14), versions[1].Size)
+
+	versions = testRunVersions(t, env.gopts, VersionsOptions{All: true}, "/testdata/file")
+	rtest.Equals(t, 3, len(versions))
+
+	versions = testRunVersions(t, env.gopts, VersionsOptions{}, "/testdata/missing")
+	rtest.Equals(t, 0, len(versions))
+}
+
 func TestBackupErrors(t *testing.T) {
 	if runtime.GOOS == "windows" {
 		return
@@ -715,6 +907,56 @@ func TestIncrementalBackup(t *testing.T) {
 	t.Logf("repository grown by %d bytes", stat3.size-stat2.size)
 }
 
+func TestBackupHooks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("hook commands are run using sh")
+	}
+
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+
+	pre := filepath.Join(env.base, "pre")
+	post := filepath.Join(env.base, "post")
+	result := filepath.Join(env.base, "result")
+	report := `echo "$RESTIC_BACKUP_STATUS $RESTIC_SNAPSHOT_ID" > `
+
+	opts := BackupOptions{
+		PreCommand:         report + pre,
+		PostCommand:        report + post,
+		PostSuccessCommand: report + result,
+		PostFailureCommand: "echo failed >" + result,
+	}
+	testRunBackup(t, filepath.Dir(env.testdata), []string{"testdata"}, opts, env.gopts)
+	snapshotIDs := testRunList(t, "snapshots", env.gopts)
+	rtest.Assert(t, len(snapshotIDs) == 1, "expected one snapshot, got %v", snapshotIDs)
+
+	for filename, want := range map[string]string{
+		pre:    "pending \n",
+		post:   "success " + snapshotIDs[0].String() + "\n",
+		result: "success " + snapshotIDs[0].String() + "\n",
+	} {
+		buf, err := os.ReadFile(filename)
+		rtest.OK(t, err)
+		rtest.Equals(t, want, string(buf))
+	}
+
+	// a failing pre-command aborts the backup
+	opts.PreCommand = "exit 1"
+	err := testRunBackupAssumeFailure(t, filepath.Dir(env.testdata), []string{"testdata"}, opts, env.gopts)
+	rtest.Assert(t, err != nil, "backup with failing pre-command did not fail")
+	snapshotIDs = testRunList(t, "snapshots", env.gopts)
+	rtest.Assert(t, len(snapshotIDs) == 1, "expected one snapshot, got %v", snapshotIDs)
+
+	buf, err := os.ReadFile(result)
+	rtest.OK(t, err)
+	rtest.Equals(t, "failed\n", string(buf))
+	buf, err = os.ReadFile(post)
+	rtest.OK(t, err)
+	rtest.Equals(t, "failure \n", string(buf))
+}
+
 func TestBackupTags(t *testing.T) {
 	env, cleanup := withTestEnvironment(t)
 	defer cleanup()
@@ -750,6 +992,25 @@ func TestBackupTags(t *testing.T) {
 		"expected parent to be %v, got %v", parent.ID, newest.Parent)
 }
 
+func TestBackupTagTemplateHostname(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		t.Skipf("unable to get hostname: %v", err)
+	}
+
+	// without --host, the hostname of the system is used
+	testSetupBackupData(t, env)
+	opts := BackupOptions{}
+	rtest.OK(t, tagTemplateLists{&opts.Tags}.Set("host-{{.Hostname}}"))
+	testRunBackup(t, "", []string{env.testdata}, opts, env.gopts)
+	newest, _ := testRunSnapshots(t, env.gopts)
+	rtest.Assert(t, newest != nil, "expected a backup, got nil")
+	rtest.Equals(t, []string{"host-" + hostname}, newest.Tags)
+}
+
 func testRunCopy(t testing.TB, srcGopts GlobalOptions, dstGopts GlobalOptions) {
 	gopts := srcGopts
 	gopts.Repo = dstGopts.Repo
@@ -919,6 +1180,51 @@ func TestInitCopyChunkerParams(t *testing.T) {
 		otherRepo.Config().ChunkerPolynomial)
 }
 
+func TestInitChunkerSizes(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	repository.TestUseLowSecurityKDFParameters(t)
+	restic.TestDisableCheckPolynomial(t)
+	restic.TestSetLockTimeout(t, 0)
+
+	initOpts := InitOptions{ChunkAvgSize: "100k"}
+	rtest.Assert(t, runInit(context.TODO(), initOpts, env.gopts, nil) != nil, "expected invalid average size to fail")
+
+	initOpts = InitOptions{RepositoryVersion: "2", ChunkAvgSize: "2M"}
+	rtest.Assert(t, runInit(context.TODO(), initOpts, env.gopts, nil) != nil, "expected chunk sizes to fail for repository version 2")
+
+	// the repository version is not raised automatically
+	for _, version := range []string{"stable", "latest"} {
+		initOpts = InitOptions{RepositoryVersion: version, ChunkAvgSize: "2M"}
+		rtest.Assert(t, runInit(context.TODO(), initOpts, env.gopts, nil) != nil, "expected chunk sizes to fail for repository version %v", version)
+	}
+
+	initOpts = InitOptions{RepositoryVersion: "3", ChunkMinSize: "64k", ChunkMaxSize: "256k", ChunkAvgSize: "128k"}
+	rtest.OK(t, runInit(context.TODO(), initOpts, env.gopts, nil))
+
+	rtest.OK(t, os.MkdirAll(env.testdata, 0755))
+	rtest.OK(t, os.WriteFile(filepath.Join(env.testdata, "file"), rtest.Random(23, 4*1024*1024), 0644))
+	testRunBackup(t, "", []string{env.testdata}, BackupOptions{}, env.gopts)
+	testRunCheck(t, env.gopts)
+
+	repo, err := OpenRepository(context.TODO(), env.gopts)
+	rtest.OK(t, err)
+	rtest.Equals(t, restic.ChunkerSizes{MinSize: 64 * 1024, MaxSize: 256 * 1024, AverageBits: 17}, repo.Config().ChunkerSizes)
+	rtest.Equals(t, uint(restic.ChunkerSizesRepoVersion), repo.Config().Version)
+
+	rtest.OK(t, repo.LoadIndex(context.TODO()))
+	dataBlobs := 0
+	repo.Index().Each(context.TODO(), func(pb restic.PackedBlob) {
+		if pb.Type != restic.DataBlob {
+			return
+		}
+		dataBlobs++
+		rtest.Assert(t, pb.DataLength() <= 256*1024, "blob %v is larger than the maximum chunk size: %v", pb.ID.Str(), pb.DataLength())
+	})
+	rtest.Assert(t, dataBlobs >= 16, "expected at least 16 data blobs, got %v", dataBlobs)
+}
+
 func testRunTag(t testing.TB, opts TagOptions, gopts GlobalOptions) {
 	rtest.OK(t, runTag(context.TODO(), opts, gopts, []string{}))
 }
@@ -1395,6 +1701,117 @@ func TestFind(t *testing.T) {
 	rtest.Assert(t, len(lines) == 4, "expected three files found in repo (%v)", datafile)
 }
 
+func TestFindRegex(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	testRunBackup(t, "", []string{env.testdata}, BackupOptions{}, env.gopts)
+
+	runFindRegex := func(opts FindOptions, pattern string) []string {
+		buf := bytes.NewBuffer(nil)
+		globalOptions.stdout = buf
+		defer func() {
+			globalOptions.stdout = os.Stdout
+		}()
+
+		opts.Regex = true
+		rtest.OK(t, runFind(context.TODO(), opts, env.gopts, []string{pattern}))
+		return strings.Fields(buf.String())
+	}
+
+	lines := runFindRegex(FindOptions{}, "/testfile[^/]*$")
+	rtest.Assert(t, len(lines) == 3, "expected three files, got %v", lines)
+
+	lines = runFindRegex(FindOptions{}, "/TESTFILE$")
+	rtest.Assert(t, len(lines) == 0, "expected no match, got %v", lines)
+
+	lines = runFindRegex(FindOptions{CaseInsensitive: true}, "/TESTFILE$")
+	rtest.Assert(t, len(lines) == 1, "expected one file, got %v", lines)
+
+	err := runFind(context.TODO(), FindOptions{Regex: true}, env.gopts, []string{"("})
+	rtest.Assert(t, err != nil, "missing error for invalid regular expression")
+}
+
+func TestFindDuplicates(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	testRunBackup(t, "", []string{env.testdata}, BackupOptions{}, env.gopts)
+	testRunBackup(t, "", []string{env.testdata}, BackupOptions{}, env.gopts)
+
+	buf := bytes.NewBuffer(nil)
+	globalOptions.stdout = buf
+	globalOptions.JSON = true
+	defer func() {
+		globalOptions.stdout = os.Stdout
+		globalOptions.JSON = false
+	}()
+
+	rtest.OK(t, runFind(context.TODO(), FindOptions{Duplicates: true}, env.gopts, []string{"testfile*"}))
+
+	var groups []duplicateFiles
+	rtest.OK(t, json.Unmarshal(buf.Bytes(), &groups))
+	rtest.Equals(t, 1, len(groups))
+
+	var names []string
+	for _, m := range groups[0].Matches {
+		names = append(names, filepath.Base(m.Path))
+	}
+	// the second snapshot must not list the same paths again
+	rtest.Equals(t, []string{"testfile", "testfile-hardlink"}, names)
+}
+
+func TestStatsByDir(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	testRunBackup(t, "", []string{env.testdata}, BackupOptions{}, env.gopts)
+
+	// use the path of the directory in the snapshot, which differs from the
+	// local path e.g. by the volume name on Windows
+	var dir string
+	for _, p := range testRunLs(t, env.gopts, "latest") {
+		if path.Base(p) == "0" && (dir == "" || len(p) < len(dir)) {
+			dir = p
+		}
+	}
+	rtest.Assert(t, dir != "", "directory 0 not found in snapshot")
+
+	buf := bytes.NewBuffer(nil)
+	globalOptions.stdout = buf
+	globalOptions.JSON = true
+	statsOptions = StatsOptions{countMode: countModeRestoreSize, byDir: true}
+	defer func() {
+		globalOptions.stdout = os.Stdout
+		globalOptions.JSON = false
+		statsOptions = StatsOptions{countMode: countModeRestoreSize}
+	}()
+
+	rtest.OK(t, runStats(context.TODO(), globalOptions, []string{"latest", dir}))
+
+	var result struct {
+		Total statsDir
+		Dirs  []statsDir
+	}
+	rtest.OK(t, json.Unmarshal(buf.Bytes(), &result))
+	rtest.Equals(t, dir, result.Total.Path)
+	rtest.Assert(t, len(result.Dirs) > 0, "no subdirectories reported")
+
+	var files, size uint64
+	for _, d := range result.Dirs {
+		rtest.Assert(t, path.Dir(d.Path) == dir, "%v is not a subdirectory of %v", d.Path, dir)
+		files += d.FileCount
+		size += d.RestoreSize
+	}
+	rtest.Assert(t, files <= result.Total.FileCount, "subdirectories contain more files than the total")
+	rtest.Assert(t, size <= result.Total.RestoreSize, "subdirectories are larger than the total")
+	// there is only a single snapshot, so all data is unique to it
+	rtest.Assert(t, result.Total.UniqueSize > 0, "no unique data found")
+}
+
 type testMatch struct {
 	Path        string    `json:"path,omitempty"`
 	Permissions string    `json:"permissions,omitempty"`
@@ -1454,8 +1871,8 @@ func testRebuildIndex(t *testing.T, backendTestHook backendWrapper) {
 		t.Fatalf("expected no error from checker for test repository, got %v", err)
 	}
 
-	if !strings.Contains(out, "restic rebuild-index") {
-		t.Fatalf("did not find hint for rebuild-index command")
+	if !strings.Contains(out, "restic repair index") {
+		t.Fatalf("did not find hint for repair index command")
 	}
 
 	env.gopts.backendTestHook = backendTestHook
@@ -1468,7 +1885,7 @@ func testRebuildIndex(t *testing.T, backendTestHook backendWrapper) {
 	}
 
 	if err != nil {
-		t.Fatalf("expected no error from checker after rebuild-index, got: %v", err)
+		t.Fatalf("expected no error from checker after repair index, got: %v", err)
 	}
 }
 
@@ -1549,13 +1966,320 @@ func TestRebuildIndexFailsOnAppendOnly(t *testing.T) {
 	env.gopts.backendTestHook = func(r restic.Backend) (restic.Backend, error) {
 		return &appendOnlyBackend{r}, nil
 	}
-	err := runRebuildIndex(context.TODO(), RebuildIndexOptions{}, env.gopts)
+	err := runRebuildIndex(context.TODO(), RepairIndexOptions{}, env.gopts)
 	if err == nil {
 		t.Error("expected rebuildIndex to fail")
 	}
 	t.Log(err)
 }
 
+func testRunRepairSnapshots(t testing.TB, gopts GlobalOptions, forget bool) {
+	globalOptions.stdout = io.Discard
+	defer func() {
+		globalOptions.stdout = os.Stdout
+	}()
+
+	opts := RepairOptions{
+		Forget: forget,
+	}
+
+	rtest.OK(t, runRepairSnapshots(context.TODO(), gopts, opts, nil))
+}
+
+func TestRepairSnapshotsWithLostData(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	testRunBackup(t, "", []string{filepath.Join(env.testdata, "0", "0", "9")}, BackupOptions{}, env.gopts)
+	testRunBackup(t, "", []string{filepath.Join(env.testdata, "0", "0", "9")}, BackupOptions{}, env.gopts)
+
+	// remove all data packs, only the trees remain
+	removePacksExcept(env.gopts, t, restic.NewIDSet(), false)
+	testRunRebuildIndex(t, env.gopts)
+
+	_, err := testRunCheckOutput(env.gopts)
+	rtest.Assert(t, err != nil, "expected check to fail after removing data")
+
+	testRunRepairSnapshots(t, env.gopts, false)
+	rtest.Equals(t, 4, len(testRunList(t, "snapshots", env.gopts)))
+
+	_, snapmap := testRunSnapshots(t, env.gopts)
+	var repaired, damaged []string
+	for id, sn := range snapmap {
+		if sn.HasTags([]string{"repaired"}) {
+			repaired = append(repaired, id.String())
+			rtest.Assert(t, sn.Original != nil, "repaired snapshot %v has no original", id)
+		} else {
+			damaged = append(damaged, id.String())
+		}
+	}
+	rtest.Equals(t, 2, len(repaired))
+
+	// the repaired snapshots must not be modified again
+	globalOptions.stdout = io.Discard
+	err = runRepairSnapshots(context.TODO(), env.gopts, RepairOptions{}, repaired)
+	globalOptions.stdout = os.Stdout
+	rtest.OK(t, err)
+	rtest.Equals(t, 4, len(testRunList(t, "snapshots", env.gopts)))
+
+	testRunForget(t, env.gopts, damaged...)
+	rtest.OK(t, runCheck(context.TODO(), CheckOptions{}, env.gopts, nil))
+	testRunRestore(t, env.gopts, filepath.Join(env.base, "restore"), restic.TestParseID(repaired[0]))
+}
+
+func TestRepairSnapshotsWithLostTree(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	testRunBackup(t, "", []string{filepath.Join(env.testdata, "0", "0", "9")}, BackupOptions{}, env.gopts)
+
+	// remove all tree packs, the snapshot cannot be repaired
+	removePacksExcept(env.gopts, t, restic.NewIDSet(), true)
+	testRunRebuildIndex(t, env.gopts)
+
+	testRunRepairSnapshots(t, env.gopts, false)
+	rtest.Equals(t, 1, len(testRunList(t, "snapshots", env.gopts)))
+
+	testRunRepairSnapshots(t, env.gopts, true)
+	rtest.Equals(t, 0, len(testRunList(t, "snapshots", env.gopts)))
+}
+
+func TestCheckSnapshot(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	testRunBackup(t, "", []string{filepath.Join(env.testdata, "0", "0", "9", "2")}, BackupOptions{}, env.gopts)
+	firstSnapshot := testRunList(t, "snapshots", env.gopts)
+	rtest.Assert(t, len(firstSnapshot) == 1, "expected one snapshot, got %v", firstSnapshot)
+	firstPacks := listPacks(env.gopts, t)
+
+	testRunBackup(t, "", []string{filepath.Join(env.testdata, "0", "0", "9", "3")}, BackupOptions{}, env.gopts)
+
+	// remove the data only referenced by the second snapshot
+	removePacksExcept(env.gopts, t, firstPacks, false)
+	testRunRebuildIndex(t, env.gopts)
+
+	opts := CheckOptions{ReadData: true, Snapshots: []string{firstSnapshot[0].String()}}
+	rtest.OK(t, runCheck(context.TODO(), opts, env.gopts, nil))
+	opts.ReadData = false
+	opts.ReadDataSubset = "1/2"
+	rtest.OK(t, runCheck(context.TODO(), opts, env.gopts, nil))
+
+	opts = CheckOptions{Snapshots: []string{"latest"}}
+	err := runCheck(context.TODO(), opts, env.gopts, nil)
+	rtest.Assert(t, err != nil, "expected check of the damaged snapshot to fail")
+
+	opts = CheckOptions{Snapshots: []string{"invalid"}}
+	err = runCheck(context.TODO(), opts, env.gopts, nil)
+	rtest.Assert(t, err != nil, "expected check of an unknown snapshot to fail")
+}
+
+func TestCheckWithCacheVerify(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	testRunBackup(t, "", []string{filepath.Join(env.testdata, "0", "0", "9", "2")}, BackupOptions{}, env.gopts)
+
+	// damage all cached index files
+	var cachedIndexes []string
+	rtest.OK(t, filepath.Walk(env.cache, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if fi.Mode().IsRegular() && filepath.Base(filepath.Dir(filepath.Dir(p))) == "index" {
+			cachedIndexes = append(cachedIndexes, p)
+			return os.WriteFile(p, []byte("broken"), 0600)
+		}
+		return nil
+	}))
+	rtest.Assert(t, len(cachedIndexes) > 0, "no cached index files found")
+
+	buf := bytes.NewBuffer(nil)
+	globalOptions.stdout = buf
+	err := runCheck(context.TODO(), CheckOptions{WithCacheVerify: true}, env.gopts, nil)
+	globalOptions.stdout = os.Stdout
+	rtest.OK(t, err)
+	msg := fmt.Sprintf("removed %d damaged files from the cache", len(cachedIndexes))
+	rtest.Assert(t, strings.Contains(buf.String(), msg), "missing %q in output:\n%s", msg, buf.String())
+
+	// the index files must have been downloaded again
+	for _, p := range cachedIndexes {
+		buf, err := os.ReadFile(p)
+		rtest.OK(t, err)
+		rtest.Equals(t, filepath.Base(p), restic.Hash(buf).String())
+	}
+}
+
+func TestCheckJSON(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	testRunBackup(t, "", []string{filepath.Join(env.testdata, "0", "0", "9")}, BackupOptions{}, env.gopts)
+
+	packs := listPacks(env.gopts, t).List()
+	rtest.Assert(t, len(packs) >= 2, "expected at least two packs, got %v", len(packs))
+	missingID, damagedID := packs[0], packs[1]
+
+	packPath := func(id restic.ID) string {
+		return filepath.Join(env.repo, "data", id.String()[:2], id.String())
+	}
+	rtest.OK(t, os.Remove(packPath(missingID)))
+	buf, err := os.ReadFile(packPath(damagedID))
+	rtest.OK(t, err)
+	buf[0] ^= 0xff
+	rtest.OK(t, os.WriteFile(packPath(damagedID), buf, 0600))
+
+	out := bytes.NewBuffer(nil)
+	globalOptions.stdout = out
+	globalOptions.JSON = true
+	env.gopts.JSON = true
+	defer func() {
+		globalOptions.stdout = os.Stdout
+		globalOptions.JSON = false
+		env.gopts.JSON = false
+	}()
+
+	err = runCheck(context.TODO(), CheckOptions{ReadData: true}, env.gopts, nil)
+	rtest.Assert(t, err != nil, "expected check to fail")
+
+	type packError struct {
+		id        restic.ID
+		errorType string
+	}
+	packErrors := make(map[packError]struct{})
+	var summary jsonCheckSummary
+	dec := json.NewDecoder(out)
+	for dec.More() {
+		var msg struct {
+			jsonCheckMessage
+			NumErrors int `json:"num_errors"`
+		}
+		rtest.OK(t, dec.Decode(&msg))
+		switch msg.MessageType {
+		case "error":
+			if msg.PackID != nil {
+				packErrors[packError{*msg.PackID, msg.ErrorType}] = struct{}{}
+			}
+		case "summary":
+			summary.NumErrors = msg.NumErrors
+		}
+	}
+
+	for _, e := range []packError{{missingID, "missing_pack"}, {damagedID, "pack_hash_mismatch"}} {
+		_, ok := packErrors[e]
+		rtest.Assert(t, ok, "missing %v error for pack %v in output:\n%v", e.errorType, e.id, packErrors)
+	}
+	rtest.Assert(t, summary.NumErrors >= 2, "expected at least two errors, got %v", summary.NumErrors)
+}
+
+func TestCheckResume(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	testRunBackup(t, "", []string{filepath.Join(env.testdata, "0", "0", "9")}, BackupOptions{}, env.gopts)
+
+	r, err := OpenRepository(context.TODO(), env.gopts)
+	rtest.OK(t, err)
+	stateFile := checkStateFile(env.gopts.CacheDir, r.Config().ID)
+
+	// a successful check does not leave a state behind
+	opts := CheckOptions{ReadData: true, Resume: true}
+	rtest.OK(t, runCheck(context.TODO(), opts, env.gopts, nil))
+	_, err = os.Stat(stateFile)
+	rtest.Assert(t, errors.Is(err, os.ErrNotExist), "unexpected check state after successful check: %v", err)
+
+	packs := listPacks(env.gopts, t)
+	damagedID := packs.List()[0]
+	packPath := filepath.Join(env.repo, "data", damagedID.String()[:2], damagedID.String())
+	buf, err := os.ReadFile(packPath)
+	rtest.OK(t, err)
+	buf[0] ^= 0xff
+	rtest.OK(t, os.WriteFile(packPath, buf, 0600))
+
+	err = runCheck(context.TODO(), opts, env.gopts, nil)
+	rtest.Assert(t, err != nil, "expected check to fail")
+
+	// all packs except the damaged one were recorded
+	state, err := loadCheckState(stateFile, "all")
+	rtest.OK(t, err)
+	verified := restic.NewIDSet(state.Verified...)
+	packs.Delete(damagedID)
+	rtest.Equals(t, packs, verified)
+
+	// only the damaged pack is read again
+	out := bytes.NewBuffer(nil)
+	globalOptions.stdout = out
+	err = runCheck(context.TODO(), opts, env.gopts, nil)
+	globalOptions.stdout = os.Stdout
+	rtest.Assert(t, err != nil, "expected check to fail")
+	msg := fmt.Sprintf("skipping %d packs already read by a previous run", len(packs))
+	rtest.Assert(t, strings.Contains(out.String(), msg), "missing %q in output:\n%s", msg, out.String())
+
+	// a different selection starts from scratch
+	state, err = loadCheckState(stateFile, "1/2")
+	rtest.OK(t, err)
+	rtest.Equals(t, 0, len(state.Verified))
+}
+
+func TestScrub(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	testRunBackup(t, "", []string{filepath.Join(env.testdata, "0", "0", "9")}, BackupOptions{}, env.gopts)
+
+	r, err := OpenRepository(context.TODO(), env.gopts)
+	rtest.OK(t, err)
+	stateFile := scrubStateFile(env.gopts.CacheDir, r.Config().ID)
+	packs := listPacks(env.gopts, t)
+	rtest.Assert(t, len(packs) >= 2, "expected at least two packs, got %v", len(packs))
+
+	// each run reads the packs which were not verified yet
+	opts := ScrubOptions{Subset: "50%"}
+	rtest.OK(t, runScrub(context.TODO(), opts, env.gopts, nil))
+	state, err := loadScrubState(stateFile)
+	rtest.OK(t, err)
+	rtest.Equals(t, len(packs)/2, len(state.Verified))
+	firstRun := make(map[string]time.Time)
+	for id, ts := range state.Verified {
+		firstRun[id] = ts
+	}
+
+	rtest.OK(t, runScrub(context.TODO(), opts, env.gopts, nil))
+	state, err = loadScrubState(stateFile)
+	rtest.OK(t, err)
+	rtest.Equals(t, 2*(len(packs)/2), len(state.Verified))
+	for id, ts := range firstRun {
+		rtest.Assert(t, state.Verified[id].Equal(ts), "pack %v was read again", id)
+	}
+
+	// a damaged pack is reported and not marked as verified
+	opts = ScrubOptions{Subset: "100%"}
+	damagedID := packs.List()[0]
+	packPath := filepath.Join(env.repo, "data", damagedID.String()[:2], damagedID.String())
+	buf, err := os.ReadFile(packPath)
+	rtest.OK(t, err)
+	buf[0] ^= 0xff
+	rtest.OK(t, os.WriteFile(packPath, buf, 0600))
+	damagedVerified := state.Verified[damagedID.String()]
+
+	err = runScrub(context.TODO(), opts, env.gopts, nil)
+	rtest.Assert(t, err != nil, "expected scrub to fail")
+	state, err = loadScrubState(stateFile)
+	rtest.OK(t, err)
+	rtest.Assert(t, state.Verified[damagedID.String()].Equal(damagedVerified), "damaged pack was marked as verified")
+	for id := range packs {
+		_, ok := state.Verified[id.String()]
+		rtest.Assert(t, ok || id == damagedID, "pack %v was not verified", id)
+	}
+}
+
 func TestCheckRestoreNoLock(t *testing.T) {
 	env, cleanup := withTestEnvironment(t)
 	defer cleanup()
@@ -1583,6 +2307,43 @@ func TestCheckRestoreNoLock(t *testing.T) {
 	testRunRestore(t, env.gopts, filepath.Join(env.base, "restore"), snapshotIDs[0])
 }
 
+func TestForgetPolicyFile(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+
+	for _, tag := range []string{"db", "db", "db", "desktop", "desktop", "other"} {
+		opts := BackupOptions{Tags: restic.TagLists{[]string{tag}}}
+		testRunBackup(t, "", []string{env.testdata}, opts, env.gopts)
+	}
+
+	policyFile := filepath.Join(env.base, "policy.yaml")
+	rtest.OK(t, os.WriteFile(policyFile, []byte(`
+rules:
+  - tag: [db]
+    keep-last: 2
+  - tag: [desktop]
+    keep-last: 1
+`), 0600))
+
+	opts := ForgetOptions{PolicyFile: policyFile, GroupBy: "host,paths"}
+	rtest.OK(t, runForget(context.TODO(), opts, env.gopts, nil))
+
+	tags := make(map[string]int)
+	_, snapmap := testRunSnapshots(t, env.gopts)
+	for _, sn := range snapmap {
+		for _, tag := range sn.Tags {
+			tags[tag]++
+		}
+	}
+	rtest.Equals(t, map[string]int{"db": 2, "desktop": 1, "other": 1}, tags)
+
+	opts.Last = 1
+	err := runForget(context.TODO(), opts, env.gopts, nil)
+	rtest.Assert(t, err != nil, "expected --policy-file combined with --keep-last to fail")
+}
+
 func TestPrune(t *testing.T) {
 	testPruneVariants(t, false)
 	testPruneVariants(t, true)
@@ -1663,6 +2424,187 @@ func listPacks(gopts GlobalOptions, t *testing.T) restic.IDSet {
 	return packs
 }
 
+func testRunUnused(t testing.TB, gopts GlobalOptions) unusedReport {
+	buf := bytes.NewBuffer(nil)
+	globalOptions.stdout = buf
+	globalOptions.JSON = true
+	gopts.JSON = true
+	defer func() {
+		globalOptions.stdout = os.Stdout
+		globalOptions.JSON = false
+	}()
+
+	rtest.OK(t, runUnused(context.TODO(), gopts, nil))
+
+	var report unusedReport
+	dec := json.NewDecoder(buf)
+	for dec.More() {
+		// skip status messages
+		rtest.OK(t, dec.Decode(&report))
+	}
+	rtest.Equals(t, "summary", report.MessageType)
+	return report
+}
+
+func TestUnused(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	opts := BackupOptions{}
+	testRunBackup(t, "", []string{filepath.Join(env.testdata, "0", "0", "9", "2")}, opts, env.gopts)
+	firstSnapshot := testRunList(t, "snapshots", env.gopts)
+	testRunBackup(t, "", []string{filepath.Join(env.testdata, "0", "0", "9", "3")}, opts, env.gopts)
+
+	report := testRunUnused(t, env.gopts)
+	rtest.Equals(t, 0, len(report.UnusedBlobs))
+	rtest.Equals(t, 0, len(report.DuplicateBlobs))
+	rtest.Equals(t, 0, len(report.UnreferencedPacks))
+
+	testRunForget(t, env.gopts, firstSnapshot[0].String())
+	// a pack file left behind by an interrupted backup
+	orphanID := restic.NewRandomID()
+	orphanDir := filepath.Join(env.repo, "data", orphanID.String()[:2])
+	rtest.OK(t, os.MkdirAll(orphanDir, 0700))
+	rtest.OK(t, os.WriteFile(filepath.Join(orphanDir, orphanID.String()), []byte("orphaned"), 0600))
+	packsBefore := listPacks(env.gopts, t)
+
+	report = testRunUnused(t, env.gopts)
+	rtest.Assert(t, len(report.UnusedBlobs) > 0, "expected unused blobs after forget")
+	var unusedSize uint64
+	for _, blob := range report.UnusedBlobs {
+		unusedSize += uint64(blob.Size)
+	}
+	rtest.Equals(t, unusedSize, report.UnusedSize)
+	rtest.Equals(t, []unusedPack{{ID: orphanID, Size: 8}}, report.UnreferencedPacks)
+
+	// nothing must have been removed
+	rtest.Equals(t, packsBefore, listPacks(env.gopts, t))
+}
+
+func TestPruneJSON(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	opts := BackupOptions{}
+
+	testRunBackup(t, "", []string{filepath.Join(env.testdata, "0", "0", "9")}, opts, env.gopts)
+	firstSnapshot := testRunList(t, "snapshots", env.gopts)
+	testRunBackup(t, "", []string{filepath.Join(env.testdata, "0", "0", "9", "2")}, opts, env.gopts)
+	testRunForget(t, env.gopts, firstSnapshot[0].String())
+
+	buf := bytes.NewBuffer(nil)
+	globalOptions.stdout = buf
+	globalOptions.JSON = true
+	defer func() {
+		globalOptions.stdout = os.Stdout
+		globalOptions.JSON = false
+	}()
+	env.gopts.JSON = true
+
+	// a verbose dry run must only print JSON and list the packs to repack
+	gopts := env.gopts
+	gopts.verbosity = 2
+	testRunPrune(t, gopts, PruneOptions{MaxUnused: "0%", DryRun: true})
+	var dryRun struct {
+		MessageType string     `json:"message_type"`
+		DryRun      bool       `json:"dry_run"`
+		RepackPacks restic.IDs `json:"repack_packs"`
+	}
+	scanner := bufio.NewScanner(buf)
+	for scanner.Scan() {
+		rtest.OK(t, json.Unmarshal(scanner.Bytes(), &dryRun))
+	}
+	rtest.OK(t, scanner.Err())
+	rtest.Equals(t, "plan", dryRun.MessageType)
+	rtest.Assert(t, dryRun.DryRun, "plan is not marked as dry run")
+	rtest.Assert(t, len(dryRun.RepackPacks) > 0, "no packs to repack listed")
+
+	buf.Reset()
+	testRunPrune(t, env.gopts, PruneOptions{MaxUnused: "0%"})
+
+	phases := make(map[string]bool)
+	plans := 0
+	scanner = bufio.NewScanner(buf)
+	for scanner.Scan() {
+		var msg struct {
+			MessageType   string `json:"message_type"`
+			Phase         string `json:"phase"`
+			PacksToRepack uint   `json:"packs_to_repack"`
+		}
+		rtest.OK(t, json.Unmarshal(scanner.Bytes(), &msg))
+		switch msg.MessageType {
+		case "status":
+			phases[msg.Phase] = true
+		case "plan":
+			plans++
+			rtest.Assert(t, msg.PacksToRepack > 0, "no packs to repack")
+		default:
+			t.Errorf("unexpected message type %q", msg.MessageType)
+		}
+	}
+	rtest.OK(t, scanner.Err())
+	rtest.Equals(t, 1, plans)
+	for _, phase := range []string{"load-index", "find-used-blobs", "plan", "repack", "rebuild-index", "delete"} {
+		rtest.Assert(t, phases[phase], "missing status for phase %v", phase)
+	}
+}
+
+// interruptIndexBackend fails saving the second and all following index files.
+type interruptIndexBackend struct {
+	restic.Backend
+	indexSaves int32
+}
+
+func (be *interruptIndexBackend) Save(ctx context.Context, h restic.Handle, rd restic.RewindReader) error {
+	if h.Type == restic.IndexFile && atomic.AddInt32(&be.indexSaves, 1) > 1 {
+		return errors.New("interrupted")
+	}
+	return be.Backend.Save(ctx, h, rd)
+}
+
+func TestPruneInterrupted(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	opts := BackupOptions{}
+
+	testRunBackup(t, "", []string{filepath.Join(env.testdata, "0", "0", "9")}, opts, env.gopts)
+	firstSnapshot := testRunList(t, "snapshots", env.gopts)
+	testRunBackup(t, "", []string{filepath.Join(env.testdata, "0", "0", "9", "2")}, opts, env.gopts)
+	testRunForget(t, env.gopts, firstSnapshot[0].String())
+
+	oldPacks := listPacks(env.gopts, t)
+
+	// interrupt prune after repacking, while the index is rewritten
+	env.gopts.backendTestHook = func(r restic.Backend) (restic.Backend, error) {
+		return &interruptIndexBackend{Backend: r}, nil
+	}
+	pruneOpts := PruneOptions{MaxUnused: "0%"}
+	err := runPrune(context.TODO(), pruneOpts, env.gopts)
+	rtest.Assert(t, err != nil, "expected prune to fail")
+	env.gopts.backendTestHook = nil
+
+	newPacks := listPacks(env.gopts, t)
+	newPacks.Sub(oldPacks)
+	rtest.Assert(t, len(newPacks) > 0, "no packs were repacked")
+
+	// the repacked data must still be referenced by the index
+	r, err := OpenRepository(context.TODO(), env.gopts)
+	rtest.OK(t, err)
+	rtest.OK(t, r.LoadIndex(context.TODO()))
+	indexedPacks := r.Index().(*index.MasterIndex).Packs(nil)
+	for id := range newPacks {
+		rtest.Assert(t, indexedPacks.Has(id), "repacked pack %v is missing from the index", id.Str())
+	}
+	rtest.OK(t, runCheck(context.TODO(), CheckOptions{}, env.gopts, nil))
+
+	testRunPrune(t, env.gopts, pruneOpts)
+	rtest.OK(t, runCheck(context.TODO(), CheckOptions{ReadData: true, CheckUnused: true}, env.gopts, nil))
+}
+
 func TestPruneWithDamagedRepository(t *testing.T) {
 	env, cleanup := withTestEnvironment(t)
 	defer cleanup()
@@ -1850,8 +2792,8 @@ func TestListOnce(t *testing.T) {
 	testRunPrune(t, env.gopts, pruneOpts)
 	rtest.OK(t, runCheck(context.TODO(), checkOpts, env.gopts, nil))
 
-	rtest.OK(t, runRebuildIndex(context.TODO(), RebuildIndexOptions{}, env.gopts))
-	rtest.OK(t, runRebuildIndex(context.TODO(), RebuildIndexOptions{ReadAllPacks: true}, env.gopts))
+	rtest.OK(t, runRebuildIndex(context.TODO(), RepairIndexOptions{}, env.gopts))
+	rtest.OK(t, runRebuildIndex(context.TODO(), RepairIndexOptions{ReadAllPacks: true}, env.gopts))
 }
 
 func TestHardLink(t *testing.T) {
@@ -2116,6 +3058,17 @@ func TestDiffJSON(t *testing.T) {
 		switch sniffer.MessageType {
 		case "change":
 			changes++
+			var change Change
+			rtest.OK(t, json.Unmarshal([]byte(line), &change))
+			switch filepath.Base(change.Path) {
+			case "modfile":
+				rtest.Equals(t, uint64(256*1024), change.RemovedBytes)
+			case "modfile1":
+				rtest.Assert(t, change.AddedBytes > 0 && change.RemovedBytes > 0,
+					"missing byte attribution for modified file: %v", line)
+			case "modfile2":
+				rtest.Equals(t, uint64(256*1024), change.AddedBytes)
+			}
 		case "statistics":
 			rtest.OK(t, json.Unmarshal([]byte(line), &stat))
 		default:
@@ -2220,3 +3173,158 @@ func TestFindListOnce(t *testing.T) {
 	// the snapshots can only be listed once, if both lists match then the there has been only a single List() call
 	rtest.Equals(t, thirdSnapshot, snapshotIDs)
 }
+
+func testRunBackendTest(gopts GlobalOptions) (string, error) {
+	buf := bytes.NewBuffer(nil)
+
+	globalOptions.stdout = buf
+	defer func() {
+		globalOptions.stdout = os.Stdout
+	}()
+
+	opts := BackendTestOptions{Size: 1, Requests: 2}
+	err := runBackendTest(context.TODO(), opts, gopts)
+	return buf.String(), err
+}
+
+// noRemoveBackend refuses to remove files except for locks, like an
+// append-only backend.
+type noRemoveBackend struct {
+	restic.Backend
+}
+
+func (be *noRemoveBackend) Remove(ctx context.Context, h restic.Handle) error {
+	if h.Type == restic.LockFile {
+		return be.Backend.Remove(ctx, h)
+	}
+	return errors.New("permission denied")
+}
+
+func TestBackendTest(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	// the backend can be tested before the repository is initialized
+	out, err := testRunBackendTest(env.gopts)
+	rtest.OK(t, err)
+	rtest.Assert(t, strings.Contains(out, "the repository is not initialized"), "unexpected output %q", out)
+	rtest.Assert(t, strings.Contains(out, "all checks passed"), "unexpected output %q", out)
+
+	testRunInit(t, env.gopts)
+	out, err = testRunBackendTest(env.gopts)
+	rtest.OK(t, err)
+	rtest.Assert(t, strings.Contains(out, "config   ok"), "unexpected output %q", out)
+	rtest.Equals(t, 0, len(listPacks(env.gopts, t)))
+
+	env.gopts.backendInnerTestHook = func(r restic.Backend) (restic.Backend, error) {
+		return &noRemoveBackend{Backend: r}, nil
+	}
+	out, err = testRunBackendTest(env.gopts)
+	rtest.Assert(t, err != nil, "missing error for failed remove")
+	rtest.Assert(t, strings.Contains(out, "remove   FAILED  permission denied"), "unexpected output %q", out)
+
+	// a probe file protected by an object lock stays, but check still passes
+	env.gopts.backendInnerTestHook = func(r restic.Backend) (restic.Backend, error) {
+		return &objectLockedBackend{Backend: r, locked: map[restic.FileType]bool{restic.PackFile: true}}, nil
+	}
+	out, err = testRunBackendTest(env.gopts)
+	rtest.OK(t, err)
+	rtest.Assert(t, strings.Contains(out, "remove   ok"), "unexpected output %q", out)
+
+	env.gopts.backendInnerTestHook = nil
+	testRunCheck(t, env.gopts)
+
+	// the test does not run while the repository is locked by another command
+	repo, err := OpenRepository(context.TODO(), env.gopts)
+	rtest.OK(t, err)
+	lock, _, err := lockRepo(context.TODO(), repo)
+	rtest.OK(t, err)
+	defer unlockRepo(lock)
+	_, err = testRunBackendTest(env.gopts)
+	rtest.Assert(t, err != nil, "backend test ran while the repository was locked")
+}
+
+// objectLockedBackend refuses to remove files of the given types, like a
+// backend which protects them with an object lock.
+type objectLockedBackend struct {
+	restic.Backend
+	locked map[restic.FileType]bool
+}
+
+func (be *objectLockedBackend) Remove(ctx context.Context, h restic.Handle) error {
+	if be.locked[h.Type] {
+		return backoff.Permanent(fmt.Errorf("%v is %w", h, restic.ErrObjectLocked))
+	}
+	return be.Backend.Remove(ctx, h)
+}
+
+func TestForgetPruneObjectLocked(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	testRunBackup(t, "", []string{filepath.Join(env.testdata, "0", "0", "9")}, BackupOptions{}, env.gopts)
+	testRunBackup(t, "", []string{filepath.Join(env.testdata, "0", "0", "9", "0")}, BackupOptions{}, env.gopts)
+	snapshotIDs := testRunList(t, "snapshots", env.gopts)
+	packs := listPacks(env.gopts, t)
+	indexes := restic.NewIDSet(testRunList(t, "index", env.gopts)...)
+
+	locked := map[restic.FileType]bool{restic.SnapshotFile: true, restic.PackFile: true, restic.IndexFile: true}
+	env.gopts.backendInnerTestHook = func(r restic.Backend) (restic.Backend, error) {
+		return &objectLockedBackend{Backend: r, locked: locked}, nil
+	}
+
+	// files protected by the object lock are kept and do not cause an error
+	testRunForget(t, env.gopts, snapshotIDs[0].String())
+	rtest.Equals(t, len(snapshotIDs), len(testRunList(t, "snapshots", env.gopts)))
+
+	// packs which are no longer used stay in the repository until the lock
+	// has expired
+	locked[restic.SnapshotFile] = false
+	testRunForget(t, env.gopts, snapshotIDs[0].String())
+	testRunPrune(t, env.gopts, PruneOptions{MaxUnused: "0"})
+	rtest.Assert(t, len(packs.Sub(listPacks(env.gopts, t))) == 0, "packs protected by the lock were removed")
+	rtest.Assert(t, len(indexes.Sub(restic.NewIDSet(testRunList(t, "index", env.gopts)...))) == 0, "index files protected by the lock were removed")
+
+	// the old index files still reference the unused blobs of the kept packs
+	env.gopts.backendInnerTestHook = nil
+	_, err := testRunCheckOutput(env.gopts)
+	rtest.OK(t, err)
+	testRunPrune(t, env.gopts, PruneOptions{MaxUnused: "0"})
+	rtest.Assert(t, len(packs.Sub(listPacks(env.gopts, t))) > 0, "unused packs were not removed after the lock expired")
+	rtest.Assert(t, len(indexes.Intersect(restic.NewIDSet(testRunList(t, "index", env.gopts)...))) == 0, "obsolete index files were not removed after the lock expired")
+	testRunCheck(t, env.gopts)
+}
+
+func TestPruneObjectLockedIndex(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	testRunBackup(t, "", []string{filepath.Join(env.testdata, "0", "0", "9")}, BackupOptions{}, env.gopts)
+	testRunBackup(t, "", []string{filepath.Join(env.testdata, "0", "0", "9", "0")}, BackupOptions{}, env.gopts)
+	snapshotIDs := testRunList(t, "snapshots", env.gopts)
+	testRunForget(t, env.gopts, snapshotIDs[0].String())
+	indexes := restic.NewIDSet(testRunList(t, "index", env.gopts)...)
+
+	// only the index files are protected, the packs referenced by the old
+	// index files must not be removed while these files exist
+	env.gopts.backendInnerTestHook = func(r restic.Backend) (restic.Backend, error) {
+		return &objectLockedBackend{Backend: r, locked: map[restic.FileType]bool{restic.IndexFile: true}}, nil
+	}
+	packs := listPacks(env.gopts, t)
+	testRunPrune(t, env.gopts, PruneOptions{MaxUnused: "0"})
+	rtest.Assert(t, len(packs.Sub(listPacks(env.gopts, t))) == 0, "packs referenced by locked index files were removed")
+	rtest.Assert(t, len(indexes.Sub(restic.NewIDSet(testRunList(t, "index", env.gopts)...))) == 0, "index files protected by the lock were removed")
+
+	// the kept packs contain unused blobs, which is not an error
+	env.gopts.backendInnerTestHook = nil
+	_, err := testRunCheckOutput(env.gopts)
+	rtest.OK(t, err)
+	testRunRestore(t, env.gopts, filepath.Join(env.base, "restore"), snapshotIDs[1])
+
+	testRunPrune(t, env.gopts, PruneOptions{MaxUnused: "0"})
+	rtest.Assert(t, len(packs.Sub(listPacks(env.gopts, t))) > 0, "unused packs were not removed after the lock expired")
+	rtest.Assert(t, len(indexes.Intersect(restic.NewIDSet(testRunList(t, "index", env.gopts)...))) == 0, "obsolete index files were not removed after the lock expired")
+	testRunCheck(t, env.gopts)
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/spf13/pflag"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/fuse"
+	"github.com/restic/restic/internal/restic"
+)
+
+// mountSnapshotDirsHelp describes the directory structure of the mount, it is
+// part of the help text of the mount and serve commands.
+const mountSnapshotDirsHelp = `Snapshot Directories
+====================
+
+If you need a different template for directories that contain snapshots,
+you can pass a time template via --time-template and path templates via
+--path-template.
+
+Example time template without colons:
+
+    --time-template "2006-01-02_15-04-05"
+
+You need to specify a sample format for exactly the following timestamp:
+
+    Mon Jan 2 15:04:05 -0700 MST 2006
+
+For details please see the documentation for time.Format() at:
+  https://godoc.org/time#Time.Format
+
+For path templates, you can use the following patterns which will be replaced:
+    %i by short snapshot ID
+    %I by long snapshot ID
+    %u by username
+    %h by hostname
+    %t by tags
+    %p by the backup paths, one directory level per path component
+    %T by timestamp as specified by --time-template
+
+The default path templates are:
+    "ids/%i"
+    "snapshots/%T"
+    "hosts/%h/%T"
+    "tags/%t/%T"
+    "paths/%p/%T"
+    "groups/%h/%p/%T"
+
+Snapshots with several tags or paths show up once for each of them. For
+example, a snapshot of "/home/user" is found below "paths/home/user/".
+
+Directories created by templates that end with %T, %i or %I contain a symlink
+"latest" to the newest snapshot in them, for example "ids/latest" or
+"groups/myhost/home/user/latest" for the newest snapshot of "/home/user" on
+the host "myhost".`
+
+// mountSingleSnapshotHelp describes the --snapshot option of the mount
+// command.
+const mountSingleSnapshotHelp = `Single Snapshot
+===============
+
+With --snapshot, only the given snapshot is mounted. Its files and dirs are
+found directly in the mountpoint, which makes it easy to point other tools
+like rsync or diff at this snapshot. The snapshot can be given by its ID or as
+"latest" for the newest snapshot matching --host, --tag and --path.`
+
+// checkTimeTemplate checks the time template used for the snapshot dirs.
+func checkTimeTemplate(template string) error {
+	if template == "" {
+		return errors.Fatal("time template string cannot be empty")
+	}
+
+	if strings.HasPrefix(template, "/") || strings.HasSuffix(template, "/") {
+		return errors.Fatal("time template string cannot start or end with '/'")
+	}
+	return nil
+}
+
+// snapshotDirsOptions collects the options for the structure of the snapshot
+// dirs, which are shared by the mount and serve commands.
+type snapshotDirsOptions struct {
+	snapshotFilterOptions
+	TimeTemplate  string
+	PathTemplates []string
+}
+
+func initSnapshotDirsOptions(f *pflag.FlagSet, opts *snapshotDirsOptions) {
+	initMultiSnapshotFilterOptions(f, &opts.snapshotFilterOptions, true)
+
+	f.StringArrayVar(&opts.PathTemplates, "path-template", nil, "set `template` for path names (can be specified multiple times)")
+	f.StringVar(&opts.TimeTemplate, "snapshot-template", time.RFC3339, "set `template` to use for snapshot dirs")
+	f.StringVar(&opts.TimeTemplate, "time-template", time.RFC3339, "set `template` to use for times")
+	_ = f.MarkDeprecated("snapshot-template", "use --time-template")
+}
+
+// config checks the options and returns the corresponding configuration.
+func (opts *snapshotDirsOptions) config() (fuse.Config, error) {
+	if err := checkTimeTemplate(opts.TimeTemplate); err != nil {
+		return fuse.Config{}, err
+	}
+
+	return fuse.Config{
+		Hosts:         opts.Hosts,
+		Tags:          opts.Tags,
+		Paths:         opts.Paths,
+		TimeTemplate:  opts.TimeTemplate,
+		PathTemplates: opts.PathTemplates,
+	}, nil
+}
+
+// findMountSnapshot returns the snapshot to mount for --snapshot.
+func findMountSnapshot(ctx context.Context, repo restic.Repository, opts snapshotDirsOptions, snapshotID string) (*restic.Snapshot, error) {
+	if len(opts.PathTemplates) > 0 {
+		return nil, errors.Fatal("--snapshot and --path-template cannot be used together")
+	}
+
+	sn, err := restic.FindFilteredSnapshot(ctx, repo.Backend(), repo, opts.Hosts, opts.Tags, opts.Paths, nil, snapshotID)
+	if err != nil {
+		return nil, errors.Fatalf("failed to find snapshot %q: %v", snapshotID, err)
+	}
+	return sn, nil
+}
@@ -0,0 +1,105 @@
+//go:build darwin
+// +build darwin
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/fuse"
+	"github.com/restic/restic/internal/nfs"
+	"github.com/restic/restic/internal/restic"
+)
+
+// mountNFS mounts the snapshots at mountpoint with the NFS client of macOS,
+// which unlike macFUSE needs no kernel extension. The NFS server only listens
+// on localhost and runs until the mountpoint is unmounted. It only permits a
+// single mount via a random export path, such that other local users cannot
+// access the files.
+func mountNFS(ctx context.Context, repo restic.Repository, cfg fuse.Config, mountpoint string) error {
+	devBefore, err := deviceID(mountpoint)
+	if err != nil {
+		return err
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return errors.Fatalf("unable to listen for NFS clients: %v", err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	srv := nfs.NewServer(fuse.NewSnapshotFS(ctx, repo, cfg))
+	srv.RestrictAccess(uint32(os.Getuid()))
+	export := srv.ExportOnce()
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- srv.Serve(ctx, l)
+	}()
+
+	// soft makes file operations fail instead of hang if restic is killed
+	// without unmounting, resvport makes the kernel send the calls from a
+	// privileged port
+	opts := fmt.Sprintf("vers=3,tcp,port=%d,mountport=%d,nolocks,locallocks,rdonly,soft,resvport", port, port)
+	debug.Log("running mount_nfs -o %v for %v", opts, mountpoint)
+	// if another user mounted the export path first, mount_nfs fails and the
+	// server is stopped
+	out, err := exec.CommandContext(ctx, "/sbin/mount_nfs", "-o", opts, "127.0.0.1:"+export, mountpoint).CombinedOutput()
+	if err != nil {
+		return errors.Fatalf("mount_nfs failed: %v: %s", err, bytes.TrimSpace(out))
+	}
+
+	AddCleanupHandler(func(code int) (int, error) {
+		debug.Log("running umount cleanup handler for NFS mount at %v", mountpoint)
+		err := umount(mountpoint)
+		if err != nil {
+			Warnf("unable to umount (maybe already umounted or still in use?): %v\n", err)
+		}
+		// replace error code of sigint
+		if code == 130 {
+			code = 0
+		}
+		return code, nil
+	})
+
+	Printf("Now serving the repository at %s via NFS\n", mountpoint)
+	Printf("Use another terminal or tool to browse the contents of this folder.\n")
+	Printf("When finished, quit with Ctrl-c here or umount the mountpoint.\n")
+
+	// the server cannot rely on the client to announce the umount, thus
+	// check whether the mountpoint still belongs to the mount
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case err := <-serveErr:
+			return err
+		case <-ticker.C:
+			dev, err := deviceID(mountpoint)
+			if err == nil && dev == devBefore {
+				debug.Log("%v was unmounted", mountpoint)
+				return nil
+			}
+		}
+	}
+}
+
+// deviceID returns the ID of the device which contains name.
+func deviceID(name string) (int32, error) {
+	fi, err := os.Stat(name)
+	if err != nil {
+		return 0, err
+	}
+	return fi.Sys().(*syscall.Stat_t).Dev, nil
+}
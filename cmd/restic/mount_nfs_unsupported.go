@@ -0,0 +1,17 @@
+//go:build freebsd || linux
+// +build freebsd linux
+
+package main
+
+import (
+	"context"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/fuse"
+	"github.com/restic/restic/internal/restic"
+)
+
+// mountNFS is only supported on macOS, other systems can use "serve nfs".
+func mountNFS(ctx context.Context, repo restic.Repository, cfg fuse.Config, mountpoint string) error {
+	return errors.Fatal("mounting via NFS is only supported on macOS, use \"restic serve nfs\" instead")
+}
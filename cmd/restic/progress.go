@@ -1,6 +1,7 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 	"strconv"
@@ -54,6 +55,61 @@ func newProgressMax(show bool, max uint64, description string) *progress.Counter
 	})
 }
 
+// jsonPhaseStatus is printed by the counters returned by newPhaseProgressMax
+// with --json.
+type jsonPhaseStatus struct {
+	MessageType    string  `json:"message_type"` // "status"
+	Phase          string  `json:"phase"`
+	SecondsElapsed uint64  `json:"seconds_elapsed,omitempty"`
+	PercentDone    float64 `json:"percent_done,omitempty"`
+	Total          uint64  `json:"total,omitempty"`
+	Done           uint64  `json:"done,omitempty"`
+}
+
+// printPhase announces the start of a phase of a longer operation. With
+// --json, a status message for the phase is printed instead of the message.
+func printPhase(phase string, format string, args ...interface{}) {
+	if globalOptions.JSON {
+		printJSONPhaseStatus(jsonPhaseStatus{MessageType: "status", Phase: phase})
+		return
+	}
+	Verbosef(format, args...)
+}
+
+func printJSONPhaseStatus(status jsonPhaseStatus) {
+	err := json.NewEncoder(globalOptions.stdout).Encode(status)
+	if err != nil {
+		Warnf("JSON encode failed: %v\n", err)
+	}
+}
+
+// newPhaseProgressMax returns a progress.Counter for a phase of a longer
+// operation. With --json, it prints status messages for the phase instead of
+// a progress bar.
+func newPhaseProgressMax(show bool, max uint64, phase string, description string) *progress.Counter {
+	if !globalOptions.JSON {
+		return newProgressMax(show, max, description)
+	}
+	if !show {
+		return nil
+	}
+
+	interval := calculateProgressInterval(show, true)
+	return progress.NewCounter(interval, max, func(v uint64, max uint64, d time.Duration, final bool) {
+		status := jsonPhaseStatus{
+			MessageType:    "status",
+			Phase:          phase,
+			SecondsElapsed: uint64(d / time.Second),
+			Total:          max,
+			Done:           v,
+		}
+		if max > 0 {
+			status.PercentDone = float64(v) / float64(max)
+		}
+		printJSONPhaseStatus(status)
+	})
+}
+
 func printProgress(status string, canUpdateStatus bool) {
 	w := stdoutTerminalWidth()
 	if w > 0 {
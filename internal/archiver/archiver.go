@@ -6,6 +6,7 @@ import (
 	"path"
 	"runtime"
 	"sort"
+	"sync"
 	"time"
 
 	"github.com/restic/restic/internal/debug"
@@ -88,12 +89,35 @@ type Archiver struct {
 
 	// Flags controlling change detection. See doc/040_backup.rst for details.
 	ChangeIgnoreFlags uint
+
+	// Resume holds the directories saved by an interrupted backup of the same
+	// targets. If set, its nodes take precedence over the nodes of the parent
+	// snapshot when detecting unchanged files.
+	Resume *ResumeState
+
+	// ReadBlockDevices configures if the contents of block devices which are
+	// given as targets are read and saved like a regular file. Otherwise only
+	// the device node is saved.
+	ReadBlockDevices bool
+
+	// blockDeviceTargets contains the absolute paths of the targets, it is
+	// only used if ReadBlockDevices is set.
+	blockDeviceTargets map[string]struct{}
+
+	// skipped collects the items for which Error ignored an error. They are
+	// recorded in the snapshot.
+	skippedMu sync.Mutex
+	skipped   []string
 }
 
 // Flags for the ChangeIgnoreFlags bitfield.
 const (
 	ChangeIgnoreCtime = 1 << iota
 	ChangeIgnoreInode
+
+	// ChangeForceRescan treats all files as changed, so that their contents
+	// are read again even if the metadata matches the previous backup.
+	ChangeForceRescan
 )
 
 // Options is used to configure the archiver.
@@ -158,8 +182,10 @@ func New(repo restic.Repository, fs fs.FS, opts Options) *Archiver {
 	return arch
 }
 
-// error calls arch.Error if it is set and the error is different from context.Canceled.
-func (arch *Archiver) error(item string, err error) error {
+// error calls arch.Error for item if it is set and the error is different
+// from context.Canceled. When the error is ignored, snPath is recorded as
+// skipped.
+func (arch *Archiver) error(snPath, item string, err error) error {
 	if arch.Error == nil || err == nil {
 		return err
 	}
@@ -172,9 +198,49 @@ func (arch *Archiver) error(item string, err error) error {
 	if err != errf {
 		debug.Log("item %v: error was filtered by handler, before: %q, after: %v", item, err, errf)
 	}
+	// a duplicate of an identical node is only a warning, the node is kept
+	if errf == nil && !errors.Is(err, restic.ErrTreeNotOrdered) {
+		arch.skippedMu.Lock()
+		arch.skipped = append(arch.skipped, snPath)
+		arch.skippedMu.Unlock()
+	}
 	return errf
 }
 
+// warn calls arch.Error for item if it is set, for errors which did not cause
+// anything to be left out of the snapshot. The error is neither recorded as
+// skipped nor does it abort the backup.
+func (arch *Archiver) warn(item string, err error) {
+	if arch.Error == nil || err == context.Canceled {
+		return
+	}
+
+	if errf := arch.Error(item, err); errf != nil {
+		debug.Log("item %v: ignoring error %v, item was saved", item, errf)
+	}
+}
+
+// skippedItems returns the sorted list of items for which an error was
+// ignored, without duplicates.
+func (arch *Archiver) skippedItems() []string {
+	arch.skippedMu.Lock()
+	defer arch.skippedMu.Unlock()
+
+	if len(arch.skipped) == 0 {
+		return nil
+	}
+
+	items := append([]string(nil), arch.skipped...)
+	sort.Strings(items)
+	list := items[:1]
+	for _, item := range items[1:] {
+		if item != list[len(list)-1] {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
 // nodeFromFileInfo returns the restic node from an os.FileInfo.
 func (arch *Archiver) nodeFromFileInfo(snPath, filename string, fi os.FileInfo) (*restic.Node, error) {
 	node, err := restic.NodeFromFileInfo(filename, fi)
@@ -207,7 +273,7 @@ func (arch *Archiver) wrapLoadTreeError(id restic.ID, err error) error {
 	if arch.Repo.Index().Has(restic.BlobHandle{ID: id, Type: restic.TreeBlob}) {
 		err = errors.Errorf("tree %v could not be loaded; the repository could be damaged: %v", id, err)
 	} else {
-		err = errors.Errorf("tree %v is not known; the repository could be damaged, run `rebuild-index` to try to repair it", id)
+		err = errors.Errorf("tree %v is not known; the repository could be damaged, run `repair index` to try to repair it", id)
 	}
 	return err
 }
@@ -238,13 +304,13 @@ func (arch *Archiver) SaveDir(ctx context.Context, snPath string, dir string, fi
 		}
 
 		pathname := arch.FS.Join(dir, name)
-		oldNode := previous.Find(name)
 		snItem := join(snPath, name)
+		oldNode := arch.previousNode(snItem, previous, name)
 		fn, excluded, err := arch.Save(ctx, snItem, pathname, oldNode)
 
 		// return error early if possible
 		if err != nil {
-			err = arch.error(pathname, err)
+			err = arch.error(snItem, pathname, err)
 			if err == nil {
 				// ignore error
 				continue
@@ -312,6 +378,16 @@ func (fn *FutureNode) take(ctx context.Context) futureNodeResult {
 	return futureNodeResult{err: errors.Errorf("no result")}
 }
 
+// previousNode returns the node the item at snPath, called name in the
+// previous tree, is compared against to detect changes. Nodes recorded in arch.Resume take
+// precedence over the nodes of the previous tree.
+func (arch *Archiver) previousNode(snPath string, previous *restic.Tree, name string) *restic.Node {
+	if node := arch.Resume.Lookup(snPath); node != nil {
+		return node
+	}
+	return previous.Find(name)
+}
+
 // allBlobsPresent checks if all blobs (contents) of the given node are
 // present in the index.
 func (arch *Archiver) allBlobsPresent(previous *restic.Node) bool {
@@ -350,7 +426,7 @@ func (arch *Archiver) Save(ctx context.Context, snPath, target string, previous
 	fi, err := arch.FS.Lstat(target)
 	if err != nil {
 		debug.Log("lstat() for %v returned error: %v", target, err)
-		err = arch.error(abstarget, err)
+		err = arch.error(snPath, abstarget, err)
 		if err != nil {
 			return FutureNode{}, false, errors.WithStack(err)
 		}
@@ -362,6 +438,28 @@ func (arch *Archiver) Save(ctx context.Context, snPath, target string, previous
 	}
 
 	switch {
+	case arch.isBlockDeviceTarget(abstarget, fi):
+		debug.Log("  %v block device, reading contents", target)
+
+		file, err := arch.FS.OpenFile(target, fs.O_RDONLY|fs.O_NOFOLLOW, 0)
+		if err != nil {
+			debug.Log("Openfile() for %v returned error: %v", target, err)
+			err = arch.error(snPath, abstarget, err)
+			if err != nil {
+				return FutureNode{}, false, errors.WithStack(err)
+			}
+			return FutureNode{}, true, nil
+		}
+
+		// Save will close the file, we don't need to do that
+		fn = arch.fileSaver.Save(ctx, snPath, target, file, blockDeviceFileInfo{fi}, func() {
+			arch.StartFile(snPath)
+		}, func() {
+			arch.CompleteItem(snPath, nil, nil, ItemStats{}, 0)
+		}, func(node *restic.Node, stats ItemStats) {
+			arch.CompleteItem(snPath, previous, node, stats, time.Since(start))
+		})
+
 	case fs.IsRegularFile(fi):
 		debug.Log("  %v regular file", target)
 
@@ -390,11 +488,7 @@ func (arch *Archiver) Save(ctx context.Context, snPath, target string, previous
 
 			debug.Log("%v hasn't changed, but contents are missing!", target)
 			// There are contents missing - inform user!
-			err := errors.Errorf("parts of %v not found in the repository index; storing the file again", target)
-			err = arch.error(abstarget, err)
-			if err != nil {
-				return FutureNode{}, false, err
-			}
+			arch.warn(abstarget, errors.Errorf("parts of %v not found in the repository index; storing the file again", target))
 		}
 
 		// reopen file and do an fstat() on the open file to check it is still
@@ -402,7 +496,7 @@ func (arch *Archiver) Save(ctx context.Context, snPath, target string, previous
 		file, err := arch.FS.OpenFile(target, fs.O_RDONLY|fs.O_NOFOLLOW, 0)
 		if err != nil {
 			debug.Log("Openfile() for %v returned error: %v", target, err)
-			err = arch.error(abstarget, err)
+			err = arch.error(snPath, abstarget, err)
 			if err != nil {
 				return FutureNode{}, false, errors.WithStack(err)
 			}
@@ -413,7 +507,7 @@ func (arch *Archiver) Save(ctx context.Context, snPath, target string, previous
 		if err != nil {
 			debug.Log("stat() on opened file %v returned error: %v", target, err)
 			_ = file.Close()
-			err = arch.error(abstarget, err)
+			err = arch.error(snPath, abstarget, err)
 			if err != nil {
 				return FutureNode{}, false, errors.WithStack(err)
 			}
@@ -424,7 +518,7 @@ func (arch *Archiver) Save(ctx context.Context, snPath, target string, previous
 		if !fs.IsRegularFile(fi) {
 			err = errors.Errorf("file %v changed type, refusing to archive", fi.Name())
 			_ = file.Close()
-			err = arch.error(abstarget, err)
+			err = arch.error(snPath, abstarget, err)
 			if err != nil {
 				return FutureNode{}, false, err
 			}
@@ -446,10 +540,8 @@ func (arch *Archiver) Save(ctx context.Context, snPath, target string, previous
 		snItem := snPath + "/"
 		oldSubtree, err := arch.loadSubtree(ctx, previous)
 		if err != nil {
-			err = arch.error(abstarget, err)
-		}
-		if err != nil {
-			return FutureNode{}, false, err
+			// the dir is saved without the information of the previous snapshot
+			arch.warn(abstarget, err)
 		}
 
 		fn, err = arch.SaveDir(ctx, snPath, target, fi, oldSubtree,
@@ -484,6 +576,30 @@ func (arch *Archiver) Save(ctx context.Context, snPath, target string, previous
 	return fn, false, nil
 }
 
+// isBlockDeviceTarget returns true if the contents of the item at abstarget
+// should be read like a regular file.
+func (arch *Archiver) isBlockDeviceTarget(abstarget string, fi os.FileInfo) bool {
+	if !arch.ReadBlockDevices || fi.Mode()&os.ModeDevice == 0 || fi.Mode()&os.ModeCharDevice != 0 {
+		return false
+	}
+	_, ok := arch.blockDeviceTargets[abstarget]
+	return ok
+}
+
+// blockDeviceFileInfo presents a block device as a regular file, so that its
+// contents are saved as the content of a file.
+type blockDeviceFileInfo struct {
+	os.FileInfo
+}
+
+func (fi blockDeviceFileInfo) Mode() os.FileMode {
+	return fi.FileInfo.Mode() &^ (os.ModeType | os.ModeCharDevice)
+}
+
+func (fi blockDeviceFileInfo) IsDir() bool {
+	return false
+}
+
 // fileChanged tries to detect whether a file's content has changed compared
 // to the contents of node, which describes the same path in the parent backup.
 // It should only be run for regular files.
@@ -494,6 +610,8 @@ func fileChanged(fi os.FileInfo, node *restic.Node, ignoreFlags uint) bool {
 	case node.Type != "file":
 		// We're only called for regular files, so this is a type change.
 		return true
+	case ignoreFlags&ChangeForceRescan != 0:
+		return true
 	case uint64(fi.Size()) != node.Size:
 		return true
 	case !fi.ModTime().Equal(node.ModTime):
@@ -575,10 +693,10 @@ func (arch *Archiver) SaveTree(ctx context.Context, snPath string, atree *Tree,
 
 		// this is a leaf node
 		if subatree.Leaf() {
-			fn, excluded, err := arch.Save(ctx, join(snPath, name), subatree.Path, previous.Find(name))
+			fn, excluded, err := arch.Save(ctx, join(snPath, name), subatree.Path, arch.previousNode(join(snPath, name), previous, name))
 
 			if err != nil {
-				err = arch.error(subatree.Path, err)
+				err = arch.error(join(snPath, name), subatree.Path, err)
 				if err == nil {
 					// ignore error
 					continue
@@ -599,13 +717,10 @@ func (arch *Archiver) SaveTree(ctx context.Context, snPath string, atree *Tree,
 		snItem := join(snPath, name) + "/"
 		start := time.Now()
 
-		oldNode := previous.Find(name)
+		oldNode := arch.previousNode(join(snPath, name), previous, name)
 		oldSubtree, err := arch.loadSubtree(ctx, oldNode)
 		if err != nil {
-			err = arch.error(join(snPath, name), err)
-		}
-		if err != nil {
-			return FutureNode{}, 0, err
+			arch.warn(join(snPath, name), err)
 		}
 
 		// not a leaf node, archive subtree
@@ -697,7 +812,7 @@ func (arch *Archiver) loadParentTree(ctx context.Context, sn *restic.Snapshot) *
 	tree, err := restic.LoadTree(ctx, arch.Repo, *sn.Tree)
 	if err != nil {
 		debug.Log("unable to load tree %v: %v", *sn.Tree, err)
-		_ = arch.error("/", arch.wrapLoadTreeError(*sn.Tree, err))
+		arch.warn("/", arch.wrapLoadTreeError(*sn.Tree, err))
 		return nil
 	}
 	return tree
@@ -710,11 +825,12 @@ func (arch *Archiver) runWorkers(ctx context.Context, wg *errgroup.Group) {
 	arch.fileSaver = NewFileSaver(ctx, wg,
 		arch.blobSaver.Save,
 		arch.Repo.Config().ChunkerPolynomial,
+		arch.Repo.Config().ChunkerSizes,
 		arch.Options.ReadConcurrency, arch.Options.SaveBlobConcurrency)
 	arch.fileSaver.CompleteBlob = arch.CompleteBlob
 	arch.fileSaver.NodeFromFileInfo = arch.nodeFromFileInfo
 
-	arch.treeSaver = NewTreeSaver(ctx, wg, arch.Options.SaveTreeConcurrency, arch.blobSaver.Save, arch.Error)
+	arch.treeSaver = NewTreeSaver(ctx, wg, arch.Options.SaveTreeConcurrency, arch.blobSaver.Save, arch.error)
 }
 
 func (arch *Archiver) stopWorkers() {
@@ -738,6 +854,21 @@ func (arch *Archiver) Snapshot(ctx context.Context, targets []string, opts Snaps
 		return nil, restic.ID{}, err
 	}
 
+	arch.skippedMu.Lock()
+	arch.skipped = nil
+	arch.skippedMu.Unlock()
+
+	if arch.ReadBlockDevices {
+		arch.blockDeviceTargets = make(map[string]struct{}, len(cleanTargets))
+		for _, target := range cleanTargets {
+			abstarget, err := arch.FS.Abs(target)
+			if err != nil {
+				return nil, restic.ID{}, err
+			}
+			arch.blockDeviceTargets[abstarget] = struct{}{}
+		}
+	}
+
 	var rootTreeID restic.ID
 
 	wgUp, wgUpCtx := errgroup.WithContext(ctx)
@@ -801,6 +932,7 @@ func (arch *Archiver) Snapshot(ctx context.Context, targets []string, opts Snaps
 		sn.Parent = opts.ParentSnapshot.ID()
 	}
 	sn.Tree = &rootTreeID
+	sn.Skipped = arch.skippedItems()
 
 	id, err := restic.SaveSnapshot(ctx, arch.Repo, sn)
 	if err != nil {
@@ -664,6 +664,12 @@ func TestFileChanged(t *testing.T) {
 			ChangeIgnore: ChangeIgnoreCtime | ChangeIgnoreInode,
 			SameFile:     true,
 		},
+		{
+			Name:         "force-rescan",
+			Modify:       func(t testing.TB, filename string) {},
+			ChangeIgnore: ChangeForceRescan,
+			SameFile:     false,
+		},
 	}
 
 	for _, test := range tests {
@@ -2244,3 +2250,198 @@ func TestRacyFileSwap(t *testing.T) {
 		t.Errorf("Save() excluded the node, that's unexpected")
 	}
 }
+
+// failOpenFS returns an error when a file with the given base name is opened
+// and when a file with the base name readErrName is read.
+type failOpenFS struct {
+	fs.FS
+	name        string
+	readErrName string
+}
+
+func (m failOpenFS) OpenFile(name string, flag int, perm os.FileMode) (fs.File, error) {
+	if filepath.Base(name) == m.name {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrPermission}
+	}
+	f, err := m.FS.OpenFile(name, flag, perm)
+	if err == nil && filepath.Base(name) == m.readErrName {
+		f = failReadFile{File: f}
+	}
+	return f, err
+}
+
+type failReadFile struct {
+	fs.File
+}
+
+func (f failReadFile) Read(p []byte) (int, error) {
+	return 0, &os.PathError{Op: "read", Path: f.Name(), Err: os.ErrPermission}
+}
+
+func TestArchiverSkippedItems(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	tempdir, repo := prepareTempdirRepoSrc(t, TestDir{
+		"dir": TestDir{
+			"unreadable": TestFile{Content: "foo"},
+			"broken":     TestFile{Content: "baz"},
+			"other":      TestFile{Content: "bar"},
+		},
+	})
+
+	back := restictest.Chdir(t, tempdir)
+	defer back()
+
+	arch := New(repo, failOpenFS{FS: fs.Local{}, name: "unreadable", readErrName: "broken"}, Options{})
+	arch.Error = func(item string, err error) error {
+		return nil
+	}
+
+	// skipped items are listed with their path within the snapshot
+	sn, _, err := arch.Snapshot(ctx, []string{"dir"}, SnapshotOptions{Time: time.Now()})
+	restictest.OK(t, err)
+	restictest.Equals(t, []string{"/dir/broken", "/dir/unreadable"}, sn.Skipped)
+
+	arch.Error = func(item string, err error) error {
+		return err
+	}
+	_, _, err = arch.Snapshot(ctx, []string{"dir"}, SnapshotOptions{Time: time.Now()})
+	restictest.Assert(t, errors.Is(err, os.ErrPermission), "unexpected error %v", err)
+}
+
+func TestArchiverParentTreeLoadError(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	tempdir, repo := prepareTempdirRepoSrc(t, TestDir{
+		"dir": TestDir{
+			"sub": TestDir{
+				"file": TestFile{Content: "foo"},
+			},
+		},
+		"other": TestDir{
+			"file": TestFile{Content: "bar"},
+		},
+	})
+
+	back := restictest.Chdir(t, tempdir)
+	defer back()
+
+	targets := []string{"dir/sub", "other"}
+	arch := New(repo, fs.Local{}, Options{})
+	parent, _, err := arch.Snapshot(ctx, targets, SnapshotOptions{Time: time.Now()})
+	restictest.OK(t, err)
+
+	// replace the subtrees of the parent snapshot with trees which do not exist
+	tree, err := restic.LoadTree(ctx, repo, *parent.Tree)
+	restictest.OK(t, err)
+	for _, node := range tree.Nodes {
+		missing := restic.NewRandomID()
+		node.Subtree = &missing
+	}
+	wg, wgCtx := errgroup.WithContext(ctx)
+	repo.StartPackUploader(wgCtx, wg)
+	rootID, err := restic.SaveTree(ctx, repo, tree)
+	restictest.OK(t, err)
+	restictest.OK(t, repo.Flush(ctx))
+	missingRoot := restic.NewRandomID()
+
+	for _, parent := range []*restic.Snapshot{
+		{Time: parent.Time, Paths: parent.Paths, Tree: &rootID},
+		{Time: parent.Time, Paths: parent.Paths, Tree: &missingRoot},
+	} {
+		// the dirs are saved without the parent, thus the errors must
+		// neither abort the backup nor mark the dirs as skipped
+		var errs []string
+		arch := New(repo, fs.Local{}, Options{})
+		arch.Error = func(item string, err error) error {
+			errs = append(errs, item)
+			return err
+		}
+
+		sn, id, err := arch.Snapshot(ctx, targets, SnapshotOptions{Time: time.Now(), ParentSnapshot: parent})
+		restictest.OK(t, err)
+		restictest.Assert(t, len(errs) > 0, "missing trees were not reported")
+		restictest.Equals(t, []string(nil), sn.Skipped)
+		TestEnsureSnapshot(t, repo, id, TestDir{
+			"dir": TestDir{
+				"sub": TestDir{
+					"file": TestFile{Content: "foo"},
+				},
+			},
+			"other": TestDir{
+				"file": TestFile{Content: "bar"},
+			},
+		})
+	}
+}
+
+// blockDeviceFS reports the file with the given base name as a block device.
+type blockDeviceFS struct {
+	fs.FS
+	name string
+}
+
+func (m blockDeviceFS) Lstat(name string) (os.FileInfo, error) {
+	fi, err := m.FS.Lstat(name)
+	if err != nil || filepath.Base(name) != m.name {
+		return fi, err
+	}
+	return fakeModeFileInfo{FileInfo: fi, mode: fi.Mode() | os.ModeDevice}, nil
+}
+
+type fakeModeFileInfo struct {
+	os.FileInfo
+	mode os.FileMode
+}
+
+func (fi fakeModeFileInfo) Mode() os.FileMode {
+	return fi.mode
+}
+
+func TestArchiverReadBlockDevices(t *testing.T) {
+	content := string(restictest.Random(42, 3*1024*1024))
+
+	for _, readDevices := range []bool{false, true} {
+		t.Run("", func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			tempdir, repo := prepareTempdirRepoSrc(t, TestDir{
+				"disk": TestFile{Content: content},
+			})
+
+			back := restictest.Chdir(t, tempdir)
+			defer back()
+
+			arch := New(repo, blockDeviceFS{FS: fs.Local{}, name: "disk"}, Options{})
+			arch.ReadBlockDevices = readDevices
+
+			sn, _, err := arch.Snapshot(ctx, []string{"disk"}, SnapshotOptions{Time: time.Now()})
+			restictest.OK(t, err)
+
+			tree, err := restic.LoadTree(ctx, repo, *sn.Tree)
+			restictest.OK(t, err)
+			node := tree.Find("disk")
+			restictest.Assert(t, node != nil, "node for disk not found")
+
+			if !readDevices {
+				restictest.Equals(t, "dev", node.Type)
+				restictest.Equals(t, 0, len(node.Content))
+				return
+			}
+
+			restictest.Equals(t, "file", node.Type)
+			restictest.Equals(t, uint64(len(content)), node.Size)
+
+			var buf []byte
+			for _, id := range node.Content {
+				data, err := repo.LoadBlob(ctx, restic.DataBlob, id, nil)
+				restictest.OK(t, err)
+				buf = append(buf, data...)
+			}
+			restictest.Equals(t, content, string(buf))
+		})
+	}
+}
@@ -22,7 +22,8 @@ type FileSaver struct {
 	saveFilePool *BufferPool
 	saveBlob     SaveBlobFn
 
-	pol chunker.Pol
+	pol   chunker.Pol
+	sizes restic.ChunkerSizes
 
 	ch chan<- saveFileJob
 
@@ -32,9 +33,11 @@ type FileSaver struct {
 }
 
 // NewFileSaver returns a new file saver. A worker pool with fileWorkers is
-// started, it is stopped when ctx is cancelled.
-func NewFileSaver(ctx context.Context, wg *errgroup.Group, save SaveBlobFn, pol chunker.Pol, fileWorkers, blobWorkers uint) *FileSaver {
+// started, it is stopped when ctx is cancelled. Files are split into chunks
+// using pol and sizes.
+func NewFileSaver(ctx context.Context, wg *errgroup.Group, save SaveBlobFn, pol chunker.Pol, sizes restic.ChunkerSizes, fileWorkers, blobWorkers uint) *FileSaver {
 	ch := make(chan saveFileJob)
+	sizes = sizes.WithDefaults()
 
 	debug.Log("new file saver with %v file workers and %v blob workers", fileWorkers, blobWorkers)
 
@@ -42,8 +45,9 @@ func NewFileSaver(ctx context.Context, wg *errgroup.Group, save SaveBlobFn, pol
 
 	s := &FileSaver{
 		saveBlob:     save,
-		saveFilePool: NewBufferPool(int(poolSize), chunker.MaxSize),
+		saveFilePool: NewBufferPool(int(poolSize), int(sizes.MaxSize)),
 		pol:          pol,
+		sizes:        sizes,
 		ch:           ch,
 
 		CompleteBlob: func(uint64) {},
@@ -169,7 +173,8 @@ func (s *FileSaver) saveFile(ctx context.Context, chnker *chunker.Chunker, snPat
 	}
 
 	// reuse the chunker
-	chnker.Reset(f, s.pol)
+	chnker.ResetWithBoundaries(f, s.pol, s.sizes.MinSize, s.sizes.MaxSize)
+	chnker.SetAverageBits(s.sizes.AverageBits)
 
 	node.Content = []restic.ID{}
 	node.Size = 0
@@ -247,7 +252,7 @@ func (s *FileSaver) saveFile(ctx context.Context, chnker *chunker.Chunker, snPat
 
 func (s *FileSaver) worker(ctx context.Context, jobs <-chan saveFileJob) {
 	// a worker has one chunker which is reused for each file (because it contains a rather large buffer)
-	chnker := chunker.New(nil, s.pol)
+	chnker := chunker.NewWithBoundaries(nil, s.pol, s.sizes.MinSize, s.sizes.MaxSize)
 
 	for {
 		var job saveFileJob
@@ -48,7 +48,7 @@ func startFileSaver(ctx context.Context, t testing.TB) (*FileSaver, context.Cont
 		t.Fatal(err)
 	}
 
-	s := NewFileSaver(ctx, wg, saveBlob, pol, workers, workers)
+	s := NewFileSaver(ctx, wg, saveBlob, pol, restic.ChunkerSizes{}, workers, workers)
 	s.NodeFromFileInfo = func(snPath, filename string, fi os.FileInfo) (*restic.Node, error) {
 		return restic.NodeFromFileInfo(filename, fi)
 	}
@@ -0,0 +1,205 @@
+package archiver
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/walker"
+)
+
+// resumeStateVersion is the version of the on-disk format of ResumeState.
+const resumeStateVersion = 1
+
+// ResumeState records the directories completed by a backup, so that a later
+// backup of the same targets can continue after an interruption without
+// reading the files in these directories again. The directory nodes are used
+// like the nodes of a parent snapshot, so changed files are still detected.
+type ResumeState struct {
+	m sync.Mutex
+
+	Version  int                     `json:"version"`
+	Time     time.Time               `json:"time"`
+	Hostname string                  `json:"hostname"`
+	Targets  []string                `json:"targets"`
+	Nodes    map[string]*restic.Node `json:"nodes"`
+}
+
+// NewResumeState returns an empty state for a backup of targets on hostname.
+func NewResumeState(hostname string, targets []string) *ResumeState {
+	return &ResumeState{
+		Version:  resumeStateVersion,
+		Hostname: hostname,
+		Targets:  sortedTargets(targets),
+		Nodes:    make(map[string]*restic.Node),
+	}
+}
+
+func sortedTargets(targets []string) []string {
+	list := append([]string(nil), targets...)
+	sort.Strings(list)
+	return list
+}
+
+// ResumeStateFilename returns the name of the file within dir which holds the
+// state for a backup of targets on hostname.
+func ResumeStateFilename(dir, hostname string, targets []string) string {
+	key := hostname + "\n" + strings.Join(sortedTargets(targets), "\n")
+	return filepath.Join(dir, restic.Hash([]byte(key)).String()+".json")
+}
+
+// LoadResumeState reads the state from filename. If the file does not exist,
+// belongs to a different backup or has an unknown version, nil is returned
+// without an error.
+func LoadResumeState(filename, hostname string, targets []string) (*ResumeState, error) {
+	buf, err := os.ReadFile(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var s ResumeState
+	if err := json.Unmarshal(buf, &s); err != nil {
+		return nil, errors.Wrap(err, "Unmarshal")
+	}
+
+	if s.Version != resumeStateVersion || s.Hostname != hostname ||
+		strings.Join(s.Targets, "\n") != strings.Join(sortedTargets(targets), "\n") {
+		debug.Log("ignoring resume state %v for a different backup", filename)
+		return nil, nil
+	}
+
+	if s.Nodes == nil {
+		s.Nodes = make(map[string]*restic.Node)
+	}
+	return &s, nil
+}
+
+// Complete records that the item at snPath has been saved as node. Only
+// directories are recorded. It is safe to call Complete concurrently and it
+// can be used with Archiver.CompleteItem.
+func (s *ResumeState) Complete(snPath string, node *restic.Node) {
+	if node == nil || node.Type != "dir" || node.Subtree == nil {
+		return
+	}
+
+	snPath = strings.TrimSuffix(snPath, "/")
+	if snPath == "" {
+		// the root node is synthetic and never resumed
+		return
+	}
+
+	s.m.Lock()
+	s.Nodes[snPath] = node
+	s.m.Unlock()
+}
+
+// Lookup returns the recorded node for the directory at snPath, or nil.
+func (s *ResumeState) Lookup(snPath string) *restic.Node {
+	if s == nil {
+		return nil
+	}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+	return s.Nodes[snPath]
+}
+
+// compact removes all nodes which are contained in another recorded
+// directory. It must be called with s.m held.
+func (s *ResumeState) compact() {
+	paths := make([]string, 0, len(s.Nodes))
+	for p := range s.Nodes {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	var last string
+	for _, p := range paths {
+		if last != "" && strings.HasPrefix(p, last+"/") {
+			delete(s.Nodes, p)
+			continue
+		}
+		last = p
+	}
+}
+
+// Save writes the state to filename, replacing the previous content
+// atomically.
+func (s *ResumeState) Save(filename string) error {
+	s.m.Lock()
+	s.compact()
+	s.Time = time.Now()
+	buf, err := json.Marshal(s)
+	s.m.Unlock()
+	if err != nil {
+		return errors.Wrap(err, "Marshal")
+	}
+
+	tmp := filename + ".tmp"
+	if err := os.WriteFile(tmp, buf, 0600); err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(fs.Rename(tmp, filename))
+}
+
+// RemoveIncomplete removes all nodes for which not all trees and data blobs
+// are contained in the index of repo, for example because the backup was
+// interrupted before the pack files were uploaded.
+func (s *ResumeState) RemoveIncomplete(ctx context.Context, repo restic.Repository) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	idx := repo.Index()
+	for p, node := range s.Nodes {
+		complete := idx.Has(restic.BlobHandle{ID: *node.Subtree, Type: restic.TreeBlob})
+		if complete {
+			err := walker.Walk(ctx, repo, *node.Subtree, nil, func(_ restic.ID, _ string, n *restic.Node, err error) (bool, error) {
+				if err != nil {
+					return false, err
+				}
+				if n == nil {
+					return false, nil
+				}
+				if n.Type == "dir" && n.Subtree != nil && !idx.Has(restic.BlobHandle{ID: *n.Subtree, Type: restic.TreeBlob}) {
+					return false, errors.Errorf("tree %v missing", n.Subtree.Str())
+				}
+				for _, id := range n.Content {
+					if !idx.Has(restic.BlobHandle{ID: id, Type: restic.DataBlob}) {
+						return false, errors.Errorf("blob %v missing", id.Str())
+					}
+				}
+				return false, nil
+			})
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			complete = err == nil
+		}
+
+		if !complete {
+			debug.Log("dropping incomplete resume node %v", p)
+			delete(s.Nodes, p)
+		}
+	}
+
+	return nil
+}
+
+// Len returns the number of recorded directories.
+func (s *ResumeState) Len() int {
+	s.m.Lock()
+	defer s.m.Unlock()
+	return len(s.Nodes)
+}
@@ -0,0 +1,93 @@
+package archiver
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/restic"
+	restictest "github.com/restic/restic/internal/test"
+)
+
+func TestResumeStateSaveLoad(t *testing.T) {
+	tempdir := restictest.TempDir(t)
+	targets := []string{"/home/user/work", "/etc"}
+	filename := ResumeStateFilename(tempdir, "host", targets)
+
+	id := restic.NewRandomID()
+	state := NewResumeState("host", targets)
+	state.Complete("/etc/", &restic.Node{Name: "etc", Type: "dir", Subtree: &id})
+	state.Complete("/etc/ssh", &restic.Node{Name: "ssh", Type: "dir", Subtree: &id})
+	state.Complete("/etc/fstab", &restic.Node{Name: "fstab", Type: "file"})
+	state.Complete("/home/user/work", &restic.Node{Name: "work", Type: "dir", Subtree: &id})
+	state.Complete("/", &restic.Node{Name: "", Type: "dir", Subtree: &id})
+
+	restictest.OK(t, state.Save(filename))
+
+	// the order of the targets does not matter
+	loaded, err := LoadResumeState(filename, "host", []string{"/etc", "/home/user/work"})
+	restictest.OK(t, err)
+	restictest.Assert(t, loaded != nil, "state was not loaded")
+	restictest.Equals(t, 2, loaded.Len())
+	restictest.Assert(t, loaded.Lookup("/etc") != nil, "node for /etc not found")
+	restictest.Assert(t, loaded.Lookup("/home/user/work") != nil, "node for /home/user/work not found")
+	restictest.Assert(t, loaded.Lookup("/etc/ssh") == nil, "node for /etc/ssh was not compacted")
+
+	for _, test := range []struct {
+		hostname string
+		targets  []string
+	}{
+		{"other", targets},
+		{"host", []string{"/etc"}},
+	} {
+		loaded, err := LoadResumeState(filename, test.hostname, test.targets)
+		restictest.OK(t, err)
+		restictest.Assert(t, loaded == nil, "state loaded for different backup %v %v", test.hostname, test.targets)
+	}
+
+	loaded, err = LoadResumeState(filepath.Join(tempdir, "missing"), "host", targets)
+	restictest.OK(t, err)
+	restictest.Assert(t, loaded == nil, "state loaded from missing file")
+}
+
+func TestArchiverResume(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	src := TestDir{
+		"dir": TestDir{
+			"file": TestFile{Content: string(restictest.Random(23, 512*1024))},
+		},
+	}
+	tempdir, repo := prepareTempdirRepoSrc(t, src)
+
+	testFS := &MockFS{
+		FS:        fs.Track{FS: fs.Local{}},
+		bytesRead: make(map[string]int),
+	}
+
+	back := restictest.Chdir(t, tempdir)
+	defer back()
+
+	state := NewResumeState("host", []string{"."})
+	arch := New(repo, testFS, Options{})
+	arch.CompleteItem = func(item string, previous, current *restic.Node, s ItemStats, d time.Duration) {
+		state.Complete(item, current)
+	}
+
+	_, _, err := arch.Snapshot(ctx, []string{"."}, SnapshotOptions{Time: time.Now()})
+	restictest.OK(t, err)
+	restictest.OK(t, state.RemoveIncomplete(ctx, repo))
+	restictest.Assert(t, state.Lookup("/dir") != nil, "directory was not recorded")
+
+	// without a parent snapshot, the file is only skipped due to the state
+	arch = New(repo, testFS, Options{})
+	arch.Resume = state
+	_, _, err = arch.Snapshot(ctx, []string{"."}, SnapshotOptions{Time: time.Now()})
+	restictest.OK(t, err)
+
+	filename := filepath.FromSlash("dir/file")
+	restictest.Equals(t, 512*1024, testFS.bytesRead[filename])
+}
@@ -12,14 +12,14 @@ import (
 // TreeSaver concurrently saves incoming trees to the repo.
 type TreeSaver struct {
 	saveBlob func(ctx context.Context, t restic.BlobType, buf *Buffer, cb func(res SaveBlobResponse))
-	errFn    ErrorFunc
+	errFn    func(snPath, target string, err error) error
 
 	ch chan<- saveTreeJob
 }
 
 // NewTreeSaver returns a new tree saver. A worker pool with treeWorkers is
 // started, it is stopped when ctx is cancelled.
-func NewTreeSaver(ctx context.Context, wg *errgroup.Group, treeWorkers uint, saveBlob func(ctx context.Context, t restic.BlobType, buf *Buffer, cb func(res SaveBlobResponse)), errFn ErrorFunc) *TreeSaver {
+func NewTreeSaver(ctx context.Context, wg *errgroup.Group, treeWorkers uint, saveBlob func(ctx context.Context, t restic.BlobType, buf *Buffer, cb func(res SaveBlobResponse)), errFn func(snPath, target string, err error) error) *TreeSaver {
 	ch := make(chan saveTreeJob)
 
 	s := &TreeSaver{
@@ -90,7 +90,7 @@ func (s *TreeSaver) save(ctx context.Context, job *saveTreeJob) (*restic.Node, I
 		// return the error if it wasn't ignored
 		if fnr.err != nil {
 			debug.Log("err for %v: %v", fnr.snPath, fnr.err)
-			fnr.err = s.errFn(fnr.target, fnr.err)
+			fnr.err = s.errFn(fnr.snPath, fnr.target, fnr.err)
 			if fnr.err == nil {
 				// ignore error
 				continue
@@ -109,7 +109,7 @@ func (s *TreeSaver) save(ctx context.Context, job *saveTreeJob) (*restic.Node, I
 		err := builder.AddNode(fnr.node)
 		if err != nil && errors.Is(err, restic.ErrTreeNotOrdered) && lastNode != nil && fnr.node.Equals(*lastNode) {
 			// ignore error if an _identical_ node already exists, but nevertheless issue a warning
-			_ = s.errFn(fnr.target, err)
+			_ = s.errFn(fnr.snPath, fnr.target, err)
 			err = nil
 		}
 		if err != nil {
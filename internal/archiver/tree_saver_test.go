@@ -25,7 +25,7 @@ func setupTreeSaver() (context.Context, context.CancelFunc, *TreeSaver, func() e
 	ctx, cancel := context.WithCancel(context.Background())
 	wg, ctx := errgroup.WithContext(ctx)
 
-	errFn := func(snPath string, err error) error {
+	errFn := func(snPath, target string, err error) error {
 		return err
 	}
 
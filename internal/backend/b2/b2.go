@@ -2,6 +2,8 @@ package b2
 
 import (
 	"context"
+	"crypto/sha1"
+	"encoding/hex"
 	"hash"
 	"io"
 	"net/http"
@@ -179,7 +181,7 @@ func (be *b2Backend) Location() string {
 
 // Hasher may return a hash function for calculating a content hash for the backend
 func (be *b2Backend) Hasher() hash.Hash {
-	return nil
+	return sha1.New()
 }
 
 // HasAtomicReplace returns whether Save() can atomically replace files
@@ -257,8 +259,14 @@ func (be *b2Backend) Save(ctx context.Context, h restic.Handle, rd restic.Rewind
 	debug.Log("Save %v, name %v", h, name)
 	obj := be.bucket.Object(name)
 
-	// b2 always requires sha1 checksums for uploaded file parts
-	w := obj.NewWriter(ctx)
+	// b2 always requires sha1 checksums for uploaded file parts, which are
+	// computed by the library and verified by the server. Large files are
+	// uploaded in multiple parts, store the checksum of the whole file for them.
+	var opts []b2.WriterOption
+	if rd.Hash() != nil {
+		opts = append(opts, b2.WithAttrsOption(&b2.Attrs{SHA1: hex.EncodeToString(rd.Hash())}))
+	}
+	w := obj.NewWriter(ctx, opts...)
 	n, err := io.Copy(w, rd)
 	debug.Log("  saved %d bytes, err %v", n, err)
 
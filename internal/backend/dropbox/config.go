@@ -0,0 +1,54 @@
+package dropbox
+
+import (
+	"path"
+	"strings"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/options"
+)
+
+// Config contains all configuration necessary to connect to Dropbox. Either
+// an access token or a refresh token together with the app key is required.
+type Config struct {
+	Path string
+
+	AccessToken  options.SecretString
+	RefreshToken options.SecretString
+	AppKey       string
+	AppSecret    options.SecretString
+
+	Connections uint `option:"connections" help:"set a limit for the number of concurrent connections (default: 4)"`
+	ChunkSize   uint `option:"chunk-size" help:"use upload sessions with chunks of the given size in MiB for larger files (default: 48)"`
+}
+
+// NewConfig returns a new Config with the default values filled in.
+func NewConfig() Config {
+	return Config{
+		Connections: 4,
+		ChunkSize:   48,
+	}
+}
+
+func init() {
+	options.Register("dropbox", Config{})
+}
+
+// ParseConfig parses the string s and extracts the dropbox config. The
+// supported configuration format is dropbox:/path, where the path is a
+// folder in the Dropbox of the user.
+func ParseConfig(s string) (interface{}, error) {
+	if !strings.HasPrefix(s, "dropbox:") {
+		return nil, errors.New("dropbox: invalid format")
+	}
+
+	// strip prefix "dropbox:"
+	p := path.Join("/", s[8:])
+	if p == "/" {
+		return nil, errors.New("dropbox: invalid format: folder not found")
+	}
+
+	cfg := NewConfig()
+	cfg.Path = p
+	return cfg, nil
+}
@@ -0,0 +1,44 @@
+package dropbox
+
+import "testing"
+
+var configTests = []struct {
+	s   string
+	cfg Config
+}{
+	{"dropbox:/restic", Config{
+		Path:        "/restic",
+		Connections: 4,
+		ChunkSize:   48,
+	}},
+	{"dropbox:backups/restic/", Config{
+		Path:        "/backups/restic",
+		Connections: 4,
+		ChunkSize:   48,
+	}},
+}
+
+func TestParseConfig(t *testing.T) {
+	for i, test := range configTests {
+		cfg, err := ParseConfig(test.s)
+		if err != nil {
+			t.Errorf("test %d:%s failed: %v", i, test.s, err)
+			continue
+		}
+
+		if cfg != test.cfg {
+			t.Errorf("test %d:\ninput:\n  %s\n wrong config, want:\n  %v\ngot:\n  %v",
+				i, test.s, test.cfg, cfg)
+			continue
+		}
+	}
+}
+
+func TestParseConfigInvalid(t *testing.T) {
+	for _, s := range []string{"dropbox:", "dropbox:/", "dropbox:/.."} {
+		_, err := ParseConfig(s)
+		if err == nil {
+			t.Errorf("expected error for %q", s)
+		}
+	}
+}
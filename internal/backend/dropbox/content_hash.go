@@ -0,0 +1,69 @@
+package dropbox
+
+import (
+	"crypto/sha256"
+	"hash"
+)
+
+// contentHashBlockSize is the size of the blocks hashed separately by the
+// Dropbox content hash.
+const contentHashBlockSize = 4 * 1024 * 1024
+
+// contentHash computes the Dropbox content hash, which is the SHA-256 hash of
+// the concatenated SHA-256 hashes of all 4 MiB blocks of a file, see
+// https://www.dropbox.com/developers/reference/content-hash.
+type contentHash struct {
+	blocks []byte
+	block  hash.Hash
+	n      int
+}
+
+// make sure that contentHash implements hash.Hash
+var _ hash.Hash = &contentHash{}
+
+func newContentHash() *contentHash {
+	return &contentHash{block: sha256.New()}
+}
+
+func (h *contentHash) Write(p []byte) (int, error) {
+	written := len(p)
+	for len(p) > 0 {
+		n := contentHashBlockSize - h.n
+		if n > len(p) {
+			n = len(p)
+		}
+		_, _ = h.block.Write(p[:n])
+		h.n += n
+		p = p[n:]
+
+		if h.n == contentHashBlockSize {
+			h.blocks = h.block.Sum(h.blocks)
+			h.block.Reset()
+			h.n = 0
+		}
+	}
+	return written, nil
+}
+
+func (h *contentHash) Sum(b []byte) []byte {
+	blocks := h.blocks
+	if h.n > 0 {
+		blocks = h.block.Sum(append([]byte{}, blocks...))
+	}
+	sum := sha256.Sum256(blocks)
+	return append(b, sum[:]...)
+}
+
+func (h *contentHash) Reset() {
+	h.blocks = h.blocks[:0]
+	h.block.Reset()
+	h.n = 0
+}
+
+func (h *contentHash) Size() int {
+	return sha256.Size
+}
+
+func (h *contentHash) BlockSize() int {
+	return sha256.BlockSize
+}
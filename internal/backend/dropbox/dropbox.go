@@ -0,0 +1,562 @@
+package dropbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/restic/restic/internal/backend"
+	"github.com/restic/restic/internal/backend/layout"
+	"github.com/restic/restic/internal/backend/sema"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/hashing"
+	"github.com/restic/restic/internal/restic"
+
+	"github.com/cenkalti/backoff/v4"
+	"golang.org/x/oauth2"
+)
+
+// the endpoints of the Dropbox API, replaced in tests
+var (
+	apiURL     = "https://api.dropboxapi.com"
+	contentURL = "https://content.dropboxapi.com"
+	tokenURL   = "https://api.dropboxapi.com/oauth2/token"
+)
+
+// Backend stores data in a folder in Dropbox.
+type Backend struct {
+	root        string
+	connections uint
+	chunkSize   int64
+	sem         sema.Semaphore
+	client      *http.Client
+	layout.Layout
+}
+
+// make sure that *Backend implements backend.Backend
+var _ restic.Backend = &Backend{}
+
+// Open opens the Dropbox backend with the given config.
+func Open(ctx context.Context, cfg Config, rt http.RoundTripper) (*Backend, error) {
+	debug.Log("open, config %#v", cfg)
+
+	if cfg.ChunkSize == 0 || cfg.ChunkSize > 150 {
+		return nil, errors.Fatal("dropbox: chunk size must be between 1 and 150 MiB")
+	}
+
+	sem, err := sema.New(cfg.Connections)
+	if err != nil {
+		return nil, err
+	}
+
+	var ts oauth2.TokenSource
+	switch {
+	case cfg.RefreshToken.String() != "":
+		if cfg.AppKey == "" {
+			return nil, errors.Fatal("dropbox: the app key is required to use a refresh token")
+		}
+
+		// use the transport for requesting access tokens
+		tokenCtx := context.WithValue(context.Background(), oauth2.HTTPClient, &http.Client{Transport: rt})
+		conf := &oauth2.Config{
+			ClientID:     cfg.AppKey,
+			ClientSecret: cfg.AppSecret.Unwrap(),
+			Endpoint: oauth2.Endpoint{
+				TokenURL:  tokenURL,
+				AuthStyle: oauth2.AuthStyleInParams,
+			},
+		}
+		ts = conf.TokenSource(tokenCtx, &oauth2.Token{RefreshToken: cfg.RefreshToken.Unwrap()})
+	case cfg.AccessToken.String() != "":
+		ts = oauth2.StaticTokenSource(&oauth2.Token{AccessToken: cfg.AccessToken.Unwrap()})
+	default:
+		return nil, errors.Fatal("dropbox: either an access token or a refresh token is required")
+	}
+
+	be := &Backend{
+		root:        cfg.Path,
+		connections: cfg.Connections,
+		chunkSize:   int64(cfg.ChunkSize) * 1024 * 1024,
+		sem:         sem,
+		client:      &http.Client{Transport: &oauth2.Transport{Source: ts, Base: rt}},
+		Layout:      &layout.DefaultLayout{Path: cfg.Path, Join: path.Join},
+	}
+
+	return be, nil
+}
+
+// Create opens the Dropbox backend and creates the folder for a new
+// repository.
+func Create(ctx context.Context, cfg Config, rt http.RoundTripper) (*Backend, error) {
+	be, err := Open(ctx, cfg, rt)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = be.Stat(ctx, restic.Handle{Type: restic.ConfigFile})
+	if err == nil {
+		return nil, errors.Fatal("config file already exists")
+	}
+	if !be.IsNotExist(err) {
+		return nil, err
+	}
+
+	// files are stored in subfolders which are created as needed
+	err = be.rpc(ctx, "files/create_folder_v2", map[string]interface{}{"path": be.root, "autorename": false}, nil)
+	var apiErr *apiError
+	if errors.As(err, &apiErr) && strings.HasPrefix(apiErr.Summary, "path/conflict/folder") {
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return be, nil
+}
+
+// apiError is an error returned by an endpoint of the Dropbox API.
+type apiError struct {
+	Summary string `json:"error_summary"`
+}
+
+func (e *apiError) Error() string {
+	return "dropbox: " + e.Summary
+}
+
+// isNotFound returns true if the error was caused by a missing file or
+// folder.
+func isNotFound(err error) bool {
+	var e *apiError
+	return errors.As(err, &e) && strings.Contains(e.Summary, "not_found")
+}
+
+// checkResponse returns an error for unsuccessful responses and closes the
+// body in that case.
+func checkResponse(resp *http.Response) error {
+	if resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusPartialContent {
+		return nil
+	}
+
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	buf, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode == http.StatusConflict {
+		var apiErr apiError
+		if err := json.Unmarshal(buf, &apiErr); err == nil && apiErr.Summary != "" {
+			return &apiErr
+		}
+	}
+	return errors.Errorf("unexpected HTTP response (%v): %v: %s", resp.StatusCode, resp.Status, bytes.TrimSpace(buf))
+}
+
+// rpc calls an endpoint of the API which takes and returns JSON.
+func (b *Backend) rpc(ctx context.Context, route string, arg interface{}, result interface{}) error {
+	buf, err := json.Marshal(arg)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, apiURL+"/2/"+route, bytes.NewReader(buf))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	b.sem.GetToken()
+	resp, err := b.client.Do(req)
+	b.sem.ReleaseToken()
+	if err != nil {
+		return errors.Wrap(err, "client.Do")
+	}
+
+	if err := checkResponse(resp); err != nil {
+		return err
+	}
+
+	if result != nil {
+		err = json.NewDecoder(resp.Body).Decode(result)
+		if err != nil {
+			_ = resp.Body.Close()
+			return errors.Wrap(err, "Decode")
+		}
+	}
+
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return errors.Wrap(resp.Body.Close(), "Close")
+}
+
+// apiArg encodes arg for the Dropbox-API-Arg header, which must only
+// contain ASCII characters.
+func apiArg(arg interface{}) (string, error) {
+	buf, err := json.Marshal(arg)
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	for _, r := range string(buf) {
+		if r < 0x80 {
+			sb.WriteRune(r)
+		} else if r <= 0xffff {
+			fmt.Fprintf(&sb, `\u%04x`, r)
+		} else {
+			// encode as UTF-16 surrogate pair
+			r -= 0x10000
+			fmt.Fprintf(&sb, `\u%04x\u%04x`, 0xd800+(r>>10), 0xdc00+(r&0x3ff))
+		}
+	}
+	return sb.String(), nil
+}
+
+// content calls an endpoint of the API which transfers file contents. The
+// caller must close the body of the response.
+func (b *Backend) content(ctx context.Context, route string, arg interface{}, body io.Reader, length int64, header http.Header) (*http.Response, error) {
+	a, err := apiArg(arg)
+	if err != nil {
+		return nil, err
+	}
+
+	if body != nil {
+		// make sure that client.Do() cannot close the reader by wrapping it
+		body = io.NopCloser(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, contentURL+"/2/"+route, body)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Dropbox-API-Arg", a)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/octet-stream")
+		// explicitly set the content length, this prevents chunked encoding
+		req.ContentLength = length
+	}
+
+	b.sem.GetToken()
+	resp, err := b.client.Do(req)
+	b.sem.ReleaseToken()
+	if err != nil {
+		return nil, errors.Wrap(err, "client.Do")
+	}
+
+	if err := checkResponse(resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// upload sends length bytes from rd to the content endpoint route and
+// decodes the result.
+func (b *Backend) upload(ctx context.Context, route string, arg interface{}, rd io.Reader, length int64, result interface{}) error {
+	resp, err := b.content(ctx, route, arg, io.LimitReader(rd, length), length, nil)
+	if err != nil {
+		return err
+	}
+
+	if result != nil {
+		err = json.NewDecoder(resp.Body).Decode(result)
+		if err != nil {
+			_ = resp.Body.Close()
+			return errors.Wrap(err, "Decode")
+		}
+	}
+
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return errors.Wrap(resp.Body.Close(), "Close")
+}
+
+func (b *Backend) Connections() uint {
+	return b.connections
+}
+
+// Location returns this backend's location (the folder name).
+func (b *Backend) Location() string {
+	return b.root
+}
+
+// Hasher may return a hash function for calculating a content hash for the backend
+func (b *Backend) Hasher() hash.Hash {
+	return newContentHash()
+}
+
+// HasAtomicReplace returns whether Save() can atomically replace files
+func (b *Backend) HasAtomicReplace() bool {
+	// a file is only visible once the upload is committed
+	return true
+}
+
+type commitInfo struct {
+	Path       string `json:"path"`
+	Mode       string `json:"mode"`
+	Autorename bool   `json:"autorename"`
+	Mute       bool   `json:"mute"`
+}
+
+// uploadArg is the argument of files/upload.
+type uploadArg struct {
+	commitInfo
+	ContentHash string `json:"content_hash,omitempty"`
+}
+
+type sessionCursor struct {
+	SessionID string `json:"session_id"`
+	Offset    int64  `json:"offset"`
+}
+
+// Save stores data in the backend at the handle. Larger files are uploaded
+// in chunks using an upload session. The content hash of the file is
+// verified against the one computed by Dropbox, a file with a wrong content
+// hash is removed again.
+func (b *Backend) Save(ctx context.Context, h restic.Handle, rd restic.RewindReader) error {
+	debug.Log("Save %v", h)
+	if err := h.Valid(); err != nil {
+		return backoff.Permanent(err)
+	}
+
+	hrd := hashing.NewReader(rd, newContentHash())
+	md, err := b.save(ctx, h, hrd, rd.Length(), rd.Hash())
+	if err != nil {
+		return err
+	}
+
+	sum := hrd.Sum(nil)
+	if md.ContentHash != "" && md.ContentHash != hex.EncodeToString(sum) {
+		err = errors.Errorf("wrong content hash for %v, got %v, want %x", h, md.ContentHash, sum)
+	} else if rd.Hash() != nil && !bytes.Equal(rd.Hash(), sum) {
+		err = errors.Errorf("wrong content hash for %v, got %x, want %x", h, sum, rd.Hash())
+	}
+	if err != nil {
+		debug.Log("removing %v after upload: %v", h, err)
+		if rerr := b.Remove(ctx, h); rerr != nil {
+			debug.Log("Remove %v returned %v", h, rerr)
+		}
+		return err
+	}
+	return nil
+}
+
+// save uploads length bytes from rd and returns the metadata of the new file.
+// If contentHash is set, it is sent along with single request uploads.
+func (b *Backend) save(ctx context.Context, h restic.Handle, rd io.Reader, length int64, contentHash []byte) (metadata, error) {
+	var md metadata
+	commit := commitInfo{Path: b.Filename(h), Mode: "overwrite", Mute: true}
+	if length <= b.chunkSize {
+		arg := uploadArg{commitInfo: commit}
+		if contentHash != nil {
+			arg.ContentHash = hex.EncodeToString(contentHash)
+		}
+		err := b.upload(ctx, "files/upload", arg, rd, length, &md)
+		return md, err
+	}
+
+	debug.Log("uploading %v in chunks of %d bytes", h, b.chunkSize)
+	var start struct {
+		SessionID string `json:"session_id"`
+	}
+	err := b.upload(ctx, "files/upload_session/start", map[string]interface{}{"close": false}, rd, b.chunkSize, &start)
+	if err != nil {
+		return md, err
+	}
+
+	cursor := sessionCursor{SessionID: start.SessionID, Offset: b.chunkSize}
+	for length-cursor.Offset > b.chunkSize {
+		arg := map[string]interface{}{"cursor": cursor, "close": false}
+		err = b.upload(ctx, "files/upload_session/append_v2", arg, rd, b.chunkSize, nil)
+		if err != nil {
+			return md, err
+		}
+		cursor.Offset += b.chunkSize
+	}
+
+	arg := map[string]interface{}{"cursor": cursor, "commit": commit}
+	err = b.upload(ctx, "files/upload_session/finish", arg, rd, length-cursor.Offset, &md)
+	return md, err
+}
+
+// notExistError is returned whenever the requested file does not exist.
+type notExistError struct {
+	restic.Handle
+}
+
+func (e *notExistError) Error() string {
+	return fmt.Sprintf("%v does not exist", e.Handle)
+}
+
+// IsNotExist returns true if the error was caused by a non-existing file.
+func (b *Backend) IsNotExist(err error) bool {
+	var e *notExistError
+	return errors.As(err, &e)
+}
+
+// Load runs fn with a reader that yields the contents of the file at h at the
+// given offset.
+func (b *Backend) Load(ctx context.Context, h restic.Handle, length int, offset int64, fn func(rd io.Reader) error) error {
+	return backend.DefaultLoad(ctx, h, length, offset, b.openReader, fn)
+}
+
+func (b *Backend) openReader(ctx context.Context, h restic.Handle, length int, offset int64) (io.ReadCloser, error) {
+	debug.Log("Load %v, length %v, offset %v", h, length, offset)
+	if err := h.Valid(); err != nil {
+		return nil, backoff.Permanent(err)
+	}
+
+	if offset < 0 {
+		return nil, errors.New("offset is negative")
+	}
+
+	if length < 0 {
+		return nil, errors.Errorf("invalid length %d", length)
+	}
+
+	header := make(http.Header)
+	if offset > 0 || length > 0 {
+		byteRange := fmt.Sprintf("bytes=%d-", offset)
+		if length > 0 {
+			byteRange = fmt.Sprintf("bytes=%d-%d", offset, offset+int64(length)-1)
+		}
+		header.Set("Range", byteRange)
+	}
+
+	resp, err := b.content(ctx, "files/download", map[string]string{"path": b.Filename(h)}, nil, 0, header)
+	if isNotFound(err) {
+		return nil, &notExistError{h}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if header.Get("Range") != "" && resp.StatusCode != http.StatusPartialContent {
+		_ = resp.Body.Close()
+		return nil, errors.Errorf("server did not return the requested range, status %v", resp.Status)
+	}
+
+	return resp.Body, nil
+}
+
+// metadata is the description of a file or folder.
+type metadata struct {
+	Tag  string `json:".tag"`
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+
+	ContentHash string `json:"content_hash"`
+}
+
+// Stat returns information about a blob.
+func (b *Backend) Stat(ctx context.Context, h restic.Handle) (restic.FileInfo, error) {
+	debug.Log("Stat %v", h)
+	if err := h.Valid(); err != nil {
+		return restic.FileInfo{}, backoff.Permanent(err)
+	}
+
+	var md metadata
+	err := b.rpc(ctx, "files/get_metadata", map[string]string{"path": b.Filename(h)}, &md)
+	if isNotFound(err) {
+		return restic.FileInfo{}, &notExistError{h}
+	}
+	if err != nil {
+		return restic.FileInfo{}, err
+	}
+
+	if md.Tag != "file" {
+		return restic.FileInfo{}, errors.Errorf("%v is not a file", h)
+	}
+
+	return restic.FileInfo{Size: md.Size, Name: h.Name}, nil
+}
+
+// Remove removes the blob with the given name and type.
+func (b *Backend) Remove(ctx context.Context, h restic.Handle) error {
+	debug.Log("Remove %v", h)
+	if err := h.Valid(); err != nil {
+		return backoff.Permanent(err)
+	}
+
+	err := b.rpc(ctx, "files/delete_v2", map[string]string{"path": b.Filename(h)}, nil)
+	if isNotFound(err) {
+		return &notExistError{h}
+	}
+	return err
+}
+
+// listResult is the response of list_folder and list_folder/continue.
+type listResult struct {
+	Entries []metadata `json:"entries"`
+	Cursor  string     `json:"cursor"`
+	HasMore bool       `json:"has_more"`
+}
+
+// List runs fn for each file in the backend which has the type t. When an
+// error occurs (or fn returns an error), List stops and returns it.
+func (b *Backend) List(ctx context.Context, t restic.FileType, fn func(restic.FileInfo) error) error {
+	debug.Log("List %v", t)
+	basedir, subdirs := b.Basedir(t)
+
+	var res listResult
+	err := b.rpc(ctx, "files/list_folder", map[string]interface{}{
+		"path":      basedir,
+		"recursive": subdirs,
+		"limit":     2000,
+	}, &res)
+	if isNotFound(err) {
+		debug.Log("ignoring non-existing folder")
+		return nil
+	}
+
+	for err == nil {
+		for _, entry := range res.Entries {
+			if entry.Tag != "file" {
+				continue
+			}
+
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			err := fn(restic.FileInfo{
+				Name: entry.Name,
+				Size: entry.Size,
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		if !res.HasMore {
+			break
+		}
+
+		cursor := res.Cursor
+		res = listResult{}
+		err = b.rpc(ctx, "files/list_folder/continue", map[string]string{"cursor": cursor}, &res)
+	}
+	if err != nil {
+		return err
+	}
+
+	return ctx.Err()
+}
+
+// Close does nothing
+func (b *Backend) Close() error { return nil }
+
+// Delete removes the folder of the repository and all files in it.
+func (b *Backend) Delete(ctx context.Context) error {
+	err := b.rpc(ctx, "files/delete_v2", map[string]string{"path": b.root}, nil)
+	if isNotFound(err) {
+		return nil
+	}
+	return err
+}
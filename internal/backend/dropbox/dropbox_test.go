@@ -0,0 +1,392 @@
+package dropbox
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/backend"
+	"github.com/restic/restic/internal/backend/test"
+	"github.com/restic/restic/internal/options"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+// fakeDropbox implements the subset of the Dropbox API used by the backend.
+// Paths are case-insensitive like on Dropbox.
+type fakeDropbox struct {
+	m        sync.Mutex
+	files    map[string][]byte
+	folders  map[string]bool
+	sessions map[string][]byte
+	// pageSize limits the number of entries returned per list request
+	pageSize int
+
+	refreshToken string
+	accessToken  string
+	refreshed    int
+}
+
+func newFakeDropbox() *fakeDropbox {
+	return &fakeDropbox{
+		files:        make(map[string][]byte),
+		folders:      make(map[string]bool),
+		sessions:     make(map[string][]byte),
+		pageSize:     7,
+		refreshToken: "refresh-token",
+		accessToken:  "access-token",
+	}
+}
+
+func conflict(w http.ResponseWriter, summary string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusConflict)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"error_summary": summary, "error": map[string]string{}})
+}
+
+func (d *fakeDropbox) createParents(p string) {
+	for dir := path.Dir(p); dir != "/"; dir = path.Dir(dir) {
+		d.folders[strings.ToLower(dir)] = true
+	}
+}
+
+func (d *fakeDropbox) commit(w http.ResponseWriter, p string, data []byte) {
+	d.createParents(p)
+	d.files[strings.ToLower(p)] = data
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{".tag": "file", "name": path.Base(p), "size": len(data), "content_hash": testContentHash(data)})
+}
+
+func (d *fakeDropbox) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	d.m.Lock()
+	defer d.m.Unlock()
+
+	if r.URL.Path == "/oauth2/token" {
+		if r.FormValue("grant_type") != "refresh_token" || r.FormValue("refresh_token") != d.refreshToken || r.FormValue("client_id") != "app-key" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		d.refreshed++
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"access_token": d.accessToken, "token_type": "bearer", "expires_in": 14400})
+		return
+	}
+
+	if r.Header.Get("Authorization") != "Bearer "+d.accessToken {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	var arg struct {
+		Path        string      `json:"path"`
+		Recursive   bool        `json:"recursive"`
+		Cursor      interface{} `json:"cursor"`
+		Commit      commitInfo  `json:"commit"`
+		ContentHash string      `json:"content_hash"`
+	}
+	if h := r.Header.Get("Dropbox-API-Arg"); h != "" {
+		if err := json.Unmarshal([]byte(h), &arg); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	} else if err := json.NewDecoder(r.Body).Decode(&arg); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	key := strings.ToLower(arg.Path)
+
+	switch strings.TrimPrefix(r.URL.Path, "/2/") {
+	case "files/upload":
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			return
+		}
+		if arg.ContentHash != "" && arg.ContentHash != testContentHash(data) {
+			conflict(w, "content_hash_mismatch/")
+			return
+		}
+		d.commit(w, arg.Path, data)
+
+	case "files/upload_session/start":
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			return
+		}
+		id := fmt.Sprintf("session-%d", len(d.sessions))
+		d.sessions[id] = data
+		_ = json.NewEncoder(w).Encode(map[string]string{"session_id": id})
+
+	case "files/upload_session/append_v2", "files/upload_session/finish":
+		cursor := arg.Cursor.(map[string]interface{})
+		id := cursor["session_id"].(string)
+		data, ok := d.sessions[id]
+		if !ok || int(cursor["offset"].(float64)) != len(data) {
+			conflict(w, "incorrect_offset/")
+			return
+		}
+		buf, err := io.ReadAll(r.Body)
+		if err != nil {
+			return
+		}
+		data = append(data, buf...)
+		if strings.HasSuffix(r.URL.Path, "finish") {
+			delete(d.sessions, id)
+			d.commit(w, arg.Commit.Path, data)
+			return
+		}
+		d.sessions[id] = data
+		_, _ = w.Write([]byte("null"))
+
+	case "files/download":
+		data, ok := d.files[key]
+		if !ok {
+			conflict(w, "path/not_found/")
+			return
+		}
+		if rng := r.Header.Get("Range"); rng != "" {
+			start, end, _ := strings.Cut(strings.TrimPrefix(rng, "bytes="), "-")
+			s, _ := strconv.Atoi(start)
+			e := len(data) - 1
+			if end != "" {
+				e, _ = strconv.Atoi(end)
+			}
+			if e >= len(data) {
+				e = len(data) - 1
+			}
+			if s > e {
+				data = nil
+			} else {
+				data = data[s : e+1]
+			}
+			w.WriteHeader(http.StatusPartialContent)
+		}
+		_, _ = w.Write(data)
+
+	case "files/get_metadata":
+		if data, ok := d.files[key]; ok {
+			_ = json.NewEncoder(w).Encode(metadata{Tag: "file", Name: path.Base(arg.Path), Size: int64(len(data))})
+		} else if d.folders[key] {
+			_ = json.NewEncoder(w).Encode(metadata{Tag: "folder", Name: path.Base(arg.Path)})
+		} else {
+			conflict(w, "path/not_found/")
+		}
+
+	case "files/create_folder_v2":
+		if d.folders[key] {
+			conflict(w, "path/conflict/folder/")
+			return
+		}
+		d.createParents(arg.Path)
+		d.folders[key] = true
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"metadata": metadata{Tag: "folder"}})
+
+	case "files/delete_v2":
+		if _, ok := d.files[key]; ok {
+			delete(d.files, key)
+		} else if d.folders[key] {
+			for name := range d.files {
+				if strings.HasPrefix(name, key+"/") {
+					delete(d.files, name)
+				}
+			}
+			for name := range d.folders {
+				if name == key || strings.HasPrefix(name, key+"/") {
+					delete(d.folders, name)
+				}
+			}
+		} else {
+			conflict(w, "path_lookup/not_found/")
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"metadata": metadata{}})
+
+	case "files/list_folder", "files/list_folder/continue":
+		offset := 0
+		if c, ok := arg.Cursor.(string); ok {
+			key, c, _ = strings.Cut(c, "|")
+			offset, _ = strconv.Atoi(c)
+			arg.Recursive = strings.HasSuffix(r.URL.Path, "continue")
+		} else if !d.folders[key] {
+			conflict(w, "path/not_found/")
+			return
+		}
+
+		var entries []metadata
+		for name, data := range d.files {
+			if path.Dir(name) == key || (arg.Recursive && strings.HasPrefix(name, key+"/")) {
+				entries = append(entries, metadata{Tag: "file", Name: path.Base(name), Size: int64(len(data))})
+			}
+		}
+		for name := range d.folders {
+			if path.Dir(name) == key || (arg.Recursive && strings.HasPrefix(name, key+"/")) {
+				entries = append(entries, metadata{Tag: "folder", Name: path.Base(name)})
+			}
+		}
+		sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+
+		res := listResult{Entries: entries[offset:]}
+		if len(res.Entries) > d.pageSize {
+			res.Entries = res.Entries[:d.pageSize]
+			res.HasMore = true
+			res.Cursor = key + "|" + strconv.Itoa(offset+d.pageSize)
+		}
+		_ = json.NewEncoder(w).Encode(res)
+
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// useFakeDropbox redirects all requests to a fake Dropbox server.
+func useFakeDropbox(t testing.TB) *fakeDropbox {
+	d := newFakeDropbox()
+	srv := httptest.NewServer(d)
+
+	oldAPI, oldContent, oldToken := apiURL, contentURL, tokenURL
+	apiURL, contentURL, tokenURL = srv.URL, srv.URL, srv.URL+"/oauth2/token"
+	t.Cleanup(func() {
+		apiURL, contentURL, tokenURL = oldAPI, oldContent, oldToken
+		srv.Close()
+	})
+	return d
+}
+
+func newTestSuite(t testing.TB, cfg Config) *test.Suite {
+	tr, err := backend.Transport(backend.TransportOptions{})
+	if err != nil {
+		t.Fatalf("cannot create transport for tests: %v", err)
+	}
+
+	return &test.Suite{
+		// NewConfig returns a config for a new temporary backend that will be used in tests.
+		NewConfig: func() (interface{}, error) {
+			cfg := cfg
+			cfg.Path = path.Join(cfg.Path, fmt.Sprintf("test-%d", time.Now().UnixNano()))
+			return cfg, nil
+		},
+
+		// CreateFn is a function that creates a temporary repository for the tests.
+		Create: func(config interface{}) (restic.Backend, error) {
+			cfg := config.(Config)
+			return Create(context.TODO(), cfg, tr)
+		},
+
+		// OpenFn is a function that opens a previously created temporary repository.
+		Open: func(config interface{}) (restic.Backend, error) {
+			cfg := config.(Config)
+			return Open(context.TODO(), cfg, tr)
+		},
+
+		// CleanupFn removes data created during the tests.
+		Cleanup: func(config interface{}) error {
+			cfg := config.(Config)
+			be, err := Open(context.TODO(), cfg, tr)
+			if err != nil {
+				return err
+			}
+			return be.Delete(context.TODO())
+		},
+	}
+}
+
+func TestBackendDropbox(t *testing.T) {
+	d := useFakeDropbox(t)
+
+	cfg := NewConfig()
+	cfg.Path = "/restic-test"
+	cfg.AccessToken = options.NewSecretString(d.accessToken)
+	newTestSuite(t, cfg).RunTests(t)
+}
+
+func TestBackendDropboxChunked(t *testing.T) {
+	d := useFakeDropbox(t)
+
+	// the test files are all smaller than 9 MiB
+	cfg := NewConfig()
+	cfg.Path = "/restic-test"
+	cfg.ChunkSize = 1
+	cfg.RefreshToken = options.NewSecretString(d.refreshToken)
+	cfg.AppKey = "app-key"
+	newTestSuite(t, cfg).RunTests(t)
+
+	rtest.Assert(t, d.refreshed > 0, "access token was never requested")
+}
+
+func TestBackendDropboxExternal(t *testing.T) {
+	token := os.Getenv("RESTIC_TEST_DROPBOX_ACCESS_TOKEN")
+	if token == "" {
+		t.Skipf("environment variable %v not set", "RESTIC_TEST_DROPBOX_ACCESS_TOKEN")
+	}
+
+	cfg := NewConfig()
+	cfg.Path = "/restic-test"
+	cfg.AccessToken = options.NewSecretString(token)
+	newTestSuite(t, cfg).RunTests(t)
+}
+
+// testContentHash computes the Dropbox content hash of data independently
+// from contentHash.
+func testContentHash(data []byte) string {
+	var sums []byte
+	for len(data) > 0 {
+		n := len(data)
+		if n > contentHashBlockSize {
+			n = contentHashBlockSize
+		}
+		sum := sha256.Sum256(data[:n])
+		sums = append(sums, sum[:]...)
+		data = data[n:]
+	}
+	sum := sha256.Sum256(sums)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestContentHash(t *testing.T) {
+	for _, size := range []int{0, 1, contentHashBlockSize - 1, contentHashBlockSize, contentHashBlockSize + 1, 3*contentHashBlockSize + 12345} {
+		data := rtest.Random(size, size)
+		want := testContentHash(data)
+
+		h := newContentHash()
+		// write in odd sized pieces which cross the block boundaries
+		for buf := data; len(buf) > 0; {
+			n := 1000003
+			if n > len(buf) {
+				n = len(buf)
+			}
+			_, err := h.Write(buf[:n])
+			rtest.OK(t, err)
+			buf = buf[n:]
+		}
+
+		// Sum must not change the state of the hash
+		rtest.Equals(t, want, hex.EncodeToString(h.Sum(nil)))
+		rtest.Equals(t, want, hex.EncodeToString(h.Sum(nil)))
+
+		h.Reset()
+		_, err := h.Write(data)
+		rtest.OK(t, err)
+		rtest.Equals(t, want, hex.EncodeToString(h.Sum(nil)))
+	}
+}
+
+func TestAPIArg(t *testing.T) {
+	arg, err := apiArg(map[string]string{"path": "/Sicherungen/Gebäude 🏠"})
+	rtest.OK(t, err)
+	rtest.Equals(t, `{"path":"/Sicherungen/Geb\u00e4ude \ud83c\udfe0"}`, arg)
+
+	var decoded map[string]string
+	rtest.OK(t, json.Unmarshal([]byte(arg), &decoded))
+	rtest.Equals(t, "/Sicherungen/Gebäude 🏠", decoded["path"])
+}
@@ -17,6 +17,7 @@ type Config struct {
 	Prefix    string
 
 	Connections uint `option:"connections" help:"set a limit for the number of concurrent connections (default: 5)"`
+	ChunkSize   uint `option:"chunk-size" help:"use resumable uploads with chunks of the given size in MiB (default: 0, disabled)"`
 }
 
 // NewConfig returns a new Config with the default values filled in.
@@ -37,6 +37,7 @@ type Backend struct {
 	gcsClient    *storage.Client
 	projectID    string
 	connections  uint
+	chunkSize    uint
 	sem          sema.Semaphore
 	bucketName   string
 	bucket       *storage.BucketHandle
@@ -108,6 +109,7 @@ func open(cfg Config, rt http.RoundTripper) (*Backend, error) {
 		gcsClient:   gcsClient,
 		projectID:   cfg.ProjectID,
 		connections: cfg.Connections,
+		chunkSize:   cfg.ChunkSize * 1024 * 1024,
 		sem:         sem,
 		bucketName:  cfg.Bucket,
 		bucket:      gcsClient.Bucket(cfg.Bucket),
@@ -240,9 +242,11 @@ func (be *Backend) Save(ctx context.Context, h restic.Handle, rd restic.RewindRe
 	// in better rate limiting behavior.
 	//
 	// restic typically writes small blobs (4MB-30MB), so the resumable
-	// uploads are not providing significant benefit anyways.
+	// uploads are not providing significant benefit anyways. They can be
+	// enabled using the chunk-size option for large pack sizes or unreliable
+	// connections.
 	w := be.bucket.Object(objName).NewWriter(ctx)
-	w.ChunkSize = 0
+	w.ChunkSize = int(be.chunkSize)
 	w.MD5 = rd.Hash()
 	wbytes, err := io.Copy(w, rd)
 	cerr := w.Close()
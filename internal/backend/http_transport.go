@@ -6,12 +6,15 @@ import (
 	"encoding/pem"
 	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"strings"
 	"time"
 
 	"github.com/restic/restic/internal/debug"
 	"github.com/restic/restic/internal/errors"
+
+	"golang.org/x/net/http/httpproxy"
 )
 
 // TransportOptions collects various options which can be set for an HTTP based
@@ -23,8 +26,57 @@ type TransportOptions struct {
 	// contains the name of a file containing the TLS client certificate and private key in PEM format
 	TLSClientCertKeyFilename string
 
+	// contains the name of a file containing the private key in PEM format,
+	// if it is not included in TLSClientCertKeyFilename
+	TLSClientKeyFilename string
+
 	// Skip TLS certificate verification
 	InsecureTLS bool
+
+	// URL of the proxy to use instead of the proxy configured in the
+	// environment. Credentials for the proxy can be included in the URL.
+	Proxy string
+}
+
+// proxyFunc returns the function which selects the proxy for a request. A
+// configured proxy is used for all requests except those to hosts in
+// $NO_PROXY.
+func proxyFunc(proxy string) (func(*http.Request) (*url.URL, error), error) {
+	if proxy == "" {
+		return http.ProxyFromEnvironment, nil
+	}
+
+	u, err := url.Parse(proxy)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse proxy URL")
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return nil, errors.Errorf("unsupported proxy URL %q, must start with http://, https:// or socks5://", u.Redacted())
+	}
+	if u.Host == "" {
+		return nil, errors.Errorf("proxy URL %q does not contain a host", u.Redacted())
+	}
+
+	cfg := httpproxy.Config{
+		HTTPProxy:  proxy,
+		HTTPSProxy: proxy,
+		NoProxy:    getEnvAny("NO_PROXY", "no_proxy"),
+	}
+	f := cfg.ProxyFunc()
+	return func(req *http.Request) (*url.URL, error) {
+		return f(req.URL)
+	}, nil
+}
+
+func getEnvAny(names ...string) string {
+	for _, name := range names {
+		if value := os.Getenv(name); value != "" {
+			return value
+		}
+	}
+	return ""
 }
 
 // readPEMCertKey reads a file and returns the PEM encoded certificate and key
@@ -65,9 +117,14 @@ func readPEMCertKey(filename string) (certs []byte, key []byte, err error) {
 // a custom rootCertFilename is non-empty, it must point to a valid PEM file,
 // otherwise the function will return an error.
 func Transport(opts TransportOptions) (http.RoundTripper, error) {
+	proxy, err := proxyFunc(opts.Proxy)
+	if err != nil {
+		return nil, err
+	}
+
 	// copied from net/http
 	tr := &http.Transport{
-		Proxy: http.ProxyFromEnvironment,
+		Proxy: proxy,
 		DialContext: (&net.Dialer{
 			Timeout:   30 * time.Second,
 			KeepAlive: 30 * time.Second,
@@ -82,6 +139,10 @@ func Transport(opts TransportOptions) (http.RoundTripper, error) {
 		TLSClientConfig:       &tls.Config{},
 	}
 
+	if opts.TLSClientKeyFilename != "" && opts.TLSClientCertKeyFilename == "" {
+		return nil, errors.Errorf("TLS client key %v specified without a client certificate", opts.TLSClientKeyFilename)
+	}
+
 	if opts.InsecureTLS {
 		tr.TLSClientConfig.InsecureSkipVerify = true
 	}
@@ -92,6 +153,21 @@ func Transport(opts TransportOptions) (http.RoundTripper, error) {
 			return nil, err
 		}
 
+		if opts.TLSClientKeyFilename != "" {
+			if key != nil {
+				return nil, errors.Errorf("error loading TLS cert and key from %v: private key already contained in certificate file", opts.TLSClientKeyFilename)
+			}
+
+			var extraCerts []byte
+			extraCerts, key, err = readPEMCertKey(opts.TLSClientKeyFilename)
+			if err != nil {
+				return nil, err
+			}
+			if extraCerts != nil {
+				return nil, errors.Errorf("error loading TLS key from %v: certificate found in key file", opts.TLSClientKeyFilename)
+			}
+		}
+
 		crt, err := tls.X509KeyPair(certs, key)
 		if err != nil {
 			return nil, errors.Errorf("parse TLS client cert or key: %v", err)
@@ -0,0 +1,263 @@
+package backend
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	rtest "github.com/restic/restic/internal/test"
+)
+
+// testCert is a certificate with its private key, signed by the CA.
+type testCert struct {
+	cert *x509.Certificate
+	der  []byte
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCert(t testing.TB, template *x509.Certificate, ca *testCert) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	rtest.OK(t, err)
+
+	parent, signer := template, key
+	if ca != nil {
+		parent, signer = ca.cert, ca.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, signer)
+	rtest.OK(t, err)
+	cert, err := x509.ParseCertificate(der)
+	rtest.OK(t, err)
+
+	return &testCert{cert: cert, der: der, key: key}
+}
+
+func (c *testCert) certPEM() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.der})
+}
+
+func (c *testCert) keyPEM(t testing.TB) []byte {
+	buf, err := x509.MarshalECPrivateKey(c.key)
+	rtest.OK(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: buf})
+}
+
+func (c *testCert) tlsCertificate() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{c.der}, PrivateKey: c.key}
+}
+
+func writeFile(t testing.TB, dir, name string, data ...[]byte) string {
+	var buf []byte
+	for _, d := range data {
+		buf = append(buf, d...)
+	}
+	filename := filepath.Join(dir, name)
+	rtest.OK(t, os.WriteFile(filename, buf, 0600))
+	return filename
+}
+
+func TestTransportClientCert(t *testing.T) {
+	notBefore := time.Now().Add(-time.Hour)
+	notAfter := time.Now().Add(time.Hour)
+
+	ca := newTestCert(t, &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}, nil)
+	server := newTestCert(t, &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "server"},
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, ca)
+	client := newTestCert(t, &x509.Certificate{
+		SerialNumber: big.NewInt(3),
+		Subject:      pkix.Name{CommonName: "client"},
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, ca)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	srv.TLS = &tls.Config{
+		Certificates: []tls.Certificate{server.tlsCertificate()},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    pool,
+	}
+	srv.StartTLS()
+	defer srv.Close()
+
+	dir := rtest.TempDir(t)
+	caFile := writeFile(t, dir, "ca.pem", ca.certPEM())
+	certKeyFile := writeFile(t, dir, "client.pem", client.certPEM(), client.keyPEM(t))
+	certFile := writeFile(t, dir, "client.crt", client.certPEM())
+	keyFile := writeFile(t, dir, "client.key", client.keyPEM(t))
+
+	var tests = []struct {
+		name string
+		opts TransportOptions
+		ok   bool
+	}{
+		{"combined", TransportOptions{RootCertFilenames: []string{caFile}, TLSClientCertKeyFilename: certKeyFile}, true},
+		{"separate", TransportOptions{RootCertFilenames: []string{caFile}, TLSClientCertKeyFilename: certFile, TLSClientKeyFilename: keyFile}, true},
+		{"no-client-cert", TransportOptions{RootCertFilenames: []string{caFile}}, false},
+		{"unknown-ca", TransportOptions{TLSClientCertKeyFilename: certKeyFile}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rt, err := Transport(test.opts)
+			rtest.OK(t, err)
+
+			resp, err := (&http.Client{Transport: rt}).Get(srv.URL)
+			if !test.ok {
+				rtest.Assert(t, err != nil, "request succeeded unexpectedly")
+				return
+			}
+			rtest.OK(t, err)
+			rtest.OK(t, resp.Body.Close())
+			rtest.Equals(t, http.StatusOK, resp.StatusCode)
+		})
+	}
+}
+
+func TestTransportClientKeyErrors(t *testing.T) {
+	dir := rtest.TempDir(t)
+	ca := newTestCert(t, &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}, nil)
+	certFile := writeFile(t, dir, "client.crt", ca.certPEM())
+	certKeyFile := writeFile(t, dir, "client.pem", ca.certPEM(), ca.keyPEM(t))
+	keyFile := writeFile(t, dir, "client.key", ca.keyPEM(t))
+
+	for _, opts := range []TransportOptions{
+		{TLSClientKeyFilename: keyFile},
+		{TLSClientCertKeyFilename: certKeyFile, TLSClientKeyFilename: keyFile},
+		{TLSClientCertKeyFilename: certFile, TLSClientKeyFilename: certFile},
+	} {
+		_, err := Transport(opts)
+		rtest.Assert(t, err != nil, "expected error for %#v", opts)
+	}
+}
+
+// testProxy is an HTTP proxy which requires basic authentication. CONNECT
+// requests are tunneled to target, regardless of the requested host.
+type testProxy struct {
+	t      testing.TB
+	target string
+
+	m        sync.Mutex
+	requests []string
+}
+
+func (p *testProxy) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Header.Get("Proxy-Authorization") != "Basic "+base64.StdEncoding.EncodeToString([]byte("user:secret")) {
+		w.WriteHeader(http.StatusProxyAuthRequired)
+		return
+	}
+	p.m.Lock()
+	p.requests = append(p.requests, req.Method+" "+req.RequestURI)
+	p.m.Unlock()
+
+	if req.Method != http.MethodConnect {
+		_, _ = io.WriteString(w, "proxied")
+		return
+	}
+
+	conn, err := net.Dial("tcp", p.target)
+	if err != nil {
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+
+	client, buf, err := w.(http.Hijacker).Hijack()
+	rtest.OK(p.t, err)
+
+	go func() {
+		_, _ = io.Copy(conn, buf)
+		_ = conn.Close()
+	}()
+	_, _ = io.Copy(client, conn)
+	_ = client.Close()
+}
+
+func TestTransportProxy(t *testing.T) {
+	target := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		_, _ = io.WriteString(w, "direct")
+	}))
+	defer target.Close()
+
+	proxy := &testProxy{t: t, target: target.Listener.Addr().String()}
+	proxySrv := httptest.NewServer(proxy)
+	defer proxySrv.Close()
+
+	dir := rtest.TempDir(t)
+	caFile := writeFile(t, dir, "ca.pem", pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: target.Certificate().Raw}))
+
+	proxyURL := strings.Replace(proxySrv.URL, "http://", "http://user:secret@", 1)
+	rt, err := Transport(TransportOptions{RootCertFilenames: []string{caFile}, Proxy: proxyURL})
+	rtest.OK(t, err)
+	client := &http.Client{Transport: rt}
+
+	get := func(url string) string {
+		resp, err := client.Get(url)
+		rtest.OK(t, err)
+		buf, err := io.ReadAll(resp.Body)
+		rtest.OK(t, err)
+		rtest.OK(t, resp.Body.Close())
+		rtest.Equals(t, http.StatusOK, resp.StatusCode)
+		return string(buf)
+	}
+
+	// plain HTTP requests are forwarded by the proxy, HTTPS uses CONNECT.
+	// The test certificate is valid for example.com.
+	rtest.Equals(t, "proxied", get("http://example.com/config"))
+	rtest.Equals(t, "direct", get("https://example.com/config"))
+	proxy.m.Lock()
+	rtest.Equals(t, []string{"GET http://example.com/config", "CONNECT example.com:443"}, proxy.requests)
+	proxy.m.Unlock()
+
+	// missing credentials are rejected by the proxy
+	rt, err = Transport(TransportOptions{Proxy: proxySrv.URL})
+	rtest.OK(t, err)
+	resp, err := (&http.Client{Transport: rt}).Get("http://example.com/config")
+	rtest.OK(t, err)
+	rtest.OK(t, resp.Body.Close())
+	rtest.Equals(t, http.StatusProxyAuthRequired, resp.StatusCode)
+}
+
+func TestTransportProxyInvalid(t *testing.T) {
+	for _, proxy := range []string{"ftp://proxy:21", "http://", "://proxy"} {
+		_, err := Transport(TransportOptions{Proxy: proxy})
+		rtest.Assert(t, err != nil, "missing error for proxy %q", proxy)
+	}
+}
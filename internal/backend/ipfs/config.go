@@ -0,0 +1,54 @@
+package ipfs
+
+import (
+	"path"
+	"strings"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/options"
+)
+
+// Config contains all configuration necessary to store a repository in the
+// mutable file system (MFS) of an IPFS node.
+type Config struct {
+	Path string
+
+	API         string `option:"api" help:"URL of the RPC API of the IPFS node (default: http://127.0.0.1:5001)"`
+	Connections uint   `option:"connections" help:"set a limit for the number of concurrent connections (default: 5)"`
+}
+
+// NewConfig returns a new Config with the default values filled in.
+func NewConfig() Config {
+	return Config{
+		API:         "http://127.0.0.1:5001",
+		Connections: 5,
+	}
+}
+
+func init() {
+	options.Register("ipfs", Config{})
+}
+
+// ParseConfig parses the string s and extracts the ipfs config. The
+// supported configuration format is ipfs:/path, where the path is a
+// directory in the MFS of the node.
+func ParseConfig(s string) (interface{}, error) {
+	if !strings.HasPrefix(s, "ipfs:") {
+		return nil, errors.New("ipfs: invalid format")
+	}
+
+	// strip prefix "ipfs:"
+	p := s[5:]
+	if !strings.HasPrefix(p, "/") {
+		return nil, errors.New("ipfs: invalid format: path must be absolute")
+	}
+
+	p = path.Clean(p)
+	if p == "/" {
+		return nil, errors.New("ipfs: invalid format: the repository cannot be stored in the MFS root")
+	}
+
+	cfg := NewConfig()
+	cfg.Path = p
+	return cfg, nil
+}
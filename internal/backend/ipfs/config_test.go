@@ -0,0 +1,49 @@
+package ipfs
+
+import "testing"
+
+var configTests = []struct {
+	s   string
+	cfg Config
+}{
+	{"ipfs:/restic", Config{
+		Path:        "/restic",
+		API:         "http://127.0.0.1:5001",
+		Connections: 5,
+	}},
+	{"ipfs:/backups/host/", Config{
+		Path:        "/backups/host",
+		API:         "http://127.0.0.1:5001",
+		Connections: 5,
+	}},
+}
+
+func TestParseConfig(t *testing.T) {
+	for i, test := range configTests {
+		cfg, err := ParseConfig(test.s)
+		if err != nil {
+			t.Errorf("test %d:%s failed: %v", i, test.s, err)
+			continue
+		}
+
+		if cfg != test.cfg {
+			t.Errorf("test %d:\ninput:\n  %s\n wrong config, want:\n  %v\ngot:\n  %v",
+				i, test.s, test.cfg, cfg)
+			continue
+		}
+	}
+}
+
+func TestParseConfigInvalid(t *testing.T) {
+	for _, s := range []string{
+		"ipfs:",
+		"ipfs:/",
+		"ipfs:relative/path",
+		"ipfs:QmYwAPJzv5CZsnA625s3Xf2nemtYgPpHdWEz79ojWnPbdG",
+	} {
+		_, err := ParseConfig(s)
+		if err == nil {
+			t.Errorf("expected error for %q", s)
+		}
+	}
+}
@@ -0,0 +1,422 @@
+package ipfs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/restic/restic/internal/backend"
+	"github.com/restic/restic/internal/backend/layout"
+	"github.com/restic/restic/internal/backend/sema"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+
+	"github.com/cenkalti/backoff/v4"
+)
+
+// make sure the ipfs backend implements restic.Backend
+var _ restic.Backend = &Backend{}
+
+// Backend stores the repository as files in the mutable file system (MFS) of
+// an IPFS node, which is accessed using the RPC API of the node. All files
+// are stored as regular IPFS objects, the CID of the repository directory can
+// be pinned on other nodes to replicate the repository.
+type Backend struct {
+	api         string
+	root        string
+	connections uint
+	sem         sema.Semaphore
+	client      http.Client
+	layout.Layout
+}
+
+// Open opens the ipfs backend with the given config.
+func Open(cfg Config, rt http.RoundTripper) (*Backend, error) {
+	debug.Log("open, config %#v", cfg)
+
+	sem, err := sema.New(cfg.Connections)
+	if err != nil {
+		return nil, err
+	}
+
+	api, err := url.Parse(cfg.API)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse API URL")
+	}
+	if api.Scheme != "http" && api.Scheme != "https" {
+		return nil, errors.Errorf("ipfs: unsupported API URL %q", cfg.API)
+	}
+
+	be := &Backend{
+		api:         strings.TrimSuffix(api.String(), "/"),
+		root:        cfg.Path,
+		client:      http.Client{Transport: rt},
+		Layout:      &layout.DefaultLayout{Path: cfg.Path, Join: path.Join},
+		connections: cfg.Connections,
+		sem:         sem,
+	}
+
+	return be, nil
+}
+
+// Create creates all the necessary directories for a new repository in the
+// MFS of the IPFS node.
+func Create(ctx context.Context, cfg Config, rt http.RoundTripper) (*Backend, error) {
+	be, err := Open(cfg, rt)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = be.Stat(ctx, restic.Handle{Type: restic.ConfigFile})
+	if err == nil {
+		return nil, errors.Fatal("config file already exists")
+	}
+	if !be.IsNotExist(err) {
+		return nil, err
+	}
+
+	for _, dir := range be.Paths() {
+		err = be.call(ctx, "files/mkdir", url.Values{"arg": {dir}, "parents": {"true"}}, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return be, nil
+}
+
+// apiError is an error returned by the RPC API of the IPFS node.
+type apiError struct {
+	Message string
+}
+
+func (e *apiError) Error() string {
+	return "ipfs: " + e.Message
+}
+
+// payload is the body of a request, which is sent as a multipart form.
+type payload struct {
+	rd          io.Reader
+	length      int64
+	contentType string
+}
+
+// newPayload returns a multipart form containing the data from rd as a
+// file. The length of the form is known in advance, such that no chunked
+// encoding is necessary.
+func newPayload(rd restic.RewindReader) (*payload, error) {
+	var header bytes.Buffer
+	mw := multipart.NewWriter(&header)
+	_, err := mw.CreateFormFile("file", "data")
+	if err != nil {
+		return nil, err
+	}
+	trailer := "\r\n--" + mw.Boundary() + "--\r\n"
+
+	return &payload{
+		rd:          io.MultiReader(&header, rd, strings.NewReader(trailer)),
+		length:      int64(header.Len()) + rd.Length() + int64(len(trailer)),
+		contentType: mw.FormDataContentType(),
+	}, nil
+}
+
+// request sends an RPC API request for the command cmd. The caller must close
+// the body of the response.
+func (b *Backend) request(ctx context.Context, cmd string, args url.Values, body *payload) (*http.Response, error) {
+	u := b.api + "/api/v0/" + cmd + "?" + args.Encode()
+
+	var rd io.Reader
+	if body != nil {
+		// make sure that client.Do() cannot close the reader by wrapping it
+		rd = io.NopCloser(body.rd)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, rd)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if body != nil {
+		req.ContentLength = body.length
+		req.Header.Set("Content-Type", body.contentType)
+	}
+
+	b.sem.GetToken()
+	resp, err := b.client.Do(req)
+	b.sem.ReleaseToken()
+	if err != nil {
+		return nil, errors.Wrap(err, "client.Do")
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer func() {
+			_, _ = io.Copy(io.Discard, resp.Body)
+			_ = resp.Body.Close()
+		}()
+
+		var apiErr apiError
+		if err := json.NewDecoder(resp.Body).Decode(&apiErr); err != nil || apiErr.Message == "" {
+			return nil, errors.Errorf("unexpected HTTP response (%v): %v", resp.StatusCode, resp.Status)
+		}
+		return nil, &apiErr
+	}
+
+	return resp, nil
+}
+
+// call sends a request and decodes the JSON response into result, if it's
+// not nil.
+func (b *Backend) call(ctx context.Context, cmd string, args url.Values, body *payload, result interface{}) error {
+	resp, err := b.request(ctx, cmd, args, body)
+	if err != nil {
+		return err
+	}
+
+	if result != nil {
+		err = json.NewDecoder(resp.Body).Decode(result)
+		if err != nil {
+			_ = resp.Body.Close()
+			return errors.Wrap(err, "Decode")
+		}
+	}
+
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return errors.Wrap(resp.Body.Close(), "Close")
+}
+
+func (b *Backend) Connections() uint {
+	return b.connections
+}
+
+// Location returns this backend's location (the path in the MFS).
+func (b *Backend) Location() string {
+	return b.root
+}
+
+// Hasher may return a hash function for calculating a content hash for the backend
+func (b *Backend) Hasher() hash.Hash {
+	return nil
+}
+
+// HasAtomicReplace returns whether Save() can atomically replace files
+func (b *Backend) HasAtomicReplace() bool {
+	// files/write truncates the file before writing
+	return false
+}
+
+// Save stores data in the backend at the handle.
+func (b *Backend) Save(ctx context.Context, h restic.Handle, rd restic.RewindReader) error {
+	if err := h.Valid(); err != nil {
+		return backoff.Permanent(err)
+	}
+
+	body, err := newPayload(rd)
+	if err != nil {
+		return err
+	}
+
+	args := url.Values{
+		"arg":      {b.Filename(h)},
+		"create":   {"true"},
+		"truncate": {"true"},
+		"parents":  {"true"},
+	}
+	return b.call(ctx, "files/write", args, body, nil)
+}
+
+// notExistError is returned whenever the requested file does not exist in
+// the MFS.
+type notExistError struct {
+	restic.Handle
+}
+
+func (e *notExistError) Error() string {
+	return fmt.Sprintf("%v does not exist", e.Handle)
+}
+
+// isNotExist returns true if the node reported that the file does not exist.
+func isNotExist(err error) bool {
+	var e *apiError
+	return errors.As(err, &e) && strings.Contains(e.Message, "does not exist")
+}
+
+// IsNotExist returns true if the error was caused by a non-existing file.
+func (b *Backend) IsNotExist(err error) bool {
+	var e *notExistError
+	return errors.As(err, &e)
+}
+
+// Load runs fn with a reader that yields the contents of the file at h at the
+// given offset.
+func (b *Backend) Load(ctx context.Context, h restic.Handle, length int, offset int64, fn func(rd io.Reader) error) error {
+	return backend.DefaultLoad(ctx, h, length, offset, b.openReader, fn)
+}
+
+func (b *Backend) openReader(ctx context.Context, h restic.Handle, length int, offset int64) (io.ReadCloser, error) {
+	debug.Log("Load %v, length %v, offset %v", h, length, offset)
+	if err := h.Valid(); err != nil {
+		return nil, backoff.Permanent(err)
+	}
+
+	if offset < 0 {
+		return nil, errors.New("offset is negative")
+	}
+
+	if length < 0 {
+		return nil, errors.Errorf("invalid length %d", length)
+	}
+
+	args := url.Values{"arg": {b.Filename(h)}}
+	if offset > 0 {
+		args.Set("offset", strconv.FormatInt(offset, 10))
+	}
+	if length > 0 {
+		args.Set("count", strconv.Itoa(length))
+	}
+
+	resp, err := b.request(ctx, "files/read", args, nil)
+	if isNotExist(err) {
+		return nil, &notExistError{h}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Body, nil
+}
+
+// stat is the response of files/stat.
+type stat struct {
+	Size int64
+	Type string
+}
+
+// Stat returns information about a blob.
+func (b *Backend) Stat(ctx context.Context, h restic.Handle) (restic.FileInfo, error) {
+	if err := h.Valid(); err != nil {
+		return restic.FileInfo{}, backoff.Permanent(err)
+	}
+
+	var st stat
+	err := b.call(ctx, "files/stat", url.Values{"arg": {b.Filename(h)}}, nil, &st)
+	if isNotExist(err) {
+		return restic.FileInfo{}, &notExistError{h}
+	}
+	if err != nil {
+		return restic.FileInfo{}, err
+	}
+
+	if st.Type != "file" {
+		return restic.FileInfo{}, errors.Errorf("%v is not a file", h)
+	}
+
+	return restic.FileInfo{Size: st.Size, Name: h.Name}, nil
+}
+
+// Remove removes the blob with the given name and type.
+func (b *Backend) Remove(ctx context.Context, h restic.Handle) error {
+	if err := h.Valid(); err != nil {
+		return backoff.Permanent(err)
+	}
+
+	err := b.call(ctx, "files/rm", url.Values{"arg": {b.Filename(h)}}, nil, nil)
+	if isNotExist(err) {
+		return &notExistError{h}
+	}
+	return err
+}
+
+// listing is the response of files/ls.
+type listing struct {
+	Entries []struct {
+		Name string
+		Type int
+		Size int64
+	}
+}
+
+// entryTypeDirectory is the type of a directory in a listing.
+const entryTypeDirectory = 1
+
+// readDir returns the entries of the directory dir. A missing directory is
+// returned as empty.
+func (b *Backend) readDir(ctx context.Context, dir string) (listing, error) {
+	var l listing
+	err := b.call(ctx, "files/ls", url.Values{"arg": {dir}, "long": {"true"}}, nil, &l)
+	if isNotExist(err) {
+		return listing{}, nil
+	}
+	return l, err
+}
+
+// List runs fn for each file in the backend which has the type t. When an
+// error occurs (or fn returns an error), List stops and returns it.
+func (b *Backend) List(ctx context.Context, t restic.FileType, fn func(restic.FileInfo) error) error {
+	basedir, subdirs := b.Basedir(t)
+
+	dirs := []string{basedir}
+	if subdirs {
+		l, err := b.readDir(ctx, basedir)
+		if err != nil {
+			return err
+		}
+
+		dirs = dirs[:0]
+		for _, entry := range l.Entries {
+			if entry.Type == entryTypeDirectory {
+				dirs = append(dirs, path.Join(basedir, entry.Name))
+			}
+		}
+	}
+
+	for _, dir := range dirs {
+		l, err := b.readDir(ctx, dir)
+		if err != nil {
+			return err
+		}
+
+		for _, entry := range l.Entries {
+			if entry.Type == entryTypeDirectory {
+				continue
+			}
+
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			err := fn(restic.FileInfo{
+				Name: entry.Name,
+				Size: entry.Size,
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return ctx.Err()
+}
+
+// Close closes all open files.
+func (b *Backend) Close() error {
+	// this does not need to do anything, all open files are closed within the
+	// same function.
+	return nil
+}
+
+// Delete removes all data in the backend.
+func (b *Backend) Delete(ctx context.Context) error {
+	err := b.call(ctx, "files/rm", url.Values{"arg": {b.root}, "recursive": {"true"}}, nil, nil)
+	if isNotExist(err) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,239 @@
+package ipfs_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/restic/restic/internal/backend"
+	"github.com/restic/restic/internal/backend/ipfs"
+	"github.com/restic/restic/internal/backend/test"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+// fakeNode implements the subset of the files API of an IPFS node which is
+// used by the backend.
+type fakeNode struct {
+	m     sync.Mutex
+	files map[string][]byte
+	dirs  map[string]bool
+}
+
+func newFakeNode() *fakeNode {
+	return &fakeNode{
+		files: make(map[string][]byte),
+		dirs:  map[string]bool{"/": true},
+	}
+}
+
+func apiError(w http.ResponseWriter, msg string) {
+	w.WriteHeader(http.StatusInternalServerError)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"Message": msg, "Code": 0, "Type": "error"})
+}
+
+func (n *fakeNode) mkdirAll(dir string) {
+	for ; !n.dirs[dir]; dir = path.Dir(dir) {
+		n.dirs[dir] = true
+	}
+}
+
+func (n *fakeNode) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	n.m.Lock()
+	defer n.m.Unlock()
+
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query()
+	p := q.Get("arg")
+	_, isFile := n.files[p]
+
+	switch strings.TrimPrefix(r.URL.Path, "/api/v0/") {
+	case "files/mkdir":
+		n.mkdirAll(p)
+		w.WriteHeader(http.StatusOK)
+
+	case "files/write":
+		if q.Get("parents") == "true" {
+			n.mkdirAll(path.Dir(p))
+		}
+		if !n.dirs[path.Dir(p)] {
+			apiError(w, "file does not exist")
+			return
+		}
+		f, _, err := r.FormFile("file")
+		if err != nil {
+			apiError(w, err.Error())
+			return
+		}
+		buf, err := io.ReadAll(f)
+		if err != nil {
+			apiError(w, err.Error())
+			return
+		}
+		n.files[p] = buf
+		w.WriteHeader(http.StatusOK)
+
+	case "files/read":
+		if !isFile {
+			apiError(w, "file does not exist")
+			return
+		}
+		buf := n.files[p]
+		offset, _ := strconv.Atoi(q.Get("offset"))
+		if offset > len(buf) {
+			offset = len(buf)
+		}
+		buf = buf[offset:]
+		if count, err := strconv.Atoi(q.Get("count")); err == nil && count < len(buf) {
+			buf = buf[:count]
+		}
+		_, _ = w.Write(buf)
+
+	case "files/stat":
+		switch {
+		case isFile:
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"Size": len(n.files[p]), "Type": "file"})
+		case n.dirs[p]:
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"Size": 0, "Type": "directory"})
+		default:
+			apiError(w, "file does not exist")
+		}
+
+	case "files/ls":
+		if !n.dirs[p] {
+			apiError(w, "file does not exist")
+			return
+		}
+		type entry struct {
+			Name string
+			Type int
+			Size int
+		}
+		var entries []entry
+		for name, buf := range n.files {
+			if path.Dir(name) == p {
+				entries = append(entries, entry{Name: path.Base(name), Size: len(buf)})
+			}
+		}
+		for name := range n.dirs {
+			if name != "/" && path.Dir(name) == p {
+				entries = append(entries, entry{Name: path.Base(name), Type: 1})
+			}
+		}
+		sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"Entries": entries})
+
+	case "files/rm":
+		switch {
+		case isFile:
+			delete(n.files, p)
+		case n.dirs[p] && q.Get("recursive") == "true":
+			for name := range n.files {
+				if strings.HasPrefix(name, p+"/") {
+					delete(n.files, name)
+				}
+			}
+			for name := range n.dirs {
+				if name == p || strings.HasPrefix(name, p+"/") {
+					delete(n.dirs, name)
+				}
+			}
+		case n.dirs[p]:
+			apiError(w, p+" is a directory, use -r to remove directories")
+			return
+		default:
+			apiError(w, "file does not exist")
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func newTestSuite(t testing.TB, api string, minimalData bool) *test.Suite {
+	tr, err := backend.Transport(backend.TransportOptions{})
+	if err != nil {
+		t.Fatalf("cannot create transport for tests: %v", err)
+	}
+
+	return &test.Suite{
+		MinimalData: minimalData,
+
+		// NewConfig returns a config for a new temporary backend that will be used in tests.
+		NewConfig: func() (interface{}, error) {
+			cfg := ipfs.NewConfig()
+			cfg.API = api
+			cfg.Path = "/restic-test-" + restic.NewRandomID().String()[:8]
+			return cfg, nil
+		},
+
+		// CreateFn is a function that creates a temporary repository for the tests.
+		Create: func(config interface{}) (restic.Backend, error) {
+			cfg := config.(ipfs.Config)
+			return ipfs.Create(context.TODO(), cfg, tr)
+		},
+
+		// OpenFn is a function that opens a previously created temporary repository.
+		Open: func(config interface{}) (restic.Backend, error) {
+			cfg := config.(ipfs.Config)
+			return ipfs.Open(cfg, tr)
+		},
+
+		// CleanupFn removes data created during the tests.
+		Cleanup: func(config interface{}) error {
+			cfg := config.(ipfs.Config)
+			be, err := ipfs.Open(cfg, tr)
+			if err != nil {
+				return err
+			}
+			return be.Delete(context.TODO())
+		},
+	}
+}
+
+func TestBackendIPFS(t *testing.T) {
+	srv := httptest.NewServer(newFakeNode())
+	defer srv.Close()
+
+	newTestSuite(t, srv.URL, false).RunTests(t)
+}
+
+func TestBackendIPFSNode(t *testing.T) {
+	api := os.Getenv("RESTIC_TEST_IPFS_API")
+	if api == "" {
+		t.Skipf("environment variable %v not set", "RESTIC_TEST_IPFS_API")
+	}
+
+	newTestSuite(t, api, true).RunTests(t)
+}
+
+func TestBackendIPFSInvalidAPI(t *testing.T) {
+	cfg := ipfs.NewConfig()
+	cfg.Path = "/restic"
+	cfg.API = "unix:/run/ipfs.sock"
+
+	_, err := ipfs.Open(cfg, http.DefaultTransport)
+	rtest.Assert(t, err != nil, "expected error for unsupported API URL")
+}
+
+func BenchmarkBackendIPFS(t *testing.B) {
+	srv := httptest.NewServer(newFakeNode())
+	defer srv.Close()
+
+	newTestSuite(t, srv.URL, false).RunBenchmarks(t)
+}
@@ -1,6 +1,7 @@
 package limiter
 
 import (
+	"context"
 	"io"
 	"net/http"
 )
@@ -26,4 +27,8 @@ type Limiter interface {
 
 	// Transport returns an http.RoundTripper limited with the limiter.
 	Transport(http.RoundTripper) http.RoundTripper
+
+	// Request waits until another backend operation may be started, or
+	// until ctx is cancelled.
+	Request(ctx context.Context) error
 }
@@ -69,3 +69,62 @@ func (l *limitedReader) WriteTo(w io.Writer) (int64, error) {
 }
 
 var _ restic.Backend = (*rateLimitedBackend)(nil)
+
+// LimitRequests wraps a Backend and limits the rate at which operations are
+// started on the backend.
+func LimitRequests(be restic.Backend, l Limiter) restic.Backend {
+	return requestLimitedBackend{
+		Backend: be,
+		limiter: l,
+	}
+}
+
+type requestLimitedBackend struct {
+	restic.Backend
+	limiter Limiter
+}
+
+func (r requestLimitedBackend) Save(ctx context.Context, h restic.Handle, rd restic.RewindReader) error {
+	if err := r.limiter.Request(ctx); err != nil {
+		return err
+	}
+	return r.Backend.Save(ctx, h, rd)
+}
+
+func (r requestLimitedBackend) Load(ctx context.Context, h restic.Handle, length int, offset int64, consumer func(rd io.Reader) error) error {
+	if err := r.limiter.Request(ctx); err != nil {
+		return err
+	}
+	return r.Backend.Load(ctx, h, length, offset, consumer)
+}
+
+func (r requestLimitedBackend) Stat(ctx context.Context, h restic.Handle) (restic.FileInfo, error) {
+	if err := r.limiter.Request(ctx); err != nil {
+		return restic.FileInfo{}, err
+	}
+	return r.Backend.Stat(ctx, h)
+}
+
+func (r requestLimitedBackend) Remove(ctx context.Context, h restic.Handle) error {
+	if err := r.limiter.Request(ctx); err != nil {
+		return err
+	}
+	return r.Backend.Remove(ctx, h)
+}
+
+func (r requestLimitedBackend) List(ctx context.Context, t restic.FileType, fn func(restic.FileInfo) error) error {
+	if err := r.limiter.Request(ctx); err != nil {
+		return err
+	}
+	return r.Backend.List(ctx, t, fn)
+}
+
+// Warmup prepares the files for reading if the wrapped backend supports it.
+func (r requestLimitedBackend) Warmup(ctx context.Context, handles []restic.Handle) error {
+	if err := r.limiter.Request(ctx); err != nil {
+		return err
+	}
+	return restic.Warmup(ctx, r.Backend, handles)
+}
+
+var _ restic.Backend = (*requestLimitedBackend)(nil)
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"crypto/rand"
+	"errors"
 	"fmt"
 	"io"
 	"testing"
@@ -36,7 +37,7 @@ func TestLimitBackendSave(t *testing.T) {
 		}
 		return nil
 	}
-	limiter := NewStaticLimiter(Limits{42 * 1024, 42 * 1024})
+	limiter := NewStaticLimiter(Limits{UploadKb: 42 * 1024, DownloadKb: 42 * 1024})
 	limbe := LimitBackend(be, limiter)
 
 	rd := restic.NewByteReader(data, nil)
@@ -82,7 +83,7 @@ func TestLimitBackendLoad(t *testing.T) {
 			}
 			return newTracedReadCloser(src), nil
 		}
-		limiter := NewStaticLimiter(Limits{42 * 1024, 42 * 1024})
+		limiter := NewStaticLimiter(Limits{UploadKb: 42 * 1024, DownloadKb: 42 * 1024})
 		limbe := LimitBackend(be, limiter)
 
 		err := limbe.Load(context.TODO(), testHandle, 0, 0, func(rd io.Reader) error {
@@ -107,3 +108,25 @@ func TestLimitBackendLoad(t *testing.T) {
 			test.innerWriteTo, test.outerWriteTo)
 	}
 }
+
+func TestLimitRequests(t *testing.T) {
+	stats := 0
+	be := mock.NewBackend()
+	be.StatFn = func(ctx context.Context, h restic.Handle) (restic.FileInfo, error) {
+		stats++
+		return restic.FileInfo{Name: h.Name}, nil
+	}
+
+	limbe := LimitRequests(be, NewStaticLimiter(Limits{Requests: 1}))
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+
+	_, err := limbe.Stat(ctx, restic.Handle{Type: restic.PackFile, Name: "test"})
+	rtest.OK(t, err)
+
+	// the next request has to wait, and is aborted by cancelling the context
+	cancel()
+	_, err = limbe.Stat(ctx, restic.Handle{Type: restic.PackFile, Name: "test"})
+	rtest.Assert(t, errors.Is(err, context.Canceled), "unexpected error %v", err)
+	rtest.Equals(t, 1, stats)
+}
@@ -1,8 +1,10 @@
 package limiter
 
 import (
+	"context"
 	"io"
 	"net/http"
+	"time"
 
 	"github.com/juju/ratelimit"
 )
@@ -10,13 +12,15 @@ import (
 type staticLimiter struct {
 	upstream   *ratelimit.Bucket
 	downstream *ratelimit.Bucket
+	requests   *ratelimit.Bucket
 }
 
-// Limits represents static upload and download limits.
-// For both, zero means unlimited.
+// Limits represents static upload and download limits, and a limit for the
+// number of backend operations per second. For all, zero means unlimited.
 type Limits struct {
 	UploadKb   int
 	DownloadKb int
+	Requests   int
 }
 
 // NewStaticLimiter constructs a Limiter with a fixed (static) upload and
@@ -25,6 +29,7 @@ func NewStaticLimiter(l Limits) Limiter {
 	var (
 		upstreamBucket   *ratelimit.Bucket
 		downstreamBucket *ratelimit.Bucket
+		requestsBucket   *ratelimit.Bucket
 	)
 
 	if l.UploadKb > 0 {
@@ -35,9 +40,14 @@ func NewStaticLimiter(l Limits) Limiter {
 		downstreamBucket = ratelimit.NewBucketWithRate(toByteRate(l.DownloadKb), int64(toByteRate(l.DownloadKb)))
 	}
 
+	if l.Requests > 0 {
+		requestsBucket = ratelimit.NewBucketWithRate(float64(l.Requests), int64(l.Requests))
+	}
+
 	return staticLimiter{
 		upstream:   upstreamBucket,
 		downstream: downstreamBucket,
+		requests:   requestsBucket,
 	}
 }
 
@@ -57,6 +67,26 @@ func (l staticLimiter) DownstreamWriter(w io.Writer) io.Writer {
 	return l.limitWriter(w, l.downstream)
 }
 
+func (l staticLimiter) Request(ctx context.Context) error {
+	if l.requests == nil {
+		return nil
+	}
+
+	d := l.requests.Take(1)
+	if d == 0 {
+		return nil
+	}
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 type roundTripper func(*http.Request) (*http.Response, error)
 
 func (rt roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
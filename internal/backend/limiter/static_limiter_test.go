@@ -2,11 +2,14 @@ package limiter
 
 import (
 	"bytes"
+	"context"
 	"crypto/rand"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"testing"
+	"time"
 
 	"github.com/restic/restic/internal/test"
 )
@@ -16,10 +19,10 @@ func TestLimiterWrapping(t *testing.T) {
 	writer := new(bytes.Buffer)
 
 	for _, limits := range []Limits{
-		{0, 0},
-		{42, 0},
-		{0, 42},
-		{42, 42},
+		{0, 0, 0},
+		{42, 0, 0},
+		{0, 42, 0},
+		{42, 42, 0},
 	} {
 		limiter := NewStaticLimiter(limits)
 
@@ -48,7 +51,7 @@ func (r *tracedReadCloser) Close() error {
 }
 
 func TestRoundTripperReader(t *testing.T) {
-	limiter := NewStaticLimiter(Limits{42 * 1024, 42 * 1024})
+	limiter := NewStaticLimiter(Limits{UploadKb: 42 * 1024, DownloadKb: 42 * 1024})
 	data := make([]byte, 1234)
 	_, err := io.ReadFull(rand.Reader, data)
 	test.OK(t, err)
@@ -86,7 +89,7 @@ func TestRoundTripperReader(t *testing.T) {
 }
 
 func TestRoundTripperCornerCases(t *testing.T) {
-	limiter := NewStaticLimiter(Limits{42 * 1024, 42 * 1024})
+	limiter := NewStaticLimiter(Limits{UploadKb: 42 * 1024, DownloadKb: 42 * 1024})
 
 	rt := limiter.Transport(roundTripper(func(req *http.Request) (*http.Response, error) {
 		return &http.Response{}, nil
@@ -103,3 +106,24 @@ func TestRoundTripperCornerCases(t *testing.T) {
 	_, err = rt.RoundTrip(&http.Request{})
 	test.Assert(t, err != nil, "round tripper lost an error")
 }
+
+func TestRequestLimit(t *testing.T) {
+	limiter := NewStaticLimiter(Limits{Requests: 20})
+
+	start := time.Now()
+	// the first requests up to the rate are not delayed
+	for i := 0; i < 21; i++ {
+		test.OK(t, limiter.Request(context.TODO()))
+	}
+	d := time.Since(start)
+	test.Assert(t, d >= 40*time.Millisecond, "requests were not delayed, took %v", d)
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	cancel()
+	for i := 0; i < 2; i++ {
+		err := limiter.Request(ctx)
+		test.Assert(t, errors.Is(err, context.Canceled), "unexpected error %v", err)
+	}
+
+	test.OK(t, NewStaticLimiter(Limits{}).Request(ctx))
+}
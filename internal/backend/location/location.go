@@ -6,13 +6,17 @@ import (
 
 	"github.com/restic/restic/internal/backend/azure"
 	"github.com/restic/restic/internal/backend/b2"
+	"github.com/restic/restic/internal/backend/dropbox"
 	"github.com/restic/restic/internal/backend/gs"
+	"github.com/restic/restic/internal/backend/ipfs"
 	"github.com/restic/restic/internal/backend/local"
 	"github.com/restic/restic/internal/backend/rclone"
 	"github.com/restic/restic/internal/backend/rest"
 	"github.com/restic/restic/internal/backend/s3"
 	"github.com/restic/restic/internal/backend/sftp"
 	"github.com/restic/restic/internal/backend/swift"
+	"github.com/restic/restic/internal/backend/tape"
+	"github.com/restic/restic/internal/backend/webdav"
 	"github.com/restic/restic/internal/errors"
 )
 
@@ -40,6 +44,10 @@ var parsers = []parser{
 	{"azure", azure.ParseConfig, noPassword},
 	{"swift", swift.ParseConfig, noPassword},
 	{"rest", rest.ParseConfig, rest.StripPassword},
+	{"webdav", webdav.ParseConfig, webdav.StripPassword},
+	{"ipfs", ipfs.ParseConfig, noPassword},
+	{"dropbox", dropbox.ParseConfig, noPassword},
+	{"tape", tape.ParseConfig, noPassword},
 	{"rclone", rclone.ParseConfig, noPassword},
 }
 
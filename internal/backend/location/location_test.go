@@ -4,13 +4,18 @@ import (
 	"net/url"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/restic/restic/internal/backend/b2"
+	"github.com/restic/restic/internal/backend/dropbox"
+	"github.com/restic/restic/internal/backend/ipfs"
 	"github.com/restic/restic/internal/backend/local"
 	"github.com/restic/restic/internal/backend/rest"
 	"github.com/restic/restic/internal/backend/s3"
 	"github.com/restic/restic/internal/backend/sftp"
 	"github.com/restic/restic/internal/backend/swift"
+	"github.com/restic/restic/internal/backend/tape"
+	"github.com/restic/restic/internal/backend/webdav"
 )
 
 func parseURL(s string) *url.URL {
@@ -183,10 +188,13 @@ var parseTests = []struct {
 		"s3://eu-central-1/bucketname",
 		Location{Scheme: "s3",
 			Config: s3.Config{
-				Endpoint:    "eu-central-1",
-				Bucket:      "bucketname",
-				Prefix:      "",
-				Connections: 5,
+				Endpoint:       "eu-central-1",
+				Bucket:         "bucketname",
+				Prefix:         "",
+				Connections:    5,
+				RestoreDays:    7,
+				RestoreTimeout: 24 * time.Hour,
+				RestoreTier:    "Standard",
 			},
 		},
 	},
@@ -194,10 +202,13 @@ var parseTests = []struct {
 		"s3://hostname.foo/bucketname",
 		Location{Scheme: "s3",
 			Config: s3.Config{
-				Endpoint:    "hostname.foo",
-				Bucket:      "bucketname",
-				Prefix:      "",
-				Connections: 5,
+				Endpoint:       "hostname.foo",
+				Bucket:         "bucketname",
+				Prefix:         "",
+				Connections:    5,
+				RestoreDays:    7,
+				RestoreTimeout: 24 * time.Hour,
+				RestoreTier:    "Standard",
 			},
 		},
 	},
@@ -205,10 +216,13 @@ var parseTests = []struct {
 		"s3://hostname.foo/bucketname/prefix/directory",
 		Location{Scheme: "s3",
 			Config: s3.Config{
-				Endpoint:    "hostname.foo",
-				Bucket:      "bucketname",
-				Prefix:      "prefix/directory",
-				Connections: 5,
+				Endpoint:       "hostname.foo",
+				Bucket:         "bucketname",
+				Prefix:         "prefix/directory",
+				Connections:    5,
+				RestoreDays:    7,
+				RestoreTimeout: 24 * time.Hour,
+				RestoreTier:    "Standard",
 			},
 		},
 	},
@@ -216,10 +230,13 @@ var parseTests = []struct {
 		"s3:eu-central-1/repo",
 		Location{Scheme: "s3",
 			Config: s3.Config{
-				Endpoint:    "eu-central-1",
-				Bucket:      "repo",
-				Prefix:      "",
-				Connections: 5,
+				Endpoint:       "eu-central-1",
+				Bucket:         "repo",
+				Prefix:         "",
+				Connections:    5,
+				RestoreDays:    7,
+				RestoreTimeout: 24 * time.Hour,
+				RestoreTier:    "Standard",
 			},
 		},
 	},
@@ -227,10 +244,13 @@ var parseTests = []struct {
 		"s3:eu-central-1/repo/prefix/directory",
 		Location{Scheme: "s3",
 			Config: s3.Config{
-				Endpoint:    "eu-central-1",
-				Bucket:      "repo",
-				Prefix:      "prefix/directory",
-				Connections: 5,
+				Endpoint:       "eu-central-1",
+				Bucket:         "repo",
+				Prefix:         "prefix/directory",
+				Connections:    5,
+				RestoreDays:    7,
+				RestoreTimeout: 24 * time.Hour,
+				RestoreTier:    "Standard",
 			},
 		},
 	},
@@ -238,10 +258,13 @@ var parseTests = []struct {
 		"s3:https://hostname.foo/repo",
 		Location{Scheme: "s3",
 			Config: s3.Config{
-				Endpoint:    "hostname.foo",
-				Bucket:      "repo",
-				Prefix:      "",
-				Connections: 5,
+				Endpoint:       "hostname.foo",
+				Bucket:         "repo",
+				Prefix:         "",
+				Connections:    5,
+				RestoreDays:    7,
+				RestoreTimeout: 24 * time.Hour,
+				RestoreTier:    "Standard",
 			},
 		},
 	},
@@ -249,10 +272,13 @@ var parseTests = []struct {
 		"s3:https://hostname.foo/repo/prefix/directory",
 		Location{Scheme: "s3",
 			Config: s3.Config{
-				Endpoint:    "hostname.foo",
-				Bucket:      "repo",
-				Prefix:      "prefix/directory",
-				Connections: 5,
+				Endpoint:       "hostname.foo",
+				Bucket:         "repo",
+				Prefix:         "prefix/directory",
+				Connections:    5,
+				RestoreDays:    7,
+				RestoreTimeout: 24 * time.Hour,
+				RestoreTier:    "Standard",
 			},
 		},
 	},
@@ -260,11 +286,14 @@ var parseTests = []struct {
 		"s3:http://hostname.foo/repo",
 		Location{Scheme: "s3",
 			Config: s3.Config{
-				Endpoint:    "hostname.foo",
-				Bucket:      "repo",
-				Prefix:      "",
-				UseHTTP:     true,
-				Connections: 5,
+				Endpoint:       "hostname.foo",
+				Bucket:         "repo",
+				Prefix:         "",
+				UseHTTP:        true,
+				Connections:    5,
+				RestoreDays:    7,
+				RestoreTimeout: 24 * time.Hour,
+				RestoreTier:    "Standard",
 			},
 		},
 	},
@@ -297,6 +326,45 @@ var parseTests = []struct {
 			},
 		},
 	},
+	{
+		"webdav:https://hostname.foo/dav/",
+		Location{Scheme: "webdav",
+			Config: webdav.Config{
+				URL:         parseURL("https://hostname.foo/dav/"),
+				Connections: 5,
+			},
+		},
+	},
+	{
+		"ipfs:/backups/restic",
+		Location{Scheme: "ipfs",
+			Config: ipfs.Config{
+				Path:        "/backups/restic",
+				API:         "http://127.0.0.1:5001",
+				Connections: 5,
+			},
+		},
+	},
+	{
+		"tape:/srv/restic-repo",
+		Location{Scheme: "tape",
+			Config: tape.Config{
+				Path:        "/srv/restic-repo",
+				VolumeSize:  100 * 1024,
+				Connections: 2,
+			},
+		},
+	},
+	{
+		"dropbox:/backups/restic",
+		Location{Scheme: "dropbox",
+			Config: dropbox.Config{
+				Path:        "/backups/restic",
+				Connections: 4,
+				ChunkSize:   48,
+			},
+		},
+	},
 	{
 		"b2:bucketname:/prefix", Location{Scheme: "b2",
 			Config: b2.Config{
@@ -28,7 +28,7 @@ func newTestSuite(t testing.TB) *test.Suite {
 		Create: func(config interface{}) (restic.Backend, error) {
 			t.Logf("Create()")
 			cfg := config.(rclone.Config)
-			be, err := rclone.Create(context.TODO(), cfg)
+			be, err := rclone.Create(context.TODO(), cfg, nil)
 			var e *exec.Error
 			if errors.As(err, &e) && e.Err == exec.ErrNotFound {
 				t.Skipf("program %q not found", e.Name)
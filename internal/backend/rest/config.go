@@ -12,6 +12,10 @@ import (
 type Config struct {
 	URL         *url.URL
 	Connections uint `option:"connections" help:"set a limit for the number of concurrent connections (default: 5)"`
+
+	CACert        string `option:"cacert" help:"file to load the root certificates for the server from (default: --cacert)"`
+	TLSClientCert string `option:"tls-client-cert" help:"file containing the PEM encoded TLS client certificate (default: --tls-client-cert)"`
+	TLSClientKey  string `option:"tls-client-key" help:"file containing the PEM encoded private key of the client certificate, if not included in the certificate file"`
 }
 
 func init() {
@@ -4,20 +4,81 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"sync/atomic"
 	"time"
 
 	"github.com/cenkalti/backoff/v4"
 	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/restic"
 )
 
+// Backoff strategies supported by Options.
+const (
+	BackoffExponential = "exponential"
+	BackoffConstant    = "constant"
+)
+
+// Options configure how often and how long failed operations are retried.
+type Options struct {
+	// MaxTries is the number of retries after the first attempt.
+	MaxTries int
+	// Backoff is the strategy used to compute the delay between retries,
+	// either BackoffExponential or BackoffConstant.
+	Backoff string
+	// InitialInterval is the delay before the first retry. A constant
+	// backoff uses it as delay for all retries.
+	InitialInterval time.Duration
+	// MaxInterval limits the delay between retries.
+	MaxInterval time.Duration
+	// MaxElapsedTime limits the time spent retrying an operation, zero
+	// means no limit.
+	MaxElapsedTime time.Duration
+	// RequestTimeout limits the duration of a single attempt, zero means no
+	// limit. It is not applied to List, which may run for a long time. For
+	// Load, it only limits the time spent waiting for data from the backend,
+	// see loadWithTimeout.
+	RequestTimeout time.Duration
+}
+
+// DefaultOptions returns the options used by New.
+func DefaultOptions() Options {
+	return Options{
+		MaxTries:        10,
+		Backoff:         BackoffExponential,
+		InitialInterval: backoff.DefaultInitialInterval,
+		MaxInterval:     backoff.DefaultMaxInterval,
+		MaxElapsedTime:  backoff.DefaultMaxElapsedTime,
+	}
+}
+
+// Validate returns an error if the options are invalid.
+func (opts Options) Validate() error {
+	switch opts.Backoff {
+	case BackoffExponential, BackoffConstant:
+	default:
+		return errors.Errorf("invalid backoff strategy %q, must be %q or %q", opts.Backoff, BackoffExponential, BackoffConstant)
+	}
+
+	if opts.MaxTries < 0 {
+		return errors.Errorf("invalid number of retries %d", opts.MaxTries)
+	}
+	if opts.InitialInterval <= 0 || opts.MaxInterval <= 0 {
+		return errors.New("retry intervals must be positive")
+	}
+	if opts.MaxElapsedTime < 0 || opts.RequestTimeout < 0 {
+		return errors.New("retry and request timeouts must not be negative")
+	}
+	return nil
+}
+
 // Backend retries operations on the backend in case of an error with a
 // backoff.
 type Backend struct {
 	restic.Backend
-	MaxTries int
-	Report   func(string, error, time.Duration)
-	Success  func(string, int)
+	Options
+	Report  func(string, error, time.Duration)
+	Success func(string, int)
 }
 
 // statically ensure that RetryBackend implements restic.Backend.
@@ -28,11 +89,18 @@ var _ restic.Backend = &Backend{}
 // success is called with the number of retries before a successful operation
 // (it is not called if it succeeded on the first try)
 func New(be restic.Backend, maxTries int, report func(string, error, time.Duration), success func(string, int)) *Backend {
+	opts := DefaultOptions()
+	opts.MaxTries = maxTries
+	return NewWithOptions(be, opts, report, success)
+}
+
+// NewWithOptions is like New, but uses the retry policy described by opts.
+func NewWithOptions(be restic.Backend, opts Options, report func(string, error, time.Duration), success func(string, int)) *Backend {
 	return &Backend{
-		Backend:  be,
-		MaxTries: maxTries,
-		Report:   report,
-		Success:  success,
+		Backend: be,
+		Options: opts,
+		Report:  report,
+		Success: success,
 	}
 }
 
@@ -57,6 +125,86 @@ func retryNotifyErrorWithSuccess(operation backoff.Operation, b backoff.BackOff,
 
 var fastRetries = false
 
+// newBackOff returns the backoff for the configured strategy.
+func (be *Backend) newBackOff() backoff.BackOff {
+	bo := backoff.NewExponentialBackOff()
+	bo.InitialInterval = be.InitialInterval
+	bo.MaxInterval = be.MaxInterval
+	bo.MaxElapsedTime = be.MaxElapsedTime
+	if be.Backoff == BackoffConstant {
+		// a constant backoff which still honors MaxElapsedTime
+		bo.Multiplier = 1
+		bo.RandomizationFactor = 0
+	}
+	if fastRetries {
+		// speed up integration tests
+		bo.InitialInterval = 1 * time.Millisecond
+	}
+	bo.Reset()
+
+	return backoff.WithMaxRetries(bo, uint64(be.MaxTries))
+}
+
+// withTimeout runs f with a context that is cancelled after RequestTimeout.
+func (be *Backend) withTimeout(ctx context.Context, f func(ctx context.Context) error) error {
+	if be.RequestTimeout == 0 {
+		return f(ctx)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, be.RequestTimeout)
+	defer cancel()
+
+	err := f(ctx)
+	if err != nil && ctx.Err() == context.DeadlineExceeded {
+		return errors.Errorf("request timed out after %v: %v", be.RequestTimeout, err)
+	}
+	return err
+}
+
+// loadWithTimeout runs Load of the wrapped backend. It is aborted if either
+// the consumer is not called or a read of the consumer does not return within
+// RequestTimeout. The time the consumer spends processing the data does not
+// count towards the timeout. Waiting for the backend to prepare a file before
+// the download starts, such as the restore of an archived file, does count.
+func (be *Backend) loadWithTimeout(ctx context.Context, h restic.Handle, length int, offset int64, consumer func(rd io.Reader) error) error {
+	if be.RequestTimeout == 0 {
+		return be.Backend.Load(ctx, h, length, offset, consumer)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var timedOut int32
+	timer := time.AfterFunc(be.RequestTimeout, func() {
+		atomic.StoreInt32(&timedOut, 1)
+		cancel()
+	})
+	defer timer.Stop()
+
+	err := be.Backend.Load(ctx, h, length, offset, func(rd io.Reader) error {
+		timer.Stop()
+		return consumer(&timeoutReader{rd: rd, timer: timer, timeout: be.RequestTimeout})
+	})
+	if err != nil && atomic.LoadInt32(&timedOut) != 0 {
+		return errors.Errorf("request timed out after %v: %v", be.RequestTimeout, err)
+	}
+	return err
+}
+
+// timeoutReader runs timer while a read is in progress.
+type timeoutReader struct {
+	rd      io.Reader
+	timer   *time.Timer
+	timeout time.Duration
+}
+
+func (r *timeoutReader) Read(p []byte) (int, error) {
+	r.timer.Reset(r.timeout)
+	n, err := r.rd.Read(p)
+	r.timer.Stop()
+	return n, err
+}
+
 func (be *Backend) retry(ctx context.Context, msg string, f func() error) error {
 	// Don't do anything when called with an already cancelled context. There would be
 	// no retries in that case either, so be consistent and abort always.
@@ -68,14 +216,17 @@ func (be *Backend) retry(ctx context.Context, msg string, f func() error) error
 		return ctx.Err()
 	}
 
-	bo := backoff.NewExponentialBackOff()
-	if fastRetries {
-		// speed up integration tests
-		bo.InitialInterval = 1 * time.Millisecond
+	// retrying does not help if the error is fatal
+	operation := func() error {
+		err := f()
+		if err != nil && errors.IsFatal(err) {
+			return backoff.Permanent(err)
+		}
+		return err
 	}
 
-	err := retryNotifyErrorWithSuccess(f,
-		backoff.WithContext(backoff.WithMaxRetries(bo, uint64(be.MaxTries)), ctx),
+	err := retryNotifyErrorWithSuccess(operation,
+		backoff.WithContext(be.newBackOff(), ctx),
 		func(err error, d time.Duration) {
 			if be.Report != nil {
 				be.Report(msg, err, d)
@@ -99,7 +250,9 @@ func (be *Backend) Save(ctx context.Context, h restic.Handle, rd restic.RewindRe
 			return err
 		}
 
-		err = be.Backend.Save(ctx, h, rd)
+		err = be.withTimeout(ctx, func(ctx context.Context) error {
+			return be.Backend.Save(ctx, h, rd)
+		})
 		if err == nil {
 			return nil
 		}
@@ -128,7 +281,12 @@ func (be *Backend) Save(ctx context.Context, h restic.Handle, rd restic.RewindRe
 func (be *Backend) Load(ctx context.Context, h restic.Handle, length int, offset int64, consumer func(rd io.Reader) error) (err error) {
 	return be.retry(ctx, fmt.Sprintf("Load(%v, %v, %v)", h, length, offset),
 		func() error {
-			return be.Backend.Load(ctx, h, length, offset, consumer)
+			err := be.loadWithTimeout(ctx, h, length, offset, consumer)
+			if be.Backend.IsNotExist(err) {
+				// retrying does not make the file appear
+				return backoff.Permanent(err)
+			}
+			return err
 		})
 }
 
@@ -136,8 +294,10 @@ func (be *Backend) Load(ctx context.Context, h restic.Handle, length int, offset
 func (be *Backend) Stat(ctx context.Context, h restic.Handle) (fi restic.FileInfo, err error) {
 	err = be.retry(ctx, fmt.Sprintf("Stat(%v)", h),
 		func() error {
-			var innerError error
-			fi, innerError = be.Backend.Stat(ctx, h)
+			innerError := be.withTimeout(ctx, func(ctx context.Context) (err error) {
+				fi, err = be.Backend.Stat(ctx, h)
+				return err
+			})
 
 			if be.Backend.IsNotExist(innerError) {
 				// do not retry if file is not found, as stat is usually used  to check whether a file exists
@@ -151,7 +311,21 @@ func (be *Backend) Stat(ctx context.Context, h restic.Handle) (fi restic.FileInf
 // Remove removes a File with type t and name.
 func (be *Backend) Remove(ctx context.Context, h restic.Handle) (err error) {
 	return be.retry(ctx, fmt.Sprintf("Remove(%v)", h), func() error {
-		return be.Backend.Remove(ctx, h)
+		err := be.withTimeout(ctx, func(ctx context.Context) error {
+			return be.Backend.Remove(ctx, h)
+		})
+		if be.Backend.IsNotExist(err) {
+			return backoff.Permanent(err)
+		}
+		return err
+	})
+}
+
+// Warmup prepares the files for reading if the backend supports it. The
+// request timeout is not applied, as restoring archived files takes hours.
+func (be *Backend) Warmup(ctx context.Context, handles []restic.Handle) error {
+	return be.retry(ctx, fmt.Sprintf("Warmup(%d files)", len(handles)), func() error {
+		return restic.Warmup(ctx, be.Backend, handles)
 	})
 }
 
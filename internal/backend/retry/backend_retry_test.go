@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"io"
+	"strings"
 	"testing"
 	"time"
 
@@ -386,3 +387,184 @@ func TestNotifyWithSuccessIsCalled(t *testing.T) {
 		t.Fatalf("Success should have been called only once, but was called %d times instead", successCalled)
 	}
 }
+
+func TestBackendLoadNotExists(t *testing.T) {
+	// load should not retry if the error matches IsNotExist
+	notFound := errors.New("not found")
+	attempt := 0
+
+	be := mock.NewBackend()
+	be.OpenReaderFn = func(ctx context.Context, h restic.Handle, length int, offset int64) (io.ReadCloser, error) {
+		attempt++
+		if attempt > 1 {
+			t.Fail()
+			return nil, errors.New("must not retry")
+		}
+		return nil, notFound
+	}
+	be.IsNotExistFn = func(err error) bool {
+		return errors.Is(err, notFound)
+	}
+
+	TestFastRetries(t)
+	retryBackend := New(be, 10, nil, nil)
+
+	err := retryBackend.Load(context.TODO(), restic.Handle{}, 0, 0, func(rd io.Reader) (err error) {
+		return nil
+	})
+	test.Assert(t, be.IsNotExistFn(err), "unexpected error %v", err)
+	test.Equals(t, 1, attempt)
+}
+
+func TestBackendFatalError(t *testing.T) {
+	// fatal errors are not retried
+	attempt := 0
+
+	be := mock.NewBackend()
+	be.SaveFn = func(ctx context.Context, h restic.Handle, rd restic.RewindReader) error {
+		attempt++
+		return errors.Fatal("permission denied")
+	}
+
+	TestFastRetries(t)
+	retryBackend := New(be, 10, nil, nil)
+
+	err := retryBackend.Save(context.TODO(), restic.Handle{}, restic.NewByteReader([]byte("foo"), nil))
+	test.Assert(t, errors.IsFatal(err), "unexpected error %v", err)
+	test.Equals(t, 1, attempt)
+}
+
+func TestBackendRequestTimeout(t *testing.T) {
+	attempt := 0
+
+	be := mock.NewBackend()
+	be.StatFn = func(ctx context.Context, h restic.Handle) (restic.FileInfo, error) {
+		attempt++
+		if attempt == 1 {
+			// the first request hangs until the timeout expires
+			<-ctx.Done()
+			return restic.FileInfo{}, ctx.Err()
+		}
+		return restic.FileInfo{Name: "foo"}, nil
+	}
+
+	TestFastRetries(t)
+	opts := DefaultOptions()
+	opts.RequestTimeout = 10 * time.Millisecond
+	retryBackend := NewWithOptions(be, opts, nil, nil)
+
+	fi, err := retryBackend.Stat(context.TODO(), restic.Handle{})
+	test.OK(t, err)
+	test.Equals(t, "foo", fi.Name)
+	test.Equals(t, 2, attempt)
+}
+
+func TestBackendLoadRequestTimeout(t *testing.T) {
+	attempt := 0
+
+	be := mock.NewBackend()
+	be.OpenReaderFn = func(ctx context.Context, h restic.Handle, length int, offset int64) (io.ReadCloser, error) {
+		attempt++
+		if attempt == 1 {
+			// the first request hangs until the timeout expires
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}
+		return io.NopCloser(bytes.NewReader([]byte("foo"))), nil
+	}
+
+	TestFastRetries(t)
+	opts := DefaultOptions()
+	opts.RequestTimeout = 10 * time.Millisecond
+	retryBackend := NewWithOptions(be, opts, nil, nil)
+
+	var data []byte
+	err := retryBackend.Load(context.TODO(), restic.Handle{}, 0, 0, func(rd io.Reader) error {
+		// processing the data takes longer than the timeout
+		time.Sleep(50 * time.Millisecond)
+		var err error
+		data, err = io.ReadAll(rd)
+		return err
+	})
+	test.OK(t, err)
+	test.Equals(t, "foo", string(data))
+	test.Equals(t, 2, attempt)
+}
+
+// stallingReader blocks reads until the context is canceled.
+type stallingReader struct {
+	ctx context.Context
+}
+
+func (rd stallingReader) Read(p []byte) (int, error) {
+	<-rd.ctx.Done()
+	return 0, rd.ctx.Err()
+}
+
+func (rd stallingReader) Close() error {
+	return nil
+}
+
+func TestBackendLoadStalledRead(t *testing.T) {
+	be := mock.NewBackend()
+	be.OpenReaderFn = func(ctx context.Context, h restic.Handle, length int, offset int64) (io.ReadCloser, error) {
+		return stallingReader{ctx}, nil
+	}
+
+	TestFastRetries(t)
+	opts := DefaultOptions()
+	opts.MaxTries = 2
+	opts.RequestTimeout = 10 * time.Millisecond
+	retryBackend := NewWithOptions(be, opts, nil, nil)
+
+	err := retryBackend.Load(context.TODO(), restic.Handle{}, 0, 0, func(rd io.Reader) error {
+		_, err := io.ReadAll(rd)
+		return err
+	})
+	test.Assert(t, err != nil && strings.Contains(err.Error(), "request timed out"), "unexpected error %v", err)
+}
+
+func TestBackoffStrategy(t *testing.T) {
+	defer func(fast bool) { fastRetries = fast }(fastRetries)
+	fastRetries = false
+
+	opts := DefaultOptions()
+	opts.Backoff = BackoffConstant
+	opts.MaxTries = 3
+	opts.InitialInterval = 2 * time.Second
+	bo := NewWithOptions(mock.NewBackend(), opts, nil, nil).newBackOff()
+
+	for i := 0; i < 3; i++ {
+		test.Equals(t, 2*time.Second, bo.NextBackOff())
+	}
+	test.Equals(t, backoff.Stop, bo.NextBackOff())
+
+	opts.Backoff = BackoffExponential
+	opts.MaxInterval = 3 * time.Second
+	bo = NewWithOptions(mock.NewBackend(), opts, nil, nil).newBackOff()
+
+	var last time.Duration
+	for i := 0; i < 3; i++ {
+		d := bo.NextBackOff()
+		// the randomization may exceed MaxInterval by 50%
+		test.Assert(t, d > 0 && d <= 4500*time.Millisecond, "unexpected interval %v", d)
+		last = d
+	}
+	test.Assert(t, last > time.Second, "interval did not increase, got %v", last)
+	test.Equals(t, backoff.Stop, bo.NextBackOff())
+}
+
+func TestOptionsValidate(t *testing.T) {
+	test.OK(t, DefaultOptions().Validate())
+
+	for _, modify := range []func(*Options){
+		func(opts *Options) { opts.Backoff = "linear" },
+		func(opts *Options) { opts.MaxTries = -1 },
+		func(opts *Options) { opts.InitialInterval = 0 },
+		func(opts *Options) { opts.RequestTimeout = -time.Second },
+	} {
+		opts := DefaultOptions()
+		modify(&opts)
+		test.Assert(t, opts.Validate() != nil, "missing error for %#v", opts)
+	}
+}
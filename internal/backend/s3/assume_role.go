@@ -0,0 +1,63 @@
+package s3
+
+import (
+	"time"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+const (
+	defaultSTSEndpoint     = "https://sts.amazonaws.com"
+	defaultRoleSessionName = "restic"
+	defaultRoleDuration    = time.Hour
+)
+
+// assumeRole returns credentials for the role configured in cfg, which are
+// obtained from STS using the credentials returned by source. The temporary
+// credentials are requested again shortly before they expire.
+func assumeRole(cfg Config, source *credentials.Credentials) (*credentials.Credentials, error) {
+	src, err := source.Get()
+	if err != nil {
+		return nil, errors.Wrap(err, "source credentials")
+	}
+	if src.AccessKeyID == "" {
+		return nil, errors.New("no source credentials found to assume role")
+	}
+	if src.SessionToken != "" {
+		return nil, errors.New("assuming a role with temporary source credentials is not supported")
+	}
+
+	endpoint, region := cfg.STSEndpoint, cfg.Region
+	if endpoint == "" || region == "" {
+		// requests to the global endpoint of STS are signed for us-east-1
+		region = "us-east-1"
+	}
+	if endpoint == "" {
+		endpoint = defaultSTSEndpoint
+	}
+
+	opts := credentials.STSAssumeRoleOptions{
+		AccessKey:       src.AccessKeyID,
+		SecretKey:       src.SecretAccessKey,
+		Location:        region,
+		DurationSeconds: int(defaultRoleDuration / time.Second),
+		RoleARN:         cfg.RoleARN,
+		RoleSessionName: cfg.RoleSessionName,
+	}
+	if cfg.RoleDuration != 0 {
+		opts.DurationSeconds = int(cfg.RoleDuration / time.Second)
+	}
+	if opts.RoleSessionName == "" {
+		opts.RoleSessionName = defaultRoleSessionName
+	}
+
+	debug.Log("assuming role %v at %v", cfg.RoleARN, endpoint)
+	creds, err := credentials.NewSTSAssumeRole(endpoint, opts)
+	if err != nil {
+		return nil, errors.Wrap(err, "NewSTSAssumeRole")
+	}
+	return creds, nil
+}
@@ -0,0 +1,136 @@
+package s3
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	rtest "github.com/restic/restic/internal/test"
+
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// fakeSTS answers AssumeRole requests with credentials which are valid for
+// the given lifetime.
+type fakeSTS struct {
+	lifetime time.Duration
+
+	m        sync.Mutex
+	requests []*http.Request
+}
+
+func (srv *fakeSTS) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	srv.m.Lock()
+	defer srv.m.Unlock()
+
+	if err := req.ParseForm(); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	srv.requests = append(srv.requests, req)
+
+	if req.PostForm.Get("RoleArn") != "arn:aws:iam::123456789012:role/backup" {
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = fmt.Fprint(w, `<ErrorResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/"><Error><Type>Sender</Type><Code>AccessDenied</Code><Message>not authorized</Message></Error></ErrorResponse>`)
+		return
+	}
+
+	n := len(srv.requests)
+	_, _ = fmt.Fprintf(w, `<AssumeRoleResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+<AssumeRoleResult><Credentials>
+<AccessKeyId>ASIA%d</AccessKeyId><SecretAccessKey>secret%d</SecretAccessKey><SessionToken>token%d</SessionToken>
+<Expiration>%s</Expiration>
+</Credentials></AssumeRoleResult></AssumeRoleResponse>`, n, n, n, time.Now().Add(srv.lifetime).UTC().Format(time.RFC3339))
+}
+
+func TestAssumeRole(t *testing.T) {
+	srv := &fakeSTS{lifetime: time.Hour}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	source := credentials.NewStaticV4("AKIASOURCE", "sourcesecret", "")
+	cfg := Config{
+		RoleARN:     "arn:aws:iam::123456789012:role/backup",
+		STSEndpoint: ts.URL,
+	}
+	creds, err := assumeRole(cfg, source)
+	rtest.OK(t, err)
+
+	v, err := creds.Get()
+	rtest.OK(t, err)
+	rtest.Equals(t, credentials.Value{
+		AccessKeyID:     "ASIA1",
+		SecretAccessKey: "secret1",
+		SessionToken:    "token1",
+		SignerType:      credentials.SignatureV4,
+	}, v)
+
+	// the credentials are cached until they expire
+	_, err = creds.Get()
+	rtest.OK(t, err)
+	rtest.Equals(t, 1, len(srv.requests))
+
+	req := srv.requests[0]
+	rtest.Equals(t, "AssumeRole", req.PostForm.Get("Action"))
+	rtest.Equals(t, defaultRoleSessionName, req.PostForm.Get("RoleSessionName"))
+	rtest.Equals(t, "3600", req.PostForm.Get("DurationSeconds"))
+	auth := req.Header.Get("Authorization")
+	rtest.Assert(t, strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKIASOURCE/") && strings.Contains(auth, "/us-east-1/sts/"),
+		"unexpected Authorization header %q", auth)
+}
+
+func TestAssumeRoleRefresh(t *testing.T) {
+	// credentials are refreshed after 80% of their lifetime
+	srv := &fakeSTS{lifetime: 50 * time.Millisecond}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	source := credentials.NewStaticV4("AKIASOURCE", "sourcesecret", "")
+	cfg := Config{
+		RoleARN:     "arn:aws:iam::123456789012:role/backup",
+		STSEndpoint: ts.URL,
+	}
+	creds, err := assumeRole(cfg, source)
+	rtest.OK(t, err)
+
+	v, err := creds.Get()
+	rtest.OK(t, err)
+	rtest.Equals(t, "ASIA1", v.AccessKeyID)
+
+	time.Sleep(100 * time.Millisecond)
+
+	v, err = creds.Get()
+	rtest.OK(t, err)
+	rtest.Equals(t, "ASIA2", v.AccessKeyID)
+}
+
+func TestAssumeRoleDenied(t *testing.T) {
+	srv := &fakeSTS{lifetime: time.Hour}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	source := credentials.NewStaticV4("AKIASOURCE", "sourcesecret", "")
+	cfg := Config{
+		RoleARN:     "arn:aws:iam::123456789012:role/other",
+		STSEndpoint: ts.URL,
+	}
+	creds, err := assumeRole(cfg, source)
+	rtest.OK(t, err)
+
+	_, err = creds.Get()
+	rtest.Assert(t, err != nil && strings.Contains(err.Error(), "not authorized"), "unexpected error %v", err)
+}
+
+func TestAssumeRoleTemporarySource(t *testing.T) {
+	source := credentials.NewStaticV4("ASIASOURCE", "sourcesecret", "sourcetoken")
+	cfg := Config{
+		RoleARN: "arn:aws:iam::123456789012:role/backup",
+	}
+
+	_, err := assumeRole(cfg, source)
+	rtest.Assert(t, err != nil, "expected error for temporary source credentials")
+}
@@ -4,6 +4,7 @@ import (
 	"net/url"
 	"path"
 	"strings"
+	"time"
 
 	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/options"
@@ -19,20 +20,38 @@ type Config struct {
 	Bucket       string
 	Prefix       string
 	Layout       string `option:"layout" help:"use this backend layout (default: auto-detect)"`
-	StorageClass string `option:"storage-class" help:"set S3 storage class (STANDARD, STANDARD_IA, ONEZONE_IA, INTELLIGENT_TIERING or REDUCED_REDUNDANCY)"`
+	StorageClass string `option:"storage-class" help:"set S3 storage class (STANDARD, STANDARD_IA, ONEZONE_IA, INTELLIGENT_TIERING, REDUCED_REDUNDANCY, GLACIER_IR, GLACIER or DEEP_ARCHIVE)"`
 
 	Connections   uint   `option:"connections" help:"set a limit for the number of concurrent connections (default: 5)"`
 	MaxRetries    uint   `option:"retries" help:"set the number of retries attempted"`
 	Region        string `option:"region" help:"set region"`
 	BucketLookup  string `option:"bucket-lookup" help:"bucket lookup style: 'auto', 'dns', or 'path'"`
 	ListObjectsV1 bool   `option:"list-objects-v1" help:"use deprecated V1 api for ListObjects calls"`
+	KMSKeyID      string `option:"kms-key-id" help:"encrypt new objects on the server with SSE-KMS using this key ID or ARN"`
+	Checksum      bool   `option:"checksum" help:"let the server verify the SHA-256 checksum of uploaded files (not supported by all S3 compatible servers)"`
+
+	RoleARN         string        `option:"role-arn" help:"assume this IAM role using the configured long-term credentials"`
+	RoleSessionName string        `option:"role-session-name" help:"session name of the assumed role (default: restic)"`
+	RoleDuration    time.Duration `option:"role-duration" help:"lifetime of the assumed role credentials, at least 1h (default: 1h)"`
+	STSEndpoint     string        `option:"sts-endpoint" help:"STS endpoint used to assume the role (default: https://sts.amazonaws.com)"`
+
+	EnableRestore  bool          `option:"enable-restore" help:"restore archived pack files from GLACIER or DEEP_ARCHIVE before reading them"`
+	RestoreDays    int           `option:"restore-days" help:"number of days restored pack files stay available (default: 7)"`
+	RestoreTimeout time.Duration `option:"restore-timeout" help:"maximum time to wait for the restore of a pack file (default: 24h)"`
+	RestoreTier    string        `option:"restore-tier" help:"retrieval tier used for restores: Standard, Bulk or Expedited (default: Standard)"`
+
+	ObjectLockMode      string        `option:"object-lock-mode" help:"protect new files using S3 Object Lock in GOVERNANCE or COMPLIANCE mode"`
+	ObjectLockRetention time.Duration `option:"object-lock-retention" help:"fixed duration each new file is protected by the object lock after its upload, the retention is never extended, e.g. 720h"`
 }
 
 // NewConfig returns a new Config with the default values filled in.
 func NewConfig() Config {
 	return Config{
-		Connections:   5,
-		ListObjectsV1: false,
+		Connections:    5,
+		ListObjectsV1:  false,
+		RestoreDays:    7,
+		RestoreTimeout: 24 * time.Hour,
+		RestoreTier:    "Standard",
 	}
 }
 
@@ -3,6 +3,7 @@ package s3
 import (
 	"strings"
 	"testing"
+	"time"
 )
 
 var configTests = []struct {
@@ -10,92 +11,134 @@ var configTests = []struct {
 	cfg Config
 }{
 	{"s3://eu-central-1/bucketname", Config{
-		Endpoint:    "eu-central-1",
-		Bucket:      "bucketname",
-		Prefix:      "",
-		Connections: 5,
+		Endpoint:       "eu-central-1",
+		Bucket:         "bucketname",
+		Prefix:         "",
+		Connections:    5,
+		RestoreDays:    7,
+		RestoreTimeout: 24 * time.Hour,
+		RestoreTier:    "Standard",
 	}},
 	{"s3://eu-central-1/bucketname/", Config{
-		Endpoint:    "eu-central-1",
-		Bucket:      "bucketname",
-		Prefix:      "",
-		Connections: 5,
+		Endpoint:       "eu-central-1",
+		Bucket:         "bucketname",
+		Prefix:         "",
+		Connections:    5,
+		RestoreDays:    7,
+		RestoreTimeout: 24 * time.Hour,
+		RestoreTier:    "Standard",
 	}},
 	{"s3://eu-central-1/bucketname/prefix/directory", Config{
-		Endpoint:    "eu-central-1",
-		Bucket:      "bucketname",
-		Prefix:      "prefix/directory",
-		Connections: 5,
+		Endpoint:       "eu-central-1",
+		Bucket:         "bucketname",
+		Prefix:         "prefix/directory",
+		Connections:    5,
+		RestoreDays:    7,
+		RestoreTimeout: 24 * time.Hour,
+		RestoreTier:    "Standard",
 	}},
 	{"s3://eu-central-1/bucketname/prefix/directory/", Config{
-		Endpoint:    "eu-central-1",
-		Bucket:      "bucketname",
-		Prefix:      "prefix/directory",
-		Connections: 5,
+		Endpoint:       "eu-central-1",
+		Bucket:         "bucketname",
+		Prefix:         "prefix/directory",
+		Connections:    5,
+		RestoreDays:    7,
+		RestoreTimeout: 24 * time.Hour,
+		RestoreTier:    "Standard",
 	}},
 	{"s3:eu-central-1/foobar", Config{
-		Endpoint:    "eu-central-1",
-		Bucket:      "foobar",
-		Prefix:      "",
-		Connections: 5,
+		Endpoint:       "eu-central-1",
+		Bucket:         "foobar",
+		Prefix:         "",
+		Connections:    5,
+		RestoreDays:    7,
+		RestoreTimeout: 24 * time.Hour,
+		RestoreTier:    "Standard",
 	}},
 	{"s3:eu-central-1/foobar/", Config{
-		Endpoint:    "eu-central-1",
-		Bucket:      "foobar",
-		Prefix:      "",
-		Connections: 5,
+		Endpoint:       "eu-central-1",
+		Bucket:         "foobar",
+		Prefix:         "",
+		Connections:    5,
+		RestoreDays:    7,
+		RestoreTimeout: 24 * time.Hour,
+		RestoreTier:    "Standard",
 	}},
 	{"s3:eu-central-1/foobar/prefix/directory", Config{
-		Endpoint:    "eu-central-1",
-		Bucket:      "foobar",
-		Prefix:      "prefix/directory",
-		Connections: 5,
+		Endpoint:       "eu-central-1",
+		Bucket:         "foobar",
+		Prefix:         "prefix/directory",
+		Connections:    5,
+		RestoreDays:    7,
+		RestoreTimeout: 24 * time.Hour,
+		RestoreTier:    "Standard",
 	}},
 	{"s3:eu-central-1/foobar/prefix/directory/", Config{
-		Endpoint:    "eu-central-1",
-		Bucket:      "foobar",
-		Prefix:      "prefix/directory",
-		Connections: 5,
+		Endpoint:       "eu-central-1",
+		Bucket:         "foobar",
+		Prefix:         "prefix/directory",
+		Connections:    5,
+		RestoreDays:    7,
+		RestoreTimeout: 24 * time.Hour,
+		RestoreTier:    "Standard",
 	}},
 	{"s3:https://hostname:9999/foobar", Config{
-		Endpoint:    "hostname:9999",
-		Bucket:      "foobar",
-		Prefix:      "",
-		Connections: 5,
+		Endpoint:       "hostname:9999",
+		Bucket:         "foobar",
+		Prefix:         "",
+		Connections:    5,
+		RestoreDays:    7,
+		RestoreTimeout: 24 * time.Hour,
+		RestoreTier:    "Standard",
 	}},
 	{"s3:https://hostname:9999/foobar/", Config{
-		Endpoint:    "hostname:9999",
-		Bucket:      "foobar",
-		Prefix:      "",
-		Connections: 5,
+		Endpoint:       "hostname:9999",
+		Bucket:         "foobar",
+		Prefix:         "",
+		Connections:    5,
+		RestoreDays:    7,
+		RestoreTimeout: 24 * time.Hour,
+		RestoreTier:    "Standard",
 	}},
 	{"s3:http://hostname:9999/foobar", Config{
-		Endpoint:    "hostname:9999",
-		Bucket:      "foobar",
-		Prefix:      "",
-		UseHTTP:     true,
-		Connections: 5,
+		Endpoint:       "hostname:9999",
+		Bucket:         "foobar",
+		Prefix:         "",
+		UseHTTP:        true,
+		Connections:    5,
+		RestoreDays:    7,
+		RestoreTimeout: 24 * time.Hour,
+		RestoreTier:    "Standard",
 	}},
 	{"s3:http://hostname:9999/foobar/", Config{
-		Endpoint:    "hostname:9999",
-		Bucket:      "foobar",
-		Prefix:      "",
-		UseHTTP:     true,
-		Connections: 5,
+		Endpoint:       "hostname:9999",
+		Bucket:         "foobar",
+		Prefix:         "",
+		UseHTTP:        true,
+		Connections:    5,
+		RestoreDays:    7,
+		RestoreTimeout: 24 * time.Hour,
+		RestoreTier:    "Standard",
 	}},
 	{"s3:http://hostname:9999/bucket/prefix/directory", Config{
-		Endpoint:    "hostname:9999",
-		Bucket:      "bucket",
-		Prefix:      "prefix/directory",
-		UseHTTP:     true,
-		Connections: 5,
+		Endpoint:       "hostname:9999",
+		Bucket:         "bucket",
+		Prefix:         "prefix/directory",
+		UseHTTP:        true,
+		Connections:    5,
+		RestoreDays:    7,
+		RestoreTimeout: 24 * time.Hour,
+		RestoreTier:    "Standard",
 	}},
 	{"s3:http://hostname:9999/bucket/prefix/directory/", Config{
-		Endpoint:    "hostname:9999",
-		Bucket:      "bucket",
-		Prefix:      "prefix/directory",
-		UseHTTP:     true,
-		Connections: 5,
+		Endpoint:       "hostname:9999",
+		Bucket:         "bucket",
+		Prefix:         "prefix/directory",
+		UseHTTP:        true,
+		Connections:    5,
+		RestoreDays:    7,
+		RestoreTimeout: 24 * time.Hour,
+		RestoreTier:    "Standard",
 	}},
 }
 
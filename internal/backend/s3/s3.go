@@ -1,7 +1,10 @@
 package s3
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/base64"
 	"fmt"
 	"hash"
 	"io"
@@ -9,6 +12,7 @@ import (
 	"os"
 	"path"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/restic/restic/internal/backend"
@@ -16,11 +20,14 @@ import (
 	"github.com/restic/restic/internal/backend/sema"
 	"github.com/restic/restic/internal/debug"
 	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/hashing"
 	"github.com/restic/restic/internal/restic"
 
 	"github.com/cenkalti/backoff/v4"
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/minio/minio-go/v7/pkg/encrypt"
+	"golang.org/x/sync/errgroup"
 )
 
 // Backend stores data on an S3 endpoint.
@@ -28,6 +35,7 @@ type Backend struct {
 	client *minio.Client
 	sem    sema.Semaphore
 	cfg    Config
+	sse    encrypt.ServerSide
 	layout.Layout
 }
 
@@ -51,7 +59,8 @@ func open(ctx context.Context, cfg Config, rt http.RoundTripper) (*Backend, erro
 	//  - Minio creds file (i.e. MINIO_SHARED_CREDENTIALS_FILE or ~/.mc/config.json)
 	//  - IAM profile based credentials. (performs an HTTP
 	//    call to a pre-defined endpoint, only valid inside
-	//    configured ec2 instances)
+	//    configured ec2 instances, ECS tasks or EKS pods with
+	//    IAM roles for service accounts)
 	creds := credentials.NewChainCredentials([]credentials.Provider{
 		&credentials.EnvAWS{},
 		&credentials.Static{
@@ -70,6 +79,16 @@ func open(ctx context.Context, cfg Config, rt http.RoundTripper) (*Backend, erro
 		},
 	})
 
+	// use the credentials found above to assume the role, the temporary
+	// credentials are refreshed automatically before they expire
+	if cfg.RoleARN != "" {
+		var err error
+		creds, err = assumeRole(cfg, creds)
+		if err != nil {
+			return nil, errors.Wrap(err, "assumeRole")
+		}
+	}
+
 	c, err := creds.Get()
 	if err != nil {
 		return nil, errors.Wrap(err, "creds.Get")
@@ -97,6 +116,26 @@ func open(ctx context.Context, cfg Config, rt http.RoundTripper) (*Backend, erro
 		return nil, fmt.Errorf(`bad bucket-lookup style %q must be "auto", "path" or "dns"`, cfg.BucketLookup)
 	}
 
+	switch cfg.RestoreTier {
+	case string(minio.TierStandard), string(minio.TierBulk), string(minio.TierExpedited):
+	default:
+		return nil, fmt.Errorf(`bad restore-tier %q must be "Standard", "Bulk" or "Expedited"`, cfg.RestoreTier)
+	}
+
+	switch strings.ToUpper(cfg.ObjectLockMode) {
+	case "":
+		if cfg.ObjectLockRetention != 0 {
+			return nil, errors.New("object-lock-retention requires object-lock-mode")
+		}
+	case string(minio.Governance), string(minio.Compliance):
+		cfg.ObjectLockMode = strings.ToUpper(cfg.ObjectLockMode)
+		if cfg.ObjectLockRetention <= 0 {
+			return nil, errors.New("object-lock-mode requires a positive object-lock-retention")
+		}
+	default:
+		return nil, fmt.Errorf(`bad object-lock-mode %q must be "GOVERNANCE" or "COMPLIANCE"`, cfg.ObjectLockMode)
+	}
+
 	client, err := minio.New(cfg.Endpoint, options)
 	if err != nil {
 		return nil, errors.Wrap(err, "minio.New")
@@ -113,6 +152,13 @@ func open(ctx context.Context, cfg Config, rt http.RoundTripper) (*Backend, erro
 		cfg:    cfg,
 	}
 
+	if cfg.KMSKeyID != "" {
+		be.sse, err = encrypt.NewSSEKMS(cfg.KMSKeyID, nil)
+		if err != nil {
+			return nil, errors.Wrap(err, "NewSSEKMS")
+		}
+	}
+
 	l, err := layout.ParseLayout(ctx, be, cfg.Layout, defaultLayout, cfg.Prefix)
 	if err != nil {
 		return nil, err
@@ -149,8 +195,9 @@ func Create(ctx context.Context, cfg Config, rt http.RoundTripper) (restic.Backe
 	}
 
 	if !found {
-		// create new bucket with default ACL in default region
-		err = be.client.MakeBucket(ctx, cfg.Bucket, minio.MakeBucketOptions{})
+		// create new bucket with default ACL in default region. Object lock
+		// can only be enabled when creating a bucket.
+		err = be.client.MakeBucket(ctx, cfg.Bucket, minio.MakeBucketOptions{ObjectLocking: be.useObjectLock()})
 		if err != nil {
 			return nil, errors.Wrap(err, "client.MakeBucket")
 		}
@@ -159,6 +206,32 @@ func Create(ctx context.Context, cfg Config, rt http.RoundTripper) (restic.Backe
 	return be, nil
 }
 
+// useObjectLock returns whether new files are protected by an object lock.
+func (be *Backend) useObjectLock() bool {
+	return be.cfg.ObjectLockMode != ""
+}
+
+// checkObjectLock returns an error wrapping restic.ErrObjectLocked if the
+// object is still protected by a retention period or a legal hold at now.
+func checkObjectLock(fi minio.ObjectInfo, now time.Time) error {
+	if fi.Metadata.Get("X-Amz-Object-Lock-Legal-Hold") == "ON" {
+		return fmt.Errorf("%w with a legal hold", restic.ErrObjectLocked)
+	}
+
+	until := fi.Metadata.Get("X-Amz-Object-Lock-Retain-Until-Date")
+	if until == "" {
+		return nil
+	}
+	t, err := time.Parse(time.RFC3339, until)
+	if err != nil {
+		return errors.Wrap(err, "parse retention date")
+	}
+	if t.After(now) {
+		return fmt.Errorf("%w until %v", restic.ErrObjectLocked, t.Local().Format(time.RFC3339))
+	}
+	return nil
+}
+
 // isAccessDenied returns true if the error is caused by Access Denied.
 func isAccessDenied(err error) bool {
 	debug.Log("isAccessDenied(%T, %#v)", err, err)
@@ -258,7 +331,7 @@ func (be *Backend) Location() string {
 
 // Hasher may return a hash function for calculating a content hash for the backend
 func (be *Backend) Hasher() hash.Hash {
-	return nil
+	return sha256.New()
 }
 
 // HasAtomicReplace returns whether Save() can atomically replace files
@@ -271,6 +344,23 @@ func (be *Backend) Path() string {
 	return be.cfg.Prefix
 }
 
+// isArchiveClass returns true if objects stored with the storage class must be
+// restored before they can be read.
+func isArchiveClass(class string) bool {
+	return class == "GLACIER" || class == "DEEP_ARCHIVE"
+}
+
+// useStorageClass returns whether the configured storage class should be used
+// for the file. Archive classes are only used for pack files which contain
+// data blobs, all other files are read regularly and are stored with the
+// default storage class of the bucket.
+func (be *Backend) useStorageClass(h restic.Handle) bool {
+	if !isArchiveClass(be.cfg.StorageClass) {
+		return true
+	}
+	return h.Type == restic.PackFile && h.ContainedBlobType == restic.DataBlob
+}
+
 // Save stores data in the backend at the handle.
 func (be *Backend) Save(ctx context.Context, h restic.Handle, rd restic.RewindReader) error {
 	debug.Log("Save %v", h)
@@ -284,24 +374,55 @@ func (be *Backend) Save(ctx context.Context, h restic.Handle, rd restic.RewindRe
 	be.sem.GetToken()
 	defer be.sem.ReleaseToken()
 
-	opts := minio.PutObjectOptions{StorageClass: be.cfg.StorageClass}
+	opts := minio.PutObjectOptions{ServerSideEncryption: be.sse}
+	if be.useStorageClass(h) {
+		opts.StorageClass = be.cfg.StorageClass
+	}
+	if be.useObjectLock() && h.Type != restic.LockFile {
+		opts.Mode = minio.RetentionMode(be.cfg.ObjectLockMode)
+		opts.RetainUntilDate = time.Now().Add(be.cfg.ObjectLockRetention).UTC()
+	}
 	opts.ContentType = "application/octet-stream"
 	// the only option with the high-level api is to let the library handle the checksum computation
 	opts.SendContentMd5 = true
 	// only use multipart uploads for very large files
 	opts.PartSize = 200 * 1024 * 1024
 
+	// if enabled, let the server verify the SHA-256 checksum of the data.
+	// Multipart uploads only support checksums per part, thus the checksum is
+	// only verified locally for these.
+	var checksum string
+	if be.cfg.Checksum && rd.Hash() != nil && rd.Length() < int64(opts.PartSize) {
+		checksum = base64.StdEncoding.EncodeToString(rd.Hash())
+		opts.UserMetadata = map[string]string{"X-Amz-Checksum-Sha256": checksum}
+	}
+	hrd := hashing.NewReader(rd, sha256.New())
+
 	debug.Log("PutObject(%v, %v, %v)", be.cfg.Bucket, objName, rd.Length())
-	info, err := be.client.PutObject(ctx, be.cfg.Bucket, objName, io.NopCloser(rd), int64(rd.Length()), opts)
+	info, err := be.client.PutObject(ctx, be.cfg.Bucket, objName, io.NopCloser(hrd), int64(rd.Length()), opts)
 
 	debug.Log("%v -> %v bytes, err %#v: %v", objName, info.Size, err, err)
+	if err != nil {
+		return errors.Wrap(err, "client.PutObject")
+	}
 
-	// sanity check
-	if err == nil && info.Size != rd.Length() {
+	// sanity checks
+	if info.Size != rd.Length() {
 		return errors.Errorf("wrote %d bytes instead of the expected %d bytes", info.Size, rd.Length())
 	}
+	if rd.Hash() != nil && !bytes.Equal(hrd.Sum(nil), rd.Hash()) {
+		err = errors.Errorf("checksum of uploaded data does not match, got %x, want %x", hrd.Sum(nil), rd.Hash())
+	} else if checksum != "" && info.ChecksumSHA256 != "" && info.ChecksumSHA256 != checksum {
+		err = errors.Errorf("server returned checksum %v instead of %v", info.ChecksumSHA256, checksum)
+	}
+	if err != nil {
+		// do not keep the damaged file
+		rmErr := be.client.RemoveObject(ctx, be.cfg.Bucket, objName, minio.RemoveObjectOptions{VersionID: info.VersionID})
+		debug.Log("removed damaged file %v: %v", objName, rmErr)
+		return err
+	}
 
-	return errors.Wrap(err, "client.PutObject")
+	return nil
 }
 
 // Load runs fn with a reader that yields the contents of the file at h at the
@@ -345,6 +466,14 @@ func (be *Backend) openReader(ctx context.Context, h restic.Handle, length int,
 
 	coreClient := minio.Core{Client: be.client}
 	rd, _, _, err := coreClient.GetObject(ctx, be.cfg.Bucket, objName, opts)
+	if err != nil && isArchived(err) {
+		be.sem.ReleaseToken()
+		err = be.restore(ctx, h, objName)
+		be.sem.GetToken()
+		if err == nil {
+			rd, _, _, err = coreClient.GetObject(ctx, be.cfg.Bucket, objName, opts)
+		}
+	}
 	if err != nil {
 		cancel()
 		be.sem.ReleaseToken()
@@ -354,6 +483,160 @@ func (be *Backend) openReader(ctx context.Context, h restic.Handle, length int,
 	return be.sem.ReleaseTokenOnClose(rd, cancel), err
 }
 
+// isArchived returns true if the error is caused by reading an object which
+// has been archived and must be restored first.
+func isArchived(err error) bool {
+	var e minio.ErrorResponse
+	return errors.As(err, &e) && e.Code == "InvalidObjectState"
+}
+
+// restorePollInterval is the time between checks whether a restore has
+// completed.
+var restorePollInterval = time.Minute
+
+// restore requests a temporary copy of the archived object and waits until it
+// is available for reading, or until the restore timeout expires.
+func (be *Backend) restore(ctx context.Context, h restic.Handle, objName string) error {
+	if !be.cfg.EnableRestore {
+		return backoff.Permanent(errors.Errorf("%v is archived in storage class %v and must be restored before it can be read, use -o s3.enable-restore=true", h, be.cfg.StorageClass))
+	}
+
+	err := be.requestRestore(ctx, objName)
+	if err != nil {
+		return err
+	}
+	return be.waitRestored(ctx, []string{objName})
+}
+
+// Warmup requests the restore of all archived files among handles at once and
+// waits until all of them can be read. It does nothing unless restores are
+// enabled.
+func (be *Backend) Warmup(ctx context.Context, handles []restic.Handle) error {
+	if !be.cfg.EnableRestore {
+		return nil
+	}
+
+	var m sync.Mutex
+	var pending []string
+
+	wg, wgCtx := errgroup.WithContext(ctx)
+	for _, h := range handles {
+		objName := be.Filename(h)
+		wg.Go(func() error {
+			be.sem.GetToken()
+			info, err := be.client.StatObject(wgCtx, be.cfg.Bucket, objName, minio.StatObjectOptions{})
+			be.sem.ReleaseToken()
+			if err != nil {
+				return errors.Wrap(err, "client.StatObject")
+			}
+
+			if !isArchiveClass(info.Metadata.Get("X-Amz-Storage-Class")) ||
+				info.Restore != nil && !info.Restore.OngoingRestore {
+				// the object can be read
+				return nil
+			}
+			if info.Restore == nil {
+				err = be.requestRestore(wgCtx, objName)
+				if err != nil {
+					return err
+				}
+			}
+
+			m.Lock()
+			pending = append(pending, objName)
+			m.Unlock()
+			return nil
+		})
+	}
+	err := wg.Wait()
+	if err != nil {
+		return err
+	}
+
+	debug.Log("waiting for the restore of %d of %d files", len(pending), len(handles))
+	return be.waitRestored(ctx, pending)
+}
+
+// requestRestore requests a temporary copy of the archived object.
+func (be *Backend) requestRestore(ctx context.Context, objName string) error {
+	debug.Log("restoring %v for %d days, tier %v", objName, be.cfg.RestoreDays, be.cfg.RestoreTier)
+
+	req := minio.RestoreRequest{}
+	req.SetDays(be.cfg.RestoreDays)
+	req.SetGlacierJobParameters(minio.GlacierJobParameters{Tier: minio.TierType(be.cfg.RestoreTier)})
+
+	be.sem.GetToken()
+	err := be.client.RestoreObject(ctx, be.cfg.Bucket, objName, "", req)
+	be.sem.ReleaseToken()
+
+	var e minio.ErrorResponse
+	if errors.As(err, &e) && e.Code == "RestoreAlreadyInProgress" {
+		err = nil
+	}
+	return errors.Wrap(err, "client.RestoreObject")
+}
+
+// waitRestored polls the objects until all restores have completed, or until
+// the restore timeout expires.
+func (be *Backend) waitRestored(ctx context.Context, objNames []string) error {
+	ctx, cancel := context.WithTimeout(ctx, be.cfg.RestoreTimeout)
+	defer cancel()
+
+	timeout := func() error {
+		return backoff.Permanent(errors.Errorf("restore of %d files did not complete within %v", len(objNames), be.cfg.RestoreTimeout))
+	}
+
+	for len(objNames) > 0 {
+		var m sync.Mutex
+		var remaining []string
+
+		wg, wgCtx := errgroup.WithContext(ctx)
+		for _, objName := range objNames {
+			objName := objName
+			wg.Go(func() error {
+				be.sem.GetToken()
+				info, err := be.client.StatObject(wgCtx, be.cfg.Bucket, objName, minio.StatObjectOptions{})
+				be.sem.ReleaseToken()
+				if err != nil {
+					return errors.Wrap(err, "client.StatObject")
+				}
+
+				if info.Restore != nil && !info.Restore.OngoingRestore {
+					debug.Log("restore of %v completed, expires %v", objName, info.Restore.ExpiryTime)
+					return nil
+				}
+				m.Lock()
+				remaining = append(remaining, objName)
+				m.Unlock()
+				return nil
+			})
+		}
+		err := wg.Wait()
+		if err != nil && ctx.Err() == context.DeadlineExceeded {
+			// retrying after the timeout would start waiting again
+			return timeout()
+		}
+		if err != nil {
+			return err
+		}
+
+		objNames = remaining
+		if len(objNames) == 0 {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			if ctx.Err() == context.DeadlineExceeded {
+				return timeout()
+			}
+			return ctx.Err()
+		case <-time.After(restorePollInterval):
+		}
+	}
+	return nil
+}
+
 // Stat returns information about a blob.
 func (be *Backend) Stat(ctx context.Context, h restic.Handle) (bi restic.FileInfo, err error) {
 	debug.Log("%v", h)
@@ -394,8 +677,29 @@ func (be *Backend) Remove(ctx context.Context, h restic.Handle) error {
 	objName := be.Filename(h)
 
 	be.sem.GetToken()
-	err := be.client.RemoveObject(ctx, be.cfg.Bucket, objName, minio.RemoveObjectOptions{})
-	be.sem.ReleaseToken()
+	defer be.sem.ReleaseToken()
+
+	var opts minio.RemoveObjectOptions
+	if be.useObjectLock() && h.Type != restic.LockFile {
+		fi, err := be.client.StatObject(ctx, be.cfg.Bucket, objName, minio.StatObjectOptions{})
+		if be.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrap(err, "client.StatObject")
+		}
+		if err := checkObjectLock(fi, time.Now()); err != nil {
+			debug.Log("Remove(%v) at %v -> %v", h, objName, err)
+			return backoff.Permanent(fmt.Errorf("%v is %w", h, err))
+		}
+
+		// In a versioned bucket, removing an object only adds a delete
+		// marker. Remove the expired version instead, so that it does not
+		// take up space.
+		opts.VersionID = fi.VersionID
+	}
+
+	err := be.client.RemoveObject(ctx, be.cfg.Bucket, objName, opts)
 
 	debug.Log("Remove(%v) at %v -> err %v", h, objName, err)
 
@@ -512,8 +816,9 @@ func (be *Backend) Rename(ctx context.Context, h restic.Handle, l layout.Layout)
 	}
 
 	dst := minio.CopyDestOptions{
-		Bucket: be.cfg.Bucket,
-		Object: newname,
+		Bucket:     be.cfg.Bucket,
+		Object:     newname,
+		Encryption: be.sse,
 	}
 
 	_, err := be.client.CopyObject(ctx, dst, src)
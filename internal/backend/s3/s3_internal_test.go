@@ -0,0 +1,495 @@
+package s3
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/options"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/minio/minio-go/v7"
+)
+
+func TestUseStorageClass(t *testing.T) {
+	var tests = []struct {
+		class string
+		h     restic.Handle
+		use   bool
+	}{
+		{"STANDARD_IA", restic.Handle{Type: restic.PackFile, ContainedBlobType: restic.DataBlob}, true},
+		{"STANDARD_IA", restic.Handle{Type: restic.PackFile, ContainedBlobType: restic.TreeBlob}, true},
+		{"STANDARD_IA", restic.Handle{Type: restic.IndexFile}, true},
+		{"GLACIER", restic.Handle{Type: restic.PackFile, ContainedBlobType: restic.DataBlob}, true},
+		{"GLACIER", restic.Handle{Type: restic.PackFile, ContainedBlobType: restic.TreeBlob}, false},
+		{"GLACIER", restic.Handle{Type: restic.PackFile}, false},
+		{"DEEP_ARCHIVE", restic.Handle{Type: restic.SnapshotFile}, false},
+		{"DEEP_ARCHIVE", restic.Handle{Type: restic.ConfigFile}, false},
+	}
+
+	for _, test := range tests {
+		be := &Backend{cfg: Config{StorageClass: test.class}}
+		if use := be.useStorageClass(test.h); use != test.use {
+			t.Errorf("useStorageClass(%v) for %v returned %v, want %v", test.h, test.class, use, test.use)
+		}
+	}
+}
+
+// archiveServer simulates an S3 server which holds archived objects. A
+// restore completes on the second check of the object after it was
+// requested.
+type archiveServer struct {
+	data string
+
+	m        sync.Mutex
+	restores int
+	polls    int
+	// restoreState contains the number of checks since the restore of each
+	// object was requested
+	restoreState map[string]int
+	// restoresAtCompletion is the number of restores requested when the
+	// first restore completed
+	restoresAtCompletion int
+	// neverComplete prevents restores from completing
+	neverComplete bool
+}
+
+func (srv *archiveServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	srv.m.Lock()
+	defer srv.m.Unlock()
+
+	w.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+
+	checks, restoring := srv.restoreState[req.URL.Path]
+	restored := restoring && checks > 1
+
+	switch {
+	case req.Method == http.MethodPost && req.URL.Query().Has("restore"):
+		srv.restores++
+		srv.restoreState[req.URL.Path] = 0
+		w.WriteHeader(http.StatusAccepted)
+	case req.Method == http.MethodHead:
+		w.Header().Set("Content-Length", "4")
+		w.Header().Set("x-amz-storage-class", "GLACIER")
+		if !restoring {
+			break
+		}
+		srv.polls++
+		if !srv.neverComplete {
+			srv.restoreState[req.URL.Path]++
+		}
+		if srv.restoreState[req.URL.Path] > 1 {
+			if srv.restoresAtCompletion == 0 {
+				srv.restoresAtCompletion = srv.restores
+			}
+			w.Header().Set("x-amz-restore", `ongoing-request="false", expiry-date="Fri, 21 Dec 2012 00:00:00 GMT"`)
+		} else {
+			w.Header().Set("x-amz-restore", `ongoing-request="true"`)
+		}
+	case req.Method == http.MethodGet && restored:
+		w.Header().Set("Content-Length", "4")
+		_, _ = io.WriteString(w, srv.data)
+	case req.Method == http.MethodGet:
+		w.Header().Set("Content-Type", "application/xml")
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = io.WriteString(w, `<?xml version="1.0" encoding="UTF-8"?>
+<Error><Code>InvalidObjectState</Code><Message>The operation is not valid for the object's storage class</Message></Error>`)
+	default:
+		w.WriteHeader(http.StatusNotImplemented)
+	}
+}
+
+func newArchiveBackend(t testing.TB, enableRestore bool) (*Backend, *archiveServer) {
+	srv := &archiveServer{data: "data", restoreState: make(map[string]int)}
+	ts := httptest.NewServer(srv)
+	t.Cleanup(ts.Close)
+
+	cfg := NewConfig()
+	cfg.Endpoint = strings.TrimPrefix(ts.URL, "http://")
+	cfg.UseHTTP = true
+	cfg.KeyID = "key"
+	cfg.Secret = options.NewSecretString("secret")
+	cfg.Region = "us-east-1"
+	cfg.Bucket = "bucket"
+	cfg.Prefix = "restic"
+	cfg.Layout = "default"
+	cfg.BucketLookup = "path"
+	cfg.StorageClass = "GLACIER"
+	cfg.EnableRestore = enableRestore
+
+	be, err := open(context.TODO(), cfg, http.DefaultTransport)
+	rtest.OK(t, err)
+	return be, srv
+}
+
+func TestRestoreArchived(t *testing.T) {
+	defer func(d time.Duration) { restorePollInterval = d }(restorePollInterval)
+	restorePollInterval = time.Millisecond
+
+	be, srv := newArchiveBackend(t, true)
+
+	h := restic.Handle{Type: restic.PackFile, Name: restic.NewRandomID().String()}
+	var data []byte
+	err := be.Load(context.TODO(), h, 0, 0, func(rd io.Reader) (err error) {
+		data, err = io.ReadAll(rd)
+		return err
+	})
+	rtest.OK(t, err)
+	rtest.Equals(t, "data", string(data))
+	rtest.Equals(t, 1, srv.restores)
+	rtest.Equals(t, 2, srv.polls)
+}
+
+func TestWarmupArchived(t *testing.T) {
+	defer func(d time.Duration) { restorePollInterval = d }(restorePollInterval)
+	restorePollInterval = time.Millisecond
+
+	be, srv := newArchiveBackend(t, true)
+
+	var handles []restic.Handle
+	for i := 0; i < 5; i++ {
+		handles = append(handles, restic.Handle{Type: restic.PackFile, Name: restic.NewRandomID().String()})
+	}
+	rtest.OK(t, be.Warmup(context.TODO(), handles))
+	rtest.Equals(t, 5, srv.restores)
+	// all restores must be requested before waiting for the first one
+	rtest.Equals(t, 5, srv.restoresAtCompletion)
+
+	// the packs can be read without restoring them again
+	for _, h := range handles {
+		rtest.OK(t, be.Load(context.TODO(), h, 0, 0, func(rd io.Reader) error {
+			_, err := io.Copy(io.Discard, rd)
+			return err
+		}))
+	}
+	rtest.Equals(t, 5, srv.restores)
+}
+
+func TestWarmupTimeout(t *testing.T) {
+	defer func(d time.Duration) { restorePollInterval = d }(restorePollInterval)
+	restorePollInterval = time.Millisecond
+
+	be, srv := newArchiveBackend(t, true)
+	be.cfg.RestoreTimeout = 20 * time.Millisecond
+	srv.neverComplete = true
+
+	err := be.Warmup(context.TODO(), []restic.Handle{{Type: restic.PackFile, Name: restic.NewRandomID().String()}})
+	var perr *backoff.PermanentError
+	rtest.Assert(t, errors.As(err, &perr), "timeout is not a permanent error: %v", err)
+}
+
+func TestRestoreDisabled(t *testing.T) {
+	be, srv := newArchiveBackend(t, false)
+
+	h := restic.Handle{Type: restic.PackFile, Name: restic.NewRandomID().String()}
+	err := be.Load(context.TODO(), h, 0, 0, func(rd io.Reader) error {
+		return nil
+	})
+	rtest.Assert(t, err != nil && strings.Contains(err.Error(), "s3.enable-restore"), "unexpected error %v", err)
+	rtest.Equals(t, 0, srv.restores)
+}
+
+func TestKMSEncryption(t *testing.T) {
+	var m sync.Mutex
+	var header http.Header
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		m.Lock()
+		defer m.Unlock()
+		if req.Method == http.MethodPut {
+			header = req.Header.Clone()
+		}
+		_, _ = io.Copy(io.Discard, req.Body)
+		w.Header().Set("ETag", `"d41d8cd98f00b204e9800998ecf8427e"`)
+	}))
+	defer ts.Close()
+
+	cfg := NewConfig()
+	cfg.Endpoint = strings.TrimPrefix(ts.URL, "http://")
+	cfg.UseHTTP = true
+	cfg.KeyID = "key"
+	cfg.Secret = options.NewSecretString("secret")
+	cfg.Region = "us-east-1"
+	cfg.Bucket = "bucket"
+	cfg.Layout = "default"
+	cfg.BucketLookup = "path"
+	cfg.KMSKeyID = "arn:aws:kms:us-east-1:123456789012:key/1234abcd-12ab-34cd-56ef-1234567890ab"
+
+	be, err := open(context.TODO(), cfg, http.DefaultTransport)
+	rtest.OK(t, err)
+
+	h := restic.Handle{Type: restic.PackFile, Name: restic.NewRandomID().String()}
+	rtest.OK(t, be.Save(context.TODO(), h, restic.NewByteReader([]byte("data"), nil)))
+
+	m.Lock()
+	defer m.Unlock()
+	rtest.Equals(t, "aws:kms", header.Get("X-Amz-Server-Side-Encryption"))
+	rtest.Equals(t, cfg.KMSKeyID, header.Get("X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id"))
+}
+
+// objectLockServer simulates an S3 server with object lock enabled. It records
+// the retention of uploaded objects and the removed object versions.
+type objectLockServer struct {
+	m         sync.Mutex
+	retention map[string]string
+	removed   []string
+}
+
+func (srv *objectLockServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	srv.m.Lock()
+	defer srv.m.Unlock()
+
+	w.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+
+	switch req.Method {
+	case http.MethodPut:
+		_, _ = io.Copy(io.Discard, req.Body)
+		if req.Header.Get("X-Amz-Object-Lock-Mode") != "" {
+			srv.retention[req.URL.Path] = req.Header.Get("X-Amz-Object-Lock-Mode") + " " + req.Header.Get("X-Amz-Object-Lock-Retain-Until-Date")
+		}
+		w.Header().Set("ETag", `"d41d8cd98f00b204e9800998ecf8427e"`)
+	case http.MethodHead:
+		w.Header().Set("x-amz-version-id", "v1")
+		if until, ok := srv.retention[req.URL.Path]; ok {
+			w.Header().Set("X-Amz-Object-Lock-Retain-Until-Date", strings.Fields(until)[1])
+		}
+	case http.MethodDelete:
+		srv.removed = append(srv.removed, req.URL.Path+"?versionId="+req.URL.Query().Get("versionId"))
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNotImplemented)
+	}
+}
+
+func TestObjectLock(t *testing.T) {
+	srv := &objectLockServer{retention: make(map[string]string)}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	cfg := NewConfig()
+	cfg.Endpoint = strings.TrimPrefix(ts.URL, "http://")
+	cfg.UseHTTP = true
+	cfg.KeyID = "key"
+	cfg.Secret = options.NewSecretString("secret")
+	cfg.Region = "us-east-1"
+	cfg.Bucket = "bucket"
+	cfg.Layout = "default"
+	cfg.BucketLookup = "path"
+	cfg.ObjectLockMode = "compliance"
+	cfg.ObjectLockRetention = time.Hour
+
+	be, err := open(context.TODO(), cfg, http.DefaultTransport)
+	rtest.OK(t, err)
+
+	// lock files are not protected, as they are removed regularly
+	pack := restic.Handle{Type: restic.PackFile, Name: restic.NewRandomID().String()}
+	lock := restic.Handle{Type: restic.LockFile, Name: restic.NewRandomID().String()}
+	for _, h := range []restic.Handle{pack, lock} {
+		rtest.OK(t, be.Save(context.TODO(), h, restic.NewByteReader([]byte("data"), nil)))
+	}
+
+	srv.m.Lock()
+	rtest.Equals(t, 1, len(srv.retention))
+	retention := srv.retention["/bucket/"+be.Filename(pack)]
+	srv.m.Unlock()
+	rtest.Assert(t, strings.HasPrefix(retention, "COMPLIANCE "), "unexpected retention %q", retention)
+	until, err := time.Parse(time.RFC3339, strings.Fields(retention)[1])
+	rtest.OK(t, err)
+	rtest.Assert(t, until.After(time.Now().Add(59*time.Minute)), "retention %v is too short", until)
+
+	err = be.Remove(context.TODO(), pack)
+	rtest.Assert(t, errors.Is(err, restic.ErrObjectLocked), "unexpected error %v", err)
+	rtest.OK(t, be.Remove(context.TODO(), lock))
+
+	// once the retention has expired, the object version is removed
+	srv.m.Lock()
+	srv.retention["/bucket/"+be.Filename(pack)] = "COMPLIANCE " + time.Now().Add(-time.Minute).UTC().Format(time.RFC3339)
+	srv.m.Unlock()
+	rtest.OK(t, be.Remove(context.TODO(), pack))
+
+	srv.m.Lock()
+	defer srv.m.Unlock()
+	rtest.Equals(t, []string{
+		"/bucket/" + be.Filename(lock) + "?versionId=",
+		"/bucket/" + be.Filename(pack) + "?versionId=v1",
+	}, srv.removed)
+}
+
+func TestCheckObjectLock(t *testing.T) {
+	now := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+	var tests = []struct {
+		header http.Header
+		locked bool
+	}{
+		{http.Header{}, false},
+		{http.Header{"X-Amz-Object-Lock-Retain-Until-Date": {"2023-01-02T03:04:06Z"}}, true},
+		{http.Header{"X-Amz-Object-Lock-Retain-Until-Date": {"2023-01-02T03:04:04Z"}}, false},
+		{http.Header{"X-Amz-Object-Lock-Legal-Hold": {"ON"}}, true},
+		{http.Header{"X-Amz-Object-Lock-Legal-Hold": {"OFF"}}, false},
+	}
+
+	for _, test := range tests {
+		err := checkObjectLock(minio.ObjectInfo{Metadata: test.header}, now)
+		rtest.Assert(t, errors.Is(err, restic.ErrObjectLocked) == test.locked, "unexpected result %v for %v", err, test.header)
+	}
+}
+
+func TestObjectLockConfig(t *testing.T) {
+	for _, mode := range []struct {
+		mode      string
+		retention time.Duration
+	}{
+		{"GOVERNANCE", 0},
+		{"", time.Hour},
+		{"LEGAL", time.Hour},
+	} {
+		cfg := NewConfig()
+		cfg.Endpoint = "localhost:1"
+		cfg.KeyID = "key"
+		cfg.Secret = options.NewSecretString("secret")
+		cfg.ObjectLockMode = mode.mode
+		cfg.ObjectLockRetention = mode.retention
+		_, err := open(context.TODO(), cfg, http.DefaultTransport)
+		rtest.Assert(t, err != nil, "missing error for %v", mode)
+	}
+}
+
+// checksumServer stores uploaded objects and optionally verifies the SHA-256
+// checksum sent by the client.
+type checksumServer struct {
+	verify bool
+
+	m         sync.Mutex
+	checksums []string
+	objects   map[string][]byte
+}
+
+func (srv *checksumServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	srv.m.Lock()
+	defer srv.m.Unlock()
+
+	switch req.Method {
+	case http.MethodPut:
+		data, err := readPayload(req)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		checksum := req.Header.Get("X-Amz-Checksum-Sha256")
+		srv.checksums = append(srv.checksums, checksum)
+		sum := sha256.Sum256(data)
+		if srv.verify && checksum != base64.StdEncoding.EncodeToString(sum[:]) {
+			w.Header().Set("Content-Type", "application/xml")
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = io.WriteString(w, `<?xml version="1.0" encoding="UTF-8"?>
+<Error><Code>BadDigest</Code><Message>The SHA256 you specified did not match the calculated checksum.</Message></Error>`)
+			return
+		}
+		srv.objects[req.URL.Path] = data
+		if srv.verify {
+			w.Header().Set("X-Amz-Checksum-Sha256", checksum)
+		}
+		w.Header().Set("ETag", `"d41d8cd98f00b204e9800998ecf8427e"`)
+	case http.MethodDelete:
+		delete(srv.objects, req.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNotImplemented)
+	}
+}
+
+// readPayload returns the body of req, decoding the chunks of a streaming
+// upload if necessary.
+func readPayload(req *http.Request) ([]byte, error) {
+	if req.Header.Get("X-Amz-Content-Sha256") != "STREAMING-AWS4-HMAC-SHA256-PAYLOAD" {
+		return io.ReadAll(req.Body)
+	}
+
+	var data []byte
+	rd := bufio.NewReader(req.Body)
+	for {
+		line, err := rd.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.ParseInt(strings.Split(line, ";")[0], 16, 64)
+		if err != nil {
+			return nil, err
+		}
+		chunk := make([]byte, size+2)
+		if _, err := io.ReadFull(rd, chunk); err != nil {
+			return nil, err
+		}
+		if size == 0 {
+			return data, nil
+		}
+		data = append(data, chunk[:size]...)
+	}
+}
+
+// wrongHashReader returns a hash which does not match the data.
+type wrongHashReader struct {
+	*restic.ByteReader
+}
+
+func (rd wrongHashReader) Hash() []byte {
+	h := append([]byte{}, rd.ByteReader.Hash()...)
+	h[0] ^= 0x01
+	return h
+}
+
+func TestUploadChecksum(t *testing.T) {
+	for _, verify := range []bool{true, false} {
+		srv := &checksumServer{verify: verify, objects: make(map[string][]byte)}
+		ts := httptest.NewServer(srv)
+
+		cfg := NewConfig()
+		cfg.Endpoint = strings.TrimPrefix(ts.URL, "http://")
+		cfg.UseHTTP = true
+		cfg.KeyID = "key"
+		cfg.Secret = options.NewSecretString("secret")
+		cfg.Region = "us-east-1"
+		cfg.Bucket = "bucket"
+		cfg.Layout = "default"
+		cfg.BucketLookup = "path"
+		cfg.Checksum = verify
+
+		be, err := open(context.TODO(), cfg, http.DefaultTransport)
+		rtest.OK(t, err)
+
+		data := []byte("data")
+		h := restic.Handle{Type: restic.PackFile, Name: restic.Hash(data).String()}
+		rtest.OK(t, be.Save(context.TODO(), h, restic.NewByteReader(data, be.Hasher())))
+
+		// uploads with a wrong hash are rejected either by the server or by
+		// the local check, and the damaged file is removed
+		h2 := restic.Handle{Type: restic.PackFile, Name: restic.NewRandomID().String()}
+		err = be.Save(context.TODO(), h2, wrongHashReader{restic.NewByteReader(data, be.Hasher())})
+		rtest.Assert(t, err != nil, "upload with wrong hash did not fail, verify %v", verify)
+
+		srv.m.Lock()
+		// the checksum is only sent if enabled
+		sum := sha256.Sum256(data)
+		checksum := ""
+		if verify {
+			checksum = base64.StdEncoding.EncodeToString(sum[:])
+		}
+		rtest.Equals(t, checksum, srv.checksums[0])
+		rtest.Equals(t, 1, len(srv.objects))
+		rtest.Equals(t, data, srv.objects["/bucket/"+be.Filename(h)])
+		srv.m.Unlock()
+
+		ts.Close()
+	}
+}
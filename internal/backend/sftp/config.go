@@ -17,6 +17,7 @@ type Config struct {
 	Command string `option:"command" help:"specify command to create sftp connection"`
 
 	Connections uint `option:"connections" help:"set a limit for the number of concurrent connections (default: 5)"`
+	MaxRequests uint `option:"max-requests" help:"set a limit for the number of outstanding requests per file transfer (default: 64)"`
 }
 
 // NewConfig returns a new config with default options applied.
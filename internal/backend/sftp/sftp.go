@@ -97,8 +97,16 @@ func startClient(cfg Config) (*SFTP, error) {
 		}
 	}()
 
+	// Requests for different files are multiplexed over the connection by
+	// the client, transfers of a single file are split into several
+	// outstanding requests to hide the latency of the link.
+	var opts []sftp.ClientOption
+	if cfg.MaxRequests > 0 {
+		opts = append(opts, sftp.MaxConcurrentRequestsPerFile(int(cfg.MaxRequests)))
+	}
+
 	// open the SFTP session
-	client, err := sftp.NewClientPipe(rd, wr)
+	client, err := sftp.NewClientPipe(rd, wr, opts...)
 	if err != nil {
 		return nil, errors.Errorf("unable to start the sftp session, error: %v", err)
 	}
@@ -356,8 +364,9 @@ func (r *SFTP) Save(ctx context.Context, h restic.Handle, rd restic.RewindReader
 		}
 	}()
 
-	// save data, make sure to use the optimized sftp upload method
-	wbytes, err := f.ReadFrom(rd)
+	// save data, make sure to use the optimized sftp upload method which
+	// sends several write requests without waiting for each response
+	wbytes, err := f.ReadFromWithConcurrency(rd, 0)
 	if err != nil {
 		_ = f.Close()
 		err = r.checkNoSpace(dirname, rd.Length(), err)
@@ -0,0 +1,43 @@
+package tape
+
+import (
+	"strings"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/options"
+)
+
+// Config holds all information needed to open a tape repository.
+type Config struct {
+	Path string
+
+	VolumeSize  uint `option:"volume-size" help:"start a new volume once the current volume reaches this size in MiB (default: 102400)"`
+	Connections uint `option:"connections" help:"set a limit for the number of concurrent operations (default: 2)"`
+}
+
+// NewConfig returns a new config with default options applied.
+func NewConfig() Config {
+	return Config{
+		VolumeSize:  100 * 1024,
+		Connections: 2,
+	}
+}
+
+func init() {
+	options.Register("tape", Config{})
+}
+
+// ParseConfig parses a tape backend config. The supported configuration
+// format is tape:/path/to/repo.
+func ParseConfig(s string) (interface{}, error) {
+	if !strings.HasPrefix(s, "tape:") {
+		return nil, errors.New(`invalid format, prefix "tape" not found`)
+	}
+
+	cfg := NewConfig()
+	cfg.Path = s[5:]
+	if cfg.Path == "" {
+		return nil, errors.New("tape: invalid format: path not found")
+	}
+	return cfg, nil
+}
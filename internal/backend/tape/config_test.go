@@ -0,0 +1,35 @@
+package tape
+
+import "testing"
+
+var configTests = []struct {
+	s   string
+	cfg Config
+}{
+	{"tape:/srv/restic", Config{
+		Path:        "/srv/restic",
+		VolumeSize:  100 * 1024,
+		Connections: 2,
+	}},
+	{"tape:relative/dir", Config{
+		Path:        "relative/dir",
+		VolumeSize:  100 * 1024,
+		Connections: 2,
+	}},
+}
+
+func TestParseConfig(t *testing.T) {
+	for i, test := range configTests {
+		cfg, err := ParseConfig(test.s)
+		if err != nil {
+			t.Errorf("test %d:%s failed: %v", i, test.s, err)
+			continue
+		}
+
+		if cfg != test.cfg {
+			t.Errorf("test %d:\ninput:\n  %s\n wrong config, want:\n  %v\ngot:\n  %v",
+				i, test.s, test.cfg, cfg)
+			continue
+		}
+	}
+}
@@ -0,0 +1,564 @@
+package tape
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/restic/restic/internal/backend"
+	"github.com/restic/restic/internal/backend/local"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/restic"
+
+	"github.com/cenkalti/backoff/v4"
+)
+
+// Backend stores pack files append-only in large volume files, which are
+// never modified once they are complete and can therefore be moved to tape
+// or write-once media. All other files are small and are stored in a local
+// repository.
+//
+// For each volume, a catalog file records the offset and length of the
+// packs stored in the volume. Removing a pack only records the removal in the
+// catalog, the data stays in the volume. Each backend instance starts a new
+// volume, volumes are never appended to by later runs.
+type Backend struct {
+	*local.Local
+
+	dir        string
+	volumeSize int64
+
+	m sync.Mutex
+	// packs contains all known copies of the packs
+	packs map[string][]location
+	// cur is the volume packs are currently appended to
+	cur *volume
+	// catalog is the catalog of the current volume, it's kept open for
+	// recording removed packs even if the volume is complete
+	catalog *os.File
+	num     int
+	// started is set once a volume was created for the current catalog
+	started bool
+}
+
+// ensure statically that *Backend implements restic.Backend.
+var _ restic.Backend = &Backend{}
+
+// location is the position of a pack in a volume.
+type location struct {
+	Volume int   `json:"volume"`
+	Offset int64 `json:"offset"`
+	Length int64 `json:"length"`
+}
+
+// catalogEntry is a line in a catalog file.
+type catalogEntry struct {
+	Name    string `json:"name"`
+	Removed bool   `json:"removed,omitempty"`
+	location
+}
+
+type volume struct {
+	f    *os.File
+	size int64
+}
+
+const volumeDir = "volumes"
+
+func volumeName(num int) string {
+	return fmt.Sprintf("%06d.vol", num)
+}
+
+func catalogName(num int) string {
+	return fmt.Sprintf("%06d.catalog", num)
+}
+
+func open(be *local.Local, cfg Config) (*Backend, error) {
+	if cfg.VolumeSize == 0 {
+		return nil, errors.Fatal("tape: volume size must be larger than zero")
+	}
+
+	return &Backend{
+		Local:      be,
+		dir:        filepath.Join(cfg.Path, volumeDir),
+		volumeSize: int64(cfg.VolumeSize) * 1024 * 1024,
+		packs:      make(map[string][]location),
+	}, nil
+}
+
+func localConfig(cfg Config) local.Config {
+	return local.Config{
+		Path:        cfg.Path,
+		Layout:      "default",
+		Connections: cfg.Connections,
+	}
+}
+
+// Open opens the tape backend as specified by config.
+func Open(ctx context.Context, cfg Config) (*Backend, error) {
+	debug.Log("open tape backend at %v", cfg.Path)
+	be, err := local.Open(ctx, localConfig(cfg))
+	if err != nil {
+		return nil, err
+	}
+	return open(be, cfg)
+}
+
+// Create creates all the necessary files and directories for a new tape
+// backend at dir. Afterwards a new config blob should be created.
+func Create(ctx context.Context, cfg Config) (*Backend, error) {
+	debug.Log("create tape backend at %v", cfg.Path)
+	be, err := local.Create(ctx, localConfig(cfg))
+	if err != nil {
+		return nil, err
+	}
+
+	err = fs.MkdirAll(filepath.Join(cfg.Path, volumeDir), be.Modes.Dir)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return open(be, cfg)
+}
+
+// readCatalogs loads all catalog files. The caller must hold b.m.
+func (b *Backend) readCatalogs() error {
+	entries, err := os.ReadDir(b.dir)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	packs := make(map[string][]location)
+	removed := make(map[location]struct{})
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Name(), ".catalog") {
+			continue
+		}
+
+		err := readCatalog(filepath.Join(b.dir, entry.Name()), func(e catalogEntry) {
+			if e.Removed {
+				removed[e.location] = struct{}{}
+			} else {
+				packs[e.Name] = append(packs[e.Name], e.location)
+			}
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	for name, locs := range packs {
+		var live []location
+		for _, loc := range locs {
+			if _, ok := removed[loc]; !ok {
+				live = append(live, loc)
+			}
+		}
+
+		if len(live) == 0 {
+			delete(packs, name)
+		} else {
+			packs[name] = live
+		}
+	}
+
+	b.packs = packs
+	return nil
+}
+
+// readCatalog runs fn for each entry in the catalog file. Lines which cannot
+// be parsed, for example an incomplete last line after a crash, are ignored.
+func readCatalog(filename string, fn func(catalogEntry)) error {
+	f, err := fs.Open(filename)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var e catalogEntry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			debug.Log("ignoring invalid line in catalog %v: %v", filename, err)
+			continue
+		}
+		fn(e)
+	}
+
+	if err := sc.Err(); err != nil {
+		_ = f.Close()
+		return errors.Wrap(err, "read catalog")
+	}
+	return f.Close()
+}
+
+// lookup returns the location of the pack with the given ID. The catalogs
+// are reloaded if the pack is unknown, as it may have been saved by another
+// process. The caller must hold b.m.
+func (b *Backend) lookup(name string) (location, bool, error) {
+	locs, ok := b.packs[name]
+	if !ok {
+		if err := b.readCatalogs(); err != nil {
+			return location{}, false, err
+		}
+		locs, ok = b.packs[name]
+		if !ok {
+			return location{}, false, nil
+		}
+	}
+	return locs[len(locs)-1], true, nil
+}
+
+// openCatalog creates the catalog for a new volume. The caller must hold b.m.
+func (b *Backend) openCatalog() error {
+	if b.catalog != nil {
+		err := b.catalog.Close()
+		b.catalog = nil
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	entries, err := os.ReadDir(b.dir)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	num := 0
+	for _, entry := range entries {
+		name := strings.TrimSuffix(strings.TrimSuffix(entry.Name(), ".catalog"), ".vol")
+		if n, err := strconv.Atoi(name); err == nil && n > num {
+			num = n
+		}
+	}
+
+	// another process may create a volume at the same time
+	for {
+		num++
+		f, err := fs.OpenFile(filepath.Join(b.dir, catalogName(num)), os.O_WRONLY|os.O_CREATE|os.O_EXCL|os.O_APPEND, b.Modes.File)
+		if errors.Is(err, os.ErrExist) {
+			continue
+		}
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		debug.Log("using volume %v", num)
+		b.catalog = f
+		b.num = num
+		b.started = false
+		return nil
+	}
+}
+
+// record appends the entry to the catalog of the current volume. The caller
+// must hold b.m.
+func (b *Backend) record(e catalogEntry) error {
+	if b.catalog == nil {
+		if err := b.openCatalog(); err != nil {
+			return err
+		}
+	}
+
+	buf, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	_, err = b.catalog.Write(append(buf, '\n'))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return syncFile(b.catalog)
+}
+
+func syncFile(f *os.File) error {
+	err := f.Sync()
+	// ignore error if filesystem does not support fsync.
+	if err != nil && !errors.Is(err, syscall.ENOTSUP) {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// closeVolume finishes the current volume. The caller must hold b.m.
+func (b *Backend) closeVolume() error {
+	if b.cur == nil {
+		return nil
+	}
+
+	f := b.cur.f
+	b.cur = nil
+	if err := syncFile(f); err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	// try to mark the volume as read-only to avoid accidental modifications
+	_ = fs.Chmod(f.Name(), b.Modes.File&0444)
+	return errors.WithStack(f.Close())
+}
+
+// Save stores data in the backend at the handle. Packs are appended to the
+// current volume.
+func (b *Backend) Save(ctx context.Context, h restic.Handle, rd restic.RewindReader) (err error) {
+	if h.Type != restic.PackFile {
+		return b.Local.Save(ctx, h, rd)
+	}
+
+	debug.Log("Save %v", h)
+	if err := h.Valid(); err != nil {
+		return backoff.Permanent(err)
+	}
+
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	if b.cur == nil {
+		// each volume has its own catalog
+		if b.catalog == nil || b.started {
+			if err := b.openCatalog(); err != nil {
+				return err
+			}
+		}
+
+		f, err := fs.OpenFile(filepath.Join(b.dir, volumeName(b.num)), os.O_WRONLY|os.O_CREATE|os.O_EXCL, b.Modes.File)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		b.cur = &volume{f: f}
+		b.started = true
+	}
+
+	loc := location{Volume: b.num, Offset: b.cur.size, Length: rd.Length()}
+	wbytes, err := io.Copy(b.cur.f, rd)
+	// the data is kept even if it is incomplete, as the volume is only ever
+	// appended to
+	b.cur.size += wbytes
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	// sanity check
+	if wbytes != rd.Length() {
+		return errors.Errorf("wrote %d bytes instead of the expected %d bytes", wbytes, rd.Length())
+	}
+
+	if err := syncFile(b.cur.f); err != nil {
+		return err
+	}
+
+	// only packs which are recorded in the catalog exist
+	err = b.record(catalogEntry{Name: h.Name, location: loc})
+	if err != nil {
+		return err
+	}
+	b.packs[h.Name] = append(b.packs[h.Name], loc)
+
+	if b.cur.size >= b.volumeSize {
+		debug.Log("volume %v is complete", b.num)
+		return b.closeVolume()
+	}
+	return nil
+}
+
+// unavailableError is returned if the volume containing a pack is missing,
+// for example because it was moved to tape.
+type unavailableError struct {
+	name string
+	loc  location
+}
+
+func (e *unavailableError) Error() string {
+	return fmt.Sprintf("pack %v is stored in volume %v at offset %d, which is not available in %v",
+		e.name, volumeName(e.loc.Volume), e.loc.Offset, volumeDir)
+}
+
+// Load runs fn with a reader that yields the contents of the file at h at the
+// given offset.
+func (b *Backend) Load(ctx context.Context, h restic.Handle, length int, offset int64, fn func(rd io.Reader) error) error {
+	if h.Type != restic.PackFile {
+		return b.Local.Load(ctx, h, length, offset, fn)
+	}
+	return backend.DefaultLoad(ctx, h, length, offset, b.openReader, fn)
+}
+
+func (b *Backend) openReader(ctx context.Context, h restic.Handle, length int, offset int64) (io.ReadCloser, error) {
+	debug.Log("Load %v, length %v, offset %v", h, length, offset)
+	if err := h.Valid(); err != nil {
+		return nil, backoff.Permanent(err)
+	}
+
+	if offset < 0 {
+		return nil, errors.New("offset is negative")
+	}
+
+	if length < 0 {
+		return nil, errors.Errorf("invalid length %d", length)
+	}
+
+	b.m.Lock()
+	loc, ok, err := b.lookup(h.Name)
+	b.m.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errors.WithStack(&os.PathError{Op: "open", Path: h.Name, Err: os.ErrNotExist})
+	}
+
+	if offset > loc.Length {
+		offset = loc.Length
+	}
+	remaining := loc.Length - offset
+	if length > 0 && int64(length) < remaining {
+		remaining = int64(length)
+	}
+
+	f, err := fs.Open(filepath.Join(b.dir, volumeName(loc.Volume)))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, backoff.Permanent(&unavailableError{name: h.Name, loc: loc})
+	}
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	_, err = f.Seek(loc.Offset+offset, io.SeekStart)
+	if err != nil {
+		_ = f.Close()
+		return nil, errors.WithStack(err)
+	}
+
+	return backend.LimitReadCloser(f, remaining), nil
+}
+
+// Stat returns information about a blob.
+func (b *Backend) Stat(ctx context.Context, h restic.Handle) (restic.FileInfo, error) {
+	if h.Type != restic.PackFile {
+		return b.Local.Stat(ctx, h)
+	}
+
+	debug.Log("Stat %v", h)
+	if err := h.Valid(); err != nil {
+		return restic.FileInfo{}, backoff.Permanent(err)
+	}
+
+	b.m.Lock()
+	loc, ok, err := b.lookup(h.Name)
+	b.m.Unlock()
+	if err != nil {
+		return restic.FileInfo{}, err
+	}
+	if !ok {
+		return restic.FileInfo{}, errors.WithStack(&os.PathError{Op: "stat", Path: h.Name, Err: os.ErrNotExist})
+	}
+
+	return restic.FileInfo{Size: loc.Length, Name: h.Name}, nil
+}
+
+// Remove removes the blob with the given name and type. For packs, the
+// removal is recorded in the catalog, the data is retained in the volume.
+func (b *Backend) Remove(ctx context.Context, h restic.Handle) error {
+	if h.Type != restic.PackFile {
+		return b.Local.Remove(ctx, h)
+	}
+
+	debug.Log("Remove %v", h)
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	if _, ok, err := b.lookup(h.Name); err != nil {
+		return err
+	} else if !ok {
+		return errors.WithStack(&os.PathError{Op: "remove", Path: h.Name, Err: os.ErrNotExist})
+	}
+
+	for _, loc := range b.packs[h.Name] {
+		err := b.record(catalogEntry{Name: h.Name, Removed: true, location: loc})
+		if err != nil {
+			return err
+		}
+	}
+	delete(b.packs, h.Name)
+	return nil
+}
+
+// List runs fn for each file in the backend which has the type t. When an
+// error occurs (or fn returns an error), List stops and returns it.
+func (b *Backend) List(ctx context.Context, t restic.FileType, fn func(restic.FileInfo) error) error {
+	if t != restic.PackFile {
+		return b.Local.List(ctx, t, fn)
+	}
+
+	b.m.Lock()
+	err := b.readCatalogs()
+	var list []restic.FileInfo
+	for name, locs := range b.packs {
+		list = append(list, restic.FileInfo{Name: name, Size: locs[len(locs)-1].Length})
+	}
+	b.m.Unlock()
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	for _, fi := range list {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		err := fn(fi)
+		if err != nil {
+			return err
+		}
+	}
+
+	return ctx.Err()
+}
+
+// Close finishes the current volume.
+func (b *Backend) Close() error {
+	debug.Log("Close()")
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	err := b.closeVolume()
+	if b.catalog != nil {
+		if cerr := b.catalog.Close(); err == nil {
+			err = errors.WithStack(cerr)
+		}
+		b.catalog = nil
+	}
+
+	if lerr := b.Local.Close(); err == nil {
+		err = lerr
+	}
+	return err
+}
+
+// Delete removes the repository and all files.
+func (b *Backend) Delete(ctx context.Context) error {
+	b.m.Lock()
+	_ = b.closeVolume()
+	if b.catalog != nil {
+		_ = b.catalog.Close()
+		b.catalog = nil
+	}
+	b.m.Unlock()
+
+	return b.Local.Delete(ctx)
+}
+
+// Hasher may return a hash function for calculating a content hash for the backend
+func (b *Backend) Hasher() hash.Hash {
+	return nil
+}
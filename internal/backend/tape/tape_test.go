@@ -0,0 +1,149 @@
+package tape_test
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/restic/restic/internal/backend/tape"
+	"github.com/restic/restic/internal/backend/test"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func newTestSuite(t testing.TB, volumeSize uint) *test.Suite {
+	return &test.Suite{
+		// NewConfig returns a config for a new temporary backend that will be used in tests.
+		NewConfig: func() (interface{}, error) {
+			dir, err := os.MkdirTemp(rtest.TestTempDir, "restic-test-tape-")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			t.Logf("create new backend at %v", dir)
+
+			cfg := tape.NewConfig()
+			cfg.Path = dir
+			cfg.VolumeSize = volumeSize
+			return cfg, nil
+		},
+
+		// CreateFn is a function that creates a temporary repository for the tests.
+		Create: func(config interface{}) (restic.Backend, error) {
+			cfg := config.(tape.Config)
+			return tape.Create(context.TODO(), cfg)
+		},
+
+		// OpenFn is a function that opens a previously created temporary repository.
+		Open: func(config interface{}) (restic.Backend, error) {
+			cfg := config.(tape.Config)
+			return tape.Open(context.TODO(), cfg)
+		},
+
+		// CleanupFn removes data created during the tests.
+		Cleanup: func(config interface{}) error {
+			cfg := config.(tape.Config)
+			if !rtest.TestCleanupTempDirs {
+				t.Logf("leaving test backend dir at %v", cfg.Path)
+			}
+
+			rtest.RemoveAll(t, cfg.Path)
+			return nil
+		},
+	}
+}
+
+func TestBackend(t *testing.T) {
+	newTestSuite(t, tape.NewConfig().VolumeSize).RunTests(t)
+}
+
+func TestBackendSmallVolumes(t *testing.T) {
+	newTestSuite(t, 1).RunTests(t)
+}
+
+func BenchmarkBackend(t *testing.B) {
+	newTestSuite(t, tape.NewConfig().VolumeSize).RunBenchmarks(t)
+}
+
+func savePack(t testing.TB, be restic.Backend, data []byte) restic.Handle {
+	h := restic.Handle{Type: restic.PackFile, Name: restic.Hash(data).String()}
+	rtest.OK(t, be.Save(context.TODO(), h, restic.NewByteReader(data, be.Hasher())))
+	return h
+}
+
+func listPacks(t testing.TB, be restic.Backend) map[string]int64 {
+	packs := make(map[string]int64)
+	rtest.OK(t, be.List(context.TODO(), restic.PackFile, func(fi restic.FileInfo) error {
+		packs[fi.Name] = fi.Size
+		return nil
+	}))
+	return packs
+}
+
+func volumes(t testing.TB, dir string) []string {
+	names, err := filepath.Glob(filepath.Join(dir, "volumes", "*.vol"))
+	rtest.OK(t, err)
+	return names
+}
+
+func TestVolumes(t *testing.T) {
+	cfg := tape.NewConfig()
+	cfg.Path = rtest.TempDir(t)
+	cfg.VolumeSize = 1
+
+	be, err := tape.Create(context.TODO(), cfg)
+	rtest.OK(t, err)
+
+	// the first pack fills the first volume
+	h1 := savePack(t, be, rtest.Random(1, 1024*1024+1))
+	h2 := savePack(t, be, rtest.Random(2, 500))
+	h3 := savePack(t, be, rtest.Random(3, 700))
+	rtest.OK(t, be.Remove(context.TODO(), h2))
+	rtest.OK(t, be.Close())
+	rtest.Equals(t, 2, len(volumes(t, cfg.Path)))
+
+	// packs are appended to a new volume after reopening the repository
+	be, err = tape.Open(context.TODO(), cfg)
+	rtest.OK(t, err)
+	h4 := savePack(t, be, rtest.Random(4, 300))
+	rtest.OK(t, be.Close())
+	rtest.Equals(t, 3, len(volumes(t, cfg.Path)))
+
+	be, err = tape.Open(context.TODO(), cfg)
+	rtest.OK(t, err)
+	defer func() {
+		rtest.OK(t, be.Close())
+	}()
+
+	packs := listPacks(t, be)
+	rtest.Equals(t, map[string]int64{h1.Name: 1024*1024 + 1, h3.Name: 700, h4.Name: 300}, packs)
+
+	_, err = be.Stat(context.TODO(), h2)
+	rtest.Assert(t, be.IsNotExist(err), "unexpected error for removed pack: %v", err)
+
+	buf, err := backendLoad(be, h3, 100, 600)
+	rtest.OK(t, err)
+	rtest.Equals(t, rtest.Random(3, 700)[600:], buf)
+
+	// move the first volume to "tape"
+	rtest.OK(t, os.Rename(volumes(t, cfg.Path)[0], filepath.Join(cfg.Path, "archived.vol")))
+	_, err = backendLoad(be, h1, 0, 0)
+	rtest.Assert(t, err != nil && strings.Contains(err.Error(), "000001.vol"), "unexpected error for archived volume: %v", err)
+
+	// packs in other volumes are still available
+	buf, err = backendLoad(be, h4, 0, 0)
+	rtest.OK(t, err)
+	rtest.Equals(t, rtest.Random(4, 300), buf)
+}
+
+func backendLoad(be restic.Backend, h restic.Handle, length int, offset int64) ([]byte, error) {
+	var buf []byte
+	err := be.Load(context.TODO(), h, length, offset, func(rd io.Reader) (err error) {
+		buf, err = io.ReadAll(rd)
+		return err
+	})
+	return buf, err
+}
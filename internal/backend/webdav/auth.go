@@ -0,0 +1,246 @@
+package webdav
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/restic/restic/internal/debug"
+)
+
+// authTransport adds basic or digest authentication to the requests. The
+// authentication scheme is chosen according to the challenge of the server.
+// Basic authentication is only sent without a challenge over HTTPS, as it
+// transmits the password unencrypted. Credentials are only sent to the host
+// of the repository, and not when following redirects to other hosts.
+type authTransport struct {
+	rt       http.RoundTripper
+	host     string
+	username string
+	password string
+
+	m      sync.Mutex
+	basic  bool
+	digest *digestChallenge
+	nc     uint32
+	// cnonce returns a new client nonce, it is replaced in tests
+	cnonce func() string
+}
+
+// digestChallenge contains the parameters sent by the server in a
+// WWW-Authenticate header for the digest scheme.
+type digestChallenge struct {
+	realm  string
+	nonce  string
+	opaque string
+	qop    string
+}
+
+func newAuthTransport(rt http.RoundTripper, host, username, password string) *authTransport {
+	return &authTransport{
+		rt:       rt,
+		host:     host,
+		username: username,
+		password: password,
+		cnonce:   newCNonce,
+	}
+}
+
+func newCNonce() string {
+	var buf [8]byte
+	_, _ = io.ReadFull(rand.Reader, buf[:])
+	return hex.EncodeToString(buf[:])
+}
+
+// RoundTrip sends the request with the credentials for the last challenge of
+// the server. If the server requests digest authentication, or basic
+// authentication for a request sent without credentials, the request is
+// resent with the new challenge if possible.
+func (t *authTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Host != t.host {
+		debug.Log("not sending credentials to host %v", req.URL.Host)
+		return t.rt.RoundTrip(req)
+	}
+
+	authReq := t.authorize(req)
+	resp, err := t.rt.RoundTrip(authReq)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+
+	headers := resp.Header.Values("WWW-Authenticate")
+	challenge := parseDigestChallenge(headers)
+	switch {
+	case challenge != nil:
+		debug.Log("received digest challenge for realm %q", challenge.realm)
+		t.m.Lock()
+		t.digest = challenge
+		t.nc = 0
+		t.m.Unlock()
+	case authReq.Header.Get("Authorization") == "" && hasBasicChallenge(headers):
+		debug.Log("received basic challenge")
+		t.m.Lock()
+		t.basic = true
+		t.m.Unlock()
+	default:
+		return resp, nil
+	}
+
+	// the request can only be sent again if the body can be recreated
+	if req.Body != nil && req.GetBody == nil {
+		return resp, nil
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+
+	if req.GetBody != nil {
+		req = req.Clone(req.Context())
+		req.Body, err = req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return t.rt.RoundTrip(t.authorize(req))
+}
+
+// authorize returns a copy of req with an Authorization header. Before the
+// server has sent a challenge, credentials are only added for HTTPS.
+func (t *authTransport) authorize(req *http.Request) *http.Request {
+	req = req.Clone(req.Context())
+
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	if t.digest == nil {
+		if t.basic || req.URL.Scheme == "https" {
+			req.SetBasicAuth(t.username, t.password)
+		}
+		return req
+	}
+
+	t.nc++
+	req.Header.Set("Authorization", t.digestAuthorization(req.Method, req.URL.RequestURI(), t.nc, t.cnonce()))
+	return req
+}
+
+func md5Hex(s string) string {
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// digestAuthorization computes the Authorization header according to RFC 2617.
+func (t *authTransport) digestAuthorization(method, uri string, nc uint32, cnonce string) string {
+	c := t.digest
+	ha1 := md5Hex(t.username + ":" + c.realm + ":" + t.password)
+	ha2 := md5Hex(method + ":" + uri)
+
+	var response string
+	var params []string
+	if c.qop != "" {
+		ncValue := fmt.Sprintf("%08x", nc)
+		response = md5Hex(strings.Join([]string{ha1, c.nonce, ncValue, cnonce, c.qop, ha2}, ":"))
+		params = append(params, "qop="+c.qop, "nc="+ncValue, fmt.Sprintf("cnonce=%q", cnonce))
+	} else {
+		response = md5Hex(ha1 + ":" + c.nonce + ":" + ha2)
+	}
+
+	params = append([]string{
+		fmt.Sprintf("username=%q", t.username),
+		fmt.Sprintf("realm=%q", c.realm),
+		fmt.Sprintf("nonce=%q", c.nonce),
+		fmt.Sprintf("uri=%q", uri),
+		fmt.Sprintf("response=%q", response),
+	}, params...)
+	if c.opaque != "" {
+		params = append(params, fmt.Sprintf("opaque=%q", c.opaque))
+	}
+	return "Digest " + strings.Join(params, ", ")
+}
+
+// parseDigestChallenge returns the digest challenge contained in the
+// WWW-Authenticate headers, or nil if the server does not offer the digest
+// scheme with a supported algorithm.
+func parseDigestChallenge(headers []string) *digestChallenge {
+	for _, header := range headers {
+		scheme, rest, _ := strings.Cut(header, " ")
+		if !strings.EqualFold(scheme, "Digest") {
+			continue
+		}
+
+		params := parseAuthParams(rest)
+		if algorithm, ok := params["algorithm"]; ok && !strings.EqualFold(algorithm, "MD5") {
+			continue
+		}
+
+		c := &digestChallenge{
+			realm:  params["realm"],
+			nonce:  params["nonce"],
+			opaque: params["opaque"],
+		}
+		// only qop=auth is supported, as auth-int requires hashing the body
+		for _, qop := range strings.Split(params["qop"], ",") {
+			if strings.TrimSpace(qop) == "auth" {
+				c.qop = "auth"
+			}
+		}
+		if params["qop"] != "" && c.qop == "" {
+			continue
+		}
+		return c
+	}
+	return nil
+}
+
+// hasBasicChallenge reports whether the server offers the basic scheme in
+// one of the WWW-Authenticate headers.
+func hasBasicChallenge(headers []string) bool {
+	for _, header := range headers {
+		scheme, _, _ := strings.Cut(header, " ")
+		if strings.EqualFold(scheme, "Basic") {
+			return true
+		}
+	}
+	return false
+}
+
+// parseAuthParams parses the comma separated list of key=value pairs of a
+// WWW-Authenticate header. Values may be quoted.
+func parseAuthParams(s string) map[string]string {
+	params := make(map[string]string)
+	for len(s) > 0 {
+		s = strings.TrimLeft(s, " ,")
+		key, rest, ok := strings.Cut(s, "=")
+		if !ok {
+			break
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			// quoted string, backslash escapes a character
+			var sb strings.Builder
+			i := 1
+			for ; i < len(rest) && rest[i] != '"'; i++ {
+				if rest[i] == '\\' && i+1 < len(rest) {
+					i++
+				}
+				sb.WriteByte(rest[i])
+			}
+			value = sb.String()
+			if i < len(rest) {
+				i++
+			}
+			s = rest[i:]
+		} else {
+			value, s, _ = strings.Cut(rest, ",")
+			value = strings.TrimSpace(value)
+		}
+		params[key] = value
+	}
+	return params
+}
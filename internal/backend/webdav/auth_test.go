@@ -0,0 +1,168 @@
+package webdav
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestDigestAuthorization(t *testing.T) {
+	// example from RFC 2617, section 3.5
+	challenge := parseDigestChallenge([]string{
+		`Basic realm="testrealm@host.com"`,
+		`Digest realm="testrealm@host.com", qop="auth,auth-int", nonce="dcd98b7102dd2f0e8b11d0f600bfb0c093", opaque="5ccc069c403ebaf9f0171e9517f40e41"`,
+	})
+	if challenge == nil {
+		t.Fatal("digest challenge not found")
+	}
+	rtest.Equals(t, "testrealm@host.com", challenge.realm)
+	rtest.Equals(t, "dcd98b7102dd2f0e8b11d0f600bfb0c093", challenge.nonce)
+	rtest.Equals(t, "5ccc069c403ebaf9f0171e9517f40e41", challenge.opaque)
+	rtest.Equals(t, "auth", challenge.qop)
+
+	tr := newAuthTransport(nil, "host.com", "Mufasa", "Circle Of Life")
+	tr.digest = challenge
+	header := tr.digestAuthorization("GET", "/dir/index.html", 1, "0a4f113b")
+
+	want := `Digest username="Mufasa", realm="testrealm@host.com", nonce="dcd98b7102dd2f0e8b11d0f600bfb0c093", ` +
+		`uri="/dir/index.html", response="6629fae49393a05397450978507c4ef1", qop=auth, nc=00000001, ` +
+		`cnonce="0a4f113b", opaque="5ccc069c403ebaf9f0171e9517f40e41"`
+	rtest.Equals(t, want, header)
+}
+
+func TestParseDigestChallengeUnsupported(t *testing.T) {
+	for _, headers := range [][]string{
+		{`Basic realm="test"`},
+		{`Digest realm="test", nonce="abc", algorithm=SHA-256`},
+		{`Digest realm="test", nonce="abc", qop="auth-int"`},
+	} {
+		if c := parseDigestChallenge(headers); c != nil {
+			t.Errorf("unexpected challenge %v for %v", c, headers)
+		}
+	}
+}
+
+func TestDigestRoundTrip(t *testing.T) {
+	const nonce = "6f1d46d3e0d7c1b2"
+	var bodies []string
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		buf, err := io.ReadAll(r.Body)
+		rtest.OK(t, err)
+		bodies = append(bodies, string(buf))
+
+		scheme, rest, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+		params := parseAuthParams(rest)
+		if scheme != "Digest" || params["nonce"] != nonce {
+			w.Header().Set("WWW-Authenticate", `Digest realm="restic", qop="auth", nonce="`+nonce+`"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		ha1 := md5Hex("user:restic:secret")
+		ha2 := md5Hex(r.Method + ":" + params["uri"])
+		want := md5Hex(strings.Join([]string{ha1, nonce, params["nc"], params["cnonce"], params["qop"], ha2}, ":"))
+		if params["response"] != want {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer srv.Close()
+
+	client := http.Client{Transport: newAuthTransport(http.DefaultTransport, srv.Listener.Addr().String(), "user", "secret")}
+	for i := 0; i < 2; i++ {
+		req, err := http.NewRequest(http.MethodPut, srv.URL+"/file", strings.NewReader("data"))
+		rtest.OK(t, err)
+		resp, err := client.Do(req)
+		rtest.OK(t, err)
+		rtest.OK(t, resp.Body.Close())
+		rtest.Equals(t, http.StatusCreated, resp.StatusCode)
+	}
+
+	// the first request is sent again after the challenge, the second one
+	// directly uses digest authentication
+	rtest.Equals(t, []string{"data", "data", "data"}, bodies)
+}
+
+func TestBasicRoundTrip(t *testing.T) {
+	var auths []string
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, err := io.Copy(io.Discard, r.Body)
+		rtest.OK(t, err)
+		auths = append(auths, r.Header.Get("Authorization"))
+
+		username, password, ok := r.BasicAuth()
+		if !ok || username != "user" || password != "secret" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="restic"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer srv.Close()
+
+	client := http.Client{Transport: newAuthTransport(http.DefaultTransport, srv.Listener.Addr().String(), "user", "secret")}
+	for i := 0; i < 2; i++ {
+		req, err := http.NewRequest(http.MethodPut, srv.URL+"/file", strings.NewReader("data"))
+		rtest.OK(t, err)
+		resp, err := client.Do(req)
+		rtest.OK(t, err)
+		rtest.OK(t, resp.Body.Close())
+		rtest.Equals(t, http.StatusCreated, resp.StatusCode)
+	}
+
+	// the password is not sent via plain HTTP before the server asks for it
+	rtest.Equals(t, 3, len(auths))
+	rtest.Equals(t, "", auths[0])
+	rtest.Assert(t, auths[1] != "" && auths[1] == auths[2], "unexpected authorization headers %v", auths)
+}
+
+func TestBasicOnlyPreemptiveForHTTPS(t *testing.T) {
+	tr := newAuthTransport(nil, "example.com", "user", "secret")
+	for _, test := range []struct {
+		url  string
+		auth bool
+	}{
+		{"http://example.com/file", false},
+		{"https://example.com/file", true},
+	} {
+		req, err := http.NewRequest(http.MethodGet, test.url, nil)
+		rtest.OK(t, err)
+		_, _, ok := tr.authorize(req).BasicAuth()
+		rtest.Equals(t, test.auth, ok)
+	}
+}
+
+func TestAuthOnlyForRepositoryHost(t *testing.T) {
+	var auths []string
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auths = append(auths, r.Header.Get("Authorization"))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer other.Close()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		username, password, ok := r.BasicAuth()
+		if !ok || username != "user" || password != "secret" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="restic"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		http.Redirect(w, r, other.URL+r.URL.Path, http.StatusFound)
+	}))
+	defer srv.Close()
+
+	// the credentials must not be sent to the target of a redirect
+	client := http.Client{Transport: newAuthTransport(http.DefaultTransport, srv.Listener.Addr().String(), "user", "secret")}
+	resp, err := client.Get(srv.URL + "/file")
+	rtest.OK(t, err)
+	rtest.OK(t, resp.Body.Close())
+	rtest.Equals(t, http.StatusOK, resp.StatusCode)
+	rtest.Equals(t, []string{""}, auths)
+}
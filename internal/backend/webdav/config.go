@@ -0,0 +1,91 @@
+package webdav
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/options"
+)
+
+// Config contains all configuration necessary to connect to a WebDAV server.
+type Config struct {
+	URL      *url.URL
+	Username string
+	Password options.SecretString
+
+	Connections uint `option:"connections" help:"set a limit for the number of concurrent connections (default: 5)"`
+
+	CACert        string `option:"cacert" help:"file to load the root certificates for the server from (default: --cacert)"`
+	TLSClientCert string `option:"tls-client-cert" help:"file containing the PEM encoded TLS client certificate (default: --tls-client-cert)"`
+	TLSClientKey  string `option:"tls-client-key" help:"file containing the PEM encoded private key of the client certificate, if not included in the certificate file"`
+}
+
+func init() {
+	options.Register("webdav", Config{})
+}
+
+// NewConfig returns a new Config with the default values filled in.
+func NewConfig() Config {
+	return Config{
+		Connections: 5,
+	}
+}
+
+// ParseConfig parses the string s and extracts the WebDAV server URL. The
+// supported configuration format is webdav:https://[user[:password]@]host/path.
+// The credentials are removed from the URL.
+func ParseConfig(s string) (interface{}, error) {
+	if !strings.HasPrefix(s, "webdav:") {
+		return nil, errors.New("invalid WebDAV backend specification")
+	}
+
+	s = prepareURL(s)
+
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, errors.Errorf("webdav: unsupported URL scheme %q", u.Scheme)
+	}
+
+	cfg := NewConfig()
+	if u.User != nil {
+		cfg.Username = u.User.Username()
+		password, _ := u.User.Password()
+		cfg.Password = options.NewSecretString(password)
+		u.User = nil
+	}
+	cfg.URL = u
+	return cfg, nil
+}
+
+// StripPassword removes the password from the URL
+// If the repository location cannot be parsed as a valid URL, it will be returned as is
+// (it's because this function is used for logging errors)
+func StripPassword(s string) string {
+	scheme := s[:7]
+	s = prepareURL(s)
+
+	u, err := url.Parse(s)
+	if err != nil {
+		return scheme + s
+	}
+
+	if _, set := u.User.Password(); !set {
+		return scheme + s
+	}
+
+	// a password was set: we replace it with ***
+	return scheme + strings.Replace(u.String(), u.User.String()+"@", u.User.Username()+":***@", 1)
+}
+
+func prepareURL(s string) string {
+	s = s[7:]
+	if !strings.HasSuffix(s, "/") {
+		s += "/"
+	}
+	return s
+}
@@ -0,0 +1,569 @@
+package webdav
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/restic/restic/internal/backend"
+	"github.com/restic/restic/internal/backend/layout"
+	"github.com/restic/restic/internal/backend/sema"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+
+	"github.com/cenkalti/backoff/v4"
+)
+
+// make sure the webdav backend implements restic.Backend
+var _ restic.Backend = &Backend{}
+
+// Backend stores data on a WebDAV server.
+type Backend struct {
+	url         *url.URL
+	connections uint
+	sem         sema.Semaphore
+	client      http.Client
+	layout.Layout
+}
+
+// Open opens the WebDAV backend with the given config.
+func Open(cfg Config, rt http.RoundTripper) (*Backend, error) {
+	sem, err := sema.New(cfg.Connections)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.Username != "" || cfg.Password.Unwrap() != "" {
+		rt = newAuthTransport(rt, cfg.URL.Host, cfg.Username, cfg.Password.Unwrap())
+	}
+
+	// the layout works on the path, the scheme and host are added by urlFor
+	u := *cfg.URL
+	p := strings.TrimSuffix(u.Path, "/")
+	if p == "" {
+		p = "/"
+	}
+
+	be := &Backend{
+		url:         &u,
+		client:      http.Client{Transport: rt},
+		Layout:      &layout.DefaultLayout{Path: p, Join: path.Join},
+		connections: cfg.Connections,
+		sem:         sem,
+	}
+
+	return be, nil
+}
+
+// Create creates all the necessary collections for a new repository on the
+// WebDAV server.
+func Create(ctx context.Context, cfg Config, rt http.RoundTripper) (*Backend, error) {
+	be, err := Open(cfg, rt)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = be.Stat(ctx, restic.Handle{Type: restic.ConfigFile})
+	if err == nil {
+		return nil, errors.Fatal("config file already exists")
+	}
+	if !be.IsNotExist(err) {
+		return nil, err
+	}
+
+	base, _ := be.Basedir(restic.ConfigFile)
+	err = be.mkcol(ctx, base)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, dir := range be.Paths() {
+		err = be.mkcol(ctx, dir)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return be, nil
+}
+
+// urlFor returns the URL for the path p on the server.
+func (b *Backend) urlFor(p string) string {
+	u := *b.url
+	u.Path = p
+	u.RawPath = ""
+	return u.String()
+}
+
+// do sends the request while holding a token of the semaphore.
+func (b *Backend) do(req *http.Request) (*http.Response, error) {
+	b.sem.GetToken()
+	resp, err := b.client.Do(req)
+	b.sem.ReleaseToken()
+	return resp, err
+}
+
+// collection returns the path of the collection dir with a trailing slash.
+func collection(dir string) string {
+	return strings.TrimSuffix(dir, "/") + "/"
+}
+
+func drainAndClose(resp *http.Response) error {
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return resp.Body.Close()
+}
+
+// mkcol creates the collection dir. If the parent collection is missing, it
+// is created first. Existing collections are ignored.
+func (b *Backend) mkcol(ctx context.Context, dir string) error {
+	req, err := http.NewRequestWithContext(ctx, "MKCOL", b.urlFor(collection(dir)), nil)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	resp, err := b.do(req)
+	if err != nil {
+		return errors.Wrap(err, "MKCOL")
+	}
+	_ = drainAndClose(resp)
+
+	switch resp.StatusCode {
+	case http.StatusCreated, http.StatusOK:
+		return nil
+	case http.StatusMethodNotAllowed:
+		// the collection already exists
+		return nil
+	case http.StatusConflict:
+		parent := path.Dir(dir)
+		if parent == dir {
+			break
+		}
+		debug.Log("parent of %v does not exist, creating it", dir)
+		err = b.mkcol(ctx, parent)
+		if err != nil {
+			return err
+		}
+		return b.mkcol(ctx, dir)
+	}
+
+	return errors.Errorf("creating directory %v failed, server response: %v (%v)", dir, resp.Status, resp.StatusCode)
+}
+
+func (b *Backend) Connections() uint {
+	return b.connections
+}
+
+// Location returns this backend's location (the server's URL).
+func (b *Backend) Location() string {
+	return b.url.String()
+}
+
+// Hasher may return a hash function for calculating a content hash for the backend
+func (b *Backend) Hasher() hash.Hash {
+	return nil
+}
+
+// HasAtomicReplace returns whether Save() can atomically replace files
+func (b *Backend) HasAtomicReplace() bool {
+	// WebDAV servers differ in whether PUT replaces a file atomically
+	return false
+}
+
+// Save stores data in the backend at the handle.
+func (b *Backend) Save(ctx context.Context, h restic.Handle, rd restic.RewindReader) error {
+	if err := h.Valid(); err != nil {
+		return backoff.Permanent(err)
+	}
+
+	resp, err := b.put(ctx, h, rd)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode == http.StatusConflict {
+		// the directory is missing, e.g. it was removed by another program
+		debug.Log("directory for %v is missing, creating it", h)
+		err = b.mkcol(ctx, strings.TrimSuffix(b.Dirname(h), "/"))
+		if err != nil {
+			return err
+		}
+
+		err = rd.Rewind()
+		if err != nil {
+			return err
+		}
+
+		resp, err = b.put(ctx, h, rd)
+		if err != nil {
+			return err
+		}
+	}
+
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return errors.Errorf("server response unexpected: %v (%v)", resp.Status, resp.StatusCode)
+	}
+
+	return nil
+}
+
+// put uploads the data from rd, the body of the response is already closed.
+func (b *Backend) put(ctx context.Context, h restic.Handle, rd restic.RewindReader) (*http.Response, error) {
+	// make sure that client.Do() cannot close the reader by wrapping it
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, b.urlFor(b.Filename(h)), io.NopCloser(rd))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+
+	// explicitly set the content length, this prevents chunked encoding and
+	// let's the server know what's coming.
+	req.ContentLength = rd.Length()
+	req.GetBody = func() (io.ReadCloser, error) {
+		err := rd.Rewind()
+		return io.NopCloser(rd), err
+	}
+
+	resp, err := b.do(req)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return resp, errors.Wrap(drainAndClose(resp), "Close")
+}
+
+// notExistError is returned whenever the requested file does not exist on the
+// server.
+type notExistError struct {
+	restic.Handle
+}
+
+func (e *notExistError) Error() string {
+	return fmt.Sprintf("%v does not exist", e.Handle)
+}
+
+// IsNotExist returns true if the error was caused by a non-existing file.
+func (b *Backend) IsNotExist(err error) bool {
+	var e *notExistError
+	return errors.As(err, &e)
+}
+
+// Load runs fn with a reader that yields the contents of the file at h at the
+// given offset.
+func (b *Backend) Load(ctx context.Context, h restic.Handle, length int, offset int64, fn func(rd io.Reader) error) error {
+	return backend.DefaultLoad(ctx, h, length, offset, b.openReader, fn)
+}
+
+func (b *Backend) openReader(ctx context.Context, h restic.Handle, length int, offset int64) (io.ReadCloser, error) {
+	debug.Log("Load %v, length %v, offset %v", h, length, offset)
+	if err := h.Valid(); err != nil {
+		return nil, backoff.Permanent(err)
+	}
+
+	if offset < 0 {
+		return nil, errors.New("offset is negative")
+	}
+
+	if length < 0 {
+		return nil, errors.Errorf("invalid length %d", length)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, b.urlFor(b.Filename(h)), nil)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if offset > 0 || length > 0 {
+		byteRange := fmt.Sprintf("bytes=%d-", offset)
+		if length > 0 {
+			byteRange = fmt.Sprintf("bytes=%d-%d", offset, offset+int64(length)-1)
+		}
+		req.Header.Set("Range", byteRange)
+		debug.Log("Load(%v) send range %v", h, byteRange)
+	}
+
+	resp, err := b.do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "client.Do")
+	}
+
+	switch resp.StatusCode {
+	case http.StatusNotFound:
+		_ = drainAndClose(resp)
+		return nil, &notExistError{h}
+	case http.StatusPartialContent:
+		return resp.Body, nil
+	case http.StatusOK:
+		// the server ignored the range header and returns the whole file
+		if offset > 0 {
+			_, err = io.CopyN(io.Discard, resp.Body, offset)
+			if err != nil {
+				_ = resp.Body.Close()
+				return nil, errors.Wrap(err, "skip to offset")
+			}
+		}
+		if length > 0 {
+			return backend.LimitReadCloser(resp.Body, int64(length)), nil
+		}
+		return resp.Body, nil
+	}
+
+	_ = drainAndClose(resp)
+	return nil, errors.Errorf("unexpected HTTP response (%v): %v", resp.StatusCode, resp.Status)
+}
+
+// Stat returns information about a blob.
+func (b *Backend) Stat(ctx context.Context, h restic.Handle) (restic.FileInfo, error) {
+	if err := h.Valid(); err != nil {
+		return restic.FileInfo{}, backoff.Permanent(err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, b.urlFor(b.Filename(h)), nil)
+	if err != nil {
+		return restic.FileInfo{}, errors.WithStack(err)
+	}
+
+	resp, err := b.do(req)
+	if err != nil {
+		return restic.FileInfo{}, errors.WithStack(err)
+	}
+
+	if err = drainAndClose(resp); err != nil {
+		return restic.FileInfo{}, errors.Wrap(err, "Close")
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		return restic.FileInfo{}, &notExistError{h}
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return restic.FileInfo{}, errors.Errorf("unexpected HTTP response (%v): %v", resp.StatusCode, resp.Status)
+	}
+
+	if resp.ContentLength < 0 {
+		return restic.FileInfo{}, errors.New("negative content length")
+	}
+
+	bi := restic.FileInfo{
+		Size: resp.ContentLength,
+		Name: h.Name,
+	}
+
+	return bi, nil
+}
+
+// Remove removes the blob with the given name and type.
+func (b *Backend) Remove(ctx context.Context, h restic.Handle) error {
+	if err := h.Valid(); err != nil {
+		return backoff.Permanent(err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, b.urlFor(b.Filename(h)), nil)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	resp, err := b.do(req)
+	if err != nil {
+		return errors.Wrap(err, "client.Do")
+	}
+
+	if err = drainAndClose(resp); err != nil {
+		return errors.Wrap(err, "Close")
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		return &notExistError{h}
+	}
+
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return errors.Errorf("blob not removed, server response: %v (%v)", resp.Status, resp.StatusCode)
+	}
+
+	return nil
+}
+
+// propfindBody requests only the properties needed to list files.
+const propfindBody = `<?xml version="1.0" encoding="utf-8"?>
+<d:propfind xmlns:d="DAV:">
+  <d:prop>
+    <d:resourcetype/>
+    <d:getcontentlength/>
+  </d:prop>
+</d:propfind>`
+
+// multistatus is the response to a PROPFIND request.
+type multistatus struct {
+	Responses []struct {
+		Href     string `xml:"DAV: href"`
+		Propstat []struct {
+			Prop struct {
+				ContentLength string `xml:"DAV: getcontentlength"`
+				ResourceType  struct {
+					Collection *struct{} `xml:"DAV: collection"`
+				} `xml:"DAV: resourcetype"`
+			} `xml:"DAV: prop"`
+			Status string `xml:"DAV: status"`
+		} `xml:"DAV: propstat"`
+	} `xml:"DAV: response"`
+}
+
+// davEntry is a single entry of a collection.
+type davEntry struct {
+	name  string
+	size  int64
+	isDir bool
+}
+
+// readDir lists the entries of the collection dir. A missing collection is
+// returned as empty.
+func (b *Backend) readDir(ctx context.Context, dir string) ([]davEntry, error) {
+	req, err := http.NewRequestWithContext(ctx, "PROPFIND", b.urlFor(collection(dir)), strings.NewReader(propfindBody))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	req.Header.Set("Depth", "1")
+	req.Header.Set("Content-Type", "application/xml; charset=utf-8")
+
+	resp, err := b.do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "List")
+	}
+
+	defer func() {
+		_ = drainAndClose(resp)
+	}()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+
+	if resp.StatusCode != http.StatusMultiStatus {
+		return nil, errors.Errorf("List failed, server response: %v (%v)", resp.Status, resp.StatusCode)
+	}
+
+	var ms multistatus
+	err = xml.NewDecoder(resp.Body).Decode(&ms)
+	if err != nil {
+		return nil, errors.Wrap(err, "Decode")
+	}
+
+	var entries []davEntry
+	for _, r := range ms.Responses {
+		href, err := url.Parse(r.Href)
+		if err != nil {
+			return nil, errors.Wrap(err, "parse href")
+		}
+
+		// the collection itself is contained in the response
+		p := strings.TrimSuffix(href.Path, "/")
+		if p == strings.TrimSuffix(dir, "/") || p == "" {
+			continue
+		}
+
+		entry := davEntry{name: path.Base(p)}
+		for _, ps := range r.Propstat {
+			if !strings.Contains(ps.Status, " 200 ") {
+				continue
+			}
+			if ps.Prop.ResourceType.Collection != nil {
+				entry.isDir = true
+			}
+			if ps.Prop.ContentLength != "" {
+				entry.size, err = strconv.ParseInt(ps.Prop.ContentLength, 10, 64)
+				if err != nil {
+					return nil, errors.Wrap(err, "parse content length")
+				}
+			}
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+// List runs fn for each file in the backend which has the type t. When an
+// error occurs (or fn returns an error), List stops and returns it.
+func (b *Backend) List(ctx context.Context, t restic.FileType, fn func(restic.FileInfo) error) error {
+	basedir, subdirs := b.Basedir(t)
+
+	dirs := []string{basedir}
+	if subdirs {
+		entries, err := b.readDir(ctx, basedir)
+		if err != nil {
+			return err
+		}
+
+		dirs = dirs[:0]
+		for _, entry := range entries {
+			if entry.isDir {
+				dirs = append(dirs, path.Join(basedir, entry.name))
+			}
+		}
+	}
+
+	for _, dir := range dirs {
+		entries, err := b.readDir(ctx, dir)
+		if err != nil {
+			return err
+		}
+
+		for _, entry := range entries {
+			if entry.isDir {
+				continue
+			}
+
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			err := fn(restic.FileInfo{
+				Name: entry.name,
+				Size: entry.size,
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return ctx.Err()
+}
+
+// Close closes all open files.
+func (b *Backend) Close() error {
+	// this does not need to do anything, all open files are closed within the
+	// same function.
+	return nil
+}
+
+// Delete removes all data in the backend.
+func (b *Backend) Delete(ctx context.Context) error {
+	base, _ := b.Basedir(restic.ConfigFile)
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, b.urlFor(collection(base)), nil)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	resp, err := b.do(req)
+	if err != nil {
+		return errors.Wrap(err, "client.Do")
+	}
+
+	if err = drainAndClose(resp); err != nil {
+		return errors.Wrap(err, "Close")
+	}
+
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return errors.Errorf("repository not removed, server response: %v (%v)", resp.Status, resp.StatusCode)
+	}
+
+	return nil
+}
@@ -0,0 +1,122 @@
+package webdav_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+
+	"github.com/restic/restic/internal/backend"
+	"github.com/restic/restic/internal/backend/test"
+	"github.com/restic/restic/internal/backend/webdav"
+	"github.com/restic/restic/internal/options"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+
+	xwebdav "golang.org/x/net/webdav"
+)
+
+// runWebDAVServer starts a WebDAV server which stores the files in dir and
+// requires basic authentication.
+func runWebDAVServer(t testing.TB, dir string) *url.URL {
+	handler := &xwebdav.Handler{
+		FileSystem: xwebdav.Dir(dir),
+		LockSystem: xwebdav.NewMemLS(),
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, password, ok := r.BasicAuth()
+		if !ok || user != "user" || password != "secret" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="restic"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+
+	u, err := url.Parse(srv.URL + "/restic-test/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+func newTestSuite(t testing.TB, url *url.URL, username, password string, minimalData bool) *test.Suite {
+	tr, err := backend.Transport(backend.TransportOptions{})
+	if err != nil {
+		t.Fatalf("cannot create transport for tests: %v", err)
+	}
+
+	return &test.Suite{
+		MinimalData: minimalData,
+
+		// NewConfig returns a config for a new temporary backend that will be used in tests.
+		NewConfig: func() (interface{}, error) {
+			cfg := webdav.NewConfig()
+			cfg.URL = url
+			cfg.Username = username
+			cfg.Password = options.NewSecretString(password)
+			return cfg, nil
+		},
+
+		// CreateFn is a function that creates a temporary repository for the tests.
+		Create: func(config interface{}) (restic.Backend, error) {
+			cfg := config.(webdav.Config)
+			return webdav.Create(context.TODO(), cfg, tr)
+		},
+
+		// OpenFn is a function that opens a previously created temporary repository.
+		Open: func(config interface{}) (restic.Backend, error) {
+			cfg := config.(webdav.Config)
+			return webdav.Open(cfg, tr)
+		},
+
+		// CleanupFn removes data created during the tests.
+		Cleanup: func(config interface{}) error {
+			return nil
+		},
+	}
+}
+
+func TestBackendWebDAV(t *testing.T) {
+	serverURL := runWebDAVServer(t, rtest.TempDir(t))
+	newTestSuite(t, serverURL, "user", "secret", false).RunTests(t)
+}
+
+func TestBackendWebDAVWrongPassword(t *testing.T) {
+	serverURL := runWebDAVServer(t, rtest.TempDir(t))
+
+	tr, err := backend.Transport(backend.TransportOptions{})
+	rtest.OK(t, err)
+
+	cfg := webdav.NewConfig()
+	cfg.URL = serverURL
+	cfg.Username = "user"
+	cfg.Password = options.NewSecretString("wrong")
+
+	_, err = webdav.Create(context.TODO(), cfg, tr)
+	rtest.Assert(t, err != nil, "expected error for wrong password")
+}
+
+func TestBackendWebDAVExternalServer(t *testing.T) {
+	repostr := os.Getenv("RESTIC_TEST_WEBDAV_REPOSITORY")
+	if repostr == "" {
+		t.Skipf("environment variable %v not set", "RESTIC_TEST_WEBDAV_REPOSITORY")
+	}
+
+	cfg, err := webdav.ParseConfig(repostr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := cfg.(webdav.Config)
+	newTestSuite(t, c.URL, c.Username, c.Password.Unwrap(), true).RunTests(t)
+}
+
+func BenchmarkBackendWebDAV(t *testing.B) {
+	serverURL := runWebDAVServer(t, rtest.TempDir(t))
+	newTestSuite(t, serverURL, "user", "secret", false).RunBenchmarks(t)
+}
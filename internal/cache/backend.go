@@ -43,6 +43,11 @@ func (b *Backend) Remove(ctx context.Context, h restic.Handle) error {
 	return b.Cache.remove(h)
 }
 
+// Warmup prepares the files for reading if the wrapped backend supports it.
+func (b *Backend) Warmup(ctx context.Context, handles []restic.Handle) error {
+	return restic.Warmup(ctx, b.Backend, handles)
+}
+
 func autoCacheTypes(h restic.Handle) bool {
 	switch h.Type {
 	case restic.IndexFile, restic.SnapshotFile:
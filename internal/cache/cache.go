@@ -248,3 +248,15 @@ func (c *Cache) Wrap(be restic.Backend) restic.Backend {
 func (c *Cache) BaseDir() string {
 	return c.Base
 }
+
+// StateDir returns the directory name within the cache directory of the
+// repository which holds local state for the operation name, for example the
+// progress of an interrupted backup. The directory is created if it does not
+// exist yet.
+func (c *Cache) StateDir(name string) (string, error) {
+	dir := filepath.Join(c.path, "state", name)
+	if err := fs.MkdirAll(dir, dirMode); err != nil {
+		return "", errors.WithStack(err)
+	}
+	return dir, nil
+}
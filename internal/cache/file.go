@@ -6,6 +6,7 @@ import (
 	"path/filepath"
 	"runtime"
 
+	"github.com/minio/sha256-simd"
 	"github.com/pkg/errors"
 	"github.com/restic/restic/internal/backend"
 	"github.com/restic/restic/internal/crypto"
@@ -173,6 +174,53 @@ func (c *Cache) Clear(t restic.FileType, valid restic.IDSet) error {
 	return nil
 }
 
+// Verify checks all cached files of type t and removes those whose content
+// does not match their ID. The IDs of the removed files are returned.
+func (c *Cache) Verify(t restic.FileType) (removed restic.IDs, err error) {
+	debug.Log("Verify(%v)", t)
+	list, err := c.list(t)
+	if err != nil {
+		return nil, err
+	}
+
+	for id := range list {
+		h := restic.Handle{Type: t, Name: id.String()}
+		ok, err := c.verifyFile(h, id)
+		if err != nil {
+			return removed, err
+		}
+		if ok {
+			continue
+		}
+
+		debug.Log("removing damaged cache entry %v", h)
+		if err = c.remove(h); err != nil {
+			return removed, err
+		}
+		removed = append(removed, id)
+	}
+
+	return removed, nil
+}
+
+// verifyFile returns whether the hash of the cached file matches id.
+func (c *Cache) verifyFile(h restic.Handle, id restic.ID) (bool, error) {
+	f, err := fs.Open(c.filename(h))
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return false, errors.WithStack(err)
+	}
+
+	return restic.IDFromHash(hash.Sum(nil)) == id, nil
+}
+
 func isFile(fi os.FileInfo) bool {
 	return fi.Mode()&(os.ModeType|os.ModeCharDevice) == 0
 }
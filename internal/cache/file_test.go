@@ -134,6 +134,24 @@ func TestFiles(t *testing.T) {
 	}
 }
 
+func TestFileVerify(t *testing.T) {
+	c := TestNewCache(t)
+
+	ids := generateRandomFiles(t, restic.IndexFile, c)
+	damaged := randomID(ids)
+	test.OK(t, os.WriteFile(c.filename(restic.Handle{Type: restic.IndexFile, Name: damaged.String()}), []byte("broken"), 0600))
+
+	removed, err := c.Verify(restic.IndexFile)
+	test.OK(t, err)
+	test.Equals(t, restic.IDs{damaged}, removed)
+
+	ids.Delete(damaged)
+	list := listFiles(t, c, restic.IndexFile)
+	if !ids.Equals(list) {
+		t.Errorf("wrong list of remaining files, want:\n  %v\ngot:\n  %v", ids, list)
+	}
+}
+
 func TestFileLoad(t *testing.T) {
 	seed := time.Now().Unix()
 	t.Logf("seed is %v", seed)
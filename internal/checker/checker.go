@@ -40,6 +40,7 @@ type Checker struct {
 
 	masterIndex *index.MasterIndex
 	snapshots   restic.Lister
+	snapshotIDs restic.IDSet
 
 	repo restic.Repository
 }
@@ -61,6 +62,21 @@ func New(repo restic.Repository, trackUnused bool) *Checker {
 // ErrLegacyLayout is returned when the repository uses the S3 legacy layout.
 var ErrLegacyLayout = errors.New("repository uses S3 legacy layout")
 
+var (
+	// ErrPackNotFound is contained in a PackError for a pack which is
+	// referenced by the index but does not exist.
+	ErrPackNotFound = errors.New("does not exist")
+	// ErrPackSize is contained in a PackError for a pack whose size does not
+	// match the index.
+	ErrPackSize = errors.New("unexpected file size")
+	// ErrPackHash is contained in a PackError returned by ReadPacks for a
+	// pack whose content does not match its ID.
+	ErrPackHash = errors.New("Pack ID does not match")
+	// ErrBlobNotFound is contained in the errors of a TreeError for a blob
+	// which is not contained in the index.
+	ErrBlobNotFound = errors.New("not found in index")
+)
+
 // ErrDuplicatePacks is returned when a pack is found in more than one index.
 type ErrDuplicatePacks struct {
 	PackID  restic.ID
@@ -199,6 +215,10 @@ func (e *PackError) Error() string {
 	return "pack " + e.ID.String() + ": " + e.Err.Error()
 }
 
+func (e *PackError) Unwrap() error {
+	return e.Err
+}
+
 // IsOrphanedPack returns true if the error describes a pack which is not
 // contained in any index.
 func IsOrphanedPack(err error) bool {
@@ -254,7 +274,7 @@ func (c *Checker) Packs(ctx context.Context, errChan chan<- error) {
 			select {
 			case <-ctx.Done():
 				return
-			case errChan <- &PackError{ID: id, Err: errors.New("does not exist")}:
+			case errChan <- &PackError{ID: id, Err: ErrPackNotFound}:
 			}
 			continue
 		}
@@ -264,7 +284,7 @@ func (c *Checker) Packs(ctx context.Context, errChan chan<- error) {
 			select {
 			case <-ctx.Done():
 				return
-			case errChan <- &PackError{ID: id, Err: errors.Errorf("unexpected file size: got %d, expected %d", reposize, size)}:
+			case errChan <- &PackError{ID: id, Err: fmt.Errorf("%w: got %d, expected %d", ErrPackSize, reposize, size)}:
 			}
 		}
 	}
@@ -293,6 +313,10 @@ func (e *Error) Error() string {
 	return e.Err.Error()
 }
 
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
 // TreeError collects several errors that occurred while processing a tree.
 type TreeError struct {
 	ID     restic.ID
@@ -328,7 +352,26 @@ func (c *Checker) checkTreeWorker(ctx context.Context, trees <-chan restic.TreeI
 	}
 }
 
-func loadSnapshotTreeIDs(ctx context.Context, lister restic.Lister, repo restic.Repository) (ids restic.IDs, errs []error) {
+// SelectSnapshots restricts Structure to the snapshots with the given IDs, by
+// default all snapshots are checked.
+func (c *Checker) SelectSnapshots(ids restic.IDSet) {
+	c.snapshotIDs = ids
+}
+
+func loadSnapshotTreeIDs(ctx context.Context, lister restic.Lister, repo restic.Repository, selected restic.IDSet) (ids restic.IDs, errs []error) {
+	if selected != nil {
+		for id := range selected {
+			sn, err := restic.LoadSnapshot(ctx, repo, id)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			debug.Log("snapshot %v has tree %v", id, *sn.Tree)
+			ids = append(ids, *sn.Tree)
+		}
+		return ids, errs
+	}
+
 	err := restic.ForAllSnapshots(ctx, lister, repo, nil, func(id restic.ID, sn *restic.Snapshot, err error) error {
 		if err != nil {
 			errs = append(errs, err)
@@ -350,7 +393,7 @@ func loadSnapshotTreeIDs(ctx context.Context, lister restic.Lister, repo restic.
 // subtrees are available in the index. errChan is closed after all trees have
 // been traversed.
 func (c *Checker) Structure(ctx context.Context, p *progress.Counter, errChan chan<- error) {
-	trees, errs := loadSnapshotTreeIDs(ctx, c.snapshots, c.repo)
+	trees, errs := loadSnapshotTreeIDs(ctx, c.snapshots, c.repo, c.snapshotIDs)
 	p.SetMax(uint64(len(trees)))
 	debug.Log("need to check %d trees from snapshots, %d errs returned", len(trees), len(errs))
 
@@ -415,7 +458,7 @@ func (c *Checker) checkTree(id restic.ID, tree *restic.Tree) (errs []error) {
 				_, found := c.repo.LookupBlobSize(blobID, restic.DataBlob)
 				if !found {
 					debug.Log("tree %v references blob %v which isn't contained in index", id, blobID)
-					errs = append(errs, &Error{TreeID: id, Err: errors.Errorf("file %q blob %v not found in index", node.Name, blobID)})
+					errs = append(errs, &Error{TreeID: id, Err: fmt.Errorf("file %q blob %v %w", node.Name, blobID, ErrBlobNotFound)})
 				}
 			}
 
@@ -482,6 +525,29 @@ func (c *Checker) UnusedBlobs(ctx context.Context) (blobs restic.BlobHandles) {
 	return blobs
 }
 
+// ReferencedPacks returns the packs which contain blobs referenced by the
+// checked snapshots. It requires tracking blob references and must be called
+// after Structure.
+func (c *Checker) ReferencedPacks(ctx context.Context) map[restic.ID]int64 {
+	if !c.trackUnused {
+		panic("only works when tracking blob references")
+	}
+	c.blobRefs.Lock()
+	defer c.blobRefs.Unlock()
+
+	packs := make(map[restic.ID]int64)
+	c.repo.Index().Each(ctx, func(blob restic.PackedBlob) {
+		if !c.blobRefs.M.Has(blob.BlobHandle) {
+			return
+		}
+		if size, ok := c.packs[blob.PackID]; ok {
+			packs[blob.PackID] = size
+		}
+	})
+
+	return packs
+}
+
 // CountPacks returns the number of packs in the repository.
 func (c *Checker) CountPacks() uint64 {
 	return uint64(len(c.packs))
@@ -497,7 +563,7 @@ func checkPack(ctx context.Context, r restic.Repository, id restic.ID, blobs []r
 	debug.Log("checking pack %v", id.String())
 
 	if len(blobs) == 0 {
-		return errors.Errorf("pack %v is empty or not indexed", id)
+		return errors.New("is empty or not indexed")
 	}
 
 	// sanity check blobs in index
@@ -572,11 +638,11 @@ func checkPack(ctx context.Context, r restic.Repository, id restic.ID, blobs []r
 	if err != nil {
 		// failed to load the pack file, return as further checks cannot succeed anyways
 		debug.Log("  error streaming pack: %v", err)
-		return errors.Errorf("pack %v failed to download: %v", id, err)
+		return errors.Errorf("failed to download: %v", err)
 	}
 	if !hash.Equal(id) {
 		debug.Log("Pack ID does not match, want %v, got %v", id, hash)
-		return errors.Errorf("Pack ID does not match, want %v, got %v", id, hash)
+		return fmt.Errorf("%w, want %v, got %v", ErrPackHash, id, hash)
 	}
 
 	blobs, hdrSize, err := pack.List(r.Key(), bytes.NewReader(hdrBuf), int64(len(hdrBuf)))
@@ -606,7 +672,7 @@ func checkPack(ctx context.Context, r restic.Repository, id restic.ID, blobs []r
 	}
 
 	if len(errs) > 0 {
-		return errors.Errorf("pack %v contains %v errors: %v", id, len(errs), errs)
+		return errors.Errorf("contains %v errors: %v", len(errs), errs)
 	}
 
 	return nil
@@ -621,6 +687,20 @@ func (c *Checker) ReadData(ctx context.Context, errChan chan<- error) {
 func (c *Checker) ReadPacks(ctx context.Context, packs map[restic.ID]int64, p *progress.Counter, errChan chan<- error) {
 	defer close(errChan)
 
+	// restore archived packs before reading them
+	handles := make([]restic.Handle, 0, len(packs))
+	for pack := range packs {
+		handles = append(handles, restic.Handle{Type: restic.PackFile, Name: pack.String()})
+	}
+	err := restic.Warmup(ctx, c.repo.Backend(), handles)
+	if err != nil {
+		select {
+		case <-ctx.Done():
+		case errChan <- err:
+		}
+		return
+	}
+
 	g, ctx := errgroup.WithContext(ctx)
 	type checkTask struct {
 		id    restic.ID
@@ -655,6 +735,7 @@ func (c *Checker) ReadPacks(ctx context.Context, packs map[restic.ID]int64, p *p
 				if err == nil {
 					continue
 				}
+				err = &PackError{ID: ps.id, Err: err}
 
 				select {
 				case <-ctx.Done():
@@ -681,7 +762,7 @@ func (c *Checker) ReadPacks(ctx context.Context, packs map[restic.ID]int64, p *p
 	}
 	close(ch)
 
-	err := g.Wait()
+	err = g.Wait()
 	if err != nil {
 		select {
 		case <-ctx.Done():
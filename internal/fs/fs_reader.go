@@ -24,12 +24,21 @@ type Reader struct {
 	Mode    os.FileMode
 	ModTime time.Time
 	Size    int64
+	Owner   *Owner
 
 	AllowEmptyFile bool
 
 	open sync.Once
 }
 
+// Owner describes the owner of the file provided by Reader. It is returned by
+// the Sys() method of the file's FileInfo. If User or Group are empty, the
+// name is looked up from the ID.
+type Owner struct {
+	UID, GID    uint32
+	User, Group string
+}
+
 // statically ensure that Local implements FS.
 var _ FS = &Reader{}
 
@@ -68,6 +77,7 @@ func (fs *Reader) fi() os.FileInfo {
 		size:    fs.Size,
 		mode:    fs.Mode,
 		modtime: fs.ModTime,
+		owner:   fs.Owner,
 	}
 }
 
@@ -295,6 +305,7 @@ type fakeFileInfo struct {
 	size    int64
 	mode    os.FileMode
 	modtime time.Time
+	owner   *Owner
 }
 
 func (fi fakeFileInfo) Name() string {
@@ -318,6 +329,9 @@ func (fi fakeFileInfo) IsDir() bool {
 }
 
 func (fi fakeFileInfo) Sys() interface{} {
+	if fi.owner != nil {
+		return fi.owner
+	}
 	return nil
 }
 
@@ -0,0 +1,41 @@
+package fuse
+
+import "github.com/restic/restic/internal/restic"
+
+// Config holds settings for the fuse mount.
+type Config struct {
+	OwnerIsRoot bool
+	// ForceOwner replaces the owner and group of all files and dirs by
+	// OwnerUID and OwnerGID.
+	ForceOwner bool
+	OwnerUID   uint32
+	OwnerGID   uint32
+	// AllowRoot restricts access to the root dir to its owner. Together
+	// with the allow_other and default_permissions mount options only the
+	// owner and the superuser can access the mount.
+	AllowRoot     bool
+	Hosts         []string
+	Tags          []restic.TagList
+	Paths         []string
+	TimeTemplate  string
+	PathTemplates []string
+	// Snapshot is shown at the root of the mount instead of the snapshot
+	// dir structure, if set.
+	Snapshot *restic.Snapshot
+}
+
+// defaultPathTemplates are used if Config.PathTemplates is empty.
+var defaultPathTemplates = []string{
+	"ids/%i",
+	"snapshots/%T",
+	"hosts/%h/%T",
+	"tags/%t/%T",
+	"paths/%p/%T",
+	"groups/%h/%p/%T",
+}
+
+// Size of the blob cache. TODO: make this configurable.
+const blobCacheSize = 64 << 20
+
+// Size of the cache for decoded trees.
+const treeCacheSize = 32 << 20
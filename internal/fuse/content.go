@@ -0,0 +1,270 @@
+package fuse
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/restic/restic/internal/bloblru"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+)
+
+// The default block size to report in stat
+const blockSize = 512
+
+const (
+	// readaheadReads is the number of consecutive sequential reads after
+	// which the following blobs are loaded in advance.
+	readaheadReads = 2
+	// readaheadSlack is the distance in bytes to the end of the last read
+	// within which a read still counts as sequential.
+	readaheadSlack = 4 * 1024 * 1024
+	// readaheadSize is the number of bytes after a sequential read whose
+	// blobs are loaded in advance. It must be a fraction of the blob cache
+	// size, otherwise the blobs are evicted before they are read.
+	readaheadSize = 16 * 1024 * 1024
+	// readaheadWorkers is the number of blobs loaded concurrently in advance
+	// for a file.
+	readaheadWorkers = 4
+)
+
+// fileContent reads the content of a file node from the repository. It is
+// safe for concurrent use.
+//
+// Once a file is read sequentially, the blobs after the current read are
+// loaded in the background. Thus copying large files is limited by the
+// throughput of the backend instead of the latency of loading each blob.
+type fileContent struct {
+	repo      restic.Repository
+	blobCache *bloblru.Cache
+	node      *restic.Node
+	// cumsize[i] holds the cumulative size of blobs[:i].
+	cumsize []uint64
+
+	// ctx is used for loading blobs in advance, it is cancelled by Close
+	ctx     context.Context
+	cancel  context.CancelFunc
+	workers chan struct{}
+
+	m sync.Mutex
+	// end of the sequential reads and their number
+	nextOffset uint64
+	sequential int
+	// blobs before this index were already scheduled for readahead
+	readahead int
+	// loading holds the blobs which are loaded in advance, the channels are
+	// closed once a blob is in the cache or loading failed
+	loading map[int]chan struct{}
+}
+
+// newFileContent returns a fileContent for node. If the size of node does not
+// match the size of its blobs, the node is replaced by a copy with the
+// correct size.
+func newFileContent(repo restic.Repository, blobCache *bloblru.Cache, node *restic.Node) (*fileContent, error) {
+	var bytes uint64
+	cumsize := make([]uint64, 1+len(node.Content))
+	for i, id := range node.Content {
+		size, found := repo.LookupBlobSize(id, restic.DataBlob)
+		if !found {
+			return nil, errors.Errorf("id %v not found in repository", id)
+		}
+
+		bytes += uint64(size)
+		cumsize[i+1] = bytes
+	}
+
+	if bytes != node.Size {
+		debug.Log("sizes do not match: node.Size %v != size %v, using real size", node.Size, bytes)
+		// Make a copy of the node with correct size
+		nodenew := *node
+		nodenew.Size = bytes
+		node = &nodenew
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &fileContent{
+		repo:      repo,
+		blobCache: blobCache,
+		node:      node,
+		cumsize:   cumsize,
+		ctx:       ctx,
+		cancel:    cancel,
+		workers:   make(chan struct{}, readaheadWorkers),
+		loading:   make(map[int]chan struct{}),
+	}, nil
+}
+
+// Close stops loading blobs in advance. Reading is still possible afterwards.
+func (f *fileContent) Close() {
+	f.cancel()
+}
+
+// blobIndex returns the index of the blob which contains offset.
+func (f *fileContent) blobIndex(offset uint64) int {
+	return -1 + sort.Search(len(f.cumsize), func(i int) bool {
+		return f.cumsize[i] > offset
+	})
+}
+
+// detectSequential records a read of size bytes at offset. If the file is
+// read sequentially, the blobs following the read are loaded in advance.
+func (f *fileContent) detectSequential(offset uint64, size int) {
+	end := offset + uint64(size)
+	if end > f.node.Size {
+		end = f.node.Size
+	}
+
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	// The kernel issues several reads at the same time, which may arrive
+	// in a slightly different order. Thus reads near the end of the last
+	// read do not count as random access.
+	switch {
+	case offset+readaheadSlack < f.nextOffset || offset > f.nextOffset+readaheadSlack:
+		f.sequential = 0
+		f.readahead = 0
+		f.nextOffset = end
+		return
+	case end > f.nextOffset:
+		f.sequential++
+		f.nextOffset = end
+	default:
+		return
+	}
+
+	if f.sequential < readaheadReads || end >= f.node.Size {
+		return
+	}
+
+	start := f.blobIndex(end)
+	if end > f.cumsize[start] {
+		// the blob containing end is loaded by the read itself
+		start++
+	}
+	if start < f.readahead {
+		start = f.readahead
+	}
+	stop := start
+	for stop < len(f.node.Content) && f.cumsize[stop] < end+readaheadSize {
+		stop++
+	}
+
+	for i := start; i < stop; i++ {
+		if _, ok := f.loading[i]; ok {
+			continue
+		}
+		done := make(chan struct{})
+		f.loading[i] = done
+		go f.loadAhead(i, done)
+	}
+	if stop > f.readahead {
+		f.readahead = stop
+	}
+}
+
+// loadAhead loads the blob with index i into the cache and closes done.
+func (f *fileContent) loadAhead(i int, done chan struct{}) {
+	defer func() {
+		f.m.Lock()
+		delete(f.loading, i)
+		f.m.Unlock()
+		close(done)
+	}()
+
+	select {
+	case f.workers <- struct{}{}:
+	case <-f.ctx.Done():
+		return
+	}
+	defer func() {
+		<-f.workers
+	}()
+
+	id := f.node.Content[i]
+	if _, ok := f.blobCache.Get(id); ok {
+		return
+	}
+	blob, err := f.repo.LoadBlob(f.ctx, restic.DataBlob, id, nil)
+	if err != nil {
+		// the blob is loaded again when it is read
+		debug.Log("readahead of blob %v of %v failed: %v", id, f.node.Name, err)
+		return
+	}
+	f.blobCache.Add(id, blob)
+}
+
+func (f *fileContent) getBlobAt(ctx context.Context, i int) (blob []byte, err error) {
+	for {
+		blob, ok := f.blobCache.Get(f.node.Content[i])
+		if ok {
+			return blob, nil
+		}
+
+		// wait for the blob if it is currently loaded in advance
+		f.m.Lock()
+		done, ok := f.loading[i]
+		f.m.Unlock()
+		if !ok {
+			break
+		}
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return nil, unwrapCtxCanceled(ctx.Err())
+		}
+	}
+
+	blob, err = f.repo.LoadBlob(ctx, restic.DataBlob, f.node.Content[i], nil)
+	if err != nil {
+		debug.Log("LoadBlob(%v, %v) failed: %v", f.node.Name, f.node.Content[i], err)
+		return nil, unwrapCtxCanceled(err)
+	}
+
+	f.blobCache.Add(f.node.Content[i], blob)
+
+	return blob, nil
+}
+
+// ReadAt reads up to len(dst) bytes starting at offset into dst and returns
+// the number of bytes read. Reading at or beyond the end of the file returns
+// zero bytes.
+func (f *fileContent) ReadAt(ctx context.Context, dst []byte, offset uint64) (int, error) {
+	// handle special case: file is empty or offset is beyond the end
+	if offset >= f.node.Size {
+		return 0, nil
+	}
+
+	f.detectSequential(offset, len(dst))
+
+	// Skip blobs before the offset
+	startContent := f.blobIndex(offset)
+	offset -= f.cumsize[startContent]
+
+	readBytes := 0
+	remainingBytes := len(dst)
+
+	// no lock needed here as getBlobAt can be called concurrently
+	// (blobCache has it's own locking)
+	for i := startContent; remainingBytes > 0 && i < len(f.cumsize)-1; i++ {
+		blob, err := f.getBlobAt(ctx, i)
+		if err != nil {
+			return 0, err
+		}
+
+		if offset > 0 {
+			blob = blob[offset:]
+			offset = 0
+		}
+
+		copied := copy(dst, blob)
+		remainingBytes -= copied
+		readBytes += copied
+
+		dst = dst[copied:]
+	}
+
+	return readBytes, nil
+}
@@ -0,0 +1,138 @@
+package fuse
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+
+	"github.com/restic/restic/internal/bloblru"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+// loadRecordingRepo records how often each data blob is loaded.
+type loadRecordingRepo struct {
+	restic.Repository
+
+	m     sync.Mutex
+	loads map[restic.ID]int
+}
+
+func (r *loadRecordingRepo) LoadBlob(ctx context.Context, t restic.BlobType, id restic.ID, buf []byte) ([]byte, error) {
+	if t == restic.DataBlob {
+		r.m.Lock()
+		r.loads[id]++
+		r.m.Unlock()
+	}
+	return r.Repository.LoadBlob(ctx, t, id, buf)
+}
+
+func (r *loadRecordingRepo) loaded(id restic.ID) int {
+	r.m.Lock()
+	defer r.m.Unlock()
+	return r.loads[id]
+}
+
+// saveTestFile saves n blobs of size bytes and returns a node for them and
+// its content.
+func saveTestFile(t testing.TB, repo restic.Repository, n, size int) (*restic.Node, []byte) {
+	ctx := context.Background()
+	var wg errgroup.Group
+	repo.StartPackUploader(ctx, &wg)
+
+	node := &restic.Node{Name: "file", Type: "file"}
+	var data []byte
+	for i := 0; i < n; i++ {
+		buf := rtest.Random(i, size)
+		id, _, _, err := repo.SaveBlob(ctx, restic.DataBlob, buf, restic.ID{}, false)
+		rtest.OK(t, err)
+		node.Content = append(node.Content, id)
+		data = append(data, buf...)
+	}
+	rtest.OK(t, repo.Flush(ctx))
+	node.Size = uint64(len(data))
+	return node, data
+}
+
+// waitReadahead waits until all blobs loaded in advance are in the cache.
+func waitReadahead(t testing.TB, f *fileContent) {
+	for start := time.Now(); time.Since(start) < 10*time.Second; time.Sleep(time.Millisecond) {
+		f.m.Lock()
+		n := len(f.loading)
+		f.m.Unlock()
+		if n == 0 {
+			return
+		}
+	}
+	t.Fatal("readahead did not finish")
+}
+
+func TestFileContentReadahead(t *testing.T) {
+	const blobs, blobSize, readSize = 20, 64 * 1024, 16 * 1024
+
+	repo := &loadRecordingRepo{Repository: repository.TestRepository(t), loads: make(map[restic.ID]int)}
+	node, data := saveTestFile(t, repo, blobs, blobSize)
+	ctx := context.Background()
+
+	f, err := newFileContent(repo, bloblru.New(blobCacheSize), node)
+	rtest.OK(t, err)
+	defer f.Close()
+
+	buf := make([]byte, readSize)
+	for i := 0; i < readaheadReads; i++ {
+		n, err := f.ReadAt(ctx, buf, uint64(i*readSize))
+		rtest.OK(t, err)
+		rtest.Assert(t, bytes.Equal(data[i*readSize:(i+1)*readSize], buf[:n]), "wrong data read at %d", i*readSize)
+	}
+	waitReadahead(t, f)
+	for i, id := range node.Content {
+		rtest.Assert(t, repo.loaded(id) == 1, "blob %d was loaded %d times after sequential reads", i, repo.loaded(id))
+	}
+
+	// reading the rest of the file does not load any blob again
+	for offset := readaheadReads * readSize; offset < len(data); offset += readSize {
+		n, err := f.ReadAt(ctx, buf, uint64(offset))
+		rtest.OK(t, err)
+		rtest.Assert(t, bytes.Equal(data[offset:offset+n], buf[:n]), "wrong data read at %d", offset)
+	}
+	for i, id := range node.Content {
+		rtest.Assert(t, repo.loaded(id) == 1, "blob %d was loaded %d times", i, repo.loaded(id))
+	}
+}
+
+func TestFileContentNoReadaheadForRandomReads(t *testing.T) {
+	const blobs, blobSize = 20, 1024 * 1024
+
+	repo := &loadRecordingRepo{Repository: repository.TestRepository(t), loads: make(map[restic.ID]int)}
+	node, data := saveTestFile(t, repo, blobs, blobSize)
+	ctx := context.Background()
+
+	f, err := newFileContent(repo, bloblru.New(blobCacheSize), node)
+	rtest.OK(t, err)
+	defer f.Close()
+
+	// reads which are far apart are random access
+	buf := make([]byte, 100)
+	read := make(map[int]bool)
+	for _, i := range []int{0, 10, 5, 15, 1, 19} {
+		offset := i * blobSize
+		n, err := f.ReadAt(ctx, buf, uint64(offset))
+		rtest.OK(t, err)
+		rtest.Assert(t, bytes.Equal(data[offset:offset+n], buf[:n]), "wrong data read at %d", offset)
+		read[i] = true
+	}
+	waitReadahead(t, f)
+
+	for i, id := range node.Content {
+		want := 0
+		if read[i] {
+			want = 1
+		}
+		rtest.Assert(t, repo.loaded(id) == want, "blob %d was loaded %d times, want %d", i, repo.loaded(id), want)
+	}
+}
@@ -5,9 +5,7 @@ package fuse
 
 import (
 	"context"
-	"errors"
 	"os"
-	"path/filepath"
 	"sync"
 
 	"github.com/anacrolix/fuse"
@@ -30,10 +28,6 @@ type dir struct {
 	m           sync.Mutex
 }
 
-func cleanupNodeName(name string) string {
-	return filepath.Base(name)
-}
-
 func newDir(root *Root, inode, parentInode uint64, node *restic.Node) (*dir, error) {
 	debug.Log("new dir for %v (%v)", node.Name, node.Subtree)
 
@@ -45,46 +39,11 @@ func newDir(root *Root, inode, parentInode uint64, node *restic.Node) (*dir, err
 	}, nil
 }
 
-// returing a wrapped context.Canceled error will instead result in returing
-// an input / output error to the user. Thus unwrap the error to match the
-// expectations of bazil/fuse
-func unwrapCtxCanceled(err error) error {
-	if errors.Is(err, context.Canceled) {
-		return context.Canceled
-	}
-	return err
-}
-
-// replaceSpecialNodes replaces nodes with name "." and "/" by their contents.
-// Otherwise, the node is returned.
-func replaceSpecialNodes(ctx context.Context, repo restic.Repository, node *restic.Node) ([]*restic.Node, error) {
-	if node.Type != "dir" || node.Subtree == nil {
-		return []*restic.Node{node}, nil
-	}
-
-	if node.Name != "." && node.Name != "/" {
-		return []*restic.Node{node}, nil
-	}
-
-	tree, err := restic.LoadTree(ctx, repo, *node.Subtree)
-	if err != nil {
-		return nil, unwrapCtxCanceled(err)
-	}
-
-	return tree.Nodes, nil
-}
-
 func newDirFromSnapshot(root *Root, inode uint64, snapshot *restic.Snapshot) (*dir, error) {
 	debug.Log("new dir for snapshot %v (%v)", snapshot.ID(), snapshot.Tree)
 	return &dir{
-		root: root,
-		node: &restic.Node{
-			AccessTime: snapshot.Time,
-			ModTime:    snapshot.Time,
-			ChangeTime: snapshot.Time,
-			Mode:       os.ModeDir | 0555,
-			Subtree:    snapshot.Tree,
-		},
+		root:  root,
+		node:  snapshotNode(snapshot),
 		inode: inode,
 	}, nil
 }
@@ -99,21 +58,9 @@ func (d *dir) open(ctx context.Context) error {
 
 	debug.Log("open dir %v (%v)", d.node.Name, d.node.Subtree)
 
-	tree, err := restic.LoadTree(ctx, d.root.repo, *d.node.Subtree)
+	items, err := dirItems(ctx, d.root.treeCache, d.root.repo, *d.node.Subtree)
 	if err != nil {
-		debug.Log("  error loading tree %v: %v", d.node.Subtree, err)
-		return unwrapCtxCanceled(err)
-	}
-	items := make(map[string]*restic.Node)
-	for _, n := range tree.Nodes {
-		nodes, err := replaceSpecialNodes(ctx, d.root.repo, n)
-		if err != nil {
-			debug.Log("  replaceSpecialNodes(%v) failed: %v", n, err)
-			return err
-		}
-		for _, node := range nodes {
-			items[cleanupNodeName(node.Name)] = node
-		}
+		return err
 	}
 	d.items = items
 	return nil
@@ -124,10 +71,7 @@ func (d *dir) Attr(ctx context.Context, a *fuse.Attr) error {
 	a.Inode = d.inode
 	a.Mode = os.ModeDir | d.node.Mode
 
-	if !d.root.cfg.OwnerIsRoot {
-		a.Uid = d.node.UID
-		a.Gid = d.node.GID
-	}
+	a.Uid, a.Gid = d.root.nodeOwner(d.node)
 	a.Atime = d.node.AccessTime
 	a.Ctime = d.node.ChangeTime
 	a.Mtime = d.node.ModTime
@@ -5,21 +5,17 @@ package fuse
 
 import (
 	"context"
-	"sort"
 
 	"github.com/restic/restic/internal/debug"
-	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/restic"
 
 	"github.com/anacrolix/fuse"
 	"github.com/anacrolix/fuse/fs"
 )
 
-// The default block size to report in stat
-const blockSize = 512
-
 // Statically ensure that *file and *openFile implement the given interfaces
 var _ = fs.HandleReader(&openFile{})
+var _ = fs.HandleReleaser(&openFile{})
 var _ = fs.NodeListxattrer(&file{})
 var _ = fs.NodeGetxattrer(&file{})
 var _ = fs.NodeOpener(&file{})
@@ -32,8 +28,7 @@ type file struct {
 
 type openFile struct {
 	file
-	// cumsize[i] holds the cumulative size of blobs[:i].
-	cumsize []uint64
+	content *fileContent
 }
 
 func newFile(root *Root, inode uint64, node *restic.Node) (fusefile *file, err error) {
@@ -54,10 +49,7 @@ func (f *file) Attr(ctx context.Context, a *fuse.Attr) error {
 	a.BlockSize = blockSize
 	a.Nlink = uint32(f.node.Links)
 
-	if !f.root.cfg.OwnerIsRoot {
-		a.Uid = f.node.UID
-		a.Gid = f.node.GID
-	}
+	a.Uid, a.Gid = f.root.nodeOwner(f.node)
 	a.Atime = f.node.AccessTime
 	a.Ctime = f.node.ChangeTime
 	a.Mtime = f.node.ModTime
@@ -69,100 +61,43 @@ func (f *file) Attr(ctx context.Context, a *fuse.Attr) error {
 func (f *file) Open(ctx context.Context, req *fuse.OpenRequest, resp *fuse.OpenResponse) (fs.Handle, error) {
 	debug.Log("open file %v with %d blobs", f.node.Name, len(f.node.Content))
 
-	var bytes uint64
-	cumsize := make([]uint64, 1+len(f.node.Content))
-	for i, id := range f.node.Content {
-		size, found := f.root.repo.LookupBlobSize(id, restic.DataBlob)
-		if !found {
-			return nil, errors.Errorf("id %v not found in repository", id)
-		}
-
-		bytes += uint64(size)
-		cumsize[i+1] = bytes
-	}
-
-	var of = openFile{file: *f}
-
-	if bytes != f.node.Size {
-		debug.Log("sizes do not match: node.Size %v != size %v, using real size", f.node.Size, bytes)
-		// Make a copy of the node with correct size
-		nodenew := *f.node
-		nodenew.Size = bytes
-		of.file.node = &nodenew
-	}
-	of.cumsize = cumsize
-
-	return &of, nil
-}
-
-func (f *openFile) getBlobAt(ctx context.Context, i int) (blob []byte, err error) {
-
-	blob, ok := f.root.blobCache.Get(f.node.Content[i])
-	if ok {
-		return blob, nil
-	}
-
-	blob, err = f.root.repo.LoadBlob(ctx, restic.DataBlob, f.node.Content[i], nil)
+	content, err := newFileContent(f.root.repo, f.root.blobCache, f.node)
 	if err != nil {
-		debug.Log("LoadBlob(%v, %v) failed: %v", f.node.Name, f.node.Content[i], err)
-		return nil, unwrapCtxCanceled(err)
+		return nil, err
 	}
 
-	f.root.blobCache.Add(f.node.Content[i], blob)
+	var of = openFile{file: *f, content: content}
+	// the size of the node may have been corrected
+	of.file.node = content.node
 
-	return blob, nil
+	return &of, nil
 }
 
 func (f *openFile) Read(ctx context.Context, req *fuse.ReadRequest, resp *fuse.ReadResponse) error {
 	debug.Log("Read(%v, %v, %v), file size %v", f.node.Name, req.Size, req.Offset, f.node.Size)
-	offset := uint64(req.Offset)
 
 	// as stated in https://godoc.org/bazil.org/fuse/fs#HandleReader there
 	// is no need to check if offset > size
 
-	// handle special case: file is empty
-	if f.node.Size == 0 {
-		resp.Data = resp.Data[:0]
-		return nil
-	}
-
-	// Skip blobs before the offset
-	startContent := -1 + sort.Search(len(f.cumsize), func(i int) bool {
-		return f.cumsize[i] > offset
-	})
-	offset -= f.cumsize[startContent]
-
-	dst := resp.Data[0:req.Size]
-	readBytes := 0
-	remainingBytes := req.Size
-
 	// The documentation of bazil/fuse actually says that synchronization is
 	// required (see https://godoc.org/bazil.org/fuse#hdr-Service_Methods):
 	//
 	// Multiple goroutines may call service methods simultaneously;
 	// the methods being called are responsible for appropriate synchronization.
 	//
-	// However, no lock needed here as getBlobAt can be called conurrently
-	// (blobCache has it's own locking)
-	for i := startContent; remainingBytes > 0 && i < len(f.cumsize)-1; i++ {
-		blob, err := f.getBlobAt(ctx, i)
-		if err != nil {
-			return err
-		}
-
-		if offset > 0 {
-			blob = blob[offset:]
-			offset = 0
-		}
-
-		copied := copy(dst, blob)
-		remainingBytes -= copied
-		readBytes += copied
-
-		dst = dst[copied:]
+	// However, no lock needed here as ReadAt can be called concurrently
+	n, err := f.content.ReadAt(ctx, resp.Data[0:req.Size], uint64(req.Offset))
+	if err != nil {
+		return err
 	}
-	resp.Data = resp.Data[:readBytes]
+	resp.Data = resp.Data[:n]
+
+	return nil
+}
 
+func (f *openFile) Release(ctx context.Context, req *fuse.ReleaseRequest) error {
+	debug.Log("Release(%v)", f.node.Name)
+	f.content.Close()
 	return nil
 }
 
@@ -0,0 +1,268 @@
+//go:build windows
+// +build windows
+
+package fuse
+
+import (
+	"context"
+	"os"
+	"sync"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+
+	"github.com/winfsp/cgofuse/fuse"
+)
+
+// FS is a read-only file system for WinFsp which serves the snapshots of a
+// repository. All paths passed to it are slash separated.
+type FS struct {
+	fuse.FileSystemBase
+
+	ctx    context.Context
+	pathFS *pathFS
+
+	m       sync.Mutex
+	handles map[uint64]*fileContent
+	next    uint64
+}
+
+// make sure that *FS implements fuse.FileSystemInterface
+var _ fuse.FileSystemInterface = &FS{}
+
+// NewFS returns a file system for the snapshots in repo. WinFsp calls do not
+// carry a context, ctx is used for all operations on the repository instead.
+func NewFS(ctx context.Context, repo restic.Repository, cfg Config) *FS {
+	return &FS{
+		ctx:     ctx,
+		pathFS:  newPathFS(repo, cfg),
+		handles: make(map[uint64]*fileContent),
+	}
+}
+
+// errno converts err into a negative FUSE error code.
+func errno(err error) int {
+	switch {
+	case errors.Is(err, errNotExist):
+		return -fuse.ENOENT
+	case errors.Is(err, errNotDir):
+		return -fuse.ENOTDIR
+	case errors.Is(err, errIsDir):
+		return -fuse.EISDIR
+	}
+	debug.Log("returning EIO for error %v", err)
+	return -fuse.EIO
+}
+
+// fileMode converts a Go file mode into the mode bits used by FUSE.
+func fileMode(mode os.FileMode) uint32 {
+	m := uint32(mode.Perm())
+	switch {
+	case mode&os.ModeDir != 0:
+		m |= fuse.S_IFDIR
+	case mode&os.ModeSymlink != 0:
+		m |= fuse.S_IFLNK
+	case mode&os.ModeNamedPipe != 0:
+		m |= fuse.S_IFIFO
+	case mode&os.ModeSocket != 0:
+		m |= fuse.S_IFSOCK
+	case mode&os.ModeCharDevice != 0:
+		m |= fuse.S_IFCHR
+	case mode&os.ModeDevice != 0:
+		m |= fuse.S_IFBLK
+	default:
+		m |= fuse.S_IFREG
+	}
+	return m
+}
+
+func (f *FS) fillStat(e pathEntry, stat *fuse.Stat_t) {
+	*stat = fuse.Stat_t{}
+	if e.meta != nil {
+		stat.Mode = fuse.S_IFDIR | 0555
+		stat.Nlink = 2
+		ts := fuse.NewTimespec(f.pathFS.mountTime)
+		stat.Atim, stat.Mtim, stat.Ctim, stat.Birthtim = ts, ts, ts, ts
+		return
+	}
+
+	node := e.node
+	stat.Mode = fileMode(node.Mode)
+	if e.isDir() {
+		stat.Mode = fuse.S_IFDIR | uint32(node.Mode.Perm())
+		stat.Nlink = 2
+	} else {
+		stat.Nlink = uint32(node.Links)
+		stat.Size = int64(node.Size)
+		if node.Type == "symlink" {
+			stat.Size = int64(len(node.LinkTarget))
+		}
+	}
+	stat.Uid = node.UID
+	stat.Gid = node.GID
+	stat.Blksize = blockSize
+	stat.Blocks = stat.Size/blockSize + 1
+	stat.Atim = fuse.NewTimespec(node.AccessTime)
+	stat.Mtim = fuse.NewTimespec(node.ModTime)
+	stat.Ctim = fuse.NewTimespec(node.ChangeTime)
+	stat.Birthtim = stat.Mtim
+}
+
+// Statfs reports an empty read-only file system.
+func (f *FS) Statfs(path string, stat *fuse.Statfs_t) int {
+	*stat = fuse.Statfs_t{Bsize: blockSize, Frsize: blockSize, Namemax: 255}
+	return 0
+}
+
+// Getattr returns the attributes of the file or dir at path.
+func (f *FS) Getattr(path string, stat *fuse.Stat_t, fh uint64) int {
+	debug.Log("Getattr(%v)", path)
+	e, err := f.pathFS.lookup(f.ctx, path)
+	if err != nil {
+		return errno(err)
+	}
+	f.fillStat(e, stat)
+	return 0
+}
+
+// Readlink returns the target of the symlink at path.
+func (f *FS) Readlink(path string) (int, string) {
+	debug.Log("Readlink(%v)", path)
+	e, err := f.pathFS.lookup(f.ctx, path)
+	if err != nil {
+		return errno(err), ""
+	}
+	if e.node == nil || e.node.Type != "symlink" {
+		return -fuse.EINVAL, ""
+	}
+	return 0, e.node.LinkTarget
+}
+
+// Opendir checks that path is a dir.
+func (f *FS) Opendir(path string) (int, uint64) {
+	debug.Log("Opendir(%v)", path)
+	e, err := f.pathFS.lookup(f.ctx, path)
+	if err != nil {
+		return errno(err), ^uint64(0)
+	}
+	if !e.isDir() {
+		return -fuse.ENOTDIR, ^uint64(0)
+	}
+	return 0, 0
+}
+
+// Readdir lists the entries of the dir at path including their attributes.
+func (f *FS) Readdir(path string, fill func(name string, stat *fuse.Stat_t, ofst int64) bool, ofst int64, fh uint64) int {
+	debug.Log("Readdir(%v)", path)
+	e, err := f.pathFS.lookup(f.ctx, path)
+	if err != nil {
+		return errno(err)
+	}
+	entries, err := f.pathFS.readDir(f.ctx, e)
+	if err != nil {
+		return errno(err)
+	}
+
+	if !fill(".", nil, 0) || !fill("..", nil, 0) {
+		return 0
+	}
+	for _, entry := range entries {
+		var stat fuse.Stat_t
+		f.fillStat(entry.pathEntry, &stat)
+		if !fill(entry.name, &stat, 0) {
+			break
+		}
+	}
+	return 0
+}
+
+// Releasedir closes a dir opened by Opendir.
+func (f *FS) Releasedir(path string, fh uint64) int {
+	return 0
+}
+
+// Open opens the file at path for reading.
+func (f *FS) Open(path string, flags int) (int, uint64) {
+	debug.Log("Open(%v, %x)", path, flags)
+	if flags&fuse.O_ACCMODE != fuse.O_RDONLY {
+		return -fuse.EROFS, ^uint64(0)
+	}
+	e, err := f.pathFS.lookup(f.ctx, path)
+	if err != nil {
+		return errno(err), ^uint64(0)
+	}
+	content, err := f.pathFS.open(e)
+	if err != nil {
+		return errno(err), ^uint64(0)
+	}
+
+	f.m.Lock()
+	defer f.m.Unlock()
+	fh := f.next
+	f.next++
+	f.handles[fh] = content
+	return 0, fh
+}
+
+// Read reads from a file opened by Open.
+func (f *FS) Read(path string, buff []byte, ofst int64, fh uint64) int {
+	f.m.Lock()
+	content, ok := f.handles[fh]
+	f.m.Unlock()
+	if !ok || ofst < 0 {
+		return -fuse.EBADF
+	}
+
+	n, err := content.ReadAt(f.ctx, buff, uint64(ofst))
+	if err != nil {
+		debug.Log("Read(%v, %v) failed: %v", path, ofst, err)
+		return errno(err)
+	}
+	return n
+}
+
+// Release closes a file opened by Open.
+func (f *FS) Release(path string, fh uint64) int {
+	f.m.Lock()
+	content, ok := f.handles[fh]
+	delete(f.handles, fh)
+	f.m.Unlock()
+	if ok {
+		content.Close()
+	}
+	return 0
+}
+
+// Getxattr returns the extended attribute name of the file at path.
+func (f *FS) Getxattr(path string, name string) (int, []byte) {
+	e, err := f.pathFS.lookup(f.ctx, path)
+	if err != nil {
+		return errno(err), nil
+	}
+	if e.node == nil {
+		return -fuse.ENOATTR, nil
+	}
+	value := e.node.GetExtendedAttribute(name)
+	if value == nil {
+		return -fuse.ENOATTR, nil
+	}
+	return 0, value
+}
+
+// Listxattr lists the extended attributes of the file at path.
+func (f *FS) Listxattr(path string, fill func(name string) bool) int {
+	e, err := f.pathFS.lookup(f.ctx, path)
+	if err != nil {
+		return errno(err)
+	}
+	if e.node == nil {
+		return 0
+	}
+	for _, attr := range e.node.ExtendedAttributes {
+		if !fill(attr.Name) {
+			break
+		}
+	}
+	return 0
+}
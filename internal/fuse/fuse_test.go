@@ -8,6 +8,7 @@ import (
 	"context"
 	"math/rand"
 	"os"
+	"sort"
 	"testing"
 	"time"
 
@@ -115,7 +116,7 @@ func TestFuseFile(t *testing.T) {
 		Size:    filesize,
 		Content: content,
 	}
-	root := &Root{repo: repo, blobCache: bloblru.New(blobCacheSize)}
+	root := &Root{repo: repo, blobCache: bloblru.New(blobCacheSize), treeCache: newTreeCache(treeCacheSize)}
 
 	inode := inodeFromNode(1, node)
 	f, err := newFile(root, inode, node)
@@ -149,7 +150,7 @@ func TestFuseFile(t *testing.T) {
 func TestFuseDir(t *testing.T) {
 	repo := repository.TestRepository(t)
 
-	root := &Root{repo: repo, blobCache: bloblru.New(blobCacheSize)}
+	root := &Root{repo: repo, blobCache: bloblru.New(blobCacheSize), treeCache: newTreeCache(treeCacheSize)}
 
 	node := &restic.Node{
 		Mode:       0755,
@@ -183,6 +184,84 @@ func TestTopUIDGID(t *testing.T) {
 
 	testTopUIDGID(t, Config{}, repo, uint32(os.Getuid()), uint32(os.Getgid()))
 	testTopUIDGID(t, Config{OwnerIsRoot: true}, repo, 0, 0)
+	testTopUIDGID(t, Config{ForceOwner: true, OwnerUID: 1000, OwnerGID: 1001}, repo, 1000, 1001)
+}
+
+func TestNodeOwner(t *testing.T) {
+	node := &restic.Node{UID: 42, GID: 43}
+	for _, c := range []struct {
+		cfg      Config
+		uid, gid uint32
+	}{
+		{Config{}, 42, 43},
+		{Config{OwnerIsRoot: true}, 0, 0},
+		{Config{ForceOwner: true, OwnerUID: 1000, OwnerGID: 1001}, 1000, 1001},
+	} {
+		root := &Root{cfg: c.cfg}
+		uid, gid := root.nodeOwner(node)
+		rtest.Equals(t, c.uid, uid)
+		rtest.Equals(t, c.gid, gid)
+	}
+}
+
+func TestRootAllowRoot(t *testing.T) {
+	repo := repository.TestRepository(t)
+	ctx := context.Background()
+
+	var attr fuse.Attr
+	rtest.OK(t, NewRoot(repo, Config{}).Attr(ctx, &attr))
+	rtest.Equals(t, os.ModeDir|0555, attr.Mode)
+
+	rtest.OK(t, NewRoot(repo, Config{AllowRoot: true}).Attr(ctx, &attr))
+	rtest.Equals(t, os.ModeDir|0500, attr.Mode)
+	rtest.Equals(t, uint32(os.Getuid()), attr.Uid)
+
+	// a different owner must not lock out the user running restic
+	for _, cfg := range []Config{
+		{AllowRoot: true, OwnerIsRoot: true},
+		{AllowRoot: true, ForceOwner: true, OwnerUID: uint32(os.Getuid()) + 1, OwnerGID: uint32(os.Getgid()) + 1},
+	} {
+		rtest.OK(t, NewRoot(repo, cfg).Attr(ctx, &attr))
+		rtest.Equals(t, os.ModeDir|0500, attr.Mode)
+		rtest.Equals(t, uint32(os.Getuid()), attr.Uid)
+		rtest.Equals(t, uint32(os.Getgid()), attr.Gid)
+	}
+}
+
+func TestRootSingleSnapshot(t *testing.T) {
+	repo := repository.TestRepository(t)
+	ctx := context.Background()
+	restic.TestCreateSnapshot(t, repo, time.Unix(1460289341, 207401672), 2, 0)
+	sn := loadFirstSnapshot(t, repo)
+	tree := loadTree(t, repo, *sn.Tree)
+
+	root := NewRoot(repo, Config{Snapshot: sn})
+	var attr fuse.Attr
+	rtest.OK(t, root.Attr(ctx, &attr))
+	rtest.Equals(t, os.ModeDir|0555, attr.Mode)
+	rtest.Equals(t, uint32(os.Getuid()), attr.Uid)
+	rtest.Equals(t, sn.Time, attr.Mtime)
+
+	// the nodes of the snapshot are found directly in the root dir
+	entries, err := root.ReadDirAll(ctx)
+	rtest.OK(t, err)
+	var names, want []string
+	for _, e := range entries {
+		if e.Name != "." && e.Name != ".." {
+			names = append(names, e.Name)
+		}
+	}
+	for _, node := range tree.Nodes {
+		want = append(want, node.Name)
+	}
+	sort.Strings(names)
+	sort.Strings(want)
+	rtest.Equals(t, want, names)
+
+	_, err = root.Lookup(ctx, tree.Nodes[0].Name)
+	rtest.OK(t, err)
+	_, err = root.Lookup(ctx, "ids")
+	rtest.Assert(t, err == fuse.ENOENT, "unexpected error %v for the ids dir", err)
 }
 
 func testTopUIDGID(t *testing.T, cfg Config, repo restic.Repository, uid, gid uint32) {
@@ -209,11 +288,15 @@ func testTopUIDGID(t *testing.T, cfg Config, repo restic.Repository, uid, gid ui
 	snapshotdir, err := idsdir.(fs.NodeStringLookuper).Lookup(ctx, snapID)
 	rtest.OK(t, err)
 
-	// restic.TestCreateSnapshot does not set the UID/GID thus it must be always zero
+	// restic.TestCreateSnapshot does not set the UID/GID thus it must be
+	// zero unless the owner is replaced
+	if !cfg.ForceOwner {
+		uid, gid = 0, 0
+	}
 	err = snapshotdir.Attr(ctx, &attr)
 	rtest.OK(t, err)
-	rtest.Equals(t, uint32(0), attr.Uid)
-	rtest.Equals(t, uint32(0), attr.Gid)
+	rtest.Equals(t, uid, attr.Uid)
+	rtest.Equals(t, gid, attr.Gid)
 }
 
 func TestInodeFromNode(t *testing.T) {
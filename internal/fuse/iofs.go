@@ -0,0 +1,280 @@
+package fuse
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"time"
+
+	"github.com/restic/restic/internal/restic"
+)
+
+// SnapshotFS provides the snapshot dir structure of the mount as an fs.FS,
+// for serving it via other protocols than FUSE. Links to snapshots like
+// "latest" are shown as directories, symlinks within snapshots are not
+// followed. Use ReadLink to get their target.
+//
+// The Sys method of the fs.FileInfo values returns the *restic.Node of files
+// and dirs within snapshots, and nil for the dirs of the snapshot dir
+// structure.
+type SnapshotFS struct {
+	ctx context.Context
+	p   *pathFS
+}
+
+// Statically ensure that *SnapshotFS implements these interfaces
+var _ fs.StatFS = &SnapshotFS{}
+var _ fs.ReadDirFS = &SnapshotFS{}
+
+// NewSnapshotFS returns a file system for the snapshots in repo. Like
+// fs.FS, its methods do not accept a context, ctx is used for all operations
+// on the repository instead.
+func NewSnapshotFS(ctx context.Context, repo restic.Repository, cfg Config) *SnapshotFS {
+	return &SnapshotFS{ctx: ctx, p: newPathFS(repo, cfg)}
+}
+
+func (s *SnapshotFS) lookup(op, name string) (pathEntry, error) {
+	if !fs.ValidPath(name) {
+		return pathEntry{}, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+
+	p := name
+	if p == "." {
+		p = ""
+	}
+	e, err := s.p.lookup(s.ctx, p)
+	if err != nil {
+		return pathEntry{}, &fs.PathError{Op: op, Path: name, Err: err}
+	}
+	return e, nil
+}
+
+// Open opens the file or dir name. The returned fs.File implements
+// io.ReaderAt and io.Seeker for files and fs.ReadDirFile for dirs.
+func (s *SnapshotFS) Open(name string) (fs.File, error) {
+	e, err := s.lookup("open", name)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &snapshotFile{fs: s, name: name, entry: e, info: s.fileInfo(name, e)}
+	if !e.isDir() {
+		f.content, err = s.p.open(e)
+		if err != nil {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+		// the size of the content is correct even for broken nodes
+		f.info.size = int64(f.content.node.Size)
+	}
+	return f, nil
+}
+
+// Stat returns information about the file or dir name.
+func (s *SnapshotFS) Stat(name string) (fs.FileInfo, error) {
+	e, err := s.lookup("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return s.fileInfo(name, e), nil
+}
+
+// ReadDir returns the entries of the dir name, sorted by name.
+func (s *SnapshotFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	e, err := s.lookup("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	return s.readDir(name, e)
+}
+
+func (s *SnapshotFS) readDir(name string, e pathEntry) ([]fs.DirEntry, error) {
+	entries, err := s.p.readDir(s.ctx, e)
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+
+	list := make([]fs.DirEntry, 0, len(entries))
+	for _, entry := range entries {
+		list = append(list, fs.FileInfoToDirEntry(s.fileInfo(entry.name, entry.pathEntry)))
+	}
+	return list, nil
+}
+
+// ReadLink returns the target of the symlink name.
+func (s *SnapshotFS) ReadLink(name string) (string, error) {
+	e, err := s.lookup("readlink", name)
+	if err != nil {
+		return "", err
+	}
+	if e.node == nil || e.node.Type != "symlink" {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: fs.ErrInvalid}
+	}
+	return e.node.LinkTarget, nil
+}
+
+func (s *SnapshotFS) fileInfo(name string, e pathEntry) *fileInfo {
+	fi := &fileInfo{name: path.Base(name)}
+	if e.meta != nil {
+		fi.mode = os.ModeDir | 0555
+		fi.modTime = s.p.mountTime
+		return fi
+	}
+
+	fi.node = e.node
+	fi.mode = nodeMode(e.node)
+	fi.modTime = e.node.ModTime
+	if e.node.Type == "file" {
+		fi.size = int64(e.node.Size)
+	}
+	return fi
+}
+
+// nodeMode returns the file mode of node, with the type bits set according to
+// the type of the node.
+func nodeMode(node *restic.Node) os.FileMode {
+	mode := node.Mode &^ os.ModeType
+	switch node.Type {
+	case "dir":
+		mode |= os.ModeDir
+	case "symlink":
+		mode |= os.ModeSymlink
+	case "dev":
+		mode |= os.ModeDevice
+	case "chardev":
+		mode |= os.ModeDevice | os.ModeCharDevice
+	case "fifo":
+		mode |= os.ModeNamedPipe
+	case "socket":
+		mode |= os.ModeSocket
+	}
+	return mode
+}
+
+type fileInfo struct {
+	name    string
+	size    int64
+	mode    os.FileMode
+	modTime time.Time
+	node    *restic.Node
+}
+
+func (fi *fileInfo) Name() string       { return fi.name }
+func (fi *fileInfo) Size() int64        { return fi.size }
+func (fi *fileInfo) Mode() os.FileMode  { return fi.mode }
+func (fi *fileInfo) ModTime() time.Time { return fi.modTime }
+func (fi *fileInfo) IsDir() bool        { return fi.mode.IsDir() }
+
+func (fi *fileInfo) Sys() interface{} {
+	if fi.node == nil {
+		return nil
+	}
+	return fi.node
+}
+
+// snapshotFile is a file or dir opened by SnapshotFS.Open.
+type snapshotFile struct {
+	fs    *SnapshotFS
+	name  string
+	entry pathEntry
+	info  *fileInfo
+
+	// only set for files
+	content *fileContent
+	offset  int64
+
+	// only used for dirs
+	entries []fs.DirEntry
+	listed  bool
+}
+
+func (f *snapshotFile) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+func (f *snapshotFile) Close() error {
+	if f.content != nil {
+		f.content.Close()
+	}
+	return nil
+}
+
+func (f *snapshotFile) Read(p []byte) (int, error) {
+	n, err := f.ReadAt(p, f.offset)
+	f.offset += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+func (f *snapshotFile) ReadAt(p []byte, off int64) (int, error) {
+	if f.content == nil {
+		return 0, &fs.PathError{Op: "read", Path: f.name, Err: errIsDir}
+	}
+	if off < 0 {
+		return 0, &fs.PathError{Op: "read", Path: f.name, Err: fs.ErrInvalid}
+	}
+
+	n, err := f.content.ReadAt(f.fs.ctx, p, uint64(off))
+	if err != nil {
+		return n, &fs.PathError{Op: "read", Path: f.name, Err: err}
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (f *snapshotFile) Seek(offset int64, whence int) (int64, error) {
+	if f.content == nil {
+		return 0, &fs.PathError{Op: "seek", Path: f.name, Err: errIsDir}
+	}
+
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += f.info.size
+	default:
+		return 0, &fs.PathError{Op: "seek", Path: f.name, Err: fs.ErrInvalid}
+	}
+	if offset < 0 {
+		return 0, &fs.PathError{Op: "seek", Path: f.name, Err: fs.ErrInvalid}
+	}
+	f.offset = offset
+	return offset, nil
+}
+
+// ReadDir implements fs.ReadDirFile.
+func (f *snapshotFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	if f.content != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: f.name, Err: errNotDir}
+	}
+
+	if !f.listed {
+		entries, err := f.fs.readDir(f.name, f.entry)
+		if err != nil {
+			return nil, err
+		}
+		f.entries = entries
+		f.listed = true
+	}
+
+	if n <= 0 {
+		entries := f.entries
+		f.entries = nil
+		return entries, nil
+	}
+	if len(f.entries) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(f.entries) {
+		n = len(f.entries)
+	}
+	entries := f.entries[:n]
+	f.entries = f.entries[n:]
+	return entries, nil
+}
@@ -0,0 +1,66 @@
+package fuse
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestSnapshotFS(t *testing.T) {
+	repo := repository.TestRepository(t)
+	ctx := context.Background()
+
+	timestamp, err := time.Parse(time.RFC3339, "2017-01-24T10:42:56+01:00")
+	rtest.OK(t, err)
+	sn := restic.TestCreateSnapshot(t, repo, timestamp, 2, 0)
+
+	fsys := NewSnapshotFS(ctx, repo, Config{TimeTemplate: time.RFC3339})
+	snDir := "ids/" + sn.ID().Str()
+	rtest.OK(t, fstest.TestFS(fsys, "ids", "snapshots/latest", snDir))
+
+	fi, err := fsys.Stat(snDir)
+	rtest.OK(t, err)
+	rtest.Assert(t, fi.IsDir(), "snapshot is not a dir")
+	rtest.Assert(t, fi.ModTime().Equal(sn.Time), "wrong time %v for snapshot dir", fi.ModTime())
+	node, ok := fi.Sys().(*restic.Node)
+	rtest.Assert(t, ok, "Sys() returned %T instead of a node", fi.Sys())
+	rtest.Equals(t, *sn.Tree, *node.Subtree)
+
+	fi, err = fsys.Stat("ids")
+	rtest.OK(t, err)
+	rtest.Assert(t, fi.Sys() == nil, "Sys() returned %v for a dir of the snapshot dir structure", fi.Sys())
+
+	_, err = fsys.Open(snDir + "/missing")
+	rtest.Assert(t, errors.Is(err, fs.ErrNotExist), "unexpected error %v for a missing file", err)
+	_, err = fsys.Open("/ids")
+	rtest.Assert(t, errors.Is(err, fs.ErrInvalid), "unexpected error %v for an invalid path", err)
+
+	entries, err := fsys.ReadDir(snDir)
+	rtest.OK(t, err)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		f, err := fsys.Open(snDir + "/" + entry.Name())
+		rtest.OK(t, err)
+		ra, ok := f.(io.ReaderAt)
+		rtest.Assert(t, ok, "file does not implement io.ReaderAt")
+		info, err := f.Stat()
+		rtest.OK(t, err)
+
+		buf := make([]byte, 10)
+		n, err := ra.ReadAt(buf, info.Size())
+		rtest.Equals(t, 0, n)
+		rtest.Assert(t, err == io.EOF, "unexpected error %v when reading at the end of the file", err)
+		rtest.OK(t, f.Close())
+	}
+}
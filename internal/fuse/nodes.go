@@ -0,0 +1,78 @@
+package fuse
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/restic"
+)
+
+func cleanupNodeName(name string) string {
+	return filepath.Base(name)
+}
+
+// returing a wrapped context.Canceled error will instead result in returing
+// an input / output error to the user. Thus unwrap the error to match the
+// expectations of bazil/fuse
+func unwrapCtxCanceled(err error) error {
+	if errors.Is(err, context.Canceled) {
+		return context.Canceled
+	}
+	return err
+}
+
+// replaceSpecialNodes replaces nodes with name "." and "/" by their contents.
+// Otherwise, the node is returned.
+func replaceSpecialNodes(ctx context.Context, trees *treeCache, repo restic.BlobLoader, node *restic.Node) ([]*restic.Node, error) {
+	if node.Type != "dir" || node.Subtree == nil {
+		return []*restic.Node{node}, nil
+	}
+
+	if node.Name != "." && node.Name != "/" {
+		return []*restic.Node{node}, nil
+	}
+
+	tree, err := trees.Load(ctx, repo, *node.Subtree)
+	if err != nil {
+		return nil, unwrapCtxCanceled(err)
+	}
+
+	return tree.Nodes, nil
+}
+
+// snapshotNode returns a node for the root dir of the snapshot.
+func snapshotNode(snapshot *restic.Snapshot) *restic.Node {
+	return &restic.Node{
+		Type:       "dir",
+		AccessTime: snapshot.Time,
+		ModTime:    snapshot.Time,
+		ChangeTime: snapshot.Time,
+		Mode:       os.ModeDir | 0555,
+		Subtree:    snapshot.Tree,
+	}
+}
+
+// dirItems returns the nodes in the tree with the given id, keyed by their
+// names.
+func dirItems(ctx context.Context, trees *treeCache, repo restic.BlobLoader, id restic.ID) (map[string]*restic.Node, error) {
+	tree, err := trees.Load(ctx, repo, id)
+	if err != nil {
+		debug.Log("  error loading tree %v: %v", id, err)
+		return nil, unwrapCtxCanceled(err)
+	}
+	items := make(map[string]*restic.Node)
+	for _, n := range tree.Nodes {
+		nodes, err := replaceSpecialNodes(ctx, trees, repo, n)
+		if err != nil {
+			debug.Log("  replaceSpecialNodes(%v) failed: %v", n, err)
+			return nil, err
+		}
+		for _, node := range nodes {
+			items[cleanupNodeName(node.Name)] = node
+		}
+	}
+	return items, nil
+}
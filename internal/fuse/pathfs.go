@@ -0,0 +1,178 @@
+package fuse
+
+import (
+	"context"
+	"io/fs"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/restic/restic/internal/bloblru"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+)
+
+var (
+	errNotExist = fs.ErrNotExist
+	errNotDir   = errors.New("not a directory")
+	errIsDir    = errors.New("is a directory")
+)
+
+// pathEntry is a file or directory of the mount which was found by its
+// path.
+type pathEntry struct {
+	// meta is set for the dirs of the snapshot dir structure
+	meta *MetaDirData
+	// node is set for the root dir of snapshots and everything therein
+	node *restic.Node
+}
+
+// namedEntry is an entry of a directory.
+type namedEntry struct {
+	name string
+	pathEntry
+}
+
+// pathFS provides access to the snapshots in a repository by path, for FUSE
+// implementations like WinFsp which identify files by their path instead of
+// by inodes. Symlinks like "latest" in the snapshot dir structure are
+// resolved to the root dir of the snapshot they point to.
+type pathFS struct {
+	repo      restic.Repository
+	blobCache *bloblru.Cache
+	treeCache *treeCache
+	dirStruct *SnapshotsDirStructure
+	// snapshot is shown at the root instead of dirStruct, if set
+	snapshot *restic.Snapshot
+
+	// mountTime is used as the time of the dirs in the snapshot dir structure
+	mountTime time.Time
+}
+
+func newPathFS(repo restic.Repository, cfg Config) *pathFS {
+	debug.Log("newPathFS(), config %v", cfg)
+	return &pathFS{
+		repo:      repo,
+		blobCache: bloblru.New(blobCacheSize),
+		treeCache: newTreeCache(treeCacheSize),
+		dirStruct: NewSnapshotsDirStructure(repo, cfg),
+		snapshot:  cfg.Snapshot,
+		mountTime: time.Now(),
+	}
+}
+
+// lookup returns the entry for the slash separated path name.
+func (p *pathFS) lookup(ctx context.Context, name string) (pathEntry, error) {
+	e, err := p.root(ctx)
+	if err != nil {
+		return pathEntry{}, err
+	}
+
+	for _, elem := range strings.Split(name, "/") {
+		if elem == "" {
+			continue
+		}
+		e, err = p.child(ctx, e, elem)
+		if err != nil {
+			debug.Log("lookup(%v) failed at %v: %v", name, elem, err)
+			return pathEntry{}, err
+		}
+	}
+	return e, nil
+}
+
+// root returns the entry for the root dir.
+func (p *pathFS) root(ctx context.Context) (pathEntry, error) {
+	if p.snapshot != nil {
+		return pathEntry{node: snapshotNode(p.snapshot)}, nil
+	}
+
+	meta, err := p.dirStruct.UpdatePrefix(ctx, "")
+	if err != nil {
+		return pathEntry{}, unwrapCtxCanceled(err)
+	} else if meta == nil {
+		return pathEntry{}, errNotExist
+	}
+	return pathEntry{meta: meta}, nil
+}
+
+// child returns the entry name in the directory e.
+func (p *pathFS) child(ctx context.Context, e pathEntry, name string) (pathEntry, error) {
+	if e.meta != nil {
+		child := e.meta.names[name]
+		switch {
+		case child == nil:
+			return pathEntry{}, errNotExist
+		case child.snapshot != nil:
+			return pathEntry{node: snapshotNode(child.snapshot)}, nil
+		default:
+			return pathEntry{meta: child}, nil
+		}
+	}
+
+	if e.node.Type != "dir" || e.node.Subtree == nil {
+		return pathEntry{}, errNotDir
+	}
+	// use a binary search in the sorted tree, as each file is looked up
+	// separately. Names of special nodes only match in the dir items.
+	tree, err := p.treeCache.Load(ctx, p.repo, *e.node.Subtree)
+	if err != nil {
+		return pathEntry{}, unwrapCtxCanceled(err)
+	}
+	if node := tree.Find(name); node != nil {
+		return pathEntry{node: node}, nil
+	}
+
+	items, err := dirItems(ctx, p.treeCache, p.repo, *e.node.Subtree)
+	if err != nil {
+		return pathEntry{}, err
+	}
+	node, ok := items[name]
+	if !ok {
+		return pathEntry{}, errNotExist
+	}
+	return pathEntry{node: node}, nil
+}
+
+// readDir returns the entries of the directory e, sorted by name.
+func (p *pathFS) readDir(ctx context.Context, e pathEntry) ([]namedEntry, error) {
+	var entries []namedEntry
+	if e.meta != nil {
+		for name := range e.meta.names {
+			child, err := p.child(ctx, e, name)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, namedEntry{name: name, pathEntry: child})
+		}
+	} else {
+		if !e.isDir() || e.node.Subtree == nil {
+			return nil, errNotDir
+		}
+		items, err := dirItems(ctx, p.treeCache, p.repo, *e.node.Subtree)
+		if err != nil {
+			return nil, err
+		}
+		for name, node := range items {
+			entries = append(entries, namedEntry{name: name, pathEntry: pathEntry{node: node}})
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].name < entries[j].name
+	})
+	return entries, nil
+}
+
+// open returns the content of the file e.
+func (p *pathFS) open(e pathEntry) (*fileContent, error) {
+	if e.isDir() {
+		return nil, errIsDir
+	}
+	return newFileContent(p.repo, p.blobCache, e.node)
+}
+
+func (e pathEntry) isDir() bool {
+	return e.meta != nil || e.node.Type == "dir"
+}
@@ -0,0 +1,127 @@
+package fuse
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestPathFS(t *testing.T) {
+	repo := repository.TestRepository(t)
+	ctx := context.Background()
+
+	timestamp, err := time.Parse(time.RFC3339, "2017-01-24T10:42:56+01:00")
+	rtest.OK(t, err)
+	sn := restic.TestCreateSnapshot(t, repo, timestamp, 2, 0)
+	tree, err := restic.LoadTree(ctx, repo, *sn.Tree)
+	rtest.OK(t, err)
+
+	p := newPathFS(repo, Config{TimeTemplate: time.RFC3339})
+
+	root, err := p.lookup(ctx, "/")
+	rtest.OK(t, err)
+	rtest.Assert(t, root.isDir(), "root is not a dir")
+	entries, err := p.readDir(ctx, root)
+	rtest.OK(t, err)
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.name)
+	}
+	rtest.Equals(t, []string{"groups", "hosts", "ids", "paths", "snapshots", "tags"}, names)
+
+	// the root dir of the snapshot lists the nodes of its tree
+	snDir := "/ids/" + sn.ID().Str()
+	e, err := p.lookup(ctx, snDir)
+	rtest.OK(t, err)
+	rtest.Equals(t, *sn.Tree, *e.node.Subtree)
+	entries, err = p.readDir(ctx, e)
+	rtest.OK(t, err)
+	var want []string
+	for _, node := range tree.Nodes {
+		want = append(want, node.Name)
+	}
+	names = nil
+	for _, e := range entries {
+		names = append(names, e.name)
+	}
+	sort.Strings(want)
+	rtest.Equals(t, want, names)
+
+	// symlinks are resolved to the snapshot
+	e, err = p.lookup(ctx, "/snapshots/latest")
+	rtest.OK(t, err)
+	rtest.Equals(t, *sn.Tree, *e.node.Subtree)
+
+	_, err = p.open(e)
+	rtest.Assert(t, errors.Is(err, errIsDir), "unexpected error %v for opening a dir", err)
+	_, err = p.lookup(ctx, snDir+"/missing")
+	rtest.Assert(t, errors.Is(err, errNotExist), "unexpected error %v for a missing file", err)
+	_, err = p.lookup(ctx, "/hosts/missing/latest")
+	rtest.Assert(t, errors.Is(err, errNotExist), "unexpected error %v for a missing dir", err)
+
+	var file *restic.Node
+	for _, node := range tree.Nodes {
+		if node.Type == "file" {
+			file = node
+			break
+		}
+	}
+	rtest.Assert(t, file != nil, "no file found in tree")
+
+	var data []byte
+	for _, id := range file.Content {
+		buf, err := repo.LoadBlob(ctx, restic.DataBlob, id, nil)
+		rtest.OK(t, err)
+		data = append(data, buf...)
+	}
+
+	e, err = p.lookup(ctx, snDir+"/"+file.Name)
+	rtest.OK(t, err)
+	rtest.Assert(t, !e.isDir(), "file is a dir")
+	content, err := p.open(e)
+	rtest.OK(t, err)
+
+	buf := make([]byte, len(data)+100)
+	n, err := content.ReadAt(ctx, buf, 0)
+	rtest.OK(t, err)
+	rtest.Assert(t, bytes.Equal(data, buf[:n]), "wrong file content")
+
+	n, err = content.ReadAt(ctx, buf, uint64(len(data)))
+	rtest.OK(t, err)
+	rtest.Equals(t, 0, n)
+
+	_, err = p.lookup(ctx, snDir+"/"+file.Name+"/foo")
+	rtest.Assert(t, errors.Is(err, errNotDir), "unexpected error %v for a path below a file", err)
+}
+
+func TestPathFSSingleSnapshot(t *testing.T) {
+	repo := repository.TestRepository(t)
+	ctx := context.Background()
+
+	sn := restic.TestCreateSnapshot(t, repo, time.Unix(1460289341, 207401672), 2, 0)
+	tree, err := restic.LoadTree(ctx, repo, *sn.Tree)
+	rtest.OK(t, err)
+
+	p := newPathFS(repo, Config{TimeTemplate: time.RFC3339, Snapshot: sn})
+
+	root, err := p.lookup(ctx, "/")
+	rtest.OK(t, err)
+	rtest.Equals(t, *sn.Tree, *root.node.Subtree)
+
+	entries, err := p.readDir(ctx, root)
+	rtest.OK(t, err)
+	rtest.Equals(t, len(tree.Nodes), len(entries))
+
+	e, err := p.lookup(ctx, "/"+tree.Nodes[0].Name)
+	rtest.OK(t, err)
+	rtest.Equals(t, tree.Nodes[0].Name, e.node.Name)
+	_, err = p.lookup(ctx, "/ids")
+	rtest.Assert(t, errors.Is(err, errNotExist), "unexpected error %v for the ids dir", err)
+}
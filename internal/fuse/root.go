@@ -4,75 +4,106 @@
 package fuse
 
 import (
+	"context"
 	"os"
 
 	"github.com/restic/restic/internal/bloblru"
 	"github.com/restic/restic/internal/debug"
 	"github.com/restic/restic/internal/restic"
 
+	"github.com/anacrolix/fuse"
 	"github.com/anacrolix/fuse/fs"
 )
 
-// Config holds settings for the fuse mount.
-type Config struct {
-	OwnerIsRoot   bool
-	Hosts         []string
-	Tags          []restic.TagList
-	Paths         []string
-	TimeTemplate  string
-	PathTemplates []string
-}
-
 // Root is the root node of the fuse mount of a repository.
 type Root struct {
 	repo      restic.Repository
 	cfg       Config
 	blobCache *bloblru.Cache
+	treeCache *treeCache
 
-	*SnapshotsDir
+	rootDir
 
 	uid, gid uint32
 }
 
+// rootDir is the dir shown at the root of the mount, either the snapshot dir
+// structure or a single snapshot.
+type rootDir interface {
+	fs.Node
+	fs.HandleReadDirAller
+	fs.NodeStringLookuper
+}
+
 // ensure that *Root implements these interfaces
 var _ = fs.HandleReadDirAller(&Root{})
 var _ = fs.NodeStringLookuper(&Root{})
 
 const rootInode = 1
 
-// Size of the blob cache. TODO: make this configurable.
-const blobCacheSize = 64 << 20
-
 // NewRoot initializes a new root node from a repository.
 func NewRoot(repo restic.Repository, cfg Config) *Root {
 	debug.Log("NewRoot(), config %v", cfg)
 
+	if cfg.OwnerIsRoot {
+		cfg.ForceOwner = true
+		cfg.OwnerUID, cfg.OwnerGID = 0, 0
+	}
+
 	root := &Root{
 		repo:      repo,
 		cfg:       cfg,
 		blobCache: bloblru.New(blobCacheSize),
+		treeCache: newTreeCache(treeCacheSize),
 	}
 
-	if !cfg.OwnerIsRoot {
+	if cfg.ForceOwner {
+		root.uid, root.gid = cfg.OwnerUID, cfg.OwnerGID
+	} else {
 		root.uid = uint32(os.Getuid())
 		root.gid = uint32(os.Getgid())
 	}
 
-	// set defaults, if PathTemplates is not set
-	if len(cfg.PathTemplates) == 0 {
-		cfg.PathTemplates = []string{
-			"ids/%i",
-			"snapshots/%T",
-			"hosts/%h/%T",
-			"tags/%t/%T",
+	if cfg.Snapshot != nil {
+		root.rootDir = &dir{
+			root:        root,
+			node:        snapshotNode(cfg.Snapshot),
+			inode:       rootInode,
+			parentInode: rootInode,
 		}
+	} else {
+		root.rootDir = NewSnapshotsDir(root, rootInode, rootInode, NewSnapshotsDirStructure(repo, cfg), "")
 	}
 
-	root.SnapshotsDir = NewSnapshotsDir(root, rootInode, rootInode, NewSnapshotsDirStructure(root, cfg.PathTemplates, cfg.TimeTemplate), "")
-
 	return root
 }
 
+// Attr returns the attributes of the root dir.
+func (r *Root) Attr(ctx context.Context, attr *fuse.Attr) error {
+	err := r.rootDir.Attr(ctx, attr)
+	// the root dir belongs to the user running restic, also for a single
+	// snapshot whose root dir has no owner
+	attr.Uid, attr.Gid = r.uid, r.gid
+	if r.cfg.AllowRoot {
+		// only the user running restic may enter the mount besides root,
+		// regardless of the owner reported for the files
+		attr.Uid, attr.Gid = uint32(os.Getuid()), uint32(os.Getgid())
+		attr.Mode = os.ModeDir | 0500
+	}
+	return err
+}
+
+// nodeOwner returns the owner and group reported for node.
+func (r *Root) nodeOwner(node *restic.Node) (uid, gid uint32) {
+	switch {
+	case r.cfg.OwnerIsRoot:
+		return 0, 0
+	case r.cfg.ForceOwner:
+		return r.cfg.OwnerUID, r.cfg.OwnerGID
+	}
+	return node.UID, node.GID
+}
+
 // Root is just there to satisfy fs.Root, it returns itself.
 func (r *Root) Root() (fs.Node, error) {
 	debug.Log("Root()")
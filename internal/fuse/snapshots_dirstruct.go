@@ -1,6 +1,3 @@
-//go:build darwin || freebsd || linux
-// +build darwin freebsd linux
-
 package fuse
 
 import (
@@ -29,10 +26,11 @@ type MetaDirData struct {
 
 // SnapshotsDirStructure contains the directory structure for snapshots.
 // It uses a paths and time template to generate a map of pathnames
-// pointing to the actual snapshots. For templates that end with a time,
-// also "latest" links are generated.
+// pointing to the actual snapshots. For templates that end with a time or a
+// snapshot ID, also "latest" links are generated.
 type SnapshotsDirStructure struct {
-	root          *Root
+	repo          restic.Repository
+	cfg           Config
 	pathTemplates []string
 	timeTemplate  string
 
@@ -46,12 +44,18 @@ type SnapshotsDirStructure struct {
 	lastCheck time.Time
 }
 
-// NewSnapshotsDirStructure returns a new directory structure for snapshots.
-func NewSnapshotsDirStructure(root *Root, pathTemplates []string, timeTemplate string) *SnapshotsDirStructure {
+// NewSnapshotsDirStructure returns a new directory structure for the
+// snapshots in repo which match the filters in cfg.
+func NewSnapshotsDirStructure(repo restic.Repository, cfg Config) *SnapshotsDirStructure {
+	pathTemplates := cfg.PathTemplates
+	if len(pathTemplates) == 0 {
+		pathTemplates = defaultPathTemplates
+	}
 	return &SnapshotsDirStructure{
-		root:          root,
+		repo:          repo,
+		cfg:           cfg,
 		pathTemplates: pathTemplates,
-		timeTemplate:  timeTemplate,
+		timeTemplate:  cfg.TimeTemplate,
 	}
 }
 
@@ -91,23 +95,32 @@ func pathsFromSn(pathTemplate string, timeTemplate string, sn *restic.Snapshot)
 			writeTime = true
 			continue
 
-		case 't':
-			if len(sn.Tags) == 0 {
+		case 't', 'p':
+			var repls []string
+			if c == 't' {
+				for _, tag := range sn.Tags {
+					repls = append(repls, filenameFromTag(tag))
+				}
+			} else {
+				for _, p := range sn.Paths {
+					repls = append(repls, filenameFromPath(p))
+				}
+			}
+			if len(repls) == 0 {
 				return nil, ""
 			}
-			if len(sn.Tags) != 1 {
+			if len(repls) != 1 {
 				// needs special treatment: Rebuild the string builders
-				newout := make([]strings.Builder, len(out)*len(sn.Tags))
-				for i, tag := range sn.Tags {
-					tag = filenameFromTag(tag)
+				newout := make([]strings.Builder, len(out)*len(repls))
+				for i, r := range repls {
 					for j := range out {
-						newout[i*len(out)+j].WriteString(out[j].String() + tag)
+						newout[i*len(out)+j].WriteString(out[j].String() + r)
 					}
 				}
 				out = newout
 				continue
 			}
-			repl = sn.Tags[0]
+			repl = repls[0]
 
 		case 'i':
 			repl = sn.ID().Str()
@@ -160,6 +173,22 @@ func filenameFromTag(tag string) string {
 	return strings.ReplaceAll(tag, "/", "_")
 }
 
+// filenameFromPath converts a backup path of a snapshot into a relative
+// directory path, so that "/home/user" is represented as "home/user". The
+// colon of Windows drive letters is removed and the components "", "." and
+// ".." are replaced like in filenameFromTag.
+func filenameFromPath(p string) string {
+	p = strings.ReplaceAll(p, "\\", "/")
+	var parts []string
+	for i, part := range strings.Split(strings.Trim(p, "/"), "/") {
+		if i == 0 && len(part) == 2 && part[1] == ':' {
+			part = part[:1]
+		}
+		parts = append(parts, filenameFromTag(part))
+	}
+	return strings.Join(parts, "/")
+}
+
 // determine static path prefix
 func staticPrefix(pathTemplate string) (prefix string) {
 	inVerb := false
@@ -174,7 +203,7 @@ outer:
 		}
 		inVerb = false
 		switch c {
-		case 'i', 'I', 'u', 'h', 't', 'T':
+		case 'i', 'I', 'u', 'h', 't', 'p', 'T':
 			patternStart = i
 			break outer
 		}
@@ -258,10 +287,24 @@ func (d *SnapshotsDirStructure) makeDirs(snapshots restic.Snapshots) {
 		}
 	}
 
+	// latest links to the newest snapshot in dir, the snapshots are sorted
+	// by time thus later snapshots with the same time take precedence
 	latestTime := make(map[string]time.Time)
+	linkLatest := func(dir, target string, sn *restic.Snapshot) {
+		lt, ok := latestTime[dir]
+		if !ok || !sn.Time.Before(lt) {
+			debug.Log("link (update) %v -> %v\n", dir, target)
+			// inject symlink
+			mount(path.Clean(dir+"/latest"), mountData{sn: sn, linkTarget: target})
+			latestTime[dir] = sn.Time
+		}
+	}
+
 	for _, sn := range snapshots {
 		for _, templ := range d.pathTemplates {
 			paths, timeSuffix := pathsFromSn(templ, d.timeTemplate, sn)
+			// directories with snapshot ids also get a latest link
+			endsWithID := strings.HasSuffix(templ, "%i") || strings.HasSuffix(templ, "%I")
 			for _, p := range paths {
 				if p != "" {
 					p = "/" + p
@@ -269,13 +312,10 @@ func (d *SnapshotsDirStructure) makeDirs(snapshots restic.Snapshots) {
 				suffix := uniqueName(entries, p, timeSuffix)
 				mount(path.Clean(p+suffix), mountData{sn: sn})
 				if timeSuffix != "" {
-					lt, ok := latestTime[p]
-					if !ok || !sn.Time.Before(lt) {
-						debug.Log("link (update) %v -> %v\n", p, suffix)
-						// inject symlink
-						mount(path.Clean(p+"/latest"), mountData{sn: sn, linkTarget: suffix})
-						latestTime[p] = sn.Time
-					}
+					linkLatest(p, suffix, sn)
+				} else if endsWithID {
+					dir, name := path.Split(p + suffix)
+					linkLatest(dir, name, sn)
 				}
 			}
 		}
@@ -295,7 +335,7 @@ func (d *SnapshotsDirStructure) updateSnapshots(ctx context.Context) error {
 	}
 
 	var snapshots restic.Snapshots
-	err := restic.FindFilteredSnapshots(ctx, d.root.repo.Backend(), d.root.repo, d.root.cfg.Hosts, d.root.cfg.Tags, d.root.cfg.Paths, nil, func(id string, sn *restic.Snapshot, err error) error {
+	err := restic.FindFilteredSnapshots(ctx, d.repo.Backend(), d.repo, d.cfg.Hosts, d.cfg.Tags, d.cfg.Paths, nil, func(id string, sn *restic.Snapshot, err error) error {
 		if sn != nil {
 			snapshots = append(snapshots, sn)
 		}
@@ -328,7 +368,7 @@ func (d *SnapshotsDirStructure) updateSnapshots(ctx context.Context) error {
 		return nil
 	}
 
-	err = d.root.repo.LoadIndex(ctx)
+	err = d.repo.LoadIndex(ctx)
 	if err != nil {
 		return err
 	}
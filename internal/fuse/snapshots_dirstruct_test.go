@@ -1,6 +1,3 @@
-//go:build darwin || freebsd || linux
-// +build darwin freebsd linux
-
 package fuse
 
 import (
@@ -15,7 +12,7 @@ import (
 func TestPathsFromSn(t *testing.T) {
 	id1, _ := restic.ParseID("1234567812345678123456781234567812345678123456781234567812345678")
 	time1, _ := time.Parse("2006-01-02T15:04:05", "2021-01-01T00:00:01")
-	sn1 := &restic.Snapshot{Hostname: "host", Username: "user", Tags: []string{"tag1", "tag2"}, Time: time1}
+	sn1 := &restic.Snapshot{Hostname: "host", Username: "user", Tags: []string{"tag1", "tag2"}, Paths: []string{"/home/user", "/etc"}, Time: time1}
 	restic.TestSetSnapshotID(t, sn1, id1)
 
 	var p []string
@@ -52,6 +49,61 @@ func TestPathsFromSn(t *testing.T) {
 	p, s = pathsFromSn("%T/%i", "2006/01", sn1)
 	test.Equals(t, []string{"2021/01/12345678"}, p)
 	test.Equals(t, "", s)
+
+	p, s = pathsFromSn("paths/%p/%T", "2006-01-02T15:04:05", sn1)
+	test.Equals(t, []string{"paths/home/user/", "paths/etc/"}, p)
+	test.Equals(t, "2021-01-01T00:00:01", s)
+
+	p, s = pathsFromSn("groups/%h/%p/%T", "2006-01-02T15:04:05", sn1)
+	test.Equals(t, []string{"groups/host/home/user/", "groups/host/etc/"}, p)
+	test.Equals(t, "2021-01-01T00:00:01", s)
+
+	p, s = pathsFromSn("%h/%p/%t", "2006-01-02T15:04:05", sn1)
+	test.Equals(t, []string{"host/home/user/tag1", "host/etc/tag1", "host/home/user/tag2", "host/etc/tag2"}, p)
+	test.Equals(t, "", s)
+
+	// snapshots without paths are not included
+	p, s = pathsFromSn("paths/%p/%T", "2006-01-02T15:04:05", &restic.Snapshot{Time: time1})
+	test.Equals(t, []string(nil), p)
+	test.Equals(t, "", s)
+}
+
+func TestMakeDirsPaths(t *testing.T) {
+	sds := &SnapshotsDirStructure{
+		pathTemplates: []string{"paths/%p/%T"},
+		timeTemplate:  "2006-01-02",
+	}
+
+	time0, _ := time.Parse("2006-01-02T15:04:05", "2020-12-31T00:00:01")
+	sn0 := &restic.Snapshot{Paths: []string{"/home"}, Time: time0}
+	restic.TestSetSnapshotID(t, sn0, restic.NewRandomID())
+
+	time1, _ := time.Parse("2006-01-02T15:04:05", "2021-01-01T00:00:01")
+	sn1 := &restic.Snapshot{Paths: []string{"/home/user", "/srv"}, Time: time1}
+	restic.TestSetSnapshotID(t, sn1, restic.NewRandomID())
+
+	sds.makeDirs(restic.Snapshots{sn0, sn1})
+
+	expNames := map[string]*restic.Snapshot{
+		"":                            nil,
+		"/paths":                      nil,
+		"/paths/home":                 nil,
+		"/paths/home/2020-12-31":      sn0,
+		"/paths/home/latest":          sn0,
+		"/paths/home/user":            nil,
+		"/paths/home/user/2021-01-01": sn1,
+		"/paths/home/user/latest":     sn1,
+		"/paths/srv":                  nil,
+		"/paths/srv/2021-01-01":       sn1,
+		"/paths/srv/latest":           sn1,
+	}
+	expLatest := map[string]string{
+		"/paths/home/latest":      "2020-12-31",
+		"/paths/home/user/latest": "2021-01-01",
+		"/paths/srv/latest":       "2021-01-01",
+	}
+
+	verifyEntries(t, expNames, expLatest, sds.entries)
 }
 
 func TestMakeDirs(t *testing.T) {
@@ -199,6 +251,10 @@ func TestMakeDirs(t *testing.T) {
 	expNames["/tags/tag4/latest"] = sn2
 	expNames["/users/user/latest"] = sn1
 	expNames["/users/user2/latest"] = sn3 // sn2 and sn3 have same time string
+	expNames["/ids/latest"] = sn3         // sn2 and sn3 have same time
+	expNames["/longids/latest"] = sn3
+	expNames["/2020/12/31/latest"] = sn0
+	expNames["/2021/01/01/latest"] = sn3
 
 	// latest links
 	expLatest["/snapshots/latest"] = "2021/01/01-2" // sn1 - sn3 have same time string
@@ -210,6 +266,10 @@ func TestMakeDirs(t *testing.T) {
 	expLatest["/tags/tag4/latest"] = "2021/01/01"
 	expLatest["/users/user/latest"] = "2021/01/01"
 	expLatest["/users/user2/latest"] = "2021/01/01-1" // sn2 and sn3 have same time string
+	expLatest["/ids/latest"] = "aaaaaaaa"
+	expLatest["/longids/latest"] = "aaaaaaaa12345678123456781234567812345678123456781234567812345678"
+	expLatest["/2020/12/31/latest"] = "00000000"
+	expLatest["/2021/01/01/latest"] = "aaaaaaaa"
 
 	verifyEntries(t, expNames, expLatest, sds.entries)
 }
@@ -289,3 +349,19 @@ func TestFilenameFromTag(t *testing.T) {
 		test.Equals(t, c.filename, filenameFromTag(c.tag))
 	}
 }
+
+func TestFilenameFromPath(t *testing.T) {
+	for _, c := range []struct {
+		path, filename string
+	}{
+		{"/", "_"},
+		{"/home/user", "home/user"},
+		{"/home/user/", "home/user"},
+		{"relative/../dir", "relative/__/dir"},
+		{"/a//b", "a/_/b"},
+		{`C:\Users\user`, "C/Users/user"},
+		{"C:/", "C"},
+	} {
+		test.Equals(t, c.filename, filenameFromPath(c.path))
+	}
+}
@@ -0,0 +1,121 @@
+package fuse
+
+import (
+	"context"
+	"sync"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/restic"
+
+	"github.com/hashicorp/golang-lru/v2/simplelru"
+)
+
+// Crude estimates of the memory used by a cached tree and by each of its
+// nodes, in addition to the variable length fields of the nodes.
+const (
+	treeOverhead = len(restic.ID{}) + 64
+	nodeOverhead = 512
+)
+
+// treeCache is a fixed-size LRU cache of decoded trees. Directories are
+// listed again whenever the kernel has forgotten about them, and trees are
+// often shared between snapshots, thus this saves loading and decrypting the
+// same tree blobs over and over again. It is safe for concurrent access.
+type treeCache struct {
+	mu sync.Mutex
+	c  *simplelru.LRU[restic.ID, *cachedTree]
+
+	free, size int // Current and max capacity, in bytes.
+}
+
+type cachedTree struct {
+	tree *restic.Tree
+	size int
+}
+
+// newTreeCache returns a tree cache which stores at most size bytes worth of
+// trees.
+func newTreeCache(size int) *treeCache {
+	c := &treeCache{
+		free: size,
+		size: size,
+	}
+
+	maxEntries := size / treeOverhead
+	lru, err := simplelru.NewLRU[restic.ID, *cachedTree](maxEntries, c.evict)
+	if err != nil {
+		panic(err) // Can only be maxEntries <= 0.
+	}
+	c.c = lru
+
+	return c
+}
+
+// treeSize estimates the memory used by tree.
+func treeSize(tree *restic.Tree) int {
+	size := treeOverhead
+	for _, node := range tree.Nodes {
+		size += nodeOverhead + len(node.Name) + len(node.LinkTarget) +
+			len(node.User) + len(node.Group) + len(node.Content)*len(restic.ID{})
+		for _, attr := range node.ExtendedAttributes {
+			size += len(attr.Name) + len(attr.Value)
+		}
+	}
+	return size
+}
+
+// Add adds the tree with the given id to c.
+func (c *treeCache) Add(id restic.ID, tree *restic.Tree) {
+	size := treeSize(tree)
+	if size > c.size {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.c.Contains(id) {
+		return
+	}
+
+	for size > c.free {
+		c.c.RemoveOldest()
+	}
+
+	c.c.Add(id, &cachedTree{tree: tree, size: size})
+	c.free -= size
+}
+
+// Get returns the tree with the given id, if it is cached.
+func (c *treeCache) Get(id restic.ID) (*restic.Tree, bool) {
+	c.mu.Lock()
+	entry, ok := c.c.Get(id)
+	c.mu.Unlock()
+
+	debug.Log("treeCache: get %v, hit %v", id, ok)
+	if !ok {
+		return nil, false
+	}
+	return entry.tree, true
+}
+
+func (c *treeCache) evict(id restic.ID, entry *cachedTree) {
+	debug.Log("treeCache: evict %v, %d bytes", id, entry.size)
+	c.free += entry.size
+}
+
+// Load returns the tree with the given id from the cache, or loads it from
+// repo and adds it to the cache. The nodes of the returned tree are shared and
+// must not be modified.
+func (c *treeCache) Load(ctx context.Context, repo restic.BlobLoader, id restic.ID) (*restic.Tree, error) {
+	if tree, ok := c.Get(id); ok {
+		return tree, nil
+	}
+
+	tree, err := restic.LoadTree(ctx, repo, id)
+	if err != nil {
+		return nil, err
+	}
+	c.Add(id, tree)
+	return tree, nil
+}
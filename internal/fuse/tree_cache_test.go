@@ -0,0 +1,86 @@
+//go:build darwin || freebsd || linux
+// +build darwin freebsd linux
+
+package fuse
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func testTree(t testing.TB, n int) *restic.Tree {
+	tree := restic.NewTree(n)
+	for i := 0; i < n; i++ {
+		rtest.OK(t, tree.Insert(&restic.Node{Name: fmt.Sprintf("file%04d", i), Type: "file"}))
+	}
+	return tree
+}
+
+func TestTreeCache(t *testing.T) {
+	tree := testTree(t, 10)
+	size := treeSize(tree)
+	c := newTreeCache(3 * size)
+
+	var ids restic.IDs
+	for i := 0; i < 4; i++ {
+		id := restic.NewRandomID()
+		ids = append(ids, id)
+		c.Add(id, tree)
+	}
+
+	// the oldest tree was evicted
+	_, ok := c.Get(ids[0])
+	rtest.Assert(t, !ok, "tree %v was not evicted", ids[0])
+	for _, id := range ids[1:] {
+		cached, ok := c.Get(id)
+		rtest.Assert(t, ok, "tree %v not found", id)
+		rtest.Assert(t, cached == tree, "wrong tree for %v", id)
+	}
+	rtest.Equals(t, 0, c.free)
+
+	// trees larger than the cache are not added
+	id := restic.NewRandomID()
+	c.Add(id, testTree(t, 40))
+	_, ok = c.Get(id)
+	rtest.Assert(t, !ok, "tree larger than the cache was added")
+	rtest.Equals(t, 0, c.free)
+}
+
+// countingRepo counts the number of tree blobs loaded from the repository.
+type countingRepo struct {
+	restic.Repository
+	trees int32
+}
+
+func (r *countingRepo) LoadBlob(ctx context.Context, t restic.BlobType, id restic.ID, buf []byte) ([]byte, error) {
+	if t == restic.TreeBlob {
+		atomic.AddInt32(&r.trees, 1)
+	}
+	return r.Repository.LoadBlob(ctx, t, id, buf)
+}
+
+func TestDirUsesTreeCache(t *testing.T) {
+	repo := &countingRepo{Repository: repository.TestRepository(t)}
+	restic.TestCreateSnapshot(t, repo, time.Unix(1460289341, 207401672), 2, 0)
+	sn := loadFirstSnapshot(t, repo)
+
+	root := NewRoot(repo, Config{})
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		// a new dir is created whenever the kernel looks up a directory again
+		d, err := newDirFromSnapshot(root, 1, sn)
+		rtest.OK(t, err)
+		_, err = d.ReadDirAll(ctx)
+		rtest.OK(t, err)
+	}
+
+	// the tree of the snapshot was only loaded once
+	rtest.Equals(t, int32(1), atomic.LoadInt32(&repo.trees))
+}
@@ -0,0 +1,113 @@
+package httpfs
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"crypto/subtle"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/restic/restic/internal/errors"
+)
+
+// Htpasswd holds users and their passwords, hashed with bcrypt like by
+// "htpasswd -B".
+type Htpasswd struct {
+	users map[string][]byte
+
+	// checking a bcrypt hash is slow, thus the sha256 hashes of passwords
+	// which were correct are cached
+	m     sync.Mutex
+	valid map[string][sha256.Size]byte
+}
+
+// ReadHtpasswd reads an htpasswd file.
+func ReadHtpasswd(filename string) (*Htpasswd, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, errors.Wrap(err, "Open")
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	h, err := ParseHtpasswd(f)
+	if err != nil {
+		return nil, errors.Wrapf(err, "htpasswd file %v", filename)
+	}
+	return h, nil
+}
+
+// ParseHtpasswd parses lines of the form "user:hash", lines starting with
+// "#" are ignored. Only bcrypt hashes are supported.
+func ParseHtpasswd(rd io.Reader) (*Htpasswd, error) {
+	h := &Htpasswd{
+		users: make(map[string][]byte),
+		valid: make(map[string][sha256.Size]byte),
+	}
+
+	sc := bufio.NewScanner(rd)
+	for line := 1; sc.Scan(); line++ {
+		text := strings.TrimSpace(sc.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		user, hash, ok := strings.Cut(text, ":")
+		if !ok || user == "" {
+			return nil, errors.Errorf("invalid line %d, expected user:hash", line)
+		}
+		if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+			return nil, errors.Errorf("unsupported hash for user %q in line %d, only bcrypt is supported", user, line)
+		}
+		h.users[user] = []byte(hash)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// Check returns true if password is correct for user.
+func (h *Htpasswd) Check(user, password string) bool {
+	hash, ok := h.users[user]
+	if !ok {
+		return false
+	}
+
+	sum := sha256.Sum256([]byte(password))
+	h.m.Lock()
+	valid, cached := h.valid[user]
+	h.m.Unlock()
+	if cached && subtle.ConstantTimeCompare(valid[:], sum[:]) == 1 {
+		return true
+	}
+
+	if bcrypt.CompareHashAndPassword(hash, []byte(password)) != nil {
+		return false
+	}
+
+	h.m.Lock()
+	h.valid[user] = sum
+	h.m.Unlock()
+	return true
+}
+
+// BasicAuth returns a handler which requires HTTP basic authentication with
+// one of users before calling next.
+func BasicAuth(next http.Handler, realm string, users *Htpasswd) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, password, ok := r.BasicAuth()
+		if !ok || !users.Check(user, password) {
+			w.Header().Set("WWW-Authenticate", `Basic realm="`+realm+`", charset="UTF-8"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
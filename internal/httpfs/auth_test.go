@@ -0,0 +1,64 @@
+package httpfs
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestParseHtpasswd(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	rtest.OK(t, err)
+
+	users, err := ParseHtpasswd(strings.NewReader("# comment\n\nalice:" + string(hash) + "\n"))
+	rtest.OK(t, err)
+	rtest.Assert(t, users.Check("alice", "secret"), "correct password rejected")
+	// the second check uses the cache
+	rtest.Assert(t, users.Check("alice", "secret"), "correct password rejected")
+	rtest.Assert(t, !users.Check("alice", "wrong"), "wrong password accepted")
+	rtest.Assert(t, !users.Check("bob", "secret"), "unknown user accepted")
+
+	for _, data := range []string{
+		"alice",
+		":" + string(hash),
+		"alice:{SHA}5en6G6MezRroT3XKqkdPOmY/BfQ=",
+		"alice:secret",
+	} {
+		_, err := ParseHtpasswd(strings.NewReader(data))
+		rtest.Assert(t, err != nil, "no error for invalid line %q", data)
+	}
+}
+
+func TestBasicAuth(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	rtest.OK(t, err)
+	users, err := ParseHtpasswd(strings.NewReader("alice:" + string(hash)))
+	rtest.OK(t, err)
+
+	h := BasicAuth(NewHandler(testFS()), "restic", users)
+
+	for _, test := range []struct {
+		user, password string
+		status         int
+	}{
+		{"", "", http.StatusUnauthorized},
+		{"alice", "wrong", http.StatusUnauthorized},
+		{"alice", "secret", http.StatusOK},
+	} {
+		req := httptest.NewRequest("GET", "/dir/file.txt", nil)
+		if test.user != "" {
+			req.SetBasicAuth(test.user, test.password)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		rtest.Equals(t, test.status, rec.Code)
+		if test.status == http.StatusUnauthorized {
+			rtest.Assert(t, rec.Header().Get("WWW-Authenticate") != "", "no WWW-Authenticate header")
+		}
+	}
+}
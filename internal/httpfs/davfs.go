@@ -0,0 +1,112 @@
+package httpfs
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"mime"
+	"os"
+	"path"
+
+	"golang.org/x/net/webdav"
+
+	"github.com/restic/restic/internal/errors"
+)
+
+// davFS provides read-only access to an fs.FS for the WebDAV handler.
+type davFS struct {
+	fsys fs.FS
+}
+
+// Statically ensure that davFS implements webdav.FileSystem
+var _ webdav.FileSystem = davFS{}
+
+func (d davFS) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+	return os.ErrPermission
+}
+
+func (d davFS) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND) != 0 {
+		return nil, os.ErrPermission
+	}
+
+	f, err := d.fsys.Open(fsName(name))
+	if err != nil {
+		return nil, err
+	}
+	return davFile{File: f}, nil
+}
+
+func (d davFS) RemoveAll(ctx context.Context, name string) error {
+	return os.ErrPermission
+}
+
+func (d davFS) Rename(ctx context.Context, oldName, newName string) error {
+	return os.ErrPermission
+}
+
+func (d davFS) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	fi, err := fs.Stat(d.fsys, fsName(name))
+	if err != nil {
+		return nil, err
+	}
+	return davFileInfo{fi}, nil
+}
+
+type davFile struct {
+	fs.File
+}
+
+func (f davFile) Seek(offset int64, whence int) (int64, error) {
+	s, ok := f.File.(io.Seeker)
+	if !ok {
+		return 0, errors.New("file does not support seeking")
+	}
+	return s.Seek(offset, whence)
+}
+
+func (f davFile) Readdir(count int) ([]os.FileInfo, error) {
+	rd, ok := f.File.(fs.ReadDirFile)
+	if !ok {
+		return nil, errors.New("not a directory")
+	}
+
+	entries, err := rd.ReadDir(count)
+	list := make([]os.FileInfo, 0, len(entries))
+	for _, e := range entries {
+		fi, err := e.Info()
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, davFileInfo{fi})
+	}
+	return list, err
+}
+
+func (f davFile) Stat() (os.FileInfo, error) {
+	fi, err := f.File.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return davFileInfo{fi}, nil
+}
+
+func (f davFile) Write(p []byte) (int, error) {
+	return 0, os.ErrPermission
+}
+
+// davFileInfo returns the content type of files based on their name only.
+// Otherwise the WebDAV handler reads the start of each file in a dir listing.
+type davFileInfo struct {
+	fs.FileInfo
+}
+
+// Statically ensure that davFileInfo implements webdav.ContentTyper
+var _ webdav.ContentTyper = davFileInfo{}
+
+func (fi davFileInfo) ContentType(ctx context.Context) (string, error) {
+	if ctype := mime.TypeByExtension(path.Ext(fi.Name())); ctype != "" {
+		return ctype, nil
+	}
+	return "application/octet-stream", nil
+}
@@ -0,0 +1,235 @@
+// Package httpfs serves an fs.FS via HTTP and WebDAV.
+package httpfs
+
+import (
+	"html/template"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"golang.org/x/net/webdav"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/ui"
+)
+
+// methods which are supported by the handler
+const allowedMethods = "OPTIONS, GET, HEAD, PROPFIND"
+
+// ReadLinkFS is implemented by file systems which contain symlinks. Stat and
+// ReadDir of such a file system must not follow symlinks.
+type ReadLinkFS interface {
+	fs.FS
+	ReadLink(name string) (string, error)
+}
+
+// Handler serves the files and dirs of a file system. GET and HEAD requests
+// return the content of files and an HTML listing for dirs, WebDAV clients
+// can list dirs with PROPFIND. As the handler does not support locking,
+// WebDAV clients treat the file system as read-only. All methods which would
+// modify it are rejected.
+//
+// Files returned by the file system must implement io.Seeker, dirs must
+// implement fs.ReadDirFile.
+type Handler struct {
+	fsys fs.FS
+	dav  *webdav.Handler
+}
+
+// NewHandler returns a handler for fsys.
+func NewHandler(fsys fs.FS) *Handler {
+	return &Handler{
+		fsys: fsys,
+		dav: &webdav.Handler{
+			FileSystem: davFS{fsys: fsys},
+			// not used for PROPFIND without locks, but required
+			LockSystem: webdav.NewMemLS(),
+			Logger: func(r *http.Request, err error) {
+				if err != nil {
+					debug.Log("WebDAV %v %v failed: %v", r.Method, r.URL.Path, err)
+				}
+			},
+		},
+	}
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	debug.Log("%v %v", r.Method, r.URL.Path)
+
+	switch r.Method {
+	case http.MethodOptions:
+		w.Header().Set("Allow", allowedMethods)
+		// WebDAV class 1, without locking
+		w.Header().Set("DAV", "1")
+		w.Header().Set("MS-Author-Via", "DAV")
+	case http.MethodGet, http.MethodHead:
+		h.serveGet(w, r)
+	case "PROPFIND":
+		// listing the whole file system at once is too expensive
+		depth := r.Header.Get("Depth")
+		if depth != "0" && depth != "1" {
+			http.Error(w, "only PROPFIND with depth 0 or 1 is supported", http.StatusForbidden)
+			return
+		}
+		h.dav.ServeHTTP(w, r)
+	default:
+		w.Header().Set("Allow", allowedMethods)
+		http.Error(w, "read-only file system", http.StatusMethodNotAllowed)
+	}
+}
+
+// fsName returns the name in the file system for the slash separated path p.
+func fsName(p string) string {
+	name := strings.TrimPrefix(path.Clean("/"+p), "/")
+	if name == "" {
+		return "."
+	}
+	return name
+}
+
+// httpError replies with the HTTP status for err.
+func httpError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, fs.ErrNotExist), errors.Is(err, fs.ErrInvalid):
+		http.Error(w, "not found", http.StatusNotFound)
+	case errors.Is(err, fs.ErrPermission):
+		http.Error(w, "permission denied", http.StatusForbidden)
+	default:
+		debug.Log("returning internal server error for error %v", err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+	}
+}
+
+func (h *Handler) serveGet(w http.ResponseWriter, r *http.Request) {
+	name := fsName(r.URL.Path)
+	fi, err := fs.Stat(h.fsys, name)
+	if err != nil {
+		httpError(w, err)
+		return
+	}
+
+	switch {
+	case fi.IsDir():
+		if !strings.HasSuffix(r.URL.Path, "/") {
+			// make relative links in the listing work, the relative
+			// redirect also works behind proxies which change the path
+			w.Header().Set("Location", "./"+url.PathEscape(path.Base(r.URL.Path))+"/")
+			w.WriteHeader(http.StatusMovedPermanently)
+			return
+		}
+		h.serveDir(w, name)
+	case fi.Mode().IsRegular():
+		h.serveFile(w, r, name)
+	default:
+		http.Error(w, "not a regular file", http.StatusForbidden)
+	}
+}
+
+func (h *Handler) serveFile(w http.ResponseWriter, r *http.Request, name string) {
+	f, err := h.fsys.Open(name)
+	if err != nil {
+		httpError(w, err)
+		return
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	fi, err := f.Stat()
+	if err != nil {
+		httpError(w, err)
+		return
+	}
+
+	rs, ok := f.(io.ReadSeeker)
+	if !ok {
+		httpError(w, errors.Errorf("file %v does not implement io.Seeker", name))
+		return
+	}
+
+	// supports range requests and conditional requests based on the time
+	http.ServeContent(w, r, fi.Name(), fi.ModTime(), rs)
+}
+
+var dirTemplate = template.Must(template.New("dir").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Path}}</title>
+</head>
+<body>
+<h1>{{.Path}}</h1>
+<table>
+<tr><th>Name</th><th>Size</th><th>Modified</th></tr>
+{{if .Parent}}<tr><td><a href="../">../</a></td><td></td><td></td></tr>
+{{end}}{{range .Entries}}<tr><td>{{if .Target}}{{.Name}} -&gt; {{.Target}}{{else}}<a href="{{.Link}}">{{.Name}}</a>{{end}}</td><td>{{.Size}}</td><td>{{.ModTime}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+type dirEntry struct {
+	Name    string
+	Link    string
+	Target  string
+	Size    string
+	ModTime string
+}
+
+func (h *Handler) serveDir(w http.ResponseWriter, name string) {
+	list, err := fs.ReadDir(h.fsys, name)
+	if err != nil {
+		httpError(w, err)
+		return
+	}
+
+	rl, _ := h.fsys.(ReadLinkFS)
+	entries := make([]dirEntry, 0, len(list))
+	for _, e := range list {
+		fi, err := e.Info()
+		if err != nil {
+			httpError(w, err)
+			return
+		}
+
+		// without "./", names with a colon would be parsed as URL scheme
+		entry := dirEntry{
+			Name:    e.Name(),
+			Link:    "./" + url.PathEscape(e.Name()),
+			ModTime: fi.ModTime().Format("2006-01-02 15:04:05"),
+		}
+		switch {
+		case fi.IsDir():
+			entry.Name += "/"
+			entry.Link += "/"
+		case fi.Mode().IsRegular():
+			entry.Size = ui.FormatBytes(uint64(fi.Size()))
+		case fi.Mode()&fs.ModeSymlink != 0 && rl != nil:
+			entry.Target, err = rl.ReadLink(path.Join(name, e.Name()))
+			if err != nil {
+				httpError(w, err)
+				return
+			}
+		}
+		entries = append(entries, entry)
+	}
+
+	p := "/"
+	if name != "." {
+		p += name + "/"
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	err = dirTemplate.Execute(w, struct {
+		Path    string
+		Parent  bool
+		Entries []dirEntry
+	}{p, name != ".", entries})
+	if err != nil {
+		debug.Log("writing dir listing for %v failed: %v", name, err)
+	}
+}
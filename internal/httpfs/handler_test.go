@@ -0,0 +1,106 @@
+package httpfs
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func testFS() fstest.MapFS {
+	return fstest.MapFS{
+		"dir/file.txt":      {Data: []byte("hello world"), ModTime: time.Unix(1500000000, 0)},
+		"dir/sub/x":         {Data: []byte("x")},
+		"dir/index.html":    {Data: []byte("<html></html>")},
+		"dir/with space&co": {Data: []byte("y")},
+		"dir/a:b":           {Data: []byte("z")},
+	}
+}
+
+func request(t testing.TB, h http.Handler, method, target string, header map[string]string) *http.Response {
+	req := httptest.NewRequest(method, target, nil)
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec.Result()
+}
+
+func readBody(t testing.TB, res *http.Response) string {
+	buf, err := io.ReadAll(res.Body)
+	rtest.OK(t, err)
+	return string(buf)
+}
+
+func TestHandlerGet(t *testing.T) {
+	h := NewHandler(testFS())
+
+	res := request(t, h, "GET", "/dir/file.txt", nil)
+	rtest.Equals(t, http.StatusOK, res.StatusCode)
+	rtest.Equals(t, "hello world", readBody(t, res))
+	rtest.Equals(t, "text/plain; charset=utf-8", res.Header.Get("Content-Type"))
+
+	res = request(t, h, "GET", "/dir/file.txt", map[string]string{"Range": "bytes=6-"})
+	rtest.Equals(t, http.StatusPartialContent, res.StatusCode)
+	rtest.Equals(t, "world", readBody(t, res))
+
+	res = request(t, h, "GET", "/dir/file.txt", map[string]string{
+		"If-Modified-Since": time.Unix(1500000000, 0).UTC().Format(http.TimeFormat),
+	})
+	rtest.Equals(t, http.StatusNotModified, res.StatusCode)
+
+	res = request(t, h, "GET", "/dir/missing", nil)
+	rtest.Equals(t, http.StatusNotFound, res.StatusCode)
+	res = request(t, h, "GET", "/../dir/sub/../file.txt", nil)
+	rtest.Equals(t, http.StatusOK, res.StatusCode)
+
+	res = request(t, h, "GET", "/dir", nil)
+	rtest.Equals(t, http.StatusMovedPermanently, res.StatusCode)
+	rtest.Equals(t, "./dir/", res.Header.Get("Location"))
+
+	// index.html files are listed and not served instead of the dir
+	res = request(t, h, "GET", "/dir/", nil)
+	rtest.Equals(t, http.StatusOK, res.StatusCode)
+	body := readBody(t, res)
+	for _, s := range []string{`href="../"`, `href="./file.txt"`, `href="./index.html"`, `href="./sub/"`, `href="./with%20space&amp;co"`, `href="./a:b"`} {
+		rtest.Assert(t, strings.Contains(body, s), "listing does not contain %v:\n%v", s, body)
+	}
+
+	res = request(t, h, "GET", "/", nil)
+	rtest.Equals(t, http.StatusOK, res.StatusCode)
+	body = readBody(t, res)
+	rtest.Assert(t, strings.Contains(body, `href="./dir/"`), "listing does not contain dir:\n%v", body)
+	rtest.Assert(t, !strings.Contains(body, `href="../"`), "listing of the root dir contains a parent:\n%v", body)
+}
+
+func TestHandlerWebDAV(t *testing.T) {
+	h := NewHandler(testFS())
+
+	res := request(t, h, "OPTIONS", "/", nil)
+	rtest.Equals(t, http.StatusOK, res.StatusCode)
+	rtest.Equals(t, "1", res.Header.Get("DAV"))
+
+	res = request(t, h, "PROPFIND", "/dir/", map[string]string{"Depth": "1"})
+	rtest.Equals(t, http.StatusMultiStatus, res.StatusCode)
+	body := readBody(t, res)
+	for _, s := range []string{"/dir/file.txt", "/dir/sub/", "<D:getcontentlength>11</D:getcontentlength>"} {
+		rtest.Assert(t, strings.Contains(body, s), "PROPFIND response does not contain %v:\n%v", s, body)
+	}
+	rtest.Assert(t, !strings.Contains(body, "/dir/sub/x"), "PROPFIND response contains more than one level:\n%v", body)
+
+	res = request(t, h, "PROPFIND", "/", map[string]string{"Depth": "infinity"})
+	rtest.Equals(t, http.StatusForbidden, res.StatusCode)
+	res = request(t, h, "PROPFIND", "/", nil)
+	rtest.Equals(t, http.StatusForbidden, res.StatusCode)
+
+	for _, method := range []string{"PUT", "DELETE", "MKCOL", "MOVE", "COPY", "PROPPATCH", "LOCK", "POST"} {
+		res = request(t, h, method, "/dir/file.txt", nil)
+		rtest.Assert(t, res.StatusCode == http.StatusMethodNotAllowed, "%v returned status %v", method, res.StatusCode)
+	}
+}
@@ -0,0 +1,174 @@
+package index
+
+import (
+	"hash/maphash"
+	"math"
+	"sort"
+
+	"github.com/restic/restic/internal/restic"
+)
+
+// MaxBlobCount is the largest value which can be stored in a CountedBlobSet.
+const MaxBlobCount = math.MaxUint8 - 1
+
+// CountedBlobSet is a set of blobs which stores a value for each blob, like
+// restic.CountedBlobSet. For blobs contained in the final indexes of a
+// MasterIndex, the value is stored in the index entries. Only the remaining
+// blobs are stored in a map. This lets prune track the used blobs without a
+// second set next to the index. The value uses the padding of the index
+// entries on 64-bit platforms, on 32-bit platforms it adds 4 bytes to each
+// entry. The blobs to keep while repacking are still copied to a separate set.
+//
+// Only a single CountedBlobSet can be used for a MasterIndex at a time, and
+// the final indexes must not be merged while it is in use. A CountedBlobSet
+// is not safe for concurrent use.
+type CountedBlobSet struct {
+	maps   [restic.NumBlobTypes][]countedIndexMap
+	len    int
+	others restic.CountedBlobSet
+}
+
+// countedIndexMap allows lookups in an indexMap of a final index without
+// locking the index. As the map is not modified anymore, only the hash state
+// must not be shared.
+type countedIndexMap struct {
+	m  *indexMap
+	mh maphash.Hash
+}
+
+// NewCountedBlobSet returns an empty CountedBlobSet for the blobs in mi.
+func (mi *MasterIndex) NewCountedBlobSet() *CountedBlobSet {
+	mi.idxMutex.RLock()
+	defer mi.idxMutex.RUnlock()
+
+	s := &CountedBlobSet{others: restic.NewCountedBlobSet()}
+	for _, idx := range mi.idx {
+		idx.m.Lock()
+		if idx.final {
+			for typ := range idx.byType {
+				m := &idx.byType[typ]
+				m.foreach(func(e *indexEntry) bool {
+					e.count = 0
+					return true
+				})
+
+				cm := countedIndexMap{m: m}
+				cm.mh.SetSeed(m.mh.Seed())
+				s.maps[typ] = append(s.maps[typ], cm)
+			}
+		}
+		idx.m.Unlock()
+	}
+	return s
+}
+
+// entry returns the index entry which holds the value of h, or nil if the
+// blob is not contained in a final index.
+func (s *CountedBlobSet) entry(h restic.BlobHandle) *indexEntry {
+	maps := s.maps[h.Type]
+	for i := range maps {
+		if e := maps[i].m.getWithHasher(&maps[i].mh, h.ID); e != nil {
+			return e
+		}
+	}
+	return nil
+}
+
+// Has returns true iff h is contained in the set.
+func (s *CountedBlobSet) Has(h restic.BlobHandle) bool {
+	_, ok := s.Get(h)
+	return ok
+}
+
+// Get returns the value for h and whether h is contained in the set.
+func (s *CountedBlobSet) Get(h restic.BlobHandle) (uint8, bool) {
+	if e := s.entry(h); e != nil {
+		if e.count == 0 {
+			return 0, false
+		}
+		return e.count - 1, true
+	}
+
+	v, ok := s.others[h]
+	return v, ok
+}
+
+// Insert adds h to the set with value 0.
+func (s *CountedBlobSet) Insert(h restic.BlobHandle) {
+	s.Set(h, 0)
+}
+
+// Set adds h to the set with value v, which must not exceed MaxBlobCount.
+func (s *CountedBlobSet) Set(h restic.BlobHandle, v uint8) {
+	if v > MaxBlobCount {
+		panic("value too large for CountedBlobSet")
+	}
+
+	if e := s.entry(h); e != nil {
+		if e.count == 0 {
+			s.len++
+		}
+		e.count = v + 1
+		return
+	}
+
+	s.others[h] = v
+}
+
+// Delete removes h from the set.
+func (s *CountedBlobSet) Delete(h restic.BlobHandle) {
+	if e := s.entry(h); e != nil {
+		if e.count != 0 {
+			s.len--
+		}
+		e.count = 0
+		return
+	}
+
+	delete(s.others, h)
+}
+
+// Len returns the number of blobs in the set.
+func (s *CountedBlobSet) Len() int {
+	return s.len + len(s.others)
+}
+
+// Each calls fn for all blobs in the set with their value. fn must not modify
+// the set.
+func (s *CountedBlobSet) Each(fn func(h restic.BlobHandle, v uint8)) {
+	for typ, maps := range s.maps {
+		for _, cm := range maps {
+			cm.m.foreach(func(e *indexEntry) bool {
+				if e.count != 0 {
+					fn(restic.BlobHandle{ID: e.id, Type: restic.BlobType(typ)}, e.count-1)
+				}
+				return true
+			})
+		}
+	}
+
+	for h, v := range s.others {
+		fn(h, v)
+	}
+}
+
+// List returns a sorted slice of all BlobHandle in the set.
+func (s *CountedBlobSet) List() restic.BlobHandles {
+	list := make(restic.BlobHandles, 0, s.Len())
+	s.Each(func(h restic.BlobHandle, _ uint8) {
+		list = append(list, h)
+	})
+
+	sort.Sort(list)
+
+	return list
+}
+
+func (s *CountedBlobSet) String() string {
+	str := s.List().String()
+	if len(str) < 2 {
+		return "{}"
+	}
+
+	return "{" + str[1:len(str)-1] + "}"
+}
@@ -0,0 +1,64 @@
+package index_test
+
+import (
+	"testing"
+
+	"github.com/restic/restic/internal/index"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestCountedBlobSet(t *testing.T) {
+	bhIndexed := restic.NewRandomBlobHandle()
+	bhDuplicate := restic.BlobHandle{ID: restic.NewRandomID(), Type: restic.TreeBlob}
+	bhOther := restic.NewRandomBlobHandle()
+
+	idx1 := index.NewIndex()
+	idx1.StorePack(restic.NewRandomID(), []restic.Blob{{BlobHandle: bhIndexed, Length: 42}})
+	idx1.StorePack(restic.NewRandomID(), []restic.Blob{{BlobHandle: bhDuplicate, Length: 23}})
+	idx2 := index.NewIndex()
+	idx2.StorePack(restic.NewRandomID(), []restic.Blob{{BlobHandle: bhDuplicate, Length: 23, Offset: 5}})
+
+	mIdx := index.NewMasterIndex()
+	mIdx.Insert(idx1)
+	mIdx.Insert(idx2)
+	index.TestMergeIndex(t, mIdx)
+
+	s := mIdx.NewCountedBlobSet()
+	rtest.Equals(t, 0, s.Len())
+	for _, bh := range []restic.BlobHandle{bhIndexed, bhDuplicate, bhOther} {
+		rtest.Assert(t, !s.Has(bh), "empty set contains %v", bh)
+		s.Insert(bh)
+		rtest.Assert(t, s.Has(bh), "set is missing %v", bh)
+		count, ok := s.Get(bh)
+		rtest.Assert(t, ok && count == 0, "unexpected value %v, %v for %v", count, ok, bh)
+	}
+	rtest.Equals(t, 3, s.Len())
+
+	s.Set(bhIndexed, index.MaxBlobCount)
+	s.Set(bhDuplicate, 2)
+	s.Set(bhOther, 1)
+	rtest.Equals(t, 3, s.Len())
+
+	found := make(map[restic.BlobHandle]uint8)
+	s.Each(func(bh restic.BlobHandle, count uint8) {
+		found[bh] = count
+	})
+	rtest.Equals(t, map[restic.BlobHandle]uint8{
+		bhIndexed:   index.MaxBlobCount,
+		bhDuplicate: 2,
+		bhOther:     1,
+	}, found)
+
+	s.Delete(bhIndexed)
+	s.Delete(bhOther)
+	rtest.Assert(t, !s.Has(bhIndexed), "deleted blob %v is still contained", bhIndexed)
+	rtest.Assert(t, !s.Has(bhOther), "deleted blob %v is still contained", bhOther)
+	rtest.Equals(t, 1, s.Len())
+	rtest.Equals(t, restic.BlobHandles{bhDuplicate}, s.List())
+
+	// a new set must not contain the values of the previous one
+	s = mIdx.NewCountedBlobSet()
+	rtest.Equals(t, 0, s.Len())
+	rtest.Assert(t, !s.Has(bhDuplicate), "new set contains %v", bhDuplicate)
+}
@@ -110,6 +110,25 @@ func (m *indexMap) grow() {
 	}
 }
 
+// getWithHasher returns the first entry for the given id like get, but
+// computes the hash using mh instead of m.mh. mh must use the seed of m.mh.
+// This allows concurrent lookups in maps which are no longer modified.
+func (m *indexMap) getWithHasher(mh *maphash.Hash, id restic.ID) *indexEntry {
+	if len(m.buckets) == 0 {
+		return nil
+	}
+
+	mh.Reset()
+	_, _ = mh.Write(id[:])
+	h := uint(mh.Sum64()) & uint(len(m.buckets)-1)
+	for e := m.buckets[h]; e != nil; e = e.next {
+		if e.id == id {
+			return e
+		}
+	}
+	return nil
+}
+
 func (m *indexMap) hash(id restic.ID) uint {
 	// We use maphash to prevent backups of specially crafted inputs
 	// from degrading performance.
@@ -137,12 +156,11 @@ func (m *indexMap) newEntry() *indexEntry {
 	//
 	// Then again, allocating each indexEntry separately also wastes space
 	// on 32-bit platforms, because the Go malloc has no size class for
-	// exactly 52 bytes, so it puts the indexEntry in a 64-byte slot instead.
+	// exactly 56 bytes, so it puts the indexEntry in a 64-byte slot instead.
 	// See src/runtime/sizeclasses.go in the Go source repo.
 	//
 	// The batch size of 4 means we hit the size classes for 4×64=256 bytes
-	// (64-bit) and 4×52=208 bytes (32-bit), wasting nothing in malloc on
-	// 64-bit and relatively little on 32-bit.
+	// (64-bit) and 4×56=224 bytes (32-bit), wasting nothing in malloc.
 	const entryAllocBatch = 4
 
 	e := m.free
@@ -167,4 +185,10 @@ type indexEntry struct {
 	offset             uint32
 	length             uint32
 	uncompressedLength uint32
+
+	// count holds the value of the blob in a CountedBlobSet plus one, zero
+	// means that the blob is not contained in the set. It fits into the
+	// padding at the end of the struct on 64-bit platforms, on 32-bit
+	// platforms it grows the struct from 52 to 56 bytes.
+	count uint8
 }
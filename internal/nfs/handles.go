@@ -0,0 +1,130 @@
+package nfs
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"path"
+	"sync"
+
+	"github.com/hashicorp/golang-lru/v2/simplelru"
+)
+
+// handleSize is the length of the file handles used by the server.
+const handleSize = 16
+
+// maximum number of paths which are kept in the handle table
+const maxHandles = 1 << 18
+
+// rootID is the id of the root dir, which is never evicted
+const rootID = 1
+
+// handleTable assigns file handles to the paths of files. A handle consists
+// of an id for the path and a random generation number, which is different
+// each time the server is started. Handles are thus only valid as long as
+// the server runs, afterwards clients receive a "stale file handle" error.
+//
+// The paths which were seen most recently by a client are kept in memory.
+// Handles of evicted paths become stale, a path which is seen again gets a
+// new id.
+type handleTable struct {
+	gen uint64
+
+	m     sync.Mutex
+	next  uint64
+	ids   map[string]uint64
+	paths *simplelru.LRU[uint64, string]
+}
+
+func newHandleTable() *handleTable {
+	return newHandleTableSize(maxHandles)
+}
+
+func newHandleTableSize(size int) *handleTable {
+	var buf [8]byte
+	_, err := rand.Read(buf[:])
+	if err != nil {
+		panic(err)
+	}
+
+	t := &handleTable{
+		gen:  binary.BigEndian.Uint64(buf[:]),
+		next: rootID,
+		ids:  make(map[string]uint64),
+	}
+	t.paths, err = simplelru.NewLRU(size, func(id uint64, name string) {
+		// called with t.m locked
+		delete(t.ids, name)
+	})
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// id returns the id for the path name, which is also used as the file id.
+func (t *handleTable) id(name string) uint64 {
+	if name == "." {
+		return rootID
+	}
+
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	id, ok := t.ids[name]
+	if ok {
+		// mark as recently used
+		t.paths.Get(id)
+		return id
+	}
+
+	t.next++
+	id = t.next
+	t.ids[name] = id
+	t.paths.Add(id, name)
+	return id
+}
+
+// handle returns the file handle and the id for the path name.
+func (t *handleTable) handle(name string) ([]byte, uint64) {
+	id := t.id(name)
+	fh := make([]byte, handleSize)
+	binary.BigEndian.PutUint64(fh[:8], t.gen)
+	binary.BigEndian.PutUint64(fh[8:], id)
+	return fh, id
+}
+
+// path returns the path and the id for the handle fh.
+func (t *handleTable) path(fh []byte) (string, uint64, uint32) {
+	if len(fh) != handleSize {
+		return "", 0, nfs3ErrBadHandle
+	}
+	if binary.BigEndian.Uint64(fh[:8]) != t.gen {
+		return "", 0, nfs3ErrStale
+	}
+
+	id := binary.BigEndian.Uint64(fh[8:])
+	if id == rootID {
+		return ".", id, nfs3OK
+	}
+
+	t.m.Lock()
+	defer t.m.Unlock()
+	name, ok := t.paths.Get(id)
+	if !ok {
+		return "", 0, nfs3ErrStale
+	}
+	return name, id, nfs3OK
+}
+
+// joinPath returns the path of the entry name in the dir with the path dir.
+func joinPath(dir, name string) string {
+	switch {
+	case name == ".":
+		return dir
+	case name == "..":
+		return path.Dir(dir)
+	case dir == ".":
+		return name
+	}
+	return dir + "/" + name
+}
@@ -0,0 +1,127 @@
+package nfs
+
+import (
+	"io/fs"
+	"strings"
+
+	"github.com/restic/restic/internal/debug"
+)
+
+// MOUNT version 3 as described in appendix I of RFC 1813.
+const (
+	mountProg    = 100005
+	mountVersion = 3
+
+	mountProcMnt     = 1
+	mountProcDump    = 2
+	mountProcUmnt    = 3
+	mountProcUmntAll = 4
+	mountProcExport  = 5
+
+	mnt3OK        = 0
+	mnt3ErrNoEnt  = 2
+	mnt3ErrAcces  = 13
+	mnt3ErrNotDir = 20
+	mnt3ErrInval  = 22
+
+	maxPathLen = 1024
+)
+
+func (s *Server) mountProcs() map[uint32]procedure {
+	return map[uint32]procedure{
+		mountProcMnt:     s.mountMnt,
+		mountProcDump:    s.mountDump,
+		mountProcUmnt:    s.mountUmnt,
+		mountProcUmntAll: s.mountUmntAll,
+		mountProcExport:  s.mountExport,
+	}
+}
+
+// mountAuth checks the credentials of calls if access is restricted. MNT
+// fails with MNT3ERR_ACCES for other users, all other procedures are rejected.
+func (s *Server) mountAuth(c caller, proc uint32) (uint32, procedure) {
+	if !s.restricted || (c.cred != nil && c.cred.uid == s.uid) {
+		return authOK, nil
+	}
+	if c.cred != nil && proc == mountProcMnt {
+		return authOK, func(args *xdrReader, res *xdrWriter) {
+			res.uint32(mnt3ErrAcces)
+		}
+	}
+	return authTooWeak, nil
+}
+
+// mountMnt returns the handle for a dir. All dirs can be mounted, "/" is the
+// root dir of the file system. With ExportOnce, only the root dir can be
+// mounted once via the export path.
+func (s *Server) mountMnt(args *xdrReader, res *xdrWriter) {
+	dirpath := args.string(maxPathLen)
+	if args.err != nil {
+		return
+	}
+
+	if s.export != "" {
+		if !s.mountOnce(dirpath) {
+			debug.Log("MNT rejected")
+			res.uint32(mnt3ErrAcces)
+			return
+		}
+		dirpath = "/"
+	}
+
+	debug.Log("MNT %q", dirpath)
+	name := strings.Trim(dirpath, "/")
+	if name == "" {
+		name = "."
+	}
+	if !fs.ValidPath(name) {
+		res.uint32(mnt3ErrInval)
+		return
+	}
+
+	fi, err := fs.Stat(s.fsys, name)
+	if err != nil {
+		debug.Log("MNT %q failed: %v", dirpath, err)
+		res.uint32(mnt3ErrNoEnt)
+		return
+	}
+	if !fi.IsDir() {
+		res.uint32(mnt3ErrNotDir)
+		return
+	}
+
+	fh, _ := s.handles.handle(name)
+	res.uint32(mnt3OK)
+	res.opaque(fh)
+	// auth flavors
+	res.uint32(1)
+	res.uint32(authUnix)
+}
+
+// mountDump returns an empty list of mounts, they are not tracked.
+func (s *Server) mountDump(args *xdrReader, res *xdrWriter) {
+	res.bool(false)
+}
+
+func (s *Server) mountUmnt(args *xdrReader, res *xdrWriter) {
+	dirpath := args.string(maxPathLen)
+	debug.Log("UMNT %q", dirpath)
+}
+
+func (s *Server) mountUmntAll(args *xdrReader, res *xdrWriter) {
+	debug.Log("UMNTALL")
+}
+
+// mountExport lists the root dir as the only export, for all clients. The
+// export path of ExportOnce is not listed.
+func (s *Server) mountExport(args *xdrReader, res *xdrWriter) {
+	if s.export != "" {
+		res.bool(false)
+		return
+	}
+	res.bool(true)
+	res.string("/")
+	// no groups
+	res.bool(false)
+	res.bool(false)
+}
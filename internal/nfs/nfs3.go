@@ -0,0 +1,656 @@
+package nfs
+
+import (
+	"io"
+	"io/fs"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+)
+
+// NFS version 3 as described in RFC 1813.
+const (
+	nfsProg    = 100003
+	nfsVersion = 3
+
+	nfs3ProcGetattr     = 1
+	nfs3ProcSetattr     = 2
+	nfs3ProcLookup      = 3
+	nfs3ProcAccess      = 4
+	nfs3ProcReadlink    = 5
+	nfs3ProcRead        = 6
+	nfs3ProcWrite       = 7
+	nfs3ProcCreate      = 8
+	nfs3ProcMkdir       = 9
+	nfs3ProcSymlink     = 10
+	nfs3ProcMknod       = 11
+	nfs3ProcRemove      = 12
+	nfs3ProcRmdir       = 13
+	nfs3ProcRename      = 14
+	nfs3ProcLink        = 15
+	nfs3ProcReaddir     = 16
+	nfs3ProcReaddirplus = 17
+	nfs3ProcFsstat      = 18
+	nfs3ProcFsinfo      = 19
+	nfs3ProcPathconf    = 20
+	nfs3ProcCommit      = 21
+
+	nfs3OK             = 0
+	nfs3ErrNoEnt       = 2
+	nfs3ErrIO          = 5
+	nfs3ErrAcces       = 13
+	nfs3ErrNotDir      = 20
+	nfs3ErrIsDir       = 21
+	nfs3ErrInval       = 22
+	nfs3ErrROFS        = 30
+	nfs3ErrNameTooLong = 63
+	nfs3ErrStale       = 70
+	nfs3ErrBadHandle   = 10001
+	nfs3ErrNotSupp     = 10004
+	nfs3ErrTooSmall    = 10005
+
+	nf3Reg  = 1
+	nf3Dir  = 2
+	nf3Blk  = 3
+	nf3Chr  = 4
+	nf3Lnk  = 5
+	nf3Sock = 6
+	nf3Fifo = 7
+
+	access3Read    = 0x01
+	access3Lookup  = 0x02
+	access3Execute = 0x20
+
+	fsf3Symlink     = 0x02
+	fsf3Homogeneous = 0x08
+
+	// maximum size of NFS file handles
+	nfs3FhSize = 64
+	// encoded size of fattr3
+	fattrSize = 84
+
+	maxNameLen   = 255
+	maxReadSize  = 1 << 20
+	maxWriteSize = 64 << 10
+)
+
+// failAttrs contains the number of empty optional attributes which follow the
+// status of a failed call of each procedure. All procedures which modify the
+// file system fail with wcc_data, which consist of pre and post operation
+// attributes of a dir or file, or post operation attributes and wcc_data for
+// LINK.
+var failAttrs = map[uint32]int{
+	nfs3ProcGetattr:     0,
+	nfs3ProcLookup:      1,
+	nfs3ProcAccess:      1,
+	nfs3ProcReadlink:    1,
+	nfs3ProcRead:        1,
+	nfs3ProcReaddir:     1,
+	nfs3ProcReaddirplus: 1,
+	nfs3ProcFsstat:      1,
+	nfs3ProcFsinfo:      1,
+	nfs3ProcPathconf:    1,
+
+	nfs3ProcSetattr: 2,
+	nfs3ProcWrite:   2,
+	nfs3ProcCreate:  2,
+	nfs3ProcMkdir:   2,
+	nfs3ProcSymlink: 2,
+	nfs3ProcMknod:   2,
+	nfs3ProcRemove:  2,
+	nfs3ProcRmdir:   2,
+	nfs3ProcRename:  4,
+	nfs3ProcLink:    3,
+	nfs3ProcCommit:  2,
+}
+
+func (s *Server) nfsProcs() map[uint32]procedure {
+	procs := map[uint32]procedure{
+		nfs3ProcGetattr:  s.nfsGetattr,
+		nfs3ProcLookup:   s.nfsLookup,
+		nfs3ProcAccess:   s.nfsAccess,
+		nfs3ProcReadlink: s.nfsReadlink,
+		nfs3ProcRead:     s.nfsRead,
+		nfs3ProcReaddir: func(args *xdrReader, res *xdrWriter) {
+			s.nfsReaddir(args, res, false)
+		},
+		nfs3ProcReaddirplus: func(args *xdrReader, res *xdrWriter) {
+			s.nfsReaddir(args, res, true)
+		},
+		nfs3ProcFsstat:   s.nfsFsstat,
+		nfs3ProcFsinfo:   s.nfsFsinfo,
+		nfs3ProcPathconf: s.nfsPathconf,
+	}
+
+	// all procedures which modify the file system fail
+	for proc, attrs := range failAttrs {
+		if _, ok := procs[proc]; !ok {
+			procs[proc] = fail(nfs3ErrROFS, attrs)
+		}
+	}
+	return procs
+}
+
+// fail returns a procedure which fails with the status st, followed by the
+// given number of empty optional attributes.
+func fail(st uint32, attrs int) procedure {
+	return func(args *xdrReader, res *xdrWriter) {
+		res.uint32(st)
+		for i := 0; i < attrs; i++ {
+			res.bool(false)
+		}
+	}
+}
+
+// nfsAuth checks the credentials of calls if access is restricted. Calls
+// without AUTH_UNIX credentials or from an unprivileged port are rejected,
+// calls of other users fail with NFS3ERR_ACCES.
+func (s *Server) nfsAuth(c caller, proc uint32) (uint32, procedure) {
+	switch {
+	case !s.restricted:
+		return authOK, nil
+	case c.cred == nil || !c.privileged:
+		return authTooWeak, nil
+	case c.cred.uid != s.uid:
+		return authOK, fail(nfs3ErrAcces, failAttrs[proc])
+	}
+	return authOK, nil
+}
+
+// status returns the NFS status for err.
+func status(err error) uint32 {
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return nfs3ErrNoEnt
+	case errors.Is(err, fs.ErrPermission):
+		return nfs3ErrAcces
+	case errors.Is(err, fs.ErrInvalid):
+		return nfs3ErrInval
+	}
+	debug.Log("returning NFS3ERR_IO for error %v", err)
+	return nfs3ErrIO
+}
+
+// lookupHandle returns the path, the id and the attributes of the file with
+// the handle fh.
+func (s *Server) lookupHandle(fh []byte) (string, uint64, fs.FileInfo, uint32) {
+	name, id, st := s.handles.path(fh)
+	if st != nfs3OK {
+		return "", 0, nil, st
+	}
+
+	fi, err := fs.Stat(s.fsys, name)
+	if errors.Is(err, fs.ErrNotExist) {
+		// the file has been removed, e.g. when a snapshot was forgotten
+		return "", 0, nil, nfs3ErrStale
+	} else if err != nil {
+		return "", 0, nil, status(err)
+	}
+	return name, id, fi, nfs3OK
+}
+
+// fileType returns the NFS type of a file with the given mode.
+func fileType(mode fs.FileMode) uint32 {
+	switch {
+	case mode.IsDir():
+		return nf3Dir
+	case mode&fs.ModeSymlink != 0:
+		return nf3Lnk
+	case mode&fs.ModeCharDevice != 0:
+		return nf3Chr
+	case mode&fs.ModeDevice != 0:
+		return nf3Blk
+	case mode&fs.ModeSocket != 0:
+		return nf3Sock
+	case mode&fs.ModeNamedPipe != 0:
+		return nf3Fifo
+	}
+	return nf3Reg
+}
+
+func writeTime(w *xdrWriter, t time.Time) {
+	sec := t.Unix()
+	switch {
+	case sec < 0:
+		w.uint32(0)
+		w.uint32(0)
+	case sec > math.MaxUint32:
+		w.uint32(math.MaxUint32)
+		w.uint32(0)
+	default:
+		w.uint32(uint32(sec))
+		w.uint32(uint32(t.Nanosecond()))
+	}
+}
+
+// writeAttr writes the attributes of a file. The owner, number of links and
+// the access and change times are only available for files with a
+// *restic.Node returned by Sys.
+func writeAttr(w *xdrWriter, id uint64, fi fs.FileInfo) {
+	mode := fi.Mode()
+	perm := uint32(mode.Perm())
+	if mode&fs.ModeSetuid != 0 {
+		perm |= 0o4000
+	}
+	if mode&fs.ModeSetgid != 0 {
+		perm |= 0o2000
+	}
+	if mode&fs.ModeSticky != 0 {
+		perm |= 0o1000
+	}
+
+	nlink := uint32(1)
+	if fi.IsDir() {
+		nlink = 2
+	}
+	var uid, gid uint32
+	size := uint64(fi.Size())
+	atime, mtime, ctime := fi.ModTime(), fi.ModTime(), fi.ModTime()
+
+	if node, ok := fi.Sys().(*restic.Node); ok && node != nil {
+		if node.Links > 0 {
+			nlink = uint32(node.Links)
+		}
+		uid, gid = node.UID, node.GID
+		if node.Type == "symlink" {
+			size = uint64(len(node.LinkTarget))
+		}
+		atime, ctime = node.AccessTime, node.ChangeTime
+	}
+
+	w.uint32(fileType(mode))
+	w.uint32(perm)
+	w.uint32(nlink)
+	w.uint32(uid)
+	w.uint32(gid)
+	w.uint64(size)
+	// used
+	w.uint64(size)
+	// rdev, device numbers are not available in a portable format
+	w.uint32(0)
+	w.uint32(0)
+	// fsid
+	w.uint64(1)
+	w.uint64(id)
+	writeTime(w, atime)
+	writeTime(w, mtime)
+	writeTime(w, ctime)
+}
+
+// writePostOpAttr writes optional attributes, which are omitted if fi is nil.
+func writePostOpAttr(w *xdrWriter, id uint64, fi fs.FileInfo) {
+	if fi == nil {
+		w.bool(false)
+		return
+	}
+	w.bool(true)
+	writeAttr(w, id, fi)
+}
+
+func (s *Server) nfsGetattr(args *xdrReader, res *xdrWriter) {
+	fh := args.opaque(nfs3FhSize)
+	if args.err != nil {
+		return
+	}
+
+	_, id, fi, st := s.lookupHandle(fh)
+	res.uint32(st)
+	if st == nfs3OK {
+		writeAttr(res, id, fi)
+	}
+}
+
+func (s *Server) nfsLookup(args *xdrReader, res *xdrWriter) {
+	fh := args.opaque(nfs3FhSize)
+	name := args.string(maxPathLen)
+	if args.err != nil {
+		return
+	}
+
+	dir, dirID, dirInfo, st := s.lookupHandle(fh)
+	switch {
+	case st != nfs3OK:
+	case !dirInfo.IsDir():
+		st = nfs3ErrNotDir
+	case len(name) > maxNameLen:
+		st = nfs3ErrNameTooLong
+	case name == "" || strings.Contains(name, "/"):
+		st = nfs3ErrNoEnt
+	}
+	if st != nfs3OK {
+		res.uint32(st)
+		writePostOpAttr(res, dirID, dirInfo)
+		return
+	}
+
+	child := joinPath(dir, name)
+	fi, err := fs.Stat(s.fsys, child)
+	if err != nil {
+		res.uint32(status(err))
+		writePostOpAttr(res, dirID, dirInfo)
+		return
+	}
+
+	childFh, id := s.handles.handle(child)
+	res.uint32(nfs3OK)
+	res.opaque(childFh)
+	writePostOpAttr(res, id, fi)
+	writePostOpAttr(res, dirID, dirInfo)
+}
+
+// nfsAccess allows to read all files and dirs, execute permission is granted
+// for dirs and files with any execute bit set.
+func (s *Server) nfsAccess(args *xdrReader, res *xdrWriter) {
+	fh := args.opaque(nfs3FhSize)
+	access := args.uint32()
+	if args.err != nil {
+		return
+	}
+
+	_, id, fi, st := s.lookupHandle(fh)
+	res.uint32(st)
+	writePostOpAttr(res, id, fi)
+	if st != nfs3OK {
+		return
+	}
+
+	allowed := uint32(access3Read | access3Lookup)
+	if fi.IsDir() || fi.Mode()&0o111 != 0 {
+		allowed |= access3Execute
+	}
+	res.uint32(access & allowed)
+}
+
+func (s *Server) nfsReadlink(args *xdrReader, res *xdrWriter) {
+	fh := args.opaque(nfs3FhSize)
+	if args.err != nil {
+		return
+	}
+
+	name, id, fi, st := s.lookupHandle(fh)
+	rl, ok := s.fsys.(ReadLinkFS)
+	switch {
+	case st != nfs3OK:
+	case fi.Mode()&fs.ModeSymlink == 0:
+		st = nfs3ErrInval
+	case !ok:
+		st = nfs3ErrNotSupp
+	}
+	if st != nfs3OK {
+		res.uint32(st)
+		writePostOpAttr(res, id, fi)
+		return
+	}
+
+	target, err := rl.ReadLink(name)
+	if err != nil {
+		res.uint32(status(err))
+		writePostOpAttr(res, id, fi)
+		return
+	}
+
+	res.uint32(nfs3OK)
+	writePostOpAttr(res, id, fi)
+	res.string(target)
+}
+
+func (s *Server) nfsRead(args *xdrReader, res *xdrWriter) {
+	fh := args.opaque(nfs3FhSize)
+	offset := args.uint64()
+	count := args.uint32()
+	if args.err != nil {
+		return
+	}
+
+	name, id, fi, st := s.lookupHandle(fh)
+	switch {
+	case st != nfs3OK:
+	case fi.IsDir():
+		st = nfs3ErrIsDir
+	case !fi.Mode().IsRegular():
+		st = nfs3ErrInval
+	}
+	if st != nfs3OK {
+		res.uint32(st)
+		writePostOpAttr(res, id, fi)
+		return
+	}
+
+	f, err := s.open(id, name)
+	if err != nil {
+		res.uint32(status(err))
+		writePostOpAttr(res, id, fi)
+		return
+	}
+	defer s.done(f)
+
+	// the size of an opened file may be more accurate
+	if info, err := f.Stat(); err == nil {
+		fi = info
+	}
+
+	ra, ok := f.File.(io.ReaderAt)
+	if !ok {
+		debug.Log("file %v does not implement io.ReaderAt", name)
+		res.uint32(nfs3ErrIO)
+		writePostOpAttr(res, id, fi)
+		return
+	}
+
+	if count > maxReadSize {
+		count = maxReadSize
+	}
+	var n int
+	buf := make([]byte, count)
+	if offset < uint64(fi.Size()) {
+		n, err = ra.ReadAt(buf, int64(offset))
+		if err != nil && err != io.EOF {
+			res.uint32(status(err))
+			writePostOpAttr(res, id, fi)
+			return
+		}
+	}
+
+	res.uint32(nfs3OK)
+	writePostOpAttr(res, id, fi)
+	res.uint32(uint32(n))
+	res.bool(offset+uint64(n) >= uint64(fi.Size()))
+	res.opaque(buf[:n])
+}
+
+type dirEntry struct {
+	name string
+	path string
+	info fs.FileInfo
+}
+
+// dirEntries returns the entries of the dir name, including "." and "..".
+func (s *Server) dirEntries(name string, fi fs.FileInfo) ([]dirEntry, error) {
+	parent := joinPath(name, "..")
+	parentInfo, err := fs.Stat(s.fsys, parent)
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := fs.ReadDir(s.fsys, name)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]dirEntry, 0, len(list)+2)
+	entries = append(entries,
+		dirEntry{name: ".", path: name, info: fi},
+		dirEntry{name: "..", path: parent, info: parentInfo},
+	)
+	for _, e := range list {
+		info, err := e.Info()
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, dirEntry{name: e.Name(), path: joinPath(name, e.Name()), info: info})
+	}
+	return entries, nil
+}
+
+// nfsReaddir handles READDIR and, if plus is set, READDIRPLUS which also
+// returns the attributes and handles of the entries. The cookie of an entry
+// is its index in the dir plus one, the cookie verifier is not used.
+func (s *Server) nfsReaddir(args *xdrReader, res *xdrWriter, plus bool) {
+	fh := args.opaque(nfs3FhSize)
+	cookie := args.uint64()
+	_ = args.fixed(8)
+	dirCount := args.uint32()
+	maxCount := dirCount
+	if plus {
+		maxCount = args.uint32()
+	}
+	if args.err != nil {
+		return
+	}
+
+	name, id, fi, st := s.lookupHandle(fh)
+	if st == nfs3OK && !fi.IsDir() {
+		st = nfs3ErrNotDir
+	}
+	if st != nfs3OK {
+		res.uint32(st)
+		writePostOpAttr(res, id, fi)
+		return
+	}
+
+	entries, err := s.dirEntries(name, fi)
+	if err != nil {
+		res.uint32(status(err))
+		writePostOpAttr(res, id, fi)
+		return
+	}
+
+	body := &xdrWriter{}
+	writePostOpAttr(body, id, fi)
+	// cookie verifier
+	body.fixed(make([]byte, 8))
+
+	start := len(entries)
+	if cookie < uint64(len(entries)) {
+		start = int(cookie)
+	}
+
+	// status, end of the list and eof
+	size := 4 + len(body.buf) + 8
+	dirSize := 0
+	i := start
+	for ; i < len(entries); i++ {
+		e := entries[i]
+		// value follows, file id, name and cookie
+		entrySize := 4 + 8 + 4 + pad(len(e.name)) + 8
+		dirSize += entrySize
+		if plus {
+			// attributes and handle
+			entrySize += 4 + fattrSize + 4 + 4 + handleSize
+		}
+		size += entrySize
+		if size > int(maxCount) || dirSize > int(dirCount) {
+			break
+		}
+
+		entryFh, entryID := s.handles.handle(e.path)
+		body.bool(true)
+		body.uint64(entryID)
+		body.string(e.name)
+		body.uint64(uint64(i + 1))
+		if plus {
+			writePostOpAttr(body, entryID, e.info)
+			body.bool(true)
+			body.opaque(entryFh)
+		}
+	}
+
+	if i == start && i < len(entries) {
+		res.uint32(nfs3ErrTooSmall)
+		writePostOpAttr(res, id, fi)
+		return
+	}
+
+	body.bool(false)
+	body.bool(i == len(entries))
+	res.uint32(nfs3OK)
+	res.buf = append(res.buf, body.buf...)
+}
+
+func (s *Server) nfsFsstat(args *xdrReader, res *xdrWriter) {
+	fh := args.opaque(nfs3FhSize)
+	if args.err != nil {
+		return
+	}
+
+	_, id, fi, st := s.lookupHandle(fh)
+	res.uint32(st)
+	writePostOpAttr(res, id, fi)
+	if st != nfs3OK {
+		return
+	}
+
+	// total, free and available bytes and files, the file system is
+	// read-only and thus also the number of seconds for which this is valid
+	for i := 0; i < 6; i++ {
+		res.uint64(0)
+	}
+	res.uint32(math.MaxUint32)
+}
+
+func (s *Server) nfsFsinfo(args *xdrReader, res *xdrWriter) {
+	fh := args.opaque(nfs3FhSize)
+	if args.err != nil {
+		return
+	}
+
+	_, id, fi, st := s.lookupHandle(fh)
+	res.uint32(st)
+	writePostOpAttr(res, id, fi)
+	if st != nfs3OK {
+		return
+	}
+
+	// maximum, preferred and multiple of the size of reads, writes and
+	// dir listings
+	res.uint32(maxReadSize)
+	res.uint32(maxReadSize)
+	res.uint32(4096)
+	res.uint32(maxWriteSize)
+	res.uint32(maxWriteSize)
+	res.uint32(4096)
+	res.uint32(maxWriteSize)
+	// maximum file size
+	res.uint64(math.MaxInt64)
+	// time delta
+	res.uint32(0)
+	res.uint32(1)
+	res.uint32(fsf3Symlink | fsf3Homogeneous)
+}
+
+func (s *Server) nfsPathconf(args *xdrReader, res *xdrWriter) {
+	fh := args.opaque(nfs3FhSize)
+	if args.err != nil {
+		return
+	}
+
+	_, id, fi, st := s.lookupHandle(fh)
+	res.uint32(st)
+	writePostOpAttr(res, id, fi)
+	if st != nfs3OK {
+		return
+	}
+
+	// maximum number of links and length of names
+	res.uint32(math.MaxUint32)
+	res.uint32(maxNameLen)
+	// no_trunc, chown_restricted, case_insensitive, case_preserving
+	res.bool(true)
+	res.bool(true)
+	res.bool(false)
+	res.bool(true)
+}
@@ -0,0 +1,275 @@
+package nfs
+
+import (
+	"encoding/binary"
+	"io"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+)
+
+// ONC RPC version 2 as described in RFC 5531.
+const (
+	rpcVersion = 2
+
+	msgCall  = 0
+	msgReply = 1
+
+	replyAccepted = 0
+	replyDenied   = 1
+
+	acceptSuccess      = 0
+	acceptProgUnavail  = 1
+	acceptProgMismatch = 2
+	acceptProcUnavail  = 3
+	acceptGarbageArgs  = 4
+
+	rejectRPCMismatch = 0
+	rejectAuthError   = 1
+
+	authNone = 0
+	authUnix = 1
+
+	// auth_stat of rejected calls
+	authOK      = 0
+	authBadCred = 1
+	authTooWeak = 5
+
+	// maximum length of credentials and verifiers
+	maxAuthLen = 400
+	// limits of AUTH_UNIX credentials
+	maxMachineNameLen = 255
+	maxGids           = 16
+)
+
+// lastFragment is set in the header of the last fragment of a record.
+const lastFragment = 1 << 31
+
+// maxRecordSize is the maximum size of an RPC call. Calls are small, except
+// for WRITE which is rejected anyway.
+const maxRecordSize = 2 * maxWriteSize
+
+// readRecord reads a record of at most maxSize bytes, sent with the record
+// marking standard for RPC over TCP.
+func readRecord(rd io.Reader, maxSize int) ([]byte, error) {
+	var rec []byte
+	for {
+		var hdr [4]byte
+		_, err := io.ReadFull(rd, hdr[:])
+		if err != nil {
+			return nil, err
+		}
+
+		h := binary.BigEndian.Uint32(hdr[:])
+		size := int(h &^ lastFragment)
+		if len(rec)+size > maxSize {
+			return nil, errors.Errorf("record too large (%d bytes)", len(rec)+size)
+		}
+
+		start := len(rec)
+		rec = append(rec, make([]byte, size)...)
+		_, err = io.ReadFull(rd, rec[start:])
+		if err != nil {
+			return nil, err
+		}
+
+		if h&lastFragment != 0 {
+			return rec, nil
+		}
+	}
+}
+
+// writeRecord writes data as a single fragment.
+func writeRecord(wr io.Writer, data []byte) error {
+	buf := make([]byte, 4, 4+len(data))
+	binary.BigEndian.PutUint32(buf, lastFragment|uint32(len(data)))
+	buf = append(buf, data...)
+	_, err := wr.Write(buf)
+	return err
+}
+
+// procedure handles a call of a remote procedure. It decodes its arguments
+// from args and then encodes the results to res. If args.err is set after
+// the call, the arguments were invalid and res is discarded.
+type procedure func(args *xdrReader, res *xdrWriter)
+
+// unixCred contains the AUTH_UNIX credentials of a call, see appendix A of
+// RFC 5531. They are not verified in any way, the client may send arbitrary
+// values.
+type unixCred struct {
+	stamp       uint32
+	machineName string
+	uid, gid    uint32
+	gids        []uint32
+}
+
+// parseUnixCred decodes the body of AUTH_UNIX credentials.
+func parseUnixCred(body []byte) (*unixCred, error) {
+	r := &xdrReader{buf: body}
+	cred := &unixCred{
+		stamp:       r.uint32(),
+		machineName: r.string(maxMachineNameLen),
+		uid:         r.uint32(),
+		gid:         r.uint32(),
+	}
+
+	n := r.uint32()
+	if r.err == nil && n > maxGids {
+		r.err = errGarbage
+	}
+	for i := uint32(0); i < n && r.err == nil; i++ {
+		cred.gids = append(cred.gids, r.uint32())
+	}
+	if r.err == nil && len(r.buf) != 0 {
+		r.err = errGarbage
+	}
+
+	if r.err != nil {
+		return nil, r.err
+	}
+	return cred, nil
+}
+
+// caller describes the client which sent a call.
+type caller struct {
+	// privileged is set for calls sent from a port below 1024, which
+	// usually only root can use
+	privileged bool
+	// cred is nil unless the call has AUTH_UNIX credentials
+	cred *unixCred
+}
+
+// program is a version of an RPC program. Procedure 0 must not be included,
+// it does nothing in all programs.
+type program struct {
+	prog, vers uint32
+	procs      map[uint32]procedure
+
+	// auth is called for all procedures except 0 if set. It returns the
+	// auth_stat to reject the call with, or authOK and optionally a
+	// procedure to call instead of proc, for example to deny access.
+	auth func(c caller, proc uint32) (uint32, procedure)
+}
+
+// handleCall returns the reply for the RPC call in rec, or nil if rec is not
+// a call. The call was sent from a privileged port if privileged is set.
+func handleCall(progs []program, privileged bool, rec []byte) []byte {
+	r := &xdrReader{buf: rec}
+	xid := r.uint32()
+	if r.uint32() != msgCall || r.err != nil {
+		debug.Log("ignoring message %v which is not a call", xid)
+		return nil
+	}
+
+	w := &xdrWriter{}
+	w.uint32(xid)
+	w.uint32(msgReply)
+
+	if r.uint32() != rpcVersion {
+		w.uint32(replyDenied)
+		w.uint32(rejectRPCMismatch)
+		w.uint32(rpcVersion)
+		w.uint32(rpcVersion)
+		return w.buf
+	}
+
+	prog, vers, proc := r.uint32(), r.uint32(), r.uint32()
+	flavor := r.uint32()
+	cred := r.opaque(maxAuthLen)
+	// the verifier is ignored, AUTH_UNIX does not use it
+	_ = r.uint32()
+	_ = r.opaque(maxAuthLen)
+
+	// accept writes the header of an accepted reply
+	accept := func(stat uint32) []byte {
+		w.uint32(replyAccepted)
+		w.uint32(authNone)
+		w.opaque(nil)
+		w.uint32(stat)
+		return w.buf
+	}
+
+	if r.err != nil {
+		return accept(acceptGarbageArgs)
+	}
+
+	found := false
+	low, high := ^uint32(0), uint32(0)
+	var p program
+	for _, candidate := range progs {
+		if candidate.prog != prog {
+			continue
+		}
+		found = true
+		if candidate.vers < low {
+			low = candidate.vers
+		}
+		if candidate.vers > high {
+			high = candidate.vers
+		}
+		if candidate.vers == vers {
+			p = candidate
+		}
+	}
+
+	switch {
+	case !found:
+		debug.Log("call %v for unknown program %v", xid, prog)
+		return accept(acceptProgUnavail)
+	case p.procs == nil:
+		debug.Log("call %v for unsupported version %v of program %v", xid, vers, prog)
+		accept(acceptProgMismatch)
+		w.uint32(low)
+		w.uint32(high)
+		return w.buf
+	}
+
+	if proc == 0 {
+		return accept(acceptSuccess)
+	}
+
+	fn, ok := p.procs[proc]
+	if !ok {
+		debug.Log("call %v for unknown procedure %v of program %v", xid, proc, prog)
+		return accept(acceptProcUnavail)
+	}
+
+	if p.auth != nil {
+		c := caller{privileged: privileged}
+		stat := uint32(authOK)
+		if flavor == authUnix {
+			var err error
+			c.cred, err = parseUnixCred(cred)
+			if err != nil {
+				stat = authBadCred
+			}
+		}
+
+		var denied procedure
+		if stat == authOK {
+			stat, denied = p.auth(c, proc)
+		}
+		if stat != authOK {
+			debug.Log("rejecting call %v for procedure %v of program %v with auth_stat %v", xid, proc, prog, stat)
+			w.uint32(replyDenied)
+			w.uint32(rejectAuthError)
+			w.uint32(stat)
+			return w.buf
+		}
+		if denied != nil {
+			debug.Log("denying call %v for procedure %v of program %v", xid, proc, prog)
+			fn = denied
+		}
+	}
+
+	res := &xdrWriter{}
+	fn(r, res)
+	if r.err != nil {
+		debug.Log("call %v for procedure %v of program %v has invalid arguments", xid, proc, prog)
+		return accept(acceptGarbageArgs)
+	}
+
+	accept(acceptSuccess)
+	w.buf = append(w.buf, res.buf...)
+	return w.buf
+}
@@ -0,0 +1,265 @@
+// Package nfs implements a read-only NFS version 3 server for an fs.FS.
+//
+// The server offers the NFS and MOUNT programs on the same TCP port and does
+// not register with a portmapper, thus clients need to be told the port for
+// both, for example with the mount options "port=N,mountport=N" on Linux.
+package nfs
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"io"
+	"io/fs"
+	"net"
+	"sync"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+
+	"github.com/hashicorp/golang-lru/v2/simplelru"
+)
+
+// maximum number of calls per connection which are handled concurrently
+const maxConcurrentCalls = 16
+
+// number of files which are kept open for reading
+const openFiles = 64
+
+// ReadLinkFS is implemented by file systems which contain symlinks. Stat and
+// ReadDir of such a file system must not follow symlinks.
+type ReadLinkFS interface {
+	fs.FS
+	ReadLink(name string) (string, error)
+}
+
+// Server exports an fs.FS via NFS. The files returned by Open must implement
+// io.ReaderAt, dirs must implement fs.ReadDirFile.
+type Server struct {
+	fsys    fs.FS
+	handles *handleTable
+
+	m     sync.Mutex
+	files *simplelru.LRU[uint64, *openFile]
+	// mounted is set after the first successful MNT call for export
+	mounted bool
+
+	// if export is set, the root dir can only be mounted once via this path
+	export string
+
+	progs []program
+
+	// only calls with the credentials of uid are permitted if restricted
+	// is set
+	restricted bool
+	uid        uint32
+}
+
+// NewServer returns a server for fsys.
+func NewServer(fsys fs.FS) *Server {
+	s := &Server{
+		fsys:    fsys,
+		handles: newHandleTable(),
+	}
+
+	files, err := simplelru.NewLRU(openFiles, func(id uint64, f *openFile) {
+		// called with s.m locked
+		f.evicted = true
+		f.release()
+	})
+	if err != nil {
+		panic(err)
+	}
+	s.files = files
+
+	s.progs = []program{
+		{prog: mountProg, vers: mountVersion, procs: s.mountProcs(), auth: s.mountAuth},
+		{prog: nfsProg, vers: nfsVersion, procs: s.nfsProcs(), auth: s.nfsAuth},
+	}
+	return s
+}
+
+// RestrictAccess only permits calls with the AUTH_UNIX credentials of the
+// user uid. NFS calls must also be sent from a privileged port, which the NFS
+// clients in the kernels of macOS and Linux use with the "resvport" mount
+// option. Calls of the MOUNT program are sent by the mount command, which
+// usually does not run as root. RestrictAccess must be called before Serve.
+//
+// The credentials are chosen by the client and some systems permit all users
+// to bind privileged ports, thus this does not keep other local users out.
+// Use ExportOnce for that.
+func (s *Server) RestrictAccess(uid uint32) {
+	s.restricted = true
+	s.uid = uid
+}
+
+// ExportOnce makes the root dir available only via a random export path,
+// which is returned. The first MNT call for this path succeeds, all other MNT
+// calls fail. As file handles contain a random number which is only known
+// to the server and the client which mounted the root dir, no other client
+// can access files afterwards. ExportOnce must be called before Serve.
+func (s *Server) ExportOnce() string {
+	var buf [16]byte
+	_, err := rand.Read(buf[:])
+	if err != nil {
+		panic(err)
+	}
+	s.export = "/" + hex.EncodeToString(buf[:])
+	return s.export
+}
+
+// mountOnce reports whether the MNT call for dirpath is the first one for the
+// export path of ExportOnce.
+func (s *Server) mountOnce(dirpath string) bool {
+	s.m.Lock()
+	defer s.m.Unlock()
+	if s.mounted || subtle.ConstantTimeCompare([]byte(dirpath), []byte(s.export)) != 1 {
+		return false
+	}
+	s.mounted = true
+	return true
+}
+
+// Serve accepts connections on l and handles the calls of the clients. It
+// returns when ctx is cancelled or l fails.
+func (s *Server) Serve(ctx context.Context, l net.Listener) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	go func() {
+		<-ctx.Done()
+		_ = l.Close()
+	}()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return errors.Wrap(err, "Accept")
+		}
+
+		debug.Log("new connection from %v", conn.RemoteAddr())
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.serveConn(ctx, conn)
+		}()
+	}
+}
+
+func (s *Server) serveConn(ctx context.Context, conn net.Conn) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	go func() {
+		<-ctx.Done()
+		_ = conn.Close()
+	}()
+
+	var (
+		wg  sync.WaitGroup
+		wm  sync.Mutex
+		sem = make(chan struct{}, maxConcurrentCalls)
+	)
+	defer wg.Wait()
+
+	privileged := false
+	if addr, ok := conn.RemoteAddr().(*net.TCPAddr); ok {
+		privileged = addr.Port < 1024
+	}
+
+	rd := bufio.NewReader(conn)
+	for {
+		rec, err := readRecord(rd, maxRecordSize)
+		if err != nil {
+			if err != io.EOF && ctx.Err() == nil {
+				debug.Log("connection from %v failed: %v", conn.RemoteAddr(), err)
+			}
+			return
+		}
+
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			reply := handleCall(s.progs, privileged, rec)
+			if reply == nil {
+				return
+			}
+
+			wm.Lock()
+			err := writeRecord(conn, reply)
+			wm.Unlock()
+			if err != nil {
+				debug.Log("sending reply to %v failed: %v", conn.RemoteAddr(), err)
+				cancel()
+			}
+		}()
+	}
+}
+
+// openFile is a file which is kept open for reading. It is closed after it
+// has been evicted from the cache and all reads have finished.
+type openFile struct {
+	fs.File
+	refs    int
+	evicted bool
+}
+
+// release must be called with Server.m locked.
+func (f *openFile) release() {
+	if f.evicted && f.refs == 0 {
+		_ = f.Close()
+	}
+}
+
+// open returns the file with the handle id and path name, which is kept open
+// for later reads. The file must be passed to done afterwards.
+func (s *Server) open(id uint64, name string) (*openFile, error) {
+	s.m.Lock()
+	f, ok := s.files.Get(id)
+	if ok {
+		f.refs++
+	}
+	s.m.Unlock()
+	if ok {
+		return f, nil
+	}
+
+	file, err := s.fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+	f, ok = s.files.Get(id)
+	if ok {
+		// opened concurrently
+		_ = file.Close()
+	} else {
+		f = &openFile{File: file}
+		s.files.Add(id, f)
+	}
+	f.refs++
+	return f, nil
+}
+
+// done releases a file returned by open.
+func (s *Server) done(f *openFile) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	f.refs--
+	f.release()
+}
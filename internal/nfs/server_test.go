@@ -0,0 +1,475 @@
+package nfs
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"sort"
+	"sync"
+	"testing"
+	"testing/fstest"
+
+	rtest "github.com/restic/restic/internal/test"
+)
+
+type testClient struct {
+	t    testing.TB
+	conn net.Conn
+	rd   *bufio.Reader
+	xid  uint32
+
+	// cred is sent as AUTH_UNIX credentials if set
+	cred *unixCred
+}
+
+func newTestClient(t testing.TB, fsys fstest.MapFS) *testClient {
+	return dialTestServer(t, NewServer(fsys))
+}
+
+// dialTestServer runs srv and returns a client connected to it.
+func dialTestServer(t testing.TB, srv *Server) *testClient {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	rtest.OK(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		rtest.OK(t, srv.Serve(ctx, l))
+	}()
+	t.Cleanup(func() {
+		cancel()
+		wg.Wait()
+	})
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	rtest.OK(t, err)
+	t.Cleanup(func() {
+		_ = conn.Close()
+	})
+	return &testClient{t: t, conn: conn, rd: bufio.NewReader(conn)}
+}
+
+// encodeUnixCred returns the body of AUTH_UNIX credentials.
+func encodeUnixCred(cred *unixCred) []byte {
+	w := &xdrWriter{}
+	w.uint32(cred.stamp)
+	w.string(cred.machineName)
+	w.uint32(cred.uid)
+	w.uint32(cred.gid)
+	w.uint32(uint32(len(cred.gids)))
+	for _, gid := range cred.gids {
+		w.uint32(gid)
+	}
+	return w.buf
+}
+
+// callRecord returns the record of a call with the credentials cred.
+func callRecord(xid, prog, vers, proc uint32, cred *unixCred, args func(w *xdrWriter)) []byte {
+	w := &xdrWriter{}
+	w.uint32(xid)
+	w.uint32(msgCall)
+	w.uint32(rpcVersion)
+	w.uint32(prog)
+	w.uint32(vers)
+	w.uint32(proc)
+	if cred != nil {
+		w.uint32(authUnix)
+		w.opaque(encodeUnixCred(cred))
+	} else {
+		w.uint32(authNone)
+		w.opaque(nil)
+	}
+	w.uint32(authNone)
+	w.opaque(nil)
+	if args != nil {
+		args(w)
+	}
+	return w.buf
+}
+
+// rawCall calls a procedure and returns the reply after the message type.
+func (c *testClient) rawCall(prog, vers, proc uint32, args func(w *xdrWriter)) *xdrReader {
+	c.xid++
+	rtest.OK(c.t, writeRecord(c.conn, callRecord(c.xid, prog, vers, proc, c.cred, args)))
+
+	rec, err := readRecord(c.rd, 2*maxReadSize)
+	rtest.OK(c.t, err)
+	r := &xdrReader{buf: rec}
+	rtest.Equals(c.t, c.xid, r.uint32())
+	rtest.Equals(c.t, uint32(msgReply), r.uint32())
+	return r
+}
+
+// call calls a procedure and returns its accept status and results.
+func (c *testClient) call(prog, vers, proc uint32, args func(w *xdrWriter)) (uint32, *xdrReader) {
+	r := c.rawCall(prog, vers, proc, args)
+	rtest.Equals(c.t, uint32(replyAccepted), r.uint32())
+	return readAccepted(c.t, r)
+}
+
+// readAccepted decodes the verifier of an accepted reply and returns the
+// accept status.
+func readAccepted(t testing.TB, r *xdrReader) (uint32, *xdrReader) {
+	_ = r.uint32()
+	_ = r.opaque(maxAuthLen)
+	stat := r.uint32()
+	rtest.OK(t, r.err)
+	return stat, r
+}
+
+// rejected calls a procedure and returns the auth_stat it was rejected with.
+func (c *testClient) rejected(prog, vers, proc uint32, args func(w *xdrWriter)) uint32 {
+	r := c.rawCall(prog, vers, proc, args)
+	rtest.Equals(c.t, uint32(replyDenied), r.uint32())
+	rtest.Equals(c.t, uint32(rejectAuthError), r.uint32())
+	stat := r.uint32()
+	rtest.OK(c.t, r.err)
+	return stat
+}
+
+// nfs calls an NFS procedure and returns its status and results.
+func (c *testClient) nfs(proc uint32, args func(w *xdrWriter)) (uint32, *xdrReader) {
+	stat, r := c.call(nfsProg, nfsVersion, proc, args)
+	rtest.Equals(c.t, uint32(acceptSuccess), stat)
+	return r.uint32(), r
+}
+
+func (c *testClient) mount(dirpath string) (uint32, []byte) {
+	stat, r := c.call(mountProg, mountVersion, mountProcMnt, func(w *xdrWriter) {
+		w.string(dirpath)
+	})
+	rtest.Equals(c.t, uint32(acceptSuccess), stat)
+	st := r.uint32()
+	if st != mnt3OK {
+		return st, nil
+	}
+	return st, r.opaque(nfs3FhSize)
+}
+
+func (c *testClient) lookup(dir []byte, name string) (uint32, []byte) {
+	st, r := c.nfs(nfs3ProcLookup, func(w *xdrWriter) {
+		w.opaque(dir)
+		w.string(name)
+	})
+	if st != nfs3OK {
+		return st, nil
+	}
+	return st, r.opaque(nfs3FhSize)
+}
+
+// readAttr decodes fattr3 and returns the type, mode, size and file id.
+func readAttr(r *xdrReader) (typ, mode uint32, size, fileid uint64) {
+	typ = r.uint32()
+	mode = r.uint32()
+	_ = r.next(12)
+	size = r.uint64()
+	_ = r.next(24)
+	fileid = r.uint64()
+	_ = r.next(24)
+	return typ, mode, size, fileid
+}
+
+// readDirNames lists the dir with READDIR calls of the given size.
+func (c *testClient) readDirNames(dir []byte, count uint32) []string {
+	var names []string
+	var cookie uint64
+	for {
+		st, r := c.nfs(nfs3ProcReaddir, func(w *xdrWriter) {
+			w.opaque(dir)
+			w.uint64(cookie)
+			w.fixed(make([]byte, 8))
+			w.uint32(count)
+		})
+		rtest.Equals(c.t, uint32(nfs3OK), st)
+		if r.bool() {
+			_, _, _, _ = readAttr(r)
+		}
+		_ = r.fixed(8)
+		for r.bool() {
+			_ = r.uint64()
+			names = append(names, r.string(maxNameLen))
+			cookie = r.uint64()
+		}
+		eof := r.bool()
+		rtest.OK(c.t, r.err)
+		if eof {
+			return names
+		}
+	}
+}
+
+func TestServer(t *testing.T) {
+	fsys := fstest.MapFS{
+		"dir/file":  {Data: []byte("hello world"), Mode: 0644},
+		"dir/sub/x": {Data: []byte{}, Mode: 0600},
+		"top":       {Data: []byte("abc"), Mode: 0755},
+	}
+	for i := 0; i < 50; i++ {
+		fsys["many/"+string(rune('a'+i%26))+string(rune('a'+i/26))] = &fstest.MapFile{}
+	}
+	c := newTestClient(t, fsys)
+
+	st, root := c.mount("/")
+	rtest.Equals(t, uint32(mnt3OK), st)
+	st, _ = c.mount("/top")
+	rtest.Equals(t, uint32(mnt3ErrNotDir), st)
+	st, _ = c.mount("/missing")
+	rtest.Equals(t, uint32(mnt3ErrNoEnt), st)
+	st, sub := c.mount("/dir/sub")
+	rtest.Equals(t, uint32(mnt3OK), st)
+
+	st, dir := c.lookup(root, "dir")
+	rtest.Equals(t, uint32(nfs3OK), st)
+	st, file := c.lookup(dir, "file")
+	rtest.Equals(t, uint32(nfs3OK), st)
+	st, _ = c.lookup(dir, "missing")
+	rtest.Equals(t, uint32(nfs3ErrNoEnt), st)
+	st, _ = c.lookup(file, "foo")
+	rtest.Equals(t, uint32(nfs3ErrNotDir), st)
+	st, parent := c.lookup(sub, "..")
+	rtest.Equals(t, uint32(nfs3OK), st)
+	rtest.Equals(t, dir, parent)
+
+	st, r := c.nfs(nfs3ProcGetattr, func(w *xdrWriter) { w.opaque(file) })
+	rtest.Equals(t, uint32(nfs3OK), st)
+	typ, mode, size, _ := readAttr(r)
+	rtest.Equals(t, uint32(nf3Reg), typ)
+	rtest.Equals(t, uint32(0644), mode)
+	rtest.Equals(t, uint64(11), size)
+
+	st, r = c.nfs(nfs3ProcRead, func(w *xdrWriter) {
+		w.opaque(file)
+		w.uint64(6)
+		w.uint32(100)
+	})
+	rtest.Equals(t, uint32(nfs3OK), st)
+	rtest.Assert(t, r.bool(), "no attributes returned by READ")
+	_, _, _, _ = readAttr(r)
+	rtest.Equals(t, uint32(5), r.uint32())
+	rtest.Assert(t, r.bool(), "eof not set")
+	rtest.Equals(t, "world", string(r.opaque(maxReadSize)))
+
+	st, _ = c.nfs(nfs3ProcRead, func(w *xdrWriter) {
+		w.opaque(dir)
+		w.uint64(0)
+		w.uint32(100)
+	})
+	rtest.Equals(t, uint32(nfs3ErrIsDir), st)
+
+	// READDIRPLUS returns handles which can be used directly
+	st, r = c.nfs(nfs3ProcReaddirplus, func(w *xdrWriter) {
+		w.opaque(dir)
+		w.uint64(0)
+		w.fixed(make([]byte, 8))
+		w.uint32(4096)
+		w.uint32(65536)
+	})
+	rtest.Equals(t, uint32(nfs3OK), st)
+	rtest.Assert(t, r.bool(), "no dir attributes")
+	_, _, _, _ = readAttr(r)
+	_ = r.fixed(8)
+	handles := make(map[string][]byte)
+	var names []string
+	for r.bool() {
+		_ = r.uint64()
+		name := r.string(maxNameLen)
+		_ = r.uint64()
+		rtest.Assert(t, r.bool(), "no attributes for %v", name)
+		_, _, _, _ = readAttr(r)
+		rtest.Assert(t, r.bool(), "no handle for %v", name)
+		handles[name] = r.opaque(nfs3FhSize)
+		names = append(names, name)
+	}
+	rtest.Assert(t, r.bool(), "eof not set")
+	rtest.OK(t, r.err)
+	rtest.Equals(t, []string{".", "..", "file", "sub"}, names)
+	rtest.Equals(t, file, handles["file"])
+	rtest.Equals(t, root, handles[".."])
+
+	// small READDIR calls need several calls to list all entries
+	st, many := c.lookup(root, "many")
+	rtest.Equals(t, uint32(nfs3OK), st)
+	names = c.readDirNames(many, 300)
+	rtest.Equals(t, 52, len(names))
+	rtest.Assert(t, sort.StringsAreSorted(names[2:]), "names are not sorted: %v", names)
+	rtest.Equals(t, names, c.readDirNames(many, 65536))
+
+	st, _ = c.nfs(nfs3ProcReaddir, func(w *xdrWriter) {
+		w.opaque(many)
+		w.uint64(0)
+		w.fixed(make([]byte, 8))
+		w.uint32(100)
+	})
+	rtest.Equals(t, uint32(nfs3ErrTooSmall), st)
+
+	st, r = c.nfs(nfs3ProcAccess, func(w *xdrWriter) {
+		w.opaque(file)
+		w.uint32(0x3f)
+	})
+	rtest.Equals(t, uint32(nfs3OK), st)
+	rtest.Assert(t, r.bool(), "no attributes returned by ACCESS")
+	_, _, _, _ = readAttr(r)
+	rtest.Equals(t, uint32(access3Read|access3Lookup), r.uint32())
+
+	st, _ = c.nfs(nfs3ProcWrite, func(w *xdrWriter) {
+		w.opaque(file)
+		w.uint64(0)
+		w.uint32(3)
+		w.uint32(0)
+		w.opaque([]byte("foo"))
+	})
+	rtest.Equals(t, uint32(nfs3ErrROFS), st)
+
+	st, _ = c.nfs(nfs3ProcGetattr, func(w *xdrWriter) { w.opaque([]byte("foo")) })
+	rtest.Equals(t, uint32(nfs3ErrBadHandle), st)
+	stale := append([]byte{}, file...)
+	stale[0]++
+	st, _ = c.nfs(nfs3ProcGetattr, func(w *xdrWriter) { w.opaque(stale) })
+	rtest.Equals(t, uint32(nfs3ErrStale), st)
+
+	stat, _ := c.call(nfsProg, 4, nfs3ProcGetattr, nil)
+	rtest.Equals(t, uint32(acceptProgMismatch), stat)
+	stat, _ = c.call(100000, 2, 0, nil)
+	rtest.Equals(t, uint32(acceptProgUnavail), stat)
+	stat, _ = c.call(nfsProg, nfsVersion, nfs3ProcGetattr, nil)
+	rtest.Equals(t, uint32(acceptGarbageArgs), stat)
+}
+
+func TestParseUnixCred(t *testing.T) {
+	cred := &unixCred{stamp: 42, machineName: "host", uid: 501, gid: 20, gids: []uint32{12, 61, 79}}
+	parsed, err := parseUnixCred(encodeUnixCred(cred))
+	rtest.OK(t, err)
+	rtest.Equals(t, cred, parsed)
+
+	invalid := [][]byte{
+		nil,
+		encodeUnixCred(&unixCred{gids: make([]uint32, maxGids+1)}),
+		append(encodeUnixCred(cred), 0, 0, 0, 0),
+		encodeUnixCred(cred)[:20],
+	}
+	for _, body := range invalid {
+		_, err := parseUnixCred(body)
+		rtest.Assert(t, err != nil, "missing error for %v", body)
+	}
+}
+
+func TestServerRestrictAccess(t *testing.T) {
+	fsys := fstest.MapFS{
+		"dir/file": {Data: []byte("hello world"), Mode: 0644},
+	}
+	srv := NewServer(fsys)
+	srv.RestrictAccess(501)
+
+	// the test client uses an unprivileged port, which suffices for MOUNT
+	c := dialTestServer(t, srv)
+	stat, _ := c.call(mountProg, mountVersion, 0, nil)
+	rtest.Equals(t, uint32(acceptSuccess), stat)
+	rtest.Equals(t, uint32(authTooWeak), c.rejected(mountProg, mountVersion, mountProcMnt, func(w *xdrWriter) {
+		w.string("/")
+	}))
+
+	c.cred = &unixCred{machineName: "host", uid: 502, gid: 20}
+	st, _ := c.mount("/")
+	rtest.Equals(t, uint32(mnt3ErrAcces), st)
+	rtest.Equals(t, uint32(authTooWeak), c.rejected(mountProg, mountVersion, mountProcExport, nil))
+
+	c.cred.uid = 501
+	st, root := c.mount("/")
+	rtest.Equals(t, uint32(mnt3OK), st)
+	stat, _ = c.call(mountProg, mountVersion, mountProcExport, nil)
+	rtest.Equals(t, uint32(acceptSuccess), stat)
+
+	// NFS calls must be sent from a privileged port
+	rtest.Equals(t, uint32(authTooWeak), c.rejected(nfsProg, nfsVersion, nfs3ProcGetattr, func(w *xdrWriter) {
+		w.opaque(root)
+	}))
+
+	call := func(cred *unixCred, proc uint32, args func(w *xdrWriter)) *xdrReader {
+		reply := handleCall(srv.progs, true, callRecord(1, nfsProg, nfsVersion, proc, cred, args))
+		return &xdrReader{buf: reply[8:]}
+	}
+	lookup := func(w *xdrWriter) {
+		w.opaque(root)
+		w.string("dir")
+	}
+
+	r := call(c.cred, nfs3ProcLookup, lookup)
+	rtest.Equals(t, uint32(replyAccepted), r.uint32())
+	stat, r = readAccepted(t, r)
+	rtest.Equals(t, uint32(acceptSuccess), stat)
+	rtest.Equals(t, uint32(nfs3OK), r.uint32())
+
+	// calls of other users fail, followed by the empty dir attributes
+	r = call(&unixCred{uid: 0}, nfs3ProcLookup, lookup)
+	rtest.Equals(t, uint32(replyAccepted), r.uint32())
+	stat, r = readAccepted(t, r)
+	rtest.Equals(t, uint32(acceptSuccess), stat)
+	rtest.Equals(t, uint32(nfs3ErrAcces), r.uint32())
+	rtest.Assert(t, !r.bool(), "unexpected attributes")
+	rtest.Equals(t, 0, len(r.buf))
+
+	// calls without AUTH_UNIX credentials are rejected
+	r = call(nil, nfs3ProcLookup, lookup)
+	rtest.Equals(t, uint32(replyDenied), r.uint32())
+	rtest.Equals(t, uint32(rejectAuthError), r.uint32())
+	rtest.Equals(t, uint32(authTooWeak), r.uint32())
+}
+
+func TestServerExportOnce(t *testing.T) {
+	fsys := fstest.MapFS{
+		"dir/file": {Data: []byte("hello world"), Mode: 0644},
+	}
+	srv := NewServer(fsys)
+	export := srv.ExportOnce()
+
+	c := dialTestServer(t, srv)
+	c.cred = &unixCred{machineName: "host", uid: 501, gid: 20}
+
+	// the root dir cannot be mounted without the export path, which is not
+	// listed
+	for _, dirpath := range []string{"/", "/dir", export + "/dir", export[:len(export)-1]} {
+		st, _ := c.mount(dirpath)
+		rtest.Equals(t, uint32(mnt3ErrAcces), st)
+	}
+	stat, r := c.call(mountProg, mountVersion, mountProcExport, nil)
+	rtest.Equals(t, uint32(acceptSuccess), stat)
+	rtest.Assert(t, !r.bool(), "unexpected export")
+
+	st, root := c.mount(export)
+	rtest.Equals(t, uint32(mnt3OK), st)
+	st, _ = c.lookup(root, "dir")
+	rtest.Equals(t, uint32(nfs3OK), st)
+
+	// only the first mount succeeds
+	st, _ = c.mount(export)
+	rtest.Equals(t, uint32(mnt3ErrAcces), st)
+}
+
+func TestHandleTableEviction(t *testing.T) {
+	tab := newHandleTableSize(2)
+	root, _ := tab.handle(".")
+	a, idA := tab.handle("a")
+	_, _ = tab.handle("b")
+
+	// a was used most recently, thus b is evicted
+	rtest.Equals(t, idA, tab.id("a"))
+	c, _ := tab.handle("c")
+	for _, fh := range [][]byte{root, a, c} {
+		_, _, st := tab.path(fh)
+		rtest.Equals(t, uint32(nfs3OK), st)
+	}
+
+	_, idB := tab.handle("b")
+	rtest.Assert(t, idB > idA, "evicted path got old id %v", idB)
+	name, _, st := tab.path(a)
+	rtest.Equals(t, uint32(nfs3ErrStale), st)
+	rtest.Equals(t, "", name)
+
+	// the root dir is never evicted
+	name, id, st := tab.path(root)
+	rtest.Equals(t, uint32(nfs3OK), st)
+	rtest.Equals(t, ".", name)
+	rtest.Equals(t, uint64(rootID), id)
+}
@@ -0,0 +1,120 @@
+package nfs
+
+import (
+	"encoding/binary"
+
+	"github.com/restic/restic/internal/errors"
+)
+
+var errGarbage = errors.New("invalid XDR data")
+
+// xdrReader decodes data in the XDR format described in RFC 4506. The first
+// error is stored in err, all later reads return zero values.
+type xdrReader struct {
+	buf []byte
+	err error
+}
+
+func (r *xdrReader) next(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(r.buf) {
+		r.err = errGarbage
+		r.buf = nil
+		return nil
+	}
+	b := r.buf[:n]
+	r.buf = r.buf[n:]
+	return b
+}
+
+func (r *xdrReader) uint32() uint32 {
+	b := r.next(4)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint32(b)
+}
+
+func (r *xdrReader) uint64() uint64 {
+	b := r.next(8)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint64(b)
+}
+
+func (r *xdrReader) bool() bool {
+	return r.uint32() != 0
+}
+
+// fixed reads opaque data with a fixed length of n bytes.
+func (r *xdrReader) fixed(n int) []byte {
+	b := r.next(pad(n))
+	if b == nil {
+		return nil
+	}
+	return b[:n]
+}
+
+// opaque reads variable length opaque data of at most maxLen bytes.
+func (r *xdrReader) opaque(maxLen int) []byte {
+	n := r.uint32()
+	if r.err == nil && n > uint32(maxLen) {
+		r.err = errGarbage
+	}
+	return r.fixed(int(n))
+}
+
+func (r *xdrReader) string(maxLen int) string {
+	return string(r.opaque(maxLen))
+}
+
+// xdrWriter encodes data in the XDR format.
+type xdrWriter struct {
+	buf []byte
+}
+
+func (w *xdrWriter) uint32(v uint32) {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], v)
+	w.buf = append(w.buf, b[:]...)
+}
+
+func (w *xdrWriter) uint64(v uint64) {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], v)
+	w.buf = append(w.buf, b[:]...)
+}
+
+func (w *xdrWriter) bool(v bool) {
+	if v {
+		w.uint32(1)
+	} else {
+		w.uint32(0)
+	}
+}
+
+// fixed writes opaque data with a fixed length.
+func (w *xdrWriter) fixed(b []byte) {
+	w.buf = append(w.buf, b...)
+	for i := len(b); i < pad(len(b)); i++ {
+		w.buf = append(w.buf, 0)
+	}
+}
+
+// opaque writes variable length opaque data.
+func (w *xdrWriter) opaque(b []byte) {
+	w.uint32(uint32(len(b)))
+	w.fixed(b)
+}
+
+func (w *xdrWriter) string(s string) {
+	w.opaque([]byte(s))
+}
+
+// pad returns n rounded up to a multiple of four.
+func pad(n int) int {
+	return (n + 3) &^ 3
+}
@@ -519,7 +519,7 @@ func testStreamPack(t *testing.T, version uint) {
 	switch version {
 	case 1:
 		compress = false
-	case 2:
+	case 2, 3:
 		compress = true
 	default:
 		t.Fatal("test does not suport repository version", version)
@@ -674,3 +674,14 @@ func TestInvalidCompression(t *testing.T) {
 	_, err = repository.New(nil, repository.Options{Compression: comp})
 	rtest.Assert(t, err != nil, "missing error")
 }
+
+func TestCompressionModeString(t *testing.T) {
+	for _, mode := range []string{"auto", "off", "fastest", "better", "max"} {
+		var comp repository.CompressionMode
+		rtest.OK(t, comp.Set(mode))
+		rtest.Equals(t, mode, comp.String())
+
+		_, err := repository.New(nil, repository.Options{Compression: comp})
+		rtest.OK(t, err)
+	}
+}
@@ -4,8 +4,14 @@ import (
 	"context"
 	"hash"
 	"io"
+
+	"github.com/restic/restic/internal/errors"
 )
 
+// ErrObjectLocked is returned by Remove if a file is protected by an object
+// lock of the storage service and cannot be removed yet.
+var ErrObjectLocked = errors.New("protected by object lock")
+
 // Backend is used to store and access data.
 //
 // Backend operations that return an error will be retried when a Backend is
@@ -75,3 +81,22 @@ type FileInfo struct {
 	Size int64
 	Name string
 }
+
+// Warmer is implemented by backends which store files in an archive storage
+// class, from which files must be restored before they can be read.
+type Warmer interface {
+	// Warmup requests the restore of all archived files among handles and
+	// waits until all of them can be read. Requesting the restores at once
+	// allows the storage service to process them in parallel.
+	Warmup(ctx context.Context, handles []Handle) error
+}
+
+// Warmup prepares the files for reading if be implements Warmer, and
+// does nothing otherwise.
+func Warmup(ctx context.Context, be Backend, handles []Handle) error {
+	w, ok := be.(Warmer)
+	if !ok || len(handles) == 0 {
+		return nil
+	}
+	return w.Warmup(ctx, handles)
+}
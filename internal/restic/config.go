@@ -16,15 +16,77 @@ type Config struct {
 	Version           uint        `json:"version"`
 	ID                string      `json:"id"`
 	ChunkerPolynomial chunker.Pol `json:"chunker_polynomial"`
+	ChunkerSizes
+}
+
+// ChunkerSizes configures the sizes of the chunks files are split into. Zero
+// values select the defaults of the chunker, which are also used by
+// repositories created without these parameters.
+type ChunkerSizes struct {
+	MinSize     uint `json:"chunker_min_size,omitempty"`
+	MaxSize     uint `json:"chunker_max_size,omitempty"`
+	AverageBits int  `json:"chunker_average_bits,omitempty"`
+}
+
+// Limits for the chunker sizes.
+const (
+	MinChunkerSize        = 64 * 1024
+	MaxChunkerSize        = 64 * 1024 * 1024
+	DefaultChunkerAvgBits = 20
+)
+
+// WithDefaults returns a copy of s with all zero values replaced by the
+// defaults.
+func (s ChunkerSizes) WithDefaults() ChunkerSizes {
+	if s.MinSize == 0 {
+		s.MinSize = chunker.MinSize
+	}
+	if s.MaxSize == 0 {
+		s.MaxSize = chunker.MaxSize
+	}
+	if s.AverageBits == 0 {
+		s.AverageBits = DefaultChunkerAvgBits
+	}
+	return s
+}
+
+// Validate checks that the sizes can be used for the chunker.
+func (s ChunkerSizes) Validate() error {
+	s = s.WithDefaults()
+	switch {
+	case s.MinSize < MinChunkerSize:
+		return errors.Errorf("minimum chunk size %d is smaller than %d", s.MinSize, MinChunkerSize)
+	case s.MaxSize > MaxChunkerSize:
+		return errors.Errorf("maximum chunk size %d is larger than %d", s.MaxSize, MaxChunkerSize)
+	case s.MinSize >= s.MaxSize:
+		return errors.Errorf("minimum chunk size %d must be smaller than the maximum size %d", s.MinSize, s.MaxSize)
+	case s.AverageBits < 1 || s.AverageBits > 30:
+		return errors.Errorf("invalid number of bits %d for the average chunk size", s.AverageBits)
+	}
+
+	avg := uint(1) << uint(s.AverageBits)
+	if avg < s.MinSize || avg > s.MaxSize {
+		return errors.Errorf("average chunk size %d must be between the minimum size %d and the maximum size %d", avg, s.MinSize, s.MaxSize)
+	}
+	return nil
 }
 
 const MinRepoVersion = 1
-const MaxRepoVersion = 2
+const MaxRepoVersion = 3
+
+// ChunkerSizesRepoVersion is the first repository version which supports
+// custom chunker sizes. Older restic versions refuse to open it instead of
+// chunking new data with the default sizes.
+const ChunkerSizesRepoVersion = 3
 
 // StableRepoVersion is the version that is written to the config when a repository
 // is newly created with Init().
 const StableRepoVersion = 2
 
+// LatestRepoVersion is the version selected by "latest". Version 3 is only
+// needed for custom chunker sizes and must be requested explicitly.
+const LatestRepoVersion = 2
+
 // JSONUnpackedLoader loads unpacked JSON.
 type JSONUnpackedLoader interface {
 	LoadJSONUnpacked(context.Context, FileType, ID, interface{}) error
@@ -96,6 +158,13 @@ func LoadConfig(ctx context.Context, r LoaderUnpacked) (Config, error) {
 		}
 	}
 
+	if err := cfg.ChunkerSizes.Validate(); err != nil {
+		return Config{}, errors.Wrap(err, "invalid chunker sizes")
+	}
+	if cfg.ChunkerSizes != (ChunkerSizes{}) && cfg.Version < ChunkerSizesRepoVersion {
+		return Config{}, errors.Errorf("chunker sizes are not supported by repository version %v", cfg.Version)
+	}
+
 	return cfg, nil
 }
 
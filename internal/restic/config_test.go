@@ -1,6 +1,7 @@
 package restic_test
 
 import (
+	"bytes"
 	"context"
 	"testing"
 
@@ -63,3 +64,54 @@ func TestConfig(t *testing.T) {
 	rtest.Assert(t, cfg1 == cfg2,
 		"configs aren't equal: %v != %v", cfg1, cfg2)
 }
+
+func TestChunkerSizesValidate(t *testing.T) {
+	for _, sizes := range []restic.ChunkerSizes{
+		{},
+		{MinSize: 128 * 1024, MaxSize: 1024 * 1024, AverageBits: 18},
+		{MinSize: 4 * 1024 * 1024, MaxSize: 64 * 1024 * 1024, AverageBits: 24},
+		{AverageBits: 22},
+	} {
+		rtest.OK(t, sizes.Validate())
+	}
+
+	for _, sizes := range []restic.ChunkerSizes{
+		{MinSize: 1024},
+		{MaxSize: 128 * 1024 * 1024},
+		{MinSize: 8 * 1024 * 1024},
+		{AverageBits: 16},
+		{AverageBits: 24},
+		{MinSize: 128 * 1024, MaxSize: 1024 * 1024, AverageBits: 21},
+	} {
+		rtest.Assert(t, sizes.Validate() != nil, "missing error for %+v", sizes)
+	}
+}
+
+func TestConfigChunkerSizes(t *testing.T) {
+	var resultBuf []byte
+	save := func(tpe restic.FileType, buf []byte) (restic.ID, error) {
+		resultBuf = buf
+		return restic.ID{}, nil
+	}
+	load := func(tpe restic.FileType, id restic.ID, in []byte) ([]byte, error) {
+		return resultBuf, nil
+	}
+
+	cfg, err := restic.CreateConfig(restic.MaxRepoVersion)
+	rtest.OK(t, err)
+	rtest.OK(t, restic.SaveConfig(context.TODO(), saver{save}, cfg))
+	rtest.Assert(t, !bytes.Contains(resultBuf, []byte("chunker_min_size")), "default sizes saved in config: %s", resultBuf)
+
+	cfg.ChunkerSizes = restic.ChunkerSizes{MinSize: 128 * 1024, MaxSize: 1024 * 1024, AverageBits: 18}
+	rtest.OK(t, restic.SaveConfig(context.TODO(), saver{save}, cfg))
+
+	loaded, err := restic.LoadConfig(context.TODO(), loader{load})
+	rtest.OK(t, err)
+	rtest.Equals(t, cfg, loaded)
+
+	// older repository versions must not contain chunker sizes
+	cfg.Version = restic.ChunkerSizesRepoVersion - 1
+	rtest.OK(t, restic.SaveConfig(context.TODO(), saver{save}, cfg))
+	_, err = restic.LoadConfig(context.TODO(), loader{load})
+	rtest.Assert(t, err != nil, "missing error for chunker sizes in repository version %v", cfg.Version)
+}
@@ -222,7 +222,12 @@ func (node Node) restoreMetadata(path string) error {
 
 func (node Node) restoreExtendedAttributes(path string) error {
 	for _, attr := range node.ExtendedAttributes {
-		err := Setxattr(path, attr.Name, attr.Value)
+		var err error
+		if IsACLExtendedAttribute(attr.Name) {
+			err = setACL(path, attr)
+		} else {
+			err = Setxattr(path, attr.Name, attr.Value)
+		}
 		if err != nil {
 			return err
 		}
@@ -565,6 +570,20 @@ func lookupGroup(gid uint32) string {
 }
 
 func (node *Node) fillExtra(path string, fi os.FileInfo) error {
+	if owner, ok := fi.Sys().(*fs.Owner); ok {
+		// owner set explicitly, e.g. for data read from stdin
+		node.UID, node.GID = owner.UID, owner.GID
+		node.User, node.Group = owner.User, owner.Group
+		if node.User == "" {
+			node.User = lookupUsername(owner.UID)
+		}
+		if node.Group == "" {
+			node.Group = lookupGroup(owner.GID)
+		}
+		node.ChangeTime = node.ModTime
+		return nil
+	}
+
 	stat, ok := toStatT(fi.Sys())
 	if !ok {
 		// fill minimal info with current values for uid, gid
@@ -638,6 +657,13 @@ func (node *Node) fillExtendedAttributes(path string) error {
 		node.ExtendedAttributes = append(node.ExtendedAttributes, attr)
 	}
 
+	acls, err := getACLs(path, node.Type == "dir")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "can not obtain ACLs for %v: %v\n", path, err)
+		return nil
+	}
+	node.ExtendedAttributes = append(node.ExtendedAttributes, acls...)
+
 	return nil
 }
 
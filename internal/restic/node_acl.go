@@ -0,0 +1,140 @@
+package restic
+
+import (
+	"encoding/binary"
+	"sort"
+
+	"github.com/restic/restic/internal/errors"
+)
+
+// Names of the extended attributes which contain ACLs. Linux stores POSIX ACLs
+// as extended attributes, the ACLs of FreeBSD and macOS are saved in the same
+// way with the names below.
+const (
+	posixACLAccessAttr  = "system.posix_acl_access"
+	posixACLDefaultAttr = "system.posix_acl_default"
+	nfs4ACLAttr         = "freebsd.nfs4_acl"
+	darwinACLAttr       = "com.apple.system.Security"
+)
+
+// IsACLExtendedAttribute reports whether the extended attribute name contains
+// the ACL of a file or directory.
+func IsACLExtendedAttribute(name string) bool {
+	switch name {
+	case posixACLAccessAttr, posixACLDefaultAttr, nfs4ACLAttr, darwinACLAttr:
+		return true
+	}
+	return false
+}
+
+// Tags of POSIX ACL entries, FreeBSD uses the same values as Linux.
+const (
+	posixACLUserObj  = 0x01
+	posixACLUser     = 0x02
+	posixACLGroupObj = 0x04
+	posixACLGroup    = 0x08
+	posixACLMask     = 0x10
+	posixACLOther    = 0x20
+
+	posixACLUndefinedID = 0xffffffff
+
+	posixACLXattrVersion   = 2
+	posixACLXattrEntrySize = 8
+
+	nfs4ACLEntrySize = 16
+)
+
+// posixACLEntry is an entry of a POSIX ACL.
+type posixACLEntry struct {
+	Tag  uint16
+	Perm uint16
+	ID   uint32
+}
+
+// encodePOSIXACL returns the entries in the format of the ACL extended
+// attributes of Linux. The entries are sorted like Linux requires it.
+func encodePOSIXACL(entries []posixACLEntry) []byte {
+	entries = append([]posixACLEntry(nil), entries...)
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Tag != entries[j].Tag {
+			return entries[i].Tag < entries[j].Tag
+		}
+		return entries[i].ID < entries[j].ID
+	})
+
+	buf := make([]byte, 4, 4+len(entries)*posixACLXattrEntrySize)
+	binary.LittleEndian.PutUint32(buf, posixACLXattrVersion)
+	for _, e := range entries {
+		var b [posixACLXattrEntrySize]byte
+		binary.LittleEndian.PutUint16(b[0:], e.Tag)
+		binary.LittleEndian.PutUint16(b[2:], e.Perm)
+		binary.LittleEndian.PutUint32(b[4:], e.ID)
+		buf = append(buf, b[:]...)
+	}
+	return buf
+}
+
+// decodePOSIXACL parses an ACL in the format of the ACL extended attributes of
+// Linux.
+func decodePOSIXACL(buf []byte) ([]posixACLEntry, error) {
+	if len(buf) < 4 || (len(buf)-4)%posixACLXattrEntrySize != 0 {
+		return nil, errors.Errorf("invalid POSIX ACL of %d bytes", len(buf))
+	}
+	if v := binary.LittleEndian.Uint32(buf); v != posixACLXattrVersion {
+		return nil, errors.Errorf("unsupported POSIX ACL version %d", v)
+	}
+
+	entries := make([]posixACLEntry, 0, (len(buf)-4)/posixACLXattrEntrySize)
+	for b := buf[4:]; len(b) > 0; b = b[posixACLXattrEntrySize:] {
+		entries = append(entries, posixACLEntry{
+			Tag:  binary.LittleEndian.Uint16(b[0:]),
+			Perm: binary.LittleEndian.Uint16(b[2:]),
+			ID:   binary.LittleEndian.Uint32(b[4:]),
+		})
+	}
+	return entries, nil
+}
+
+// MapACLOwners returns a copy of attrs in which the user and group IDs of
+// the entries of POSIX and NFSv4 ACLs are replaced using mapUser and
+// mapGroup. The ACLs of macOS refer to users and groups by their UUID and are
+// not changed.
+func MapACLOwners(attrs []ExtendedAttribute, mapUser, mapGroup func(id uint32) uint32) ([]ExtendedAttribute, error) {
+	result := make([]ExtendedAttribute, 0, len(attrs))
+	for _, attr := range attrs {
+		switch attr.Name {
+		case posixACLAccessAttr, posixACLDefaultAttr:
+			entries, err := decodePOSIXACL(attr.Value)
+			if err != nil {
+				return nil, err
+			}
+			for i, e := range entries {
+				switch e.Tag {
+				case posixACLUser:
+					entries[i].ID = mapUser(e.ID)
+				case posixACLGroup:
+					entries[i].ID = mapGroup(e.ID)
+				}
+			}
+			attr.Value = encodePOSIXACL(entries)
+
+		case nfs4ACLAttr:
+			if len(attr.Value)%nfs4ACLEntrySize != 0 {
+				return nil, errors.Errorf("invalid NFSv4 ACL of %d bytes", len(attr.Value))
+			}
+			buf := append([]byte(nil), attr.Value...)
+			for b := buf; len(b) > 0; b = b[nfs4ACLEntrySize:] {
+				id := binary.LittleEndian.Uint32(b[4:])
+				switch binary.LittleEndian.Uint32(b[0:]) {
+				case posixACLUser:
+					binary.LittleEndian.PutUint32(b[4:], mapUser(id))
+				case posixACLGroup:
+					binary.LittleEndian.PutUint32(b[4:], mapGroup(id))
+				}
+			}
+			attr.Value = buf
+		}
+		result = append(result, attr)
+	}
+	return result, nil
+}
@@ -0,0 +1,106 @@
+//go:build darwin
+// +build darwin
+
+package restic
+
+import (
+	"encoding/binary"
+	"syscall"
+	"unsafe"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+)
+
+// Definitions from sys/attr.h and sys/kauth.h.
+const (
+	attrBitMapCount         = 5
+	attrCmnExtendedSecurity = 0x00400000
+
+	// the ACL of a kauth_filesec follows the magic, owner GUID and group GUID
+	filesecACLOffset = 36
+	filesecNoACL     = 0xffffffff
+
+	// the maximum number of entries is 128 of 24 bytes each
+	filesecMaxSize = filesecACLOffset + 8 + 128*24
+)
+
+type attrList struct {
+	BitmapCount uint16
+	Reserved    uint16
+	CommonAttr  uint32
+	VolAttr     uint32
+	DirAttr     uint32
+	FileAttr    uint32
+	ForkAttr    uint32
+}
+
+// attrListSyscall runs getattrlist or setattrlist for the extended security
+// information of path.
+func attrListSyscall(trap uintptr, path string, buf []byte) error {
+	p, err := syscall.BytePtrFromString(path)
+	if err != nil {
+		return err
+	}
+	al := attrList{BitmapCount: attrBitMapCount, CommonAttr: attrCmnExtendedSecurity}
+	_, _, errno := syscall.Syscall6(trap, uintptr(unsafe.Pointer(p)), uintptr(unsafe.Pointer(&al)),
+		uintptr(unsafe.Pointer(&buf[0])), uintptr(len(buf)), 0, 0)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// getACLs returns the ACL of path as a kauth_filesec structure with the owner
+// and group GUIDs cleared. The structure uses the byte order of the host,
+// macOS only runs on little endian systems.
+func getACLs(path string, isDir bool) ([]ExtendedAttribute, error) {
+	// the buffer starts with the total length, followed by an attrreference
+	buf := make([]byte, 12+filesecMaxSize)
+	err := attrListSyscall(syscall.SYS_GETATTRLIST, path, buf)
+	if err == syscall.ENOTSUP {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "getattrlist")
+	}
+
+	offset := 4 + int(int32(binary.LittleEndian.Uint32(buf[4:])))
+	length := int(binary.LittleEndian.Uint32(buf[8:]))
+	if length < filesecACLOffset+8 || offset < 12 || offset+length > len(buf) {
+		// no ACL
+		return nil, nil
+	}
+	fsec := append([]byte(nil), buf[offset:offset+length]...)
+	if binary.LittleEndian.Uint32(fsec[filesecACLOffset:]) == filesecNoACL {
+		return nil, nil
+	}
+
+	for i := 4; i < filesecACLOffset; i++ {
+		fsec[i] = 0
+	}
+	return []ExtendedAttribute{{Name: darwinACLAttr, Value: fsec}}, nil
+}
+
+// setACL restores the ACL in attr and ignores the ACLs of other systems.
+func setACL(path string, attr ExtendedAttribute) error {
+	if attr.Name != darwinACLAttr {
+		debug.Log("ignoring unsupported ACL %v for %v", attr.Name, path)
+		return nil
+	}
+	if len(attr.Value) < filesecACLOffset+8 || len(attr.Value) > filesecMaxSize {
+		return errors.Errorf("invalid ACL of %d bytes", len(attr.Value))
+	}
+
+	// the attrreference points to the data directly following it
+	buf := make([]byte, 8+len(attr.Value))
+	binary.LittleEndian.PutUint32(buf[0:], 8)
+	binary.LittleEndian.PutUint32(buf[4:], uint32(len(attr.Value)))
+	copy(buf[8:], attr.Value)
+
+	err := attrListSyscall(syscall.SYS_SETATTRLIST, path, buf)
+	if err == syscall.ENOTSUP {
+		return nil
+	}
+	return errors.Wrap(err, "setattrlist")
+}
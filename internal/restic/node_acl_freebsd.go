@@ -0,0 +1,205 @@
+//go:build freebsd
+// +build freebsd
+
+package restic
+
+import (
+	"encoding/binary"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+)
+
+// Definitions from sys/acl.h.
+const (
+	aclMaxEntries = 254
+
+	aclTypeAccess  = 2
+	aclTypeDefault = 3
+	aclTypeNFS4    = 4
+
+	aclEveryone = 0x40
+)
+
+// aclEntry is an entry of a POSIX.1e or NFSv4 ACL, the latter are saved in
+// the layout of this structure. NFSv4 ACLs use the same tags as POSIX ACLs
+// for users and groups.
+type aclEntry struct {
+	Tag       uint32
+	ID        uint32
+	Perm      uint32
+	EntryType uint16
+	Flags     uint16
+}
+
+type acl struct {
+	MaxCnt  uint32
+	Cnt     uint32
+	Spare   [4]int32
+	Entries [aclMaxEntries]aclEntry
+}
+
+func aclSyscall(trap uintptr, path string, tpe int, a *acl) error {
+	p, err := unix.BytePtrFromString(path)
+	if err != nil {
+		return err
+	}
+	_, _, errno := unix.Syscall(trap, uintptr(unsafe.Pointer(p)), uintptr(tpe), uintptr(unsafe.Pointer(a)))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// getACL returns the ACL of type tpe, or nil if the file system does not
+// support it.
+func getACL(path string, tpe int) (*acl, error) {
+	a := &acl{MaxCnt: aclMaxEntries}
+	err := aclSyscall(unix.SYS___ACL_GET_FILE, path, tpe, a)
+	switch err {
+	case nil:
+		return a, nil
+	case unix.EINVAL, unix.EOPNOTSUPP:
+		return nil, nil
+	}
+	return nil, errors.Wrap(err, "acl_get_file")
+}
+
+// getACLs returns the POSIX.1e or NFSv4 ACLs of path. ACLs which only
+// contain the permissions of the file mode are omitted.
+func getACLs(path string, isDir bool) ([]ExtendedAttribute, error) {
+	var attrs []ExtendedAttribute
+
+	a, err := getACL(path, aclTypeAccess)
+	if err != nil {
+		return nil, err
+	}
+	if a != nil {
+		// the minimal ACL contains the owner, group and other entries
+		if a.Cnt > 3 {
+			attrs = append(attrs, ExtendedAttribute{Name: posixACLAccessAttr, Value: encodeFreeBSDPOSIXACL(a)})
+		}
+
+		if isDir {
+			a, err := getACL(path, aclTypeDefault)
+			if err != nil {
+				return nil, err
+			}
+			if a != nil && a.Cnt > 0 {
+				attrs = append(attrs, ExtendedAttribute{Name: posixACLDefaultAttr, Value: encodeFreeBSDPOSIXACL(a)})
+			}
+		}
+		return attrs, nil
+	}
+
+	a, err = getACL(path, aclTypeNFS4)
+	if err != nil || a == nil || trivialNFS4ACL(a) {
+		return nil, err
+	}
+	return []ExtendedAttribute{{Name: nfs4ACLAttr, Value: encodeNFS4ACL(a)}}, nil
+}
+
+// trivialNFS4ACL reports whether a only contains the entries for owner@,
+// group@ and everyone@ which FreeBSD derives from the file mode.
+func trivialNFS4ACL(a *acl) bool {
+	for _, e := range a.Entries[:a.Cnt] {
+		if e.Flags != 0 {
+			return false
+		}
+		switch e.Tag {
+		case posixACLUserObj, posixACLGroupObj, aclEveryone:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func encodeFreeBSDPOSIXACL(a *acl) []byte {
+	entries := make([]posixACLEntry, 0, a.Cnt)
+	for _, e := range a.Entries[:a.Cnt] {
+		entries = append(entries, posixACLEntry{Tag: uint16(e.Tag), Perm: uint16(e.Perm), ID: e.ID})
+	}
+	return encodePOSIXACL(entries)
+}
+
+func encodeNFS4ACL(a *acl) []byte {
+	buf := make([]byte, 0, a.Cnt*nfs4ACLEntrySize)
+	for _, e := range a.Entries[:a.Cnt] {
+		var b [nfs4ACLEntrySize]byte
+		binary.LittleEndian.PutUint32(b[0:], e.Tag)
+		binary.LittleEndian.PutUint32(b[4:], e.ID)
+		binary.LittleEndian.PutUint32(b[8:], e.Perm)
+		binary.LittleEndian.PutUint16(b[12:], e.EntryType)
+		binary.LittleEndian.PutUint16(b[14:], e.Flags)
+		buf = append(buf, b[:]...)
+	}
+	return buf
+}
+
+func decodeNFS4ACL(buf []byte) (*acl, error) {
+	if len(buf)%nfs4ACLEntrySize != 0 || len(buf)/nfs4ACLEntrySize > aclMaxEntries {
+		return nil, errors.Errorf("invalid NFSv4 ACL of %d bytes", len(buf))
+	}
+
+	a := &acl{MaxCnt: aclMaxEntries}
+	for b := buf; len(b) > 0; b = b[nfs4ACLEntrySize:] {
+		a.Entries[a.Cnt] = aclEntry{
+			Tag:       binary.LittleEndian.Uint32(b[0:]),
+			ID:        binary.LittleEndian.Uint32(b[4:]),
+			Perm:      binary.LittleEndian.Uint32(b[8:]),
+			EntryType: binary.LittleEndian.Uint16(b[12:]),
+			Flags:     binary.LittleEndian.Uint16(b[14:]),
+		}
+		a.Cnt++
+	}
+	return a, nil
+}
+
+// setACL restores the POSIX.1e or NFSv4 ACL in attr and ignores the ACLs of
+// other systems.
+func setACL(path string, attr ExtendedAttribute) error {
+	var (
+		a   *acl
+		tpe int
+		err error
+	)
+
+	switch attr.Name {
+	case posixACLAccessAttr, posixACLDefaultAttr:
+		tpe = aclTypeAccess
+		if attr.Name == posixACLDefaultAttr {
+			tpe = aclTypeDefault
+		}
+
+		var entries []posixACLEntry
+		entries, err = decodePOSIXACL(attr.Value)
+		if err == nil && len(entries) > aclMaxEntries {
+			err = errors.Errorf("POSIX ACL has too many entries: %d", len(entries))
+		}
+		if err == nil {
+			a = &acl{MaxCnt: aclMaxEntries, Cnt: uint32(len(entries))}
+			for i, e := range entries {
+				a.Entries[i] = aclEntry{Tag: uint32(e.Tag), ID: e.ID, Perm: uint32(e.Perm)}
+			}
+		}
+	case nfs4ACLAttr:
+		tpe = aclTypeNFS4
+		a, err = decodeNFS4ACL(attr.Value)
+	default:
+		debug.Log("ignoring unsupported ACL %v for %v", attr.Name, path)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	err = aclSyscall(unix.SYS___ACL_SET_FILE, path, tpe, a)
+	if err == unix.EOPNOTSUPP {
+		return nil
+	}
+	return errors.Wrap(err, "acl_set_file")
+}
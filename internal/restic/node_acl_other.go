@@ -0,0 +1,22 @@
+//go:build !darwin && !freebsd
+// +build !darwin,!freebsd
+
+package restic
+
+import "github.com/restic/restic/internal/debug"
+
+// getACLs returns nothing, POSIX ACLs are already part of the extended
+// attributes.
+func getACLs(path string, isDir bool) ([]ExtendedAttribute, error) {
+	return nil, nil
+}
+
+// setACL restores POSIX ACLs as extended attributes and ignores the ACLs
+// of other systems.
+func setACL(path string, attr ExtendedAttribute) error {
+	if attr.Name != posixACLAccessAttr && attr.Name != posixACLDefaultAttr {
+		debug.Log("ignoring unsupported ACL %v for %v", attr.Name, path)
+		return nil
+	}
+	return Setxattr(path, attr.Name, attr.Value)
+}
@@ -0,0 +1,69 @@
+package restic
+
+import (
+	"testing"
+
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestPOSIXACLEncoding(t *testing.T) {
+	entries := []posixACLEntry{
+		{Tag: posixACLOther, Perm: 4, ID: posixACLUndefinedID},
+		{Tag: posixACLUser, Perm: 6, ID: 1001},
+		{Tag: posixACLUserObj, Perm: 7, ID: posixACLUndefinedID},
+		{Tag: posixACLMask, Perm: 6, ID: posixACLUndefinedID},
+		{Tag: posixACLUser, Perm: 4, ID: 1000},
+		{Tag: posixACLGroupObj, Perm: 5, ID: posixACLUndefinedID},
+	}
+
+	buf := encodePOSIXACL(entries)
+	rtest.Equals(t, []byte{
+		2, 0, 0, 0,
+		0x01, 0, 7, 0, 0xff, 0xff, 0xff, 0xff,
+		0x02, 0, 4, 0, 0xe8, 0x03, 0, 0,
+		0x02, 0, 6, 0, 0xe9, 0x03, 0, 0,
+		0x04, 0, 5, 0, 0xff, 0xff, 0xff, 0xff,
+		0x10, 0, 6, 0, 0xff, 0xff, 0xff, 0xff,
+		0x20, 0, 4, 0, 0xff, 0xff, 0xff, 0xff,
+	}, buf)
+
+	decoded, err := decodePOSIXACL(buf)
+	rtest.OK(t, err)
+	rtest.Equals(t, []posixACLEntry{entries[2], entries[4], entries[1], entries[5], entries[3], entries[0]}, decoded)
+
+	for _, buf := range [][]byte{nil, {2, 0, 0}, {1, 0, 0, 0}, {2, 0, 0, 0, 1, 0}} {
+		_, err := decodePOSIXACL(buf)
+		rtest.Assert(t, err != nil, "missing error for %v", buf)
+	}
+}
+
+func TestIsACLExtendedAttribute(t *testing.T) {
+	for _, name := range []string{"system.posix_acl_access", "system.posix_acl_default", "freebsd.nfs4_acl", "com.apple.system.Security"} {
+		rtest.Assert(t, IsACLExtendedAttribute(name), "%v is not an ACL", name)
+	}
+	for _, name := range []string{"user.foo", "security.selinux", "com.apple.quarantine"} {
+		rtest.Assert(t, !IsACLExtendedAttribute(name), "%v is an ACL", name)
+	}
+}
+
+func TestMapACLOwnersNFS4(t *testing.T) {
+	// owner@, user:1000 and group:100 entries
+	acl := []byte{
+		0x01, 0, 0, 0, 0xff, 0xff, 0xff, 0xff, 0x07, 0, 0, 0, 0x01, 0, 0, 0,
+		0x02, 0, 0, 0, 0xe8, 0x03, 0, 0, 0x07, 0, 0, 0, 0x01, 0, 0x03, 0,
+		0x08, 0, 0, 0, 100, 0, 0, 0, 0x05, 0, 0, 0, 0x01, 0, 0, 0,
+	}
+	attrs := []ExtendedAttribute{{Name: nfs4ACLAttr, Value: acl}}
+
+	mapped, err := MapACLOwners(attrs, func(id uint32) uint32 { return id + 1 }, func(id uint32) uint32 { return id + 2 })
+	rtest.OK(t, err)
+	rtest.Equals(t, []ExtendedAttribute{{Name: nfs4ACLAttr, Value: []byte{
+		0x01, 0, 0, 0, 0xff, 0xff, 0xff, 0xff, 0x07, 0, 0, 0, 0x01, 0, 0, 0,
+		0x02, 0, 0, 0, 0xe9, 0x03, 0, 0, 0x07, 0, 0, 0, 0x01, 0, 0x03, 0,
+		0x08, 0, 0, 0, 102, 0, 0, 0, 0x05, 0, 0, 0, 0x01, 0, 0, 0,
+	}}}, mapped)
+	rtest.Equals(t, byte(0xe8), attrs[0].Value[20])
+
+	_, err = MapACLOwners([]ExtendedAttribute{{Name: nfs4ACLAttr, Value: acl[:20]}}, nil, nil)
+	rtest.Assert(t, err != nil, "missing error for truncated ACL")
+}
@@ -8,6 +8,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/restic/restic/internal/fs"
 	"github.com/restic/restic/internal/restic"
 	rtest "github.com/restic/restic/internal/test"
 )
@@ -292,3 +293,25 @@ func TestFixTime(t *testing.T) {
 		})
 	}
 }
+
+func TestNodeFromFileInfoOwner(t *testing.T) {
+	rd := &fs.Reader{
+		Name:    "/dump.sql",
+		Mode:    0600,
+		ModTime: time.Unix(1500000000, 0),
+		Owner:   &fs.Owner{UID: 1234, GID: 5678, User: "dbuser"},
+	}
+
+	fi, err := rd.Lstat("/dump.sql")
+	rtest.OK(t, err)
+
+	node, err := restic.NodeFromFileInfo("/dump.sql", fi)
+	rtest.OK(t, err)
+
+	rtest.Equals(t, uint32(1234), node.UID)
+	rtest.Equals(t, uint32(5678), node.GID)
+	rtest.Equals(t, "dbuser", node.User)
+	rtest.Equals(t, os.FileMode(0600), node.Mode)
+	rtest.Assert(t, node.ModTime.Equal(rd.ModTime), "wrong mtime %v", node.ModTime)
+	rtest.Assert(t, node.ChangeTime.Equal(rd.ModTime), "wrong ctime %v", node.ChangeTime)
+}
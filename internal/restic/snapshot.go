@@ -25,6 +25,10 @@ type Snapshot struct {
 	Tags     []string  `json:"tags,omitempty"`
 	Original *ID       `json:"original,omitempty"`
 
+	// Skipped lists the paths within the snapshot of the files and
+	// directories which could not be read completely during the backup.
+	Skipped []string `json:"skipped,omitempty"`
+
 	id *ID // plaintext ID, used during restore
 }
 
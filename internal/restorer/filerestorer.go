@@ -12,6 +12,7 @@ import (
 	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/repository"
 	"github.com/restic/restic/internal/restic"
+	restoreui "github.com/restic/restic/internal/ui/restore"
 )
 
 // TODO if a blob is corrupt, there may be good blob copies in other packs
@@ -31,6 +32,14 @@ type fileInfo struct {
 	size       int64
 	location   string      // file on local filesystem relative to restorer basedir
 	blobs      interface{} // blobs of the file
+	inPlace    bool        // file already exists and is updated in place
+	present    []bool      // for files updated in place: blobs already present at their offset
+}
+
+// blobPresent reports whether the i-th blob of the file is already present in
+// the existing file and thus does not need to be written.
+func (f *fileInfo) blobPresent(i int) bool {
+	return f.present != nil && f.present[i]
 }
 
 type fileBlobInfo struct {
@@ -49,15 +58,18 @@ type fileRestorer struct {
 	key        *crypto.Key
 	idx        func(restic.BlobHandle) []restic.PackedBlob
 	packLoader repository.BackendLoadFn
+	// warmup prepares the packs for reading before they are loaded, if set
+	warmup func(ctx context.Context, packs restic.IDs) error
 
 	workerCount int
 	filesWriter *filesWriter
 	zeroChunk   restic.ID
 	sparse      bool
 
-	dst   string
-	files []*fileInfo
-	Error func(string, error) error
+	dst      string
+	files    []*fileInfo
+	Error    func(string, error) error
+	progress *restoreui.Progress
 }
 
 func newFileRestorer(dst string,
@@ -87,6 +99,13 @@ func (r *fileRestorer) addFile(location string, content restic.IDs, size int64)
 	r.files = append(r.files, &fileInfo{location: location, blobs: content, size: size})
 }
 
+// addFileInPlace adds a file which already exists in the target directory.
+// Only the blobs not marked in present are written, the rest of the existing
+// file is kept.
+func (r *fileRestorer) addFileInPlace(location string, content restic.IDs, size int64, present []bool) {
+	r.files = append(r.files, &fileInfo{location: location, blobs: content, size: size, inPlace: true, present: present})
+}
+
 func (r *fileRestorer) targetPath(location string) string {
 	return filepath.Join(r.dst, location)
 }
@@ -124,7 +143,14 @@ func (r *fileRestorer) restoreFiles(ctx context.Context) error {
 			packsMap = make(map[restic.ID][]fileBlobInfo)
 		}
 		fileOffset := int64(0)
+		blobIndex := 0
 		err := r.forEachBlob(fileBlobs, func(packID restic.ID, blob restic.Blob) {
+			present := file.blobPresent(blobIndex)
+			blobIndex++
+			if present {
+				fileOffset += int64(blob.DataLength())
+				return
+			}
 			if largeFile {
 				packsMap[packID] = append(packsMap[packID], fileBlobInfo{id: blob.ID, offset: fileOffset})
 				fileOffset += int64(blob.DataLength())
@@ -148,6 +174,10 @@ func (r *fileRestorer) restoreFiles(ctx context.Context) error {
 			// in addition, a short chunk will never match r.zeroChunk which would prevent sparseness for short files
 			file.sparse = r.sparse
 		}
+		if file.inPlace {
+			// sparse writes skip zeros, which would keep the old content
+			file.sparse = false
+		}
 
 		if err != nil {
 			// repository index is messed up, can't do anything
@@ -158,6 +188,12 @@ func (r *fileRestorer) restoreFiles(ctx context.Context) error {
 		}
 	}
 
+	if r.warmup != nil {
+		if err := r.warmup(ctx, packOrder); err != nil {
+			return err
+		}
+	}
+
 	wg, ctx := errgroup.WithContext(ctx)
 	downloadCh := make(chan *packInfo)
 
@@ -210,11 +246,13 @@ func (r *fileRestorer) downloadPack(ctx context.Context, pack *packInfo) error {
 		}
 		if fileBlobs, ok := file.blobs.(restic.IDs); ok {
 			fileOffset := int64(0)
+			blobIndex := 0
 			err := r.forEachBlob(fileBlobs, func(packID restic.ID, blob restic.Blob) {
-				if packID.Equal(pack.id) {
+				if packID.Equal(pack.id) && !file.blobPresent(blobIndex) {
 					addBlob(blob, fileOffset)
 				}
 				fileOffset += int64(blob.DataLength())
+				blobIndex++
 			})
 			if err != nil {
 				// restoreFiles should have caught this error before
@@ -268,9 +306,13 @@ func (r *fileRestorer) downloadPack(ctx context.Context, pack *packInfo) error {
 						file.inProgress = true
 						createSize = file.size
 					}
-					return r.filesWriter.writeToFile(r.targetPath(file.location), blobData, offset, createSize, file.sparse)
+					return r.filesWriter.writeToFile(r.targetPath(file.location), blobData, offset, createSize, file.sparse, file.inPlace)
+				}
+				err := writeToFile()
+				if err == nil {
+					r.progress.AddProgress(file.location, uint64(len(blobData)), uint64(file.size))
 				}
-				err := sanitizeError(file, writeToFile())
+				err = sanitizeError(file, err)
 				if err != nil {
 					return err
 				}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/restic/restic/internal/crypto"
@@ -272,6 +273,54 @@ func TestErrorRestoreFiles(t *testing.T) {
 	rtest.Assert(t, errors.Is(err, loadError), "got %v, expected contained error %v", err, loadError)
 }
 
+func TestFileRestorerWarmup(t *testing.T) {
+	tempdir := rtest.TempDir(t)
+	content := []TestFile{
+		{
+			name: "file1",
+			blobs: []TestBlob{
+				{"data1-1", "pack1"},
+				{"data1-2", "pack2"},
+			},
+		},
+		{
+			name: "file2",
+			blobs: []TestBlob{
+				{"data2-1", "pack2"},
+			},
+		}}
+
+	repo := newTestRepo(content)
+	loader := repo.loader
+	warmedUp := false
+	repo.loader = func(ctx context.Context, h restic.Handle, length int, offset int64, fn func(rd io.Reader) error) error {
+		rtest.Assert(t, warmedUp, "pack %v loaded before warmup", h)
+		return loader(ctx, h, length, offset, fn)
+	}
+
+	r := newFileRestorer(tempdir, repo.loader, repo.key, repo.Lookup, 2, false)
+	r.files = repo.files
+	r.warmup = func(ctx context.Context, packs restic.IDs) error {
+		rtest.Equals(t, 2, len(packs))
+		warmedUp = true
+		return nil
+	}
+
+	rtest.OK(t, r.restoreFiles(context.TODO()))
+	rtest.Assert(t, warmedUp, "warmup was not called")
+	verifyRestore(t, r, repo)
+
+	// an error of warmup aborts the restore
+	warmupError := errors.New("warmup error")
+	r = newFileRestorer(tempdir, repo.loader, repo.key, repo.Lookup, 2, false)
+	r.files = repo.files
+	r.warmup = func(ctx context.Context, packs restic.IDs) error {
+		return warmupError
+	}
+	err := r.restoreFiles(context.TODO())
+	rtest.Assert(t, errors.Is(err, warmupError), "got %v, expected contained error %v", err, warmupError)
+}
+
 func TestDownloadError(t *testing.T) {
 	for i := 0; i < 100; i += 10 {
 		testPartialDownloadError(t, i)
@@ -316,3 +365,37 @@ func testPartialDownloadError(t *testing.T, part int) {
 	rtest.OK(t, err)
 	verifyRestore(t, r, repo)
 }
+
+func TestFileRestorerInPlace(t *testing.T) {
+	tempdir := rtest.TempDir(t)
+	content := []TestFile{
+		{
+			name: "file1",
+			blobs: []TestBlob{
+				{"data1-1", "pack1"},
+				{"data1-2", "pack2"},
+				{"data1-3", "pack1"},
+			},
+		}}
+
+	repo := newTestRepo(content)
+
+	loaded := make(map[string]int)
+	loader := repo.loader
+	repo.loader = func(ctx context.Context, h restic.Handle, length int, offset int64, fn func(rd io.Reader) error) error {
+		id, err := restic.ParseID(h.Name)
+		rtest.OK(t, err)
+		loaded[repo.packsIDToName[id]]++
+		return loader(ctx, h, length, offset, fn)
+	}
+
+	// the existing file is longer and only the second blob differs
+	rtest.OK(t, os.WriteFile(filepath.Join(tempdir, "file1"), []byte("data1-1xxxxxxxdata1-3trailing garbage"), 0600))
+
+	r := newFileRestorer(tempdir, repo.loader, repo.key, repo.Lookup, 2, true)
+	r.addFileInPlace("file1", repo.files[0].blobs.(restic.IDs), 21, []bool{true, false, true})
+
+	rtest.OK(t, r.restoreFiles(context.TODO()))
+	verifyRestore(t, r, repo)
+	rtest.Equals(t, map[string]int{"pack2": 1}, loaded)
+}
@@ -38,7 +38,11 @@ func newFilesWriter(count int) *filesWriter {
 	}
 }
 
-func (w *filesWriter) writeToFile(path string, blob []byte, offset int64, createSize int64, sparse bool) error {
+// writeToFile writes blob to the file at path at the given offset. If
+// createSize is not negative, the file is created with that size, or for
+// inPlace files, the existing file is truncated to it without discarding its
+// content.
+func (w *filesWriter) writeToFile(path string, blob []byte, offset int64, createSize int64, sparse bool, inPlace bool) error {
 	bucket := &w.buckets[uint(xxhash.Sum64String(path))%uint(len(w.buckets))]
 
 	acquireWriter := func() (*partialFile, error) {
@@ -51,7 +55,9 @@ func (w *filesWriter) writeToFile(path string, blob []byte, offset int64, create
 		}
 
 		var flags int
-		if createSize >= 0 {
+		if createSize >= 0 && inPlace {
+			flags = os.O_CREATE | os.O_WRONLY
+		} else if createSize >= 0 {
 			flags = os.O_CREATE | os.O_TRUNC | os.O_WRONLY
 		} else {
 			flags = os.O_WRONLY
@@ -65,7 +71,12 @@ func (w *filesWriter) writeToFile(path string, blob []byte, offset int64, create
 		wr := &partialFile{File: f, users: 1, sparse: sparse}
 		bucket.files[path] = wr
 
-		if createSize >= 0 {
+		if createSize >= 0 && inPlace {
+			err = f.Truncate(createSize)
+			if err != nil {
+				return nil, err
+			}
+		} else if createSize >= 0 {
 			if sparse {
 				err = truncateSparse(f, createSize)
 				if err != nil {
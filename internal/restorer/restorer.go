@@ -10,10 +10,28 @@ import (
 	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/fs"
 	"github.com/restic/restic/internal/restic"
+	restoreui "github.com/restic/restic/internal/ui/restore"
 
 	"golang.org/x/sync/errgroup"
 )
 
+// OverwriteBehavior controls what happens to items which already exist in the
+// target directory.
+type OverwriteBehavior int
+
+const (
+	// OverwriteAlways replaces existing items.
+	OverwriteAlways OverwriteBehavior = iota
+	// OverwriteIfChanged replaces existing items unless they have the same
+	// type, size and modification time as in the snapshot.
+	OverwriteIfChanged
+	// OverwriteIfNewer replaces existing items if they are older than the
+	// item in the snapshot.
+	OverwriteIfNewer
+	// OverwriteNever keeps existing items.
+	OverwriteNever
+)
+
 // Restorer is used to restore a snapshot to a directory.
 type Restorer struct {
 	repo   restic.Repository
@@ -22,6 +40,29 @@ type Restorer struct {
 
 	Error        func(location string, err error) error
 	SelectFilter func(item string, dstpath string, node *restic.Node) (selectedForRestore bool, childMayBeSelected bool)
+
+	// Progress is notified about the restored files, it may be nil.
+	Progress *restoreui.Progress
+
+	// Overwrite controls whether existing files and other non-directory
+	// items in the target directory are replaced.
+	Overwrite OverwriteBehavior
+
+	// InPlace enables reusing the content of files which already exist in
+	// the target directory. Only the parts of such files which differ from
+	// the snapshot are downloaded and written.
+	InPlace bool
+
+	// MapUser and MapGroup return the user or group ID used for restoring
+	// an item owned by the ID and name stored in the snapshot. The name is
+	// empty if it is unknown. They are applied to the owner of each node and
+	// to the entries of its ACLs. If they are nil, the stored IDs are used.
+	MapUser  func(id uint32, name string) uint32
+	MapGroup func(id uint32, name string) uint32
+
+	// XattrSelectFilter reports whether the extended attribute with the given
+	// name is restored. If it is nil, all extended attributes are restored.
+	XattrSelectFilter func(name string) bool
 }
 
 var restorerAbortOnAllErrors = func(location string, err error) error { return err }
@@ -171,6 +212,14 @@ func (res *Restorer) restoreNodeTo(ctx context.Context, node *restic.Node, targe
 
 func (res *Restorer) restoreNodeMetadataTo(node *restic.Node, target, location string) error {
 	debug.Log("restoreNodeMetadata %v %v %v", node.Name, target, location)
+	node = res.selectXattrs(node)
+	if res.MapUser != nil || res.MapGroup != nil {
+		var err error
+		node, err = res.mapOwners(node)
+		if err != nil {
+			return err
+		}
+	}
 	err := node.RestoreMetadata(target)
 	if err != nil {
 		debug.Log("node.RestoreMetadata(%s) error %v", target, err)
@@ -178,6 +227,60 @@ func (res *Restorer) restoreNodeMetadataTo(node *restic.Node, target, location s
 	return err
 }
 
+// mapOwners returns node with the owner and the users and groups in its ACLs
+// replaced by MapUser and MapGroup. The original node is not modified.
+func (res *Restorer) mapOwners(node *restic.Node) (*restic.Node, error) {
+	// only the owner of the node is stored with its name
+	mapUser := func(uid uint32) uint32 {
+		if res.MapUser == nil {
+			return uid
+		}
+		name := ""
+		if uid == node.UID {
+			name = node.User
+		}
+		return res.MapUser(uid, name)
+	}
+	mapGroup := func(gid uint32) uint32 {
+		if res.MapGroup == nil {
+			return gid
+		}
+		name := ""
+		if gid == node.GID {
+			name = node.Group
+		}
+		return res.MapGroup(gid, name)
+	}
+
+	n := *node
+	n.UID, n.GID = mapUser(node.UID), mapGroup(node.GID)
+	attrs, err := restic.MapACLOwners(node.ExtendedAttributes, mapUser, mapGroup)
+	if err != nil {
+		return nil, errors.Wrapf(err, "ACL of %v", node.Name)
+	}
+	n.ExtendedAttributes = attrs
+	return &n, nil
+}
+
+// selectXattrs returns node with only the extended attributes selected by
+// XattrSelectFilter. The original node is not modified.
+func (res *Restorer) selectXattrs(node *restic.Node) *restic.Node {
+	if res.XattrSelectFilter == nil || len(node.ExtendedAttributes) == 0 {
+		return node
+	}
+
+	n := *node
+	n.ExtendedAttributes = nil
+	for _, attr := range node.ExtendedAttributes {
+		if res.XattrSelectFilter(attr.Name) {
+			n.ExtendedAttributes = append(n.ExtendedAttributes, attr)
+		} else {
+			debug.Log("not restoring extended attribute %v of %v", attr.Name, node.Name)
+		}
+	}
+	return &n
+}
+
 func (res *Restorer) restoreHardlinkAt(node *restic.Node, target, path, location string) error {
 	if err := fs.Remove(path); !os.IsNotExist(err) {
 		return errors.Wrap(err, "RemoveCreateHardlink")
@@ -199,10 +302,42 @@ func (res *Restorer) restoreEmptyFileAt(node *restic.Node, target, location stri
 	if err != nil {
 		return err
 	}
+	res.Progress.AddProgress(location, 0, 0)
 
 	return res.restoreNodeMetadataTo(node, target, location)
 }
 
+// shouldOverwrite reports whether the non-directory node is restored to
+// target according to res.Overwrite.
+func (res *Restorer) shouldOverwrite(node *restic.Node, target string) (bool, error) {
+	if res.Overwrite == OverwriteAlways {
+		return true, nil
+	}
+
+	fi, err := fs.Lstat(target)
+	if errors.Is(err, os.ErrNotExist) {
+		return true, nil
+	}
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+
+	switch res.Overwrite {
+	case OverwriteIfChanged:
+		sameType := (node.Type == "file" && fi.Mode().IsRegular()) ||
+			(node.Type == "symlink" && fi.Mode()&os.ModeSymlink != 0)
+		unchanged := sameType && fi.ModTime().Equal(node.ModTime) &&
+			(node.Type != "file" || uint64(fi.Size()) == node.Size)
+		return !unchanged, nil
+	case OverwriteIfNewer:
+		return node.ModTime.After(fi.ModTime()), nil
+	case OverwriteNever:
+		return false, nil
+	default:
+		return false, errors.Errorf("unknown overwrite behavior %v", res.Overwrite)
+	}
+}
+
 // RestoreTo creates the directories and files in the snapshot below dst.
 // Before an item is created, res.Filter is called.
 func (res *Restorer) RestoreTo(ctx context.Context, dst string) error {
@@ -215,8 +350,18 @@ func (res *Restorer) RestoreTo(ctx context.Context, dst string) error {
 	}
 
 	idx := NewHardlinkIndex()
+	// items which already exist and are kept according to res.Overwrite
+	keep := make(map[string]struct{})
 	filerestorer := newFileRestorer(dst, res.repo.Backend().Load, res.repo.Key(), res.repo.Index().Lookup, res.repo.Connections(), res.sparse)
 	filerestorer.Error = res.Error
+	filerestorer.progress = res.Progress
+	filerestorer.warmup = func(ctx context.Context, packs restic.IDs) error {
+		handles := make([]restic.Handle, 0, len(packs))
+		for _, id := range packs {
+			handles = append(handles, restic.Handle{Type: restic.PackFile, Name: id.String()})
+		}
+		return restic.Warmup(ctx, res.repo.Backend(), handles)
+	}
 
 	debug.Log("first pass for %q", dst)
 
@@ -238,6 +383,17 @@ func (res *Restorer) RestoreTo(ctx context.Context, dst string) error {
 				return err
 			}
 
+			overwrite, err := res.shouldOverwrite(node, target)
+			if err != nil {
+				keep[location] = struct{}{}
+				return res.Error(location, err)
+			}
+			if !overwrite {
+				debug.Log("keeping existing %v", location)
+				keep[location] = struct{}{}
+				return nil
+			}
+
 			if node.Type != "file" {
 				return nil
 			}
@@ -253,6 +409,17 @@ func (res *Restorer) RestoreTo(ctx context.Context, dst string) error {
 				idx.Add(node.Inode, node.DeviceID, location)
 			}
 
+			if res.InPlace {
+				present, err := res.existingBlobs(target, node)
+				if err != nil {
+					return res.Error(location, err)
+				}
+				if present != nil {
+					return res.restoreInPlace(filerestorer, node, target, location, present)
+				}
+			}
+
+			res.Progress.AddFile(node.Size)
 			filerestorer.addFile(location, node.Content, int64(node.Size))
 
 			return nil
@@ -273,6 +440,10 @@ func (res *Restorer) RestoreTo(ctx context.Context, dst string) error {
 	_, err = res.traverseTree(ctx, dst, string(filepath.Separator), *res.sn.Tree, treeVisitor{
 		visitNode: func(node *restic.Node, target, location string) error {
 			debug.Log("second pass, visitNode: restore node %q", location)
+			if _, ok := keep[location]; ok {
+				return nil
+			}
+
 			if node.Type != "file" {
 				return res.restoreNodeTo(ctx, node, target, location)
 			}
@@ -282,6 +453,7 @@ func (res *Restorer) RestoreTo(ctx context.Context, dst string) error {
 				if node.Links > 1 {
 					idx.Add(node.Inode, node.DeviceID, location)
 				}
+				res.Progress.AddFile(0)
 				return res.restoreEmptyFileAt(node, target, location)
 			}
 
@@ -296,6 +468,90 @@ func (res *Restorer) RestoreTo(ctx context.Context, dst string) error {
 	return err
 }
 
+// restoreInPlace schedules the blobs of node which are missing in the existing
+// file target for restore. If all blobs are present, the file is only
+// truncated to the correct size.
+func (res *Restorer) restoreInPlace(filerestorer *fileRestorer, node *restic.Node, target, location string, present []bool) error {
+	res.Progress.AddFile(node.Size)
+
+	var presentBytes uint64
+	complete := true
+	for i, ok := range present {
+		if !ok {
+			complete = false
+			continue
+		}
+		length, _ := res.repo.LookupBlobSize(node.Content[i], restic.DataBlob)
+		presentBytes += uint64(length)
+	}
+	if presentBytes > 0 {
+		res.Progress.AddProgress(location, presentBytes, node.Size)
+	}
+
+	if !complete {
+		filerestorer.addFileInPlace(location, node.Content, int64(node.Size), present)
+		return nil
+	}
+
+	debug.Log("%v is unchanged", location)
+	if err := os.Truncate(target, int64(node.Size)); err != nil {
+		return res.Error(location, errors.WithStack(err))
+	}
+	return nil
+}
+
+// existingBlobs compares the file at target with the content of node. It
+// returns for each blob whether it is already present at the right offset. If
+// target is not a regular file, nil is returned.
+func (res *Restorer) existingBlobs(target string, node *restic.Node) ([]bool, error) {
+	fi, err := fs.Lstat(target)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if !fi.Mode().IsRegular() {
+		return nil, nil
+	}
+
+	f, err := os.Open(target)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	present := make([]bool, len(node.Content))
+	var buf []byte
+	var offset int64
+	for i, blobID := range node.Content {
+		length, found := res.repo.LookupBlobSize(blobID, restic.DataBlob)
+		if !found {
+			return nil, errors.Errorf("Unable to fetch blob %s", blobID)
+		}
+		if offset+int64(length) > fi.Size() {
+			// the remaining blobs are beyond the end of the existing file
+			break
+		}
+
+		if length > uint(cap(buf)) {
+			buf = make([]byte, length)
+		}
+		buf = buf[:length]
+
+		_, err = f.ReadAt(buf, offset)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		present[i] = blobID.Equal(restic.Hash(buf))
+		offset += int64(length)
+	}
+
+	return present, nil
+}
+
 // Snapshot returns the snapshot this restorer is configured to use.
 func (res *Restorer) Snapshot() *restic.Snapshot {
 	return res.sn
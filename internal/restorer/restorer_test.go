@@ -875,3 +875,175 @@ func TestRestorerSparseFiles(t *testing.T) {
 	t.Logf("wrote %d zeros as %d blocks, %.1f%% sparse",
 		len(zeros), blocks, 100*sparsity)
 }
+
+func TestRestorerSelectXattrs(t *testing.T) {
+	node := &restic.Node{
+		Name: "file",
+		ExtendedAttributes: []restic.ExtendedAttribute{
+			{Name: "user.foo", Value: []byte("foo")},
+			{Name: "system.posix_acl_access", Value: []byte{2, 0, 0, 0}},
+		},
+	}
+
+	res := &Restorer{}
+	rtest.Assert(t, res.selectXattrs(node) == node, "node was modified without a filter")
+
+	res.XattrSelectFilter = func(name string) bool {
+		return !strings.HasPrefix(name, "system.")
+	}
+	selected := res.selectXattrs(node)
+	rtest.Equals(t, []restic.ExtendedAttribute{{Name: "user.foo", Value: []byte("foo")}}, selected.ExtendedAttributes)
+	rtest.Equals(t, 2, len(node.ExtendedAttributes))
+}
+
+func TestRestorerMapOwners(t *testing.T) {
+	// user::rw-, user:1000:r--, user:1001:rw-, group::r--, group:100:r--, mask::rw-, other::---
+	acl := []byte{
+		2, 0, 0, 0,
+		0x01, 0, 6, 0, 0xff, 0xff, 0xff, 0xff,
+		0x02, 0, 4, 0, 0xe8, 0x03, 0, 0,
+		0x02, 0, 6, 0, 0xe9, 0x03, 0, 0,
+		0x04, 0, 4, 0, 0xff, 0xff, 0xff, 0xff,
+		0x08, 0, 4, 0, 100, 0, 0, 0,
+		0x10, 0, 6, 0, 0xff, 0xff, 0xff, 0xff,
+		0x20, 0, 0, 0, 0xff, 0xff, 0xff, 0xff,
+	}
+	node := &restic.Node{
+		Name:  "file",
+		UID:   1001,
+		GID:   100,
+		User:  "alice",
+		Group: "users",
+		ExtendedAttributes: []restic.ExtendedAttribute{
+			{Name: "user.foo", Value: []byte("foo")},
+			{Name: "system.posix_acl_access", Value: acl},
+		},
+	}
+
+	res := &Restorer{
+		MapUser: func(id uint32, name string) uint32 {
+			if name == "alice" {
+				return 2001
+			}
+			if id == 1000 {
+				return 500
+			}
+			return id
+		},
+		MapGroup: func(id uint32, name string) uint32 {
+			if id == 100 {
+				return 200
+			}
+			return id
+		},
+	}
+	mapped, err := res.mapOwners(node)
+	rtest.OK(t, err)
+	rtest.Equals(t, uint32(2001), mapped.UID)
+	rtest.Equals(t, uint32(200), mapped.GID)
+
+	// the entries are sorted by their new IDs
+	rtest.Equals(t, []restic.ExtendedAttribute{
+		{Name: "user.foo", Value: []byte("foo")},
+		{Name: "system.posix_acl_access", Value: []byte{
+			2, 0, 0, 0,
+			0x01, 0, 6, 0, 0xff, 0xff, 0xff, 0xff,
+			0x02, 0, 4, 0, 0xf4, 0x01, 0, 0,
+			0x02, 0, 6, 0, 0xd1, 0x07, 0, 0,
+			0x04, 0, 4, 0, 0xff, 0xff, 0xff, 0xff,
+			0x08, 0, 4, 0, 200, 0, 0, 0,
+			0x10, 0, 6, 0, 0xff, 0xff, 0xff, 0xff,
+			0x20, 0, 0, 0, 0xff, 0xff, 0xff, 0xff,
+		}},
+	}, mapped.ExtendedAttributes)
+
+	// the original node is not modified
+	rtest.Equals(t, uint32(1001), node.UID)
+	rtest.Equals(t, acl, node.ExtendedAttributes[1].Value)
+}
+
+func TestRestorerInPlace(t *testing.T) {
+	repo := repository.TestRepository(t)
+
+	sn, _ := saveSnapshot(t, repo, Snapshot{
+		Nodes: map[string]Node{
+			"changed":   File{Data: "content: changed\n"},
+			"unchanged": File{Data: "content: unchanged\n"},
+			"new":       File{Data: "content: new\n"},
+		},
+	})
+
+	tempdir := rtest.TempDir(t)
+	for name, data := range map[string]string{
+		"changed":   "old content\n",
+		"unchanged": "content: unchanged\nwith more data appended\n",
+	} {
+		rtest.OK(t, os.WriteFile(filepath.Join(tempdir, name), []byte(data), 0600))
+	}
+
+	res := NewRestorer(context.TODO(), repo, sn, false)
+	res.InPlace = true
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	rtest.OK(t, res.RestoreTo(ctx, tempdir))
+
+	for name, data := range map[string]string{
+		"changed":   "content: changed\n",
+		"unchanged": "content: unchanged\n",
+		"new":       "content: new\n",
+	} {
+		content, err := os.ReadFile(filepath.Join(tempdir, name))
+		rtest.OK(t, err)
+		rtest.Equals(t, data, string(content))
+	}
+}
+
+func TestRestorerOverwrite(t *testing.T) {
+	repo := repository.TestRepository(t)
+
+	sn, _ := saveSnapshot(t, repo, Snapshot{
+		Nodes: map[string]Node{
+			"older":     File{Data: "content: snapshot\n", ModTime: time.Unix(2000, 0)},
+			"newer":     File{Data: "content: snapshot\n", ModTime: time.Unix(2000, 0)},
+			"unchanged": File{Data: "content: snapshot\n", ModTime: time.Unix(2000, 0)},
+			"missing":   File{Data: "content: snapshot\n", ModTime: time.Unix(2000, 0)},
+		},
+	})
+
+	const existing = "content: existing\n"
+	for _, test := range []struct {
+		behavior OverwriteBehavior
+		restored map[string]bool
+	}{
+		{OverwriteAlways, map[string]bool{"older": true, "newer": true, "unchanged": true, "missing": true}},
+		{OverwriteIfChanged, map[string]bool{"older": true, "newer": true, "unchanged": false, "missing": true}},
+		{OverwriteIfNewer, map[string]bool{"older": true, "newer": false, "unchanged": false, "missing": true}},
+		{OverwriteNever, map[string]bool{"older": false, "newer": false, "unchanged": false, "missing": true}},
+	} {
+		tempdir := rtest.TempDir(t)
+		for name, mtime := range map[string]time.Time{
+			"older":     time.Unix(1000, 0),
+			"newer":     time.Unix(3000, 0),
+			"unchanged": time.Unix(2000, 0),
+		} {
+			filename := filepath.Join(tempdir, name)
+			rtest.OK(t, os.WriteFile(filename, []byte(existing), 0600))
+			rtest.OK(t, os.Chtimes(filename, mtime, mtime))
+		}
+
+		res := NewRestorer(context.TODO(), repo, sn, false)
+		res.Overwrite = test.behavior
+		rtest.OK(t, res.RestoreTo(context.TODO(), tempdir))
+
+		for name, restored := range test.restored {
+			content, err := os.ReadFile(filepath.Join(tempdir, name))
+			rtest.OK(t, err)
+			want := existing
+			if restored {
+				want = "content: snapshot\n"
+			}
+			rtest.Assert(t, want == string(content), "behavior %v, file %v: want %q, got %q", test.behavior, name, want, content)
+		}
+	}
+}
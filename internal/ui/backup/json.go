@@ -160,6 +160,18 @@ func (b *JSONProgress) CompleteItem(messageType, item string, previous, current
 	}
 }
 
+// SkippedMountPoint reports a mount point whose content is not saved due to
+// --one-file-system.
+func (b *JSONProgress) SkippedMountPoint(item string) {
+	if b.v < 1 {
+		return
+	}
+	b.print(skippedMountPoint{
+		MessageType: "skipped_mount_point",
+		Item:        item,
+	})
+}
+
 // ReportTotal sets the total stats up to now
 func (b *JSONProgress) ReportTotal(item string, start time.Time, s archiver.ScanStats) {
 	if b.v >= 2 {
@@ -230,6 +242,11 @@ type verboseUpdate struct {
 	TotalFiles         uint    `json:"total_files"`
 }
 
+type skippedMountPoint struct {
+	MessageType string `json:"message_type"` // "skipped_mount_point"
+	Item        string `json:"item"`
+}
+
 type summaryOutput struct {
 	MessageType         string  `json:"message_type"` // "summary"
 	FilesNew            uint    `json:"files_new"`
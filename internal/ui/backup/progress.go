@@ -16,6 +16,7 @@ type ProgressPrinter interface {
 	Error(item string, err error) error
 	ScannerError(item string, err error) error
 	CompleteItem(messageType string, item string, previous, current *restic.Node, s archiver.ItemStats, d time.Duration)
+	SkippedMountPoint(item string)
 	ReportTotal(item string, start time.Time, s archiver.ScanStats)
 	Finish(snapshotID restic.ID, start time.Time, summary *Summary, dryRun bool)
 	Reset()
@@ -203,6 +204,13 @@ func (p *Progress) ReportTotal(item string, s archiver.ScanStats) {
 	}
 }
 
+// Summary returns the statistics collected so far.
+func (p *Progress) Summary() Summary {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.summary
+}
+
 // Finish prints the finishing messages.
 func (p *Progress) Finish(snapshotID restic.ID, dryrun bool) {
 	// wait for the status update goroutine to shut down
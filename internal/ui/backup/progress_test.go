@@ -32,6 +32,8 @@ func (p *mockPrinter) CompleteItem(messageType string, item string, previous, cu
 	}
 }
 
+func (p *mockPrinter) SkippedMountPoint(item string) {}
+
 func (p *mockPrinter) ReportTotal(_ string, _ time.Time, _ archiver.ScanStats) {}
 func (p *mockPrinter) Finish(id restic.ID, _ time.Time, summary *Summary, dryRun bool) {
 	p.Lock()
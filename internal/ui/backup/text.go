@@ -83,6 +83,12 @@ func (b *TextProgress) Error(item string, err error) error {
 	return nil
 }
 
+// SkippedMountPoint reports a mount point whose content is not saved due to
+// --one-file-system.
+func (b *TextProgress) SkippedMountPoint(item string) {
+	b.P("skipping mount point %v (--one-file-system)\n", item)
+}
+
 // CompleteItem is the status callback function for the archiver when a
 // file/dir has been saved successfully.
 func (b *TextProgress) CompleteItem(messageType, item string, previous, current *restic.Node, s archiver.ItemStats, d time.Duration) {
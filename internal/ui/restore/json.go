@@ -0,0 +1,113 @@
+package restore
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+
+	"github.com/restic/restic/internal/ui/termstatus"
+)
+
+// JSONProgress reports progress for the `restore` command in JSON.
+type JSONProgress struct {
+	term *termstatus.Terminal
+}
+
+// assert that JSONProgress implements the ProgressPrinter interface
+var _ ProgressPrinter = &JSONProgress{}
+
+// NewJSONProgress returns a new restore progress reporter.
+func NewJSONProgress(term *termstatus.Terminal) *JSONProgress {
+	return &JSONProgress{term: term}
+}
+
+func toJSONString(status interface{}) string {
+	buf := new(bytes.Buffer)
+	err := json.NewEncoder(buf).Encode(status)
+	if err != nil {
+		panic(err)
+	}
+	return buf.String()
+}
+
+func (t *JSONProgress) print(status interface{}) {
+	t.term.Print(toJSONString(status))
+}
+
+func (t *JSONProgress) error(status interface{}) {
+	t.term.Error(toJSONString(status))
+}
+
+// Update prints a status message.
+func (t *JSONProgress) Update(s State, duration time.Duration) {
+	status := statusUpdate{
+		MessageType:      "status",
+		SecondsElapsed:   uint64(duration / time.Second),
+		SecondsRemaining: s.secondsRemaining(duration),
+		TotalFiles:       s.FilesTotal,
+		FilesRestored:    s.FilesFinished,
+		TotalBytes:       s.AllBytesTotal,
+		BytesRestored:    s.AllBytesWritten,
+		ErrorCount:       s.Errors,
+	}
+
+	if s.AllBytesTotal > 0 {
+		status.PercentDone = float64(s.AllBytesWritten) / float64(s.AllBytesTotal)
+	}
+
+	t.print(status)
+}
+
+// Error is the error callback function for the restorer, it prints the error
+// and returns nil.
+func (t *JSONProgress) Error(item string, err error) error {
+	t.error(errorUpdate{
+		MessageType: "error",
+		Error:       err.Error(),
+		During:      "restore",
+		Item:        item,
+	})
+	return nil
+}
+
+// Finish prints the summary.
+func (t *JSONProgress) Finish(s State, duration time.Duration) {
+	t.print(summaryOutput{
+		MessageType:    "summary",
+		SecondsElapsed: uint64(duration / time.Second),
+		TotalFiles:     s.FilesTotal,
+		FilesRestored:  s.FilesFinished,
+		TotalBytes:     s.AllBytesTotal,
+		BytesRestored:  s.AllBytesWritten,
+		ErrorCount:     s.Errors,
+	})
+}
+
+type statusUpdate struct {
+	MessageType      string  `json:"message_type"` // "status"
+	SecondsElapsed   uint64  `json:"seconds_elapsed,omitempty"`
+	SecondsRemaining uint64  `json:"seconds_remaining,omitempty"`
+	PercentDone      float64 `json:"percent_done"`
+	TotalFiles       uint64  `json:"total_files,omitempty"`
+	FilesRestored    uint64  `json:"files_restored,omitempty"`
+	TotalBytes       uint64  `json:"total_bytes,omitempty"`
+	BytesRestored    uint64  `json:"bytes_restored,omitempty"`
+	ErrorCount       uint    `json:"error_count,omitempty"`
+}
+
+type errorUpdate struct {
+	MessageType string `json:"message_type"` // "error"
+	Error       string `json:"error"`
+	During      string `json:"during"`
+	Item        string `json:"item"`
+}
+
+type summaryOutput struct {
+	MessageType    string `json:"message_type"` // "summary"
+	SecondsElapsed uint64 `json:"seconds_elapsed,omitempty"`
+	TotalFiles     uint64 `json:"total_files"`
+	FilesRestored  uint64 `json:"files_restored"`
+	TotalBytes     uint64 `json:"total_bytes"`
+	BytesRestored  uint64 `json:"bytes_restored"`
+	ErrorCount     uint   `json:"error_count"`
+}
@@ -0,0 +1,126 @@
+package restore
+
+import (
+	"sync"
+	"time"
+
+	"github.com/restic/restic/internal/ui/progress"
+)
+
+// A ProgressPrinter can print various progress messages.
+// It must be safe to call its methods from concurrent goroutines.
+type ProgressPrinter interface {
+	Update(s State, duration time.Duration)
+	Error(item string, err error) error
+	Finish(s State, duration time.Duration)
+}
+
+// State is the current state of a restore.
+type State struct {
+	FilesFinished   uint64
+	FilesTotal      uint64
+	AllBytesWritten uint64
+	AllBytesTotal   uint64
+	Errors          uint
+}
+
+// secondsRemaining estimates the time until all bytes are written.
+func (s State) secondsRemaining(duration time.Duration) uint64 {
+	if s.AllBytesWritten == 0 || s.AllBytesWritten >= s.AllBytesTotal {
+		return 0
+	}
+	secs := float64(duration / time.Second)
+	todo := float64(s.AllBytesTotal - s.AllBytesWritten)
+	return uint64(secs / float64(s.AllBytesWritten) * todo)
+}
+
+type fileProgressInfo struct {
+	bytesWritten, bytesTotal uint64
+}
+
+// Progress reports progress for the `restore` command.
+type Progress struct {
+	updater progress.Updater
+	mu      sync.Mutex
+
+	progressInfoMap map[string]fileProgressInfo
+	state           State
+
+	printer ProgressPrinter
+}
+
+// NewProgress returns a Progress which reports to printer every interval.
+func NewProgress(printer ProgressPrinter, interval time.Duration) *Progress {
+	p := &Progress{
+		progressInfoMap: make(map[string]fileProgressInfo),
+		printer:         printer,
+	}
+	p.updater = *progress.NewUpdater(interval, p.update)
+	return p
+}
+
+func (p *Progress) update(runtime time.Duration, final bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if final {
+		p.printer.Finish(p.state, runtime)
+	} else {
+		p.printer.Update(p.state, runtime)
+	}
+}
+
+// AddFile starts tracking a new file with the given size. It is safe to call
+// the methods of a nil Progress.
+func (p *Progress) AddFile(size uint64) {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.state.FilesTotal++
+	p.state.AllBytesTotal += size
+}
+
+// AddProgress accumulates the number of bytes written for a file.
+func (p *Progress) AddProgress(name string, bytesWrittenPortion uint64, bytesTotal uint64) {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	entry, exists := p.progressInfoMap[name]
+	if !exists {
+		entry.bytesTotal = bytesTotal
+	}
+	entry.bytesWritten += bytesWrittenPortion
+	p.progressInfoMap[name] = entry
+
+	p.state.AllBytesWritten += bytesWrittenPortion
+	if entry.bytesWritten == entry.bytesTotal {
+		delete(p.progressInfoMap, name)
+		p.state.FilesFinished++
+	}
+}
+
+// Error is the error callback function for the restorer, it counts and prints
+// the error and returns nil.
+func (p *Progress) Error(item string, err error) error {
+	p.mu.Lock()
+	p.state.Errors++
+	p.mu.Unlock()
+
+	return p.printer.Error(item, err)
+}
+
+// Finish stops the progress updates and prints the summary.
+func (p *Progress) Finish() {
+	if p == nil {
+		return
+	}
+	p.updater.Done()
+}
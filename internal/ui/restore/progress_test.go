@@ -0,0 +1,70 @@
+package restore
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/errors"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+type mockPrinter struct {
+	sync.Mutex
+	finished bool
+	state    State
+}
+
+func (p *mockPrinter) Update(s State, duration time.Duration) {}
+func (p *mockPrinter) Error(item string, err error) error     { return nil }
+
+func (p *mockPrinter) Finish(s State, duration time.Duration) {
+	p.Lock()
+	defer p.Unlock()
+
+	p.finished = true
+	p.state = s
+}
+
+func TestProgress(t *testing.T) {
+	prnt := &mockPrinter{}
+	prog := NewProgress(prnt, time.Millisecond)
+
+	prog.AddFile(0)
+	prog.AddProgress("empty", 0, 0)
+
+	prog.AddFile(100)
+	prog.AddProgress("foo", 60, 100)
+	prog.AddProgress("foo", 40, 100)
+
+	prog.AddFile(50)
+	prog.AddProgress("bar", 20, 50)
+
+	rtest.OK(t, prog.Error("bar", errors.New("write error")))
+
+	time.Sleep(10 * time.Millisecond)
+	prog.Finish()
+
+	rtest.Assert(t, prnt.finished, "Finish was not called")
+	rtest.Equals(t, State{
+		FilesFinished:   2,
+		FilesTotal:      3,
+		AllBytesWritten: 120,
+		AllBytesTotal:   150,
+		Errors:          1,
+	}, prnt.state)
+}
+
+func TestStateSecondsRemaining(t *testing.T) {
+	s := State{AllBytesWritten: 25, AllBytesTotal: 100}
+	rtest.Equals(t, uint64(30), s.secondsRemaining(10*time.Second))
+
+	s.AllBytesWritten = 0
+	rtest.Equals(t, uint64(0), s.secondsRemaining(10*time.Second))
+
+	// a nil Progress ignores all updates
+	var p *Progress
+	p.AddFile(1)
+	p.AddProgress("foo", 1, 1)
+	p.Finish()
+}
@@ -0,0 +1,72 @@
+package restore
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/restic/restic/internal/ui"
+	"github.com/restic/restic/internal/ui/termstatus"
+)
+
+// TextProgress reports progress for the `restore` command.
+type TextProgress struct {
+	*ui.Message
+
+	term *termstatus.Terminal
+}
+
+// assert that TextProgress implements the ProgressPrinter interface
+var _ ProgressPrinter = &TextProgress{}
+
+// NewTextProgress returns a new restore progress reporter.
+func NewTextProgress(term *termstatus.Terminal, verbosity uint) *TextProgress {
+	return &TextProgress{
+		Message: ui.NewMessage(term, verbosity),
+		term:    term,
+	}
+}
+
+// Update updates the status lines.
+func (t *TextProgress) Update(s State, duration time.Duration) {
+	elapsed := ui.FormatDuration(duration)
+	formattedAllBytesWritten := ui.FormatBytes(s.AllBytesWritten)
+	formattedAllBytesTotal := ui.FormatBytes(s.AllBytesTotal)
+	allPercent := ui.FormatPercent(s.AllBytesWritten, s.AllBytesTotal)
+
+	var eta string
+	if secs := s.secondsRemaining(duration); secs > 0 {
+		eta = fmt.Sprintf(" ETA %s", ui.FormatSeconds(secs))
+	}
+
+	status := fmt.Sprintf("[%s] %s  %v files %s, total %v files %v, %d errors%s",
+		elapsed, allPercent, s.FilesFinished, formattedAllBytesWritten,
+		s.FilesTotal, formattedAllBytesTotal, s.Errors, eta)
+
+	t.term.SetStatus([]string{status})
+}
+
+// Error is the error callback function for the restorer, it prints the error
+// and returns nil.
+func (t *TextProgress) Error(item string, err error) error {
+	t.E("ignoring error for %s: %s\n", item, err)
+	return nil
+}
+
+// Finish prints the summary.
+func (t *TextProgress) Finish(s State, duration time.Duration) {
+	t.term.SetStatus([]string{})
+
+	elapsed := ui.FormatDuration(duration)
+	formattedAllBytesTotal := ui.FormatBytes(s.AllBytesTotal)
+
+	var summary string
+	if s.FilesFinished == s.FilesTotal && s.AllBytesWritten == s.AllBytesTotal {
+		summary = fmt.Sprintf("Summary: Restored %d files (%s) in %s", s.FilesTotal, formattedAllBytesTotal, elapsed)
+	} else {
+		formattedAllBytesWritten := ui.FormatBytes(s.AllBytesWritten)
+		summary = fmt.Sprintf("Summary: Restored %d / %d files (%s / %s) in %s",
+			s.FilesFinished, s.FilesTotal, formattedAllBytesWritten, formattedAllBytesTotal, elapsed)
+	}
+
+	t.P("%s\n", summary)
+}
@@ -13,9 +13,22 @@ import (
 // dirs). If false is returned, files are ignored and dirs are not even walked.
 type SelectByNameFunc func(item string) bool
 
+// NodeRewriteFunc returns the node which replaces node in the rewritten tree,
+// or nil to remove it. The node can be modified in place.
+type NodeRewriteFunc func(node *restic.Node, path string) *restic.Node
+
+// FailedTreeRewriteFunc is called for a tree which could not be loaded. It
+// returns the ID of the tree to use instead, or the null ID to remove the tree.
+type FailedTreeRewriteFunc func(nodeID restic.ID, path string, err error) (restic.ID, error)
+
 type TreeFilterVisitor struct {
 	SelectByName SelectByNameFunc
 	PrintExclude func(string)
+	// RewriteNode is called for all selected nodes except directories, if set.
+	RewriteNode NodeRewriteFunc
+	// RewriteFailedTree is called if a tree cannot be loaded, unless the
+	// context was canceled. If it is not set, the error is returned.
+	RewriteFailedTree FailedTreeRewriteFunc
 }
 
 type BlobLoadSaver interface {
@@ -26,6 +39,14 @@ type BlobLoadSaver interface {
 func FilterTree(ctx context.Context, repo BlobLoadSaver, nodepath string, nodeID restic.ID, visitor *TreeFilterVisitor) (newNodeID restic.ID, err error) {
 	curTree, err := restic.LoadTree(ctx, repo, nodeID)
 	if err != nil {
+		// a canceled context is no reason to replace the tree
+		if ctx.Err() != nil {
+			return restic.ID{}, ctx.Err()
+		}
+		if visitor != nil && visitor.RewriteFailedTree != nil {
+			debug.Log("filterTree: failed to load tree %v at %s: %v", nodeID.Str(), nodepath, err)
+			return visitor.RewriteFailedTree(nodeID, nodepath, err)
+		}
 		return restic.ID{}, err
 	}
 
@@ -55,6 +76,14 @@ func FilterTree(ctx context.Context, repo BlobLoadSaver, nodepath string, nodeID
 		}
 
 		if node.Subtree == nil {
+			if visitor.RewriteNode != nil {
+				node = visitor.RewriteNode(node, path)
+				if node == nil {
+					changed = true
+					continue
+				}
+			}
+
 			err = tb.AddNode(node)
 			if err != nil {
 				return restic.ID{}, err
@@ -68,6 +97,10 @@ func FilterTree(ctx context.Context, repo BlobLoadSaver, nodepath string, nodeID
 		if !node.Subtree.Equal(newID) {
 			changed = true
 		}
+		if newID.IsNull() {
+			// the subtree was removed
+			continue
+		}
 		node.Subtree = &newID
 		err = tb.AddNode(node)
 		if err != nil {
@@ -75,12 +108,17 @@ func FilterTree(ctx context.Context, repo BlobLoadSaver, nodepath string, nodeID
 		}
 	}
 
-	if changed {
+	if changed || visitor.RewriteNode != nil {
 		tree, err := tb.Finalize()
 		if err != nil {
 			return restic.ID{}, err
 		}
 
+		if !changed && restic.Hash(tree) == nodeID {
+			// RewriteNode did not modify any node
+			return nodeID, nil
+		}
+
 		// Save new tree
 		newTreeID, _, _, err := repo.SaveBlob(ctx, restic.TreeBlob, tree, restic.ID{}, false)
 		debug.Log("filterTree: save new tree for %s as %v\n", nodepath, newTreeID)
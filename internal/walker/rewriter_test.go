@@ -220,3 +220,94 @@ func TestRewriterFailOnUnknownFields(t *testing.T) {
 		t.Error("missing error on unknown field")
 	}
 }
+
+func TestRewriterRewriteNodeAndFailedTree(t *testing.T) {
+	repo, root := BuildTreeMap(TestTree{
+		"foo": TestFile{},
+		"bar": TestFile{},
+		"subdir": TestTree{
+			"subfile": TestFile{},
+		},
+	})
+	expRepo, expRoot := BuildTreeMap(TestTree{
+		"foo": TestFile{},
+	})
+
+	// remove the subdirectory from the repository
+	tree, err := restic.LoadTree(context.TODO(), repo, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, node := range tree.Nodes {
+		if node.Name == "subdir" {
+			delete(repo, *node.Subtree)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+
+	var failed []string
+	modrepo := WritableTreeMap{repo}
+	newRoot, err := FilterTree(ctx, modrepo, "/", root, &TreeFilterVisitor{
+		SelectByName: func(string) bool { return true },
+		RewriteNode: func(node *restic.Node, path string) *restic.Node {
+			if path == "/bar" {
+				return nil
+			}
+			return node
+		},
+		RewriteFailedTree: func(nodeID restic.ID, path string, err error) (restic.ID, error) {
+			failed = append(failed, path)
+			return restic.ID{}, nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !cmp.Equal(failed, []string{"/subdir"}) {
+		t.Errorf("unexpected failed trees: %v", failed)
+	}
+	if newRoot != expRoot {
+		t.Error("hash mismatch")
+		fmt.Println("Got")
+		modrepo.Dump()
+		fmt.Println("Expected")
+		WritableTreeMap{expRepo}.Dump()
+	}
+}
+
+func TestRewriterFailedTreeCanceled(t *testing.T) {
+	repo, root := BuildTreeMap(TestTree{
+		"foo": TestFile{},
+		"subdir": TestTree{
+			"subfile": TestFile{},
+		},
+	})
+
+	// remove the subdirectory from the repository
+	tree, err := restic.LoadTree(context.TODO(), repo, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, node := range tree.Nodes {
+		if node.Name == "subdir" {
+			delete(repo, *node.Subtree)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	cancel()
+
+	_, err = FilterTree(ctx, WritableTreeMap{repo}, "/", root, &TreeFilterVisitor{
+		SelectByName: func(string) bool { return true },
+		RewriteFailedTree: func(nodeID restic.ID, path string, err error) (restic.ID, error) {
+			t.Errorf("unexpected call for %v", path)
+			return restic.ID{}, nil
+		},
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
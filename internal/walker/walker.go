@@ -30,10 +30,22 @@ var ErrSkipNode = errors.New("skip this node")
 // ignore is ignored.
 type WalkFunc func(parentTreeID restic.ID, path string, node *restic.Node, nodeErr error) (ignore bool, err error)
 
+// LessFunc reports whether node a should be visited before node b when both
+// are contained in the same tree.
+type LessFunc func(a, b *restic.Node) bool
+
 // Walk calls walkFn recursively for each node in root. If walkFn returns an
 // error, it is passed up the call stack. The trees in ignoreTrees are not
-// walked. If walkFn ignores trees, these are added to the set.
+// walked. If walkFn ignores trees, these are added to the set. The nodes of
+// each tree are visited in the order of their names.
 func Walk(ctx context.Context, repo restic.BlobLoader, root restic.ID, ignoreTrees restic.IDSet, walkFn WalkFunc) error {
+	return WalkSorted(ctx, repo, root, ignoreTrees, nil, walkFn)
+}
+
+// WalkSorted works like Walk, but visits the nodes of each tree in the order
+// defined by less. Nodes for which less does not define an order are visited
+// in the order of their names. If less is nil, WalkSorted behaves like Walk.
+func WalkSorted(ctx context.Context, repo restic.BlobLoader, root restic.ID, ignoreTrees restic.IDSet, less LessFunc, walkFn WalkFunc) error {
 	tree, err := restic.LoadTree(ctx, repo, root)
 	_, err = walkFn(root, "/", nil, err)
 
@@ -48,14 +60,14 @@ func Walk(ctx context.Context, repo restic.BlobLoader, root restic.ID, ignoreTre
 		ignoreTrees = restic.NewIDSet()
 	}
 
-	_, err = walk(ctx, repo, "/", root, tree, ignoreTrees, walkFn)
+	_, err = walk(ctx, repo, "/", root, tree, ignoreTrees, less, walkFn)
 	return err
 }
 
 // walk recursively traverses the tree, ignoring subtrees when the ID of the
 // subtree is in ignoreTrees. If err is nil and ignore is true, the subtree ID
 // will be added to ignoreTrees by walk.
-func walk(ctx context.Context, repo restic.BlobLoader, prefix string, parentTreeID restic.ID, tree *restic.Tree, ignoreTrees restic.IDSet, walkFn WalkFunc) (ignore bool, err error) {
+func walk(ctx context.Context, repo restic.BlobLoader, prefix string, parentTreeID restic.ID, tree *restic.Tree, ignoreTrees restic.IDSet, less LessFunc, walkFn WalkFunc) (ignore bool, err error) {
 	var allNodesIgnored = true
 
 	if len(tree.Nodes) == 0 {
@@ -65,6 +77,11 @@ func walk(ctx context.Context, repo restic.BlobLoader, prefix string, parentTree
 	sort.Slice(tree.Nodes, func(i, j int) bool {
 		return tree.Nodes[i].Name < tree.Nodes[j].Name
 	})
+	if less != nil {
+		sort.SliceStable(tree.Nodes, func(i, j int) bool {
+			return less(tree.Nodes[i], tree.Nodes[j])
+		})
+	}
 
 	for _, node := range tree.Nodes {
 		p := path.Join(prefix, node.Name)
@@ -119,7 +136,7 @@ func walk(ctx context.Context, repo restic.BlobLoader, prefix string, parentTree
 			allNodesIgnored = false
 		}
 
-		ignore, err = walk(ctx, repo, p, *node.Subtree, subtree, ignoreTrees, walkFn)
+		ignore, err = walk(ctx, repo, p, *node.Subtree, subtree, ignoreTrees, less, walkFn)
 		if err != nil {
 			return false, err
 		}
@@ -560,3 +560,33 @@ func TestWalker(t *testing.T) {
 		})
 	}
 }
+
+func TestWalkerSorted(t *testing.T) {
+	repo, root := BuildTreeMap(TestTree{
+		"a": TestFile{},
+		"b": TestTree{
+			"x": TestFile{},
+			"y": TestFile{},
+		},
+		"c": TestFile{},
+	})
+
+	reverse := func(a, b *restic.Node) bool {
+		return a.Name > b.Name
+	}
+
+	fn, last := checkItemOrder([]string{
+		"/",
+		"/c",
+		"/b",
+		"/b/y",
+		"/b/x",
+		"/a",
+	})(t)
+
+	err := WalkSorted(context.TODO(), repo, root, restic.NewIDSet(), reverse, fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	last(t)
+}